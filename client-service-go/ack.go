@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ackSubcommand  = "ack"
+	ackDescription = "acknowledges an event, publishing the acknowledgment on events.ack and recording it with the reader"
+	// ackSubject carries acknowledgments, which the writer persists and follow mode uses to
+	// stop showing acknowledged events
+	ackSubject   = "events.ack"
+	ackQueryType = "acknowledge"
+)
+
+// Acknowledgment is the payload published on events.ack, named like the other events.*
+// payloads. The writer decodes the same structure to persist it.
+type Acknowledgment struct {
+	SchemaVersion  int    `json:"schemaVersion"`
+	EventID        string `json:"eventId"`
+	AcknowledgedBy string `json:"acknowledgedBy"`
+	Note           string `json:"note,omitempty"`
+	Timestamp      string `json:"timestamp"` // RFC3339 with nanoseconds, UTC
+}
+
+// ackSchemaVersion is the version of the Acknowledgment payload
+const ackSchemaVersion = 1
+
+// ackRecord is the data of an acknowledge response, the acknowledgment as the reader
+// recorded it. The contract with the reader:
+//
+//	request:  {"query_type": "acknowledge",
+//	           "params": {"event_id": "<uuid>", "acknowledged_by": "alice", "note": "...",
+//	                      "timestamp": "2024-05-01T12:00:00Z"}}
+//	response: {"status": "success",
+//	           "data": {"event_id": "<uuid>", "acknowledged_by": "alice", "note": "...",
+//	                    "timestamp": "2024-05-01T12:00:00Z"}}
+//
+// note may be empty. The timestamp is the acknowledgment's, the same as published on
+// events.ack, so that both records of it are one point.
+type ackRecord struct {
+	EventID        string `json:"event_id"`
+	AcknowledgedBy string `json:"acknowledged_by"`
+	Note           string `json:"note"`
+	Timestamp      string `json:"timestamp"`
+}
+
+// ackConfig is the acknowledgment the ack subcommand sends.
+type ackConfig struct {
+	eventID string // Canonical lower-case form
+	by      string
+	note    string
+}
+
+// Parses the flags of the ack subcommand, reporting flag syntax errors and -h like
+// parseSubcommand
+func parseAck(args []string, stderr io.Writer) (ackConfig, error) {
+	fs := flag.NewFlagSet("client "+ackSubcommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cfg := ackConfig{}
+	fs.StringVar(&cfg.eventID, "event-id", "", "ID of the event to acknowledge, a UUID (required)")
+	fs.StringVar(&cfg.by, "by", "", "who acknowledges the event (required)")
+	fs.StringVar(&cfg.note, "note", "", "optional note, e.g. the ticket tracking the event")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: client [global flags] %s --event-id <uuid> --by <name> [--note text]\n\nAcknowledges an event: %s.\n\nFlags:\n", ackSubcommand, ackDescription)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return cfg, err
+		}
+		return cfg, errUsageReported
+	}
+
+	var problems []error
+	if fs.NArg() > 0 {
+		problems = append(problems, fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	if cfg.eventID == "" {
+		problems = append(problems, errors.New("--event-id: is required"))
+	} else if id, err := parseEventID(cfg.eventID); err != nil {
+		problems = append(problems, fmt.Errorf("--event-id %w", err))
+	} else {
+		cfg.eventID = id
+	}
+	cfg.by = strings.TrimSpace(cfg.by)
+	if cfg.by == "" {
+		problems = append(problems, errors.New("--by: is required"))
+	}
+	for i, problem := range problems {
+		problems[i] = fmt.Errorf("%s: %w", ackSubcommand, problem)
+	}
+	return cfg, errors.Join(problems...)
+}
+
+// Parses an event ID, which must be a UUID in its 36 character form, and returns it in
+// lower case as the daemon publishes it
+func parseEventID(s string) (string, error) {
+	id, err := uuid.Parse(s)
+	if err != nil || len(s) != 36 {
+		return "", fmt.Errorf("%q: expected a UUID such as 0b8e4c2a-5f0e-4d3b-9a61-2c7f1e9d8a34", s)
+	}
+	return id.String(), nil
+}
+
+// Publishes the acknowledgment on events.ack, then has the reader record it, printing the
+// recorded acknowledgment to out. Returns the failure of the reader request, if any.
+func (c *client) runAck(cfg ackConfig, out io.Writer) (failureCode, error) {
+	ack := Acknowledgment{
+		SchemaVersion:  ackSchemaVersion,
+		EventID:        cfg.eventID,
+		AcknowledgedBy: cfg.by,
+		Note:           cfg.note,
+		Timestamp:      time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	payload, err := json.Marshal(ack)
+	if err != nil {
+		return failureClientError, err
+	}
+	logger.debugf("Publishing on '%s': %s", ackSubject, payload)
+	if err := c.nc.Publish(ackSubject, payload); err != nil {
+		return failureClientError, fmt.Errorf("Publishing the acknowledgment on '%s': %w", ackSubject, err)
+	}
+	if err := c.nc.FlushTimeout(c.timeout); err != nil {
+		return classifyFailure(err), fmt.Errorf("Publishing the acknowledgment on '%s': %w", ackSubject, err)
+	}
+	logger.verbosef("Published the acknowledgment of event %s on '%s'", ack.EventID, ackSubject)
+
+	request := ReaderRequest{
+		QueryType: ackQueryType,
+		Params: map[string]interface{}{
+			"event_id":        ack.EventID,
+			"acknowledged_by": ack.AcknowledgedBy,
+			"note":            ack.Note,
+			"timestamp":       ack.Timestamp,
+		},
+	}
+	ex, err := c.query(request, 0)
+	if err != nil {
+		return classifyFailure(err), fmt.Errorf("Event %s acknowledged on '%s', but the reader did not record it: %w", ack.EventID, ackSubject, err)
+	}
+	if ex.response.Status != "success" {
+		return failureReaderError, fmt.Errorf("Event %s acknowledged on '%s', but the reader did not record it: status %q: %s", ack.EventID, ackSubject, ex.response.Status, ex.response.Message)
+	}
+	record, _ := ex.typed.(ackRecord)
+	line := fmt.Sprintf("Acknowledged event %s by %s at %s", record.EventID, record.AcknowledgedBy, c.times.human(record.Timestamp))
+	if record.Note != "" {
+		line += ": " + record.Note
+	}
+	fmt.Fprintln(out, line)
+	return "", nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAck(t *testing.T) {
+	cfg, err := parseAck([]string{"--event-id", "0B8E4C2A-5F0E-4D3B-9A61-2C7F1E9D8A34", "--by", " alice ", "--note", "INC-42"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != (ackConfig{eventID: "0b8e4c2a-5f0e-4d3b-9a61-2c7f1e9d8a34", by: "alice", note: "INC-42"}) {
+		t.Errorf("parsed %+v, want the ID in lower case and the name trimmed", cfg)
+	}
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"ack: --event-id: is required", "ack: --by: is required"}},
+		{[]string{"--event-id", "0b8e4c2a5f0e4d3b9a612c7f1e9d8a34", "--by", "alice"}, []string{`ack: --event-id "0b8e4c2a5f0e4d3b9a612c7f1e9d8a34": expected a UUID`}},
+		{[]string{"--event-id", "ev-1", "--by", "   "}, []string{`--event-id "ev-1": expected a UUID`, "ack: --by: is required"}},
+		{[]string{"--event-id", "0b8e4c2a-5f0e-4d3b-9a61-2c7f1e9d8a34", "--by", "alice", "extra"}, []string{`ack: unexpected argument "extra"`}},
+	}
+	for _, tt := range tests {
+		_, err := parseAck(tt.args, io.Discard)
+		for _, want := range tt.want {
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("parseAck(%q) = %v, want it to report %q", tt.args, err, want)
+			}
+		}
+	}
+}
+
+// The acknowledgment is published on events.ack and recorded with the reader, both with
+// the same timestamp
+func TestRunAckPublishesAndRecords(t *testing.T) {
+	s := startFakeNATS(t)
+	requests := fakeReader(t, s, natsSubjectRequest, func(request ReaderRequest) ReaderResponse {
+		return ReaderResponse{Status: "success", Data: request.Params}
+	})
+	published, err := connectFake(t, s).SubscribeSync(ackSubject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, s)
+	if err := c.nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	cfg := ackConfig{eventID: "0b8e4c2a-5f0e-4d3b-9a61-2c7f1e9d8a34", by: "alice", note: "INC-42"}
+	if failure, err := c.runAck(cfg, &out); failure != "" || err != nil {
+		t.Fatalf("runAck = %q, %v", failure, err)
+	}
+
+	msg, err := published.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("nothing published on %s: %v", ackSubject, err)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(msg.Data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	timestamp, _ := payload["timestamp"].(string)
+	if _, err := time.Parse(time.RFC3339Nano, timestamp); err != nil || !strings.HasSuffix(timestamp, "Z") {
+		t.Errorf("timestamp %q, want RFC 3339 in UTC", timestamp)
+	}
+	want := map[string]interface{}{"schemaVersion": 1.0, "eventId": cfg.eventID, "acknowledgedBy": "alice", "note": "INC-42", "timestamp": timestamp}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("published %v, want %v", payload, want)
+	}
+
+	sent := requests()
+	wantParams := map[string]interface{}{"event_id": cfg.eventID, "acknowledged_by": "alice", "note": "INC-42", "timestamp": timestamp}
+	if len(sent) != 1 || sent[0].QueryType != ackQueryType || !reflect.DeepEqual(sent[0].Params, wantParams) {
+		t.Errorf("sent %+v, want one acknowledge request with %v", sent, wantParams)
+	}
+	if !strings.HasPrefix(out.String(), "Acknowledged event "+cfg.eventID+" by alice at ") || !strings.HasSuffix(out.String(), ": INC-42\n") {
+		t.Errorf("printed %q", out.String())
+	}
+}
+
+func TestRunAckReaderFailure(t *testing.T) {
+	s := startFakeNATS(t)
+	fakeReader(t, s, natsSubjectRequest, func(ReaderRequest) ReaderResponse {
+		return ReaderResponse{Status: "error", Message: "storage unavailable"}
+	})
+	c := newTestClient(t, s)
+	var out strings.Builder
+	failure, err := c.runAck(ackConfig{eventID: "0b8e4c2a-5f0e-4d3b-9a61-2c7f1e9d8a34", by: "alice"}, &out)
+	if failure != failureReaderError || err == nil || !strings.Contains(err.Error(), "acknowledged on 'events.ack', but the reader did not record it") || out.Len() != 0 {
+		t.Errorf("runAck = %q, %v, printing %q; want the reader's error", failure, err, out.String())
+	}
+}
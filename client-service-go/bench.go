@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	benchSubcommand  = "bench"
+	benchDescription = "load test: sends a query at a fixed rate and reports latency percentiles and errors"
+	benchAborted     = "aborted" // Error kind of the queries in flight at Ctrl-C
+)
+
+// benchConfig is the load a bench run puts on the reader.
+type benchConfig struct {
+	request  ReaderRequest
+	rate     float64 // Queries started per second
+	duration time.Duration
+	parallel int    // Queries in flight at most
+	jsonOut  string // Also receives the report as JSON, "-" for stdout, empty for none
+}
+
+// benchReport is the outcome of a bench run, also written as JSON for comparisons in CI.
+type benchReport struct {
+	QueryType    string         `json:"query_type"`
+	TargetRate   float64        `json:"target_rate"`
+	AchievedRate float64        `json:"achieved_rate"`
+	DurationSecs float64        `json:"duration_seconds"`
+	Parallel     int            `json:"parallel"`
+	Sent         int            `json:"sent"`
+	Succeeded    int            `json:"succeeded"`
+	Skipped      int            `json:"skipped"` // Ticks dropped because every worker was busy
+	Errors       map[string]int `json:"errors"`  // By kind: timeout, no_responders, reader_error, aborted, other
+	LatencyMs    benchLatencies `json:"latency_ms"`
+}
+
+// benchLatencies are the latencies of the queries the reader answered, in milliseconds.
+type benchLatencies struct {
+	Min  float64 `json:"min"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+// Parses the flags of the bench subcommand, reporting flag syntax errors and -h like
+// parseSubcommand
+func parseBench(args []string, stderr io.Writer) (benchConfig, error) {
+	fs := flag.NewFlagSet("client "+benchSubcommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	queryType := fs.String("query", "alerts_critical", "query type to send")
+	params := fs.String("params", "{}", `parameters of the query as a JSON object, e.g. '{"source_device": "DiskUnit"}'`)
+	cfg := benchConfig{}
+	fs.Float64Var(&cfg.rate, "rate", 10, "queries started per second")
+	fs.DurationVar(&cfg.duration, "duration", 30*time.Second, "how long to keep sending")
+	fs.IntVar(&cfg.parallel, "parallel", 10, "queries in flight at most; ticks finding every worker busy are skipped, not delayed")
+	fs.StringVar(&cfg.jsonOut, "json-out", "", "also write the report as JSON to this file, - for stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: client [global flags] %s [flags]\n\nRuns a %s.\n\nFlags:\n", benchSubcommand, benchDescription)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return cfg, err
+		}
+		return cfg, errUsageReported
+	}
+
+	var problems []error
+	if fs.NArg() > 0 {
+		problems = append(problems, fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	request, err := decodeRawRequest([]byte(fmt.Sprintf(`{"query_type": %q, "params": %s}`, *queryType, *params)))
+	if err != nil {
+		problems = append(problems, fmt.Errorf("--query and --params: %w", err))
+	}
+	cfg.request = request
+	if cfg.rate <= 0 {
+		problems = append(problems, fmt.Errorf("--rate %g: must be positive", cfg.rate))
+	}
+	if cfg.duration <= 0 {
+		problems = append(problems, fmt.Errorf("--duration %s: must be positive", cfg.duration))
+	}
+	if cfg.parallel < 1 {
+		problems = append(problems, fmt.Errorf("--parallel %d: must be at least 1", cfg.parallel))
+	}
+	for i, problem := range problems {
+		problems[i] = fmt.Errorf("%s: %w", benchSubcommand, problem)
+	}
+	return cfg, errors.Join(problems...)
+}
+
+// Sends the query at the configured rate until the duration is over or ctx is cancelled,
+// then waits for the queries in flight, which the client's context may abort. A ticker
+// paces the starts and a pool of workers sends them, so a slow response delays neither
+// the schedule nor the other queries. Queries are not retried, so that every failure
+// shows in the report.
+func (c *client) runBench(ctx context.Context, cfg benchConfig) benchReport {
+	bc := *c
+	bc.retry.maxAttempts = 1
+
+	type outcome struct {
+		latency time.Duration
+		kind    string // Empty on success
+	}
+	var mu sync.Mutex
+	var outcomes []outcome
+	skipped := 0
+
+	// Unbuffered, so that a tick only starts a query when a worker is idle, never late
+	ticks := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range ticks {
+				ex, err := bc.query(cfg.request, 0)
+				o := outcome{latency: ex.latency, kind: benchErrorKind(ex, err)}
+				mu.Lock()
+				outcomes = append(outcomes, o)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.rate))
+	deadline := time.NewTimer(cfg.duration)
+	defer deadline.Stop()
+send:
+	for {
+		select {
+		case <-ctx.Done():
+			break send
+		case <-deadline.C:
+			break send
+		case <-ticker.C:
+			select {
+			case ticks <- struct{}{}:
+			default:
+				skipped++
+			}
+		}
+	}
+	ticker.Stop()
+	elapsed := time.Since(start)
+	close(ticks)
+	wg.Wait()
+
+	report := benchReport{
+		QueryType:    cfg.request.QueryType,
+		TargetRate:   cfg.rate,
+		DurationSecs: math.Round(elapsed.Seconds()*1000) / 1000,
+		Parallel:     cfg.parallel,
+		Sent:         len(outcomes),
+		Skipped:      skipped,
+		Errors:       map[string]int{},
+	}
+	report.AchievedRate = math.Round(float64(report.Sent)/elapsed.Seconds()*100) / 100
+	var latencies []time.Duration
+	for _, o := range outcomes {
+		if o.kind == "" {
+			report.Succeeded++
+		} else {
+			report.Errors[o.kind]++
+		}
+		// Timeouts and missing readers say nothing about how fast the reader answers
+		if o.kind == "" || o.kind == "reader_error" {
+			latencies = append(latencies, o.latency)
+		}
+	}
+	report.LatencyMs = summarizeLatencies(latencies)
+	return report
+}
+
+func benchErrorKind(ex exchange, err error) string {
+	switch {
+	case errors.Is(err, nats.ErrTimeout):
+		return "timeout"
+	case errors.Is(err, nats.ErrNoResponders):
+		return "no_responders"
+	case errors.Is(err, context.Canceled):
+		return benchAborted
+	case err != nil:
+		return "other"
+	case ex.response.Status != "success":
+		return "reader_error"
+	}
+	return ""
+}
+
+func summarizeLatencies(latencies []time.Duration) benchLatencies {
+	if len(latencies) == 0 {
+		return benchLatencies{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	return benchLatencies{
+		Min:  milliseconds(latencies[0]),
+		P50:  milliseconds(percentile(latencies, 50)),
+		P90:  milliseconds(percentile(latencies, 90)),
+		P99:  milliseconds(percentile(latencies, 99)),
+		Max:  milliseconds(latencies[len(latencies)-1]),
+		Mean: milliseconds(total / time.Duration(len(latencies))),
+	}
+}
+
+// Returns the nearest-rank percentile p of the sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*100) / 100
+}
+
+func printBenchReport(out io.Writer, r benchReport) {
+	fmt.Fprintf(out, "Bench of %s: %d sent in %.1fs, %.1f/s achieved of %.1f/s targeted, %d in flight at most\n",
+		r.QueryType, r.Sent, r.DurationSecs, r.AchievedRate, r.TargetRate, r.Parallel)
+	fmt.Fprintf(out, "  succeeded     %d\n", r.Succeeded)
+	kinds := make([]string, 0, len(r.Errors))
+	for kind := range r.Errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(out, "  %-13s %d\n", kind, r.Errors[kind])
+	}
+	if r.Skipped > 0 {
+		fmt.Fprintf(out, "  skipped       %d (every worker busy, raise --parallel)\n", r.Skipped)
+	}
+	l := r.LatencyMs
+	fmt.Fprintf(out, "  latency ms    min %.2f  p50 %.2f  p90 %.2f  p99 %.2f  max %.2f  mean %.2f\n", l.Min, l.P50, l.P90, l.P99, l.Max, l.Mean)
+}
+
+// Writes the report as JSON to path, "-" meaning stdout
+func writeBenchJSON(path string, r benchReport) error {
+	out, err := openOutput(path, true, rotation{})
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return out.writeResult(string(data))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestSummarizeLatencies(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[len(latencies)-1-i] = time.Duration(i+1) * time.Millisecond // Unsorted
+	}
+	got := summarizeLatencies(latencies)
+	want := benchLatencies{Min: 1, P50: 50, P90: 90, P99: 99, Max: 100, Mean: 50.5}
+	if got != want {
+		t.Errorf("summarizeLatencies(1..100ms) = %+v, want %+v", got, want)
+	}
+	if got := summarizeLatencies([]time.Duration{7 * time.Millisecond}); got.P50 != 7 || got.P99 != 7 {
+		t.Errorf("percentiles of a single latency = %+v, want it everywhere", got)
+	}
+	if got := summarizeLatencies(nil); got != (benchLatencies{}) {
+		t.Errorf("summarizeLatencies(nil) = %+v, want zeros", got)
+	}
+}
+
+func TestBenchErrorKind(t *testing.T) {
+	success := exchange{response: ReaderResponse{Status: "success"}}
+	tests := []struct {
+		ex   exchange
+		err  error
+		want string
+	}{
+		{success, nil, ""},
+		{exchange{response: ReaderResponse{Status: "error"}}, nil, "reader_error"},
+		{exchange{}, nats.ErrTimeout, "timeout"},
+		{exchange{}, nats.ErrNoResponders, "no_responders"},
+		{exchange{}, context.Canceled, benchAborted},
+		{exchange{}, errors.New("connection closed"), "other"},
+	}
+	for _, tt := range tests {
+		if got := benchErrorKind(tt.ex, tt.err); got != tt.want {
+			t.Errorf("benchErrorKind(%q, %v) = %q, want %q", tt.ex.response.Status, tt.err, got, tt.want)
+		}
+	}
+}
+
+// Queries slower than the interval between them keep to the rate while workers are free,
+// and are skipped rather than delayed once every worker is busy
+func TestRunBenchKeepsThePace(t *testing.T) {
+	const latency, rate, duration = 200 * time.Millisecond, 20, time.Second
+	request := ReaderRequest{QueryType: "device_health", Params: map[string]interface{}{"source_device": "dev-01"}}
+	for _, tt := range []struct {
+		parallel    int
+		wantSkipped bool
+	}{
+		{parallel: 10},
+		{parallel: 1, wantSkipped: true},
+	} {
+		s := startFakeNATS(t)
+		slowReader(t, s, latency)
+		c := newTestClient(t, s)
+
+		r := c.runBench(context.Background(), benchConfig{request: request, rate: rate, duration: duration, parallel: tt.parallel})
+		if r.Succeeded != r.Sent || len(r.Errors) != 0 {
+			t.Errorf("parallel %d: %d of %d succeeded, errors %v", tt.parallel, r.Succeeded, r.Sent, r.Errors)
+		}
+		if r.LatencyMs.Min < milliseconds(latency) {
+			t.Errorf("parallel %d: fastest answer in %gms, below the reader's latency", tt.parallel, r.LatencyMs.Min)
+		}
+		if !tt.wantSkipped {
+			if r.Skipped != 0 || r.Sent < rate*9/10 {
+				t.Errorf("parallel %d: sent %d and skipped %d in %s at %d/s, want the rate kept", tt.parallel, r.Sent, r.Skipped, duration, rate)
+			}
+			continue
+		}
+		// One worker finishes a query every latency, so it takes one tick in four
+		if r.Skipped == 0 || r.Sent > int(duration/latency)+1 || r.Sent+r.Skipped < rate*9/10 {
+			t.Errorf("parallel %d: sent %d and skipped %d in %s at %d/s, want the ticks of a busy worker skipped", tt.parallel, r.Sent, r.Skipped, duration, rate)
+		}
+	}
+}
+
+func TestRunBenchAbortedQueries(t *testing.T) {
+	s := startFakeNATS(t)
+	slowReader(t, s, time.Minute)
+	c := newTestClient(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.ctx = ctx
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	request := ReaderRequest{QueryType: "device_health", Params: map[string]interface{}{"source_device": "dev-01"}}
+	r := c.runBench(ctx, benchConfig{request: request, rate: 10, duration: time.Minute, parallel: 5})
+	if r.Sent == 0 || r.Errors[benchAborted] != r.Sent || r.DurationSecs > 1 {
+		t.Errorf("sent %d with errors %v in %gs, want every query aborted soon after Ctrl-C", r.Sent, r.Errors, r.DurationSecs)
+	}
+}
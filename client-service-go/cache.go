@@ -0,0 +1,94 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const defaultCacheMaxEntries = 1000
+
+// responseCache keeps the gateway's successful responses for a while, so that dashboards
+// polling the same query every few seconds do not each reach the reader. Entries are keyed
+// on the query type and params; as they all live for the same TTL, the oldest entry is
+// also the first to expire, and is the one dropped when the cache is full. Safe for
+// concurrent use by the gateway's handlers.
+type responseCache struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // Of order, by key
+	order   *list.List               // *cacheEntry, oldest first
+}
+
+type cacheEntry struct {
+	key    string
+	ex     exchange
+	stored time.Time
+}
+
+func newResponseCache(ttl time.Duration, maxEntries int) *responseCache {
+	return &responseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+// Returns the cache key of a request: its query type and params as JSON, whose object keys
+// are sorted, so that the order the params were given in does not matter
+func cacheKey(request ReaderRequest) (string, bool) {
+	key, err := json.Marshal(struct {
+		QueryType string                 `json:"query_type"`
+		Params    map[string]interface{} `json:"params"`
+	}{request.QueryType, request.Params})
+	return string(key), err == nil
+}
+
+// Returns the cached exchange of the key and its age, unless it is missing or expired
+func (c *responseCache) get(key string) (exchange, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.dropExpired(now)
+	element, ok := c.entries[key]
+	if !ok {
+		return exchange{}, 0, false
+	}
+	entry := element.Value.(*cacheEntry)
+	return entry.ex, now.Sub(entry.stored), true
+}
+
+// Stores the exchange under the key, dropping the oldest entry when the cache is full
+func (c *responseCache) put(key string, ex exchange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.dropExpired(now)
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+	for c.order.Len() >= c.maxEntries {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	c.entries[key] = c.order.PushBack(&cacheEntry{key: key, ex: ex, stored: now})
+}
+
+func (c *responseCache) dropExpired(now time.Time) {
+	for oldest := c.order.Front(); oldest != nil; oldest = c.order.Front() {
+		entry := oldest.Value.(*cacheEntry)
+		if now.Sub(entry.stored) < c.ttl {
+			return
+		}
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to. The channels of After receive the
+// time once the clock reaches it.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), c: ch})
+	return ch
+}
+
+// Returns how many channels of After wait for the clock
+func (c *fakeClock) pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiting := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			waiting = append(waiting, timer)
+			continue
+		}
+		timer.c <- c.now
+	}
+	c.timers = waiting
+}
+
+func newTestCache(ttl time.Duration, maxEntries int) (*responseCache, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)}
+	cache := newResponseCache(ttl, maxEntries)
+	cache.now = clock.Now
+	return cache, clock
+}
+
+func TestCacheKey(t *testing.T) {
+	key := func(queryType string, params map[string]interface{}) string {
+		k, ok := cacheKey(ReaderRequest{QueryType: queryType, Params: params, RequestID: fmt.Sprint(len(params))})
+		if !ok {
+			t.Fatalf("no key for %s %v", queryType, params)
+		}
+		return k
+	}
+	a := key("metrics_avg", map[string]interface{}{"metric_type": "IOPs", "window_minutes": 5})
+	b := key("metrics_avg", map[string]interface{}{"window_minutes": 5, "metric_type": "IOPs"})
+	if a != b {
+		t.Errorf("keys %s and %s differ for the same params", a, b)
+	}
+	for _, other := range []string{
+		key("metrics_avg", map[string]interface{}{"metric_type": "IOPs", "window_minutes": 15}),
+		key("metrics_max", map[string]interface{}{"metric_type": "IOPs", "window_minutes": 5}),
+	} {
+		if other == a {
+			t.Errorf("key %s shared by different requests", a)
+		}
+	}
+}
+
+func TestResponseCacheHitsAndExpiry(t *testing.T) {
+	cache, clock := newTestCache(5*time.Second, 10)
+	if _, _, ok := cache.get("a"); ok {
+		t.Fatal("hit in an empty cache")
+	}
+	cache.put("a", exchange{request: ReaderRequest{RequestID: "req-a"}})
+	clock.advance(4 * time.Second)
+	if ex, age, ok := cache.get("a"); !ok || age != 4*time.Second || ex.request.RequestID != "req-a" {
+		t.Errorf("get = %v, %s, %t, want req-a cached 4s ago", ex.request.RequestID, age, ok)
+	}
+	clock.advance(time.Second)
+	if _, _, ok := cache.get("a"); ok {
+		t.Error("hit once the TTL is over")
+	}
+
+	// Storing again restarts the TTL
+	cache.put("a", exchange{})
+	clock.advance(3 * time.Second)
+	cache.put("a", exchange{request: ReaderRequest{RequestID: "req-a2"}})
+	clock.advance(3 * time.Second)
+	if ex, _, ok := cache.get("a"); !ok || ex.request.RequestID != "req-a2" {
+		t.Errorf("get = %v, %t, want the response stored last", ex.request.RequestID, ok)
+	}
+}
+
+func TestResponseCacheBound(t *testing.T) {
+	cache, clock := newTestCache(time.Minute, 2)
+	for _, key := range []string{"a", "b", "a", "c"} { // a stored again is newer than b
+		cache.put(key, exchange{request: ReaderRequest{RequestID: key}})
+		clock.advance(time.Second)
+	}
+	if cache.order.Len() != 2 || len(cache.entries) != 2 {
+		t.Errorf("holds %d entries (%d keys), want the bound of 2", cache.order.Len(), len(cache.entries))
+	}
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, _, ok := cache.get(key); ok != want {
+			t.Errorf("%s cached %t, want %t", key, ok, want)
+		}
+	}
+}
+
+// Successful responses are served from the cache until they expire; errors never are
+func TestGatewayCache(t *testing.T) {
+	cache, clock := newTestCache(5*time.Second, 10)
+	reader := &fakeRequester{respond: func(request ReaderRequest) (ReaderResponse, error) {
+		if request.Params["source_device"] == "missing" {
+			return ReaderResponse{Status: "error", Message: "unknown device"}, nil
+		}
+		return ReaderResponse{Status: "success", Data: map[string]interface{}{"device": request.Params["source_device"], "health": "ok"}}, nil
+	}}
+	gateway := newGateway(reader, 4, cache)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		gateway.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		return rec
+	}
+
+	steps := []struct {
+		target    string
+		advance   time.Duration
+		wantCache string
+		wantAge   string
+		wantSent  int
+	}{
+		{"/devices/dev-01/health", 0, "MISS", "", 1},
+		{"/devices/dev-01/health", 3 * time.Second, "HIT", "3", 1},
+		{"/devices/dev-02/health", 0, "MISS", "", 2},
+		{"/devices/dev-01/health", 2 * time.Second, "MISS", "", 3}, // Expired
+		{"/devices/missing/health", 0, "MISS", "", 4},
+		{"/devices/missing/health", 0, "MISS", "", 5},
+	}
+	for i, step := range steps {
+		clock.advance(step.advance)
+		rec := get(step.target)
+		if rec.Header().Get("X-Cache") != step.wantCache || rec.Header().Get("Age") != step.wantAge || len(reader.sent()) != step.wantSent {
+			t.Errorf("step %d, GET %s: X-Cache %q, Age %q, %d request(s) sent, want %s, %q and %d", i, step.target,
+				rec.Header().Get("X-Cache"), rec.Header().Get("Age"), len(reader.sent()), step.wantCache, step.wantAge, step.wantSent)
+		}
+		if step.wantCache == "HIT" && (rec.Code != http.StatusOK || rec.Header().Get("X-Request-ID") != "req-1") {
+			t.Errorf("step %d: cached response %d with request ID %q", i, rec.Code, rec.Header().Get("X-Request-ID"))
+		}
+	}
+
+	// Without a cache there is no X-Cache header
+	if rec := serveGateway(t, reader, "GET", "/devices/dev-01/health", ""); rec.Header().Get("X-Cache") != "" {
+		t.Errorf("X-Cache %q without a cache", rec.Header().Get("X-Cache"))
+	}
+}
+
+// Run with -race: the gateway's handlers share the cache
+func TestGatewayCacheConcurrentHandlers(t *testing.T) {
+	cache := newResponseCache(time.Minute, 8)
+	reader := &fakeRequester{respond: func(ReaderRequest) (ReaderResponse, error) {
+		return ReaderResponse{Status: "success", Data: []interface{}{}}, nil
+	}}
+	gateway := newGateway(reader, 64, cache)
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			gateway.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/devices/dev-%02d/health", i%16), nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("status %d: %s", rec.Code, rec.Body)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := cache.order.Len(); n > 8 || n != len(cache.entries) {
+		t.Errorf("cache holds %d entries and %d keys, want at most 8 of each", n, len(cache.entries))
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	checkSubcommand  = "check"
+	checkDescription = "checks a device's latest metric value against bounds and exits 0 (ok), 1 (breached) or 3 (no data)"
+)
+
+// checkConfig is the bound a check holds a device's metric to.
+type checkConfig struct {
+	device   string
+	metric   string
+	window   time.Duration // Samples considered for the latest value
+	min, max *float64      // Bounds, nil when not checked
+	retries  int           // Further attempts after a failed check
+	interval time.Duration // Pause between attempts
+}
+
+// checkVerdict is the outcome of a check.
+type checkVerdict struct {
+	code int // exitOK, exitFailure, exitNoData or exitInterrupted
+	line string
+}
+
+// Parses the flags of the check subcommand, reporting flag syntax errors and -h like
+// parseSubcommand
+func parseCheck(args []string, stderr io.Writer) (checkConfig, error) {
+	fs := flag.NewFlagSet("client "+checkSubcommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cfg := checkConfig{}
+	fs.StringVar(&cfg.device, "device", "", "device to check (required)")
+	fs.StringVar(&cfg.metric, "metric", "", "metric type, e.g. DiskTemp (required)")
+	fs.DurationVar(&cfg.window, "window", 5*time.Minute, "how recent the latest value must be, in whole minutes")
+	minValue := fs.Float64("min", 0, "fail when the latest value is below this")
+	maxValue := fs.Float64("max", 0, "fail when the latest value is above this")
+	fs.IntVar(&cfg.retries, "retries", 0, "check again this many times before failing")
+	fs.DurationVar(&cfg.interval, "interval", 10*time.Second, "pause between attempts")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: client [global flags] %s [flags]\n\nRuns a single check: %s.\n\nFlags:\n", checkSubcommand, checkDescription)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return cfg, err
+		}
+		return cfg, errUsageReported
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "min":
+			cfg.min = minValue
+		case "max":
+			cfg.max = maxValue
+		}
+	})
+
+	var problems []error
+	if fs.NArg() > 0 {
+		problems = append(problems, fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	if cfg.device == "" {
+		problems = append(problems, errors.New("--device: is required"))
+	}
+	if cfg.metric == "" {
+		problems = append(problems, errors.New("--metric: is required"))
+	}
+	if _, err := wholeMinutes("--window", cfg.window); err != nil {
+		problems = append(problems, err)
+	}
+	if cfg.min == nil && cfg.max == nil {
+		problems = append(problems, errors.New("--min or --max: at least one bound is required"))
+	}
+	if cfg.min != nil && cfg.max != nil && *cfg.min > *cfg.max {
+		problems = append(problems, fmt.Errorf("--min %g: must not exceed --max %g", *cfg.min, *cfg.max))
+	}
+	if cfg.retries < 0 {
+		problems = append(problems, fmt.Errorf("--retries %d: must not be negative", cfg.retries))
+	}
+	if cfg.interval < 0 {
+		problems = append(problems, fmt.Errorf("--interval %s: must not be negative", cfg.interval))
+	}
+	for i, problem := range problems {
+		problems[i] = fmt.Errorf("%s: %w", checkSubcommand, problem)
+	}
+	return cfg, errors.Join(problems...)
+}
+
+// Checks the latest value of the metric up to 1+retries times, stopping at the first pass
+// or when the client's context is cancelled, and returns the verdict of the last attempt
+func (c *client) runCheck(cfg checkConfig) checkVerdict {
+	var verdict checkVerdict
+	for attempt := 0; attempt <= cfg.retries; attempt++ {
+		if attempt > 0 {
+			logger.infof("Check attempt %d of %d: %s; retrying in %s", attempt, cfg.retries+1, verdict.line, cfg.interval)
+			select {
+			case <-time.After(cfg.interval):
+			case <-c.ctx.Done():
+				return verdict
+			}
+		}
+		verdict = c.checkOnce(cfg)
+		if verdict.code == exitOK {
+			break
+		}
+	}
+	return verdict
+}
+
+func (c *client) checkOnce(cfg checkConfig) checkVerdict {
+	windowMinutes, _ := wholeMinutes("--window", cfg.window)
+	request := ReaderRequest{
+		QueryType: "metric_summary",
+		Params: map[string]interface{}{
+			"source_device":  cfg.device,
+			"metric_type":    cfg.metric,
+			"window_minutes": windowMinutes,
+		},
+	}
+	ex, err := c.query(request, 0)
+	if errors.Is(err, context.Canceled) {
+		return checkVerdict{exitInterrupted, fmt.Sprintf("INTERRUPTED: %s %s not checked", cfg.device, cfg.metric)}
+	}
+	if err != nil {
+		return checkVerdict{exitFailure, fmt.Sprintf("ERROR: %s %s: %v", cfg.device, cfg.metric, err)}
+	}
+	if ex.response.Status != "success" {
+		return checkVerdict{exitFailure, fmt.Sprintf("ERROR: %s %s: reader returned status %q: %s", cfg.device, cfg.metric, ex.response.Status, ex.response.Message)}
+	}
+	summary, ok := ex.typed.(metricSummary)
+	if !ok || summary.Count == 0 {
+		return checkVerdict{exitNoData, fmt.Sprintf("NO DATA: no %s samples for %s in the last %d minute(s)", cfg.metric, cfg.device, windowMinutes)}
+	}
+	return judge(cfg, summary.Last)
+}
+
+// Compares the latest value with the bounds of the check
+func judge(cfg checkConfig, last float64) checkVerdict {
+	subject := fmt.Sprintf("%s %s latest %g", cfg.device, cfg.metric, last)
+	switch {
+	case cfg.max != nil && last > *cfg.max:
+		return checkVerdict{exitFailure, fmt.Sprintf("BREACH: %s is above the maximum %g", subject, *cfg.max)}
+	case cfg.min != nil && last < *cfg.min:
+		return checkVerdict{exitFailure, fmt.Sprintf("BREACH: %s is below the minimum %g", subject, *cfg.min)}
+	}
+	return checkVerdict{exitOK, fmt.Sprintf("OK: %s is within bounds", subject)}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// summaryReader answers metric_summary with the last value of the device named after it,
+// e.g. "60" for a breach of --max 55, a message for "nodata" and an error for anything else
+func summaryReader(request ReaderRequest) ReaderResponse {
+	device, _ := request.Params["source_device"].(string)
+	switch device {
+	case "nodata":
+		return ReaderResponse{Status: "success", Data: "no data"}
+	case "empty":
+		return ReaderResponse{Status: "success", Data: map[string]interface{}{"device": device, "metric": "DiskTemp", "count": 0, "min": 0, "max": 0, "mean": 0, "last": 0}}
+	case "40", "50", "60":
+		last := map[string]float64{"40": 40, "50": 50, "60": 60}[device]
+		return ReaderResponse{Status: "success", Data: map[string]interface{}{"device": device, "metric": "DiskTemp", "count": 12, "min": last, "max": last, "mean": last, "last": last}}
+	}
+	return ReaderResponse{Status: "error", Message: "unknown device"}
+}
+
+func TestParseCheck(t *testing.T) {
+	cfg, err := parseCheck([]string{"--device", "DiskUnit-0001", "--metric", "DiskTemp", "--min", "0", "--retries", "2"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.min == nil || *cfg.min != 0 || cfg.max != nil || cfg.retries != 2 {
+		t.Errorf("parsed %+v, want a minimum of 0 given explicitly and no maximum", cfg)
+	}
+
+	_, err = parseCheck([]string{"--window", "90s", "--min", "5", "--max", "1", "--retries", "-1"}, io.Discard)
+	for _, want := range []string{"--device: is required", "--metric: is required", "--window 1m30s", "--min 5: must not exceed --max 1", "--retries -1"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseCheck error %v, want it to report %q", err, want)
+		}
+	}
+	if _, err := parseCheck([]string{"--device", "d", "--metric", "m"}, io.Discard); err == nil || !strings.Contains(err.Error(), "at least one bound") {
+		t.Errorf("check without bounds: %v", err)
+	}
+}
+
+func TestRunCheckVerdicts(t *testing.T) {
+	s := startFakeNATS(t)
+	fakeReader(t, s, natsSubjectRequest, summaryReader)
+	c := newTestClient(t, s)
+	bound := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		device   string
+		min, max *float64
+		wantCode int
+		wantLine string
+	}{
+		{"50", nil, bound(55), exitOK, "OK: 50 DiskTemp latest 50 is within bounds"},
+		{"60", nil, bound(55), exitFailure, "BREACH: 60 DiskTemp latest 60 is above the maximum 55"},
+		{"40", bound(45), bound(55), exitFailure, "BREACH: 40 DiskTemp latest 40 is below the minimum 45"},
+		{"nodata", nil, bound(55), exitNoData, "NO DATA: no DiskTemp samples for nodata in the last 5 minute(s)"},
+		{"empty", nil, bound(55), exitNoData, "NO DATA"},
+		{"missing", nil, bound(55), exitFailure, `ERROR: missing DiskTemp: reader returned status "error": unknown device`},
+	}
+	for _, tt := range tests {
+		cfg := checkConfig{device: tt.device, metric: "DiskTemp", window: 5 * time.Minute, min: tt.min, max: tt.max}
+		verdict := c.runCheck(cfg)
+		if verdict.code != tt.wantCode || !strings.HasPrefix(verdict.line, tt.wantLine) {
+			t.Errorf("check of %s: %d %q, want %d %q", tt.device, verdict.code, verdict.line, tt.wantCode, tt.wantLine)
+		}
+	}
+}
+
+func TestRunCheckRetries(t *testing.T) {
+	s := startFakeNATS(t)
+	var breaches atomic.Int64 // Answered before the value is back within bounds
+	breaches.Store(2)
+	requests := fakeReader(t, s, natsSubjectRequest, func(ReaderRequest) ReaderResponse {
+		last := "50"
+		if breaches.Add(-1) >= 0 {
+			last = "60"
+		}
+		return summaryReader(ReaderRequest{Params: map[string]interface{}{"source_device": last}})
+	})
+	c := newTestClient(t, s)
+	limit := 55.0
+	cfg := checkConfig{device: "DiskUnit-0001", metric: "DiskTemp", window: 5 * time.Minute, max: &limit, retries: 5}
+	if verdict := c.runCheck(cfg); verdict.code != exitOK || len(requests()) != 3 {
+		t.Errorf("check = %+v after %d attempt(s), want a pass at the third", verdict, len(requests()))
+	}
+
+	cfg.retries = 1
+	breaches.Store(10)
+	if verdict := c.runCheck(cfg); verdict.code != exitFailure || len(requests()) != 5 {
+		t.Errorf("check = %+v after %d attempt(s) in all, want a breach after 2 more", verdict, len(requests()))
+	}
+}
+
+func TestRunCheckExitCodes(t *testing.T) {
+	s := startFakeNATS(t)
+	fakeReader(t, s, natsSubjectRequest, summaryReader)
+	for device, want := range map[string]int{"50": exitOK, "60": exitFailure, "nodata": exitNoData} {
+		if got := runClient(t, nil, "--nats-url", s.url(), "check", "--device", device, "--metric", "DiskTemp", "--max", "55"); got != want {
+			t.Errorf("check of %s exited %d, want %d", device, got, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ANSI colors of alerts and table rows by criticality
+const (
+	colorLow    = "\033[32m"   // Criticality 1 to 3, green
+	colorMedium = "\033[33m"   // Criticality 4 to 7, yellow
+	colorHigh   = "\033[1;31m" // Criticality 8 to 10, bold red
+	colorReset  = "\033[0m"
+)
+
+func criticalityColor(criticality int) string {
+	switch {
+	case criticality >= 8:
+		return colorHigh
+	case criticality >= 4:
+		return colorMedium
+	case criticality >= 1:
+		return colorLow
+	default:
+		return ""
+	}
+}
+
+// Wraps the text in the color of the criticality
+func colorize(text string, criticality int) string {
+	color := criticalityColor(criticality)
+	if color == "" {
+		return text
+	}
+	return color + text + colorReset
+}
+
+// Reports whether colors may be written to an output: it is a terminal, --no-color was not
+// given and NO_COLOR is unset. Files and pipes never get colors.
+func colorAllowed(noColor, terminal bool) bool {
+	return !noColor && terminal && os.Getenv("NO_COLOR") == ""
+}
+
+// Colors the rows of a table rendered by formatTable by their criticality column, if the
+// table has one. Colors wrap whole lines, after alignment, so the columns stay aligned.
+func colorTable(table string, columns []string, rows [][]string) string {
+	column := -1
+	for i, name := range columns {
+		if name == "criticality" {
+			column = i
+		}
+	}
+	if column < 0 || len(rows) == 0 {
+		return table
+	}
+	// formatTable writes the header, the separator line, then a line per row
+	lines := strings.Split(table, "\n")
+	for i, row := range rows {
+		if criticality, err := strconv.Atoi(row[column]); err == nil && i+2 < len(lines) {
+			lines[i+2] = colorize(lines[i+2], criticality)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestColorAllowed(t *testing.T) {
+	tests := []struct {
+		noColor, terminal bool
+		noColorEnv        string
+		want              bool
+	}{
+		{terminal: true, want: true},
+		{noColor: true, terminal: true},
+		{terminal: true, noColorEnv: "1"},
+		{}, // A file or a pipe
+	}
+	for _, tt := range tests {
+		t.Setenv("NO_COLOR", tt.noColorEnv)
+		if got := colorAllowed(tt.noColor, tt.terminal); got != tt.want {
+			t.Errorf("colorAllowed(%t, %t) with NO_COLOR=%q = %t, want %t", tt.noColor, tt.terminal, tt.noColorEnv, got, tt.want)
+		}
+	}
+}
+
+func TestCriticalityColor(t *testing.T) {
+	for criticality, want := range map[int]string{0: "", 1: colorLow, 3: colorLow, 4: colorMedium, 7: colorMedium, 8: colorHigh, 10: colorHigh} {
+		if got := criticalityColor(criticality); got != want {
+			t.Errorf("criticalityColor(%d) = %q, want %q", criticality, got, want)
+		}
+	}
+	if got := colorize("text", 0); got != "text" {
+		t.Errorf("colorize without a criticality = %q", got)
+	}
+}
+
+// Only the rows of tables on a terminal get colors, CSV and JSON never do
+func TestFormatResponseColors(t *testing.T) {
+	ex := responseFixture(t, "alerts_critical")
+	ex.typed, _, _ = decodeResponseData("alerts_critical", ex.response.Data)
+
+	table := (&client{output: outputTable, times: &timeFormatter{}, color: true}).formatResponse(ex)
+	lines := strings.Split(table, "\n")
+	// The header lines, the column names and their underline stay plain
+	for i, line := range lines {
+		switch {
+		case strings.Contains(line, "UnauthorizedAccess") || strings.Contains(line, "DriveFailure") || strings.Contains(line, "DataCorruption"):
+			if !strings.HasPrefix(line, colorHigh) || !strings.HasSuffix(line, colorReset) {
+				t.Errorf("line %d of criticality 8 or more not in bold red: %q", i, line)
+			}
+		case strings.Contains(line, "\033["):
+			t.Errorf("line %d colored: %q", i, line)
+		}
+	}
+
+	ex.typed.([]alertRow)[1].Criticality = 5
+	ex.typed.([]alertRow)[2].Criticality = 2
+	table = (&client{output: outputTable, times: &timeFormatter{}, color: true}).formatResponse(ex)
+	for _, want := range []string{colorHigh, colorMedium, colorLow} {
+		if strings.Count(table, want) != 1 {
+			t.Errorf("table has %d row(s) in %q, want 1:\n%s", strings.Count(table, want), want, table)
+		}
+	}
+
+	for _, c := range []*client{
+		{output: outputTable, times: &timeFormatter{}},
+		{output: outputCSV, times: &timeFormatter{}, color: true},
+		{output: outputJSON, times: &timeFormatter{}, color: true},
+		{output: outputJSONL, times: &timeFormatter{}, color: true},
+	} {
+		if got := c.formatResponse(ex); strings.Contains(got, "\033[") {
+			t.Errorf("%s output with color %t has ANSI codes:\n%s", c.output, c.color, got)
+		}
+	}
+}
+
+// Followed alerts are colored on the terminal and written plain to the file
+func TestFollowAlertsColors(t *testing.T) {
+	for _, color := range []bool{true, false} {
+		s := startFakeNATS(t)
+		c := newTestClient(t, s)
+		file, err := openOutput(filepath.Join(t.TempDir(), "alerts.log"), true, rotation{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		var terminal bytes.Buffer
+		done := make(chan error, 1)
+		go func() {
+			_, err := c.followAlerts(ctx, followConfig{subjects: []string{eventsSubject}, minCriticality: 1, color: color, file: file}, &terminal)
+			done <- err
+		}()
+		for c.nc.NumSubscriptions() < 2 { // The alerts and acknowledgments
+			time.Sleep(5 * time.Millisecond)
+		}
+		if err := c.nc.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		publisher := connectFake(t, s)
+		for i, criticality := range []int{2, 6, 9} {
+			data, _ := json.Marshal(alert{ID: string(rune('a' + i)), Criticality: criticality, Timestamp: "2025-01-01T10:00:00Z", SourceDevice: "DiskUnit-0001", EventType: "DriveFailure"})
+			if err := publisher.Publish(eventsSubject, data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := publisher.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.nc.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		lines := strings.Split(strings.TrimSpace(terminal.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("color %t: showed %q, want the 3 alerts", color, terminal.String())
+		}
+		for i, want := range []string{colorLow, colorMedium, colorHigh} {
+			if colored := strings.HasPrefix(lines[i], want); colored != color {
+				t.Errorf("color %t: line %q colored %t", color, lines[i], colored)
+			}
+		}
+		if written := readFile(t, file.name); strings.Contains(written, "\033[") || strings.Count(written, "\n") != 3 {
+			t.Errorf("color %t: file holds %q, want the 3 alerts without ANSI codes", color, written)
+		}
+	}
+}
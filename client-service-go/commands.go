@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type paramKind int
+
+const (
+	paramString paramKind = iota
+	paramInt
+	paramFloat
+)
+
+func (k paramKind) String() string {
+	switch k {
+	case paramInt:
+		return "integer"
+	case paramFloat:
+		return "number"
+	default:
+		return "text"
+	}
+}
+
+// commandParam is a positional argument of a command, sent as params[name].
+type commandParam struct {
+	name     string
+	kind     paramKind
+	required bool
+}
+
+// queryCommand maps a command typed in interactive mode to a reader query type.
+type queryCommand struct {
+	name        string
+	queryType   string
+	description string
+	params      []commandParam
+}
+
+// queryCommands lists the commands of interactive mode. Adding a query type only takes an entry here.
+var queryCommands = []queryCommand{
+	{
+		name:        "alerts",
+		queryType:   "alerts_critical",
+		description: "critical events of the last minutes",
+		params: []commandParam{
+			{name: "since_minutes", kind: paramInt},
+			{name: "min_criticality", kind: paramInt},
+		},
+	},
+	{
+		name:        "health",
+		queryType:   "device_health",
+		description: "health of a device derived from its latest metric",
+		params: []commandParam{
+			{name: "source_device", kind: paramString, required: true},
+		},
+	},
+	{
+		name:        "anomaly",
+		queryType:   "anomaly_temperature",
+		description: "temperature readings of a device deviating from its mean",
+		params: []commandParam{
+			{name: "source_device", kind: paramString, required: true},
+			{name: "threshold", kind: paramFloat},
+			{name: "window_minutes", kind: paramInt},
+		},
+	},
+	{
+		name:        "summary",
+		queryType:   "metric_summary",
+		description: "min, max, mean and last value of a device's metric",
+		params: []commandParam{
+			{name: "source_device", kind: paramString, required: true},
+			{name: "metric_type", kind: paramString, required: true},
+			{name: "window_minutes", kind: paramInt},
+		},
+	},
+	{
+		name:        "events",
+		queryType:   "events_by_type",
+		description: "event counts per device and event type",
+		params: []commandParam{
+			{name: "since_minutes", kind: paramInt},
+			{name: "source_device", kind: paramString},
+		},
+	},
+}
+
+// Returns the usage line of the command, e.g. "alerts [since_minutes] [min_criticality]"
+func (c queryCommand) usage() string {
+	parts := []string{c.name}
+	for _, p := range c.params {
+		if p.required {
+			parts = append(parts, "<"+p.name+">")
+		} else {
+			parts = append(parts, "["+p.name+"]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Parses a command line such as "alerts 15 8" into the reader request it stands for.
+// Omitted optional parameters are left to the reader's defaults.
+func parseCommand(line string) (ReaderRequest, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ReaderRequest{}, fmt.Errorf("empty command")
+	}
+	cmd, ok := findCommand(fields[0])
+	if !ok {
+		return ReaderRequest{}, fmt.Errorf("unknown command %q", fields[0])
+	}
+	args := fields[1:]
+	if len(args) > len(cmd.params) {
+		return ReaderRequest{}, fmt.Errorf("too many arguments, usage: %s", cmd.usage())
+	}
+
+	params := make(map[string]interface{})
+	for i, p := range cmd.params {
+		if i >= len(args) {
+			if p.required {
+				return ReaderRequest{}, fmt.Errorf("missing %s, usage: %s", p.name, cmd.usage())
+			}
+			continue
+		}
+		value, err := parseParam(p.kind, args[i])
+		if err != nil {
+			return ReaderRequest{}, fmt.Errorf("%s must be a %s, got %q", p.name, p.kind, args[i])
+		}
+		params[p.name] = value
+	}
+	return ReaderRequest{QueryType: cmd.queryType, Params: params}, nil
+}
+
+func findCommand(name string) (queryCommand, bool) {
+	for _, cmd := range queryCommands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return queryCommand{}, false
+}
+
+func parseParam(kind paramKind, arg string) (interface{}, error) {
+	switch kind {
+	case paramInt:
+		return strconv.Atoi(arg)
+	case paramFloat:
+		return strconv.ParseFloat(arg, 64)
+	default:
+		return arg, nil
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    ReaderRequest
+		wantErr string
+	}{
+		{line: "alerts", want: ReaderRequest{QueryType: "alerts_critical", Params: map[string]interface{}{}}},
+		{line: "alerts 15 8", want: ReaderRequest{QueryType: "alerts_critical", Params: map[string]interface{}{"since_minutes": 15, "min_criticality": 8}}},
+		{line: "  health   StorageArray-0001 ", want: ReaderRequest{QueryType: "device_health", Params: map[string]interface{}{"source_device": "StorageArray-0001"}}},
+		{line: "anomaly DiskUnit-0002 2.5", want: ReaderRequest{QueryType: "anomaly_temperature", Params: map[string]interface{}{"source_device": "DiskUnit-0002", "threshold": 2.5}}},
+		{line: "summary DiskUnit-0002 IOPs 30", want: ReaderRequest{QueryType: "metric_summary", Params: map[string]interface{}{"source_device": "DiskUnit-0002", "metric_type": "IOPs", "window_minutes": 30}}},
+		{line: "events 60", want: ReaderRequest{QueryType: "events_by_type", Params: map[string]interface{}{"since_minutes": 60}}},
+		{line: "", wantErr: "empty command"},
+		{line: "fleet", wantErr: `unknown command "fleet"`},
+		{line: "health", wantErr: "missing source_device, usage: health <source_device>"},
+		{line: "summary DiskUnit-0002", wantErr: "missing metric_type"},
+		{line: "alerts 15 8 extra", wantErr: "too many arguments, usage: alerts [since_minutes] [min_criticality]"},
+		{line: "alerts soon", wantErr: `since_minutes must be a integer, got "soon"`},
+		{line: "anomaly DiskUnit-0002 high", wantErr: `threshold must be a number, got "high"`},
+	}
+	for _, tt := range tests {
+		got, err := parseCommand(tt.line)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseCommand(%q) = %v, want error %q", tt.line, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCommand(%q) = %+v, %v, want %+v", tt.line, got, err, tt.want)
+		}
+	}
+}
+
+func TestQueryCommandsAreConsistent(t *testing.T) {
+	seen := map[string]bool{}
+	for _, cmd := range queryCommands {
+		if seen[cmd.name] {
+			t.Errorf("command %s listed twice", cmd.name)
+		}
+		seen[cmd.name] = true
+		optional := false
+		for _, p := range cmd.params {
+			if p.required && optional {
+				t.Errorf("%s: required %s follows an optional parameter, so it cannot be given alone", cmd.name, p.name)
+			}
+			optional = optional || !p.required
+		}
+		if found, ok := findCommand(cmd.name); !ok || found.queryType != cmd.queryType {
+			t.Errorf("findCommand(%s) = %+v, %t", cmd.name, found, ok)
+		}
+	}
+}
+
+func TestRunInteractive(t *testing.T) {
+	s := startFakeNATS(t)
+	requests := fakeReader(t, s, natsSubjectRequest, func(request ReaderRequest) ReaderResponse {
+		return ReaderResponse{Status: "success", Data: map[string]interface{}{"device": request.Params["source_device"], "health": "ok", "events_last_hour": 0, "metrics": []interface{}{}}}
+	})
+	c := newTestClient(t, s)
+
+	var out strings.Builder
+	c.runInteractive(strings.NewReader("help\n\nfleet\nhealth StorageArray-0001\nexit\nhealth never-sent\n"), &out)
+
+	for _, want := range []string{
+		"alerts [since_minutes] [min_criticality]", // help
+		`Error: unknown command "fleet"`,
+		"StorageArray-0001",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+	got := requests()
+	if len(got) != 1 || got[0].QueryType != "device_health" || got[0].Params["source_device"] != "StorageArray-0001" {
+		t.Errorf("reader received %+v, want the one health query before exit", got)
+	}
+}
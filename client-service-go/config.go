@@ -0,0 +1,435 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultMaxLogFiles = 5
+
+// Exit codes of the client.
+const (
+	exitOK      = 0
+	exitFailure = 1 // A query failed: an error status from the reader or no connection
+	exitUsage   = 2 // Invalid flags, environment variables or queries file
+	exitNoData  = 3 // client check found no recent value to check
+	// The first failed query of a batch or watch run timed out, found no reader subscribed
+	// or got a response it could not decode; see failureCode
+	exitTimeout      = 4
+	exitNoResponders = 5
+	exitDecodeError  = 6
+	// Stopped by Ctrl-C or SIGTERM before every query was run, as shells report it
+	exitInterrupted = 130
+)
+
+// errUsageReported is returned for command lines the flag package rejected, having printed
+// the problem and the usage already.
+var errUsageReported = errors.New("invalid command line")
+
+// options holds the command line of the client, with environment variables as defaults.
+type options struct {
+	natsURL         string // One URL, or the comma-separated servers of a cluster to fail over between
+	subject         string // Subject the reader answers queries on
+	connect         retryPolicy
+	timeout         time.Duration
+	streamTimeout   time.Duration // How long a response streamed in chunks may take in full
+	maxAttempts     int
+	retryBackoff    time.Duration
+	parallel        int
+	paging          pagingPolicy
+	failFast        bool
+	noReader        noReaderPolicy
+	interactive     bool
+	queriesFile     string
+	watch           time.Duration
+	watchFailures   int
+	queryType       string
+	subcommand      string // Name of the subcommand given after the global flags, if any
+	ack             *ackConfig
+	bench           *benchConfig
+	check           *checkConfig
+	diff            *diffConfig
+	schedule        []scheduledJob
+	saved           *savedQuery  // Of client run
+	listSaved       []savedQuery // Of client list-saved, non-nil to list them
+	device          string
+	output          outputFormat
+	outputFile      string
+	outputFileSet   bool // Whether --out was given rather than defaulted
+	truncate        bool
+	rotation        rotation
+	noColor         bool
+	noTruncate      bool           // Keeps the cells of tables on a terminal whole
+	columns         []string       // Of tables and CSV results, in this order; nil for all
+	times           *timeFormatter // From --tz and --time-format
+	csvOut          string
+	csvCombined     bool
+	followAlerts    bool
+	followSecurity  bool
+	minCriticality  int
+	serve           string // Address of the HTTP gateway, empty to run queries instead
+	serveInFlight   int
+	cacheTTL        time.Duration // How long the gateway serves a response from its cache, 0 disables it
+	cacheEntries    int
+	webhook         webhookTarget // url "" without
+	webhookTimeout  time.Duration
+	webhookAttempts int
+	logLevel        logLevel // From -q and -v
+	historyPath     string   // File recording the queries run, empty to record none
+
+	queries []plannedQuery // The default queries, those of the queries file or the --query one
+}
+
+// Parses the command line and the environment. Every invalid setting is reported at once.
+func parseOptions(args []string, stderr io.Writer) (*options, error) {
+	var problems []error
+	envTimeout, err := envDuration("REQUEST_TIMEOUT", defaultRequestTimeout)
+	problems = appendProblem(problems, err)
+	envMaxAttempts, err := envInt("REQUEST_MAX_ATTEMPTS", defaultMaxAttempts)
+	problems = appendProblem(problems, err)
+	envBackoff, err := envDuration("REQUEST_RETRY_BACKOFF", defaultRetryBackoff)
+	problems = appendProblem(problems, err)
+	envMinCriticality, err := envInt("CLIENT_MIN_CRITICALITY", defaultAlertCriticality)
+	problems = appendProblem(problems, err)
+	envConnectAttempts, err := envInt("NATS_CONNECT_ATTEMPTS", defaultConnectAttempts)
+	problems = appendProblem(problems, err)
+	envCacheTTL, err := envDuration("CLIENT_CACHE_TTL", 0)
+	problems = appendProblem(problems, err)
+
+	o := &options{}
+	var output string
+	fs := flag.NewFlagSet("client", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { printUsage(fs, stderr) }
+	fs.StringVar(&o.natsURL, "nats-url", envOr("NATS_URL", defaultNatsURL), "NATS server URL, e.g. nats://localhost:4222 outside docker-compose [NATS_URL]")
+	fs.StringVar(&o.subject, "subject", envOr("READER_SUBJECT", natsSubjectRequest), "NATS subject the reader answers queries on, e.g. reader.staging.query [READER_SUBJECT]")
+	natsURLs := fs.String("nats-urls", os.Getenv("NATS_URLS"), "comma-separated servers of one NATS cluster, tried in turn and failed over between; overrides --nats-url [NATS_URLS]")
+	fs.IntVar(&o.connect.maxAttempts, "connect-attempts", envConnectAttempts, "attempts to connect to NATS at startup, with a growing delay in between [NATS_CONNECT_ATTEMPTS]")
+	fs.DurationVar(&o.connect.backoff, "connect-backoff", defaultConnectBackoff, "delay before the second attempt to connect, doubled for every further one up to "+maxRetryBackoff.String())
+	fs.IntVar(&o.maxAttempts, "max-attempts", envMaxAttempts, "attempts per request when the reader times out or nobody is subscribed, 1 disables retries [REQUEST_MAX_ATTEMPTS]")
+	fs.DurationVar(&o.retryBackoff, "retry-backoff", envBackoff, "delay before the first retry, doubled for every further one up to "+maxRetryBackoff.String()+" [REQUEST_RETRY_BACKOFF]")
+	fs.IntVar(&o.parallel, "parallel", 1, "queries of a batch run in flight at once; results keep the order of the queries")
+	fs.IntVar(&o.paging.pageSize, "page-size", 0, "ask the reader for at most this many items per response, 0 leaves it to the reader")
+	fs.BoolVar(&o.paging.all, "all", false, "follow the reader's next_cursor and stitch every page of a result together")
+	fs.IntVar(&o.paging.maxPages, "max-pages", defaultMaxPages, "with --all, pages fetched at most per query before it fails")
+	fs.BoolVar(&o.failFast, "fail-fast", false, "stop a batch or watch run at the first failed query")
+	noReader := fs.String("on-no-reader", string(noReaderAbort), "what a batch run does once a query finds no reader subscribed to the subject: abort skips the remaining queries, continue runs them anyway; watch mode waits for a reader either way")
+	fs.DurationVar(&o.timeout, "timeout", envTimeout, "how long each request waits for the reader's response, unless its queries file entry sets one [REQUEST_TIMEOUT]")
+	fs.BoolVar(&o.interactive, "interactive", false, "read queries from stdin instead of running the default ones; implied when stdin is a terminal and no queries file is given")
+	fs.StringVar(&o.queriesFile, "queries", os.Getenv("CLIENT_QUERIES"), "YAML or JSON file listing the queries to run instead of the default ones [CLIENT_QUERIES]")
+	fs.DurationVar(&o.watch, "watch", 0, "re-run the queries at this interval, e.g. 30s, until interrupted; 0 runs them once")
+	fs.IntVar(&o.watchFailures, "watch-failures", defaultWatchFailureThreshold, "consecutive failures of a query in watch mode before it is flagged, 0 never flags")
+	fs.StringVar(&o.queryType, "query", "", "run only this query type instead of the default or file queries")
+	fs.StringVar(&o.device, "device", "", "source_device parameter of the --query query")
+	fs.StringVar(&output, "output", "", "result format: json, jsonl (a line of compact JSON per result), table (aligned columns) or csv; defaults to table on a terminal and json otherwise")
+	fs.StringVar(&o.outputFile, "out", defaultOutputFile, "file receiving the results of batch runs, - for stdout; watch and follow mode write there when it is given")
+	fs.StringVar(&o.outputFile, "output-file", defaultOutputFile, "same as --out")
+	fs.BoolVar(&o.truncate, "truncate", false, "empty the --out file before writing instead of appending to it")
+	fs.BoolVar(&o.noColor, "no-color", false, "never color tables and alerts by criticality; colors are only used on a terminal without NO_COLOR set")
+	fs.BoolVar(&o.noTruncate, "no-truncate", false, "never shorten the cells of tables to fit the terminal; tables written to files or pipes never are")
+	columns := fs.String("columns", "", "comma-separated columns of table and CSV results to show, in this order, e.g. source_device,criticality,event_type; a result without any of them shows all")
+	tz := fs.String("tz", "", "render timestamps in this zone, an IANA name such as Europe/Berlin or local; JSON, JSON lines and CSV results are converted too, to RFC 3339 in the zone")
+	timeFormat := fs.String("time-format", "", "render the timestamps of tables, watch headers and followed alerts in this format: rfc3339, datetime, short or a Go layout such as \"2006-01-02 15:04\"")
+	fs.StringVar(&o.csvOut, "csv-out", "", "also export tabular results as CSV, one file per query type named after this path, e.g. results.alerts_critical.csv for results.csv")
+	fs.BoolVar(&o.csvCombined, "csv-combined", false, "with --csv-out, write every query type to that one file under a query_type column")
+	maxLogSize := fs.String("max-log-size", "0", "rotate the --out file once it reaches this size, e.g. 10MB; 0 never rotates")
+	fs.IntVar(&o.rotation.maxFiles, "max-log-files", defaultMaxLogFiles, "rotated --out files kept, the oldest being removed")
+	fs.BoolVar(&o.followAlerts, "follow-alerts", false, "print the daemon's events on '"+eventsSubject+"' at or above --min-criticality as they arrive until Ctrl-C instead of running queries")
+	fs.BoolVar(&o.followSecurity, "follow-security", false, "with --follow-alerts, also print the security events on '"+securityEventsSubject+"'")
+	fs.IntVar(&o.minCriticality, "min-criticality", envMinCriticality, "with --follow-alerts, hide events below this criticality [CLIENT_MIN_CRITICALITY]")
+	fs.StringVar(&o.serve, "serve", os.Getenv("CLIENT_SERVE"), "serve the reader queries over HTTP on this address, e.g. :8080, instead of running queries [CLIENT_SERVE]")
+	fs.IntVar(&o.serveInFlight, "serve-max-in-flight", defaultServeMaxInFlight, "with --serve, queries answered at once; further ones get 503")
+	fs.DurationVar(&o.cacheTTL, "cache-ttl", envCacheTTL, "with --serve, answer repeated queries from a cache of the successful responses for this long, e.g. 5s; 0 disables it [CLIENT_CACHE_TTL]")
+	fs.IntVar(&o.cacheEntries, "cache-max-entries", defaultCacheMaxEntries, "with --cache-ttl, responses cached at most, the oldest being dropped")
+	fs.StringVar(&o.webhook.url, "webhook-url", os.Getenv("CLIENT_WEBHOOK_URL"), "POST every result of watch and schedule runs as JSON to this Slack-compatible or generic webhook [CLIENT_WEBHOOK_URL]")
+	fs.StringVar(&o.webhook.secret, "webhook-secret", os.Getenv("CLIENT_WEBHOOK_SECRET"), "sign webhook deliveries with HMAC-SHA256 of this secret in the "+webhookSignatureHeader+" header [CLIENT_WEBHOOK_SECRET]")
+	fs.DurationVar(&o.streamTimeout, "stream-timeout", defaultStreamTimeout, "how long a response the reader streams in chunks may take to arrive in full")
+	fs.DurationVar(&o.webhookTimeout, "webhook-timeout", defaultWebhookTimeout, "how long each webhook delivery attempt may take")
+	fs.IntVar(&o.webhookAttempts, "webhook-attempts", defaultWebhookAttempts, "attempts per webhook delivery when the webhook fails with a server error")
+	profile := fs.String("profile", os.Getenv("CLIENT_PROFILE"), "apply the flags of this profile of the --config file, flags given here winning [CLIENT_PROFILE]")
+	configPath := fs.String("config", envOr("CLIENT_CONFIG", defaultProfilesPath()), "YAML file of profiles for --profile [CLIENT_CONFIG]")
+	fs.StringVar(&o.historyPath, "history", envOr("CLIENT_HISTORY", defaultHistoryPath()), "record every query run, with its outcome, to this JSONL file for client replay; '' records none [CLIENT_HISTORY]")
+	quiet, verbosity := false, 0
+	fs.BoolVar(&quiet, "quiet", false, "write nothing to stderr but errors, and no summaries or headers with the results")
+	fs.BoolVar(&quiet, "q", false, "same as --quiet")
+	fs.Var(verboseFlag{&verbosity, 1}, "v", "also log every request with its subject and timing, retries and connection events; -vv or -v -v adds the raw request and response payloads")
+	fs.Var(verboseFlag{&verbosity, 2}, "vv", "same as -v -v")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errUsageReported
+	}
+	if *profile != "" {
+		problems = appendProblem(problems, applyProfile(fs, *configPath, *profile))
+	}
+	fs.Visit(func(f *flag.Flag) { o.outputFileSet = o.outputFileSet || f.Name == "out" || f.Name == "output-file" })
+
+	if *natsURLs != "" {
+		var urls []string
+		for _, u := range strings.Split(*natsURLs, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				urls = append(urls, u)
+			}
+		}
+		if len(urls) == 0 {
+			problems = append(problems, fmt.Errorf("--nats-urls %q: lists no server", *natsURLs))
+		}
+		o.natsURL = strings.Join(urls, ",")
+	}
+	o.columns = parseColumns(*columns)
+	o.times, err = newTimeFormatter(*tz, *timeFormat)
+	problems = appendProblem(problems, err)
+	switch o.noReader = noReaderPolicy(*noReader); o.noReader {
+	case noReaderAbort, noReaderContinue:
+	default:
+		problems = append(problems, fmt.Errorf("--on-no-reader %q: expected %s or %s", *noReader, noReaderAbort, noReaderContinue))
+	}
+	// An empty format is chosen once the output is known, see run
+	if output != "" {
+		if o.output, err = parseOutputFormat(output); err != nil {
+			problems = append(problems, fmt.Errorf("--output: %w", err))
+		}
+	}
+	if o.connect.maxAttempts < 1 {
+		problems = append(problems, fmt.Errorf("--connect-attempts %d: must be at least 1", o.connect.maxAttempts))
+	}
+	if o.connect.backoff < 0 {
+		problems = append(problems, fmt.Errorf("--connect-backoff %s: must not be negative", o.connect.backoff))
+	}
+	if o.subject == "" {
+		problems = append(problems, errors.New("--subject: must not be empty"))
+	}
+	if o.timeout <= 0 {
+		problems = append(problems, fmt.Errorf("--timeout %s: must be positive", o.timeout))
+	}
+	if o.parallel < 1 {
+		problems = append(problems, fmt.Errorf("--parallel %d: must be at least 1", o.parallel))
+	}
+	if o.paging.pageSize < 0 {
+		problems = append(problems, fmt.Errorf("--page-size %d: must not be negative", o.paging.pageSize))
+	}
+	if o.paging.maxPages < 1 {
+		problems = append(problems, fmt.Errorf("--max-pages %d: must be at least 1", o.paging.maxPages))
+	}
+	if o.maxAttempts < 1 {
+		problems = append(problems, fmt.Errorf("--max-attempts %d: must be at least 1", o.maxAttempts))
+	}
+	if o.retryBackoff < 0 {
+		problems = append(problems, fmt.Errorf("--retry-backoff %s: must not be negative", o.retryBackoff))
+	}
+	if o.rotation.maxSize, err = parseSize(*maxLogSize); err != nil {
+		problems = append(problems, fmt.Errorf("--max-log-size: %w", err))
+	}
+	if o.rotation.maxFiles < 0 {
+		problems = append(problems, fmt.Errorf("--max-log-files %d: must not be negative", o.rotation.maxFiles))
+	}
+	if o.serveInFlight < 1 {
+		problems = append(problems, fmt.Errorf("--serve-max-in-flight %d: must be at least 1", o.serveInFlight))
+	}
+	o.logLevel = logLevel(min(verbosity, int(levelDebug)))
+	if quiet {
+		o.logLevel = levelQuiet
+		if verbosity > 0 {
+			problems = append(problems, errors.New("--quiet: cannot be combined with -v"))
+		}
+	}
+	if o.webhook.url != "" {
+		if err := validateWebhookURL(o.webhook.url); err != nil {
+			problems = append(problems, fmt.Errorf("--webhook-url %w", err))
+		}
+	}
+	if o.streamTimeout <= 0 {
+		problems = append(problems, fmt.Errorf("--stream-timeout %s: must be positive", o.streamTimeout))
+	}
+	if o.webhookTimeout <= 0 {
+		problems = append(problems, fmt.Errorf("--webhook-timeout %s: must be positive", o.webhookTimeout))
+	}
+	if o.webhookAttempts < 1 {
+		problems = append(problems, fmt.Errorf("--webhook-attempts %d: must be at least 1", o.webhookAttempts))
+	}
+	if o.cacheTTL < 0 {
+		problems = append(problems, fmt.Errorf("--cache-ttl %s: must not be negative", o.cacheTTL))
+	}
+	if o.cacheEntries < 1 {
+		problems = append(problems, fmt.Errorf("--cache-max-entries %d: must be at least 1", o.cacheEntries))
+	}
+	if o.outputFile == "" {
+		problems = append(problems, errors.New("--out: must be a path or - for stdout"))
+	}
+	if o.watch < 0 {
+		problems = append(problems, fmt.Errorf("--watch %s: must not be negative", o.watch))
+	}
+
+	o.queries = defaultQueries()
+	if o.queriesFile != "" {
+		if o.queries, err = loadQueries(o.queriesFile); err != nil {
+			problems = append(problems, fmt.Errorf("queries file: %w", err))
+		}
+	}
+	if o.queryType != "" {
+		params := map[string]interface{}{}
+		if o.device != "" {
+			params["source_device"] = o.device
+		}
+		o.queries = []plannedQuery{{request: ReaderRequest{QueryType: o.queryType, Params: params}, repeat: 1}}
+	}
+	if fs.Arg(0) == ackSubcommand {
+		ack, err := parseAck(fs.Args()[1:], stderr)
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, errUsageReported) {
+			return nil, err
+		}
+		o.subcommand, o.ack = ackSubcommand, &ack
+		problems = appendProblem(problems, err)
+	} else if fs.Arg(0) == benchSubcommand {
+		bench, err := parseBench(fs.Args()[1:], stderr)
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, errUsageReported) {
+			return nil, err
+		}
+		o.subcommand, o.bench = benchSubcommand, &bench
+		problems = appendProblem(problems, err)
+	} else if fs.Arg(0) == checkSubcommand {
+		check, err := parseCheck(fs.Args()[1:], stderr)
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, errUsageReported) {
+			return nil, err
+		}
+		o.subcommand, o.check = checkSubcommand, &check
+		problems = appendProblem(problems, err)
+	} else if fs.Arg(0) == diffSubcommand {
+		diff, err := parseDiff(fs.Args()[1:], stderr)
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, errUsageReported) {
+			return nil, err
+		}
+		o.subcommand, o.diff = diffSubcommand, &diff
+		problems = appendProblem(problems, err)
+	} else if fs.Arg(0) == scheduleSubcommand {
+		jobs, err := parseSchedule(fs.Args()[1:], *configPath, stderr)
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, errUsageReported) {
+			return nil, err
+		}
+		o.subcommand, o.schedule = scheduleSubcommand, jobs
+		problems = appendProblem(problems, err)
+	} else if fs.Arg(0) == runSubcommand {
+		saved, err := parseRun(fs.Args()[1:], *configPath, stderr)
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, errUsageReported) {
+			return nil, err
+		}
+		o.subcommand = runSubcommand
+		switch {
+		case err != nil:
+			problems = append(problems, err)
+		case o.queryType != "" || o.queriesFile != "":
+			problems = append(problems, fmt.Errorf("%s: cannot be combined with --query or --queries", o.subcommand))
+		default:
+			o.saved, o.queries = &saved, []plannedQuery{saved.query}
+			// --output wins over the format saved with the query
+			if o.output == "" {
+				o.output = saved.output
+			}
+		}
+	} else if fs.Arg(0) == listSavedSubcommand {
+		saved, err := parseListSaved(fs.Args()[1:], *configPath, stderr)
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, errUsageReported) {
+			return nil, err
+		}
+		o.subcommand, o.listSaved = listSavedSubcommand, saved
+		if o.listSaved == nil {
+			o.listSaved = []savedQuery{}
+		}
+		problems = appendProblem(problems, err)
+	} else if fs.Arg(0) == querySubcommand {
+		queries, err := parseQuerySource(fs.Args()[1:], os.Stdin, stderr)
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, errUsageReported) {
+			return nil, err
+		}
+		o.subcommand = querySubcommand
+		switch {
+		case err != nil:
+			problems = append(problems, err)
+		case o.queryType != "" || o.queriesFile != "":
+			problems = append(problems, fmt.Errorf("%s: cannot be combined with --query or --queries", o.subcommand))
+		default:
+			o.queries = queries
+		}
+	} else if fs.Arg(0) == replaySubcommand {
+		queries, err := parseReplay(fs.Args()[1:], stderr)
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, errUsageReported) {
+			return nil, err
+		}
+		o.subcommand = replaySubcommand
+		switch {
+		case err != nil:
+			problems = append(problems, err)
+		case o.queryType != "" || o.queriesFile != "":
+			problems = append(problems, fmt.Errorf("%s: cannot be combined with --query or --queries", o.subcommand))
+		default:
+			o.queries = queries
+		}
+	} else if fs.NArg() > 0 {
+		request, err := parseSubcommand(fs.Args(), stderr)
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, errUsageReported) {
+			return nil, err
+		}
+		o.subcommand = fs.Arg(0)
+		switch {
+		case err != nil:
+			problems = append(problems, err)
+		case o.queryType != "" || o.queriesFile != "":
+			problems = append(problems, fmt.Errorf("%s: cannot be combined with --query or --queries", o.subcommand))
+		default:
+			o.queries = []plannedQuery{{request: request, repeat: 1}}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+	return o, nil
+}
+
+func appendProblem(problems []error, err error) []error {
+	if err != nil {
+		return append(problems, err)
+	}
+	return problems
+}
+
+// Returns the environment variable, or def when it is unset or empty
+func envOr(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// Returns the environment variable parsed with time.ParseDuration, or def when it is unset
+// or invalid
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return def, fmt.Errorf("%s=%q is not a duration such as 10s", name, value)
+	}
+	return d, nil
+}
+
+// Returns the environment variable parsed as an integer, or def when it is unset or invalid
+func envInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def, fmt.Errorf("%s=%q is not an integer", name, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clientEnv lists the environment variables the client reads, cleared by parseTestOptions
+var clientEnv = []string{
+	"NATS_URL", "NATS_URLS", "READER_SUBJECT", "REQUEST_TIMEOUT", "REQUEST_MAX_ATTEMPTS", "REQUEST_RETRY_BACKOFF",
+	"CLIENT_MIN_CRITICALITY", "NATS_CONNECT_ATTEMPTS", "CLIENT_CACHE_TTL", "CLIENT_QUERIES", "CLIENT_SERVE",
+	"CLIENT_WEBHOOK_URL", "CLIENT_WEBHOOK_SECRET", "CLIENT_PROFILE", "CLIENT_CONFIG", "CLIENT_HISTORY",
+}
+
+// parseTestOptions parses the command line in the environment env, every other variable
+// of the client unset
+func parseTestOptions(t *testing.T, env map[string]string, args ...string) (*options, error) {
+	t.Helper()
+	for _, name := range clientEnv {
+		t.Setenv(name, env[name])
+	}
+	return parseOptions(args, io.Discard)
+}
+
+func TestTimeoutAndNatsURLPrecedence(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		args        []string
+		wantURL     string
+		wantTimeout time.Duration
+	}{
+		{name: "defaults", wantURL: defaultNatsURL, wantTimeout: defaultRequestTimeout},
+		{name: "environment", env: map[string]string{"NATS_URL": "nats://localhost:4222", "REQUEST_TIMEOUT": "3s"}, wantURL: "nats://localhost:4222", wantTimeout: 3 * time.Second},
+		{name: "flags", args: []string{"--nats-url", "nats://127.0.0.1:4222", "--timeout", "750ms"}, wantURL: "nats://127.0.0.1:4222", wantTimeout: 750 * time.Millisecond},
+		{
+			name:    "flags over environment",
+			env:     map[string]string{"NATS_URL": "nats://localhost:4222", "REQUEST_TIMEOUT": "3s"},
+			args:    []string{"--nats-url", "nats://127.0.0.1:4222", "--timeout", "750ms"},
+			wantURL: "nats://127.0.0.1:4222", wantTimeout: 750 * time.Millisecond,
+		},
+		{
+			name:    "cluster over single server",
+			env:     map[string]string{"NATS_URL": "nats://localhost:4222", "NATS_URLS": "nats://a:4222, nats://b:4222,"},
+			wantURL: "nats://a:4222,nats://b:4222", wantTimeout: defaultRequestTimeout,
+		},
+		{
+			name:    "cluster flag over environment",
+			env:     map[string]string{"NATS_URLS": "nats://a:4222,nats://b:4222"},
+			args:    []string{"--nats-urls", "nats://c:4222"},
+			wantURL: "nats://c:4222", wantTimeout: defaultRequestTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := parseTestOptions(t, tt.env, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.natsURL != tt.wantURL || o.timeout != tt.wantTimeout {
+				t.Errorf("NATS at %s with timeout %s, want %s and %s", o.natsURL, o.timeout, tt.wantURL, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestParseOptionsReportsEveryProblem(t *testing.T) {
+	_, err := parseTestOptions(t, map[string]string{"REQUEST_TIMEOUT": "soon", "REQUEST_MAX_ATTEMPTS": "few"}, "--timeout", "0s", "--nats-urls", ",", "--parallel", "0")
+	if err == nil {
+		t.Fatal("parseOptions accepted invalid settings")
+	}
+	for _, want := range []string{
+		`REQUEST_TIMEOUT="soon" is not a duration such as 10s`,
+		`REQUEST_MAX_ATTEMPTS="few" is not an integer`,
+		"--timeout 0s: must be positive",
+		`--nats-urls ",": lists no server`,
+		"--parallel 0: must be at least 1",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not report %q:\n%v", want, err)
+		}
+	}
+
+	// An invalid variable is reported even when its flag overrides it
+	if _, err := parseTestOptions(t, map[string]string{"REQUEST_TIMEOUT": "soon"}, "--timeout", "1s"); err == nil {
+		t.Error("invalid REQUEST_TIMEOUT not reported")
+	}
+}
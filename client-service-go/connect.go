@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	defaultConnectAttempts = 5
+	defaultConnectBackoff  = time.Second
+)
+
+// Connects to NATS, trying again with a growing delay while the server may just not be up
+// yet, as when the client starts along with it. Every failed attempt is logged to stderr
+// with its diagnosis. Rejected credentials are not retried.
+func connectNATS(url string, policy retryPolicy, opts ...nats.Option) (*nats.Conn, error) {
+	for attempt := 1; ; attempt++ {
+		logger.verbosef("Connecting to NATS at %s (attempt %d of %d)", url, attempt, policy.maxAttempts)
+		nc, err := nats.Connect(url, opts...)
+		if err == nil {
+			return nc, nil
+		}
+		if isAuthError(err) || attempt >= policy.maxAttempts {
+			return nil, errors.New(describeConnectError(err))
+		}
+		delay := policy.delay(attempt)
+		logger.infof("Failed to connect to NATS at %s (attempt %d of %d): %s; retrying in %s", url, attempt, policy.maxAttempts, describeConnectError(err), delay)
+		time.Sleep(delay)
+	}
+}
+
+func isAuthError(err error) bool {
+	return errors.Is(err, nats.ErrAuthorization) || errors.Is(err, nats.ErrAuthExpired) ||
+		errors.Is(err, nats.ErrAuthRevoked) || errors.Is(err, nats.ErrAccountAuthExpired)
+}
+
+// Explains why connecting failed, with a hint at the usual fix
+func describeConnectError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return fmt.Sprintf("cannot resolve the host %q (%v); check the host in --nats-url, nats://nats:4222 only resolves inside docker-compose, use nats://localhost:4222 outside", dnsErr.Name, err)
+	case errors.Is(err, nats.ErrNoServers), errors.Is(err, syscall.ECONNREFUSED):
+		// The NATS client reports refused connections as no servers being available
+		return fmt.Sprintf("connection refused (%v); check that the NATS server is running and listening on that port", err)
+	case isAuthError(err):
+		return fmt.Sprintf("the server rejected the credentials (%v); check the user and password or token in the URL", err)
+	case errors.Is(err, nats.ErrTimeout), errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Sprintf("timed out (%v); check that the server is reachable from here and not blocked by a firewall", err)
+	}
+	return err.Error()
+}
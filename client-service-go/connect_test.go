@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// servedBy answers every query with the name of the server it came through
+func servedBy(t *testing.T, s *fakeNATS, name string) {
+	t.Helper()
+	fakeReader(t, s, natsSubjectRequest, func(ReaderRequest) ReaderResponse {
+		return ReaderResponse{Status: "success", Data: name}
+	})
+}
+
+func TestConnectFailsOverToTheNextServer(t *testing.T) {
+	first, second := startFakeNATS(t), startFakeNATS(t)
+	first.stop()
+
+	nc, err := connectNATS(first.url()+","+second.url(), retryPolicy{maxAttempts: 1}, nats.DontRandomize())
+	if err != nil {
+		t.Fatalf("connectNATS with the first server down: %v", err)
+	}
+	defer nc.Close()
+	if nc.ConnectedUrl() != second.url() {
+		t.Errorf("connected to %s, want the second server %s", nc.ConnectedUrl(), second.url())
+	}
+
+	if _, err := connectNATS(first.url(), retryPolicy{maxAttempts: 1}); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("connectNATS with the only server down = %v, want the connection refused", err)
+	}
+}
+
+// A long-running client keeps going on the second server once the first goes away
+func TestClientSurvivesAFailover(t *testing.T) {
+	first, second := startFakeNATS(t), startFakeNATS(t)
+	servedBy(t, first, "first")
+	servedBy(t, second, "second")
+
+	reconnected := make(chan string, 1)
+	nc, err := connectNATS(first.url()+","+second.url(), retryPolicy{maxAttempts: 1},
+		nats.DontRandomize(), nats.MaxReconnects(-1), nats.ReconnectWait(10*time.Millisecond),
+		nats.ReconnectHandler(func(nc *nats.Conn) { reconnected <- nc.ConnectedUrl() }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	c := newTestClient(t, first)
+	c.nc = nc
+
+	ask := func() string {
+		t.Helper()
+		msg, _, err := c.requestWithRetry(ReaderRequest{QueryType: "device_list"}, []byte(`{}`), time.Second)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		var response ReaderResponse
+		if err := json.Unmarshal(msg.Data, &response); err != nil {
+			t.Fatal(err)
+		}
+		name, _ := response.Data.(string)
+		return name
+	}
+	if got := ask(); got != "first" {
+		t.Fatalf("answered by the %s server, want the first", got)
+	}
+
+	first.stop()
+	select {
+	case url := <-reconnected:
+		if url != second.url() {
+			t.Errorf("reconnected to %s, want the second server %s", url, second.url())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("never reconnected after the first server stopped")
+	}
+	if got := ask(); got != "second" {
+		t.Errorf("answered by the %s server after the failover, want the second", got)
+	}
+}
+
+func TestDescribeConnectError(t *testing.T) {
+	timeout := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&net.DNSError{Err: "no such host", Name: "nats", IsNotFound: true}, `cannot resolve the host "nats"`},
+		{fmt.Errorf("dial: %w", &net.DNSError{Err: "server misbehaving", Name: "nats.internal", IsTemporary: true}), `cannot resolve the host "nats.internal"`},
+		{nats.ErrNoServers, "connection refused"},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, "connection refused"},
+		{nats.ErrAuthorization, "the server rejected the credentials"},
+		{fmt.Errorf("nats: %w", nats.ErrAuthExpired), "the server rejected the credentials"},
+		{nats.ErrTimeout, "timed out"},
+		{timeout, "timed out"},
+		{errors.New("nats: invalid connection"), "nats: invalid connection"},
+	}
+	for _, tt := range tests {
+		got := describeConnectError(tt.err)
+		if !strings.HasPrefix(got, tt.want) || !strings.Contains(got, tt.err.Error()) {
+			t.Errorf("describeConnectError(%v) = %q, want it to start with %q and keep the error", tt.err, got, tt.want)
+		}
+	}
+}
+
+// freeAddress returns an address nothing listens on
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// The client waits for a server starting after it, and gives up on one that never does
+// after the attempts and the delays between them
+func TestConnectNATSRetries(t *testing.T) {
+	addr := freeAddress(t)
+	time.AfterFunc(150*time.Millisecond, func() {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("listen again on %s: %v", addr, err)
+			return
+		}
+		s := &fakeNATS{ln: ln, conns: map[*fakeConn]bool{}}
+		go s.accept()
+		t.Cleanup(s.stop)
+	})
+	nc, err := connectNATS("nats://"+addr, retryPolicy{maxAttempts: 10, backoff: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("connectNATS to a server starting late: %v", err)
+	}
+	nc.Close()
+
+	start := time.Now()
+	_, err = connectNATS("nats://"+freeAddress(t), retryPolicy{maxAttempts: 3, backoff: 20 * time.Millisecond})
+	if elapsed := time.Since(start); err == nil || !strings.Contains(err.Error(), "connection refused") || elapsed < 60*time.Millisecond {
+		t.Errorf("connectNATS without a server = %v after %s, want a failure after waiting 20ms and 40ms", err, elapsed)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse("2006-01-02 15:04:05", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		spec, from, want string
+	}{
+		{"*/15 * * * *", "2025-01-01 10:07:00", "2025-01-01 10:15:00"},
+		{"*/15 * * * *", "2025-01-01 10:15:30", "2025-01-01 10:30:00"}, // After the minute it is in
+		{"0 8 * * *", "2025-01-01 08:00:00", "2025-01-02 08:00:00"},
+		{"0 8 * * mon-fri", "2025-01-03 09:00:00", "2025-01-06 08:00:00"}, // Friday to Monday
+		{"0 0 * * 7", "2025-01-01 00:00:00", "2025-01-05 00:00:00"},       // 7 is Sunday
+		{"@daily", "2025-01-01 23:59:00", "2025-01-02 00:00:00"},
+		{"@HOURLY", "2025-01-01 23:59:00", "2025-01-02 00:00:00"},
+		{"5/20 * * * *", "2025-01-01 10:05:00", "2025-01-01 10:25:00"},
+		{"0,30 9-10 * JAN *", "2025-01-31 10:45:00", "2026-01-01 09:00:00"},
+		{"0 0 29 2 *", "2025-01-01 00:00:00", "2028-02-29 00:00:00"},
+		{"0 12 13 * fri", "2025-01-01 00:00:00", "2025-01-03 12:00:00"}, // The 13th or a Friday
+		{"0 12 13 * *", "2025-01-01 00:00:00", "2025-01-13 12:00:00"},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.spec)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := s.next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("%q after %s = %s, want %s", tt.spec, tt.from, got.Format(time.DateTime), tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for spec, want := range map[string]string{
+		"* * * *":        "expected 5 fields (minute hour day-of-month month day-of-week) or a macro such as @daily, got 4",
+		"@weekdays":      "got 1",
+		"60 * * * *":     "minute: 60: out of range 0-59",
+		"*/0 * * * *":    `minute: step "0": expected a positive integer`,
+		"5-1 * * * *":    `minute: range "5-1": 5 is after 1`,
+		"0 0 * * funday": `day of week: "funday": expected a number between 0 and 7`,
+		"0 0 30 2 *":     "never matches a date",
+	} {
+		if _, err := parseCron(spec); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseCron(%q) = %v, want %q", spec, err, want)
+		}
+	}
+}
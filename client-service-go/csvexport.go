@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// csvExport collects the tabular results of a run for spreadsheets and writes them once the
+// run is over, since the header is the union of the keys of every row. Each query type gets
+// a file of its own next to the export path, e.g. results.device_health.csv for
+// results.csv, unless combined puts every row in the one file under a query_type column.
+type csvExport struct {
+	path     string
+	combined bool
+	order    []string                       // Query types in the order of their first rows
+	rows     map[string][]map[string]string // By query type
+}
+
+func newCSVExport(path string, combined bool) *csvExport {
+	return &csvExport{path: path, combined: combined, rows: map[string][]map[string]string{}}
+}
+
+// Adds the rows of a response. Data that is not a list of flat objects is rejected, so that
+// it can be skipped with a warning rather than turned into a broken CSV.
+func (e *csvExport) add(queryType string, data interface{}) error {
+	items, ok := data.([]interface{})
+	if !ok {
+		return errors.New("data is not a list of objects")
+	}
+	rows := make([]map[string]string, 0, len(items))
+	for i, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("item %d is not an object", i)
+		}
+		for key, value := range obj {
+			switch value.(type) {
+			case map[string]interface{}, []interface{}:
+				return fmt.Errorf("item %d: %s is not a plain value", i, key)
+			}
+		}
+		row := make(map[string]string, len(obj))
+		flatten("", obj, row)
+		rows = append(rows, row)
+	}
+	if _, seen := e.rows[queryType]; !seen {
+		e.order = append(e.order, queryType)
+	}
+	e.rows[queryType] = append(e.rows[queryType], rows...)
+	return nil
+}
+
+// Writes the collected rows, replacing files of earlier runs. Returns the paths written.
+func (e *csvExport) write() ([]string, error) {
+	if e.combined {
+		var all []map[string]string
+		for _, queryType := range e.order {
+			for _, row := range e.rows[queryType] {
+				combined := map[string]string{"query_type": queryType}
+				for key, value := range row {
+					combined[key] = value
+				}
+				all = append(all, combined)
+			}
+		}
+		return []string{e.path}, writeCSVFile(e.path, []string{"query_type"}, all)
+	}
+	var written []string
+	for _, queryType := range e.order {
+		path := e.queryPath(queryType)
+		if err := writeCSVFile(path, nil, e.rows[queryType]); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// Returns the file of a query type, its name inserted before the extension of the path
+func (e *csvExport) queryPath(queryType string) string {
+	ext := filepath.Ext(e.path)
+	return strings.TrimSuffix(e.path, ext) + "." + queryType + ext
+}
+
+// Writes rows to path under the leading columns followed by the sorted union of the other
+// keys. Missing keys give empty cells.
+func writeCSVFile(path string, leading []string, rows []map[string]string) error {
+	columns := append([]string(nil), leading...)
+	seen := map[string]bool{}
+	for _, column := range leading {
+		seen[column] = true
+	}
+	var rest []string
+	for _, row := range rows {
+		for key := range row {
+			if !seen[key] {
+				seen[key] = true
+				rest = append(rest, key)
+			}
+		}
+	}
+	sort.Strings(rest)
+	columns = append(columns, rest...)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write(columns)
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = row[column]
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// responseFixture returns the exchange of the fixture response of a query type, in
+// testdata/responses/<query type>.json
+func responseFixture(t *testing.T, queryType string) exchange {
+	t.Helper()
+	return fixtureExchange(t, queryType, filepath.Join("responses", queryType+".json"))
+}
+
+// knownQueryTypes returns the query types with a response schema, sorted
+func knownQueryTypes() []string {
+	var types []string
+	for queryType := range responseSchemas {
+		types = append(types, queryType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Query types whose data is not a list of flat objects, skipped by the export
+var nonTabularQueryTypes = []string{"acknowledge", "anomaly_temperature", "device_health", "device_list", "metric_summary"}
+
+func TestCSVExportGolden(t *testing.T) {
+	for _, queryType := range knownQueryTypes() {
+		t.Run(queryType, func(t *testing.T) {
+			export := newCSVExport(filepath.Join(t.TempDir(), "results.csv"), false)
+			err := export.add(queryType, responseFixture(t, queryType).response.Data)
+			if slices.Contains(nonTabularQueryTypes, queryType) {
+				if err == nil {
+					t.Fatal("added data that is not a list of flat objects")
+				}
+				if paths, err := export.write(); err != nil || len(paths) != 0 {
+					t.Errorf("write after skipping the only response = %v, %v, want no file", paths, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths, err := export.write()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(paths) != 1 || filepath.Base(paths[0]) != "results."+queryType+".csv" {
+				t.Fatalf("wrote %v, want the one file of the query type", paths)
+			}
+			checkGolden(t, filepath.Join("csv", queryType+".csv"), readFile(t, paths[0]))
+		})
+	}
+}
+
+func TestCSVExportCombined(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "all.csv")
+	export := newCSVExport(path, true)
+	for _, queryType := range []string{"top_devices", "events_by_type", "device_health", "top_devices"} {
+		err := export.add(queryType, responseFixture(t, queryType).response.Data)
+		if (err != nil) != (queryType == "device_health") {
+			t.Errorf("add(%s) = %v", queryType, err)
+		}
+	}
+	paths, err := export.write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != path {
+		t.Fatalf("wrote %v, want only %s", paths, path)
+	}
+	checkGolden(t, filepath.Join("csv", "combined.csv"), readFile(t, path))
+}
+
+func TestCSVExportUnionOfKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "rows.csv")
+	export := newCSVExport(path, false)
+	rows := []interface{}{
+		map[string]interface{}{"b": "1", "a": 2.5},
+		map[string]interface{}{"c": true, "a": nil},
+		map[string]interface{}{"b": "x,\"y\""},
+	}
+	if err := export.add("custom", rows); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := export.write(); err != nil {
+		t.Fatal(err)
+	}
+	want := "a,b,c\n2.5,1,\n,,true\n,\"x,\"\"y\"\"\",\n"
+	if got := readFile(t, filepath.Join(filepath.Dir(path), "rows.custom.csv")); got != want {
+		t.Errorf("wrote\n%s\nwant\n%s", got, want)
+	}
+
+	for _, data := range []interface{}{
+		"no data",
+		map[string]interface{}{"a": 1.0},
+		[]interface{}{"a", "b"},
+		[]interface{}{map[string]interface{}{"nested": map[string]interface{}{"a": 1.0}}},
+		[]interface{}{map[string]interface{}{"list": []interface{}{1.0}}},
+	} {
+		if err := export.add("custom", data); err == nil {
+			t.Errorf("added %v", data)
+		}
+	}
+}
+
+func TestCSVExportReplacesEarlierFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	stale := strings.TrimSuffix(path, ".csv") + ".top_devices.csv"
+	if err := os.WriteFile(stale, []byte("stale\n1\n2\n3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	export := newCSVExport(path, false)
+	if err := export.add("top_devices", []interface{}{map[string]interface{}{"rank": 1.0}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := export.write(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, stale); got != "rank\n1\n" {
+		t.Errorf("file of an earlier run holds %q after the export", got)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	diffSubcommand  = "diff"
+	diffDescription = "runs the queries of a queries file and compares their results with a saved baseline, field by field"
+	// Fields that change between runs of the same queries
+	defaultDiffIgnore = "time,timestamp,request_id,latency_ms"
+)
+
+// diffConfig is what a diff run compares.
+type diffConfig struct {
+	queries  []plannedQuery
+	baseline string // Baseline file to compare with, or to write with save
+	save     bool
+	ignore   map[string]bool // Field names left out of the comparison, at any depth
+	key      string          // Field identifying the objects of lists, compared regardless of order
+}
+
+// baselineEntry is the result of a query in a baseline file, a JSON list of them in the
+// order of the queries file. Params are kept unrendered, so that {{now}} templates compare
+// equal between runs.
+type baselineEntry struct {
+	QueryType string                 `json:"query_type"`
+	Params    map[string]interface{} `json:"params"`
+	Status    string                 `json:"status"`
+	Message   string                 `json:"message,omitempty"`
+	Data      interface{}            `json:"data,omitempty"`
+}
+
+// Parses the flags of the diff subcommand and loads its queries file, reporting flag syntax
+// errors and -h like parseSubcommand
+func parseDiff(args []string, stderr io.Writer) (diffConfig, error) {
+	fs := flag.NewFlagSet("client "+diffSubcommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cfg := diffConfig{}
+	queriesFile := fs.String("query-file", "", "YAML or JSON queries file to run (required)")
+	fs.StringVar(&cfg.baseline, "baseline", "", "baseline file of earlier results (required)")
+	fs.BoolVar(&cfg.save, "save-baseline", false, "write the results to --baseline instead of comparing with it")
+	ignore := fs.String("ignore", defaultDiffIgnore, "comma-separated fields to leave out of the comparison, at any depth")
+	fs.StringVar(&cfg.key, "key", "", "field identifying the objects of lists, e.g. event_id, so that lists compare regardless of order")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: client [global flags] %s [flags]\n\nThe %s subcommand %s; it exits with 1 on differences.\n\nFlags:\n", diffSubcommand, diffSubcommand, diffDescription)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return cfg, err
+		}
+		return cfg, errUsageReported
+	}
+
+	var problems []error
+	if fs.NArg() > 0 {
+		problems = append(problems, fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	if *queriesFile == "" {
+		problems = append(problems, errors.New("--query-file: is required"))
+	} else {
+		var err error
+		if cfg.queries, err = loadQueries(*queriesFile); err != nil {
+			problems = append(problems, fmt.Errorf("--query-file: %w", err))
+		}
+	}
+	if cfg.baseline == "" {
+		problems = append(problems, errors.New("--baseline: is required"))
+	} else if !cfg.save && !fileExists(cfg.baseline) {
+		problems = append(problems, fmt.Errorf("--baseline %s: not found, create it with --save-baseline", cfg.baseline))
+	}
+	cfg.ignore = map[string]bool{}
+	for _, field := range strings.Split(*ignore, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			cfg.ignore[field] = true
+		}
+	}
+	for i, problem := range problems {
+		problems[i] = fmt.Errorf("%s: %w", diffSubcommand, problem)
+	}
+	return cfg, errors.Join(problems...)
+}
+
+// Runs the queries once each and saves their results as the baseline, or prints how they
+// differ from it to out. Returns the exit code: that of the failure when a query got no
+// usable response, exitFailure when a result differs.
+func (c *client) runDiff(cfg diffConfig, out io.Writer) int {
+	results := make([]baselineEntry, 0, len(cfg.queries))
+	for _, q := range cfg.queries {
+		ex, err := c.forQuery(q).query(q.requestAt(time.Now()), q.timeout)
+		if errors.Is(err, context.Canceled) {
+			logger.infof("Interrupted: %d of %d queries completed, nothing compared or saved.", len(results), len(cfg.queries))
+			return exitInterrupted
+		}
+		if err != nil {
+			logger.errorf("Query %s (request %s) failed: %v", q.request.QueryType, ex.request.RequestID, err)
+			return classifyFailure(err).exitCode()
+		}
+		results = append(results, baselineEntry{
+			QueryType: q.request.QueryType,
+			Params:    q.request.Params,
+			Status:    ex.response.Status,
+			Message:   ex.response.Message,
+			Data:      ex.response.Data,
+		})
+	}
+
+	if cfg.save {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err == nil {
+			err = os.WriteFile(cfg.baseline, append(data, '\n'), 0644)
+		}
+		if err != nil {
+			logger.errorf("Failed to save the baseline: %v", err)
+			return exitFailure
+		}
+		logger.infof("Saved the results of %d queries as the baseline %s", len(results), cfg.baseline)
+		return exitOK
+	}
+
+	var baseline []baselineEntry
+	data, err := os.ReadFile(cfg.baseline)
+	if err == nil {
+		err = json.Unmarshal(data, &baseline)
+	}
+	if err != nil {
+		logger.errorf("Failed to read the baseline: %v", err)
+		return exitFailure
+	}
+	// Round-trip the results, so that both sides hold the same JSON types
+	data, err = json.Marshal(results)
+	if err == nil {
+		err = json.Unmarshal(data, &results)
+	}
+	if err != nil {
+		logger.errorf("Failed to compare the results: %v", err)
+		return exitFailure
+	}
+
+	d := differ{ignore: cfg.ignore, key: cfg.key}
+	changed := 0
+	for i := 0; i < max(len(results), len(baseline)); i++ {
+		var lines []string
+		switch {
+		case i >= len(baseline):
+			lines = []string{"not in the baseline"}
+		case i >= len(results):
+			lines = []string{"in the baseline only, the queries file has fewer queries"}
+		case results[i].QueryType != baseline[i].QueryType || !reflect.DeepEqual(results[i].Params, baseline[i].Params):
+			lines = []string{"is another query than in the baseline, save a new one"}
+		default:
+			lines = d.compare("status", baseline[i].Status, results[i].Status, lines)
+			lines = d.compare("message", baseline[i].Message, results[i].Message, lines)
+			lines = d.compare("data", baseline[i].Data, results[i].Data, lines)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		changed++
+		queryType := ""
+		if i < len(results) {
+			queryType = results[i].QueryType
+		} else {
+			queryType = baseline[i].QueryType
+		}
+		fmt.Fprintf(out, "Query %d (%s):\n", i, queryType)
+		for _, line := range lines {
+			fmt.Fprintf(out, "  %s\n", line)
+		}
+	}
+	if changed > 0 {
+		fmt.Fprintf(out, "%d of %d queries differ from the baseline %s\n", changed, max(len(results), len(baseline)), cfg.baseline)
+		return exitFailure
+	}
+	fmt.Fprintf(out, "No differences from the baseline %s in %d queries\n", cfg.baseline, len(results))
+	return exitOK
+}
+
+// differ compares decoded JSON values field by field.
+type differ struct {
+	ignore map[string]bool
+	key    string
+}
+
+// Appends a line per difference between the baseline value a and the current value b,
+// each naming its path, e.g. "data[2].criticality: 8 -> 9"
+func (d differ) compare(path string, a, b interface{}, lines []string) []string {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := map[string]bool{}
+		for k := range a {
+			keys[k] = true
+		}
+		for k := range b {
+			keys[k] = true
+		}
+		for _, k := range sortedKeys(keys) {
+			if d.ignore[k] {
+				continue
+			}
+			av, inA := a[k]
+			bv, inB := b[k]
+			switch {
+			case !inB:
+				lines = append(lines, fmt.Sprintf("%s.%s: removed, was %s", path, k, compactJSON(av)))
+			case !inA:
+				lines = append(lines, fmt.Sprintf("%s.%s: added, is %s", path, k, compactJSON(bv)))
+			default:
+				lines = d.compare(path+"."+k, av, bv, lines)
+			}
+		}
+		return lines
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		var ak, bk map[string]interface{}
+		if d.key != "" {
+			ak, bk = d.byKey(a), d.byKey(b)
+		}
+		if ak != nil && bk != nil {
+			keys := map[string]bool{}
+			for k := range ak {
+				keys[k] = true
+			}
+			for k := range bk {
+				keys[k] = true
+			}
+			for _, k := range sortedKeys(keys) {
+				itemPath := fmt.Sprintf("%s[%s=%s]", path, d.key, k)
+				av, inA := ak[k]
+				bv, inB := bk[k]
+				switch {
+				case !inB:
+					lines = append(lines, itemPath+": removed")
+				case !inA:
+					lines = append(lines, itemPath+": added")
+				default:
+					lines = d.compare(itemPath, av, bv, lines)
+				}
+			}
+			return lines
+		}
+		for i := 0; i < max(len(a), len(b)); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(b):
+				lines = append(lines, fmt.Sprintf("%s: removed, was %s", itemPath, compactJSON(a[i])))
+			case i >= len(a):
+				lines = append(lines, fmt.Sprintf("%s: added, is %s", itemPath, compactJSON(b[i])))
+			default:
+				lines = d.compare(itemPath, a[i], b[i], lines)
+			}
+		}
+		return lines
+	}
+	if !reflect.DeepEqual(a, b) {
+		lines = append(lines, fmt.Sprintf("%s: %s -> %s", path, compactJSON(a), compactJSON(b)))
+	}
+	return lines
+}
+
+// Indexes the objects of a list by their key field. Returns nil unless every item is an
+// object with a distinct key.
+func (d differ) byKey(items []interface{}) map[string]interface{} {
+	indexed := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value, ok := obj[d.key]
+		if !ok {
+			return nil
+		}
+		k := fmt.Sprint(value)
+		if _, dup := indexed[k]; dup {
+			return nil
+		}
+		indexed[k] = obj
+	}
+	return indexed
+}
+
+func sortedKeys(keys map[string]bool) []string {
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func compactJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
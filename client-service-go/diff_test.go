@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// decodeJSON decodes a JSON literal of a test
+func decodeJSON(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return v
+}
+
+func TestDifferCompare(t *testing.T) {
+	ignore := map[string]bool{"timestamp": true}
+	tests := []struct {
+		name     string
+		key      string
+		old, new string
+		want     []string
+	}{
+		{"equal", "", `{"a": [1, {"b": "x"}]}`, `{"a": [1, {"b": "x"}]}`, nil},
+		{"changed value", "", `{"a": {"b": 8}}`, `{"a": {"b": 9}}`, []string{"data.a.b: 8 -> 9"}},
+		{"added and removed fields", "", `{"a": 1, "b": 2}`, `{"b": 2, "c": [3]}`, []string{"data.a: removed, was 1", "data.c: added, is [3]"}},
+		{"ignored at any depth", "", `{"timestamp": "t1", "x": [{"timestamp": "t2", "v": 1}]}`, `{"timestamp": "t3", "x": [{"timestamp": "t4", "v": 1}]}`, nil},
+		{"type change", "", `{"a": [1]}`, `{"a": {"0": 1}}`, []string{`data.a: [1] -> {"0":1}`}},
+		{"list by position", "", `[1, 2, 3]`, `[1, 4]`, []string{"data[1]: 2 -> 4", "data[2]: removed, was 3"}},
+		{"reordered list without key", "", `[{"id": "a", "v": 1}, {"id": "b", "v": 2}]`, `[{"id": "b", "v": 2}, {"id": "a", "v": 1}]`, []string{`data[0].id: "a" -> "b"`, "data[0].v: 1 -> 2", `data[1].id: "b" -> "a"`, "data[1].v: 2 -> 1"}},
+		{"reordered list by key", "id", `[{"id": "a", "v": 1}, {"id": "b", "v": 2}]`, `[{"id": "b", "v": 2}, {"id": "a", "v": 1}]`, nil},
+		{"changed items by key", "id", `[{"id": "a", "v": 1}, {"id": "b", "v": 2}]`, `[{"id": "c", "v": 3}, {"id": "a", "v": 5}]`, []string{"data[id=a].v: 1 -> 5", "data[id=b]: removed", "data[id=c]: added"}},
+		{"duplicate keys fall back to positions", "id", `[{"id": "a", "v": 1}, {"id": "a", "v": 2}]`, `[{"id": "a", "v": 2}, {"id": "a", "v": 1}]`, []string{"data[0].v: 1 -> 2", "data[1].v: 2 -> 1"}},
+	}
+	for _, tt := range tests {
+		d := differ{ignore: ignore, key: tt.key}
+		got := d.compare("data", decodeJSON(t, tt.old), decodeJSON(t, tt.new), nil)
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s:\n%s\nwant\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestRunDiffAgainstASavedBaseline(t *testing.T) {
+	var data atomic.Value
+	data.Store(`[{"event_id": "e-1", "criticality": 9, "timestamp": "2025-01-01T10:00:00Z"}, {"event_id": "e-2", "criticality": 8, "timestamp": "2025-01-01T10:01:00Z"}]`)
+	s := startFakeNATS(t)
+	fakeReader(t, s, natsSubjectRequest, func(request ReaderRequest) ReaderResponse {
+		if request.QueryType == "device_list" {
+			return ReaderResponse{Status: "success", Data: []interface{}{"dev-01"}}
+		}
+		var rows interface{}
+		_ = json.Unmarshal([]byte(data.Load().(string)), &rows)
+		return ReaderResponse{Status: "success", Data: rows}
+	})
+	dir := t.TempDir()
+	queries := filepath.Join(dir, "queries.yaml")
+	if err := os.WriteFile(queries, []byte("- query_type: alerts_archive\n  params: {since: '{{now-15m}}'}\n- query_type: device_list\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	baseline := filepath.Join(dir, "baseline.json")
+	diff := func(args ...string) (int, string) {
+		t.Helper()
+		cfg, err := parseDiff(append([]string{"--query-file", queries, "--baseline", baseline}, args...), &bytes.Buffer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := newTestClient(t, s)
+		var out bytes.Buffer
+		return c.runDiff(cfg, &out), out.String()
+	}
+
+	if code, _ := diff("--save-baseline"); code != exitOK {
+		t.Fatalf("saving the baseline exited %d", code)
+	}
+	if code, out := diff(); code != exitOK || !strings.Contains(out, "No differences") {
+		t.Errorf("unchanged results: exit %d\n%s", code, out)
+	}
+
+	// Reordered, with new timestamps: only equal by key
+	data.Store(`[{"event_id": "e-2", "criticality": 8, "timestamp": "2025-01-02T10:01:00Z"}, {"event_id": "e-1", "criticality": 9, "timestamp": "2025-01-02T10:00:00Z"}]`)
+	if code, out := diff("--key", "event_id"); code != exitOK {
+		t.Errorf("reordered results compared by key: exit %d\n%s", code, out)
+	}
+	if code, out := diff(); code != exitFailure || !strings.Contains(out, `data[0].event_id: "e-1" -> "e-2"`) {
+		t.Errorf("reordered results compared by position: exit %d\n%s", code, out)
+	}
+
+	data.Store(`[{"event_id": "e-1", "criticality": 10, "timestamp": "x"}]`)
+	code, out := diff("--key", "event_id")
+	want := "Query 0 (alerts_archive):\n  data[event_id=e-1].criticality: 9 -> 10\n  data[event_id=e-2]: removed\n1 of 2 queries differ from the baseline " + baseline + "\n"
+	if code != exitFailure || out != want {
+		t.Errorf("changed results: exit %d\n%s\nwant\n%s", code, out, want)
+	}
+}
+
+func TestParseDiff(t *testing.T) {
+	_, err := parseDiff([]string{"--baseline", filepath.Join(t.TempDir(), "missing.json"), "extra"}, &bytes.Buffer{})
+	for _, want := range []string{`diff: unexpected argument "extra"`, "diff: --query-file: is required", "not found, create it with --save-baseline"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseDiff error %v, want it to report %q", err, want)
+		}
+	}
+}
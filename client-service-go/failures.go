@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// failureCode classifies why a query failed, so that scripts can tell a reader rejecting
+// the params from one that did not answer. It is the code of the error objects of the json
+// and jsonl formats and picks the exit code of a run.
+type failureCode string
+
+const (
+	failureTimeout      failureCode = "timeout"       // The reader did not answer in time, or gave up on the query
+	failureNoResponders failureCode = "no_responders" // No reader is subscribed to the subject
+	failureReaderError  failureCode = "reader_error"  // The reader answered with an error status
+	failureDecodeError  failureCode = "decode_error"  // The response is unreadable or breaks its schema
+	failureClientError  failureCode = "client_error"  // Anything else, such as a lost connection or --max-pages
+)
+
+// Returns the exit code of a run whose first failure has the code
+func (code failureCode) exitCode() int {
+	switch code {
+	case failureTimeout:
+		return exitTimeout
+	case failureNoResponders:
+		return exitNoResponders
+	case failureDecodeError:
+		return exitDecodeError
+	}
+	return exitFailure
+}
+
+// queryFailure is the error object of a failed query in the json and jsonl formats, e.g.
+//
+//	{"code": "reader_error", "message": "unknown device", "query_type": "device_health",
+//	 "request_id": "...", "attempts": 1}
+type queryFailure struct {
+	Code      failureCode `json:"code"`
+	Message   string      `json:"message"`
+	QueryType string      `json:"query_type"`
+	RequestID string      `json:"request_id,omitempty"`
+	Attempts  int         `json:"attempts"` // Requests sent, retries and pages included
+}
+
+// Describes the failure of a query that got no usable response (err) or an error status
+// from the reader (err nil), whose message it carries
+func newQueryFailure(ex exchange, err error) queryFailure {
+	failure := queryFailure{
+		Code:      classifyFailure(err),
+		QueryType: ex.request.QueryType,
+		RequestID: ex.request.RequestID,
+		Attempts:  ex.attempts,
+	}
+	if err != nil {
+		failure.Message = err.Error()
+	} else {
+		failure.Code, failure.Message = failureReaderError, ex.response.Message
+		if ex.response.Code == string(failureTimeout) {
+			failure.Code = failureTimeout // The reader ran out of time rather than rejecting the query
+		}
+	}
+	return failure
+}
+
+func classifyFailure(err error) failureCode {
+	var decodeErr *decodeError
+	switch {
+	case errors.Is(err, nats.ErrTimeout):
+		return failureTimeout
+	case errors.Is(err, nats.ErrNoResponders):
+		return failureNoResponders
+	case errors.As(err, &decodeErr):
+		return failureDecodeError
+	}
+	return failureClientError
+}
+
+// decodeError marks a response the client cannot make sense of: not JSON, for another
+// request or data not matching the schema of its query type.
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string { return e.err.Error() }
+func (e *decodeError) Unwrap() error { return e.err }
+
+// Formats an error like fmt.Errorf and marks it as a decode error
+func decodeErrorf(format string, args ...interface{}) error {
+	return &decodeError{fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		err      error
+		want     failureCode
+		wantExit int
+	}{
+		{fmt.Errorf("Query x timed out: %w", nats.ErrTimeout), failureTimeout, exitTimeout},
+		{fmt.Errorf("no reader: %w", nats.ErrNoResponders), failureNoResponders, exitNoResponders},
+		{fmt.Errorf("page 2: %w", decodeErrorf("data[1]: expected a string")), failureDecodeError, exitDecodeError},
+		{nats.ErrConnectionClosed, failureClientError, exitFailure},
+		{errors.New("--max-pages 5 reached"), failureClientError, exitFailure},
+	}
+	for _, tt := range tests {
+		got := classifyFailure(tt.err)
+		if got != tt.want || got.exitCode() != tt.wantExit {
+			t.Errorf("classifyFailure(%v) = %s exiting %d, want %s exiting %d", tt.err, got, got.exitCode(), tt.want, tt.wantExit)
+		}
+	}
+	if failureReaderError.exitCode() != exitFailure {
+		t.Errorf("reader_error exits %d, want %d", failureReaderError.exitCode(), exitFailure)
+	}
+}
+
+// Every failure class is written as an error object with its code, whatever the query
+func TestFailureObjects(t *testing.T) {
+	s := startFakeNATS(t)
+	fakeReader(t, s, natsSubjectRequest, func(request ReaderRequest) ReaderResponse {
+		switch request.Params["source_device"] {
+		case "garbled":
+			return ReaderResponse{Status: "success", Data: "not a health object"}
+		case "slow":
+			return ReaderResponse{Status: "error", Code: "timeout", Message: "query exceeded 5s"}
+		}
+		return ReaderResponse{Status: "error", Message: "unknown device"}
+	})
+	silent := startFakeNATS(t)
+	silentReader(t, silent)
+
+	tests := []struct {
+		name        string
+		server      *fakeNATS
+		device      string
+		setup       func(c *client)
+		wantCode    failureCode
+		wantMessage string
+		wantSent    int
+	}{
+		{"reader error", s, "missing", nil, failureReaderError, "unknown device", 1},
+		{"reader timeout", s, "slow", nil, failureTimeout, "query exceeded 5s", 1},
+		{"client timeout", silent, "any", nil, failureTimeout, "timed out after 2 attempt(s)", 2},
+		{"decode error", s, "garbled", nil, failureDecodeError, "expected an object", 1},
+		{"no reader", s, "any", func(c *client) { c.subject = "reader.nobody" }, failureNoResponders, "reader.nobody", 1},
+		{"client error", s, "any", func(c *client) { c.nc.Close() }, failureClientError, "connection closed", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, tt.server)
+			c.output = outputJSONL
+			c.timeout, c.retry = 100*time.Millisecond, retryPolicy{maxAttempts: 2, backoff: 10 * time.Millisecond}
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+			query := plannedQuery{request: ReaderRequest{QueryType: "device_health", Params: map[string]interface{}{"source_device": tt.device}}, repeat: 1}
+			if failure, err := c.sendQueries([]plannedQuery{query}, 2); failure != tt.wantCode || err != nil {
+				t.Fatalf("sendQueries = %q, %v, want %q", failure, err, tt.wantCode)
+			}
+			records := jsonlResults(t, c)
+			if len(records) != 1 || records[0].Error == nil {
+				t.Fatalf("wrote %+v, want an error object", records)
+			}
+			failure := records[0].Error
+			if failure.Code != tt.wantCode || !strings.Contains(failure.Message, tt.wantMessage) || failure.QueryType != "device_health" || failure.Attempts != tt.wantSent {
+				t.Errorf("error object %+v, want code %s with %q after %d attempt(s)", failure, tt.wantCode, tt.wantMessage, tt.wantSent)
+			}
+			if failure.RequestID != records[0].RequestID {
+				t.Errorf("error object of request %q in the result of %q", failure.RequestID, records[0].RequestID)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// fleetHealthQuery is answered by the client itself rather than the reader: it asks the
+	// reader for the device list and then for the health of every device, a few at a time.
+	// Its max_devices parameter guards against enormous fleets.
+	fleetHealthQuery     = "fleet_health"
+	defaultMaxDevices    = 100
+	fleetParallel        = 8       // device_health queries in flight at once
+	fleetHealthError     = "ERROR" // Health of devices whose query failed
+	fleetMaxDevicesParam = "max_devices"
+)
+
+// deviceList is the data of a device_list response, the names of the devices known to the
+// reader, a page of them at a time. The contract with the reader:
+//
+//	request:  {"query_type": "device_list", "params": {"cursor": "..."}}
+//	response: {"status": "success", "data": ["DiskUnit", "StorageArray", ...], "next_cursor": "..."}
+type deviceList []string
+
+func (l deviceList) table() (columns []string, rows [][]string) {
+	for _, device := range l {
+		rows = append(rows, []string{device})
+	}
+	return []string{"device"}, rows
+}
+
+// fleetHealthRow is the health of a device in a fleet_health result, or why it is unknown.
+type fleetHealthRow struct {
+	Device string `json:"device"`
+	Health string `json:"health"` // As in deviceHealth, or ERROR
+	Error  string `json:"error,omitempty"`
+}
+
+// fleetHealth is the data of a fleet_health result, rendered worst health first.
+type fleetHealth []fleetHealthRow
+
+// Severity of each health, lowest first; unlisted values rank with unknown
+var healthRank = map[string]int{"critical": 0, fleetHealthError: 1, "warn": 2, "unknown": 3, "ok": 4}
+
+func (f fleetHealth) table() (columns []string, rows [][]string) {
+	for _, row := range f {
+		rows = append(rows, []string{row.Device, row.Health, row.Error})
+	}
+	return []string{"device", "health", "error"}, rows
+}
+
+// Sorts the rows worst health first, then by device
+func (f fleetHealth) sort() {
+	rank := func(health string) int {
+		if r, ok := healthRank[health]; ok {
+			return r
+		}
+		return healthRank["unknown"]
+	}
+	sort.SliceStable(f, func(i, j int) bool {
+		if ri, rj := rank(f[i].Health), rank(f[j].Health); ri != rj {
+			return ri < rj
+		}
+		return f[i].Device < f[j].Device
+	})
+}
+
+// Answers a fleet_health query: lists the devices, every page of them whatever --all says,
+// then queries their health in parallel. A device whose query fails gets an ERROR row
+// instead of failing the whole result; only a failed device list or more devices than
+// max_devices fail it.
+func (c *client) queryFleetHealth(request ReaderRequest, timeout time.Duration) (exchange, error) {
+	start := time.Now()
+	maxDevices := defaultMaxDevices
+	if n, ok := request.Params[fleetMaxDevicesParam].(int); ok {
+		maxDevices = n
+	} else if n, ok := request.Params[fleetMaxDevicesParam].(float64); ok {
+		maxDevices = int(n)
+	}
+
+	// The first page alone would leave the devices after it unchecked, and the fleet
+	// within max_devices however large it is
+	listing := c.paging
+	listing.all = true
+	list, err := c.queryPaged(ReaderRequest{QueryType: "device_list", Params: map[string]interface{}{}}, timeout, listing)
+	ex := exchange{request: request}
+	ex.request.RequestID, ex.attempts = list.request.RequestID, list.attempts
+	if err != nil {
+		return ex, fmt.Errorf("Listing the devices: %w", err)
+	}
+	if list.response.Status != "success" {
+		ex.response = list.response
+		return ex, nil
+	}
+	devices, _ := list.typed.(deviceList)
+	if len(devices) > maxDevices {
+		return ex, fmt.Errorf("The reader lists %d devices, more than --max-devices %d; raise it to check them all", len(devices), maxDevices)
+	}
+
+	rows := make(fleetHealth, len(devices))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(fleetParallel, len(devices)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				rows[i] = c.deviceHealthRow(devices[i], timeout)
+			}
+		}()
+	}
+	for i := range devices {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	if c.ctx.Err() != nil {
+		return ex, fmt.Errorf("Query %s aborted: %w", fleetHealthQuery, c.ctx.Err())
+	}
+	rows.sort()
+
+	failed := 0
+	for _, row := range rows {
+		if row.Health == fleetHealthError {
+			failed++
+		}
+	}
+	if failed > 0 {
+		logger.infof("Health of %d of %d devices unknown, see the ERROR rows", failed, len(rows))
+	}
+
+	// The data is kept as generic JSON like that of the reader's responses
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return ex, err
+	}
+	ex.response.Status = "success"
+	if err := json.Unmarshal(data, &ex.response.Data); err != nil {
+		return ex, err
+	}
+	ex.typed = rows
+	ex.latency, ex.timeout = time.Since(start), list.timeout
+	return ex, nil
+}
+
+func (c *client) deviceHealthRow(device string, timeout time.Duration) fleetHealthRow {
+	row := fleetHealthRow{Device: device, Health: fleetHealthError}
+	ex, err := c.query(ReaderRequest{QueryType: "device_health", Params: map[string]interface{}{"source_device": device}}, timeout)
+	switch {
+	case err != nil:
+		row.Error = err.Error()
+	case ex.response.Status != "success":
+		row.Error = ex.response.Message
+	default:
+		row.Health = ex.typed.(deviceHealth).Health
+	}
+	return row
+}
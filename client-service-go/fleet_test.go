@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// pagedDeviceReader answers device_list with the devices, pageSize of them per page with
+// cursors as the reader's, and device_health with ok for every device
+func pagedDeviceReader(devices []string, pageSize int) func(ReaderRequest) ReaderResponse {
+	return func(request ReaderRequest) ReaderResponse {
+		switch request.QueryType {
+		case "device_list":
+			offset := 0
+			if cursor, ok := request.Params["cursor"].(string); ok {
+				fmt.Sscanf(cursor, "offset-%d", &offset)
+			}
+			end := min(offset+pageSize, len(devices))
+			page := make([]interface{}, 0, end-offset)
+			for _, device := range devices[offset:end] {
+				page = append(page, device)
+			}
+			total := len(devices)
+			response := ReaderResponse{Status: "success", Data: page, TotalCount: &total}
+			if end < len(devices) {
+				response.NextCursor = fmt.Sprintf("offset-%d", end)
+			}
+			return response
+		case "device_health":
+			device := request.Params["source_device"]
+			return ReaderResponse{Status: "success", Data: map[string]interface{}{"device": device, "health": "ok", "events_last_hour": 0, "metrics": []interface{}{}}}
+		}
+		return ReaderResponse{Status: "error", Message: "unexpected " + request.QueryType}
+	}
+}
+
+func TestFleetHealthFollowsEveryPage(t *testing.T) {
+	devices := []string{"Storage-01", "Storage-02", "Storage-03", "Storage-04", "Storage-05", "Storage-06", "Storage-07"}
+	s := startFakeNATS(t)
+	requests := fakeReader(t, s, natsSubjectRequest, pagedDeviceReader(devices, 3))
+	c := newTestClient(t, s) // Without --all, as fleet_health must not depend on it
+
+	ex, err := c.query(ReaderRequest{QueryType: fleetHealthQuery, Params: map[string]interface{}{}}, 0)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	rows := ex.typed.(fleetHealth)
+	var checked []string
+	for _, row := range rows {
+		if row.Health != "ok" {
+			t.Errorf("%s: %s %s", row.Device, row.Health, row.Error)
+		}
+		checked = append(checked, row.Device)
+	}
+	if strings.Join(checked, " ") != strings.Join(devices, " ") {
+		t.Errorf("checked %v, want every device once: %v", checked, devices)
+	}
+	pages := 0
+	for _, request := range requests() {
+		if request.QueryType == "device_list" {
+			pages++
+		}
+	}
+	if pages != 3 {
+		t.Errorf("asked for %d page(s) of the device list, want 3", pages)
+	}
+}
+
+func TestFleetHealthMaxDevicesCountsEveryPage(t *testing.T) {
+	devices := []string{"Storage-01", "Storage-02", "Storage-03", "Storage-04", "Storage-05"}
+	s := startFakeNATS(t)
+	requests := fakeReader(t, s, natsSubjectRequest, pagedDeviceReader(devices, 2))
+	c := newTestClient(t, s)
+
+	_, err := c.query(ReaderRequest{QueryType: fleetHealthQuery, Params: map[string]interface{}{fleetMaxDevicesParam: 4.0}}, 0)
+	if err == nil || !strings.Contains(err.Error(), "lists 5 devices, more than --max-devices 4") {
+		t.Fatalf("query = %v, want the max_devices guard to count the devices of every page", err)
+	}
+	for _, request := range requests() {
+		if request.QueryType == "device_health" {
+			t.Fatalf("checked %v of a fleet above max_devices", request.Params["source_device"])
+		}
+	}
+}
+
+// One device timing out and another answering with an error get ERROR rows among the
+// others, sorted worst first, and the command still succeeds
+func TestFleetHealthMixedResults(t *testing.T) {
+	health := map[string]string{"Storage-01": "ok", "Storage-02": "critical", "Storage-03": "warn", "Storage-04": "ok", "Storage-05": "unknown"}
+	s := startFakeNATS(t)
+	nc := connectFake(t, s)
+	_, err := nc.Subscribe(natsSubjectRequest, func(m *nats.Msg) {
+		var request ReaderRequest
+		_ = json.Unmarshal(m.Data, &request)
+		device, _ := request.Params["source_device"].(string)
+		var response ReaderResponse
+		switch {
+		case request.QueryType == "device_list":
+			response = pagedDeviceReader([]string{"Storage-01", "Storage-02", "Storage-03", "Storage-04", "Storage-05", "Storage-06", "Storage-07"}, 10)(request)
+		case device == "Storage-06":
+			return // Never answered: the query times out
+		case device == "Storage-07":
+			response = ReaderResponse{Status: "error", Message: "device offline"}
+		default:
+			response = ReaderResponse{Status: "success", Data: map[string]interface{}{"device": device, "health": health[device], "events_last_hour": 0, "metrics": []interface{}{}}}
+		}
+		response.RequestID = request.RequestID
+		data, _ := json.Marshal(response)
+		_ = m.Respond(data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, s)
+	c.timeout = 200 * time.Millisecond
+
+	ex, err := c.query(ReaderRequest{QueryType: fleetHealthQuery, Params: map[string]interface{}{fleetMaxDevicesParam: 10}}, 0)
+	if err != nil || ex.response.Status != "success" {
+		t.Fatalf("query = %+v, %v, want a result despite the failed devices", ex.response, err)
+	}
+	var got []string
+	for _, row := range ex.typed.(fleetHealth) {
+		got = append(got, row.Device+" "+row.Health)
+	}
+	want := []string{"Storage-02 critical", "Storage-06 ERROR", "Storage-07 ERROR", "Storage-03 warn", "Storage-05 unknown", "Storage-01 ok", "Storage-04 ok"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("rows\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	table := (&client{output: outputTable, times: &timeFormatter{}}).formatResponse(ex)
+	for _, want := range []string{"Storage-06  ERROR     Query device_health timed out", "Storage-07  ERROR     device offline"} {
+		if !strings.Contains(table, want) {
+			t.Errorf("table\n%s\nwant a row %q", table, want)
+		}
+	}
+	if code := runClient(t, nil, "--nats-url", s.url(), "--timeout", "200ms", "health", "--all"); code != exitOK {
+		t.Errorf("health --all exited %d, want %d with ERROR rows", code, exitOK)
+	}
+}
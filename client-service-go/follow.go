@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	eventsSubject         = "events.event"    // The daemon's events, but the security-class ones
+	securityEventsSubject = "events.security" // The daemon's security-class events
+	// Criticality from which follow mode shows events by default, as alerts_critical does
+	defaultAlertCriticality = 8
+)
+
+// Returns the subjects follow mode subscribes to: those the daemon publishes its events on,
+// the security events only when asked for
+func followSubjects(security bool) []string {
+	if security {
+		return []string{eventsSubject, securityEventsSubject}
+	}
+	return []string{eventsSubject}
+}
+
+// alert is the part of an event published by the daemon that follow mode shows.
+type alert struct {
+	ID            string `json:"id"`
+	CorrelationID string `json:"correlationId"` // Shared by the events of one incident, if any
+	Criticality   int    `json:"criticality"`
+	Timestamp     string `json:"timestamp"`
+	SourceDevice  string `json:"sourceDevice"`
+	EventType     string `json:"eventType"`
+	EventMessage  string `json:"eventMessage"`
+}
+
+// followConfig controls follow mode.
+type followConfig struct {
+	subjects       []string
+	minCriticality int     // Alerts below are dropped client-side
+	color          bool    // Colors the lines on out by criticality
+	file           *output // Also receives every line without colors, nil for none
+}
+
+// Subscribes to the event subjects and prints every event at or above the minimum
+// criticality, an alert, as it arrives, until ctx is cancelled. Alerts acknowledged on events.ack since
+// are dropped, as are the later events of their incident. Returns the number of alerts shown
+// and the first error writing them to the file.
+func (c *client) followAlerts(ctx context.Context, cfg followConfig, out io.Writer) (int, error) {
+	var mu sync.Mutex
+	shown := 0
+	acknowledged := map[string]bool{}   // Event and correlation IDs
+	correlations := map[string]string{} // Correlation ID of the events shown, by event ID
+	handler := func(m *nats.Msg) {
+		var a alert
+		if err := json.Unmarshal(m.Data, &a); err != nil {
+			logger.errorf("Skipping malformed alert on '%s': %v", m.Subject, err)
+			return
+		}
+		if a.Criticality < cfg.minCriticality {
+			return
+		}
+		a.Timestamp = c.times.human(a.Timestamp)
+		line := formatAlert(m.Subject, a)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if acknowledged[a.ID] || (a.CorrelationID != "" && acknowledged[a.CorrelationID]) {
+			logger.verbosef("Skipping acknowledged event %s", a.ID)
+			return
+		}
+		if a.ID != "" && a.CorrelationID != "" {
+			correlations[a.ID] = a.CorrelationID
+		}
+		shown++
+		if cfg.color {
+			fmt.Fprintln(out, colorize(line, a.Criticality))
+		} else {
+			fmt.Fprintln(out, line)
+		}
+		if cfg.file != nil && cfg.file.Err() == nil {
+			if err := cfg.file.writeResult(line); err != nil {
+				logger.errorf("Failed to write alerts: %v", err)
+			}
+		}
+	}
+
+	for _, subject := range cfg.subjects {
+		sub, err := c.nc.Subscribe(subject, handler)
+		if err != nil {
+			return 0, fmt.Errorf("subscribing to '%s': %w", subject, err)
+		}
+		defer sub.Unsubscribe()
+	}
+	ackSub, err := c.nc.Subscribe(ackSubject, func(m *nats.Msg) {
+		var ack Acknowledgment
+		if err := json.Unmarshal(m.Data, &ack); err != nil || ack.EventID == "" {
+			logger.errorf("Skipping malformed acknowledgment on '%s': %s", ackSubject, m.Data)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		acknowledged[ack.EventID] = true
+		if correlation := correlations[ack.EventID]; correlation != "" {
+			acknowledged[correlation] = true
+		}
+		logger.infof("Event %s acknowledged by %s, no longer shown", ack.EventID, ack.AcknowledgedBy)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("subscribing to '%s': %w", ackSubject, err)
+	}
+	defer ackSub.Unsubscribe()
+	logger.infof("Following alerts with criticality >= %d on %s, Ctrl-C to stop", cfg.minCriticality, strings.Join(cfg.subjects, ", "))
+
+	<-ctx.Done()
+	mu.Lock()
+	defer mu.Unlock()
+	if cfg.file != nil {
+		return shown, cfg.file.Err()
+	}
+	return shown, nil
+}
+
+func formatAlert(subject string, a alert) string {
+	line := fmt.Sprintf("%s [%2d] %-20s %-22s %s", a.Timestamp, a.Criticality, a.SourceDevice, a.EventType, a.EventMessage)
+	if subject != eventsSubject {
+		line += " (" + subject + ")"
+	}
+	return strings.TrimRight(line, " ")
+}
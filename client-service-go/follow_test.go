@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Follow mode listens where the daemon publishes, payloads as it sends them, and shows the
+// events from the default criticality up
+func TestFollowAlertsOnTheDaemonSubjects(t *testing.T) {
+	if got := followSubjects(false); !reflect.DeepEqual(got, []string{"events.event"}) {
+		t.Errorf("followSubjects(false) = %v", got)
+	}
+	o, err := parseTestOptions(t, nil, "--follow-alerts", "--follow-security")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.minCriticality != defaultAlertCriticality {
+		t.Errorf("--min-criticality defaults to %d, want %d", o.minCriticality, defaultAlertCriticality)
+	}
+
+	s := startFakeNATS(t)
+	c := newTestClient(t, s)
+	cfg := followConfig{subjects: followSubjects(o.followSecurity), minCriticality: o.minCriticality}
+	ctx, cancel := context.WithCancel(context.Background())
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.followAlerts(ctx, cfg, &out)
+		done <- err
+	}()
+	for c.nc.NumSubscriptions() < len(cfg.subjects)+1 { // And the acknowledgments
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := c.nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := connectFake(t, s)
+	for _, m := range []struct{ subject, payload string }{
+		{"events.event", `{"schemaVersion":2,"id":"e-1","criticality":9,"timestamp":"2025-01-01T10:00:00Z","sourceDevice":"DiskUnit-0001","parentDevice":"StorageArray-0001","eventType":"DriveFailure","eventMessage":"slot 4","status":"open","model":"HDD-20T"}`},
+		{"events.event", `{"schemaVersion":2,"id":"e-2","criticality":5,"timestamp":"2025-01-01T10:00:01Z","sourceDevice":"DiskUnit-0002","eventType":"HighLatency"}`},
+		{"events.security", `{"schemaVersion":2,"id":"e-3","criticality":10,"timestamp":"2025-01-01T10:00:02Z","sourceDevice":"CloudStorage-0001","eventType":"UnauthorizedAccess"}`},
+		{"events.metrics", `{"schemaVersion":2,"timestamp":"2025-01-01T10:00:03Z","sourceDevice":"DiskUnit-0001","metricType":"DiskTemp","value":61}`},
+	} {
+		if err := publisher.Publish(m.subject, []byte(m.payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := publisher.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Subjects are delivered each in order, not in order with one another
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Strings(lines)
+	want := []string{
+		"2025-01-01T10:00:00Z [ 9] DiskUnit-0001        DriveFailure           slot 4",
+		"2025-01-01T10:00:02Z [10] CloudStorage-0001    UnauthorizedAccess      (events.security)",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("followed\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	if strings.Contains(out.String(), "HighLatency") {
+		t.Errorf("showed an event below criticality %d", defaultAlertCriticality)
+	}
+}
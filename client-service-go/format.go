@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+const defaultOutputFile = "client_output.log"
+
+type outputFormat string
+
+const (
+	outputJSON  outputFormat = "json"
+	outputTable outputFormat = "table"
+	outputCSV   outputFormat = "csv"
+	outputJSONL outputFormat = "jsonl" // A line of compact JSON per result, for jq and other pipelines
+)
+
+func parseOutputFormat(s string) (outputFormat, error) {
+	switch f := outputFormat(strings.ToLower(s)); f {
+	case outputJSON, outputTable, outputCSV, outputJSONL:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q, expected json, jsonl, table or csv", s)
+}
+
+// jsonlRecord is a result in the jsonl format. Failed queries carry an error object instead
+// of data.
+type jsonlRecord struct {
+	QueryType string        `json:"query_type"`
+	RequestID string        `json:"request_id"`
+	Status    string        `json:"status"` // The reader's status, or "failed" without a usable response
+	LatencyMs float64       `json:"latency_ms"`
+	TimeoutMs float64       `json:"timeout_ms,omitempty"` // Wait per attempt that applied
+	Data      interface{}   `json:"data,omitempty"`
+	Summary   interface{}   `json:"summary,omitempty"`
+	Error     *queryFailure `json:"error,omitempty"`
+}
+
+// Returns the record of a query that got a response, or failed with err
+func newJSONLRecord(ex exchange, err error) jsonlRecord {
+	record := jsonlRecord{
+		QueryType: ex.request.QueryType,
+		RequestID: ex.request.RequestID,
+		Status:    ex.response.Status,
+		LatencyMs: milliseconds(ex.latency),
+		TimeoutMs: milliseconds(ex.timeout),
+	}
+	switch {
+	case err != nil:
+		failure := newQueryFailure(ex, err)
+		record.Status, record.Error = statusFailed, &failure
+	case ex.response.Status == "success":
+		record.Data, record.Summary = ex.response.Data, ex.response.Summary
+	default:
+		failure := newQueryFailure(ex, nil)
+		record.Error = &failure
+	}
+	return record
+}
+
+// Renders a result as a single line of JSON; newlines within strings are escaped by the
+// encoding
+func formatJSONL(record jsonlRecord) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(record); err != nil {
+		record.Data, record.Summary = nil, nil
+		record.Status = statusFailed
+		record.Error = &queryFailure{Code: failureClientError, Message: fmt.Sprintf("Error formatting JSON: %v", err), QueryType: record.QueryType, RequestID: record.RequestID}
+		return formatJSONL(record)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Renders response data in the format. Table and CSV need rows: a list of objects gives one
+// row each and a single object one row; anything else falls back to JSON.
+func formatData(data interface{}, format outputFormat) string {
+	if format == outputJSON {
+		return formatJSON(data)
+	}
+	columns, rows, ok := tabulate(data)
+	if !ok {
+		return formatJSON(data)
+	}
+	if format == outputCSV {
+		return formatCSV(columns, rows)
+	}
+	return formatTable(columns, rows)
+}
+
+func formatJSON(data interface{}) string {
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("Error formatting JSON: %v", err)
+	}
+	return string(b)
+}
+
+// Turns a list of objects, or a single object, into rows of cells under the union of their
+// flattened keys, sorted. Missing keys give empty cells.
+func tabulate(data interface{}) (columns []string, rows [][]string, ok bool) {
+	var objects []map[string]interface{}
+	switch v := data.(type) {
+	case map[string]interface{}:
+		objects = []map[string]interface{}{v}
+	case []interface{}:
+		for _, item := range v {
+			obj, isObject := item.(map[string]interface{})
+			if !isObject {
+				return nil, nil, false
+			}
+			objects = append(objects, obj)
+		}
+	default:
+		return nil, nil, false
+	}
+
+	flat := make([]map[string]string, len(objects))
+	seen := make(map[string]bool)
+	for i, obj := range objects {
+		flat[i] = make(map[string]string)
+		flatten("", obj, flat[i])
+		for key := range flat[i] {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	sort.Strings(columns)
+
+	rows = make([][]string, len(flat))
+	for i, cells := range flat {
+		rows[i] = make([]string, len(columns))
+		for j, column := range columns {
+			rows[i][j] = cells[column]
+		}
+	}
+	return columns, rows, true
+}
+
+// Adds the cells of obj to into, nested objects under dotted keys such as "summary.count".
+// Lists become JSON strings in their cell.
+func flatten(prefix string, obj map[string]interface{}, into map[string]string) {
+	for key, value := range obj {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flatten(key, v, into)
+		case nil:
+			into[key] = ""
+		case string:
+			into[key] = v
+		case float64:
+			into[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			b, _ := json.Marshal(v)
+			into[key] = string(b)
+		}
+	}
+}
+
+func formatTable(columns []string, rows [][]string) string {
+	if len(rows) == 0 {
+		return "(no rows)"
+	}
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	separators := make([]string, len(columns))
+	for i, column := range columns {
+		separators[i] = strings.Repeat("-", utf8.RuneCountInString(column))
+	}
+	fmt.Fprintln(w, strings.Join(separators, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(cell)
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+	return fmt.Sprintf("%s(%d row(s))", buf.String(), len(rows))
+}
+
+func formatCSV(columns []string, rows [][]string) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(columns)
+	w.WriteAll(rows)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// checkGolden compares got with the golden file testdata/<name>, rewriting it with -update
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the golden file:\n--- got\n%s\n--- want\n%s", name, got, want)
+	}
+}
+
+// fixtureExchange returns an exchange answered with the response in testdata/<name>
+func fixtureExchange(t *testing.T, queryType, name string) exchange {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response ReaderResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return exchange{
+		request:  ReaderRequest{QueryType: queryType, RequestID: response.RequestID},
+		response: response,
+		latency:  12 * time.Millisecond,
+		timeout:  5 * time.Second,
+		attempts: 1,
+	}
+}
+
+func TestFormatResponseGolden(t *testing.T) {
+	ex := fixtureExchange(t, "alerts_critical", "alerts_response.json")
+	for _, format := range []outputFormat{outputJSON, outputJSONL, outputTable, outputCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			c := &client{output: format, times: &timeFormatter{}}
+			checkGolden(t, filepath.Join("format", "alerts."+string(format)), c.formatResponse(ex))
+		})
+	}
+}
+
+func TestFormatErrorResponseGolden(t *testing.T) {
+	ex := fixtureExchange(t, "device_health", "error_response.json")
+	for _, format := range []outputFormat{outputJSON, outputJSONL, outputTable, outputCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			c := &client{output: format, times: &timeFormatter{}}
+			checkGolden(t, filepath.Join("format", "error."+string(format)), c.formatResponse(ex))
+		})
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for _, s := range []string{"json", "JSONL", "Table", "csv"} {
+		if _, err := parseOutputFormat(s); err != nil {
+			t.Errorf("parseOutputFormat(%q) = %v", s, err)
+		}
+	}
+	if _, err := parseOutputFormat("xml"); err == nil {
+		t.Error("parseOutputFormat accepted xml")
+	}
+}
+
+func TestFormatDataFallsBackToJSON(t *testing.T) {
+	for _, data := range []interface{}{"text", 3.5, []interface{}{"a", "b"}, nil} {
+		for _, format := range []outputFormat{outputTable, outputCSV} {
+			if got, want := formatData(data, format), formatJSON(data); got != want {
+				t.Errorf("formatData(%v, %s) = %q, want the JSON %q", data, format, got, want)
+			}
+		}
+	}
+	if got := formatData([]interface{}{}, outputTable); got != "(no rows)" {
+		t.Errorf("empty table rendered as %q", got)
+	}
+}
+
+// typedFixture returns the exchange of the fixture response of a query type with its data
+// decoded, as a query would
+func typedFixture(t *testing.T, queryType string) exchange {
+	t.Helper()
+	ex := responseFixture(t, queryType)
+	typed, _, err := decodeResponseData(queryType, ex.response.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.typed = typed
+	return ex
+}
+
+func TestFormatMetricSummaryGolden(t *testing.T) {
+	ex := typedFixture(t, "metric_summary")
+	noData := ex
+	noData.response.Data, noData.typed = "no data", nil
+	for _, format := range []outputFormat{outputJSON, outputTable, outputCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			c := &client{output: format, times: &timeFormatter{}}
+			checkGolden(t, filepath.Join("format", "metric_summary."+string(format)), c.formatResponse(ex))
+		})
+	}
+	c := &client{output: outputTable, times: &timeFormatter{}}
+	checkGolden(t, filepath.Join("format", "metric_summary_no_data.table"), c.formatResponse(noData))
+}
+
+// Devices are rows and event types columns, both sorted, with 0 for pairs without events
+func TestFormatEventsPivotGolden(t *testing.T) {
+	ex := typedFixture(t, "events_by_type")
+	for _, format := range []outputFormat{outputTable, outputCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			c := &client{output: format, times: &timeFormatter{}}
+			checkGolden(t, filepath.Join("format", "events_by_type."+string(format)), c.formatResponse(ex))
+		})
+	}
+}
+
+func TestEventCountsTable(t *testing.T) {
+	columns, rows := eventCounts{
+		{SourceDevice: "b", EventType: "Y", Count: 1},
+		{SourceDevice: "a", EventType: "X", Count: 2},
+		{SourceDevice: "b", EventType: "Y", Count: 4}, // Pairs repeated across pages add up
+	}.table()
+	if got, want := fmt.Sprint(columns, rows), "[source_device X Y] [[a 2 0] [b 0 5]]"; got != want {
+		t.Errorf("pivot = %s, want %s", got, want)
+	}
+	if columns, rows := (eventCounts{}).table(); len(columns) != 1 || len(rows) != 0 {
+		t.Errorf("pivot of no counts = %v %v, want the device column alone", columns, rows)
+	}
+}
+
+// Every result, failed or not, is one line of valid JSON, newlines within it escaped
+func TestJSONLOneLinePerResult(t *testing.T) {
+	s := startFakeNATS(t)
+	fakeReader(t, s, natsSubjectRequest, func(request ReaderRequest) ReaderResponse {
+		switch request.QueryType {
+		case "device_list":
+			return ReaderResponse{Status: "success", Data: []interface{}{"dev-01", "line\nbreak <&>"}}
+		case "device_health":
+			return ReaderResponse{Status: "success", Data: "not a health object"}
+		}
+		return ReaderResponse{Status: "error", Message: "unknown query type\n  hint: see the reader's log"}
+	})
+	c := newTestClient(t, s)
+	c.output = outputJSONL
+	queries := []plannedQuery{
+		{request: ReaderRequest{QueryType: "device_list"}, repeat: 2},
+		{request: ReaderRequest{QueryType: "disk_forecast"}, repeat: 1},
+		{request: ReaderRequest{QueryType: "device_health", Params: map[string]interface{}{"source_device": "dev-01"}}, repeat: 1},
+	}
+	if _, err := c.sendQueries(queries, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	written := readFile(t, c.out.name)
+	lines := strings.Split(strings.TrimSuffix(written, "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("wrote %d line(s) for 4 results:\n%s", len(lines), written)
+	}
+	var got []string
+	for _, line := range lines {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %q is not JSON: %v", line, err)
+		}
+		summary := fmt.Sprintf("%s %s", record["query_type"], record["status"])
+		if failure, ok := record["error"].(map[string]interface{}); ok {
+			summary += fmt.Sprintf(" %s: %s", failure["code"], failure["message"])
+		} else {
+			summary += fmt.Sprintf(" %v", record["data"])
+		}
+		if _, ok := record["latency_ms"].(float64); !ok || record["request_id"] == "" {
+			t.Errorf("line %q lacks its latency or request ID", line)
+		}
+		got = append(got, summary)
+	}
+	want := []string{
+		"device_list success [dev-01 line\nbreak <&>]",
+		"device_list success [dev-01 line\nbreak <&>]",
+		"disk_forecast error reader_error: unknown query type\n  hint: see the reader's log",
+		"device_health failed decode_error: Response to device_health does not match its schema: data: expected an object, got string",
+	}
+	if strings.Join(got, "\n--\n") != strings.Join(want, "\n--\n") {
+		t.Errorf("results\n%s\nwant\n%s", strings.Join(got, "\n--\n"), strings.Join(want, "\n--\n"))
+	}
+	if !strings.Contains(written, `"line\nbreak <&>"`) {
+		t.Errorf("JSONL %s escapes more than the newline", written)
+	}
+}
+
+func TestFormatJSONLUnencodableData(t *testing.T) {
+	line := formatJSONL(jsonlRecord{QueryType: "metric_summary", RequestID: "req-1", Status: "success", Data: math.Inf(1)})
+	var record jsonlRecord
+	if err := json.Unmarshal([]byte(line), &record); err != nil || strings.Contains(line, "\n") {
+		t.Fatalf("%q is not one line of JSON: %v", line, err)
+	}
+	if record.Status != statusFailed || record.Error == nil || record.Error.Code != failureClientError || record.Data != nil {
+		t.Errorf("record of unencodable data %+v, want a client error", record)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	historyFileName   = ".event_client_history"
+	replaySubcommand  = "replay"
+	replayDescription = "re-runs the queries recorded in a history file, in order, against the current connection"
+)
+
+// historyEntry is a line of the history file: a query as the client sent it, without its
+// pages, and how it ended. Params are recorded verbatim, they are only query filters.
+type historyEntry struct {
+	Time      string        `json:"time"` // RFC 3339, when the query ended
+	RequestID string        `json:"request_id,omitempty"`
+	Request   ReaderRequest `json:"request"`
+	Status    string        `json:"status"`          // The reader's status, or "failed"
+	Error     string        `json:"error,omitempty"` // Why it failed, or the reader's message
+}
+
+// history appends every query the client runs to a JSONL file, for replaying a debugging
+// session later. A nil history records nothing. Failing to record never fails a query: the
+// first error is reported on stderr and recording stops.
+type history struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// Returns the default history file in the home directory, or "" when there is no home
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFileName)
+}
+
+// Opens the history file at path for appending, creating it and its directories
+func openHistory(path string) (*history, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &history{path: path, file: f}, nil
+}
+
+// Appends the outcome of a query to the history. request is the query as the caller gave it.
+func (h *history) record(request ReaderRequest, ex exchange, err error) {
+	if h == nil {
+		return
+	}
+	request.RequestID = ""
+	entry := historyEntry{
+		Time:      time.Now().UTC().Format(time.RFC3339),
+		RequestID: ex.request.RequestID,
+		Request:   request,
+		Status:    ex.response.Status,
+		Error:     ex.response.Message,
+	}
+	if err != nil {
+		entry.Status, entry.Error = statusFailed, err.Error()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return
+	}
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		logger.errorf("Failed to record the query history to %s, recording stops: %v", h.path, err)
+		h.file.Close()
+		h.file = nil
+	}
+}
+
+func (h *history) Close() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
+
+// Reads the entries of a history file. Errors name the offending line.
+func readHistory(path string) ([]historyEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxQueryBodyBytes)
+	for line := 1; scanner.Scan(); line++ {
+		var entry historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		if entry.Request.QueryType == "" {
+			return nil, fmt.Errorf("%s:%d: request: missing query_type", path, line)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// Parses the flags of the replay subcommand and reads the queries to replay from the history
+// file, reporting flag syntax errors and -h like parseSubcommand. Entries are numbered from
+// 1 in file order, and --from and --to select an inclusive range of them.
+func parseReplay(args []string, stderr io.Writer) ([]plannedQuery, error) {
+	fs := flag.NewFlagSet("client "+replaySubcommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("history", defaultHistoryPath(), "history file to replay")
+	from := fs.Int("from", 1, "first entry to replay, counting from 1")
+	to := fs.Int("to", 0, "last entry to replay, 0 for the last one of the file")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: client [global flags] %s [flags]\n\nThe %s subcommand %s.\n\nFlags:\n", replaySubcommand, replaySubcommand, replayDescription)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errUsageReported
+	}
+
+	var problems []error
+	if fs.NArg() > 0 {
+		problems = append(problems, fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	var entries []historyEntry
+	if *path == "" {
+		problems = append(problems, errors.New("--history: is required without a home directory"))
+	} else {
+		var err error
+		if entries, err = readHistory(*path); err != nil {
+			problems = append(problems, fmt.Errorf("--history: %w", err))
+		}
+	}
+	last := *to
+	if last == 0 {
+		last = len(entries)
+	}
+	switch {
+	case *from < 1:
+		problems = append(problems, fmt.Errorf("--from %d: must be at least 1", *from))
+	case *to < 0:
+		problems = append(problems, fmt.Errorf("--to %d: must not be negative", *to))
+	case *to != 0 && *to < *from:
+		problems = append(problems, fmt.Errorf("--to %d: must not be before --from %d", *to, *from))
+	case len(problems) == 0 && last > len(entries):
+		problems = append(problems, fmt.Errorf("--to %d: the history has %d entries", *to, len(entries)))
+	case len(problems) == 0 && *from > last:
+		problems = append(problems, fmt.Errorf("--from %d: the history has %d entries", *from, len(entries)))
+	}
+	for i, problem := range problems {
+		problems[i] = fmt.Errorf("%s: %w", replaySubcommand, problem)
+	}
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+
+	queries := make([]plannedQuery, 0, last-*from+1)
+	for _, entry := range entries[*from-1 : last] {
+		queries = append(queries, plannedQuery{request: entry.Request, repeat: 1})
+	}
+	return queries, nil
+}
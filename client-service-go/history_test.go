@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Queries recorded by one run are sent again, in order, by replay in another
+func TestHistoryRecordAndReplay(t *testing.T) {
+	recorded := startFakeNATS(t)
+	fakeReader(t, recorded, natsSubjectRequest, pagedDeviceReader([]string{"dev-01"}, 10))
+	path := filepath.Join(t.TempDir(), "sessions", "history")
+	queries := filepath.Join(t.TempDir(), "queries.yaml")
+	file := "- {query_type: device_list}\n" +
+		"- {query_type: device_health, params: {source_device: dev-01}}\n" +
+		"- {query_type: metric_summary, params: {source_device: dev-01, metric_type: DiskTemp, window_minutes: 60, token: s3cret}}\n"
+	if err := os.WriteFile(queries, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code := runClient(t, nil, "--nats-url", recorded.url(), "--queries", queries, "--parallel", "1", "--history", path); code != exitFailure {
+		t.Fatalf("recording run exited %d, want %d for the unexpected metric_summary", code, exitFailure)
+	}
+
+	entries, err := readHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, fmt.Sprintf("%s %v %s %s", e.Request.QueryType, e.Request.Params, e.Status, e.Error))
+		if e.RequestID == "" || e.Request.RequestID != "" || e.Time == "" {
+			t.Errorf("entry %+v, want the time and request ID beside the request", e)
+		}
+	}
+	want := []string{
+		"device_list map[] success ",
+		"device_health map[source_device:dev-01] success ",
+		"metric_summary map[metric_type:DiskTemp source_device:dev-01 token:s3cret window_minutes:60] error unexpected metric_summary",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("recorded\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	replayed := startFakeNATS(t)
+	requests := fakeReader(t, replayed, natsSubjectRequest, pagedDeviceReader([]string{"dev-01"}, 10))
+	if code := runClient(t, nil, "--nats-url", replayed.url(), "replay", "--history", path, "--from", "2", "--to", "3"); code != exitFailure {
+		t.Errorf("replay exited %d, want %d for the unexpected metric_summary", code, exitFailure)
+	}
+	sent := requests()
+	if len(sent) != 2 {
+		t.Fatalf("replay sent %d request(s), want entries 2 and 3", len(sent))
+	}
+	for i, request := range sent {
+		request.RequestID = ""
+		entry := entries[i+1].Request
+		if fmt.Sprint(request) != fmt.Sprint(entry) {
+			t.Errorf("replayed %v, want %v", request, entry)
+		}
+	}
+	if after, _ := readHistory(path); len(after) != 3 {
+		t.Errorf("history holds %d entries after replaying it elsewhere, want the 3 recorded", len(after))
+	}
+}
+
+func TestHistoryRecordsFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h, err := openHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.record(ReaderRequest{QueryType: "device_list", RequestID: "set by the caller"}, exchange{request: ReaderRequest{RequestID: "req-1"}}, io.ErrUnexpectedEOF)
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	h.record(ReaderRequest{QueryType: "device_list"}, exchange{}, nil) // Closed: dropped
+	var none *history
+	none.record(ReaderRequest{QueryType: "device_list"}, exchange{}, nil)
+
+	entries, err := readHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Status != statusFailed || entries[0].Error != io.ErrUnexpectedEOF.Error() || entries[0].RequestID != "req-1" {
+		t.Errorf("recorded %+v, want the one failed query", entries)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("history file mode %v (%v), want 0600", info.Mode(), err)
+	}
+}
+
+func TestParseReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	var lines []string
+	for i := 1; i <= 4; i++ {
+		lines = append(lines, fmt.Sprintf(`{"time":"2025-01-01T10:00:0%dZ","request":{"query_type":"q%d","params":{}},"status":"success"}`, i, i))
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for args, want := range map[string]string{
+		"":                "q1 q2 q3 q4",
+		"--from 3":        "q3 q4",
+		"--from 2 --to 3": "q2 q3",
+		"--to 1":          "q1",
+	} {
+		queries, err := parseReplay(append([]string{"--history", path}, strings.Fields(args)...), io.Discard)
+		var got []string
+		for _, q := range queries {
+			got = append(got, q.request.QueryType)
+		}
+		if err != nil || strings.Join(got, " ") != want {
+			t.Errorf("replay %s = %v, %v, want %s", args, got, err, want)
+		}
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad")
+	if err := os.WriteFile(bad, []byte(lines[0]+"\n{\"request\":{}}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for args, want := range map[string]string{
+		"--from 0":        "--from 0: must be at least 1",
+		"--from 3 --to 2": "--to 2: must not be before --from 3",
+		"--to 5":          "--to 5: the history has 4 entries",
+		"--from 5":        "--from 5: the history has 4 entries",
+		"extra":           `unexpected argument "extra"`,
+	} {
+		if _, err := parseReplay(append([]string{"--history", path}, strings.Fields(args)...), io.Discard); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("replay %s: %v, want %q", args, err, want)
+		}
+	}
+	if _, err := parseReplay([]string{"--history", bad}, io.Discard); err == nil || !strings.Contains(err.Error(), bad+":2: request: missing query_type") {
+		t.Errorf("replay of a broken history: %v, want the line named", err)
+	}
+}
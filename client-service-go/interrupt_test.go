@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Cancelling a batch keeps the results completed so far, each written whole, and stops at
+// once instead of waiting for the queries in flight
+func TestSendQueriesInterrupted(t *testing.T) {
+	const latency = 200 * time.Millisecond
+	for _, output := range []outputFormat{outputJSONL, outputTable} {
+		s := startFakeNATS(t)
+		slowReader(t, s, latency)
+		c := newTestClient(t, s)
+		c.output = output
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		c.ctx = ctx
+		time.AfterFunc(latency+latency/2, cancel) // During the second round
+
+		start := time.Now()
+		if failure, err := c.sendQueries(deviceQueries(10), 2); failure != "" || err != nil {
+			t.Fatalf("%s: sendQueries = %q, %v", output, failure, err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*latency {
+			t.Errorf("%s: interrupted run took %s, want it to stop without waiting for the queries in flight", output, elapsed)
+		}
+		if err := c.out.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if output == outputJSONL {
+			records := jsonlResults(t, c)
+			if len(records) != 2 || records[0].Status != "success" || records[1].Status != "success" {
+				t.Errorf("wrote %+v, want the 2 results of the first round", records)
+			}
+			continue
+		}
+		written := readFile(t, c.out.name)
+		if strings.Contains(written, "dev-02") || !strings.Contains(written, "dev-01") {
+			t.Errorf("table holds\n%s\nwant only the results of the first round", written)
+		}
+		if !strings.HasPrefix(written[strings.LastIndex(strings.TrimSpace(written), "\n")+1:], "Summary: 2 queries, 0 error(s)") {
+			t.Errorf("table ends with\n%s\nwant the summary of the completed queries", written)
+		}
+	}
+}
+
+// Cancelling a watch ends the iteration under way, reports what it aborted and prints the
+// summary of the iterations run
+func TestRunWatchInterrupted(t *testing.T) {
+	const latency = 100 * time.Millisecond
+	s := startFakeNATS(t)
+	slowReader(t, s, latency)
+	c := newTestClient(t, s)
+	c.output = outputTable
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.ctx = ctx
+	time.AfterFunc(latency+latency/2, cancel) // While the second query waits
+
+	start := time.Now()
+	if failure, err := c.runWatch(ctx, deviceQueries(3), time.Hour, 3); failure != "" || err != nil {
+		t.Fatalf("runWatch = %q, %v", failure, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*latency {
+		t.Errorf("interrupted watch took %s, want it to stop without waiting for the query in flight", elapsed)
+	}
+	if err := c.out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	written := readFile(t, c.out.name)
+	for _, want := range []string{
+		"Interrupted during iteration 1: 1 of 3 queries completed, 2 aborted.\n=== Watch summary ===\n",
+		"device_health             1 succeeded, 0 failed\ndevice_health             0 succeeded, 0 failed\n",
+		"Summary: 1 queries, 0 error(s)",
+	} {
+		if !strings.Contains(written, want) {
+			t.Errorf("watch wrote\n%s\nwant it to hold %q", written, want)
+		}
+	}
+}
+
+// An interrupted check or diff exits with the code of an interruption, not of a failure
+func TestCheckAndDiffInterrupted(t *testing.T) {
+	s := startFakeNATS(t)
+	slowReader(t, s, time.Second)
+	c := newTestClient(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.ctx = ctx
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	limit := 55.0
+	verdict := c.runCheck(checkConfig{device: "DiskUnit-0001", metric: "DiskTemp", window: 5 * time.Minute, max: &limit})
+	if verdict.code != exitInterrupted || verdict.line != "INTERRUPTED: DiskUnit-0001 DiskTemp not checked" {
+		t.Errorf("interrupted check = %+v", verdict)
+	}
+	var out strings.Builder
+	if code := c.runDiff(diffConfig{queries: deviceQueries(2)}, &out); code != exitInterrupted || out.Len() != 0 {
+		t.Errorf("interrupted diff exited %d with %q, want %d and nothing compared", code, out.String(), exitInterrupted)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// logLevel is how much the client tells on stderr besides the results.
+type logLevel int
+
+const (
+	levelQuiet   logLevel = -1 // -q: errors only
+	levelNormal  logLevel = 0  // Progress, warnings and summaries as well
+	levelVerbose logLevel = 1  // -v: every request with its subject and timing, connection events
+	levelDebug   logLevel = 2  // -vv: the raw request and response payloads
+)
+
+// leveledLogger writes the client's status lines, those up to its level. The results
+// themselves go to the output instead, whatever the level.
+type leveledLogger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level logLevel
+}
+
+// logger is the client's logger, its level set from -q and -v once the flags are parsed
+var logger = &leveledLogger{out: os.Stderr}
+
+// Sets the level; the connection's callbacks may log meanwhile
+func (l *leveledLogger) setLevel(level logLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// Reports whether lines of the level are written
+func (l *leveledLogger) enabled(level logLevel) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level <= l.level
+}
+
+func (l *leveledLogger) logf(level logLevel, format string, args ...interface{}) {
+	if !l.enabled(level) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.out, format+"\n", args...)
+}
+
+// Logs a failure, written at every level
+func (l *leveledLogger) errorf(format string, args ...interface{}) {
+	l.logf(levelQuiet, format, args...)
+}
+
+// Logs progress, a warning or a summary, left out with -q
+func (l *leveledLogger) infof(format string, args ...interface{}) {
+	l.logf(levelNormal, format, args...)
+}
+
+// Logs a detail of requests and connections, written with -v
+func (l *leveledLogger) verbosef(format string, args ...interface{}) {
+	l.logf(levelVerbose, format, args...)
+}
+
+// Logs a payload, written with -vv
+func (l *leveledLogger) debugf(format string, args ...interface{}) {
+	l.logf(levelDebug, format, args...)
+}
+
+// verboseFlag is -v, which raises the verbosity by one each time it is given, or -vv,
+// which raises it by two.
+type verboseFlag struct {
+	verbosity *int
+	by        int
+}
+
+func (f verboseFlag) String() string   { return "" }
+func (f verboseFlag) IsBoolFlag() bool { return true }
+
+func (f verboseFlag) Set(s string) error {
+	on, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if on {
+		*f.verbosity += f.by
+	}
+	return nil
+}
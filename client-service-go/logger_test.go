@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// captureLog sends the client's log lines to a buffer for the rest of the test and returns
+// the lines logged so far
+func captureLog(t *testing.T) func() string {
+	t.Helper()
+	var buf bytes.Buffer
+	logger.mu.Lock()
+	out, level := logger.out, logger.level
+	logger.out = &buf
+	logger.mu.Unlock()
+	t.Cleanup(func() {
+		logger.mu.Lock()
+		defer logger.mu.Unlock()
+		logger.out, logger.level = out, level
+	})
+	return func() string {
+		// The connection's callbacks may log meanwhile
+		logger.mu.Lock()
+		defer logger.mu.Unlock()
+		return buf.String()
+	}
+}
+
+var (
+	logRequestID = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+	logAddress   = regexp.MustCompile(`127\.0\.0\.1:\d+`)
+	logDuration  = regexp.MustCompile(`\d+(\.\d+)?(ns|µs|ms|s)\b`)
+)
+
+// Replaces what changes from run to run in the log: request IDs, addresses and latencies.
+// The line of the connection closing is left out, as the connection's goroutine logs it
+// whenever it gets to it, before the run returns or after.
+func normalizeLog(log string) string {
+	log = strings.ReplaceAll(log, "Connection to NATS closed\n", "")
+	log = logRequestID.ReplaceAllString(log, "<request-id>")
+	log = logAddress.ReplaceAllString(log, "<address>")
+	return logDuration.ReplaceAllString(log, "<duration>")
+}
+
+// One query as logged at each level, the default being the lines of old
+func TestLogLevelsGolden(t *testing.T) {
+	s := startFakeNATS(t)
+	fakeReader(t, s, natsSubjectRequest, pagedDeviceReader([]string{"dev-01"}, 10))
+	for _, level := range []struct {
+		name  string
+		flags []string
+	}{
+		{"quiet", []string{"-q"}},
+		{"normal", nil},
+		{"verbose", []string{"-v"}},
+		{"debug", []string{"-vv"}},
+	} {
+		name, flags := level.name, level.flags
+		t.Run(name, func(t *testing.T) {
+			log := captureLog(t)
+			args := append([]string{"--nats-url", s.url(), "--query", "device_health", "--device", "dev-01", "--output", "json"}, flags...)
+			if code := runClient(t, nil, args...); code != exitOK {
+				t.Fatalf("run exited %d", code)
+			}
+			checkGolden(t, filepath.Join("log", name+".log"), normalizeLog(log()))
+		})
+	}
+}
+
+func TestLogLevelFlags(t *testing.T) {
+	for args, want := range map[string]logLevel{
+		"":        levelNormal,
+		"-q":      levelQuiet,
+		"--quiet": levelQuiet,
+		"-v":      levelVerbose,
+		"-vv":     levelDebug,
+		"-v -v":   levelDebug,
+		"-v -vv":  levelDebug,
+	} {
+		o, err := parseTestOptions(t, nil, strings.Fields(args)...)
+		if err != nil || o.logLevel != want {
+			t.Errorf("%q: level %d, %v, want %d", args, o.logLevel, err, want)
+		}
+	}
+	if _, err := parseTestOptions(t, nil, "-q", "-v"); err == nil {
+		t.Error("-q with -v accepted")
+	}
+}
+
+func TestLeveledLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := &leveledLogger{out: &buf}
+	for _, level := range []logLevel{levelQuiet, levelNormal, levelVerbose, levelDebug} {
+		l.setLevel(level)
+		l.errorf("error")
+		l.infof("info")
+		l.verbosef("verbose")
+		l.debugf("debug")
+		buf.WriteString("--\n")
+	}
+	want := "error\n--\nerror\ninfo\n--\nerror\ninfo\nverbose\n--\nerror\ninfo\nverbose\ndebug\n--\n"
+	if buf.String() != want {
+		t.Errorf("logged\n%s\nwant\n%s", buf.String(), want)
+	}
+}
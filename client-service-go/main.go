@@ -1,121 +1,635 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 )
 
 const (
-	natsSubjectRequest = "reader.query"
+	natsSubjectRequest    = "reader.query" // Default subject of the reader's queries
+	defaultNatsURL        = "nats://nats:4222"
+	defaultRequestTimeout = 10 * time.Second
+	// Status recorded for queries the reader never answered, or answered unreadably
+	statusFailed = "failed"
 )
 
+// ReaderRequest is a query sent to the reader. The reader echoes RequestID in its response,
+// so that client and reader logs can be matched.
 type ReaderRequest struct {
+	RequestID string                 `json:"request_id,omitempty"`
 	QueryType string                 `json:"query_type"`
 	Params    map[string]interface{} `json:"params"`
 }
 
+// ReaderResponse is the reader's answer. Data has the shape of its query type's schema, see
+// responseSchemas; alerts_critical responses also carry a per-device Summary.
 type ReaderResponse struct {
-	Status  string      `json:"status"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
+	RequestID  string      `json:"request_id,omitempty"`
+	Status     string      `json:"status"`
+	Code       string      `json:"code,omitempty"` // Of some errors, e.g. timeout when the reader gave up on the query
+	Message    string      `json:"message,omitempty"`
+	Data       interface{} `json:"data,omitempty"`
+	Summary    interface{} `json:"summary,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"` // Set when more results are left, sent back as the "cursor" parameter
+	TotalCount *int        `json:"total_count,omitempty"` // Items of the whole paged result, when the reader knows it cheaply
+	Stream     *streamInfo `json:"stream,omitempty"`      // Set with status stream, see streamInfo
+}
+
+// client sends queries to the reader and renders their responses.
+type client struct {
+	ctx      context.Context // Cancelled on Ctrl-C, abandoning the requests in flight
+	nc       *nats.Conn
+	subject  string // The reader's query subject
+	output   outputFormat
+	out      *output       // Receives the results of batch and watch runs
+	timeout  time.Duration // Wait per request for queries without a timeout of their own
+	retry    retryPolicy
+	paging   pagingPolicy
+	failFast bool           // Stops batch and watch runs at the first failed query
+	noReader noReaderPolicy // What a batch run does once no reader is subscribed
+	csv      *csvExport     // Collects tabular results for --csv-out, nil without
+	color    bool           // Colors table rows by criticality, only ever on a terminal
+	table    tableLayout    // Columns of tables and CSV results, and the width tables fit into
+	times    *timeFormatter // Renders the timestamps of results
+	history  *history       // Records the queries run, nil without
+	webhook  *webhookTarget // Receives the results of watch and schedule runs, nil without
+	notifier *notifier      // Delivers to webhooks, nil when none is configured
+	// How long a response streamed in chunks may take from the stream response to its end
+	streamTimeout time.Duration
 }
 
 func main() {
-	fmt.Println("Client started")
-	natsURL := os.Getenv("NATS_URL")
-	if natsURL == "" {
-		natsURL = "nats://nats:4222"
+	os.Exit(run(os.Args[1:]))
+}
+
+// Returns a context cancelled at the first SIGINT or SIGTERM, so that a run can stop
+// cleanly; a second one exits at once.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if _, ok := <-signals; !ok {
+			return
+		}
+		logger.infof("Interrupted, finishing up; interrupt again to quit at once")
+		cancel()
+		if _, ok := <-signals; ok {
+			os.Exit(exitInterrupted)
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(signals)
+		cancel()
 	}
+}
 
-	nc, err := nats.Connect(natsURL)
+// Runs the client with the given arguments and returns its exit code
+func run(args []string) int {
+	o, err := parseOptions(args, os.Stderr)
+	if err == nil {
+		logger.setLevel(o.logLevel)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if errors.Is(err, errUsageReported) {
+		return exitUsage
+	}
 	if err != nil {
-		fmt.Printf("Failed to connect to NATS: %v\n", err)
-		return
+		logger.errorf("Invalid configuration:\n%v", err)
+		return exitUsage
 	}
-	defer nc.Close()
 
-	sendQueries(nc)
-}
-
-func sendQueries(nc *nats.Conn) {
-	queries := []ReaderRequest{
-		{
-			QueryType: "alerts_critical",
-			Params: map[string]interface{}{
-				"since_minutes":   15,
-				"min_criticality": 8,
-			},
-		},
-		{
-			QueryType: "device_health",
-			Params: map[string]interface{}{
-				"source_device": "sensor-1",
-			},
-		},
-		{
-			QueryType: "anomaly_temperature",
-			Params: map[string]interface{}{
-				"source_device":  "sensor-1",
-				"threshold":      1.3,
-				"window_minutes": 20,
-			},
-		},
-	}
-
-	for _, req := range queries {
-		sendQuery(nc, req)
-		time.Sleep(1 * time.Second)
-	}
-}
-
-func sendQuery(nc *nats.Conn, request ReaderRequest) {
-	requestJSON, err := json.Marshal(request)
-	if err != nil {
-		writeToFile("client_output.log", fmt.Sprintf("Failed to marshal request: %v", err))
-		return
+	// Listing the saved queries needs no connection
+	if o.listSaved != nil {
+		printSavedQueries(os.Stdout, o.listSaved)
+		return exitOK
 	}
 
-	msg, err := nc.Request(natsSubjectRequest, requestJSON, 10*time.Second)
+	// A queries file, a single query or watch mode ask for a batch run even from a terminal
+	batch := o.queriesFile != "" || o.queryType != "" || o.subcommand != "" || o.watch > 0
+	interactive := !o.followAlerts && o.serve == "" && (o.interactive || (!batch && isTerminal(os.Stdin)))
+	// Watch, follow, gateway, schedule and interactive mode print to stdout unless --out is
+	// given
+	outPath := o.outputFile
+	if !o.outputFileSet && (o.watch > 0 || o.followAlerts || o.serve != "" || o.schedule != nil || interactive) {
+		outPath = "-"
+	}
+	out, err := openOutput(outPath, o.truncate, o.rotation)
 	if err != nil {
-		writeToFile("client_output.log", fmt.Sprintf("Request failed: %v", err))
-		return
+		logger.errorf("Failed to open the output: %v", err)
+		return exitFailure
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			logger.errorf("Failed to write the results: %v", err)
+		}
+	}()
+	// People read tables, programs read JSON
+	if o.output == "" {
+		o.output = outputJSON
+		if out.terminal {
+			o.output = outputTable
+		}
 	}
 
-	var response ReaderResponse
-	err = json.Unmarshal(msg.Data, &response)
+	// Status lines go to stderr, so results written to stdout with --out - stay clean
+	logger.infof("Client started")
+	opts := []nats.Option{
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err == nil {
+				return // Closed by the client itself
+			}
+			logger.infof("Disconnected from NATS: %v; reconnecting...", err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logger.infof("Reconnected to NATS at %s", nc.ConnectedUrl())
+		}),
+		nats.DiscoveredServersHandler(func(nc *nats.Conn) {
+			logger.verbosef("NATS servers known: %s", strings.Join(nc.Servers(), ", "))
+		}),
+		nats.ClosedHandler(func(*nats.Conn) {
+			logger.verbosef("Connection to NATS closed")
+		}),
+	}
+	if o.followAlerts || o.watch > 0 || o.serve != "" || o.schedule != nil {
+		// Long-running modes keep reconnecting, to another server of the cluster when one
+		// goes away, instead of giving up after the default attempts
+		opts = append(opts, nats.MaxReconnects(-1), nats.ReconnectErrHandler(func(_ *nats.Conn, err error) {
+			logger.infof("Still reconnecting to NATS: %s", describeConnectError(err))
+		}))
+	}
+	nc, err := connectNATS(o.natsURL, o.connect, opts...)
 	if err != nil {
-		writeToFile("client_output.log", fmt.Sprintf("Failed to unmarshal response: %v", err))
-		return
+		logger.errorf("Failed to connect to NATS at %s: %v", o.natsURL, err)
+		return exitFailure
+	}
+	defer nc.Close()
+	logger.infof("Connected to NATS at %s", nc.ConnectedUrl())
+	if !nc.HeadersSupported() {
+		logger.infof("The NATS server does not support headers: a missing reader shows as a timeout rather than at once")
+	}
+	// Ctrl-C stops every mode but the interactive one cleanly: requests in flight are
+	// abandoned, and the results so far are written and summed up
+	ctx := context.Background()
+	if !interactive {
+		var stop func()
+		ctx, stop = interruptContext()
+		defer stop()
+	}
+	c := &client{
+		ctx:      ctx,
+		nc:       nc,
+		subject:  o.subject,
+		output:   o.output,
+		out:      out,
+		timeout:  o.timeout,
+		retry:    retryPolicy{maxAttempts: o.maxAttempts, backoff: o.retryBackoff},
+		paging:   o.paging,
+		color:    colorAllowed(o.noColor, out.terminal),
+		table:    tableLayout{columns: o.columns},
+		times:    o.times,
+		failFast: o.failFast,
+		noReader: o.noReader,
+
+		streamTimeout: o.streamTimeout,
+	}
+	defer c.times.report()
+	// Only tables for people get truncated, those on a terminal
+	if out.terminal && !o.noTruncate {
+		c.table.width = func() int { return terminalWidth(os.Stdout) }
+	}
+	if o.csvOut != "" {
+		c.csv = newCSVExport(o.csvOut, o.csvCombined)
+	}
+	if o.webhook.url != "" {
+		c.webhook = &o.webhook
+	}
+	if c.webhook != nil || slices.ContainsFunc(o.schedule, func(j scheduledJob) bool { return j.webhook != nil }) {
+		c.notifier = newNotifier(o.webhookTimeout, o.webhookAttempts)
+	}
+	// Load tests and the gateway's callers would drown a debugging session's history
+	if o.historyPath != "" && o.bench == nil && o.serve == "" {
+		h, err := openHistory(o.historyPath)
+		if err != nil {
+			logger.errorf("Failed to open the query history, not recording it: %v", err)
+		} else {
+			c.history = h
+			defer h.Close()
+		}
+	}
+
+	if o.followAlerts {
+		cfg := followConfig{subjects: followSubjects(o.followSecurity), minCriticality: o.minCriticality, color: colorAllowed(o.noColor, isTerminal(os.Stdout))}
+		if outPath != "-" {
+			cfg.file = out
+		}
+		shown, err := c.followAlerts(ctx, cfg, os.Stdout)
+		if err != nil {
+			logger.errorf("Failed to follow alerts: %v", err)
+			return exitFailure
+		}
+		logger.infof("Stopped following alerts, %d alert(s) seen.", shown)
+		return exitOK
+	}
+
+	if o.bench != nil {
+		report := c.runBench(ctx, *o.bench)
+		// The human report makes way on stdout for the JSON one
+		if o.bench.jsonOut == "-" {
+			printBenchReport(os.Stderr, report)
+		} else {
+			printBenchReport(os.Stdout, report)
+		}
+		if o.bench.jsonOut != "" {
+			if err := writeBenchJSON(o.bench.jsonOut, report); err != nil {
+				logger.errorf("Failed to write the bench report: %v", err)
+				return exitFailure
+			}
+		}
+		// Queries aborted by Ctrl-C did not fail
+		if report.Sent-report.Errors[benchAborted] > report.Succeeded {
+			return exitFailure
+		}
+		return exitOK
+	}
+	if o.diff != nil {
+		return c.runDiff(*o.diff, os.Stdout)
+	}
+	// Ctrl-C is how the schedule ends, as with watching
+	if o.schedule != nil {
+		if failure := c.runSchedule(ctx, o.schedule); failure != "" {
+			return failure.exitCode()
+		}
+		return exitOK
+	}
+	if o.ack != nil {
+		failure, err := c.runAck(*o.ack, os.Stdout)
+		if err != nil {
+			logger.errorf("%v", err)
+			return failure.exitCode()
+		}
+		return exitOK
+	}
+	if o.check != nil {
+		verdict := c.runCheck(*o.check)
+		fmt.Fprintln(os.Stdout, verdict.line)
+		return verdict.code
+	}
+	if o.serve != "" {
+		var cache *responseCache
+		if o.cacheTTL > 0 {
+			cache = newResponseCache(o.cacheTTL, o.cacheEntries)
+		}
+		if err := c.serve(ctx, o.serve, o.serveInFlight, cache); err != nil {
+			logger.errorf("Failed to serve: %v", err)
+			return exitFailure
+		}
+		logger.infof("Stopped serving.")
+		return exitOK
 	}
 
-	if response.Status == "success" {
-		formatted := formatJSON(response.Data)
-		writeToFile("client_output.log", fmt.Sprintf("QueryType: %s\n%s\n", request.QueryType, formatted))
+	if interactive {
+		c.runInteractive(os.Stdin, os.Stdout)
+		return exitOK
+	}
+	var failure failureCode
+	if o.watch > 0 {
+		failure, err = c.runWatch(ctx, o.queries, o.watch, o.watchFailures)
 	} else {
-		writeToFile("client_output.log", fmt.Sprintf("QueryType: %s\nError: %s\n", request.QueryType, response.Message))
+		failure, err = c.sendQueries(o.queries, o.parallel)
+	}
+	if err != nil {
+		logger.errorf("Failed to write the results: %v", err)
+		return exitFailure
+	}
+	if c.csv != nil {
+		paths, err := c.csv.write()
+		if err != nil {
+			logger.errorf("Failed to write the CSV export: %v", err)
+			return exitFailure
+		}
+		logger.infof("Wrote the CSV export to %s", strings.Join(paths, ", "))
+	}
+	// Ctrl-C is how watching ends, but it cuts a batch run short
+	if o.watch == 0 && ctx.Err() != nil {
+		return exitInterrupted
+	}
+	if failure != "" {
+		return failure.exitCode()
+	}
+	return exitOK
+}
+
+// queryResult is the formatted outcome of one query and, when it failed, why.
+type queryResult struct {
+	text     string
+	exchange exchange
+	answered bool        // Whether the reader responded, successfully or not
+	err      error       // Connection error, timeout or error status from the reader
+	failure  failureCode // Classifies err
+}
+
+// Returns the error of a query that got no usable response, nil when the reader answered
+func (r queryResult) queryErr() error {
+	if r.answered {
+		return nil
+	}
+	return r.err
+}
+
+// Runs the queries, each repeat counting as a query of its own, on up to parallel
+// workers and writes the results to the output file in the order of the queries. A
+// sequential run pauses a second between queries. Failures are also reported on stderr,
+// and with fail-fast the run stops at the first of them. Cancelling the client's context
+// stops it after the results completed so far. Returns the code of the first failure, ""
+// without any, and the write error that stopped the run, if any.
+func (c *client) sendQueries(queries []plannedQuery, parallel int) (failureCode, error) {
+	var jobs []plannedQuery
+	for _, q := range queries {
+		for i := 0; i < q.repeat; i++ {
+			jobs = append(jobs, q)
+		}
+	}
+
+	results := make([]chan queryResult, len(jobs))
+	for i := range results {
+		results[i] = make(chan queryResult, 1)
+	}
+	// Closed at the first failure with fail-fast, so that no further job is handed out.
+	// Jobs go out in order, so every job before a failed one still completes.
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for i := range jobs {
+			select {
+			case next <- i:
+			case <-stop:
+				return
+			case <-c.ctx.Done():
+				return
+			}
+		}
+	}()
+	for w := 0; w < min(parallel, len(jobs)); w++ {
+		go func() {
+			for i := range next {
+				result := c.forQuery(jobs[i]).sendQuery(jobs[i].requestAt(time.Now()), jobs[i].timeout)
+				results[i] <- result
+				if result.err != nil && (c.failFast || c.stopsWithoutReader(result)) {
+					stopOnce.Do(func() { close(stop) })
+				}
+				if parallel == 1 {
+					select {
+					case <-time.After(1 * time.Second):
+					case <-c.ctx.Done():
+					}
+				}
+			}
+		}()
+	}
+
+	// Results that finish early wait in their channel until all before them are written
+	var stats queryStats
+	for i, result := range results {
+		var r queryResult
+		select {
+		case r = <-result:
+		case <-c.ctx.Done():
+			// The job was aborted or never handed out; take a result that made it anyway
+			select {
+			case r = <-result:
+			default:
+				r.err = c.ctx.Err()
+			}
+		}
+		if errors.Is(r.err, context.Canceled) {
+			logger.infof("Interrupted: %d of %d queries completed, %d aborted.", i, len(jobs), len(jobs)-i)
+			break
+		}
+		if err := c.out.writeResult(r.text); err != nil {
+			return stats.failure, err
+		}
+		stats.add(r.exchange, r.failure, r.answered)
+		c.exportCSV(r)
+		if r.err == nil {
+			continue
+		}
+		logger.errorf("Query %s (request %s) failed: %v", jobs[i].request.QueryType, r.exchange.request.RequestID, r.err)
+		if c.failFast {
+			logger.infof("Stopping after the first failure, %d of %d queries not run.", len(jobs)-i-1, len(jobs))
+			break
+		}
+		if c.stopsWithoutReader(r) {
+			logger.infof("Stopping without a reader on '%s', %d of %d queries not run (--on-no-reader %s runs them anyway).", c.subject, len(jobs)-i-1, len(jobs), noReaderContinue)
+			break
+		}
+	}
+	return stats.failure, c.writeSummary(&stats)
+}
+
+// Reports whether a batch run stops after the result: it found no reader, and the remaining
+// queries would find none either
+func (c *client) stopsWithoutReader(r queryResult) bool {
+	return r.failure == failureNoResponders && c.noReader == noReaderAbort
+}
+
+// Writes the summary line of a run to the output, or to stderr for CSV and JSONL that must
+// stay valid; -q leaves it out
+func (c *client) writeSummary(stats *queryStats) error {
+	if !logger.enabled(levelNormal) {
+		return nil
+	}
+	if c.output == outputCSV || c.output == outputJSONL {
+		logger.infof("%s", stats)
+		return nil
 	}
+	return c.out.writeResult(stats.String())
 }
 
-func writeToFile(filename string, content string) error {
-	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// Adds a successful result to the CSV export, if any, warning about data that is not a table
+func (c *client) exportCSV(r queryResult) {
+	if c.csv == nil || r.err != nil {
+		return
+	}
+	if err := c.csv.add(r.exchange.request.QueryType, c.times.machineData(r.exchange.response.Data)); err != nil {
+		logger.infof("Skipping the %s result (request %s) in the CSV export: %v", r.exchange.request.QueryType, r.exchange.request.RequestID, err)
+	}
+}
+
+// Sends one query and returns its formatted result, failed when the request got no
+// response or the reader answered with an error status
+func (c *client) sendQuery(request ReaderRequest, timeout time.Duration) queryResult {
+	ex, err := c.query(request, timeout)
 	if err != nil {
-		fmt.Printf("Failed to open file: %v\n", err)
-		return err
+		return queryResult{text: c.formatError(ex, err), exchange: ex, err: err, failure: classifyFailure(err)}
+	}
+	result := queryResult{text: c.formatResponse(ex), exchange: ex, answered: true}
+	if ex.response.Status != "success" {
+		result.err = fmt.Errorf("reader returned status %q: %s", ex.response.Status, ex.response.Message)
+		result.failure = newQueryFailure(ex, nil).Code
 	}
-	defer f.Close()
+	return result
+}
+
+// Sends the request to the reader, following its pages as set by the paging policy, and
+// checks the data of a successful response against the schema of its query type. The query
+// is recorded in the history, if any. The
+// exchange carries the request as sent even when the query fails.
+func (c *client) query(request ReaderRequest, timeout time.Duration) (exchange, error) {
+	return c.queryPaged(request, timeout, c.paging)
+}
 
-	_, err = f.WriteString(fmt.Sprintf("%s\n", content))
-	return err
+// Sends the request as query does, following its pages as set by paging instead
+func (c *client) queryPaged(request ReaderRequest, timeout time.Duration, paging pagingPolicy) (ex exchange, err error) {
+	// Answered by the client from other queries, each recorded on its own
+	if request.QueryType == fleetHealthQuery {
+		return c.queryFleetHealth(request, timeout)
+	}
+	defer func() { c.history.record(request, ex, err) }()
+	ex, err = c.queryPages(request, timeout, paging)
+	if err != nil || ex.response.Status != "success" {
+		return ex, err
+	}
+	typed, known, err := decodeResponseData(request.QueryType, ex.response.Data)
+	if err != nil {
+		return ex, decodeErrorf("Response to %s does not match its schema: %v", request.QueryType, err)
+	}
+	if !known {
+		if _, warned := warnedQueryTypes.LoadOrStore(request.QueryType, true); !warned {
+			logger.infof("No response schema for query type %s, its data is rendered as is", request.QueryType)
+		}
+	}
+	ex.typed = typed
+	return ex, nil
 }
 
-func formatJSON(data interface{}) string {
-	b, err := json.MarshalIndent(data, "", "  ")
+// Sends the request to the reader under a new request ID and waits up to timeout for its
+// response, the client's timeout when 0
+func (c *client) queryPage(request ReaderRequest, timeout time.Duration) (exchange, error) {
+	if timeout == 0 {
+		timeout = c.timeout
+	}
+	request.RequestID = uuid.NewString()
+	ex := exchange{request: request, timeout: timeout}
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return ex, fmt.Errorf("Failed to marshal request: %v", err)
+	}
+
+	logger.verbosef("Sending %s (request %s) on '%s', timeout %s", request.QueryType, request.RequestID, c.subject, timeout)
+	logger.debugf("Request %s: %s", request.RequestID, requestJSON)
+	start := time.Now()
+	msg, attempts, err := c.requestWithRetry(request, requestJSON, timeout)
+	ex.attempts = attempts
+	ex.latency = time.Since(start)
 	if err != nil {
-		return fmt.Sprintf("Error formatting JSON: %v", err)
+		return ex, err
+	}
+	logger.verbosef("Response to %s (request %s) after %s and %d attempt(s), %d bytes", request.QueryType, request.RequestID, roundLatency(ex.latency), attempts, len(msg.Data))
+	logger.debugf("Response %s: %s", request.RequestID, msg.Data)
+
+	err = json.Unmarshal(msg.Data, &ex.response)
+	if err != nil {
+		return ex, decodeErrorf("Failed to unmarshal response: %v", err)
+	}
+	// Readers predating request IDs answer without one
+	if ex.response.RequestID != "" && ex.response.RequestID != request.RequestID {
+		return ex, decodeErrorf("Response is for request %s, not %s", ex.response.RequestID, request.RequestID)
+	}
+	if ex.response.Status == statusStream {
+		err = c.collectStream(&ex, msg)
+		ex.latency = time.Since(start)
+	}
+	return ex, err
+}
+
+// warnedQueryTypes holds the query types without a response schema already warned about
+var warnedQueryTypes sync.Map
+
+// Renders a response in the output format under its query type, request ID and latency.
+// CSV results carry no such header, so that they stay valid CSV.
+func (c *client) formatResponse(ex exchange) string {
+	if c.output == outputJSONL {
+		record := newJSONLRecord(ex, nil)
+		record.Data = c.times.machineData(record.Data)
+		return formatJSONL(record)
+	}
+	header := fmt.Sprintf("QueryType: %s\nRequestID: %s (%s)\n", ex.request.QueryType, ex.request.RequestID, ex.timing())
+	if ex.response.Status == "success" {
+		data := ex.response.Data
+		// Tables and CSV convert their cells instead, once the columns are known
+		if c.output == outputJSON {
+			data = c.times.machineData(data)
+		}
+		body := formatData(data, c.output)
+		if c.output != outputJSON {
+			columns, rows, ok := tabulate(ex.response.Data)
+			// Typed data keeps the columns in the order of its schema
+			if ex.typed != nil {
+				columns, rows = typedTable(ex.typed)
+				ok = true
+			}
+			if ok {
+				columns, rows = c.table.selectColumns(columns, rows)
+			}
+			switch {
+			case ok && c.output == outputCSV:
+				body = formatCSV(columns, c.times.machineCells(columns, rows))
+			case ok:
+				columns, rows = c.table.fit(columns, c.times.humanCells(columns, rows))
+				body = formatTable(columns, rows)
+				if c.color {
+					body = colorTable(body, columns, rows)
+				}
+			}
+		}
+		if c.output == outputCSV {
+			return body
+		}
+		return fmt.Sprintf("%s%s\n", header, body)
+	}
+	if c.output == outputJSON {
+		return fmt.Sprintf("%s%s\n", header, formatJSON(jsonFailure{newQueryFailure(ex, nil)}))
+	}
+	return fmt.Sprintf("%sError: %s\n", header, ex.response.Message)
+}
+
+// jsonFailure is the body of a failed result in the json format.
+type jsonFailure struct {
+	Error queryFailure `json:"error"`
+}
+
+// Renders a query that got no usable response, as an error object in the json and jsonl
+// formats
+func (c *client) formatError(ex exchange, err error) string {
+	if c.output == outputJSONL {
+		return formatJSONL(newJSONLRecord(ex, err))
+	}
+	failure := newQueryFailure(ex, err)
+	header := fmt.Sprintf("QueryType: %s\nRequestID: %s\n", ex.request.QueryType, ex.request.RequestID)
+	if ex.timeout != 0 {
+		header = fmt.Sprintf("QueryType: %s\nRequestID: %s (%s)\n", ex.request.QueryType, ex.request.RequestID, ex.timing())
+	}
+	if c.output == outputJSON {
+		return fmt.Sprintf("%s%s\n", header, formatJSON(jsonFailure{failure}))
 	}
-	return string(b)
+	return fmt.Sprintf("%sError: %v\n", header, err)
 }
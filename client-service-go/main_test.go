@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// slowReader answers every query after latency, each on its own goroutine as the reader
+// does, echoing the request's source_device. It returns the most requests it ever had in
+// flight at once.
+func slowReader(t *testing.T, s *fakeNATS, latency time.Duration) func() int64 {
+	t.Helper()
+	nc := connectFake(t, s)
+	var inFlight, most atomic.Int64
+	_, err := nc.Subscribe(natsSubjectRequest, func(m *nats.Msg) {
+		go func() {
+			n := inFlight.Add(1)
+			for seen := most.Load(); n > seen && !most.CompareAndSwap(seen, n); seen = most.Load() {
+			}
+			time.Sleep(latency)
+			inFlight.Add(-1)
+			var request ReaderRequest
+			_ = json.Unmarshal(m.Data, &request)
+			data, _ := json.Marshal(ReaderResponse{RequestID: request.RequestID, Status: "success", Data: map[string]interface{}{"device": request.Params["source_device"], "health": "ok", "events_last_hour": 0, "metrics": []interface{}{}}})
+			_ = m.Respond(data)
+		}()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return most.Load
+}
+
+// jsonlResults returns the JSONL records the client wrote to its output file
+func jsonlResults(t *testing.T, c *client) []jsonlRecord {
+	t.Helper()
+	data, err := os.ReadFile(c.out.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []jsonlRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record jsonlRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// deviceQueries returns n device_health queries, one per device
+func deviceQueries(n int) []plannedQuery {
+	queries := make([]plannedQuery, n)
+	for i := range queries {
+		queries[i] = plannedQuery{request: ReaderRequest{QueryType: "device_health", Params: map[string]interface{}{"source_device": fmt.Sprintf("dev-%02d", i)}}, repeat: 1}
+	}
+	return queries
+}
+
+func TestSendQueriesBoundedParallelism(t *testing.T) {
+	const n, latency = 10, 100 * time.Millisecond
+	for _, parallel := range []int{2, 4, 10} {
+		t.Run(fmt.Sprintf("parallel %d", parallel), func(t *testing.T) {
+			s := startFakeNATS(t)
+			most := slowReader(t, s, latency)
+			c := newTestClient(t, s)
+			c.output = outputJSONL
+
+			start := time.Now()
+			if failure, err := c.sendQueries(deviceQueries(n), parallel); failure != "" || err != nil {
+				t.Fatalf("sendQueries = %q, %v", failure, err)
+			}
+			elapsed := time.Since(start)
+
+			rounds := (n + parallel - 1) / parallel
+			if want := time.Duration(rounds) * latency; elapsed < want || elapsed > want+latency {
+				t.Errorf("%d queries took %s, want about %s: %d round(s) of %s", n, elapsed, want, rounds, latency)
+			}
+			if most() != int64(parallel) {
+				t.Errorf("%d queries in flight at most, want %d", most(), parallel)
+			}
+			records := jsonlResults(t, c)
+			if len(records) != n {
+				t.Fatalf("wrote %d result(s), want %d", len(records), n)
+			}
+			for i, record := range records {
+				data, _ := record.Data.(map[string]interface{})
+				if want := fmt.Sprintf("dev-%02d", i); data["device"] != want {
+					t.Errorf("result %d is of %v, want %s: results must keep the order of the queries", i, data["device"], want)
+				}
+			}
+		})
+	}
+}
+
+// runClient runs the client with the command line in the environment env, every other
+// variable of the client unset, and returns its exit code. Results go to a file of the
+// test and no history is recorded.
+func runClient(t *testing.T, env map[string]string, args ...string) int {
+	t.Helper()
+	for _, name := range clientEnv {
+		t.Setenv(name, env[name])
+	}
+	return run(append([]string{"--out", filepath.Join(t.TempDir(), "results"), "--history", ""}, args...))
+}
+
+func TestRunExitCodes(t *testing.T) {
+	s := startFakeNATS(t)
+	fakeReader(t, s, natsSubjectRequest, func(request ReaderRequest) ReaderResponse {
+		switch request.Params["source_device"] {
+		case "ok":
+			return ReaderResponse{Status: "success", Data: map[string]interface{}{"device": "ok", "health": "ok", "events_last_hour": 0, "metrics": []interface{}{}}}
+		case "garbled":
+			return ReaderResponse{Status: "success", Data: "not a health object"}
+		}
+		return ReaderResponse{Status: "error", Message: "unknown device"}
+	})
+	silent := startFakeNATS(t)
+	silentReader(t, silent)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	query := func(device string) []string {
+		return []string{"--nats-url", s.url(), "--query", "device_health", "--device", device, "--timeout", "100ms", "--max-attempts", "1"}
+	}
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"success", query("ok"), exitOK},
+		{"reader error", query("missing"), exitFailure},
+		{"timeout", append(query("ok"), "--nats-url", silent.url()), exitTimeout},
+		{"decode error", query("garbled"), exitDecodeError},
+		{"no reader", append(query("ok"), "--subject", "reader.nobody"), exitNoResponders},
+		{"no connection", []string{"--nats-url", "nats://" + closed.Addr().String(), "--connect-attempts", "1", "--query", "device_list"}, exitFailure},
+		{"invalid flag value", []string{"--parallel", "0"}, exitUsage},
+		{"unknown flag", []string{"--paralel", "2"}, exitUsage},
+		{"help", []string{"--help"}, exitOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runClient(t, nil, tt.args...); got != tt.want {
+				t.Errorf("exit code %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// The first failure of a batch picks the exit code
+	queries := filepath.Join(t.TempDir(), "queries.yaml")
+	file := "- {query_type: device_health, params: {source_device: ok}}\n- {query_type: device_health, params: {source_device: missing}}\n- {query_type: device_health, params: {source_device: garbled}}\n"
+	if err := os.WriteFile(queries, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := runClient(t, nil, "--nats-url", s.url(), "--queries", queries, "--max-attempts", "1", "--parallel", "3"); got != exitFailure {
+		t.Errorf("batch exit code %d, want %d of its first failure", got, exitFailure)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// fakeNATS is a NATS server speaking just enough of the client protocol for the tests, as
+// no server is embedded in them: it routes published messages to the matching
+// subscriptions of every connection, queue groups included, and answers requests nobody
+// is subscribed to with the no-responders status, as a server with headers does.
+type fakeNATS struct {
+	ln net.Listener
+
+	mu    sync.Mutex
+	conns map[*fakeConn]bool
+}
+
+// fakeConn is a client connection of a fakeNATS with its subscriptions by sid
+type fakeConn struct {
+	net.Conn
+	mu   sync.Mutex // Serializes writes
+	subs map[string]fakeSub
+}
+
+type fakeSub struct {
+	subject, queue string
+}
+
+// startFakeNATS starts a fakeNATS on a free local port, stopped when the test ends
+func startFakeNATS(t *testing.T) *fakeNATS {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeNATS{ln: ln, conns: map[*fakeConn]bool{}}
+	go s.accept()
+	t.Cleanup(s.stop)
+	return s
+}
+
+func (s *fakeNATS) url() string {
+	return "nats://" + s.ln.Addr().String()
+}
+
+// stop closes the listener and every client connection, as a server going away
+func (s *fakeNATS) stop() {
+	s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *fakeNATS) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &fakeConn{Conn: conn, subs: map[string]fakeSub{}}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+		go s.serve(c)
+	}
+}
+
+// serve answers one client connection until it is closed
+func (s *fakeNATS) serve(c *fakeConn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+	c.write("INFO {\"server_id\":\"fake\",\"version\":\"2.10.0\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			c.write("PONG\r\n")
+		case "SUB": // SUB <subject> [queue] <sid>
+			sub := fakeSub{subject: fields[1]}
+			if len(fields) == 4 {
+				sub.queue = fields[2]
+			}
+			s.mu.Lock()
+			c.subs[fields[len(fields)-1]] = sub
+			s.mu.Unlock()
+		case "UNSUB":
+			s.mu.Lock()
+			delete(c.subs, fields[1])
+			s.mu.Unlock()
+		case "PUB", "HPUB": // PUB <subject> [reply] <size>, HPUB <subject> [reply] <header size> <size>
+			sizes := 1
+			if fields[0] == "HPUB" {
+				sizes = 2
+			}
+			reply := ""
+			if len(fields) == 3+sizes {
+				reply = fields[2]
+			}
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			headerSize := 0
+			if sizes == 2 {
+				headerSize, _ = strconv.Atoi(fields[len(fields)-2])
+			}
+			raw := make([]byte, size+2)
+			if _, err := io.ReadFull(r, raw); err != nil {
+				return
+			}
+			s.route(fields[1], reply, raw[:headerSize], raw[headerSize:size])
+		}
+	}
+}
+
+// route delivers a message to every matching subscription, one per queue group, or
+// answers a request without any with the no-responders status
+func (s *fakeNATS) route(subject, reply string, header, data []byte) {
+	type delivery struct {
+		conn *fakeConn
+		sid  string
+	}
+	var deliveries []delivery
+	s.mu.Lock()
+	queues := map[string]bool{}
+	for conn := range s.conns {
+		for sid, sub := range conn.subs {
+			if !subjectMatches(sub.subject, subject) || sub.queue != "" && queues[sub.queue] {
+				continue
+			}
+			if sub.queue != "" {
+				queues[sub.queue] = true
+			}
+			deliveries = append(deliveries, delivery{conn, sid})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, d := range deliveries {
+		target := subject + " " + d.sid
+		if reply != "" {
+			target += " " + reply
+		}
+		if len(header) > 0 {
+			d.conn.write(fmt.Sprintf("HMSG %s %d %d\r\n%s%s\r\n", target, len(header), len(header)+len(data), header, data))
+		} else {
+			d.conn.write(fmt.Sprintf("MSG %s %d\r\n%s\r\n", target, len(data), data))
+		}
+	}
+	if len(deliveries) == 0 && reply != "" {
+		noResponders := "NATS/1.0 503\r\n\r\n"
+		s.route(reply, "", []byte(noResponders), nil)
+	}
+}
+
+func (c *fakeConn) write(data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.SetWriteDeadline(time.Now().Add(time.Second))
+	_, _ = io.WriteString(c, data)
+}
+
+// subjectMatches reports whether subject matches pattern, which may hold * and > wildcards
+func subjectMatches(pattern, subject string) bool {
+	p, s := strings.Split(pattern, "."), strings.Split(subject, ".")
+	for i, token := range p {
+		if token == ">" {
+			return len(s) > i
+		}
+		if i >= len(s) || token != "*" && token != s[i] {
+			return false
+		}
+	}
+	return len(p) == len(s)
+}
+
+// connectFake connects to the server, closing the connection when the test ends
+func connectFake(t *testing.T, s *fakeNATS, opts ...nats.Option) *nats.Conn {
+	t.Helper()
+	nc, err := nats.Connect(s.url(), opts...)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+// fakeReader answers the queries on the reader's subject with respond, as the reader would.
+// It returns the requests it received so far.
+func fakeReader(t *testing.T, s *fakeNATS, subject string, respond func(ReaderRequest) ReaderResponse) func() []ReaderRequest {
+	t.Helper()
+	nc := connectFake(t, s)
+	var mu sync.Mutex
+	var requests []ReaderRequest
+	_, err := nc.Subscribe(subject, func(m *nats.Msg) {
+		var request ReaderRequest
+		if err := json.Unmarshal(m.Data, &request); err != nil {
+			t.Errorf("fake reader: %v", err)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, request)
+		mu.Unlock()
+		response := respond(request)
+		if response.RequestID == "" {
+			response.RequestID = request.RequestID
+		}
+		data, _ := json.Marshal(response)
+		_ = m.Respond(data)
+	})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	return func() []ReaderRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]ReaderRequest(nil), requests...)
+	}
+}
+
+// newTestClient returns a client connected to the server that renders JSON into a file of
+// the test, as a batch run would
+func newTestClient(t *testing.T, s *fakeNATS) *client {
+	t.Helper()
+	out, err := openOutput(filepath.Join(t.TempDir(), "results"), true, rotation{})
+	if err != nil {
+		t.Fatalf("openOutput: %v", err)
+	}
+	t.Cleanup(func() { out.Close() })
+	return &client{
+		ctx:           t.Context(),
+		nc:            connectFake(t, s),
+		subject:       natsSubjectRequest,
+		output:        outputJSON,
+		out:           out,
+		timeout:       2 * time.Second,
+		retry:         retryPolicy{maxAttempts: 1},
+		paging:        pagingPolicy{maxPages: defaultMaxPages},
+		times:         &timeFormatter{},
+		streamTimeout: time.Second,
+	}
+}
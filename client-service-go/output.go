@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rotatedSuffixLayout is the time layout of the suffix of rotated output files, sorting in
+// the order of rotation
+const rotatedSuffixLayout = "20060102-150405.000"
+
+// output receives the results of a run: a file opened once for the whole run, or stdout.
+// The first write error sticks, so that callers can check Err once per result.
+type output struct {
+	file     *os.File
+	name     string // Path of the file, or "stdout"
+	terminal bool   // Whether the results are read by a person rather than a program
+	rotation rotation
+	size     int64 // Bytes in the file, checked against the rotation limit
+	err      error
+}
+
+// rotation limits the size of an output file. Once it reaches maxSize bytes the file is
+// renamed with a timestamp suffix and a new one started, keeping maxFiles of the renamed
+// ones. A maxSize of 0 never rotates.
+type rotation struct {
+	maxSize  int64
+	maxFiles int
+}
+
+// Opens path for the results, "-" meaning stdout. Missing parent directories are created.
+// The file is appended to, or emptied first when truncate is set, and rotated as set by r.
+func openOutput(path string, truncate bool, r rotation) (*output, error) {
+	if path == "-" {
+		return &output{file: os.Stdout, name: "stdout", terminal: isTerminal(os.Stdout)}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("creating the directory of %s: %w", path, err)
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &output{file: f, name: path, rotation: r, size: info.Size()}, nil
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	if o.err != nil {
+		return 0, o.err
+	}
+	if o.rotation.maxSize > 0 && o.size >= o.rotation.maxSize {
+		if err := o.rotate(); err != nil {
+			o.err = fmt.Errorf("rotating %s: %w", o.name, err)
+			return 0, o.err
+		}
+	}
+	n, err := o.file.Write(p)
+	o.size += int64(n)
+	if err != nil {
+		o.err = fmt.Errorf("writing to %s: %w", o.name, err)
+	}
+	return n, o.err
+}
+
+// Renames the full file and starts a new one. The rename is atomic, so a process killed in
+// between leaves every line written so far in the renamed file, and the next run simply
+// creates the new one.
+func (o *output) rotate() error {
+	// Rotations within the same millisecond are numbered after those of it still kept, so
+	// that the newest file always sorts last even after the oldest ones were pruned
+	rotated := o.name + "." + time.Now().Format(rotatedSuffixLayout)
+	if same, _ := filepath.Glob(rotated + "*"); len(same) > 0 {
+		base := rotated
+		for i := len(same); ; i++ {
+			if rotated = fmt.Sprintf("%s.%d", base, i); !fileExists(rotated) {
+				break
+			}
+		}
+	}
+	if err := os.Rename(o.name, rotated); err != nil {
+		return err
+	}
+	o.file.Close()
+	f, err := os.OpenFile(o.name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	o.file, o.size = f, 0
+	return o.pruneRotated()
+}
+
+// Removes the oldest rotated files beyond the number to keep
+func (o *output) pruneRotated() error {
+	matches, err := filepath.Glob(o.name + ".*")
+	if err != nil {
+		return err
+	}
+	var rotated []string
+	for _, m := range matches {
+		suffix := strings.TrimPrefix(m, o.name+".")
+		if len(suffix) < len(rotatedSuffixLayout) {
+			continue
+		}
+		if _, err := time.Parse(rotatedSuffixLayout, suffix[:len(rotatedSuffixLayout)]); err == nil {
+			rotated = append(rotated, m)
+		}
+	}
+	if len(rotated) <= o.rotation.maxFiles {
+		return nil
+	}
+	sort.Slice(rotated, func(i, j int) bool {
+		si, ni := rotationOrder(strings.TrimPrefix(rotated[i], o.name+"."))
+		sj, nj := rotationOrder(strings.TrimPrefix(rotated[j], o.name+"."))
+		return si < sj || si == sj && ni < nj
+	})
+	for _, old := range rotated[:len(rotated)-o.rotation.maxFiles] {
+		if err := os.Remove(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Splits the suffix of a rotated file into its timestamp and its number within the
+// millisecond, 0 for the first
+func rotationOrder(suffix string) (string, int) {
+	n, _ := strconv.Atoi(strings.TrimPrefix(suffix[len(rotatedSuffixLayout):], "."))
+	return suffix[:len(rotatedSuffixLayout)], n
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Parses a size such as 500, 64KB, 10MB or 1GB, the units being powers of 1024
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		factor int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	value, factor := strings.ToUpper(strings.TrimSpace(s)), int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(value, u.suffix) {
+			value, factor = strings.TrimSpace(strings.TrimSuffix(value, u.suffix)), u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size such as 500, 64KB or 10MB", s)
+	}
+	return n * factor, nil
+}
+
+// Writes one result followed by a newline and returns the first write error of the output
+func (o *output) writeResult(content string) error {
+	fmt.Fprintln(o, content)
+	return o.err
+}
+
+// Returns the first write error of the output
+func (o *output) Err() error {
+	return o.err
+}
+
+// Closes the file, stdout staying open. Write errors are left to Err.
+func (o *output) Close() error {
+	if o.file == os.Stdout {
+		return nil
+	}
+	return o.file.Close()
+}
+
+// Reports whether f is a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeResults opens path as the client does, writes the results and closes it
+func writeResults(t *testing.T, path string, truncate bool, r rotation, results ...string) {
+	t.Helper()
+	out, err := openOutput(path, truncate, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if err := out.writeResult(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile returns the content of the file at path
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestOutputAppendsOrTruncates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "dir", "results.log") // Missing directories are created
+	writeResults(t, path, false, rotation{}, "first")
+	writeResults(t, path, false, rotation{}, "second")
+	if got := readFile(t, path); got != "first\nsecond\n" {
+		t.Errorf("appended runs wrote %q", got)
+	}
+	writeResults(t, path, true, rotation{}, "third")
+	if got := readFile(t, path); got != "third\n" {
+		t.Errorf("truncating run left %q", got)
+	}
+}
+
+func TestOutputToStdout(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out, err := openOutput("-", true, rotation{maxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.name != "stdout" || out.terminal {
+		t.Errorf("output %s, terminal %t, want stdout that is no terminal", out.name, out.terminal)
+	}
+	for _, result := range []string{"one", "two"} {
+		if err := out.writeResult(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close() // Still open after out.Close, as stdout must stay
+	got, _ := io.ReadAll(r)
+	if string(got) != "one\ntwo\n" {
+		t.Errorf("stdout received %q", got)
+	}
+}
+
+func TestOutputFlags(t *testing.T) {
+	o, err := parseTestOptions(t, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.outputFile != defaultOutputFile || o.outputFileSet || o.truncate {
+		t.Errorf("defaults write to %s (set %t, truncate %t), want appending to %s", o.outputFile, o.outputFileSet, o.truncate, defaultOutputFile)
+	}
+	for _, args := range [][]string{{"--out", "-", "--truncate"}, {"--output-file", "-", "--truncate"}} {
+		o, err := parseTestOptions(t, nil, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o.outputFile != "-" || !o.outputFileSet || !o.truncate {
+			t.Errorf("%q writes to %s (set %t, truncate %t)", args, o.outputFile, o.outputFileSet, o.truncate)
+		}
+	}
+	if _, err := parseTestOptions(t, nil, "--out", ""); err == nil {
+		t.Error("accepted an empty --out")
+	}
+}
+
+// rotatedFiles returns the contents of the rotated files of path, oldest first
+func rotatedFiles(t *testing.T, path string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(matches)
+	contents := make([]string, len(matches))
+	for i, m := range matches {
+		contents[i] = readFile(t, m)
+	}
+	return contents
+}
+
+func TestOutputRotatesAtTheSizeLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.log")
+	// Every result line takes 9 bytes, so a file takes two before reaching 10
+	r := rotation{maxSize: 10, maxFiles: 2}
+	writeResults(t, path, false, r, "result-1", "result-2", "result-3", "result-4", "result-5", "result-6", "result-7")
+
+	if got := readFile(t, path); got != "result-7\n" {
+		t.Errorf("current file holds %q", got)
+	}
+	// The oldest rotated file, holding results 1 and 2, was removed
+	if got := strings.Join(rotatedFiles(t, path), "|"); got != "result-3\nresult-4\n|result-5\nresult-6\n" {
+		t.Errorf("rotated files hold %q, want the last two of them whole", got)
+	}
+
+	// The next run counts what the file holds already
+	writeResults(t, path, false, r, "result-8", "result-9")
+	if got := readFile(t, path); got != "result-9\n" {
+		t.Errorf("next run left %q in the current file", got)
+	}
+	if got := rotatedFiles(t, path); len(got) != 2 || got[1] != "result-7\nresult-8\n" {
+		t.Errorf("rotated files after the next run %q", got)
+	}
+}
+
+func TestOutputWithoutRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.log")
+	writeResults(t, path, false, rotation{maxFiles: 2}, "result-1", "result-2", "result-3")
+	if got := rotatedFiles(t, path); len(got) != 0 {
+		t.Errorf("rotated without a size limit: %q", got)
+	}
+	if got := readFile(t, path); got != "result-1\nresult-2\nresult-3\n" {
+		t.Errorf("file holds %q", got)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{"0": 0, "500": 500, "500B": 500, "64KB": 64 << 10, "10mb": 10 << 20, " 2 GB ": 2 << 30} {
+		if got, err := parseSize(s); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "ten", "-1KB", "1.5MB", "10TB"} {
+		if _, err := parseSize(s); err == nil {
+			t.Errorf("parseSize(%q) accepted", s)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultMaxPages = 100
+
+// pagingPolicy controls how the client pages through large results. The reader answers a
+// request with a "limit" parameter with at most that many items and, when more are left, a
+// next_cursor to send back as the "cursor" parameter.
+type pagingPolicy struct {
+	pageSize int  // Items per page asked for, 0 leaves the size to the reader
+	all      bool // Follow next_cursor until the last page
+	maxPages int  // Pages followed at most, guarding against readers that never stop
+}
+
+// Sends the request and, with paging.all, the requests for its further pages, stitching
+// their data together in order so that page boundaries are invisible to formatting. The
+// exchange carries the first page's request and the latency and attempts of all pages.
+func (c *client) queryPages(request ReaderRequest, timeout time.Duration, paging pagingPolicy) (exchange, error) {
+	if paging.pageSize > 0 {
+		request.Params = withParam(request.Params, "limit", paging.pageSize)
+	}
+	ex, err := c.queryPage(request, timeout)
+	if err != nil || ex.response.Status != "success" || ex.response.NextCursor == "" {
+		return ex, err
+	}
+	if !paging.all {
+		total := ""
+		if ex.response.TotalCount != nil {
+			total = fmt.Sprintf(" (%d in total)", *ex.response.TotalCount)
+		}
+		logger.infof("Query %s (request %s) has more results%s, pass --all to fetch every page", request.QueryType, ex.request.RequestID, total)
+		return ex, nil
+	}
+	items, ok := ex.response.Data.([]interface{})
+	if !ok {
+		return ex, decodeErrorf("Query %s returned a next_cursor but its data is not a list to stitch pages into", request.QueryType)
+	}
+
+	cursors := map[string]bool{}
+	for page := 2; ex.response.NextCursor != ""; page++ {
+		cursor := ex.response.NextCursor
+		if page > paging.maxPages {
+			return ex, fmt.Errorf("Query %s stopped after %d pages (--max-pages) with results left", request.QueryType, paging.maxPages)
+		}
+		if cursors[cursor] {
+			return ex, decodeErrorf("Query %s got cursor %q twice, stopping instead of looping", request.QueryType, cursor)
+		}
+		cursors[cursor] = true
+
+		next, err := c.queryPage(ReaderRequest{QueryType: request.QueryType, Params: withParam(request.Params, "cursor", cursor)}, timeout)
+		ex.latency += next.latency
+		ex.attempts += next.attempts
+		if err != nil {
+			return ex, fmt.Errorf("Query %s page %d (request %s): %w", request.QueryType, page, next.request.RequestID, err)
+		}
+		if next.response.Status != "success" {
+			ex.response = next.response
+			return ex, nil
+		}
+		pageItems, ok := next.response.Data.([]interface{})
+		if !ok {
+			return ex, decodeErrorf("Query %s page %d: data is not a list", request.QueryType, page)
+		}
+		items = append(items, pageItems...)
+		ex.response.NextCursor = next.response.NextCursor
+	}
+	ex.response.Data = items
+	return ex, nil
+}
+
+// Returns a copy of params with the parameter set, leaving the caller's map untouched
+func withParam(params map[string]interface{}, name string, value interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(params)+1)
+	for k, v := range params {
+		copied[k] = v
+	}
+	copied[name] = value
+	return copied
+}
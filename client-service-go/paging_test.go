@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var pagedDevices = []string{"Storage-01", "Storage-02", "Storage-03", "Storage-04", "Storage-05", "Storage-06", "Storage-07"}
+
+func TestQueryStitchesThreePages(t *testing.T) {
+	s := startFakeNATS(t)
+	requests := fakeReader(t, s, natsSubjectRequest, pagedDeviceReader(pagedDevices, 3))
+	c := newTestClient(t, s)
+	c.paging = pagingPolicy{pageSize: 3, all: true, maxPages: defaultMaxPages}
+
+	ex, err := c.query(ReaderRequest{QueryType: "device_list", Params: map[string]interface{}{}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(ex.typed); got != fmt.Sprint(pagedDevices) {
+		t.Errorf("stitched %s, want every device in order", got)
+	}
+	if ex.attempts != 3 || ex.response.NextCursor != "" {
+		t.Errorf("%d attempt(s), next cursor %q, want the three pages followed to the end", ex.attempts, ex.response.NextCursor)
+	}
+	var sent []string
+	for _, r := range requests() {
+		sent = append(sent, fmt.Sprintf("limit=%v cursor=%v", r.Params["limit"], r.Params["cursor"]))
+	}
+	if want := "limit=3 cursor=<nil>, limit=3 cursor=offset-3, limit=3 cursor=offset-6"; strings.Join(sent, ", ") != want {
+		t.Errorf("sent %s, want %s", strings.Join(sent, ", "), want)
+	}
+
+	// One table, one CSV header, whatever the pages
+	c.output = outputTable
+	if table := c.formatResponse(ex); strings.Count(table, "\n------") != 1 || !strings.Contains(table, "(7 row(s))") {
+		t.Errorf("table of the stitched pages:\n%s", table)
+	}
+	c.output = outputCSV
+	if got, want := c.formatResponse(ex), "device\n"+strings.Join(pagedDevices, "\n"); got != want {
+		t.Errorf("CSV of the stitched pages = %q, want %q", got, want)
+	}
+}
+
+func TestQueryWithoutAllReturnsTheFirstPage(t *testing.T) {
+	s := startFakeNATS(t)
+	requests := fakeReader(t, s, natsSubjectRequest, pagedDeviceReader(pagedDevices, 3))
+	c := newTestClient(t, s)
+	c.paging.pageSize = 3
+
+	ex, err := c.query(ReaderRequest{QueryType: "device_list", Params: map[string]interface{}{}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(ex.typed); got != fmt.Sprint(pagedDevices[:3]) || ex.response.NextCursor != "offset-3" || len(requests()) != 1 {
+		t.Errorf("got %s with next cursor %q after %d request(s), want the first page alone", got, ex.response.NextCursor, len(requests()))
+	}
+}
+
+func TestQueryPagingLoopGuards(t *testing.T) {
+	tests := []struct {
+		name         string
+		cursor       func(page int) string // Next cursor of the page, counted from 1
+		wantCode     failureCode
+		wantMessage  string
+		wantRequests int
+	}{
+		{"cursor repeated", func(int) string { return "same" }, failureDecodeError, `got cursor "same" twice`, 2},
+		{"never ending", func(page int) string { return fmt.Sprint("page-", page+1) }, failureClientError, "stopped after 3 pages (--max-pages)", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := startFakeNATS(t)
+			page := 0
+			requests := fakeReader(t, s, natsSubjectRequest, func(ReaderRequest) ReaderResponse {
+				page++
+				return ReaderResponse{Status: "success", Data: []interface{}{fmt.Sprint("dev-", page)}, NextCursor: tt.cursor(page)}
+			})
+			c := newTestClient(t, s)
+			c.paging = pagingPolicy{all: true, maxPages: 3}
+
+			_, err := c.query(ReaderRequest{QueryType: "device_list", Params: map[string]interface{}{}}, 0)
+			if classifyFailure(err) != tt.wantCode || err == nil || !strings.Contains(err.Error(), tt.wantMessage) {
+				t.Errorf("query = %v, want a %s about %q", err, tt.wantCode, tt.wantMessage)
+			}
+			if len(requests()) != tt.wantRequests {
+				t.Errorf("sent %d request(s), want %d", len(requests()), tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestQueryPageFailures(t *testing.T) {
+	s := startFakeNATS(t)
+	fakeReader(t, s, natsSubjectRequest, func(r ReaderRequest) ReaderResponse {
+		switch r.Params["cursor"] {
+		case nil:
+			return ReaderResponse{Status: "success", Data: []interface{}{"dev-1"}, NextCursor: "2"}
+		case "2":
+			return ReaderResponse{Status: "error", Message: "cursor expired"}
+		}
+		return ReaderResponse{Status: "error", Message: "unexpected"}
+	})
+	c := newTestClient(t, s)
+	c.paging = pagingPolicy{all: true, maxPages: defaultMaxPages}
+
+	ex, err := c.query(ReaderRequest{QueryType: "device_list", Params: map[string]interface{}{}}, 0)
+	if err != nil || ex.response.Status != "error" || ex.response.Message != "cursor expired" || ex.attempts != 2 {
+		t.Errorf("query = %+v, %v, want the second page's error after 2 attempts", ex.response, err)
+	}
+
+	s2 := startFakeNATS(t)
+	fakeReader(t, s2, natsSubjectRequest, func(ReaderRequest) ReaderResponse {
+		return ReaderResponse{Status: "success", Data: map[string]interface{}{}, NextCursor: "2"}
+	})
+	c = newTestClient(t, s2)
+	c.paging = pagingPolicy{all: true, maxPages: defaultMaxPages}
+	if _, err := c.query(ReaderRequest{QueryType: "device_list", Params: map[string]interface{}{}}, 0); classifyFailure(err) != failureDecodeError {
+		t.Errorf("paged query of data that is not a list = %v, want a decode error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const profilesFileName = ".event_client.yaml"
+
+// profilesFile is the client's config file, naming sets of global flags to switch between
+// environments with --profile:
+//
+//	profiles:
+//	  staging:
+//	    nats-url: nats://nats.staging:4222
+//	    subject: reader.staging.query
+//	    timeout: 20s
+//	    output: table
+//
+// Keys are the names of global flags. Flags given on the command line win over the profile.
+type profilesFile struct {
+	Profiles map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// Returns the default config file in the home directory, or "" when there is no home
+func defaultProfilesPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, profilesFileName)
+}
+
+// Sets the flags of the named profile in path that were not given on the command line
+func applyProfile(fs *flag.FlagSet, path, name string) error {
+	if path == "" {
+		return errors.New("--config: is required without a home directory")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("--config: %w", err)
+	}
+	var file profilesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("--config %s: %w", path, err)
+	}
+	profile, ok := file.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(file.Profiles))
+		for n := range file.Profiles {
+			names = append(names, n)
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("--profile %q: %s has no profiles", name, path)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("--profile %q: not in %s, which has %s", name, path, strings.Join(names, ", "))
+	}
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	keys := make([]string, 0, len(profile))
+	for key := range profile {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var problems []error
+	for _, key := range keys {
+		if key == "profile" || key == "config" || fs.Lookup(key) == nil {
+			problems = append(problems, fmt.Errorf("profile %s: %s: not a global flag", name, key))
+			continue
+		}
+		if given[key] {
+			continue
+		}
+		var value string
+		switch v := profile[key].(type) {
+		case map[string]interface{}, []interface{}:
+			problems = append(problems, fmt.Errorf("profile %s: %s: expected a single value", name, key))
+			continue
+		case nil:
+			value = ""
+		default:
+			value = fmt.Sprint(v)
+		}
+		previous := fs.Lookup(key).Value.String()
+		if err := fs.Set(key, value); err != nil {
+			problems = append(problems, fmt.Errorf("profile %s: %s: invalid value %q: %w", name, key, value, err))
+			// Some flags take the zero value on error, which would be reported again
+			fs.Set(key, previous)
+		}
+	}
+	return errors.Join(problems...)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testProfiles = `profiles:
+  staging:
+    nats-url: nats://nats.staging:4222
+    subject: reader.staging.query
+    timeout: 20s
+    output: table
+  prod:
+    nats-url: nats://nats.prod:4222
+    parallel: 4
+`
+
+// writeProfiles writes a config file of profiles and returns its path
+func writeProfiles(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), profilesFileName)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProfileSelection(t *testing.T) {
+	path := writeProfiles(t, testProfiles)
+	tests := []struct {
+		name        string
+		env         map[string]string
+		args        []string
+		wantURL     string
+		wantSubject string
+		wantTimeout time.Duration
+		wantOutput  outputFormat // "" leaves the choice to the output, a terminal or a file
+		wantPar     int
+	}{
+		{name: "no profile", args: []string{"--config", path}, wantURL: defaultNatsURL, wantSubject: natsSubjectRequest, wantTimeout: defaultRequestTimeout, wantPar: 1},
+		{name: "staging", args: []string{"--config", path, "--profile", "staging"}, wantURL: "nats://nats.staging:4222", wantSubject: "reader.staging.query", wantTimeout: 20 * time.Second, wantOutput: outputTable, wantPar: 1},
+		{name: "prod from the environment", env: map[string]string{"CLIENT_PROFILE": "prod", "CLIENT_CONFIG": path}, wantURL: "nats://nats.prod:4222", wantSubject: natsSubjectRequest, wantTimeout: defaultRequestTimeout, wantPar: 4},
+		{
+			name:    "flags over the profile",
+			args:    []string{"--config", path, "--profile", "staging", "--subject", "reader.local.query", "--output", "csv"},
+			wantURL: "nats://nats.staging:4222", wantSubject: "reader.local.query", wantTimeout: 20 * time.Second, wantOutput: outputCSV, wantPar: 1,
+		},
+		{
+			name:    "profile over the environment",
+			env:     map[string]string{"READER_SUBJECT": "reader.env.query", "REQUEST_TIMEOUT": "3s"},
+			args:    []string{"--config", path, "--profile", "staging"},
+			wantURL: "nats://nats.staging:4222", wantSubject: "reader.staging.query", wantTimeout: 20 * time.Second, wantOutput: outputTable, wantPar: 1,
+		},
+	}
+	for _, tt := range tests {
+		o, err := parseTestOptions(t, tt.env, tt.args...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if o.natsURL != tt.wantURL || o.subject != tt.wantSubject || o.timeout != tt.wantTimeout || o.output != tt.wantOutput || o.parallel != tt.wantPar {
+			t.Errorf("%s: got %s %s %s %s parallel %d, want %s %s %s %s parallel %d", tt.name,
+				o.natsURL, o.subject, o.timeout, o.output, o.parallel, tt.wantURL, tt.wantSubject, tt.wantTimeout, tt.wantOutput, tt.wantPar)
+		}
+	}
+}
+
+func TestProfileErrors(t *testing.T) {
+	bad := writeProfiles(t, "profiles: [\n")
+	path := writeProfiles(t, testProfiles+"  broken:\n    nats-urls: [a, b]\n    colour: true\n    timeout: soon\n    config: other.yaml\n")
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--config", path, "--profile", "dev"}, []string{`--profile "dev": not in ` + path + ", which has broken, prod, staging"}},
+		{[]string{"--config", path, "--profile", "broken"}, []string{
+			"profile broken: colour: not a global flag",
+			"profile broken: config: not a global flag",
+			"profile broken: nats-urls: expected a single value",
+			`profile broken: timeout: invalid value "soon"`,
+		}},
+		{[]string{"--config", writeProfiles(t, "profiles: {}\n"), "--profile", "dev"}, []string{"has no profiles"}},
+		{[]string{"--config", filepath.Join(t.TempDir(), "missing.yaml"), "--profile", "dev"}, []string{"--config: open"}},
+		{[]string{"--config", bad, "--profile", "dev"}, []string{"--config " + bad + ": yaml:"}},
+	}
+	for _, tt := range tests {
+		_, err := parseTestOptions(t, nil, tt.args...)
+		for _, want := range tt.want {
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("%v: error %v, want it to report %q", tt.args, err, want)
+			}
+		}
+	}
+}
+
+// The subject of the profile is the one queries are sent on
+func TestProfileSubjectReachesTheReader(t *testing.T) {
+	s := startFakeNATS(t)
+	requests := fakeReader(t, s, "reader.staging.query", pagedDeviceReader([]string{"dev-01"}, 10))
+	path := writeProfiles(t, "profiles:\n  staging:\n    nats-url: "+s.url()+"\n    subject: reader.staging.query\n")
+	if code := runClient(t, nil, "--config", path, "--profile", "staging", "--query", "device_list"); code != exitOK {
+		t.Fatalf("run with the staging profile exited %d", code)
+	}
+	if sent := requests(); len(sent) != 1 || sent[0].QueryType != "device_list" {
+		t.Errorf("staging reader got %v, want the device_list query", sent)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// plannedQuery is a request of the batch run with how long to wait for each response,
+// 0 for the client's timeout, and how many times to send it.
+type plannedQuery struct {
+	request      ReaderRequest
+	timeout      time.Duration
+	maxAttempts  int            // Overrides --max-attempts when not 0
+	retryBackoff *time.Duration // Overrides --retry-backoff when set
+	repeat       int
+	templated    bool // Whether the params hold {{now}} templates, see requestAt
+}
+
+// Returns the client to send the query with: c itself, or a copy with the query's own
+// retry policy
+func (c *client) forQuery(q plannedQuery) *client {
+	if q.maxAttempts == 0 && q.retryBackoff == nil {
+		return c
+	}
+	qc := *c
+	if q.maxAttempts != 0 {
+		qc.retry.maxAttempts = q.maxAttempts
+	}
+	if q.retryBackoff != nil {
+		qc.retry.backoff = *q.retryBackoff
+	}
+	return &qc
+}
+
+// Returns the request to send at now, its templates rendered
+func (q plannedQuery) requestAt(now time.Time) ReaderRequest {
+	if !q.templated {
+		return q.request
+	}
+	request := q.request
+	request.Params = renderParams(q.request.Params, now)
+	return request
+}
+
+// queryFileEntry is one entry of a queries file. The file is a YAML or JSON list of them:
+//
+//   - query_type: device_health
+//     params: {source_device: StorageArray}
+//     timeout: 5s
+//     max_attempts: 1
+//     retry_backoff: 2s
+//     repeat: 3
+//
+// Params may refer to environment variables and the time of sending, see envReference.
+type queryFileEntry struct {
+	QueryType    string                 `yaml:"query_type"`
+	Params       map[string]interface{} `yaml:"params"`
+	Timeout      string                 `yaml:"timeout"`       // Go duration, defaults to --timeout
+	MaxAttempts  *int                   `yaml:"max_attempts"`  // Defaults to --max-attempts
+	RetryBackoff string                 `yaml:"retry_backoff"` // Go duration, defaults to --retry-backoff
+	Repeat       *int                   `yaml:"repeat"`        // Defaults to 1
+}
+
+// Returns the queries the client runs when no queries file is given
+func defaultQueries() []plannedQuery {
+	requests := []ReaderRequest{
+		{
+			QueryType: "alerts_critical",
+			Params: map[string]interface{}{
+				"since_minutes":   15,
+				"min_criticality": 8,
+			},
+		},
+		{
+			QueryType: "device_health",
+			Params: map[string]interface{}{
+				"source_device": "sensor-1",
+			},
+		},
+		{
+			QueryType: "anomaly_temperature",
+			Params: map[string]interface{}{
+				"source_device":  "sensor-1",
+				"threshold":      1.3,
+				"window_minutes": 20,
+			},
+		},
+	}
+	queries := make([]plannedQuery, 0, len(requests))
+	for _, request := range requests {
+		queries = append(queries, plannedQuery{request: request, repeat: 1})
+	}
+	return queries
+}
+
+// Reads the queries file at path, see parseQueries
+func loadQueries(path string) ([]plannedQuery, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	queries, err := parseQueries(data, os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return queries, nil
+}
+
+// Parses a YAML or JSON list of query entries, expanding the environment references of
+// their params with lookup. Errors name the index and field of the offending entry, e.g.
+// "entry 2 (line 9): timeout: ...", or list every undefined variable.
+func parseQueries(data []byte, lookup func(string) (string, bool)) ([]plannedQuery, error) {
+	var nodes []yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&nodes); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("no queries in file")
+		}
+		return nil, fmt.Errorf("expected a list of queries: %w", err)
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("no queries in file")
+	}
+
+	queries := make([]plannedQuery, 0, len(nodes))
+	missing := map[string]bool{}
+	for i, node := range nodes {
+		query, err := parseQueryEntry(&node, lookup, missing)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d (line %d): %w", i, node.Line, err)
+		}
+		queries = append(queries, query)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("undefined environment variable(s): %s", strings.Join(missingNames(missing), ", "))
+	}
+	return queries, nil
+}
+
+func parseQueryEntry(node *yaml.Node, lookup func(string) (string, bool), missing map[string]bool) (plannedQuery, error) {
+	var entry queryFileEntry
+	if node.Kind != yaml.MappingNode {
+		return plannedQuery{}, errors.New("expected a mapping with query_type, params, timeout, max_attempts, retry_backoff and repeat")
+	}
+	// Decode field by field so that a type error names its field
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		var target interface{}
+		var want string
+		switch key {
+		case "query_type":
+			target, want = &entry.QueryType, "a string"
+		case "params":
+			target, want = &entry.Params, "a mapping of parameter names to values"
+		case "timeout":
+			target, want = &entry.Timeout, "a duration such as 5s"
+		case "max_attempts":
+			target, want = &entry.MaxAttempts, "an integer"
+		case "retry_backoff":
+			target, want = &entry.RetryBackoff, "a duration such as 500ms"
+		case "repeat":
+			target, want = &entry.Repeat, "an integer"
+		default:
+			return plannedQuery{}, fmt.Errorf("%s: unknown field, expected query_type, params, timeout, max_attempts, retry_backoff or repeat", key)
+		}
+		if err := value.Decode(target); err != nil {
+			return plannedQuery{}, fmt.Errorf("%s: expected %s", key, want)
+		}
+	}
+
+	if entry.QueryType == "" {
+		return plannedQuery{}, errors.New("query_type: is required")
+	}
+	query := plannedQuery{
+		request: ReaderRequest{QueryType: entry.QueryType, Params: entry.Params},
+		repeat:  1,
+	}
+	if query.request.Params == nil {
+		query.request.Params = map[string]interface{}{}
+	}
+	params, templated, err := expandParams(query.request.Params, lookup, missing)
+	if err != nil {
+		return plannedQuery{}, fmt.Errorf("params: %w", err)
+	}
+	query.request.Params, query.templated = params, templated
+	if entry.Timeout != "" {
+		timeout, err := time.ParseDuration(entry.Timeout)
+		if err != nil || timeout <= 0 {
+			return plannedQuery{}, fmt.Errorf("timeout: %q is not a positive duration such as 5s", entry.Timeout)
+		}
+		query.timeout = timeout
+	}
+	if entry.MaxAttempts != nil {
+		if *entry.MaxAttempts < 1 {
+			return plannedQuery{}, fmt.Errorf("max_attempts: %d must be at least 1", *entry.MaxAttempts)
+		}
+		query.maxAttempts = *entry.MaxAttempts
+	}
+	if entry.RetryBackoff != "" {
+		backoff, err := time.ParseDuration(entry.RetryBackoff)
+		if err != nil || backoff < 0 {
+			return plannedQuery{}, fmt.Errorf("retry_backoff: %q is not a duration such as 500ms", entry.RetryBackoff)
+		}
+		query.retryBackoff = &backoff
+	}
+	if entry.Repeat != nil {
+		if *entry.Repeat < 1 {
+			return plannedQuery{}, fmt.Errorf("repeat: %d must be at least 1", *entry.Repeat)
+		}
+		query.repeat = *entry.Repeat
+	}
+	return query, nil
+}
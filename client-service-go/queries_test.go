@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// noEnv is an environment without any variables
+func noEnv(string) (string, bool) { return "", false }
+
+func TestLoadQueriesSampleFile(t *testing.T) {
+	t.Setenv("HEALTH_DEVICE", "DiskUnit-0007")
+	queries, err := loadQueries("queries.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 3 {
+		t.Fatalf("loaded %d queries, want 3", len(queries))
+	}
+	want := []ReaderRequest{
+		{QueryType: "alerts_critical", Params: map[string]interface{}{"since_minutes": 15, "min_criticality": 8}},
+		{QueryType: "device_health", Params: map[string]interface{}{"source_device": "DiskUnit-0007"}},
+		{QueryType: "anomaly_temperature", Params: map[string]interface{}{"source_device": "DiskUnit", "threshold": 1.3, "window_minutes": 20}},
+	}
+	for i, q := range queries {
+		if !reflect.DeepEqual(q.request, want[i]) {
+			t.Errorf("query %d: %+v, want %+v", i, q.request, want[i])
+		}
+	}
+	if health := queries[1]; health.timeout != 5*time.Second || health.maxAttempts != 1 || health.repeat != 3 {
+		t.Errorf("device_health runs with timeout %s, %d attempt(s), %d time(s), want 5s, 1 and 3", health.timeout, health.maxAttempts, health.repeat)
+	}
+	if alerts := queries[0]; alerts.timeout != 0 || alerts.maxAttempts != 0 || alerts.retryBackoff != nil || alerts.repeat != 1 {
+		t.Errorf("alerts_critical %+v, want the client's defaults", alerts)
+	}
+}
+
+func TestParseQueriesJSON(t *testing.T) {
+	queries, err := parseQueries([]byte(`[{"query_type": "device_health", "params": {"source_device": "StorageArray"}, "retry_backoff": "250ms", "repeat": 2}, {"query_type": "device_list"}]`), noEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 || queries[0].request.Params["source_device"] != "StorageArray" || queries[0].repeat != 2 {
+		t.Fatalf("parsed %+v", queries)
+	}
+	if queries[0].retryBackoff == nil || *queries[0].retryBackoff != 250*time.Millisecond {
+		t.Errorf("retry backoff %v, want 250ms", queries[0].retryBackoff)
+	}
+	if queries[1].request.Params == nil {
+		t.Error("query without params sends null params")
+	}
+}
+
+func TestParseQueriesRejects(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"", "no queries in file"},
+		{"[]", "no queries in file"},
+		{"query_type: device_health", "expected a list of queries"},
+		{"- device_health", "entry 0 (line 1): expected a mapping"},
+		{"- query_type: device_list\n- params: {}", "entry 1 (line 2): query_type: is required"},
+		{"- query_type: device_list\n  timeout: soon", `entry 0 (line 1): timeout: "soon" is not a positive duration`},
+		{"- query_type: device_list\n  timeout: [5s]", "timeout: expected a duration such as 5s"},
+		{"- query_type: device_list\n  max_attempts: 0", "max_attempts: 0 must be at least 1"},
+		{"- query_type: device_list\n  retry_backoff: -1s", `retry_backoff: "-1s" is not a duration`},
+		{"- query_type: device_list\n  repeat: many", "repeat: expected an integer"},
+		{"- query_type: device_list\n  params: [a, b]", "params: expected a mapping"},
+		{"- query_type: device_list\n  reapeat: 2", "reapeat: unknown field"},
+	}
+	for _, tt := range tests {
+		if _, err := parseQueries([]byte(tt.file), noEnv); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseQueries(%q) = %v, want an error containing %q", tt.file, err, tt.want)
+		}
+	}
+}
+
+func TestLoadQueriesNamesTheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.yaml")
+	if err := os.WriteFile(path, []byte("- repeat: 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadQueries(path); err == nil || !strings.HasPrefix(err.Error(), path+": entry 0") {
+		t.Errorf("loadQueries = %v, want an error naming the file and entry", err)
+	}
+	if _, err := loadQueries(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("loaded a missing file")
+	}
+}
+
+func TestDefaultQueries(t *testing.T) {
+	var types []string
+	for _, q := range defaultQueries() {
+		types = append(types, q.request.QueryType)
+		if q.repeat != 1 || q.timeout != 0 {
+			t.Errorf("%s runs %d time(s) with timeout %s, want once with the client's timeout", q.request.QueryType, q.repeat, q.timeout)
+		}
+	}
+	if strings.Join(types, " ") != "alerts_critical device_health anomaly_temperature" {
+		t.Errorf("default queries %v", types)
+	}
+}
+
+// Against a reader taking 300ms, the query with a 100ms override times out after its own
+// attempts while the other succeeds under the client's timeout, each result naming the
+// timeout that applied
+func TestQueryTimeoutOverrides(t *testing.T) {
+	s := startFakeNATS(t)
+	slowReader(t, s, 300*time.Millisecond)
+	c := newTestClient(t, s)
+	c.output = outputJSONL
+	queries, err := parseQueries([]byte("- query_type: device_health\n  params: {source_device: fast}\n  timeout: 100ms\n  max_attempts: 2\n  retry_backoff: 10ms\n"+
+		"- query_type: device_health\n  params: {source_device: forecast}\n"), noEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failure, err := c.sendQueries(queries, 2); failure != failureTimeout || err != nil {
+		t.Fatalf("sendQueries = %q, %v, want the timeout of the first query", failure, err)
+	}
+
+	records := jsonlResults(t, c)
+	if len(records) != 2 {
+		t.Fatalf("wrote %d result(s), want 2", len(records))
+	}
+	if r := records[0]; r.Status != statusFailed || r.TimeoutMs != 100 || r.Error == nil || r.Error.Code != failureTimeout || r.Error.Attempts != 2 {
+		t.Errorf("overridden query: %+v (error %+v), want a timeout after 2 attempts of 100ms", r, r.Error)
+	}
+	if r := records[1]; r.Status != "success" || r.TimeoutMs != float64(c.timeout.Milliseconds()) {
+		t.Errorf("default query: %+v, want a success under the client's timeout %s", r, c.timeout)
+	}
+}
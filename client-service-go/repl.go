@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const prompt = "> "
+
+// Reads commands from in until exit or end of input, sending each as a query and printing
+// the formatted response to out
+func (c *client) runInteractive(in io.Reader, out io.Writer) {
+	fmt.Fprintln(out, "Interactive mode, type 'help' for the available queries and 'exit' or Ctrl-D to quit.")
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case "":
+			continue
+		case "exit", "quit":
+			return
+		case "help":
+			printHelp(out)
+			continue
+		}
+
+		request, err := parseCommand(line)
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+			fmt.Fprintln(out, "Type 'help' for the available queries.")
+			continue
+		}
+		ex, err := c.query(request, 0)
+		if err != nil {
+			fmt.Fprintln(out, c.formatError(ex, err))
+			continue
+		}
+		fmt.Fprintln(out, c.formatResponse(ex))
+	}
+}
+
+func printHelp(out io.Writer) {
+	fmt.Fprintln(out, "Queries (<required> [optional]):")
+	for _, cmd := range queryCommands {
+		fmt.Fprintf(out, "  %-52s %s\n", cmd.usage(), cmd.description)
+		for _, p := range cmd.params {
+			fmt.Fprintf(out, "      %-20s %s\n", p.name, p.kind)
+		}
+	}
+	fmt.Fprintln(out, "Other commands:")
+	fmt.Fprintf(out, "  %-52s %s\n", "help", "show this list")
+	fmt.Fprintf(out, "  %-52s %s\n", "exit, quit, Ctrl-D", "leave interactive mode")
+}
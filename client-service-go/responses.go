@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Response data of the known query types, as sent by the reader. Field order is column
+// order in tables and CSV.
+
+// alertRow is an event of an alerts_critical response, whose data is a list of them,
+// newest first. The contract with the reader:
+//
+//	request:  {"query_type": "alerts_critical",
+//	           "params": {"since_minutes": 15, "min_criticality": 8}}
+//	response: {"status": "success",
+//	           "data": [{"event_id": "<uuid>", "timestamp": "2024-05-01T12:00:00Z",
+//	                     "source_device": "StorageArray", "event_type": "DriveFailure",
+//	                     "criticality": 9, "event_message": "..."}, ...],
+//	           "summary": [{"source_device": "StorageArray", "critical_event_count": 1}, ...]}
+//
+// Both params are optional, defaulting to 15 and 8; since_minutes must be positive and
+// min_criticality between 1 and 10.
+type alertRow struct {
+	Timestamp    string `json:"timestamp"`
+	EventID      string `json:"event_id"`
+	SourceDevice string `json:"source_device"`
+	EventType    string `json:"event_type"`
+	Criticality  int    `json:"criticality"`
+	EventMessage string `json:"event_message"`
+}
+
+// deviceHealth is the data of a device_health response. The contract with the reader:
+//
+//	request:  {"query_type": "device_health", "params": {"source_device": "DiskUnit"}}
+//	response: {"status": "success",
+//	           "data": {"device": "DiskUnit", "health": "warn", "events_last_hour": 3,
+//	                    "metrics": [{"metric_type": "DiskTemp", "value": 52.4,
+//	                                 "timestamp": "2024-05-01T12:00:00Z", "health": "warn"}, ...]}}
+//
+// Metrics holds the latest reading of each metric type, rated by the reader's thresholds;
+// health is the worst rating, or unknown for a device without recent readings.
+type deviceHealth struct {
+	Device         string          `json:"device"`
+	Health         string          `json:"health"` // ok, warn, critical or unknown
+	EventsLastHour int             `json:"events_last_hour"`
+	Metrics        []metricReading `json:"metrics"`
+}
+
+// metricReading is the latest reading of a metric in a device_health response.
+type metricReading struct {
+	MetricType string  `json:"metric_type"`
+	Value      float64 `json:"value"`
+	Timestamp  string  `json:"timestamp"`
+	Health     string  `json:"health"`
+}
+
+// Returns a row per metric reading under the device's health, or a single row without
+// readings
+func (h deviceHealth) table() (columns []string, rows [][]string) {
+	columns = []string{"device", "health", "events_last_hour", "metric_type", "value", "timestamp", "metric_health"}
+	base := []string{h.Device, h.Health, strconv.Itoa(h.EventsLastHour)}
+	if len(h.Metrics) == 0 {
+		return columns, [][]string{append(base, "", "", "", "")}
+	}
+	for _, m := range h.Metrics {
+		row := append(slices.Clone(base), m.MetricType, strconv.FormatFloat(m.Value, 'f', -1, 64), m.Timestamp, m.Health)
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
+
+// temperatureAnomaly is the data of an anomaly_temperature response. The contract with the
+// reader:
+//
+//	request:  {"query_type": "anomaly_temperature",
+//	           "params": {"source_device": "DiskUnit", "threshold": 1.3, "window_minutes": 20}}
+//	response: {"status": "success",
+//	           "data": {"device": "DiskUnit", "samples": 40, "mean": 41.2, "stddev": 2.3,
+//	                    "threshold": 1.3, "anomaly": true,
+//	                    "anomalies": [{"timestamp": "2024-05-01T12:00:00Z", "value": 48.9, "z_score": 3.35}, ...]}}
+//
+// Anomalies are the readings whose z-score, their deviation from the mean in standard
+// deviations, exceeds the threshold either way. A device with too few readings in the
+// window gets a message such as "insufficient data: ..." instead.
+type temperatureAnomaly struct {
+	Device    string          `json:"device"`
+	Samples   int             `json:"samples"`
+	Mean      float64         `json:"mean"`
+	StdDev    float64         `json:"stddev"`
+	Threshold float64         `json:"threshold"`
+	Anomaly   bool            `json:"anomaly"`
+	Anomalies []anomalousTemp `json:"anomalies"`
+}
+
+// anomalousTemp is an anomalous reading in an anomaly_temperature response.
+type anomalousTemp struct {
+	Timestamp string  `json:"timestamp"`
+	Value     float64 `json:"value"`
+	ZScore    float64 `json:"z_score"`
+}
+
+// Returns a row per anomalous reading under the baseline, or a single row without any
+func (a temperatureAnomaly) table() (columns []string, rows [][]string) {
+	columns = []string{"device", "samples", "mean", "stddev", "anomaly", "timestamp", "value", "z_score"}
+	base := []string{a.Device, strconv.Itoa(a.Samples), strconv.FormatFloat(a.Mean, 'f', 2, 64), strconv.FormatFloat(a.StdDev, 'f', 2, 64), strconv.FormatBool(a.Anomaly)}
+	if len(a.Anomalies) == 0 {
+		return columns, [][]string{append(base, "", "", "")}
+	}
+	for _, r := range a.Anomalies {
+		rows = append(rows, append(slices.Clone(base), r.Timestamp, strconv.FormatFloat(r.Value, 'f', -1, 64), strconv.FormatFloat(r.ZScore, 'f', -1, 64)))
+	}
+	return columns, rows
+}
+
+// metricSummary is the data of a metric_summary response, summing up one metric of a
+// device over a window. The contract with the reader:
+//
+//	request:  {"query_type": "metric_summary",
+//	           "params": {"source_device": "DiskUnit", "metric_type": "DiskTemp", "window_minutes": 60}}
+//	response: {"status": "success",
+//	           "data": {"device": "DiskUnit", "metric": "DiskTemp", "count": 120,
+//	                    "min": 31.2, "max": 48.9, "mean": 39.4, "last": 41.0}}
+//
+// Last is the most recent value in the window. Without samples in the window the data is a
+// message such as "no data" instead.
+type metricSummary struct {
+	Device string  `json:"device"`
+	Metric string  `json:"metric"`
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	Last   float64 `json:"last"`
+}
+
+// eventCount is a row of an events_by_type response: how many events of a type a device
+// published in the window. The contract with the reader:
+//
+//	request:  {"query_type": "events_by_type",
+//	           "params": {"since_minutes": 1440, "source_device": "DiskUnit"}}
+//	response: {"status": "success",
+//	           "data": [{"source_device": "DiskUnit", "event_type": "DriveFailure", "count": 3}, ...]}
+//
+// source_device is optional and restricts the counts to that device. The reader also takes
+// the window as a duration in since (e.g. "24h") instead of since_minutes. Device and type
+// pairs without events may be left out.
+type eventCount struct {
+	SourceDevice string `json:"source_device"`
+	EventType    string `json:"event_type"`
+	Count        int    `json:"count"`
+}
+
+// eventCounts is the data of an events_by_type response, rendered as a pivot table.
+type eventCounts []eventCount
+
+// Returns the counts pivoted, a row per device and a column per event type, both sorted.
+// Pairs without a count get 0.
+func (e eventCounts) table() (columns []string, rows [][]string) {
+	counts := map[string]map[string]int{}
+	typeSeen := map[string]bool{}
+	var devices, types []string
+	for _, c := range e {
+		if counts[c.SourceDevice] == nil {
+			counts[c.SourceDevice] = map[string]int{}
+			devices = append(devices, c.SourceDevice)
+		}
+		counts[c.SourceDevice][c.EventType] += c.Count
+		if !typeSeen[c.EventType] {
+			typeSeen[c.EventType] = true
+			types = append(types, c.EventType)
+		}
+	}
+	sort.Strings(devices)
+	sort.Strings(types)
+
+	columns = append([]string{"source_device"}, types...)
+	for _, device := range devices {
+		row := []string{device}
+		for _, eventType := range types {
+			row = append(row, strconv.Itoa(counts[device][eventType]))
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
+
+// topDevice is a row of a top_devices response, the devices ranked by a metric, the backing
+// query of "hottest disks" panels. The contract with the reader:
+//
+//	request:  {"query_type": "top_devices",
+//	           "params": {"metric_type": "DiskTemp", "window": "1h", "aggregation": "max", "limit": 10}}
+//	response: {"status": "success",
+//	           "data": [{"rank": 1, "source_device": "DiskUnit", "score": 58.2}, ...]}
+//
+// aggregation is max, mean or last; only metric_type is required. Devices are ranked by
+// score, highest first, ties by name; limit is capped at 100.
+type topDevice struct {
+	Rank         int     `json:"rank"`
+	SourceDevice string  `json:"source_device"`
+	Score        float64 `json:"score"`
+}
+
+// seriesPoint is a point of a metric_timeseries response, the mean of a metric in a window,
+// for graphs. The contract with the reader:
+//
+//	request:  {"query_type": "metric_timeseries",
+//	           "params": {"source_device": "DiskUnit", "metric_type": "DiskTemp",
+//	                      "start": "-6h", "stop": "now", "every": "5m", "fill": "omit"}}
+//	response: {"status": "success",
+//	           "data": [{"time": "2024-05-01T12:05:00Z", "value": 41.3}, ...]}
+//
+// start and stop are RFC 3339 timestamps, now or relative like -1h or -7d; windows without
+// readings are left out with fill omit and have a null value with fill null. Ranges of more
+// than 10000 points are refused with a coarser every to use.
+type seriesPoint struct {
+	Time  string   `json:"time"`
+	Value *float64 `json:"value"` // nil for an empty window
+}
+
+// responseSchema is the shape of the data of a query type's successful responses.
+type responseSchema struct {
+	data    interface{} // Zero value of the data's Go type
+	message bool        // Whether a plain string may stand in for the data
+}
+
+var responseSchemas = map[string]responseSchema{
+	"alerts_critical":     {data: []alertRow{}},
+	"device_health":       {data: deviceHealth{}},
+	"anomaly_temperature": {data: temperatureAnomaly{}, message: true},
+	"metric_summary":      {data: metricSummary{}, message: true},
+	"events_by_type":      {data: eventCounts{}},
+	"device_list":         {data: deviceList{}},
+	"top_devices":         {data: []topDevice{}},
+	"metric_timeseries":   {data: []seriesPoint{}},
+	ackQueryType:          {data: ackRecord{}},
+}
+
+// Checks the data of a successful response against the schema of its query type and
+// decodes it into the schema's Go type. Returns nil and no error for a message standing in
+// for the data, and known false for query types without a schema. Errors give the path of
+// the offending field, e.g. "data[3].criticality: expected an integer, got string".
+func decodeResponseData(queryType string, data interface{}) (typed interface{}, known bool, err error) {
+	schema, known := responseSchemas[queryType]
+	if !known {
+		return nil, false, nil
+	}
+	if _, isMessage := data.(string); isMessage && schema.message {
+		return nil, true, nil
+	}
+	t := reflect.TypeOf(schema.data)
+	if err := validateValue("data", data, t); err != nil {
+		return nil, true, err
+	}
+	// The generic value is known to fit, so this round trip cannot fail on its shape
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, true, err
+	}
+	target := reflect.New(t)
+	if err := json.Unmarshal(b, target.Interface()); err != nil {
+		return nil, true, err
+	}
+	return target.Elem().Interface(), true, nil
+}
+
+// Checks a value decoded from JSON against a Go type: structs take objects with exactly
+// their fields, slices take lists, pointers null or their element and numbers must fit their
+// kind.
+func validateValue(path string, v interface{}, t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %s", path, jsonKind(v))
+		}
+		fields := map[string]reflect.StructField{}
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			fields[name] = t.Field(i)
+			if _, present := obj[name]; !present {
+				return fmt.Errorf("%s.%s: missing", path, name)
+			}
+		}
+		for key, value := range obj {
+			field, ok := fields[key]
+			if !ok {
+				return fmt.Errorf("%s.%s: unknown field", path, key)
+			}
+			if err := validateValue(path+"."+key, value, field.Type); err != nil {
+				return err
+			}
+		}
+	case reflect.Pointer:
+		// Pointers are fields that may be null
+		if v != nil {
+			return validateValue(path, v, t.Elem())
+		}
+	case reflect.Slice:
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected a list, got %s", path, jsonKind(v))
+		}
+		for i, item := range items {
+			if err := validateValue(fmt.Sprintf("%s[%d]", path, i), item, t.Elem()); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%s: expected a string, got %s", path, jsonKind(v))
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean, got %s", path, jsonKind(v))
+		}
+	case reflect.Int:
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) {
+			return fmt.Errorf("%s: expected an integer, got %s", path, jsonKind(v))
+		}
+	case reflect.Float64:
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: expected a number, got %s", path, jsonKind(v))
+		}
+	}
+	return nil
+}
+
+// Names the JSON kind of a decoded value for error messages
+func jsonKind(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "list"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if n == math.Trunc(n) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// tableData is typed data with a layout of its own, such as a pivot table.
+type tableData interface {
+	table() (columns []string, rows [][]string)
+}
+
+// Turns typed data, a struct or a list of structs, into rows under the JSON names of the
+// struct's fields, in declaration order, unless the data lays out its own table.
+func typedTable(typed interface{}) (columns []string, rows [][]string) {
+	if t, ok := typed.(tableData); ok {
+		return t.table()
+	}
+	v := reflect.ValueOf(typed)
+	if v.Kind() != reflect.Slice {
+		v = reflect.Append(reflect.MakeSlice(reflect.SliceOf(v.Type()), 0, 1), v)
+	}
+	t := v.Type().Elem()
+	for i := 0; i < t.NumField(); i++ {
+		columns = append(columns, strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+	}
+	for i := 0; i < v.Len(); i++ {
+		row := make([]string, t.NumField())
+		for j := range row {
+			row[j] = formatCell(v.Index(i).Field(j))
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
+
+func formatCell(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return ""
+		}
+		return formatCell(v.Elem())
+	case reflect.String:
+		return v.String()
+	case reflect.Int:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeResponseDataFixtures(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	want := map[string]interface{}{
+		"alerts_critical": []alertRow{
+			{Timestamp: "2025-01-01T10:07:00Z", EventID: "6f1c2a9e-0d4b-4c1e-9a55-0b8e4f3e7a01", SourceDevice: "CloudStorage-0001", EventType: "UnauthorizedAccess", Criticality: 10, EventMessage: `login from 10.0.0.7, "svc-backup"`},
+			{Timestamp: "2025-01-01T10:05:30Z", EventID: "0b7d4e11-8f2a-4d6b-b3c0-2a9f1e6c5d02", SourceDevice: "DiskUnit-0002", EventType: "DataCorruption", Criticality: 8, EventMessage: "checksum mismatch"},
+			{Timestamp: "2025-01-01T10:00:00Z", EventID: "c3a8f5d2-4b6e-4f1a-8e7d-9c0b1a2d3e03", SourceDevice: "StorageArray-0001", EventType: "DriveFailure", Criticality: 9, EventMessage: "slot 4"},
+		},
+		"device_health": deviceHealth{Device: "DiskUnit-0002", Health: "warn", EventsLastHour: 3, Metrics: []metricReading{
+			{MetricType: "DiskTemp", Value: 52.4, Timestamp: "2025-01-01T10:00:00Z", Health: "warn"},
+			{MetricType: "IOPs", Value: 1200, Timestamp: "2025-01-01T10:00:00Z", Health: "ok"},
+		}},
+		"anomaly_temperature": temperatureAnomaly{Device: "DiskUnit-0002", Samples: 40, Mean: 41.2, StdDev: 2.3, Threshold: 1.3, Anomaly: true, Anomalies: []anomalousTemp{
+			{Timestamp: "2025-01-01T09:58:00Z", Value: 48.9, ZScore: 3.35},
+			{Timestamp: "2025-01-01T09:59:00Z", Value: 36.1, ZScore: -2.22},
+		}},
+		"metric_summary": metricSummary{Device: "DiskUnit-0002", Metric: "DiskTemp", Count: 120, Min: 31.2, Max: 48.9, Mean: 39.4, Last: 41},
+		"events_by_type": eventCounts{
+			{SourceDevice: "StorageArray-0001", EventType: "DriveFailure", Count: 3},
+			{SourceDevice: "DiskUnit-0002", EventType: "DataCorruption", Count: 1},
+			{SourceDevice: "StorageArray-0001", EventType: "UnauthorizedAccess", Count: 2},
+		},
+		"device_list": deviceList{"CloudStorage-0001", "DiskUnit-0002", "StorageArray-0001"},
+		"top_devices": []topDevice{{Rank: 1, SourceDevice: "DiskUnit-0002", Score: 58.2}, {Rank: 2, SourceDevice: "DiskUnit-0001", Score: 51}},
+		"metric_timeseries": []seriesPoint{
+			{Time: "2025-01-01T10:00:00Z", Value: f(41.3)},
+			{Time: "2025-01-01T10:05:00Z"},
+			{Time: "2025-01-01T10:10:00Z", Value: f(42)},
+		},
+		ackQueryType: ackRecord{EventID: "6f1c2a9e-0d4b-4c1e-9a55-0b8e4f3e7a01", AcknowledgedBy: "alice", Note: "replaced the drive", Timestamp: "2025-01-01T10:30:00Z"},
+	}
+	for _, queryType := range knownQueryTypes() {
+		typed, known, err := decodeResponseData(queryType, responseFixture(t, queryType).response.Data)
+		if err != nil || !known {
+			t.Errorf("%s: known %t, error %v", queryType, known, err)
+			continue
+		}
+		if !reflect.DeepEqual(typed, want[queryType]) {
+			t.Errorf("%s decoded to %#v, want %#v", queryType, typed, want[queryType])
+		}
+	}
+}
+
+func TestDecodeResponseDataErrors(t *testing.T) {
+	alert := func(change func(map[string]interface{})) []interface{} {
+		row := map[string]interface{}{"timestamp": "2025-01-01T10:00:00Z", "event_id": "e-1", "source_device": "DiskUnit-0001", "event_type": "DriveFailure", "criticality": 9.0, "event_message": ""}
+		bad := map[string]interface{}{}
+		for key, value := range row {
+			bad[key] = value
+		}
+		change(bad)
+		return []interface{}{row, bad}
+	}
+	tests := []struct {
+		queryType string
+		data      interface{}
+		want      string
+	}{
+		{"alerts_critical", alert(func(r map[string]interface{}) { r["criticality"] = "9" }), "data[1].criticality: expected an integer, got string"},
+		{"alerts_critical", alert(func(r map[string]interface{}) { r["criticality"] = 8.5 }), "data[1].criticality: expected an integer, got number"},
+		{"alerts_critical", alert(func(r map[string]interface{}) { delete(r, "event_id") }), "data[1].event_id: missing"},
+		{"alerts_critical", alert(func(r map[string]interface{}) { r["severity"] = "high" }), "data[1].severity: unknown field"},
+		{"alerts_critical", alert(func(r map[string]interface{}) { r["timestamp"] = nil }), "data[1].timestamp: expected a string, got null"},
+		{"alerts_critical", map[string]interface{}{}, "data: expected a list, got object"},
+		{"alerts_critical", "no alerts", "data: expected a list, got string"},
+		{"device_health", map[string]interface{}{"device": "d", "health": "ok", "events_last_hour": 0.0, "metrics": []interface{}{
+			map[string]interface{}{"metric_type": "DiskTemp", "value": "hot", "timestamp": "", "health": "ok"},
+		}}, "data.metrics[0].value: expected a number, got string"},
+		{"anomaly_temperature", map[string]interface{}{"device": "d", "samples": 1.0, "mean": 0.0, "stddev": 0.0, "threshold": 1.0, "anomaly": "yes", "anomalies": []interface{}{}}, "data.anomaly: expected a boolean, got string"},
+		{"device_list", []interface{}{"a", 2.0}, "data[1]: expected a string, got integer"},
+		{"metric_timeseries", []interface{}{map[string]interface{}{"time": "t", "value": true}}, "data[0].value: expected a number, got boolean"},
+	}
+	for _, tt := range tests {
+		typed, known, err := decodeResponseData(tt.queryType, tt.data)
+		if err == nil || err.Error() != tt.want || !known || typed != nil {
+			t.Errorf("%s: decoded %v (known %t) with error %v, want %q", tt.queryType, typed, known, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeResponseDataMessagesAndUnknownTypes(t *testing.T) {
+	for _, queryType := range []string{"anomaly_temperature", "metric_summary"} {
+		if typed, known, err := decodeResponseData(queryType, "insufficient data: 2 readings"); typed != nil || !known || err != nil {
+			t.Errorf("%s with a message: %v, %t, %v, want the message accepted as is", queryType, typed, known, err)
+		}
+	}
+	typed, known, err := decodeResponseData("disk_forecast", map[string]interface{}{"anything": []interface{}{1.0}})
+	if typed != nil || known || err != nil {
+		t.Errorf("unknown query type: %v, %t, %v, want it left to generic handling", typed, known, err)
+	}
+}
+
+// A query whose response breaks its schema fails as a decode error naming the field, and
+// one of an unknown type is rendered as is
+func TestQueryValidatesTheResponse(t *testing.T) {
+	s := startFakeNATS(t)
+	fakeReader(t, s, natsSubjectRequest, func(r ReaderRequest) ReaderResponse {
+		if r.QueryType == "device_list" {
+			return ReaderResponse{Status: "success", Data: []interface{}{"dev-01", 7}}
+		}
+		return ReaderResponse{Status: "success", Data: map[string]interface{}{"forecast": "full in 12 days"}}
+	})
+	c := newTestClient(t, s)
+
+	_, err := c.query(ReaderRequest{QueryType: "device_list"}, 0)
+	if classifyFailure(err) != failureDecodeError || !strings.Contains(err.Error(), "data[1]: expected a string, got integer") {
+		t.Errorf("query with a mismatched response = %v, want a decode error naming data[1]", err)
+	}
+	ex, err := c.query(ReaderRequest{QueryType: "disk_forecast"}, 0)
+	if err != nil || ex.typed != nil {
+		t.Errorf("query of an unknown type = %v with typed data %v, want the generic data", err, ex.typed)
+	}
+	if got := c.formatResponse(ex); !strings.Contains(got, "full in 12 days") {
+		t.Errorf("unknown type rendered as %q, want its data", got)
+	}
+}
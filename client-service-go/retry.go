@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	defaultMaxAttempts  = 3
+	defaultRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff     = 10 * time.Second
+)
+
+// retryPolicy controls how often a request is sent again when the reader does not answer.
+type retryPolicy struct {
+	maxAttempts int           // Attempts per request including the first one
+	backoff     time.Duration // Delay before the first retry, doubled for every further one
+}
+
+// noReaderPolicy says what a batch run does once a query finds no reader subscribed to the
+// subject. Watch mode waits for a reader to appear instead, whatever the policy.
+type noReaderPolicy string
+
+const (
+	noReaderAbort    noReaderPolicy = "abort"    // Skip the remaining queries, which would fail alike
+	noReaderContinue noReaderPolicy = "continue" // Run them anyway, each failing at once
+)
+
+// Returns the delay after the given failed attempt, capped at maxRetryBackoff
+func (p retryPolicy) delay(attempt int) time.Duration {
+	d := p.backoff
+	for i := 1; i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryBackoff)
+}
+
+// Reports whether a failed request may succeed when sent again: nobody answered in time.
+// An error status from the reader is its final answer, and a missing reader is reported at
+// once rather than waited for, see noReaderPolicy.
+func isRetryable(err error) bool {
+	return errors.Is(err, nats.ErrTimeout)
+}
+
+// Sends the request until the reader answers or the attempts are used up, waiting longer
+// between each retry, and returns the number of attempts made. Every retry is logged to
+// stderr. Cancelling the client's context abandons the request, with an error wrapping
+// context.Canceled.
+func (c *client) requestWithRetry(request ReaderRequest, data []byte, timeout time.Duration) (*nats.Msg, int, error) {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(c.ctx, timeout)
+		msg, err := c.nc.RequestWithContext(ctx, c.subject, data)
+		cancel()
+		if err == nil {
+			return msg, attempt, nil
+		}
+		if c.ctx.Err() != nil {
+			return nil, attempt, fmt.Errorf("Query %s aborted: %w", request.QueryType, c.ctx.Err())
+		}
+		// The request's own deadline is the reader's timeout
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = nats.ErrTimeout
+		}
+		if errors.Is(err, nats.ErrNoResponders) {
+			return nil, attempt, fmt.Errorf("No reader available on subject '%s' for %s: %w", c.subject, request.QueryType, err)
+		}
+		if !isRetryable(err) {
+			return nil, attempt, fmt.Errorf("Request failed: %w", err)
+		}
+		if attempt >= c.retry.maxAttempts {
+			return nil, attempt, fmt.Errorf("Query %s timed out after %d attempt(s), no response from the reader within %s each (raise --timeout if the reader is slow): %w", request.QueryType, attempt, timeout, err)
+		}
+		delay := c.retry.delay(attempt)
+		logger.infof("Query %s attempt %d of %d failed: %v; retrying in %s", request.QueryType, attempt, c.retry.maxAttempts, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-c.ctx.Done():
+			return nil, attempt, fmt.Errorf("Query %s aborted: %w", request.QueryType, c.ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// silentReader subscribes to the reader's subject without ever answering and returns the
+// number of requests received so far
+func silentReader(t *testing.T, s *fakeNATS) func() int64 {
+	t.Helper()
+	nc := connectFake(t, s)
+	var received atomic.Int64
+	if _, err := nc.Subscribe(natsSubjectRequest, func(*nats.Msg) { received.Add(1) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return received.Load
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := retryPolicy{maxAttempts: 10, backoff: time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 8 * time.Second, 5: maxRetryBackoff, 9: maxRetryBackoff} {
+		if got := p.delay(attempt); got != want {
+			t.Errorf("delay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+	if got := (retryPolicy{backoff: time.Minute}).delay(1); got != maxRetryBackoff {
+		t.Errorf("delay of a backoff above the cap = %s, want %s", got, maxRetryBackoff)
+	}
+}
+
+func TestRequestRetriesTimeouts(t *testing.T) {
+	const timeout, backoff = 50 * time.Millisecond, 20 * time.Millisecond
+	s := startFakeNATS(t)
+	received := silentReader(t, s)
+	c := newTestClient(t, s)
+	c.retry = retryPolicy{maxAttempts: 3, backoff: backoff}
+
+	start := time.Now()
+	_, attempts, err := c.requestWithRetry(ReaderRequest{QueryType: "device_list"}, []byte(`{}`), timeout)
+	elapsed := time.Since(start)
+	if !errors.Is(err, nats.ErrTimeout) || !strings.Contains(err.Error(), "timed out after 3 attempt(s)") {
+		t.Fatalf("requestWithRetry = %v, want a timeout after 3 attempts", err)
+	}
+	if attempts != 3 || received() != 3 {
+		t.Errorf("%d attempt(s), reader received %d request(s), want 3", attempts, received())
+	}
+	// Three waits for the reader and the two backoffs in between, doubling
+	if least := 3*timeout + backoff + 2*backoff; elapsed < least || elapsed > least+time.Second {
+		t.Errorf("gave up after %s, want about %s", elapsed, least)
+	}
+}
+
+func TestRequestRetrySucceeds(t *testing.T) {
+	s := startFakeNATS(t)
+	nc := connectFake(t, s)
+	var received atomic.Int64
+	_, err := nc.Subscribe(natsSubjectRequest, func(m *nats.Msg) {
+		if received.Add(1) > 1 { // The first request gets lost
+			_ = m.Respond([]byte(`{"status":"success"}`))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Flush()
+	c := newTestClient(t, s)
+	c.retry = retryPolicy{maxAttempts: 3, backoff: time.Millisecond}
+
+	msg, attempts, err := c.requestWithRetry(ReaderRequest{QueryType: "device_list"}, []byte(`{}`), 50*time.Millisecond)
+	if err != nil || attempts != 2 || string(msg.Data) != `{"status":"success"}` {
+		t.Errorf("requestWithRetry = %v after %d attempt(s), want the second attempt's response", err, attempts)
+	}
+}
+
+func TestRequestWithoutResponderIsNotRetried(t *testing.T) {
+	s := startFakeNATS(t)
+	c := newTestClient(t, s)
+	c.retry = retryPolicy{maxAttempts: 5, backoff: time.Second}
+
+	start := time.Now()
+	_, attempts, err := c.requestWithRetry(ReaderRequest{QueryType: "device_list"}, []byte(`{}`), time.Second)
+	if !errors.Is(err, nats.ErrNoResponders) || attempts != 1 {
+		t.Errorf("requestWithRetry = %v after %d attempt(s), want no responders at the first", err, attempts)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("took %s to report the missing reader", elapsed)
+	}
+}
+
+func TestRequestRetryAbortedDuringBackoff(t *testing.T) {
+	s := startFakeNATS(t)
+	silentReader(t, s)
+	c := newTestClient(t, s)
+	ctx, cancel := context.WithCancel(t.Context())
+	c.ctx = ctx
+	c.retry = retryPolicy{maxAttempts: 3, backoff: time.Hour}
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	_, attempts, err := c.requestWithRetry(ReaderRequest{QueryType: "device_list"}, []byte(`{}`), 20*time.Millisecond)
+	if !errors.Is(err, context.Canceled) || attempts != 1 {
+		t.Errorf("requestWithRetry = %v after %d attempt(s), want it aborted while waiting to retry", err, attempts)
+	}
+}
+
+// Without a reader subscribed, a batch fails at its first query instead of waiting out the
+// timeout of each, and aborts the rest unless told to run them anyway
+func TestBatchWithoutReaderFailsFast(t *testing.T) {
+	const n = 20
+	for _, policy := range []noReaderPolicy{noReaderAbort, noReaderContinue} {
+		s := startFakeNATS(t)
+		c := newTestClient(t, s)
+		c.output = outputJSONL
+		c.timeout = 10 * time.Second
+		c.retry = retryPolicy{maxAttempts: 3, backoff: time.Second}
+		c.noReader = policy
+		log := captureLog(t)
+
+		start := time.Now()
+		failure, err := c.sendQueries(deviceQueries(n), 4) // Sequential runs pause between queries
+		if failure != failureNoResponders || err != nil {
+			t.Fatalf("%s: sendQueries = %q, %v, want %q", policy, failure, err, failureNoResponders)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: %d queries took %s to fail, want far less than their %s timeout", policy, n, elapsed, c.timeout)
+		}
+		if err := c.out.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		records := jsonlResults(t, c)
+		want := 1
+		if policy == noReaderContinue {
+			want = n
+		}
+		if len(records) != want {
+			t.Errorf("%s: wrote %d result(s), want %d", policy, len(records), want)
+		}
+		for _, record := range records {
+			if record.Error == nil || record.Error.Code != failureNoResponders || record.Error.Attempts != 1 ||
+				!strings.HasPrefix(record.Error.Message, "No reader available on subject 'reader.query' for device_health") {
+				t.Errorf("%s: result %+v, want no reader at the first attempt", policy, record.Error)
+			}
+		}
+		stopped := strings.Contains(log(), "Stopping without a reader on 'reader.query', 19 of 20 queries not run")
+		if stopped != (policy == noReaderAbort) {
+			t.Errorf("%s: logged\n%s", policy, log())
+		}
+	}
+}
+
+// Watch mode polls for a missing reader, with the backoff, until one subscribes
+func TestWatchWaitsForAReader(t *testing.T) {
+	s := startFakeNATS(t)
+	c := newTestClient(t, s)
+	c.output = outputJSONL
+	c.noReader = noReaderAbort // Batch runs only
+	log := captureLog(t)
+	reader := make(chan func() []ReaderRequest, 1)
+	time.AfterFunc(readerPollBackoff/2, func() { reader <- fakeReader(t, s, natsSubjectRequest, pagedDeviceReader(nil, 10)) })
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	c.ctx = ctx
+	time.AfterFunc(readerPollBackoff*3/2, cancel) // Once the poll is answered
+
+	if failure, err := c.runWatch(ctx, deviceQueries(1), time.Hour, 1); failure != "" || err != nil {
+		t.Fatalf("runWatch = %q, %v", failure, err)
+	}
+	if err := c.out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if records := jsonlResults(t, c); len(records) != 1 || records[0].Status != "success" {
+		t.Errorf("wrote %+v, want the one result of the reader", records)
+	}
+	if sent := (<-reader)(); len(sent) != 1 {
+		t.Errorf("reader received %d request(s), want the poll after it subscribed", len(sent))
+	}
+	if want := "No reader available on 'reader.query' for device_health; polling again in 1s\nReader available on 'reader.query' again\n"; !strings.Contains(log(), want) {
+		t.Errorf("logged\n%s\nwant %q", log(), want)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	runSubcommand        = "run"
+	runDescription       = "runs a query saved in the config file's saved section by name, its params overridable with flags"
+	listSavedSubcommand  = "list-saved"
+	listSavedDescription = "lists the queries saved in the config file with their descriptions"
+)
+
+// savedQuery is an entry of the saved section of the config file: a name for a query entry
+// as in a queries file, with a description and the output format it is best read in:
+//
+//	saved:
+//	  disk-alerts:
+//	    description: Critical alerts of the disk shelf in the last hour
+//	    query_type: alerts_critical
+//	    params: {since_minutes: 60, min_criticality: 8, source_device: DiskUnit}
+//	    output: table
+//
+// Names may not be those of subcommands, which client <name> would shadow in use.
+type savedQuery struct {
+	name        string
+	description string
+	output      outputFormat // "" leaves the format to --output
+	query       plannedQuery
+}
+
+// Parses the run subcommand and the saved query it names from the config file at path.
+// Every param of the saved query with a scalar value gets a flag of its name overriding it,
+// e.g. client run disk-alerts --since_minutes 15.
+func parseRun(args []string, path string, stderr io.Writer) (savedQuery, error) {
+	usage := func(saved []savedQuery) {
+		fmt.Fprintf(stderr, "Usage: client [global flags] %s <name> [--<param> value ...]\n\nThe %s subcommand %s. Saved queries in %s:\n", runSubcommand, runSubcommand, runDescription, path)
+		printSavedQueries(stderr, saved)
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			saved, _ := loadSavedQueries(path)
+			usage(saved)
+			return savedQuery{}, flag.ErrHelp
+		}
+		return savedQuery{}, fmt.Errorf("%s: the name of a saved query is required, see client %s", runSubcommand, listSavedSubcommand)
+	}
+	saved, err := loadSavedQueries(path)
+	if err != nil {
+		return savedQuery{}, prefixProblems(runSubcommand, err)
+	}
+	i := slices.IndexFunc(saved, func(s savedQuery) bool { return s.name == args[0] })
+	if i < 0 {
+		names := make([]string, 0, len(saved))
+		for _, s := range saved {
+			names = append(names, s.name)
+		}
+		return savedQuery{}, fmt.Errorf("%s: %q: no such saved query in %s, which has %s", runSubcommand, args[0], path, strings.Join(names, ", "))
+	}
+	query := saved[i]
+
+	fs := flag.NewFlagSet("client "+runSubcommand+" "+query.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	overrides := map[string]*string{}
+	for key, value := range query.query.request.Params {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			continue // Only scalars can be given on the command line
+		}
+		overrides[key] = fs.String(key, "", fmt.Sprintf("override the %s param (saved: %v)", key, value))
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: client [global flags] %s %s [flags]\n\n%s: %s (%s).\n", runSubcommand, query.name, query.name, query.description, query.query.request.QueryType)
+		if len(overrides) > 0 {
+			fmt.Fprintf(stderr, "\nFlags:\n")
+			fs.PrintDefaults()
+		}
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return query, err
+		}
+		return query, errUsageReported
+	}
+
+	var problems []error
+	if fs.NArg() > 0 {
+		problems = append(problems, fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	// Copy the params so that the loaded query stays as saved
+	params := make(map[string]interface{}, len(query.query.request.Params))
+	for key, value := range query.query.request.Params {
+		params[key] = value
+	}
+	fs.Visit(func(f *flag.Flag) {
+		value, err := overrideParam(params[f.Name], *overrides[f.Name])
+		if err != nil {
+			problems = append(problems, fmt.Errorf("--%s %w", f.Name, err))
+			return
+		}
+		params[f.Name] = value
+	})
+	query.query.request.Params = params
+	for i, problem := range problems {
+		problems[i] = fmt.Errorf("%s %s: %w", runSubcommand, query.name, problem)
+	}
+	return query, errors.Join(problems...)
+}
+
+// Parses the value given for a param on the command line as the type of its saved value,
+// so that an integer param stays an integer
+func overrideParam(saved interface{}, value string) (interface{}, error) {
+	switch saved.(type) {
+	case int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q: expected an integer like the saved value", value)
+		}
+		return n, nil
+	case float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: expected a number like the saved value", value)
+		}
+		return f, nil
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q: expected true or false like the saved value", value)
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+// Parses the list-saved subcommand and reads the saved queries of the config file at path
+func parseListSaved(args []string, path string, stderr io.Writer) ([]savedQuery, error) {
+	fs := flag.NewFlagSet("client "+listSavedSubcommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: client [global flags] %s\n\nThe %s subcommand %s (--config).\n", listSavedSubcommand, listSavedSubcommand, listSavedDescription)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errUsageReported
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("%s: unexpected argument %q", listSavedSubcommand, fs.Arg(0))
+	}
+	saved, err := loadSavedQueries(path)
+	if err != nil {
+		return nil, prefixProblems(listSavedSubcommand, err)
+	}
+	return saved, nil
+}
+
+// Reads the saved section of the config file at path, sorted by name. A name shadowing a
+// subcommand is rejected, as is any invalid entry.
+func loadSavedQueries(path string) ([]savedQuery, error) {
+	if path == "" {
+		return nil, errors.New("--config: is required without a home directory")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("--config: %w", err)
+	}
+	var file struct {
+		Saved yaml.Node `yaml:"saved"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if file.Saved.Kind == 0 {
+		return nil, fmt.Errorf("%s: has no saved section naming queries", path)
+	}
+	if file.Saved.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: saved (line %d): expected a mapping of names to queries", path, file.Saved.Line)
+	}
+
+	var problems []error
+	var saved []savedQuery
+	missing := map[string]bool{}
+	for i := 0; i+1 < len(file.Saved.Content); i += 2 {
+		key, value := file.Saved.Content[i], file.Saved.Content[i+1]
+		query, err := parseSavedQuery(key.Value, value, os.LookupEnv, missing)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: saved query %q (line %d): %w", path, key.Value, key.Line, err))
+			continue
+		}
+		saved = append(saved, query)
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Errorf("%s: undefined environment variable(s): %s", path, strings.Join(missingNames(missing), ", ")))
+	}
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].name < saved[j].name })
+	return saved, nil
+}
+
+func parseSavedQuery(name string, node *yaml.Node, lookup func(string) (string, bool), missing map[string]bool) (savedQuery, error) {
+	switch {
+	case name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t"):
+		return savedQuery{}, errors.New("expected a name without spaces that does not start with -")
+	case slices.Contains(subcommandNames(), name):
+		return savedQuery{}, fmt.Errorf("the name of the %s subcommand, pick another", name)
+	}
+	if node.Kind != yaml.MappingNode {
+		return savedQuery{}, errors.New("expected a mapping with description, output and the fields of a query entry")
+	}
+	saved := savedQuery{name: name}
+	entry := &yaml.Node{Kind: yaml.MappingNode, Line: node.Line}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		switch key.Value {
+		case "description":
+			if err := value.Decode(&saved.description); err != nil {
+				return savedQuery{}, errors.New("description: expected a string")
+			}
+		case "output":
+			var output string
+			if err := value.Decode(&output); err != nil {
+				return savedQuery{}, errors.New("output: expected json, jsonl, table or csv")
+			}
+			format, err := parseOutputFormat(output)
+			if err != nil {
+				return savedQuery{}, fmt.Errorf("output: %w", err)
+			}
+			saved.output = format
+		default:
+			entry.Content = append(entry.Content, key, value)
+		}
+	}
+	query, err := parseQueryEntry(entry, lookup, missing)
+	if err != nil {
+		return savedQuery{}, err
+	}
+	saved.query = query
+	return saved, nil
+}
+
+// Prints the saved queries as a table of name, query type, output format and description
+func printSavedQueries(out io.Writer, saved []savedQuery) {
+	if len(saved) == 0 {
+		fmt.Fprintln(out, "  (none)")
+		return
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, s := range saved {
+		output := string(s.output)
+		if output == "" {
+			output = "-"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", s.name, s.query.request.QueryType, output, s.description)
+	}
+	tw.Flush()
+}
+
+// Names the subcommand on every line of joined problems
+func prefixProblems(subcommand string, err error) error {
+	problems := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		problems = joined.Unwrap()
+	}
+	for i, problem := range problems {
+		problems[i] = fmt.Errorf("%s: %w", subcommand, problem)
+	}
+	return errors.Join(problems...)
+}
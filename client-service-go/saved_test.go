@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSaved = `saved:
+  temps:
+    description: Disk temperatures of the last hour
+    query_type: metric_summary
+    params: {source_device: DiskUnit, metric_type: DiskTemp, window_minutes: 60, threshold: 1.5, strict: true, tags: [a]}
+  disk-alerts:
+    description: Critical alerts of the disk shelf
+    query_type: alerts_critical
+    params: {since_minutes: 60, min_criticality: 8, source_device: DiskUnit}
+    output: table
+`
+
+func TestLoadSavedQueries(t *testing.T) {
+	saved, err := loadSavedQueries(writeProfiles(t, testSaved))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 || saved[0].name != "disk-alerts" || saved[1].name != "temps" {
+		t.Fatalf("loaded %+v, want both queries sorted by name", saved)
+	}
+	alerts := saved[0]
+	want := ReaderRequest{QueryType: "alerts_critical", Params: map[string]interface{}{"since_minutes": 60, "min_criticality": 8, "source_device": "DiskUnit"}}
+	if alerts.description != "Critical alerts of the disk shelf" || alerts.output != outputTable || !reflect.DeepEqual(alerts.query.request, want) {
+		t.Errorf("disk-alerts %+v, want %+v in a table", alerts, want)
+	}
+	if saved[1].output != "" {
+		t.Errorf("temps output %q, want it left to --output", saved[1].output)
+	}
+
+	var listed strings.Builder
+	printSavedQueries(&listed, saved)
+	wantList := "  disk-alerts  alerts_critical  table  Critical alerts of the disk shelf\n" +
+		"  temps        metric_summary   -      Disk temperatures of the last hour\n"
+	if listed.String() != wantList {
+		t.Errorf("listed\n%s\nwant\n%s", listed.String(), wantList)
+	}
+}
+
+// Names of subcommands would be shadowed by them and are rejected when loading, with every
+// other invalid entry
+func TestLoadSavedQueriesErrors(t *testing.T) {
+	path := writeProfiles(t, "saved:\n"+
+		"  health: {query_type: device_health}\n"+
+		"  run: {query_type: device_list}\n"+
+		"  \"-x\": {query_type: device_list}\n"+
+		"  sheet: {query_type: device_list, output: xlsx}\n"+
+		"  nothing: {description: no query}\n"+
+		"  fine: {query_type: device_list}\n")
+	_, err := loadSavedQueries(path)
+	for _, want := range []string{
+		`saved query "health" (line 2): the name of the health subcommand, pick another`,
+		`saved query "run" (line 3): the name of the run subcommand, pick another`,
+		`saved query "-x" (line 4): expected a name without spaces that does not start with -`,
+		`saved query "sheet" (line 5): output:`,
+		`saved query "nothing" (line 6):`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), path+": "+want) {
+			t.Errorf("loadSavedQueries error %v, want it to report %q", err, want)
+		}
+	}
+	if err != nil && strings.Contains(err.Error(), `"fine"`) {
+		t.Errorf("valid entry reported: %v", err)
+	}
+
+	for content, want := range map[string]string{
+		"profiles: {}\n":    "has no saved section naming queries",
+		"saved: [a, b]\n":   "saved (line 1): expected a mapping of names to queries",
+		"saved: {a: [1]}\n": "expected a mapping with description, output and the fields of a query entry",
+	} {
+		if _, err := loadSavedQueries(writeProfiles(t, content)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestParseRunOverrides(t *testing.T) {
+	path := writeProfiles(t, testSaved)
+	query, err := parseRun([]string{"temps", "--window_minutes", "15", "--threshold", "2", "--strict", "false", "--source_device", "DiskUnit-0007"}, path, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"source_device": "DiskUnit-0007", "metric_type": "DiskTemp", "window_minutes": 15, "threshold": 2.0, "strict": false, "tags": []interface{}{"a"}}
+	if !reflect.DeepEqual(query.query.request.Params, want) {
+		t.Errorf("params %#v, want %#v with the types saved", query.query.request.Params, want)
+	}
+	if saved, _ := loadSavedQueries(path); saved[1].query.request.Params["window_minutes"] != 60 {
+		t.Errorf("saved query changed to %v", saved[1].query.request.Params)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"temps", "--window_minutes", "soon", "--strict", "maybe"}, `run temps: --window_minutes "soon": expected an integer like the saved value`},
+		{[]string{"temps", "--strict", "maybe"}, `run temps: --strict "maybe": expected true or false`},
+		{[]string{"temps", "extra"}, `run temps: unexpected argument "extra"`},
+		{[]string{"top"}, `run: "top": no such saved query in ` + path + ", which has disk-alerts, temps"},
+		{nil, "run: the name of a saved query is required, see client list-saved"},
+	}
+	for _, tt := range tests {
+		if _, err := parseRun(tt.args, path, io.Discard); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("run %q: %v, want %q", tt.args, err, tt.want)
+		}
+	}
+	// Lists can't be given as flags
+	if _, err := parseRun([]string{"temps", "--tags", "b"}, path, io.Discard); !errors.Is(err, errUsageReported) {
+		t.Errorf("run with --tags: %v, want the unknown flag reported", err)
+	}
+	if _, err := parseRun([]string{"--help"}, path, io.Discard); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("run --help: %v", err)
+	}
+}
+
+// client run sends the saved query with its overrides, in its saved format unless
+// --output is given
+func TestRunSavedQuery(t *testing.T) {
+	s := startFakeNATS(t)
+	requests := fakeReader(t, s, natsSubjectRequest, func(request ReaderRequest) ReaderResponse {
+		return ReaderResponse{Status: "success", Data: []interface{}{}}
+	})
+	path := writeProfiles(t, testSaved)
+	for _, tt := range []struct {
+		flags      []string
+		wantHeader string
+	}{
+		{nil, "\n(no rows)\n"},
+		{[]string{"--output", "json"}, "\n[]\n"},
+	} {
+		out := filepath.Join(t.TempDir(), "results")
+		args := append(append([]string{"--nats-url", s.url(), "--config", path, "--out", out}, tt.flags...), "run", "disk-alerts", "--since_minutes", "15")
+		if code := runClient(t, nil, args...); code != exitOK {
+			t.Fatalf("run %v exited %d", tt.flags, code)
+		}
+		if written := readFile(t, out); !strings.Contains(written, tt.wantHeader) {
+			t.Errorf("run %v wrote\n%s\nwant %q", tt.flags, written, tt.wantHeader)
+		}
+	}
+	sent := requests()
+	want := map[string]interface{}{"since_minutes": 15.0, "min_criticality": 8.0, "source_device": "DiskUnit"}
+	if len(sent) != 2 || sent[0].QueryType != "alerts_critical" || !reflect.DeepEqual(sent[0].Params, want) {
+		t.Errorf("sent %+v, want alerts_critical with %v", sent, want)
+	}
+}
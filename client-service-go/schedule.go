@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	scheduleSubcommand  = "schedule"
+	scheduleDescription = "runs the queries of the config file's schedule section at their cron times until Ctrl-C, appending the results to their files"
+	// Replaced in a job's out path by the day of the run, e.g. reports/events-{{date}}.log
+	scheduleDateTemplate = "{{date}}"
+)
+
+// overlapPolicy says what a job does when its next run is due before the last one is done.
+type overlapPolicy string
+
+const (
+	overlapSkip  overlapPolicy = "skip"  // Skip the run
+	overlapQueue overlapPolicy = "queue" // Run it once the last one is done; further runs due meanwhile are skipped
+)
+
+// scheduledJob is an entry of the schedule section of the config file, a query entry as in
+// a queries file with a cron expression, a results file and an overlap policy:
+//
+//	schedule:
+//	  - cron: "0 8 * * *"
+//	    query_type: events_by_type
+//	    params: {since_minutes: 1440}
+//	    out: reports/events-{{date}}.log
+//	  - cron: "*/15 * * * *"
+//	    query_type: metric_summary
+//	    params: {source_device: DiskUnit, metric_type: DiskTemp, window_minutes: 15}
+//	    overlap: queue
+type scheduledJob struct {
+	spec    string
+	cron    cronSchedule
+	query   plannedQuery
+	out     string // Results file, {{date}} standing for the day of the run; "" for --out
+	overlap overlapPolicy
+	webhook *webhookTarget // Receives the results instead of --webhook-url, nil without
+}
+
+// Parses the schedule subcommand and reads the schedule of the config file at path,
+// reporting flag syntax errors and -h like parseSubcommand
+func parseSchedule(args []string, path string, stderr io.Writer) ([]scheduledJob, error) {
+	fs := flag.NewFlagSet("client "+scheduleSubcommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: client [global flags] %s\n\nThe %s subcommand %s. The schedule is read from --config, e.g.\n\n", scheduleSubcommand, scheduleSubcommand, scheduleDescription)
+		fmt.Fprintf(stderr, "  schedule:\n    - cron: \"0 8 * * *\"\n      query_type: events_by_type\n      params: {since_minutes: 1440}\n      out: reports/events-%s.log\n      overlap: skip\n", scheduleDateTemplate)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errUsageReported
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("%s: unexpected argument %q", scheduleSubcommand, fs.Arg(0))
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%s: --config: is required without a home directory", scheduleSubcommand)
+	}
+	jobs, err := loadSchedule(path)
+	if err != nil {
+		return nil, prefixProblems(scheduleSubcommand, err)
+	}
+	return jobs, nil
+}
+
+// Reads the schedule section of the config file at path
+func loadSchedule(path string) ([]scheduledJob, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("--config: %w", err)
+	}
+	var file struct {
+		Schedule []yaml.Node `yaml:"schedule"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: schedule: expected a list of jobs: %w", path, err)
+	}
+	if len(file.Schedule) == 0 {
+		return nil, fmt.Errorf("%s: has no schedule section listing jobs", path)
+	}
+
+	var problems []error
+	jobs := make([]scheduledJob, 0, len(file.Schedule))
+	missing := map[string]bool{}
+	for i, node := range file.Schedule {
+		job, err := parseScheduledJob(&node, os.LookupEnv, missing)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: schedule entry %d (line %d): %w", path, i, node.Line, err))
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Errorf("%s: undefined environment variable(s): %s", path, strings.Join(missingNames(missing), ", ")))
+	}
+	return jobs, errors.Join(problems...)
+}
+
+// Parses a job: its cron, out and overlap fields, the rest being a query entry
+func parseScheduledJob(node *yaml.Node, lookup func(string) (string, bool), missing map[string]bool) (scheduledJob, error) {
+	if node.Kind != yaml.MappingNode {
+		return scheduledJob{}, errors.New("expected a mapping with cron, out, overlap and the fields of a query entry")
+	}
+	job := scheduledJob{overlap: overlapSkip}
+	entry := &yaml.Node{Kind: yaml.MappingNode, Line: node.Line}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		var err error
+		switch key.Value {
+		case "cron":
+			if err = value.Decode(&job.spec); err != nil {
+				return scheduledJob{}, errors.New("cron: expected a string such as \"*/15 * * * *\"")
+			}
+			if job.cron, err = parseCron(job.spec); err != nil {
+				return scheduledJob{}, fmt.Errorf("cron: %w", err)
+			}
+		case "out":
+			if err = value.Decode(&job.out); err != nil {
+				return scheduledJob{}, errors.New("out: expected a path")
+			}
+		case "overlap":
+			if err = value.Decode(&job.overlap); err != nil || (job.overlap != overlapSkip && job.overlap != overlapQueue) {
+				return scheduledJob{}, fmt.Errorf("overlap: %q: expected skip or queue", value.Value)
+			}
+		case "webhook":
+			webhook, err := parseJobWebhook(value, lookup, missing)
+			if err != nil {
+				return scheduledJob{}, fmt.Errorf("webhook: %w", err)
+			}
+			job.webhook = webhook
+		case "repeat":
+			return scheduledJob{}, errors.New("repeat: not supported in schedule entries, the cron expression sets how often the query runs")
+		default:
+			entry.Content = append(entry.Content, key, value)
+		}
+	}
+	if job.spec == "" {
+		return scheduledJob{}, errors.New("cron: is required")
+	}
+	query, err := parseQueryEntry(entry, lookup, missing)
+	if err != nil {
+		return scheduledJob{}, err
+	}
+	job.query = query
+	return job, nil
+}
+
+// Parses the webhook of a job, a URL or a mapping of url and secret, both of which may use
+// ${VAR} references to the environment, so that secrets stay out of the file
+func parseJobWebhook(node *yaml.Node, lookup func(string) (string, bool), missing map[string]bool) (*webhookTarget, error) {
+	var fields struct {
+		URL    string `yaml:"url"`
+		Secret string `yaml:"secret"`
+	}
+	if err := node.Decode(&fields.URL); err != nil {
+		if err := node.Decode(&fields); err != nil {
+			return nil, errors.New("expected a URL, or a mapping of url and secret")
+		}
+	}
+	target := &webhookTarget{
+		url:    expandEnvReferences(fields.URL, lookup, missing),
+		secret: expandEnvReferences(fields.Secret, lookup, missing),
+	}
+	if len(missing) > 0 {
+		return target, nil // Reported with the other undefined variables
+	}
+	if err := validateWebhookURL(target.url); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// Returns the results file of a run at t, "" for --out
+func (j *scheduledJob) outPath(t time.Time) string {
+	return strings.ReplaceAll(j.out, scheduleDateTemplate, t.Format(time.DateOnly))
+}
+
+// scheduler runs jobs at their cron times. Its clock is a field, so that it can run on a
+// fake one.
+type scheduler struct {
+	jobs  []scheduledJob
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+	run   func(job *scheduledJob, at time.Time) // Runs a job, due at the time
+	// Reports a run due while the job was still running, and not queued
+	skipped func(job *scheduledJob, at time.Time)
+}
+
+// Runs the jobs until ctx is cancelled, then waits for the runs in progress
+func (s *scheduler) loop(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range s.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loopJob(ctx, &s.jobs[i])
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *scheduler) loopJob(ctx context.Context, job *scheduledJob) {
+	// A worker runs the job. With skip, a send only succeeds while it waits for a run; with
+	// queue, one more run can wait in the buffer.
+	runs := make(chan time.Time)
+	if job.overlap == overlapQueue {
+		runs = make(chan time.Time, 1)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for at := range runs {
+			s.run(job, at)
+		}
+	}()
+	defer func() {
+		close(runs)
+		<-done
+	}()
+
+	var last time.Time
+	for {
+		// From the last run due, should the timer have fired early
+		from := s.now()
+		if from.Before(last) {
+			from = last
+		}
+		due := job.cron.next(from)
+		last = due
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.after(due.Sub(s.now())):
+		}
+		select {
+		case runs <- due:
+		default:
+			s.skipped(job, due)
+		}
+	}
+}
+
+// scheduleStats counts the runs of a job.
+type scheduleStats struct {
+	runs     int
+	failures int
+	skipped  int
+}
+
+// Runs the scheduled jobs until ctx is cancelled, each run writing its result to the job's
+// file, or the output, and a line to stderr. Runs in progress at Ctrl-C are aborted and
+// left out. Prints a summary of the runs per job on exit and returns the code of the first
+// failure, "" without any.
+func (c *client) runSchedule(ctx context.Context, jobs []scheduledJob) failureCode {
+	var mu sync.Mutex // Guards the stats and the output
+	stats := map[*scheduledJob]*scheduleStats{}
+	var totals queryStats
+
+	s := &scheduler{jobs: jobs, now: time.Now, after: time.After}
+	for i := range s.jobs {
+		job := &s.jobs[i]
+		stats[job] = &scheduleStats{}
+		logger.infof("Scheduled %s at %q, next run at %s", job.query.request.QueryType, job.spec, job.cron.next(time.Now()).Format(time.RFC3339))
+	}
+	s.run = func(job *scheduledJob, at time.Time) {
+		result := c.forQuery(job.query).sendQuery(job.query.requestAt(time.Now()), job.query.timeout)
+		if errors.Is(result.err, context.Canceled) {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		stats[job].runs++
+		totals.add(result.exchange, result.failure, result.answered)
+		outcome := "ok"
+		if result.err != nil {
+			stats[job].failures++
+			outcome = fmt.Sprintf("failed: %v", result.err)
+		}
+		target := job.outPath(at)
+		if err := c.writeScheduled(target, result.text); err != nil {
+			outcome += fmt.Sprintf("; writing the result failed: %v", err)
+		}
+		if target == "" {
+			target = c.out.name
+		}
+		webhook := job.webhook
+		if webhook == nil {
+			webhook = c.webhook
+		}
+		c.notifier.notify(c.ctx, webhook, result)
+		logger.infof("Ran %s (%s) due at %s, %s -> %s", job.query.request.QueryType, job.spec, at.Format(time.RFC3339), outcome, target)
+	}
+	s.skipped = func(job *scheduledJob, at time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		stats[job].skipped++
+		logger.infof("Skipped %s (%s) due at %s, its last run is still in progress", job.query.request.QueryType, job.spec, at.Format(time.RFC3339))
+	}
+
+	s.loop(ctx)
+	logger.infof("=== Schedule summary ===")
+	for i := range s.jobs {
+		job := &s.jobs[i]
+		st := stats[job]
+		logger.infof("%-25s %-15s %d run(s), %d failed, %d skipped", job.query.request.QueryType, job.spec, st.runs, st.failures, st.skipped)
+	}
+	logger.infof("%s", &totals)
+	if c.notifier != nil {
+		logger.infof("%s", c.notifier)
+	}
+	return totals.failure
+}
+
+// Appends a result to the file at path, creating it and its directory, or to the output
+// when path is ""
+func (c *client) writeScheduled(path, text string) error {
+	if path == "" {
+		return c.out.writeResult(text)
+	}
+	out, err := openOutput(path, false, rotation{})
+	if err != nil {
+		return err
+	}
+	if err := out.writeResult(text); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scheduleRuns records the runs and skips of a scheduler on a fake clock, and lets the
+// test hold the runs in progress
+type scheduleRuns struct {
+	mu      sync.Mutex
+	runs    []string
+	skipped []string
+	release chan struct{} // Closed to let runs finish; nil runs them at once
+}
+
+func newTestScheduler(t *testing.T, clock *fakeClock, specs ...string) (*scheduler, *scheduleRuns) {
+	t.Helper()
+	record := &scheduleRuns{}
+	s := &scheduler{now: clock.Now, after: clock.After}
+	for _, spec := range specs {
+		cron, err := parseCron(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.jobs = append(s.jobs, scheduledJob{spec: spec, cron: cron, overlap: overlapSkip})
+	}
+	entry := func(job *scheduledJob, at time.Time) string {
+		return fmt.Sprintf("%s %s", job.spec, at.Format("15:04"))
+	}
+	s.run = func(job *scheduledJob, at time.Time) {
+		record.mu.Lock()
+		record.runs = append(record.runs, entry(job, at))
+		release := record.release
+		record.mu.Unlock()
+		if release != nil {
+			<-release
+		}
+	}
+	s.skipped = func(job *scheduledJob, at time.Time) {
+		record.mu.Lock()
+		defer record.mu.Unlock()
+		record.skipped = append(record.skipped, entry(job, at))
+	}
+	return s, record
+}
+
+// Waits until the runs and skips recorded reach the counts
+func (r *scheduleRuns) waitFor(t *testing.T, runs, skipped int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.mu.Lock()
+		got, gotSkipped := len(r.runs), len(r.skipped)
+		r.mu.Unlock()
+		if got >= runs && gotSkipped >= skipped {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d run(s) and %d skip(s), want %d and %d", got, gotSkipped, runs, skipped)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (r *scheduleRuns) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fmt.Sprintf("ran %s; skipped %s", strings.Join(r.runs, ", "), strings.Join(r.skipped, ", "))
+}
+
+// Moves the clock by d once every job waits for it
+func advanceScheduler(t *testing.T, clock *fakeClock, jobs int, d time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for clock.pending() < jobs {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d job(s) wait for the clock, want %d", clock.pending(), jobs)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.advance(d)
+}
+
+func TestSchedulerRunsJobsAtTheirTimes(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 7, 50, 0, 0, time.UTC)}
+	s, record := newTestScheduler(t, clock, "0 8 * * *", "*/15 * * * *")
+	for i := range s.jobs {
+		s.jobs[i].overlap = overlapQueue // No run is skipped for the worker being slow to wait
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.loop(ctx)
+		close(done)
+	}()
+
+	advanceScheduler(t, clock, 2, 10*time.Minute) // 08:00, both due
+	record.waitFor(t, 2, 0)
+	advanceScheduler(t, clock, 2, 14*time.Minute) // 08:14, none due
+	advanceScheduler(t, clock, 2, time.Minute)    // 08:15
+	record.waitFor(t, 3, 0)
+	advanceScheduler(t, clock, 2, time.Hour) // 09:15: the 08:30 run, late, the runs missed meanwhile not made up
+	record.waitFor(t, 4, 0)
+	cancel()
+	<-done
+
+	runs := append([]string(nil), record.runs...)
+	if len(runs) != 4 || !strings.Contains(strings.Join(runs[:2], " "), "0 8 * * * 08:00") || !strings.Contains(strings.Join(runs[:2], " "), "*/15 * * * * 08:00") ||
+		runs[2] != "*/15 * * * * 08:15" || runs[3] != "*/15 * * * * 08:30" {
+		t.Errorf("%s, want both jobs at 08:00, then the quarter-hourly one at 08:15 and 08:30", record)
+	}
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	tests := []struct {
+		overlap     overlapPolicy
+		wantRuns    []string
+		wantSkipped []string
+	}{
+		{overlapSkip, []string{"* * * * * 10:01"}, []string{"* * * * * 10:02", "* * * * * 10:03"}},
+		{overlapQueue, []string{"* * * * * 10:01", "* * * * * 10:02"}, []string{"* * * * * 10:03"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.overlap), func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)}
+			s, record := newTestScheduler(t, clock, "* * * * *")
+			s.jobs[0].overlap = tt.overlap
+			release := make(chan struct{})
+			record.release = release
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				s.loop(ctx)
+				close(done)
+			}()
+
+			advanceScheduler(t, clock, 1, time.Minute) // 10:01 runs and holds on
+			record.waitFor(t, 1, 0)
+			advanceScheduler(t, clock, 1, time.Minute) // 10:02 queued or skipped
+			advanceScheduler(t, clock, 1, time.Minute) // 10:03 skipped
+			record.waitFor(t, 1, len(tt.wantSkipped))
+			close(release)
+			record.waitFor(t, len(tt.wantRuns), len(tt.wantSkipped))
+			cancel()
+			<-done
+
+			if strings.Join(record.runs, ", ") != strings.Join(tt.wantRuns, ", ") || strings.Join(record.skipped, ", ") != strings.Join(tt.wantSkipped, ", ") {
+				t.Errorf("%s, want runs %v and skips %v", record, tt.wantRuns, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+// Cancelling stops the jobs waiting for their time and waits for the runs in progress
+func TestSchedulerShutsDownCleanly(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)}
+	s, record := newTestScheduler(t, clock, "* * * * *", "0 8 * * *")
+	release := make(chan struct{})
+	record.release = release
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.loop(ctx)
+		close(done)
+	}()
+
+	advanceScheduler(t, clock, 2, time.Minute)
+	record.waitFor(t, 1, 0)
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("loop returned with a run in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("loop still running after the last run finished")
+	}
+}
+
+func TestLoadScheduleErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), profilesFileName)
+	config := "schedule:\n" +
+		"  - cron: \"*/15 * * * *\"\n    query_type: metric_summary\n    out: reports/metrics-{{date}}.log\n    overlap: queue\n" +
+		"  - cron: \"0 25 * * *\"\n    query_type: events_by_type\n" +
+		"  - query_type: device_list\n" +
+		"  - cron: \"@daily\"\n    query_type: device_list\n    overlap: wait\n" +
+		"  - cron: \"@daily\"\n    query_type: device_list\n    repeat: 2\n"
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := loadSchedule(path)
+	for _, want := range []string{
+		path + `: schedule entry 1 (line 6): cron: "0 25 * * *": hour: 25: out of range 0-23`,
+		path + ": schedule entry 2 (line 8): cron: is required",
+		path + `: schedule entry 3 (line 9): overlap: "wait": expected skip or queue`,
+		path + ": schedule entry 4 (line 12): repeat: not supported",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadSchedule error %v, want it to report %q", err, want)
+		}
+	}
+	if code := runClient(t, nil, "--config", path, "schedule"); code != exitUsage {
+		t.Errorf("schedule with a broken cron exited %d, want %d before running anything", code, exitUsage)
+	}
+
+	jobs, err := loadSchedule(writeProfiles(t, "schedule:\n  - cron: \"*/15 * * * *\"\n    query_type: metric_summary\n    out: reports/metrics-{{date}}.log\n"))
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("loadSchedule = %v, %v", jobs, err)
+	}
+	if got := jobs[0].outPath(time.Date(2025, 3, 9, 8, 0, 0, 0, time.UTC)); got != "reports/metrics-2025-03-09.log" || jobs[0].overlap != overlapSkip {
+		t.Errorf("out %q overlap %s, want a dated file and skip by default", got, jobs[0].overlap)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	defaultServeMaxInFlight = 32
+	maxQueryBodyBytes       = 1 << 20
+	serveShutdownTimeout    = 10 * time.Second
+)
+
+// requester sends a query to the reader. The client implements it over NATS; the gateway
+// only depends on this, so that its handlers can run against a fake.
+type requester interface {
+	query(request ReaderRequest, timeout time.Duration) (exchange, error)
+}
+
+// gateway translates HTTP requests into reader queries:
+//
+//	GET  /alerts?since=15m&min_criticality=8  alerts_critical
+//	GET  /devices/{id}/health                 device_health
+//	POST /query                               any ReaderRequest given as the JSON body
+//
+// It answers with the reader's response and 200, or 502 when the reader answered with an
+// error, 503 when no reader is subscribed or too many queries are in flight, and 504 when
+// the reader did not answer in time. With a cache, successful responses are served from it
+// until they expire, marked with an X-Cache header of HIT or MISS.
+type gateway struct {
+	reader   requester
+	inFlight chan struct{}  // Holds a token per query being answered
+	cache    *responseCache // nil without caching
+}
+
+func newGateway(reader requester, maxInFlight int, cache *responseCache) http.Handler {
+	g := &gateway{reader: reader, inFlight: make(chan struct{}, maxInFlight), cache: cache}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /alerts", g.handleAlerts)
+	mux.HandleFunc("GET /devices/{id}/health", g.handleHealth)
+	mux.HandleFunc("POST /query", g.handleQuery)
+	return mux
+}
+
+func (g *gateway) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	since, minCrit := 15*time.Minute, 8
+	var problems []error
+	if value := r.URL.Query().Get("since"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("since %q: not a duration such as 15m", value))
+		} else {
+			since = d
+		}
+	}
+	sinceMinutes, err := wholeMinutes("since", since)
+	problems = appendProblem(problems, err)
+	if value := r.URL.Query().Get("min_criticality"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < minCriticality || n > maxCriticality {
+			problems = append(problems, fmt.Errorf("min_criticality %q: must be an integer between %d and %d", value, minCriticality, maxCriticality))
+		} else {
+			minCrit = n
+		}
+	}
+	if len(problems) > 0 {
+		writeGatewayError(w, http.StatusBadRequest, errors.Join(problems...).Error())
+		return
+	}
+	g.forward(w, r, ReaderRequest{
+		QueryType: "alerts_critical",
+		Params:    map[string]interface{}{"since_minutes": sinceMinutes, "min_criticality": minCrit},
+	})
+}
+
+func (g *gateway) handleHealth(w http.ResponseWriter, r *http.Request) {
+	g.forward(w, r, ReaderRequest{
+		QueryType: "device_health",
+		Params:    map[string]interface{}{"source_device": r.PathValue("id")},
+	})
+}
+
+func (g *gateway) handleQuery(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxQueryBodyBytes))
+	if err != nil {
+		writeGatewayError(w, http.StatusBadRequest, fmt.Sprintf("reading the body: %v", err))
+		return
+	}
+	request, err := decodeRawRequest(body)
+	if err != nil {
+		writeGatewayError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	g.forward(w, r, request)
+}
+
+// Sends the request to the reader and writes its response, or the error, with the
+// matching status code, unless the cache holds the response. Every request is logged to
+// stderr.
+func (g *gateway) forward(w http.ResponseWriter, r *http.Request, request ReaderRequest) {
+	key, cacheable := "", false
+	if g.cache != nil {
+		key, cacheable = cacheKey(request)
+	}
+	if cacheable {
+		if ex, age, ok := g.cache.get(key); ok {
+			logger.infof("%s %s -> %d (request %s, cached %s ago)", r.Method, r.URL.RequestURI(), http.StatusOK, ex.request.RequestID, age.Round(time.Millisecond))
+			w.Header().Set("X-Cache", "HIT")
+			w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+			w.Header().Set("X-Request-ID", ex.request.RequestID)
+			writeGatewayJSON(w, http.StatusOK, ex.response)
+			return
+		}
+		w.Header().Set("X-Cache", "MISS")
+	}
+
+	select {
+	case g.inFlight <- struct{}{}:
+		defer func() { <-g.inFlight }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		writeGatewayError(w, http.StatusServiceUnavailable, "too many queries in flight, retry later")
+		return
+	}
+
+	ex, err := g.reader.query(request, 0)
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, nats.ErrTimeout):
+		status = http.StatusGatewayTimeout
+	case errors.Is(err, nats.ErrNoResponders):
+		status = http.StatusServiceUnavailable
+	case err != nil:
+		status = http.StatusBadGateway
+	case ex.response.Status != "success":
+		status = http.StatusBadGateway
+	}
+	logger.infof("%s %s -> %d (request %s, %s)", r.Method, r.URL.RequestURI(), status, ex.request.RequestID, roundLatency(ex.latency))
+
+	if ex.request.RequestID != "" {
+		w.Header().Set("X-Request-ID", ex.request.RequestID)
+	}
+	if err != nil {
+		writeGatewayError(w, status, err.Error())
+		return
+	}
+	if cacheable && status == http.StatusOK {
+		g.cache.put(key, ex)
+	}
+	writeGatewayJSON(w, status, ex.response)
+}
+
+// Writes an error of the gateway itself in the shape of a reader response
+func writeGatewayError(w http.ResponseWriter, status int, message string) {
+	writeGatewayJSON(w, status, ReaderResponse{Status: "error", Message: message})
+}
+
+func writeGatewayJSON(w http.ResponseWriter, status int, response ReaderResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Serves the gateway on addr until ctx is cancelled, then stops accepting connections and
+// waits up to serveShutdownTimeout for the queries in flight.
+func (c *client) serve(ctx context.Context, addr string, maxInFlight int, cache *responseCache) error {
+	// Queries in flight are left to finish at shutdown rather than abandoned on Ctrl-C
+	gc := *c
+	gc.ctx = context.Background()
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           newGateway(&gc, maxInFlight, cache),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		// No WriteTimeout: a query is bounded by the request timeout and retry policy
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+	logger.infof("Serving reader queries on %s, Ctrl-C to stop", addr)
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// fakeRequester answers the gateway's queries with respond in place of the reader and
+// keeps the requests it was sent
+type fakeRequester struct {
+	respond func(ReaderRequest) (ReaderResponse, error)
+
+	mu       sync.Mutex
+	requests []ReaderRequest
+}
+
+func (f *fakeRequester) query(request ReaderRequest, _ time.Duration) (exchange, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, request)
+	f.mu.Unlock()
+	request.RequestID = "req-1"
+	response, err := f.respond(request)
+	return exchange{request: request, response: response}, err
+}
+
+func (f *fakeRequester) sent() []ReaderRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ReaderRequest(nil), f.requests...)
+}
+
+// serveGateway sends one HTTP request to a gateway in front of reader
+func serveGateway(t *testing.T, reader requester, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newGateway(reader, 4, nil).ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestGatewayTranslatesRequests(t *testing.T) {
+	tests := []struct {
+		method, target, body string
+		want                 ReaderRequest
+	}{
+		{"GET", "/alerts", "", ReaderRequest{QueryType: "alerts_critical", Params: map[string]interface{}{"since_minutes": 15, "min_criticality": 8}}},
+		{"GET", "/alerts?since=2h&min_criticality=9", "", ReaderRequest{QueryType: "alerts_critical", Params: map[string]interface{}{"since_minutes": 120, "min_criticality": 9}}},
+		{"GET", "/devices/StorageArray-0001/health", "", ReaderRequest{QueryType: "device_health", Params: map[string]interface{}{"source_device": "StorageArray-0001"}}},
+		{"POST", "/query", `{"query_type":"device_list"}`, ReaderRequest{QueryType: "device_list", Params: map[string]interface{}{}}},
+		{"POST", "/query", `{"query_type":"metrics_avg","params":{"metric_type":"IOPs"}}`, ReaderRequest{QueryType: "metrics_avg", Params: map[string]interface{}{"metric_type": "IOPs"}}},
+	}
+	for _, tt := range tests {
+		reader := &fakeRequester{respond: func(ReaderRequest) (ReaderResponse, error) {
+			return ReaderResponse{Status: "success", Data: []interface{}{}}, nil
+		}}
+		rec := serveGateway(t, reader, tt.method, tt.target, tt.body)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s %s: status %d, want 200: %s", tt.method, tt.target, rec.Code, rec.Body)
+			continue
+		}
+		if sent := reader.sent(); len(sent) != 1 || !reflect.DeepEqual(sent[0], tt.want) {
+			t.Errorf("%s %s sent %+v, want %+v", tt.method, tt.target, sent, tt.want)
+		}
+		if rec.Header().Get("X-Request-ID") != "req-1" || rec.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s %s: headers %v, want the request ID and JSON", tt.method, tt.target, rec.Header())
+		}
+	}
+}
+
+func TestGatewayStatusCodes(t *testing.T) {
+	tests := []struct {
+		name                 string
+		method, target, body string
+		response             ReaderResponse
+		err                  error
+		wantStatus           int
+		wantMessage          string // Part of the message of an error response
+	}{
+		{name: "success", method: "GET", target: "/alerts", response: ReaderResponse{Status: "success", Data: []interface{}{}}, wantStatus: http.StatusOK},
+		{name: "reader error", method: "GET", target: "/alerts", response: ReaderResponse{Status: "error", Message: "influx down"}, wantStatus: http.StatusBadGateway, wantMessage: "influx down"},
+		{name: "timeout", method: "GET", target: "/alerts", err: fmt.Errorf("no response: %w", nats.ErrTimeout), wantStatus: http.StatusGatewayTimeout, wantMessage: "no response"},
+		{name: "no responders", method: "GET", target: "/alerts", err: nats.ErrNoResponders, wantStatus: http.StatusServiceUnavailable},
+		{name: "undecodable response", method: "GET", target: "/alerts", err: decodeErrorf("not JSON"), wantStatus: http.StatusBadGateway, wantMessage: "not JSON"},
+		{name: "bad since", method: "GET", target: "/alerts?since=soon", wantStatus: http.StatusBadRequest, wantMessage: `since "soon"`},
+		{name: "since below a minute", method: "GET", target: "/alerts?since=30s", wantStatus: http.StatusBadRequest, wantMessage: "whole number of minutes"},
+		{name: "bad criticality", method: "GET", target: "/alerts?min_criticality=11", wantStatus: http.StatusBadRequest, wantMessage: "min_criticality"},
+		{name: "query not JSON", method: "POST", target: "/query", body: "alerts", wantStatus: http.StatusBadRequest, wantMessage: "expected an object"},
+		{name: "query without type", method: "POST", target: "/query", body: `{"params":{}}`, wantStatus: http.StatusBadRequest, wantMessage: "query_type is required"},
+		{name: "query unknown field", method: "POST", target: "/query", body: `{"query_type":"device_list","limit":5}`, wantStatus: http.StatusBadRequest, wantMessage: "unknown field"},
+		{name: "query too large", method: "POST", target: "/query", body: strings.Repeat(" ", maxQueryBodyBytes+1), wantStatus: http.StatusBadRequest, wantMessage: "too large"},
+		{name: "wrong method", method: "POST", target: "/alerts", wantStatus: http.StatusMethodNotAllowed},
+		{name: "unknown path", method: "GET", target: "/devices", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		reader := &fakeRequester{respond: func(ReaderRequest) (ReaderResponse, error) { return tt.response, tt.err }}
+		rec := serveGateway(t, reader, tt.method, tt.target, tt.body)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rec.Code, tt.wantStatus, rec.Body)
+			continue
+		}
+		if tt.wantMessage == "" {
+			continue
+		}
+		var response ReaderResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Errorf("%s: body %q is not a reader response: %v", tt.name, rec.Body, err)
+		} else if response.Status != "error" || !strings.Contains(response.Message, tt.wantMessage) {
+			t.Errorf("%s: answered %+v, want an error about %q", tt.name, response, tt.wantMessage)
+		}
+	}
+}
+
+func TestGatewayLimitsQueriesInFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	reader := &fakeRequester{respond: func(ReaderRequest) (ReaderResponse, error) {
+		started <- struct{}{}
+		<-release
+		return ReaderResponse{Status: "success", Data: []interface{}{}}, nil
+	}}
+	gw := newGateway(reader, 1, nil)
+
+	first := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest("GET", "/alerts", nil))
+		first <- rec.Code
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest("GET", "/devices/dev-01/health", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("query beyond the limit answered %d with Retry-After %q, want 503 with it", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	close(release)
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("query within the limit answered %d, want 200", code)
+	}
+	rec = httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest("GET", "/alerts", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("query after the first finished answered %d, want 200", rec.Code)
+	}
+}
+
+// Cancelling the context stops the server only once the query in flight is answered
+func TestServeShutsDownGracefully(t *testing.T) {
+	const latency = 300 * time.Millisecond
+	s := startFakeNATS(t)
+	slowReader(t, s, latency)
+	c := newTestClient(t, s)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- c.serve(ctx, addr, 4, nil) }()
+
+	var resp *http.Response
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		resp, err = http.Get("http://" + addr + "/devices/dev-01/health")
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("gateway never listened: %v", err)
+	}
+	resp.Body.Close()
+
+	answered := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/devices/dev-02/health")
+		if err != nil {
+			t.Errorf("query in flight at shutdown: %v", err)
+			answered <- 0
+			return
+		}
+		resp.Body.Close()
+		answered <- resp.StatusCode
+	}()
+	time.Sleep(latency / 3)
+	cancel()
+
+	if code := <-answered; code != http.StatusOK {
+		t.Errorf("query in flight at shutdown answered %d, want 200", code)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve returned %v", err)
+	}
+	if _, err := http.Get("http://" + addr + "/alerts"); err == nil {
+		t.Error("gateway still answers after shutting down")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// exchange is a request as sent to the reader, with its request ID, and the response.
+type exchange struct {
+	request  ReaderRequest
+	response ReaderResponse
+	typed    interface{}   // Data decoded into its schema's type, nil for unknown query types
+	latency  time.Duration // From the first attempt to the response, retries included
+	timeout  time.Duration // Wait per attempt that applied, 0 when nothing was sent
+	attempts int           // Requests sent, retries and further pages included
+}
+
+// Describes the latency of the exchange and the timeout it was sent with, for headers
+func (ex exchange) timing() string {
+	if ex.timeout == 0 {
+		return roundLatency(ex.latency).String()
+	}
+	return fmt.Sprintf("%s, timeout %s", roundLatency(ex.latency), ex.timeout)
+}
+
+// queryStats sums up the queries of a run for its final summary line.
+type queryStats struct {
+	count    int
+	errors   int
+	failure  failureCode // Of the first failed query, which picks the exit code
+	answered int         // Queries with a response, the only ones whose latency is known
+	min      time.Duration
+	max      time.Duration
+	total    time.Duration
+}
+
+// Counts a query; failure tells why it failed, "" when it did not, and answered whether the
+// reader responded
+func (s *queryStats) add(ex exchange, failure failureCode, answered bool) {
+	s.count++
+	if failure != "" {
+		s.errors++
+		if s.failure == "" {
+			s.failure = failure
+		}
+	}
+	if !answered {
+		return
+	}
+	if s.answered == 0 || ex.latency < s.min {
+		s.min = ex.latency
+	}
+	if ex.latency > s.max {
+		s.max = ex.latency
+	}
+	s.answered++
+	s.total += ex.latency
+}
+
+// Returns the summary line, e.g. "Summary: 3 queries, 1 error(s), latency min 2ms mean 4ms max 7ms"
+func (s *queryStats) String() string {
+	line := fmt.Sprintf("Summary: %d queries, %d error(s)", s.count, s.errors)
+	if s.answered == 0 {
+		return line + ", no responses"
+	}
+	mean := s.total / time.Duration(s.answered)
+	return fmt.Sprintf("%s, latency min %s mean %s max %s", line, roundLatency(s.min), roundLatency(mean), roundLatency(s.max))
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	return d.Round(100 * time.Microsecond)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	querySubcommand  = "query"
+	queryDescription = "sends the raw requests read from stdin (-) or a file, a JSON object or one per line, in order"
+)
+
+// Parses the query subcommand, e.g. ["-"], and reads its requests, reporting flag syntax
+// errors and -h like parseSubcommand
+func parseQuerySource(args []string, stdin io.Reader, stderr io.Writer) ([]plannedQuery, error) {
+	fs := flag.NewFlagSet("client "+querySubcommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: client [global flags] %s -|FILE\n\nThe %s subcommand %s, e.g.\n\n  echo '{\"query_type\": \"device_health\", \"params\": {\"source_device\": \"StorageArray\"}}' | client %s -\n", querySubcommand, querySubcommand, queryDescription, querySubcommand)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errUsageReported
+	}
+
+	var err error
+	var queries []plannedQuery
+	switch fs.NArg() {
+	case 0:
+		err = errors.New("expected - to read the requests from stdin, or a file")
+	case 1:
+		source := fs.Arg(0)
+		if source == "-" {
+			queries, err = readRawRequests(stdin)
+		} else {
+			var f *os.File
+			if f, err = os.Open(source); err == nil {
+				queries, err = readRawRequests(f)
+				f.Close()
+			}
+		}
+		if err != nil && source == "-" {
+			err = fmt.Errorf("stdin: %w", err)
+		} else if err != nil {
+			err = fmt.Errorf("%s: %w", source, err)
+		}
+	default:
+		err = fmt.Errorf("unexpected argument %q", fs.Arg(1))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", querySubcommand, err)
+	}
+	return queries, nil
+}
+
+// Reads a stream of requests as JSON objects, one or more, such as JSON lines. Errors give
+// the byte offset in the stream where the offending request starts, or where its JSON broke.
+func readRawRequests(r io.Reader) ([]plannedQuery, error) {
+	decoder := json.NewDecoder(r)
+	var queries []plannedQuery
+	for {
+		start := decoder.InputOffset()
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, fmt.Errorf("invalid JSON at byte %d: %v", syntaxErr.Offset, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON after byte %d: %v", start, err)
+		}
+		request, err := decodeRawRequest(raw)
+		if err != nil {
+			return nil, fmt.Errorf("request %d at byte %d: %v", len(queries)+1, start, err)
+		}
+		queries = append(queries, plannedQuery{request: request, repeat: 1})
+	}
+	if len(queries) == 0 {
+		return nil, errors.New("no requests")
+	}
+	return queries, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pipeStdin makes input the client's stdin for the test, as a shell pipe would
+func pipeStdin(t *testing.T, input string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		io.WriteString(w, input)
+		w.Close()
+	}()
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+	})
+}
+
+func TestQueryFromStdin(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"single object", "{\n  \"query_type\": \"device_health\",\n  \"params\": {\"source_device\": \"dev-01\"}\n}\n", []string{"device_health map[source_device:dev-01]"}},
+		{"JSONL stream", `{"query_type": "device_list"}` + "\n" + `{"query_type": "device_health", "params": {"source_device": "dev-02"}}` + "\n\n" + `{"query_type": "device_health", "params": {"source_device": "dev-01"}}`,
+			[]string{"device_list map[]", "device_health map[source_device:dev-02]", "device_health map[source_device:dev-01]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := startFakeNATS(t)
+			requests := fakeReader(t, s, natsSubjectRequest, pagedDeviceReader([]string{"dev-01", "dev-02"}, 10))
+			pipeStdin(t, tt.input)
+			out := filepath.Join(t.TempDir(), "results")
+			if code := runClient(t, nil, "--nats-url", s.url(), "--output", "jsonl", "--out", out, "query", "-"); code != exitOK {
+				t.Fatalf("query - exited %d", code)
+			}
+			var got []string
+			for _, request := range requests() {
+				got = append(got, fmt.Sprintf("%s %v", request.QueryType, request.Params))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if lines := strings.Count(readFile(t, out), "\n"); lines != len(tt.want) {
+				t.Errorf("wrote %d JSON line(s), want one per request", lines)
+			}
+		})
+	}
+}
+
+func TestParseQuerySourceErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "requests.jsonl")
+	if err := os.WriteFile(file, []byte(`{"query_type": "device_list"}`+"\n"+`{"params": {}}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args  []string
+		stdin string
+		want  string
+	}{
+		{[]string{"-"}, `{"query_type": "device_list"}` + "\n" + `{"query_type": }`, "query: stdin: invalid JSON at byte 46: invalid character '}' looking for beginning of value"},
+		{[]string{"-"}, `{"query_type": "device_list"} {"query_type": "x"`, "query: stdin: invalid JSON after byte 29: unexpected EOF"},
+		{[]string{"-"}, `{"query_type": "device_list"}` + "\n" + `{"query_type": "x", "parms": {}}`, `query: stdin: request 2 at byte 29: expected an object with query_type and params: json: unknown field "parms"`},
+		{[]string{"-"}, `["device_list"]`, "query: stdin: request 1 at byte 0: expected an object"},
+		{[]string{"-"}, " \n", "query: stdin: no requests"},
+		{[]string{file}, "", "query: " + file + ": request 2 at byte 29: query_type is required"},
+		{[]string{filepath.Join(t.TempDir(), "missing")}, "", "no such file or directory"},
+		{nil, "", "query: expected - to read the requests from stdin, or a file"},
+		{[]string{"-", "extra"}, "", `query: unexpected argument "extra"`},
+	}
+	for _, tt := range tests {
+		_, err := parseQuerySource(tt.args, strings.NewReader(tt.stdin), io.Discard)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("query %v with %q: %v, want %q", tt.args, tt.stdin, err, tt.want)
+		}
+	}
+}
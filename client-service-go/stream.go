@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// statusStream announces a result too large for one NATS message, sent in chunks
+	statusStream         = "stream"
+	defaultStreamTimeout = time.Minute
+)
+
+// streamInfo is the stream field of a response whose status is "stream": the reader sends
+// the result in chunks on a subject of its choosing instead of in the response. The
+// contract with the reader:
+//
+//	response: {"status": "stream", "request_id": "...", "stream": {"subject": "_INBOX.abc"}}
+//	chunks:   {"seq": 0, "data": [...]}, {"seq": 1, "data": [...]}, ... on the subject
+//	end:      {"end": true, "total": 2, "summary": ...} on the subject
+//
+// Chunks may arrive in any order, the end marker too; their data lists are joined in seq
+// order, from 0, into the data of the result once the end marker arrived and as many chunks
+// as its total, the number of chunks sent. When the
+// response message has a reply subject, the client publishes an empty message to it once
+// it is subscribed, and the reader should wait for that before sending chunks.
+type streamInfo struct {
+	Subject string `json:"subject"`
+}
+
+// streamChunk is a message of a stream: a chunk of the data, or the end marker.
+type streamChunk struct {
+	Seq     *int              `json:"seq"`
+	Data    []json.RawMessage `json:"data"`
+	End     bool              `json:"end"`
+	Total   *int              `json:"total"`
+	Summary interface{}       `json:"summary"`
+	Status  string            `json:"status"` // "error" when the reader gives up midway, with a message
+	Message string            `json:"message"`
+}
+
+// Collects the chunks of the stream announced by the response msg until its end marker and
+// the total of chunks it counts arrived, within c.streamTimeout, and puts their data and
+// summary into ex's response. A stream that breaks off, or whose chunks do not add up, is a
+// decode error.
+func (c *client) collectStream(ex *exchange, msg *nats.Msg) error {
+	info := ex.response.Stream
+	if info == nil || info.Subject == "" {
+		return decodeErrorf("Response to %s has status stream but no stream subject", ex.request.QueryType)
+	}
+	sub, err := c.nc.SubscribeSync(info.Subject)
+	if err != nil {
+		return fmt.Errorf("Subscribing to the stream of %s on '%s': %w", ex.request.QueryType, info.Subject, err)
+	}
+	defer sub.Unsubscribe()
+	if msg.Reply != "" {
+		if err := msg.Respond(nil); err != nil {
+			return fmt.Errorf("Telling the reader to start the stream of %s: %w", ex.request.QueryType, err)
+		}
+	}
+	logger.verbosef("Collecting the stream of %s (request %s) on '%s'", ex.request.QueryType, ex.request.RequestID, info.Subject)
+
+	ctx, cancel := context.WithTimeout(c.ctx, c.streamTimeout)
+	defer cancel()
+	chunks := map[int][]json.RawMessage{}
+	var end *streamChunk // The end marker, once it arrived
+	for {
+		if end != nil && len(chunks) >= *end.Total {
+			data, err := joinChunks(chunks, end.Total)
+			if err != nil {
+				return decodeErrorf("Stream of %s: %v", ex.request.QueryType, err)
+			}
+			ex.response.Status, ex.response.Data, ex.response.Stream = "success", data, nil
+			if end.Summary != nil {
+				ex.response.Summary = end.Summary
+			}
+			logger.verbosef("Stream of %s (request %s) complete: %d chunk(s), %d item(s)", ex.request.QueryType, ex.request.RequestID, len(chunks), len(data))
+			return nil
+		}
+		m, err := sub.NextMsgWithContext(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			if end != nil {
+				return decodeErrorf("Stream of %s truncated: %d of the %d chunk(s) of the end marker received within %s (--stream-timeout)", ex.request.QueryType, len(chunks), *end.Total, c.streamTimeout)
+			}
+			return decodeErrorf("Stream of %s truncated: no end marker within %s (--stream-timeout), %d chunk(s) received", ex.request.QueryType, c.streamTimeout, len(chunks))
+		}
+		if c.ctx.Err() != nil {
+			return fmt.Errorf("Query %s aborted: %w", ex.request.QueryType, c.ctx.Err())
+		}
+		if err != nil {
+			return fmt.Errorf("Reading the stream of %s: %w", ex.request.QueryType, err)
+		}
+		var chunk streamChunk
+		if err := json.Unmarshal(m.Data, &chunk); err != nil {
+			return decodeErrorf("Stream of %s: chunk %d: %v", ex.request.QueryType, len(chunks), err)
+		}
+		switch {
+		case chunk.Status == "error":
+			ex.response.Status, ex.response.Message, ex.response.Stream = chunk.Status, chunk.Message, nil
+			return nil
+		case chunk.End && end != nil:
+			return decodeErrorf("Stream of %s: end marker received twice", ex.request.QueryType)
+		case chunk.End && (chunk.Total == nil || *chunk.Total < 0):
+			return decodeErrorf("Stream of %s: end marker without a total of 0 or more", ex.request.QueryType)
+		case chunk.End:
+			// Chunks sent before it may still be on their way
+			end = &chunk
+		case chunk.Seq == nil || *chunk.Seq < 0:
+			return decodeErrorf("Stream of %s: chunk without a seq of 0 or more", ex.request.QueryType)
+		default:
+			if _, dup := chunks[*chunk.Seq]; dup {
+				return decodeErrorf("Stream of %s: chunk %d received twice", ex.request.QueryType, *chunk.Seq)
+			}
+			chunks[*chunk.Seq] = chunk.Data
+		}
+	}
+}
+
+// Joins the data of the chunks in seq order, checking that they are the total announced
+// by the end marker, numbered from 0 without gaps
+func joinChunks(chunks map[int][]json.RawMessage, total *int) ([]interface{}, error) {
+	if total == nil {
+		return nil, errors.New("end marker without a total")
+	}
+	seqs := make([]int, 0, len(chunks))
+	for seq := range chunks {
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	for i, seq := range seqs {
+		if seq != i {
+			return nil, fmt.Errorf("chunk %d missing", i)
+		}
+	}
+	if len(seqs) != *total {
+		return nil, fmt.Errorf("%d chunk(s) received, the end marker counts %d", len(seqs), *total)
+	}
+	data := []interface{}{}
+	for _, seq := range seqs {
+		for _, raw := range chunks[seq] {
+			var item interface{}
+			if err := json.Unmarshal(raw, &item); err != nil {
+				return nil, fmt.Errorf("chunk %d: %v", seq, err)
+			}
+			data = append(data, item)
+		}
+	}
+	return data, nil
+}
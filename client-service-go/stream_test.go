@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// streamingReader answers every query with a stream response and, once the client is
+// subscribed, sends the messages of script on the stream subject in their order
+func streamingReader(t *testing.T, s *fakeNATS, script []string) {
+	t.Helper()
+	nc := connectFake(t, s)
+	_, err := nc.Subscribe(natsSubjectRequest, func(m *nats.Msg) {
+		var request ReaderRequest
+		_ = json.Unmarshal(m.Data, &request)
+		streamSubject, startSubject := nats.NewInbox(), nats.NewInbox()
+		start, err := nc.SubscribeSync(startSubject)
+		if err != nil {
+			t.Errorf("streaming reader: %v", err)
+			return
+		}
+		defer start.Unsubscribe()
+		response, _ := json.Marshal(map[string]interface{}{
+			"status": statusStream, "request_id": request.RequestID, "stream": map[string]string{"subject": streamSubject},
+		})
+		if err := nc.PublishRequest(m.Reply, startSubject, response); err != nil {
+			t.Errorf("streaming reader: %v", err)
+			return
+		}
+		if _, err := start.NextMsg(time.Second); err != nil {
+			t.Errorf("streaming reader: the client never asked for the stream: %v", err)
+			return
+		}
+		for _, chunk := range script {
+			_ = nc.Publish(streamSubject, []byte(chunk))
+		}
+	})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+}
+
+func TestCollectStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		script      []string
+		wantData    []interface{}
+		wantSummary interface{}
+		wantErr     string // Part of the decode error, "" for a successful stream
+		wantStatus  string
+	}{
+		{
+			name:        "in order",
+			script:      []string{`{"seq":0,"data":[1,2]}`, `{"seq":1,"data":[3]}`, `{"seq":2,"data":[4]}`, `{"end":true,"total":3,"summary":{"n":4}}`},
+			wantData:    []interface{}{1.0, 2.0, 3.0, 4.0},
+			wantSummary: map[string]interface{}{"n": 4.0},
+		},
+		{
+			name:     "out of order",
+			script:   []string{`{"seq":2,"data":[4]}`, `{"seq":0,"data":[1,2]}`, `{"seq":1,"data":[3]}`, `{"end":true,"total":3}`},
+			wantData: []interface{}{1.0, 2.0, 3.0, 4.0},
+		},
+		{
+			name:     "end marker before the last chunks",
+			script:   []string{`{"seq":1,"data":[3]}`, `{"end":true,"total":3}`, `{"seq":2,"data":[4]}`, `{"seq":0,"data":[1,2]}`},
+			wantData: []interface{}{1.0, 2.0, 3.0, 4.0},
+		},
+		{
+			name:     "empty",
+			script:   []string{`{"end":true,"total":0}`},
+			wantData: []interface{}{},
+		},
+		{
+			name:    "truncated without end marker",
+			script:  []string{`{"seq":0,"data":[1]}`},
+			wantErr: "no end marker within",
+		},
+		{
+			name:    "truncated after the end marker",
+			script:  []string{`{"seq":0,"data":[1]}`, `{"end":true,"total":2}`},
+			wantErr: "1 of the 2 chunk(s)",
+		},
+		{
+			name:    "gap",
+			script:  []string{`{"seq":0,"data":[1]}`, `{"seq":2,"data":[3]}`, `{"end":true,"total":2}`},
+			wantErr: "chunk 1 missing",
+		},
+		{
+			name:    "more chunks than counted",
+			script:  []string{`{"seq":0,"data":[1]}`, `{"seq":1,"data":[2]}`, `{"seq":2,"data":[3]}`, `{"end":true,"total":2}`},
+			wantErr: "3 chunk(s) received, the end marker counts 2",
+		},
+		{
+			name:    "chunk twice",
+			script:  []string{`{"seq":0,"data":[1]}`, `{"seq":0,"data":[1]}`, `{"end":true,"total":1}`},
+			wantErr: "chunk 0 received twice",
+		},
+		{
+			name:    "end marker without total",
+			script:  []string{`{"end":true}`},
+			wantErr: "end marker without a total",
+		},
+		{
+			name:       "reader gives up",
+			script:     []string{`{"seq":0,"data":[1]}`, `{"status":"error","message":"query failed midway"}`},
+			wantStatus: "error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := startFakeNATS(t)
+			streamingReader(t, s, tt.script)
+			c := newTestClient(t, s)
+			c.streamTimeout = 200 * time.Millisecond
+
+			ex, err := c.queryPage(ReaderRequest{QueryType: "device_list", Params: map[string]interface{}{}}, 0)
+			if tt.wantErr != "" {
+				if classifyFailure(err) != failureDecodeError || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("queryPage = %v, want a decode error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("queryPage: %v", err)
+			}
+			if tt.wantStatus != "" {
+				if ex.response.Status != tt.wantStatus || ex.response.Message == "" {
+					t.Fatalf("response %+v, want status %s with a message", ex.response, tt.wantStatus)
+				}
+				return
+			}
+			if ex.response.Status != "success" || ex.response.Stream != nil {
+				t.Fatalf("response %+v, want a collected success", ex.response)
+			}
+			if !reflect.DeepEqual(ex.response.Data, tt.wantData) {
+				t.Errorf("data %v, want %v", ex.response.Data, tt.wantData)
+			}
+			if !reflect.DeepEqual(ex.response.Summary, tt.wantSummary) {
+				t.Errorf("summary %v, want %v", ex.response.Summary, tt.wantSummary)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Criticality range of the events published by the daemon
+const (
+	minCriticality = 1
+	maxCriticality = 10
+)
+
+// subcommand runs a single query whose parameters come from typed flags, e.g.
+// "client health --device StorageArray". define registers the flags on fs and returns the
+// function building the request from them once parsed.
+type subcommand struct {
+	name        string
+	description string
+	define      func(fs *flag.FlagSet) func() (ReaderRequest, error)
+}
+
+// subcommands lists the subcommands of the client. The query subcommands share their
+// name and description with the interactive mode commands.
+var subcommands = []subcommand{
+	{name: "alerts", define: defineAlerts},
+	{name: "health", define: defineHealth},
+	{name: "anomaly", define: defineAnomaly},
+	{name: "summary", define: defineSummary},
+	{name: "events", define: defineEvents},
+	{name: "raw", description: "any query given as JSON", define: defineRaw},
+}
+
+func init() {
+	for i, sc := range subcommands {
+		if cmd, ok := findCommand(sc.name); ok {
+			subcommands[i].description = cmd.description
+		}
+	}
+}
+
+func defineAlerts(fs *flag.FlagSet) func() (ReaderRequest, error) {
+	since := fs.Duration("since", 15*time.Minute, "how far back to look, in whole minutes")
+	minCrit := fs.Int("min-criticality", 8, fmt.Sprintf("lowest criticality reported, %d to %d", minCriticality, maxCriticality))
+	return func() (ReaderRequest, error) {
+		var problems []error
+		sinceMinutes, err := wholeMinutes("--since", *since)
+		problems = appendProblem(problems, err)
+		if *minCrit < minCriticality || *minCrit > maxCriticality {
+			problems = append(problems, fmt.Errorf("--min-criticality %d: must be between %d and %d", *minCrit, minCriticality, maxCriticality))
+		}
+		return ReaderRequest{
+			QueryType: "alerts_critical",
+			Params:    map[string]interface{}{"since_minutes": sinceMinutes, "min_criticality": *minCrit},
+		}, errors.Join(problems...)
+	}
+}
+
+func defineHealth(fs *flag.FlagSet) func() (ReaderRequest, error) {
+	device := fs.String("device", "", "device to report on (required unless --all)")
+	all := fs.Bool("all", false, "report on every device of the reader's device_list, worst health first")
+	maxDevices := fs.Int("max-devices", defaultMaxDevices, "with --all, fail rather than query more devices than this")
+	return func() (ReaderRequest, error) {
+		switch {
+		case *all && *device != "":
+			return ReaderRequest{}, errors.New("--all: cannot be combined with --device")
+		case *all && *maxDevices < 1:
+			return ReaderRequest{}, fmt.Errorf("--max-devices %d: must be at least 1", *maxDevices)
+		case *all:
+			return ReaderRequest{
+				QueryType: fleetHealthQuery,
+				Params:    map[string]interface{}{fleetMaxDevicesParam: *maxDevices},
+			}, nil
+		case *device == "":
+			return ReaderRequest{}, errors.New("--device: is required")
+		}
+		return ReaderRequest{
+			QueryType: "device_health",
+			Params:    map[string]interface{}{"source_device": *device},
+		}, nil
+	}
+}
+
+func defineAnomaly(fs *flag.FlagSet) func() (ReaderRequest, error) {
+	device := fs.String("device", "", "device whose temperature readings are checked (required)")
+	threshold := fs.Float64("threshold", 1.3, "deviation from the mean, in standard deviations, that counts as an anomaly")
+	window := fs.Duration("window", 20*time.Minute, "readings considered, in whole minutes")
+	return func() (ReaderRequest, error) {
+		var problems []error
+		if *device == "" {
+			problems = append(problems, errors.New("--device: is required"))
+		}
+		if *threshold <= 0 {
+			problems = append(problems, fmt.Errorf("--threshold %g: must be positive", *threshold))
+		}
+		windowMinutes, err := wholeMinutes("--window", *window)
+		problems = appendProblem(problems, err)
+		return ReaderRequest{
+			QueryType: "anomaly_temperature",
+			Params: map[string]interface{}{
+				"source_device":  *device,
+				"threshold":      *threshold,
+				"window_minutes": windowMinutes,
+			},
+		}, errors.Join(problems...)
+	}
+}
+
+func defineSummary(fs *flag.FlagSet) func() (ReaderRequest, error) {
+	device := fs.String("device", "", "device whose metric is summed up (required)")
+	metric := fs.String("metric", "", "metric type, e.g. DiskTemp (required)")
+	window := fs.Duration("window", time.Hour, "samples considered, in whole minutes")
+	return func() (ReaderRequest, error) {
+		var problems []error
+		if *device == "" {
+			problems = append(problems, errors.New("--device: is required"))
+		}
+		if *metric == "" {
+			problems = append(problems, errors.New("--metric: is required"))
+		}
+		windowMinutes, err := wholeMinutes("--window", *window)
+		problems = appendProblem(problems, err)
+		return ReaderRequest{
+			QueryType: "metric_summary",
+			Params: map[string]interface{}{
+				"source_device":  *device,
+				"metric_type":    *metric,
+				"window_minutes": windowMinutes,
+			},
+		}, errors.Join(problems...)
+	}
+}
+
+func defineEvents(fs *flag.FlagSet) func() (ReaderRequest, error) {
+	since := fs.Duration("since", 24*time.Hour, "how far back to count, in whole minutes")
+	device := fs.String("device", "", "count only the events of this device")
+	return func() (ReaderRequest, error) {
+		sinceMinutes, err := wholeMinutes("--since", *since)
+		if err != nil {
+			return ReaderRequest{}, err
+		}
+		params := map[string]interface{}{"since_minutes": sinceMinutes}
+		if *device != "" {
+			params["source_device"] = *device
+		}
+		return ReaderRequest{QueryType: "events_by_type", Params: params}, nil
+	}
+}
+
+func defineRaw(fs *flag.FlagSet) func() (ReaderRequest, error) {
+	raw := fs.String("json", "", `request to send as is, e.g. '{"query_type": "device_health", "params": {"source_device": "StorageArray"}}' (required)`)
+	return func() (ReaderRequest, error) {
+		if *raw == "" {
+			return ReaderRequest{}, errors.New("--json: is required")
+		}
+		request, err := decodeRawRequest([]byte(*raw))
+		if err != nil {
+			return ReaderRequest{}, fmt.Errorf("--json: %w", err)
+		}
+		return request, nil
+	}
+}
+
+// Decodes a request given as JSON, rejecting unknown fields and a missing query type
+func decodeRawRequest(data []byte) (ReaderRequest, error) {
+	var request ReaderRequest
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		return ReaderRequest{}, fmt.Errorf("expected an object with query_type and params: %v", err)
+	}
+	if request.QueryType == "" {
+		return ReaderRequest{}, errors.New("query_type is required")
+	}
+	if request.Params == nil {
+		request.Params = map[string]interface{}{}
+	}
+	return request, nil
+}
+
+// Converts a duration flag to the whole minutes the reader expects
+func wholeMinutes(flagName string, d time.Duration) (int, error) {
+	if d < time.Minute || d%time.Minute != 0 {
+		return 0, fmt.Errorf("%s %s: must be a positive whole number of minutes, e.g. 15m", flagName, d)
+	}
+	return int(d / time.Minute), nil
+}
+
+// Parses the subcommand and its flags in args, e.g. ["alerts", "--since", "30m"], into the
+// request it stands for. Flag syntax errors and -h are reported on stderr by the flag
+// package and returned as errUsageReported and flag.ErrHelp.
+func parseSubcommand(args []string, stderr io.Writer) (ReaderRequest, error) {
+	sc, ok := findSubcommand(args[0])
+	if !ok {
+		return ReaderRequest{}, fmt.Errorf("unknown subcommand %q, expected one of %s", args[0], strings.Join(subcommandNames(), ", "))
+	}
+	fs := flag.NewFlagSet("client "+sc.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	build := sc.define(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: client [global flags] %s [flags]\n\nRuns a single query: %s.\n\nFlags:\n", sc.name, sc.description)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ReaderRequest{}, err
+		}
+		return ReaderRequest{}, errUsageReported
+	}
+	if fs.NArg() > 0 {
+		return ReaderRequest{}, fmt.Errorf("%s: unexpected argument %q, parameters are given as flags", sc.name, fs.Arg(0))
+	}
+	request, err := build()
+	if err == nil {
+		return request, nil
+	}
+	// Name the subcommand on every line of joined problems
+	problems := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		problems = joined.Unwrap()
+	}
+	for i, problem := range problems {
+		problems[i] = fmt.Errorf("%s: %w", sc.name, problem)
+	}
+	return ReaderRequest{}, errors.Join(problems...)
+}
+
+func findSubcommand(name string) (subcommand, bool) {
+	for _, sc := range subcommands {
+		if sc.name == name {
+			return sc, true
+		}
+	}
+	return subcommand{}, false
+}
+
+func subcommandNames() []string {
+	names := make([]string, 0, len(subcommands))
+	for _, sc := range subcommands {
+		names = append(names, sc.name)
+	}
+	return append(names, ackSubcommand, benchSubcommand, checkSubcommand, diffSubcommand, listSavedSubcommand, querySubcommand, replaySubcommand, runSubcommand, scheduleSubcommand)
+}
+
+// Prints the global usage of the client, listing its subcommands
+func printUsage(fs *flag.FlagSet, out io.Writer) {
+	fmt.Fprintf(out, "Usage: client [global flags] [subcommand [flags]]\n\n")
+	fmt.Fprintf(out, "Without a subcommand the client runs the default queries, those of --queries or the\n--query one, or the interactive mode. Subcommands, see client <subcommand> -h:\n")
+	for _, sc := range subcommands {
+		fmt.Fprintf(out, "  %-10s %s\n", sc.name, sc.description)
+	}
+	fmt.Fprintf(out, "  %-10s %s\n", ackSubcommand, ackDescription)
+	fmt.Fprintf(out, "  %-10s %s\n", benchSubcommand, benchDescription)
+	fmt.Fprintf(out, "  %-10s %s\n", checkSubcommand, checkDescription)
+	fmt.Fprintf(out, "  %-10s %s\n", diffSubcommand, diffDescription)
+	fmt.Fprintf(out, "  %-10s %s\n", listSavedSubcommand, listSavedDescription)
+	fmt.Fprintf(out, "  %-10s %s\n", querySubcommand, queryDescription)
+	fmt.Fprintf(out, "  %-10s %s\n", replaySubcommand, replayDescription)
+	fmt.Fprintf(out, "  %-10s %s\n", runSubcommand, runDescription)
+	fmt.Fprintf(out, "  %-10s %s\n", scheduleSubcommand, scheduleDescription)
+	fmt.Fprintf(out, "\nGlobal flags:\n")
+	fs.PrintDefaults()
+}
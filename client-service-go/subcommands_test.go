@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSubcommandParams(t *testing.T) {
+	tests := []struct {
+		args []string
+		want ReaderRequest
+	}{
+		{[]string{"alerts"}, ReaderRequest{QueryType: "alerts_critical", Params: map[string]interface{}{"since_minutes": 15, "min_criticality": 8}}},
+		{[]string{"alerts", "--since", "2h", "--min-criticality", "10"}, ReaderRequest{QueryType: "alerts_critical", Params: map[string]interface{}{"since_minutes": 120, "min_criticality": 10}}},
+		{[]string{"health", "--device", "StorageArray-0001"}, ReaderRequest{QueryType: "device_health", Params: map[string]interface{}{"source_device": "StorageArray-0001"}}},
+		{[]string{"health", "--all", "--max-devices", "50"}, ReaderRequest{QueryType: fleetHealthQuery, Params: map[string]interface{}{fleetMaxDevicesParam: 50}}},
+		{[]string{"anomaly", "--device", "DiskUnit-0002", "--threshold", "2", "--window", "45m"}, ReaderRequest{QueryType: "anomaly_temperature", Params: map[string]interface{}{"source_device": "DiskUnit-0002", "threshold": 2.0, "window_minutes": 45}}},
+		{[]string{"summary", "--device", "DiskUnit-0002", "--metric", "IOPs"}, ReaderRequest{QueryType: "metric_summary", Params: map[string]interface{}{"source_device": "DiskUnit-0002", "metric_type": "IOPs", "window_minutes": 60}}},
+		{[]string{"events"}, ReaderRequest{QueryType: "events_by_type", Params: map[string]interface{}{"since_minutes": 1440}}},
+		{[]string{"events", "--since", "30m", "--device", "CloudStorage-0001"}, ReaderRequest{QueryType: "events_by_type", Params: map[string]interface{}{"since_minutes": 30, "source_device": "CloudStorage-0001"}}},
+		{[]string{"raw", "--json", `{"query_type": "device_list"}`}, ReaderRequest{QueryType: "device_list", Params: map[string]interface{}{}}},
+		{[]string{"raw", "--json", `{"query_type": "device_health", "params": {"source_device": "x"}}`}, ReaderRequest{QueryType: "device_health", Params: map[string]interface{}{"source_device": "x"}}},
+	}
+	for _, tt := range tests {
+		got, err := parseSubcommand(tt.args, io.Discard)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSubcommand(%q) = %+v, %v, want %+v", tt.args, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseSubcommandRejects(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string // Every problem reported
+	}{
+		{[]string{"fleet"}, []string{`unknown subcommand "fleet", expected one of alerts, health`}},
+		{[]string{"alerts", "--since", "90s", "--min-criticality", "11"}, []string{"alerts: --since 1m30s: must be a positive whole number of minutes", "alerts: --min-criticality 11: must be between 1 and 10"}},
+		{[]string{"health"}, []string{"health: --device: is required"}},
+		{[]string{"health", "--all", "--device", "x"}, []string{"health: --all: cannot be combined with --device"}},
+		{[]string{"health", "--all", "--max-devices", "0"}, []string{"health: --max-devices 0: must be at least 1"}},
+		{[]string{"anomaly", "--threshold", "0"}, []string{"anomaly: --device: is required", "anomaly: --threshold 0: must be positive"}},
+		{[]string{"summary", "--window", "0s"}, []string{"summary: --device: is required", "summary: --metric: is required", "summary: --window 0s"}},
+		{[]string{"events", "StorageArray"}, []string{`events: unexpected argument "StorageArray", parameters are given as flags`}},
+		{[]string{"raw"}, []string{"raw: --json: is required"}},
+		{[]string{"raw", "--json", `{"query": "device_list"}`}, []string{"raw: --json: expected an object with query_type and params"}},
+		{[]string{"raw", "--json", `{"params": {}}`}, []string{"raw: --json: query_type is required"}},
+	}
+	for _, tt := range tests {
+		_, err := parseSubcommand(tt.args, io.Discard)
+		if err == nil {
+			t.Errorf("parseSubcommand(%q) accepted the command line", tt.args)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("parseSubcommand(%q) = %v, want it to report %q", tt.args, err, want)
+			}
+		}
+	}
+
+	if _, err := parseSubcommand([]string{"alerts", "--since", "soon"}, io.Discard); !errors.Is(err, errUsageReported) {
+		t.Errorf("unparsable flag = %v, want %v", err, errUsageReported)
+	}
+}
+
+func TestSubcommandUsage(t *testing.T) {
+	for _, sc := range subcommands {
+		var usage strings.Builder
+		if _, err := parseSubcommand([]string{sc.name, "-h"}, &usage); !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("%s -h = %v, want %v", sc.name, err, flag.ErrHelp)
+		}
+		if sc.description == "" || !strings.Contains(usage.String(), "Usage: client [global flags] "+sc.name+" [flags]") || !strings.Contains(usage.String(), sc.description) {
+			t.Errorf("%s usage does not name the subcommand and its description %q:\n%s", sc.name, sc.description, usage.String())
+		}
+	}
+
+	var usage strings.Builder
+	if _, err := parseOptions([]string{"-h"}, &usage); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("-h = %v", err)
+	}
+	for _, name := range subcommandNames() {
+		if !strings.Contains(usage.String(), "\n  "+name+" ") {
+			t.Errorf("global usage does not list %s", name)
+		}
+	}
+}
+
+func TestSubcommandGivesTheQuery(t *testing.T) {
+	o, err := parseTestOptions(t, nil, "--timeout", "2s", "summary", "--device", "DiskUnit-0002", "--metric", "DiskTemp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.subcommand != "summary" || len(o.queries) != 1 || o.queries[0].request.QueryType != "metric_summary" {
+		t.Errorf("subcommand %q runs %+v, want the one metric_summary query", o.subcommand, o.queries)
+	}
+	if _, err := parseTestOptions(t, nil, "--query", "device_list", "alerts"); err == nil || !strings.Contains(err.Error(), "alerts: cannot be combined with --query") {
+		t.Errorf("subcommand with --query = %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	tableColumnGap     = 2 // Spaces between the columns of formatTable
+	minTruncatedColumn = 8 // Narrowest a column is truncated to, ellipsis included
+	truncationEllipsis = "…"
+)
+
+// keyTableColumns are never truncated: they identify the row, or rank it.
+var keyTableColumns = []string{"device", "source_device", "criticality", "event_id"}
+
+// tableLayout picks the columns of the tables and CSV results the client renders and fits
+// tables into the terminal.
+type tableLayout struct {
+	columns []string   // Columns to show, in this order; nil for all of them
+	width   func() int // Width to fit tables into, 0 for any; nil never truncates
+}
+
+// Selects and orders the columns of a result as set by --columns. A result without any of
+// them keeps all its columns, so that one list serves several query types.
+func (l tableLayout) selectColumns(columns []string, rows [][]string) ([]string, [][]string) {
+	if len(l.columns) == 0 {
+		return columns, rows
+	}
+	var picked []int
+	for _, name := range l.columns {
+		if i := slices.Index(columns, name); i >= 0 {
+			picked = append(picked, i)
+		}
+	}
+	if len(picked) == 0 {
+		return columns, rows
+	}
+	selected := make([]string, len(picked))
+	for j, i := range picked {
+		selected[j] = columns[i]
+	}
+	selectedRows := make([][]string, len(rows))
+	for r, row := range rows {
+		selectedRows[r] = make([]string, len(picked))
+		for j, i := range picked {
+			selectedRows[r][j] = row[i]
+		}
+	}
+	return selected, selectedRows
+}
+
+// Truncates the cells of a table, ending them with an ellipsis, so that formatTable renders
+// it within the terminal's width. Key columns keep their cells whole; the others are capped
+// at one width, the widest shrinking first, down to minTruncatedColumn.
+func (l tableLayout) fit(columns []string, rows [][]string) ([]string, [][]string) {
+	if l.width == nil {
+		return columns, rows
+	}
+	width := l.width()
+	if width <= 0 || len(columns) == 0 {
+		return columns, rows
+	}
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = utf8.RuneCountInString(column)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	available := width - tableColumnGap*(len(columns)-1)
+	var flexible []int
+	for i, column := range columns {
+		if slices.Contains(keyTableColumns, column) {
+			available -= widths[i]
+		} else {
+			flexible = append(flexible, i)
+		}
+	}
+	limit := capWidth(widths, flexible, available)
+	if limit < 0 {
+		return columns, rows
+	}
+
+	truncated := make([]string, len(columns))
+	for i, column := range columns {
+		truncated[i] = column
+		if slices.Contains(flexible, i) {
+			truncated[i] = truncateCell(column, limit)
+		}
+	}
+	truncatedRows := make([][]string, len(rows))
+	for r, row := range rows {
+		truncatedRows[r] = slices.Clone(row)
+		for _, i := range flexible {
+			truncatedRows[r][i] = truncateCell(row[i], limit)
+		}
+	}
+	return truncated, truncatedRows
+}
+
+// Returns the width to cap the flexible columns at so that they fit into available, the
+// widest possible, or -1 when they fit as they are. The cap is never below
+// minTruncatedColumn, so a narrow terminal gets a table that still wraps but stays legible.
+func capWidth(widths []int, flexible []int, available int) int {
+	total := 0
+	sorted := make([]int, 0, len(flexible))
+	for _, i := range flexible {
+		total += widths[i]
+		sorted = append(sorted, widths[i])
+	}
+	if total <= available || len(sorted) == 0 {
+		return -1
+	}
+	// Lower the cap from the widest column down: at a cap between two widths, the columns
+	// at least as wide as the cap take the cap each and the others their width
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	narrower := total
+	for n, w := range sorted {
+		narrower -= w
+		// n+1 columns at the cap, the rest at their widths
+		limit := (available - narrower) / (n + 1)
+		next := 0
+		if n+1 < len(sorted) {
+			next = sorted[n+1]
+		}
+		if limit >= next {
+			return max(min(limit, w), minTruncatedColumn)
+		}
+	}
+	return minTruncatedColumn
+}
+
+// Shortens s to limit runes, the last of them an ellipsis
+func truncateCell(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:limit-1]) + truncationEllipsis
+}
+
+// Parses the comma-separated column names of --columns
+func parseColumns(s string) []string {
+	var columns []string
+	for _, column := range strings.Split(s, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// Returns the width of the terminal f is, or 0 when it is none. COLUMNS, when set, wins, as
+// it does for other tools.
+func terminalWidth(f *os.File) int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return windowWidth(f)
+}
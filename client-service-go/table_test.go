@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The layout of a table at a few terminal widths: key columns stay whole, the others shrink
+// from the widest down, and a table that fits, or has no width to fit, is left alone
+func TestTableFitGolden(t *testing.T) {
+	ex := typedFixture(t, "alerts_critical")
+	for _, width := range []int{0, 60, 110, 120, 160} {
+		t.Run(fmt.Sprint(width), func(t *testing.T) {
+			c := &client{output: outputTable, times: &timeFormatter{}, table: tableLayout{width: func() int { return width }}}
+			if width == 0 {
+				c.table.width = nil // Not a terminal
+			}
+			got := c.formatResponse(ex)
+			checkGolden(t, filepath.Join("format", fmt.Sprintf("alerts_width_%d.table", width)), got)
+			for _, key := range []string{"6f1c2a9e-0d4b-4c1e-9a55-0b8e4f3e7a01", "StorageArray-0001", "criticality"} {
+				if !strings.Contains(got, key) {
+					t.Errorf("key cell %q truncated at width %d", key, width)
+				}
+			}
+		})
+	}
+
+	c := &client{output: outputTable, times: &timeFormatter{}, table: tableLayout{
+		columns: []string{"source_device", "criticality", "event_message"},
+		width:   func() int { return 60 },
+	}}
+	checkGolden(t, filepath.Join("format", "alerts_columns_width_60.table"), c.formatResponse(ex))
+}
+
+func TestSelectColumns(t *testing.T) {
+	columns := []string{"a", "b", "c"}
+	rows := [][]string{{"a1", "b1", "c1"}, {"a2", "b2", "c2"}}
+	tests := []struct {
+		selected    []string
+		wantColumns []string
+		wantRows    [][]string
+	}{
+		{nil, columns, rows},
+		{[]string{"c", "a"}, []string{"c", "a"}, [][]string{{"c1", "a1"}, {"c2", "a2"}}},
+		{[]string{"x", "b", "y"}, []string{"b"}, [][]string{{"b1"}, {"b2"}}},
+		{[]string{"x", "y"}, columns, rows}, // None of them: all kept
+	}
+	for _, tt := range tests {
+		gotColumns, gotRows := tableLayout{columns: tt.selected}.selectColumns(columns, rows)
+		if !reflect.DeepEqual(gotColumns, tt.wantColumns) || !reflect.DeepEqual(gotRows, tt.wantRows) {
+			t.Errorf("select %v = %v %v, want %v %v", tt.selected, gotColumns, gotRows, tt.wantColumns, tt.wantRows)
+		}
+	}
+}
+
+func TestCapWidth(t *testing.T) {
+	tests := []struct {
+		widths    []int
+		available int
+		want      int
+	}{
+		{[]int{10, 20}, 30, -1},
+		{[]int{10, 20}, 25, 15},           // Only the widest shrinks
+		{[]int{10, 20, 30}, 36, 13},       // The two widest at the cap
+		{[]int{10, 20, 30}, 10, 8},        // Never below minTruncatedColumn
+		{[]int{12, 12}, 20, 10},           // Equal widths share the room
+		{[]int{40, 9, 9}, 40, 22},         // 22 + 9 + 9
+		{[]int{}, 0, -1},                  // No flexible column
+		{[]int{100, 5}, -20, 8},           // Keys alone overflow
+		{[]int{minTruncatedColumn}, 1, 8}, // Already at the minimum
+	}
+	for _, tt := range tests {
+		flexible := make([]int, len(tt.widths))
+		for i := range flexible {
+			flexible[i] = i
+		}
+		if got := capWidth(tt.widths, flexible, tt.available); got != tt.want {
+			t.Errorf("capWidth(%v, %d) = %d, want %d", tt.widths, tt.available, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateCell(t *testing.T) {
+	for _, tt := range []struct {
+		s     string
+		limit int
+		want  string
+	}{
+		{"checksum mismatch", 20, "checksum mismatch"},
+		{"checksum mismatch", 17, "checksum mismatch"},
+		{"checksum mismatch", 10, "checksum …"},
+		{"température élevée", 8, "tempéra…"}, // Counted in runes, not bytes
+	} {
+		if got := truncateCell(tt.s, tt.limit); got != tt.want {
+			t.Errorf("truncateCell(%q, %d) = %q, want %q", tt.s, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	for s, want := range map[string][]string{
+		"":                                     nil,
+		" , ":                                  nil,
+		"source_device":                        {"source_device"},
+		"criticality, source_device,,event_id": {"criticality", "source_device", "event_id"},
+	} {
+		if got := parseColumns(s); !reflect.DeepEqual(got, want) {
+			t.Errorf("parseColumns(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+// Tables written to a file are never truncated, whatever the width of the terminal
+func TestTableToFileIsNotTruncated(t *testing.T) {
+	ex := responseFixture(t, "alerts_critical")
+	s := startFakeNATS(t)
+	fakeReader(t, s, natsSubjectRequest, func(request ReaderRequest) ReaderResponse {
+		response := ex.response
+		response.RequestID = request.RequestID
+		return response
+	})
+	t.Setenv("COLUMNS", "40")
+	out := filepath.Join(t.TempDir(), "results")
+	if code := runClient(t, nil, "--nats-url", s.url(), "--output", "table", "--out", out, "--query", "alerts_critical"); code != exitOK {
+		t.Fatalf("run exited %d", code)
+	}
+	if written := readFile(t, out); !strings.Contains(written, `login from 10.0.0.7, "svc-backup"`) || strings.Contains(written, truncationEllipsis) {
+		t.Errorf("table written to a file:\n%s\nwant its cells whole", written)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Params of a queries file entry may refer to the environment and to the time of sending:
+//
+//	params:
+//	  source_device: ${DEVICE}
+//	  window_minutes: ${WINDOW:-20}
+//	  since: "{{now-15m}}"
+//
+// ${NAME} is replaced when the file is loaded, ${NAME:-default} falling back to default when
+// NAME is unset; a value that is a single reference takes the type of the variable's value,
+// so WINDOW=20 gives the number 20. {{now}}, {{now-15m}} and {{now+1h}} are replaced with
+// that time in RFC 3339 each time the query is sent.
+var (
+	envReference      = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+	templateReference = regexp.MustCompile(`\{\{([^}]*)\}\}`)
+)
+
+// Replaces the environment references in the params, recursing into lists and mappings, and
+// checks their templates. Undefined variables are added to missing rather than failing, so
+// that every one of them can be reported. Returns whether the params hold templates.
+func expandParams(params map[string]interface{}, lookup func(string) (string, bool), missing map[string]bool) (map[string]interface{}, bool, error) {
+	expanded, templated, err := expandValue(params, lookup, missing)
+	if err != nil {
+		return nil, false, err
+	}
+	return expanded.(map[string]interface{}), templated, nil
+}
+
+func expandValue(v interface{}, lookup func(string) (string, bool), missing map[string]bool) (interface{}, bool, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(v))
+		templated := false
+		for key, value := range v {
+			value, t, err := expandValue(value, lookup, missing)
+			if err != nil {
+				return nil, false, fmt.Errorf("%s: %w", key, err)
+			}
+			expanded[key], templated = value, templated || t
+		}
+		return expanded, templated, nil
+	case []interface{}:
+		expanded := make([]interface{}, len(v))
+		templated := false
+		for i, value := range v {
+			value, t, err := expandValue(value, lookup, missing)
+			if err != nil {
+				return nil, false, fmt.Errorf("[%d]: %w", i, err)
+			}
+			expanded[i], templated = value, templated || t
+		}
+		return expanded, templated, nil
+	case string:
+		return expandString(v, lookup, missing)
+	}
+	return v, false, nil
+}
+
+func expandString(s string, lookup func(string) (string, bool), missing map[string]bool) (interface{}, bool, error) {
+	expanded := expandEnvReferences(s, lookup, missing)
+	for _, m := range templateReference.FindAllStringSubmatch(expanded, -1) {
+		if _, err := parseNowTemplate(m[1]); err != nil {
+			return nil, false, err
+		}
+	}
+	templated := templateReference.MatchString(expanded)
+	// A single reference takes the type of its value, e.g. a number for a window
+	if !templated && expanded != "" && envReference.FindString(s) == s {
+		var typed interface{}
+		if err := yaml.Unmarshal([]byte(expanded), &typed); err == nil {
+			switch typed.(type) {
+			case int, float64, bool:
+				return typed, false, nil
+			}
+		}
+	}
+	return expanded, templated, nil
+}
+
+// Replaces the ${VAR} and ${VAR:-default} references in s, adding undefined variables
+// without a default to missing
+func expandEnvReferences(s string, lookup func(string) (string, bool), missing map[string]bool) string {
+	return envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envReference.FindStringSubmatch(ref)
+		if value, ok := lookup(m[1]); ok {
+			return value
+		}
+		if strings.Contains(ref, ":-") {
+			return m[2]
+		}
+		missing[m[1]] = true
+		return ""
+	})
+}
+
+// Parses the expression of a {{...}} template: now, optionally followed by a signed Go
+// duration. Returns the offset from now.
+func parseNowTemplate(expr string) (time.Duration, error) {
+	expr = strings.TrimSpace(expr)
+	rest, ok := strings.CutPrefix(expr, "now")
+	if ok && rest == "" {
+		return 0, nil
+	}
+	if ok && (rest[0] == '-' || rest[0] == '+') {
+		if d, err := time.ParseDuration(rest); err == nil {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("{{%s}}: unknown template, expected {{now}}, {{now-15m}} or {{now+1h}}", expr)
+}
+
+// Returns a copy of the params with their templates rendered at now
+func renderParams(params map[string]interface{}, now time.Time) map[string]interface{} {
+	return renderValue(params, now).(map[string]interface{})
+}
+
+func renderValue(v interface{}, now time.Time) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			rendered[key] = renderValue(value, now)
+		}
+		return rendered
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, value := range v {
+			rendered[i] = renderValue(value, now)
+		}
+		return rendered
+	case string:
+		return templateReference.ReplaceAllStringFunc(v, func(ref string) string {
+			// Checked when the file was loaded
+			offset, _ := parseNowTemplate(templateReference.FindStringSubmatch(ref)[1])
+			return now.Add(offset).UTC().Format(time.RFC3339)
+		})
+	}
+	return v
+}
+
+// Returns the sorted names of the missing variables
+func missingNames(missing map[string]bool) []string {
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
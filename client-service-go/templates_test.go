@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envOf looks variables up in env
+func envOf(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestExpandParams(t *testing.T) {
+	env := envOf(map[string]string{"DEVICE": "DiskUnit-0002", "WINDOW": "30", "THRESHOLD": "1.5", "STRICT": "true", "EMPTY": ""})
+	tests := []struct {
+		value         interface{}
+		want          interface{}
+		wantTemplated bool
+	}{
+		{"${DEVICE}", "DiskUnit-0002", false},
+		{"pool/${DEVICE}/${EMPTY}", "pool/DiskUnit-0002/", false},
+		{"${WINDOW}", 30, false}, // A single reference takes the type of its value
+		{"${THRESHOLD}", 1.5, false},
+		{"${STRICT}", true, false},
+		{"${WINDOW}m", "30m", false},
+		{"${UNSET:-20}", 20, false},
+		{"${UNSET:-}", "", false},
+		{"${EMPTY:-fallback}", "", false}, // Set, even if empty
+		{"$DEVICE", "$DEVICE", false},
+		{[]interface{}{"${DEVICE}", 3}, []interface{}{"DiskUnit-0002", 3}, false},
+		{map[string]interface{}{"since": "{{now-15m}}"}, map[string]interface{}{"since": "{{now-15m}}"}, true},
+		{"${DEVICE} since {{ now-1h }}", "DiskUnit-0002 since {{ now-1h }}", true},
+	}
+	for _, tt := range tests {
+		missing := map[string]bool{}
+		got, templated, err := expandParams(map[string]interface{}{"p": tt.value}, env, missing)
+		if err != nil || len(missing) != 0 {
+			t.Errorf("expand %v: error %v, missing %v", tt.value, err, missing)
+			continue
+		}
+		if !reflect.DeepEqual(got["p"], tt.want) || templated != tt.wantTemplated {
+			t.Errorf("expand %v = %#v (templated %t), want %#v (%t)", tt.value, got["p"], templated, tt.want, tt.wantTemplated)
+		}
+	}
+
+	if _, _, err := expandParams(map[string]interface{}{"window": []interface{}{"{{yesterday}}"}}, env, map[string]bool{}); err == nil || err.Error() != "window: [0]: {{yesterday}}: unknown template, expected {{now}}, {{now-15m}} or {{now+1h}}" {
+		t.Errorf("unknown template: %v, want it named with its path", err)
+	}
+}
+
+func TestParseNowTemplate(t *testing.T) {
+	for expr, want := range map[string]time.Duration{"now": 0, " now ": 0, "now-15m": -15 * time.Minute, "now+1h30m": 90 * time.Minute, "now-7d": 0} {
+		got, err := parseNowTemplate(expr)
+		if expr == "now-7d" { // Go durations have no days
+			if err == nil {
+				t.Errorf("parseNowTemplate(%q) accepted", expr)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("parseNowTemplate(%q) = %s, %v, want %s", expr, got, err, want)
+		}
+	}
+	for _, expr := range []string{"", "today", "now-", "now-15", "now*2", "now - 15m", "nowish"} {
+		if _, err := parseNowTemplate(expr); err == nil {
+			t.Errorf("parseNowTemplate(%q) accepted", expr)
+		}
+	}
+}
+
+// Templates are rendered each time the query is sent, in UTC, leaving the loaded query alone
+func TestRequestAtRendersTemplates(t *testing.T) {
+	queries, err := parseQueries([]byte("- query_type: events_by_type\n  params: {since: '{{now-15m}}', until: '{{now}}', tags: ['after {{now+1h}}'], limit: 5}\n- query_type: device_list\n"), noEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !queries[0].templated || queries[1].templated {
+		t.Fatalf("templated %t and %t, want only the first query", queries[0].templated, queries[1].templated)
+	}
+	at := time.Date(2025, 3, 30, 1, 10, 0, 0, time.FixedZone("CET", 3600))
+	request := queries[0].requestAt(at)
+	want := map[string]interface{}{"since": "2025-03-29T23:55:00Z", "until": "2025-03-30T00:10:00Z", "tags": []interface{}{"after 2025-03-30T01:10:00Z"}, "limit": 5}
+	if !reflect.DeepEqual(request.Params, want) {
+		t.Errorf("rendered %v, want %v", request.Params, want)
+	}
+	if later := queries[0].requestAt(at.Add(time.Minute)); later.Params["until"] != "2025-03-30T00:11:00Z" {
+		t.Errorf("rendered a minute later as %v", later.Params["until"])
+	}
+	if queries[0].request.Params["since"] != "{{now-15m}}" {
+		t.Errorf("loaded query changed to %v", queries[0].request.Params)
+	}
+}
+
+// Every undefined variable of the file is reported at once, before any query is sent
+func TestUndefinedVariablesFailBeforeSending(t *testing.T) {
+	file := "- query_type: device_health\n  params: {source_device: '${DEVICE}'}\n" +
+		"- query_type: metric_summary\n  params: {source_device: '${DEVICE}', metric_type: '${METRIC}', window_minutes: '${WINDOW:-60}'}\n" +
+		"- query_type: device_list\n  params: {pool: '${A_POOL}'}\n"
+	_, err := parseQueries([]byte(file), envOf(map[string]string{"METRIC": "DiskTemp"}))
+	if err == nil || !strings.Contains(err.Error(), "undefined environment variable(s): A_POOL, DEVICE") {
+		t.Errorf("parseQueries = %v, want both missing names, sorted", err)
+	}
+
+	s := startFakeNATS(t)
+	requests := fakeReader(t, s, natsSubjectRequest, pagedDeviceReader(nil, 10))
+	path := filepath.Join(t.TempDir(), "queries.yaml")
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code := runClient(t, nil, "--nats-url", s.url(), "--queries", path); code != exitUsage {
+		t.Errorf("run with undefined variables exited %d, want %d", code, exitUsage)
+	}
+	if sent := requests(); len(sent) != 0 {
+		t.Errorf("sent %v despite the undefined variables", sent)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// Returns 0: the width of terminals is only known on Unix, elsewhere set COLUMNS
+func windowWidth(f *os.File) int {
+	return 0
+}
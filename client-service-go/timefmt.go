@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// timeFormats are the names --time-format takes besides Go layouts
+var timeFormats = map[string]string{
+	"rfc3339":  time.RFC3339,
+	"datetime": "2006-01-02 15:04:05 MST",
+	"short":    "Jan 2 15:04:05",
+}
+
+// timeFormatter renders the timestamps of results in the zone of --tz and the layout of
+// --time-format. Tables, watch headers and followed alerts are for people and always get
+// both; JSON, JSON lines and CSV keep their raw values unless --tz is given, and then get
+// RFC 3339 in that zone, still readable by programs. Safe for concurrent use.
+type timeFormatter struct {
+	loc     *time.Location // nil keeps the zone of each timestamp
+	layout  string         // Of human output, "" for RFC 3339
+	machine bool           // Whether JSON and CSV results are converted too: --tz was given
+
+	unparseable atomic.Int64 // Timestamps left as they were
+}
+
+// Parses --tz, an IANA zone name such as Europe/Berlin, "local" or "UTC", and --time-format,
+// a name of timeFormats or a Go layout; both "" leave timestamps alone
+func newTimeFormatter(tz, format string) (*timeFormatter, error) {
+	f := &timeFormatter{}
+	var problems []error
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if strings.EqualFold(tz, "local") {
+			loc, err = time.Local, nil
+		}
+		if err != nil {
+			problems = append(problems, fmt.Errorf("--tz %q: expected an IANA zone name such as Europe/Berlin, local or UTC", tz))
+		}
+		f.loc, f.machine = loc, err == nil
+	}
+	if format != "" {
+		f.layout = format
+		if layout, ok := timeFormats[strings.ToLower(format)]; ok {
+			f.layout = layout
+		} else if reference := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC); reference.Format(format) == format {
+			// A layout without any of the reference time's elements prints itself
+			problems = append(problems, fmt.Errorf("--time-format %q: expected rfc3339, datetime, short or a Go layout such as \"2006-01-02 15:04\"", format))
+		}
+	}
+	return f, errors.Join(problems...)
+}
+
+// Reports whether the formatter changes anything
+func (f *timeFormatter) enabled() bool {
+	return f != nil && (f.loc != nil || f.layout != "")
+}
+
+// Renders t for people, e.g. in watch headers
+func (f *timeFormatter) formatTime(t time.Time) string {
+	if f == nil {
+		return t.Format(time.RFC3339)
+	}
+	if f.loc != nil {
+		t = t.In(f.loc)
+	}
+	if f.layout == "" {
+		return t.Format(time.RFC3339)
+	}
+	return t.Format(f.layout)
+}
+
+// Renders a timestamp of a result for people, or returns it as it is, counted, when it is
+// not RFC 3339
+func (f *timeFormatter) human(s string) string {
+	if !f.enabled() || s == "" {
+		return s
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		f.unparseable.Add(1)
+		return s
+	}
+	return f.formatTime(t)
+}
+
+// Renders a timestamp of a result for programs, RFC 3339 in the zone of --tz
+func (f *timeFormatter) machineValue(s string) string {
+	if f == nil || !f.machine || s == "" {
+		return s
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		f.unparseable.Add(1)
+		return s
+	}
+	return t.In(f.loc).Format(time.RFC3339Nano)
+}
+
+// Returns the rows with the cells of timestamp columns rendered by format
+func (f *timeFormatter) cells(columns []string, rows [][]string, format func(string) string) [][]string {
+	var timeColumns []int
+	for i, column := range columns {
+		if isTimeField(column) {
+			timeColumns = append(timeColumns, i)
+		}
+	}
+	if len(timeColumns) == 0 {
+		return rows
+	}
+	formatted := make([][]string, len(rows))
+	for r, row := range rows {
+		formatted[r] = append([]string(nil), row...)
+		for _, i := range timeColumns {
+			formatted[r][i] = format(row[i])
+		}
+	}
+	return formatted
+}
+
+// Returns the rows of a table with their timestamps rendered for people
+func (f *timeFormatter) humanCells(columns []string, rows [][]string) [][]string {
+	if !f.enabled() {
+		return rows
+	}
+	return f.cells(columns, rows, f.human)
+}
+
+// Returns the rows of a CSV result with their timestamps in the zone of --tz
+func (f *timeFormatter) machineCells(columns []string, rows [][]string) [][]string {
+	if f == nil || !f.machine {
+		return rows
+	}
+	return f.cells(columns, rows, f.machineValue)
+}
+
+// Returns a copy of response data with the strings of timestamp fields in the zone of --tz,
+// for JSON results; data is returned as it is without --tz
+func (f *timeFormatter) machineData(data interface{}) interface{} {
+	if f == nil || !f.machine {
+		return data
+	}
+	return f.convert("", data)
+}
+
+func (f *timeFormatter) convert(key string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			converted[k] = f.convert(k, item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = f.convert(key, item)
+		}
+		return converted
+	case string:
+		if isTimeField(key) {
+			return f.machineValue(v)
+		}
+	}
+	return v
+}
+
+// Reports whether a field or column holds timestamps by its name: time, timestamp, or
+// ending in _time or _at, the last part of dotted column names counting
+func isTimeField(name string) bool {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ToLower(name)
+	return name == "time" || name == "timestamp" || strings.HasSuffix(name, "_time") || strings.HasSuffix(name, "_at")
+}
+
+// Logs how many timestamps could not be parsed and were left as they were, if any
+func (f *timeFormatter) report() {
+	if f == nil {
+		return
+	}
+	if n := f.unparseable.Load(); n > 0 {
+		logger.infof("%d timestamp(s) were not RFC 3339 and were left as they were", n)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Berlin's clocks skip from 02:00 to 03:00 on 30 March 2025 and fall back from 03:00 to
+// 02:00 on 26 October 2025: the offset follows each instant, not the day
+func TestTimeFormatterAcrossDST(t *testing.T) {
+	f, err := newTimeFormatter("Europe/Berlin", "datetime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		utc, human, machine string
+	}{
+		{"2025-03-30T00:59:59Z", "2025-03-30 01:59:59 CET", "2025-03-30T01:59:59+01:00"},
+		{"2025-03-30T01:00:00Z", "2025-03-30 03:00:00 CEST", "2025-03-30T03:00:00+02:00"},
+		{"2025-10-26T00:30:00Z", "2025-10-26 02:30:00 CEST", "2025-10-26T02:30:00+02:00"},
+		{"2025-10-26T01:30:00Z", "2025-10-26 02:30:00 CET", "2025-10-26T02:30:00+01:00"}, // The same wall time again
+		{"2025-10-26T03:30:00.250+02:00", "2025-10-26 02:30:00 CET", "2025-10-26T02:30:00.25+01:00"},
+	}
+	for _, tt := range tests {
+		if got := f.human(tt.utc); got != tt.human {
+			t.Errorf("human(%s) = %q, want %q", tt.utc, got, tt.human)
+		}
+		if got := f.machineValue(tt.utc); got != tt.machine {
+			t.Errorf("machineValue(%s) = %q, want %q", tt.utc, got, tt.machine)
+		}
+	}
+	if n := f.unparseable.Load(); n != 0 {
+		t.Errorf("counted %d unparseable timestamp(s)", n)
+	}
+}
+
+func TestNewTimeFormatterErrors(t *testing.T) {
+	for _, tz := range []string{"UTC", "local", "Local", "America/New_York"} {
+		if f, err := newTimeFormatter(tz, ""); err != nil || f.loc == nil || !f.machine {
+			t.Errorf("--tz %s: %+v, %v", tz, f, err)
+		}
+	}
+	_, err := newTimeFormatter("Mars/Olympus_Mons", "no layout")
+	for _, want := range []string{`--tz "Mars/Olympus_Mons": expected an IANA zone name`, `--time-format "no layout": expected rfc3339, datetime, short or a Go layout`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("newTimeFormatter error %v, want it to report %q", err, want)
+		}
+	}
+	if _, err := parseTestOptions(t, nil, "--tz", "Europe/Atlantis"); err == nil || !strings.Contains(err.Error(), `--tz "Europe/Atlantis"`) {
+		t.Errorf("parseOptions with an invalid zone: %v", err)
+	}
+}
+
+// Machine output keeps its values unless --tz is given; --time-format alone is for people
+func TestTimeFormatterMachineOutput(t *testing.T) {
+	data := map[string]interface{}{
+		"timestamp": "2025-01-01T10:00:00Z",
+		"events":    []interface{}{map[string]interface{}{"created_at": "2025-01-01T11:00:00Z", "message": "2025-01-01T11:00:00Z"}},
+	}
+	layoutOnly, err := newTimeFormatter("", "short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := layoutOnly.machineData(data); !reflect.DeepEqual(got, data) {
+		t.Errorf("--time-format alone changed JSON data to %v", got)
+	}
+	if got := layoutOnly.human("2025-01-01T10:00:00Z"); got != "Jan 1 10:00:00" {
+		t.Errorf("--time-format alone rendered %q for people", got)
+	}
+
+	f, err := newTimeFormatter("Asia/Tokyo", "short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"timestamp": "2025-01-01T19:00:00+09:00",
+		"events":    []interface{}{map[string]interface{}{"created_at": "2025-01-01T20:00:00+09:00", "message": "2025-01-01T11:00:00Z"}},
+	}
+	if got := f.machineData(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("machineData = %v, want %v", got, want)
+	}
+	if data["timestamp"] != "2025-01-01T10:00:00Z" {
+		t.Errorf("machineData changed its argument to %v", data)
+	}
+	columns := []string{"details.timestamp", "device", "last_seen_at"}
+	rows := [][]string{{"2025-01-01T10:00:00Z", "2025-01-01T10:00:00Z", ""}}
+	if got := f.machineCells(columns, rows); !reflect.DeepEqual(got, [][]string{{"2025-01-01T19:00:00+09:00", "2025-01-01T10:00:00Z", ""}}) {
+		t.Errorf("machineCells = %v", got)
+	}
+	if got := f.humanCells(columns, rows); !reflect.DeepEqual(got, [][]string{{"Jan 1 19:00:00", "2025-01-01T10:00:00Z", ""}}) {
+		t.Errorf("humanCells = %v", got)
+	}
+}
+
+// Timestamps that are not RFC 3339 pass through as they are, counted and reported once
+func TestUnparseableTimestamps(t *testing.T) {
+	f, err := newTimeFormatter("UTC", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"yesterday", "2025-01-01 10:00:00", "1735725600"} {
+		if got := f.human(s); got != s {
+			t.Errorf("human(%q) = %q", s, got)
+		}
+	}
+	if got := f.machineData(map[string]interface{}{"time": "soon", "device": "not a time"}); !reflect.DeepEqual(got, map[string]interface{}{"time": "soon", "device": "not a time"}) {
+		t.Errorf("machineData = %v", got)
+	}
+	if n := f.unparseable.Load(); n != 4 {
+		t.Errorf("counted %d unparseable timestamp(s), want 4", n)
+	}
+
+	log := captureLog(t)
+	f.report()
+	(&timeFormatter{}).report()
+	if got := log(); got != "4 timestamp(s) were not RFC 3339 and were left as they were\n" {
+		t.Errorf("reported %q", got)
+	}
+}
+
+func TestFormatTimeInWatchHeaders(t *testing.T) {
+	at := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	var none *timeFormatter
+	if got := none.formatTime(at); got != "2025-07-01T08:00:00Z" {
+		t.Errorf("formatTime without a formatter = %q", got)
+	}
+	f, err := newTimeFormatter("America/New_York", "2006-01-02 15:04 MST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.formatTime(at); got != "2025-07-01 04:00 EDT" {
+		t.Errorf("formatTime = %q", got)
+	}
+}
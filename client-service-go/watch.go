@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWatchFailureThreshold = 3
+	// Delay before polling again for a missing reader, doubled each time up to maxRetryBackoff
+	readerPollBackoff = time.Second
+)
+
+// watchStats counts the outcomes of one query across the iterations of watch mode.
+type watchStats struct {
+	successes   int
+	failures    int
+	consecutive int // Failures since the last success
+}
+
+// Re-runs the queries every interval until ctx is cancelled, printing each response under
+// a timestamped header. A query failing threshold times in a row is flagged with a banner,
+// and a summary of successes and failures per query is printed on exit. Failures are also
+// reported on stderr, and with fail-fast watching stops at the first of them. A query
+// aborted by cancelling ctx is left out of the results and stats. Returns the code of the
+// first failure, "" without any, and the write error that stopped watching, if any.
+func (c *client) runWatch(ctx context.Context, queries []plannedQuery, interval time.Duration, threshold int) (failureCode, error) {
+	out := c.out
+	// Headers, banners and the summary would break a stream of JSON lines
+	notes := io.Writer(out)
+	switch {
+	case !logger.enabled(levelNormal):
+		notes = io.Discard
+	case c.output == outputJSONL:
+		notes = os.Stderr
+	}
+	stats := make([]watchStats, len(queries))
+	var totals queryStats
+	defer func() {
+		printWatchSummary(notes, queries, stats, &totals)
+		if c.notifier != nil {
+			fmt.Fprintln(notes, c.notifier)
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for iteration := 1; ; iteration++ {
+		fmt.Fprintf(notes, "=== %s | iteration %d | every %s ===\n", c.times.formatTime(time.Now()), iteration, interval)
+		for i, q := range queries {
+			if out.Err() != nil {
+				return totals.failure, out.Err()
+			}
+			err := ctx.Err()
+			if err == nil {
+				err = c.watchQuery(q, &stats[i], &totals, threshold, out, notes)
+			}
+			if errors.Is(err, context.Canceled) {
+				fmt.Fprintf(notes, "Interrupted during iteration %d: %d of %d queries completed, %d aborted.\n", iteration, i, len(queries), len(queries)-i)
+				return totals.failure, out.Err()
+			}
+			if err != nil {
+				logger.errorf("Query %s failed: %v", q.request.QueryType, err)
+				if c.failFast {
+					logger.infof("Stopping watch after the first failure.")
+					return totals.failure, out.Err()
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return totals.failure, out.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Runs one query of an iteration, writing its result to out and the failure banner to
+// notes, updates its stats and the totals and returns why it failed, if it did. Without a
+// reader subscribed, the query is sent again with a growing delay until one is.
+func (c *client) watchQuery(q plannedQuery, stats *watchStats, totals *queryStats, threshold int, out, notes io.Writer) error {
+	result := c.forQuery(q).sendQuery(q.requestAt(time.Now()), q.timeout)
+	poll := retryPolicy{backoff: readerPollBackoff}
+	for attempt := 1; result.failure == failureNoResponders; attempt++ {
+		delay := poll.delay(attempt)
+		logger.infof("No reader available on '%s' for %s; polling again in %s", c.subject, q.request.QueryType, delay)
+		select {
+		case <-time.After(delay):
+		case <-c.ctx.Done():
+			return fmt.Errorf("Query %s aborted: %w", q.request.QueryType, c.ctx.Err())
+		}
+		result = c.forQuery(q).sendQuery(q.requestAt(time.Now()), q.timeout)
+		if result.failure != failureNoResponders {
+			logger.infof("Reader available on '%s' again", c.subject)
+		}
+	}
+	if errors.Is(result.err, context.Canceled) {
+		return result.err // Neither a result nor a failure
+	}
+	fmt.Fprintln(out, result.text)
+	totals.add(result.exchange, result.failure, result.answered)
+	c.exportCSV(result)
+	c.notifier.notify(c.ctx, c.webhook, result)
+
+	err := result.err
+	if err == nil {
+		stats.successes++
+		stats.consecutive = 0
+		return nil
+	}
+	stats.failures++
+	stats.consecutive++
+	if threshold > 0 && stats.consecutive >= threshold {
+		banner := strings.Repeat("!", 72)
+		fmt.Fprintf(notes, "%s\n!!! %s has failed %d time(s) in a row, last error: %v\n%s\n\n", banner, q.request.QueryType, stats.consecutive, err, banner)
+	}
+	return err
+}
+
+func printWatchSummary(out io.Writer, queries []plannedQuery, stats []watchStats, totals *queryStats) {
+	fmt.Fprintln(out, "=== Watch summary ===")
+	for i, q := range queries {
+		fmt.Fprintf(out, "%-25s %d succeeded, %d failed\n", q.request.QueryType, stats[i].successes, stats[i].failures)
+	}
+	fmt.Fprintln(out, totals)
+}
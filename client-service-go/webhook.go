@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWebhookTimeout  = 5 * time.Second
+	defaultWebhookAttempts = 3
+	webhookBackoff         = time.Second
+	// Header of the HMAC-SHA256 of the body with the secret, hex encoded: sha256=<hex>
+	webhookSignatureHeader = "X-Webhook-Signature"
+	maxWebhookTextBytes    = 3000 // Of the data rendered into the text field
+)
+
+// webhookTarget is where the results of watch and schedule runs are POSTed: --webhook-url,
+// or the webhook of a scheduled job.
+type webhookTarget struct {
+	url    string
+	secret string // Signs the body when set
+}
+
+// Checks that the URL is an absolute http or https URL
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q: expected an http or https URL", raw)
+	}
+	return nil
+}
+
+// Returns the host of the target, to name it in logs without the secret path of Slack URLs
+func (t *webhookTarget) host() string {
+	if u, err := url.Parse(t.url); err == nil {
+		return u.Host
+	}
+	return "webhook"
+}
+
+// webhookPayload is the body of a delivery: the result as in the jsonl format, with a text
+// field that Slack and compatible chats show as the message.
+type webhookPayload struct {
+	Text string `json:"text"`
+	jsonlRecord
+}
+
+// notifier delivers results to webhooks, retrying on server errors, and counts the
+// deliveries. Safe for concurrent use.
+type notifier struct {
+	http  *http.Client
+	retry retryPolicy
+
+	mu        sync.Mutex
+	delivered int
+	failed    int
+}
+
+func newNotifier(timeout time.Duration, attempts int) *notifier {
+	return &notifier{
+		http:  &http.Client{Timeout: timeout},
+		retry: retryPolicy{maxAttempts: attempts, backoff: webhookBackoff},
+	}
+}
+
+// Delivers the result of a query to the target, logging a failed delivery to stderr. A
+// failure is only counted: it never stops the run the result is from.
+func (n *notifier) notify(ctx context.Context, target *webhookTarget, result queryResult) {
+	if n == nil || target == nil {
+		return
+	}
+	body, err := json.Marshal(newWebhookPayload(result))
+	if err == nil {
+		err = n.deliver(ctx, target, body)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		n.failed++
+		logger.errorf("Webhook delivery of %s (request %s) to %s failed: %v", result.exchange.request.QueryType, result.exchange.request.RequestID, target.host(), err)
+		return
+	}
+	n.delivered++
+	logger.verbosef("Delivered %s (request %s) to %s", result.exchange.request.QueryType, result.exchange.request.RequestID, target.host())
+}
+
+// POSTs the body until the target accepts it or the attempts are used up. Connection
+// errors, 429 and 5xx answers are retried; other answers are final.
+func (n *notifier) deliver(ctx context.Context, target *webhookTarget, body []byte) error {
+	for attempt := 1; ; attempt++ {
+		retryable, err := n.post(ctx, target, body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= n.retry.maxAttempts {
+			return fmt.Errorf("attempt %d of %d: %w", attempt, n.retry.maxAttempts, err)
+		}
+		select {
+		case <-time.After(n.retry.delay(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (n *notifier) post(ctx context.Context, target *webhookTarget, body []byte) (retryable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if target.secret != "" {
+		req.Header.Set(webhookSignatureHeader, signWebhook(target.secret, body))
+	}
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return !errors.Is(err, context.Canceled), err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retryable, fmt.Errorf("%s answered %s", target.host(), resp.Status)
+}
+
+// Returns the signature header value of the body: sha256= and the hex HMAC-SHA256 of the
+// body with the secret, which receivers compute likewise to check it
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookPayload(result queryResult) webhookPayload {
+	ex := result.exchange
+	payload := webhookPayload{jsonlRecord: newJSONLRecord(ex, result.queryErr())}
+	if payload.Error != nil {
+		payload.Text = fmt.Sprintf("%s failed (%s): %s", ex.request.QueryType, payload.Error.Code, payload.Error.Message)
+		return payload
+	}
+	data := formatData(ex.response.Data, outputTable)
+	if len(data) > maxWebhookTextBytes {
+		data = data[:maxWebhookTextBytes] + "\n..."
+	}
+	payload.Text = fmt.Sprintf("%s succeeded (request %s)\n```\n%s\n```", ex.request.QueryType, ex.request.RequestID, data)
+	return payload
+}
+
+// Returns the summary line of the deliveries, e.g. "Webhook deliveries: 5 succeeded, 1 failed"
+func (n *notifier) String() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return fmt.Sprintf("Webhook deliveries: %d succeeded, %d failed", n.delivered, n.failed)
+}
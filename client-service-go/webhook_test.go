@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// webhookDelivery is a request a test webhook received
+type webhookDelivery struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookServer answers deliveries with the statuses in turn, then with 200, and returns
+// the deliveries received so far
+func webhookServer(t *testing.T, statuses ...int) (*httptest.Server, func() []webhookDelivery) {
+	t.Helper()
+	var mu sync.Mutex
+	var deliveries []webhookDelivery
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		status := http.StatusOK
+		if len(deliveries) < len(statuses) {
+			status = statuses[len(deliveries)]
+		}
+		deliveries = append(deliveries, webhookDelivery{r.Header.Clone(), body})
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []webhookDelivery {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]webhookDelivery(nil), deliveries...)
+	}
+}
+
+func testNotifier(attempts int) *notifier {
+	n := newNotifier(time.Second, attempts)
+	n.retry.backoff = 10 * time.Millisecond
+	return n
+}
+
+var deviceListResult = queryResult{
+	exchange: exchange{request: ReaderRequest{QueryType: "device_list", RequestID: "req-1"}, response: ReaderResponse{Status: "success", Data: []interface{}{"dev-01", "dev-02"}}},
+	answered: true,
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	server, deliveries := webhookServer(t)
+	n := testNotifier(3)
+	n.notify(context.Background(), &webhookTarget{url: server.URL + "/hooks/T000/B000"}, deviceListResult)
+	failed := queryResult{
+		exchange: exchange{request: ReaderRequest{QueryType: "device_health", RequestID: "req-2"}, attempts: 2},
+		err:      fmt.Errorf("Query device_health timed out: %w", nats.ErrTimeout),
+		failure:  failureTimeout,
+	}
+	n.notify(context.Background(), &webhookTarget{url: server.URL}, failed)
+	n.notify(context.Background(), nil, deviceListResult) // No target: nothing sent
+
+	got := deliveries()
+	if len(got) != 2 {
+		t.Fatalf("received %d deliveries, want 2", len(got))
+	}
+	var payload struct {
+		Text      string        `json:"text"`
+		QueryType string        `json:"query_type"`
+		RequestID string        `json:"request_id"`
+		Status    string        `json:"status"`
+		Data      []string      `json:"data"`
+		Error     *queryFailure `json:"error"`
+	}
+	if err := json.Unmarshal(got[0].body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.QueryType != "device_list" || payload.RequestID != "req-1" || payload.Status != "success" || len(payload.Data) != 2 ||
+		!strings.HasPrefix(payload.Text, "device_list succeeded (request req-1)\n```\n") || !strings.Contains(payload.Text, "dev-02") {
+		t.Errorf("payload %+v, want the result with its table as text", payload)
+	}
+	if got[0].header.Get("Content-Type") != "application/json" || got[0].header.Get(webhookSignatureHeader) != "" {
+		t.Errorf("headers %v, want JSON without a signature", got[0].header)
+	}
+	payload.Data, payload.Error = nil, nil
+	if err := json.Unmarshal(got[1].body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Error == nil || payload.Error.Code != failureTimeout || payload.Text != "device_health failed (timeout): Query device_health timed out: nats: timeout" || payload.Data != nil {
+		t.Errorf("payload of a failure %+v (error %+v)", payload, payload.Error)
+	}
+	if n.String() != "Webhook deliveries: 2 succeeded, 0 failed" {
+		t.Errorf("summary %q", n)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		statuses      []int
+		wantSent      int
+		wantDelivered bool
+	}{
+		{"server errors", []int{503, 500}, 3, true},
+		{"rate limited", []int{429}, 2, true},
+		{"attempts used up", []int{502, 502, 502, 502}, 3, false},
+		{"rejected", []int{400}, 1, false},
+		{"not found", []int{404}, 1, false},
+	}
+	for _, tt := range tests {
+		server, deliveries := webhookServer(t, tt.statuses...)
+		n := testNotifier(3)
+		n.notify(context.Background(), &webhookTarget{url: server.URL}, deviceListResult)
+		want := "Webhook deliveries: 0 succeeded, 1 failed"
+		if tt.wantDelivered {
+			want = "Webhook deliveries: 1 succeeded, 0 failed"
+		}
+		if sent := len(deliveries()); sent != tt.wantSent || n.String() != want {
+			t.Errorf("%s: sent %d time(s), %s; want %d and %q", tt.name, sent, n, tt.wantSent, want)
+		}
+	}
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+	n := newNotifier(50*time.Millisecond, 1)
+	err := n.deliver(context.Background(), &webhookTarget{url: server.URL}, []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "attempt 1 of 1") || !strings.Contains(err.Error(), "Timeout") {
+		t.Errorf("deliver to a slow webhook = %v, want a timeout", err)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	// The well-known HMAC-SHA256 of the quick brown fox with the key "key"
+	if got := signWebhook("key", []byte("The quick brown fox jumps over the lazy dog")); got != "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8" {
+		t.Errorf("signature %s", got)
+	}
+
+	server, deliveries := webhookServer(t)
+	n := testNotifier(1)
+	n.notify(context.Background(), &webhookTarget{url: server.URL, secret: "s3cret"}, deviceListResult)
+	got := deliveries()
+	if len(got) != 1 {
+		t.Fatalf("received %d deliveries, want 1", len(got))
+	}
+	// As a receiver checks it
+	signature := got[0].header.Get(webhookSignatureHeader)
+	if !hmac.Equal([]byte(signature), []byte(signWebhook("s3cret", got[0].body))) {
+		t.Errorf("signature %q does not match the body", signature)
+	}
+	if hmac.Equal([]byte(signature), []byte(signWebhook("other", got[0].body))) {
+		t.Error("signature matches another secret")
+	}
+}
+
+// A webhook that keeps failing is counted and summarized, and watching goes on
+func TestWebhookFailuresDoNotStopWatch(t *testing.T) {
+	var received atomic.Int64
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer hook.Close()
+	s := startFakeNATS(t)
+	fakeReader(t, s, natsSubjectRequest, pagedDeviceReader([]string{"dev-01"}, 10))
+	c := newTestClient(t, s)
+	c.output = outputTable
+	c.notifier, c.webhook = testNotifier(1), &webhookTarget{url: hook.URL}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.ctx = ctx
+	go func() {
+		for received.Load() < 3 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		cancel()
+	}()
+
+	if failure, err := c.runWatch(ctx, []plannedQuery{{request: ReaderRequest{QueryType: "device_list", Params: map[string]interface{}{}}, repeat: 1}}, 20*time.Millisecond, 3); failure != "" || err != nil {
+		t.Fatalf("runWatch = %q, %v", failure, err)
+	}
+	c.out.Close()
+	written := readFile(t, c.out.name)
+	results := strings.Count(written, "QueryType: device_list")
+	if results < 3 || !strings.Contains(written, fmt.Sprintf("Webhook deliveries: 0 succeeded, %d failed", results)) {
+		t.Errorf("watch wrote\n%s\nwant every result and the failed deliveries summarized", written)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backfill constants.
+const (
+	defaultBackfillRate      = 1000            // Default backfill messages per second across the fleet
+	backfillProgressInterval = 5 * time.Second // Time between backfill progress logs
+)
+
+// backfill synthesizes history on startup so dashboards are not empty: each device first
+// runs its cycles over the past duration at the configured interval, as fast as the rate
+// limit allows, and only then switches to real-time generation.
+type backfill struct {
+	duration time.Duration
+	limiter  *rateLimiter
+	cycles   atomic.Int64 // Backfill cycles done so far across the fleet
+	planned  atomic.Int64 // Backfill cycles of all devices that started backfilling
+	running  atomic.Int64 // Devices still backfilling
+	messages atomic.Uint64
+}
+
+// Returns the backfill of the given duration, nil when it is 0
+func newBackfill(duration time.Duration, rate int) *backfill {
+	if duration <= 0 {
+		return nil
+	}
+	return &backfill{duration: duration, limiter: newRateLimiter(rate)}
+}
+
+// Runs the device's cycles from the backfill duration ago up to now with past timestamps.
+// Returns early without error when ctx is cancelled.
+func (b *backfill) run(ctx context.Context, g *deviceGenerator) error {
+	end := time.Now()
+	start := end.Add(-b.duration)
+	interval := g.settings.interval
+	b.planned.Add(int64(b.duration / interval))
+	b.running.Add(1)
+	defer func() {
+		if b.running.Add(-1) == 0 {
+			log.Printf("Daemon: Backfill complete: published %d message(s) over %d cycle(s).", b.messages.Load(), b.cycles.Load())
+		}
+	}()
+
+	g.backfilling = true
+	defer func() { g.backfilling = false }()
+	for now := start; now.Before(end); now = now.Add(interval) {
+		sent := g.sent
+		if err := g.cycle(now); err != nil {
+			return err
+		}
+		b.cycles.Add(1)
+		b.messages.Add(uint64(g.sent - sent))
+		if err := b.limiter.wait(ctx, g.sent-sent); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Logs the backfill progress until every device is done or ctx is cancelled
+func (b *backfill) logProgress(ctx context.Context) error {
+	ticker := time.NewTicker(backfillProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if b.running.Load() == 0 {
+				return nil
+			}
+			log.Printf("Daemon: Backfill: %d of %d cycle(s) done (%.0f%%), %d message(s) published, %d device(s) still backfilling.",
+				b.cycles.Load(), b.planned.Load(), 100*float64(b.cycles.Load())/float64(max(b.planned.Load(), 1)), b.messages.Load(), b.running.Load())
+		}
+	}
+}
+
+// rateLimiter spaces out messages to a fixed rate shared by all callers.
+type rateLimiter struct {
+	mu    sync.Mutex
+	every time.Duration
+	next  time.Time // Earliest time of the next message
+}
+
+func newRateLimiter(perSecond int) *rateLimiter {
+	return &rateLimiter{every: time.Second / time.Duration(perSecond)}
+}
+
+// Accounts for n messages just sent and waits until the rate allows the next one.
+// Returns ctx.Err() when cancelled.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if n <= 0 {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(n) * l.every)
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"daemon-service-go/pkg/simulator"
+)
+
+// Capacity warning constants.
+const (
+	CapacityWarningEvent   = "CapacityWarning"
+	capacityWarningLevel   = 85.0 // CapacityUsed above which warnings become possible
+	capacityCriticalLevel  = 95.0 // CapacityUsed above which warnings are raised as critical
+	capacityWarningMaxRate = 0.5  // Per-cycle warning probability of a completely full device
+)
+
+// Returns a CapacityWarning event with a probability rising from 0 at 85% usage to
+// capacityWarningMaxRate at 100%, nil otherwise or before the first CapacityUsed sample
+func capacityWarning(dev *device, now time.Time, randGen *rand.Rand) *Event {
+	used, ok := dev.Value(simulator.CapacityUsed)
+	if !ok || used <= capacityWarningLevel {
+		return nil
+	}
+	fill := (used - capacityWarningLevel) / (100 - capacityWarningLevel)
+	if randGen.Float64() >= capacityWarningMaxRate*fill*fill {
+		return nil
+	}
+	criticality := 5
+	if used > capacityCriticalLevel {
+		criticality = 8
+	}
+	return newLifecycleEvent(dev, CapacityWarningEvent, criticality, now, fmt.Sprintf("Capacity used at %.1f%%", used))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"daemon-service-go/pkg/simulator"
+)
+
+// deviceAtCapacity returns a device whose last CapacityUsed sample is used
+func deviceAtCapacity(used float64) *device {
+	cfg := simulator.DefaultConfig()
+	cfg.Ranges.ByType[simulator.CapacityUsed] = ValueRange{Min: used, Max: used}
+	dev := newDevice("StorageArray-0001", "StorageArray")
+	simulator.New(cfg, time.Now, rand.New(rand.NewSource(1))).MetricOf(dev.Device, simulator.CapacityUsed)
+	return dev
+}
+
+func TestCapacityWarningRate(t *testing.T) {
+	const draws = 20000
+	tests := []struct {
+		used            float64
+		wantRate        float64
+		wantCriticality int
+	}{
+		{used: 50},
+		{used: 85},
+		{used: 90, wantRate: 0.5 / 9, wantCriticality: 5},
+		{used: 97, wantRate: 0.5 * 0.64, wantCriticality: 8},
+		{used: 100, wantRate: capacityWarningMaxRate, wantCriticality: 8},
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		dev := deviceAtCapacity(tt.used)
+		randGen := rand.New(rand.NewSource(7))
+		warnings := 0
+		for range draws {
+			event := capacityWarning(dev, now, randGen)
+			if event == nil {
+				continue
+			}
+			warnings++
+			if event.EventType != CapacityWarningEvent || event.Criticality != tt.wantCriticality || event.SourceDevice != dev.Name {
+				t.Fatalf("at %g%%: event %+v", tt.used, event)
+			}
+		}
+		if rate := float64(warnings) / draws; math.Abs(rate-tt.wantRate) > 0.01 {
+			t.Errorf("at %g%%: warning rate %.3f, want %.3f", tt.used, rate, tt.wantRate)
+		}
+	}
+	if capacityWarning(newDevice("StorageArray-0002", "StorageArray"), now, rand.New(rand.NewSource(7))) != nil {
+		t.Error("warning before the first CapacityUsed sample")
+	}
+}
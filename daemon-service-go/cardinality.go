@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// cardinalityProgressEvery is the number of device names between progress logs.
+const cardinalityProgressEvery = 10000
+
+// errCardinalityTestComplete is returned once every unique device name was used.
+var errCardinalityTestComplete = errors.New("cardinality test complete")
+
+// cardinalityTest hands out never-repeating device names to stress series cardinality
+// downstream: every generation cycle of every device reports under a fresh name, so the
+// fleet size and the generation interval set the rate of new names.
+type cardinalityTest struct {
+	limit uint64        // Unique device names to generate in total
+	next  atomic.Uint64 // Names handed out so far
+}
+
+// Returns nil when the stress mode is off
+func newCardinalityTest(limit int) *cardinalityTest {
+	if limit <= 0 {
+		return nil
+	}
+	return &cardinalityTest{limit: uint64(limit)}
+}
+
+// Renames the device to the next unique name, or returns errCardinalityTestComplete when
+// the names are used up
+func (c *cardinalityTest) rename(dev *device) error {
+	n := c.next.Add(1)
+	if n > c.limit {
+		return errCardinalityTestComplete
+	}
+	dev.Name = fmt.Sprintf("%s-card-%09d", dev.Type, n)
+	if n%cardinalityProgressEvery == 0 || n == c.limit {
+		log.Printf("Daemon: Cardinality test: %d of %d unique device name(s) generated", n, c.limit)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits of the fault-injection mode.
+const (
+	chaosHistorySize   = 32 // Number of recently published messages eligible for duplication
+	chaosMaxDelayTicks = 3  // Largest number of cycles a reordered message is held back
+)
+
+// chaosMessage is a published or held-back message kept by the chaos injector.
+type chaosMessage struct {
+	subject   string
+	msgID     string
+	data      []byte
+	counter   *atomic.Uint64 // Publish total to increment once a held message is finally sent
+	releaseAt int            // Cycle at which a held message is released
+}
+
+// chaosInjector deliberately misbehaves to exercise consumer dedup, ordering and validation
+// logic: it republishes earlier messages verbatim, holds messages back for a few cycles so
+// they arrive after newer ones and corrupts payloads. It is safe for concurrent use by the
+// device generators; the fault paths are serialized, which is acceptable for a test mode.
+type chaosInjector struct {
+	mu sync.Mutex
+
+	duplicateRate float64
+	reorderRate   float64
+	malformedRate float64
+	randGen       *rand.Rand
+	stats         *publishStats
+
+	cycle   int
+	history []chaosMessage // Ring buffer of recently published messages
+	next    int
+	held    []chaosMessage
+}
+
+// Returns nil when every chaos rate is zero, so the fault paths cost nothing by default
+func newChaosInjector(duplicateRate, reorderRate, malformedRate float64, stats *publishStats) *chaosInjector {
+	if duplicateRate <= 0 && reorderRate <= 0 && malformedRate <= 0 {
+		return nil
+	}
+	return &chaosInjector{
+		duplicateRate: duplicateRate,
+		reorderRate:   reorderRate,
+		malformedRate: malformedRate,
+		randGen:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		stats:         stats,
+	}
+}
+
+// Corrupts the payload with the malformed rate, otherwise returns it unchanged
+func (c *chaosInjector) corrupt(subject string, data []byte) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.randGen.Float64() >= c.malformedRate {
+		return data
+	}
+	corrupted, corruption := corruptPayload(data, c.randGen)
+	c.stats.chaosMalformed.Add(1)
+	log.Printf("Daemon: CHAOS: !!! MALFORMED PAYLOAD INJECTED !!! on '%s' (%s: %s)", subject, corruption.name, corruption.description)
+	return corrupted
+}
+
+// Decides whether to hold the message back; held messages are sent by tick later on
+func (c *chaosInjector) hold(subject, msgID string, data []byte, counter *atomic.Uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.randGen.Float64() >= c.reorderRate {
+		return false
+	}
+	delay := 1 + c.randGen.Intn(chaosMaxDelayTicks)
+	c.held = append(c.held, chaosMessage{subject: subject, msgID: msgID, data: data, counter: counter, releaseAt: c.cycle + delay})
+	c.stats.chaosReordered.Add(1)
+	log.Printf("Daemon: CHAOS: holding message on '%s' back for %d cycle(s) to reorder it", subject, delay)
+	return true
+}
+
+// Remembers a published message and, with the duplicate rate, republishes an earlier one
+// verbatim, message ID included, so JetStream drops duplicates within its window
+func (c *chaosInjector) published(send sendFunc, subject, msgID string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	msg := chaosMessage{subject: subject, msgID: msgID, data: data}
+	if len(c.history) < chaosHistorySize {
+		c.history = append(c.history, msg)
+	} else {
+		c.history[c.next] = msg
+		c.next = (c.next + 1) % chaosHistorySize
+	}
+
+	if c.randGen.Float64() >= c.duplicateRate {
+		return
+	}
+	dup := c.history[c.randGen.Intn(len(c.history))]
+	if err := send(dup.subject, dup.msgID, dup.data); err != nil {
+		log.Printf("Daemon: CHAOS: Error publishing duplicate on '%s': %v", dup.subject, err)
+		return
+	}
+	c.stats.chaosDuplicates.Add(1)
+	log.Printf("Daemon: CHAOS: published duplicate message on '%s'", dup.subject)
+}
+
+// Starts a new chaos cycle and sends the held messages that are due
+func (c *chaosInjector) tick(send sendFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cycle++
+	remaining := c.held[:0]
+	for _, msg := range c.held {
+		if msg.releaseAt > c.cycle {
+			remaining = append(remaining, msg)
+			continue
+		}
+		c.release(send, msg)
+	}
+	c.held = remaining
+}
+
+// Sends every held message regardless of its release cycle, used on shutdown
+func (c *chaosInjector) drain(send sendFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, msg := range c.held {
+		c.release(send, msg)
+	}
+	c.held = nil
+}
+
+func (c *chaosInjector) release(send sendFunc, msg chaosMessage) {
+	if err := send(msg.subject, msg.msgID, msg.data); err != nil {
+		log.Printf("Daemon: CHAOS: Error publishing reordered message on '%s': %v", msg.subject, err)
+		return
+	}
+	msg.counter.Add(1)
+	log.Printf("Daemon: CHAOS: published reordered message on '%s'", msg.subject)
+}
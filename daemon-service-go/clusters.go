@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// cluster is one NATS connection the daemon publishes to, with its own delivery counters.
+// Each connection reconnects on its own, so an outage of one cluster does not affect the others.
+type cluster struct {
+	url       string
+	nc        *nats.Conn
+	js        jetstream.JetStream // Set when publishing through JetStream, nil for core NATS
+	published atomic.Uint64
+	failed    atomic.Uint64
+	closing   atomic.Bool // Set when the daemon closes the connection itself
+}
+
+// Splits a comma-separated list of NATS URLs, dropping empty entries
+func parseNatsURLs(urls string) []string {
+	var list []string
+	for _, url := range strings.Split(urls, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			list = append(list, url)
+		}
+	}
+	return list
+}
+
+// Connection defaults.
+const (
+	defaultMaxReconnects  = nats.DefaultMaxReconnect  // Reconnect attempts before a connection is closed for good
+	defaultReconnectWait  = nats.DefaultReconnectWait // Pause between reconnect attempts to the same server
+	defaultConnectTimeout = nats.DefaultTimeout       // Deadline of a single connection attempt
+	reconnectLogSampling  = 10                        // Failed reconnect attempts per log line after the first one
+	jetStreamAckTimeout   = 2 * time.Second           // How long a JetStream publish waits for the stream's ack
+)
+
+// connectionConfig tunes how the daemon connects and reconnects to NATS.
+type connectionConfig struct {
+	MaxReconnects  int // -1 retries forever
+	ReconnectWait  time.Duration
+	ConnectTimeout time.Duration
+	JetStream      bool // Publish through JetStream and wait for the stream's ack instead of fire-and-forget
+}
+
+// Connects to every cluster. With several clusters an unreachable one is retried in the
+// background instead of failing startup, so that one datacenter cannot block the other.
+// onClosed is called once every connection was closed for good by NATS, which happens
+// when the reconnect attempts are used up; closes on shutdown do not count.
+func connectClusters(urls []string, cfg connectionConfig, onClosed func()) ([]*cluster, error) {
+	clusters := make([]*cluster, 0, len(urls))
+	var closed atomic.Int64
+	clusterClosed := func() {
+		if closed.Add(1) == int64(len(urls)) {
+			onClosed()
+		}
+	}
+	for _, url := range urls {
+		c := &cluster{url: url}
+		nc, err := nats.Connect(url, c.options(cfg, len(urls) > 1, clusterClosed)...)
+		if err != nil {
+			_ = closeClusters(clusters, 0)
+			return nil, fmt.Errorf("connecting to %s: %w (%s)", url, err, connectHint(err))
+		}
+		c.nc = nc
+		if cfg.JetStream {
+			if c.js, err = jetstream.New(nc); err != nil {
+				nc.Close()
+				_ = closeClusters(clusters, 0)
+				return nil, fmt.Errorf("creating JetStream context for %s: %w", url, err)
+			}
+		}
+		clusters = append(clusters, c)
+		if nc.IsConnected() {
+			log.Printf("Daemon Service (Go): Connected to NATS at %s", url)
+		} else {
+			log.Printf("Daemon Service (Go): NATS at %s is not reachable yet, retrying in the background", url)
+		}
+	}
+	return clusters, nil
+}
+
+// Returns the connection options of the cluster. Failed reconnect attempts are logged
+// sampled, the first one and then every reconnectLogSampling-th. onClosed is called when
+// NATS closes the connection for good rather than the daemon on shutdown.
+func (c *cluster) options(cfg connectionConfig, retryOnFailedConnect bool, onClosed func()) []nats.Option {
+	var attempts atomic.Int64 // Failed reconnect attempts since the last successful connection
+	limit := "unlimited"
+	if cfg.MaxReconnects >= 0 {
+		limit = strconv.Itoa(cfg.MaxReconnects)
+	}
+	opts := []nats.Option{
+		nats.Name("daemon-service-go"),
+		nats.MaxReconnects(cfg.MaxReconnects),
+		nats.ReconnectWait(cfg.ReconnectWait),
+		nats.Timeout(cfg.ConnectTimeout),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Printf("Daemon Service (Go): Disconnected from NATS at %s: %v", c.url, err)
+		}),
+		nats.ReconnectErrHandler(func(_ *nats.Conn, err error) {
+			if n := attempts.Add(1); n%reconnectLogSampling == 1 {
+				log.Printf("Daemon Service (Go): Reconnect attempt %d of %s to NATS at %s failed: %v", n, limit, c.url, err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Printf("Daemon Service (Go): Reconnected to NATS at %s (%s) after %d failed attempt(s)", c.url, nc.ConnectedUrl(), attempts.Swap(0))
+		}),
+		nats.ClosedHandler(func(_ *nats.Conn) {
+			if c.closing.Load() {
+				return
+			}
+			log.Printf("Daemon Service (Go): ERROR: NATS connection to %s closed for good after %d failed reconnect attempt(s)", c.url, attempts.Load())
+			onClosed()
+		}),
+	}
+	if retryOnFailedConnect {
+		opts = append(opts, nats.RetryOnFailedConnect(true))
+	}
+	return opts
+}
+
+// Returns the most likely causes of a failed connection attempt
+func connectHint(err error) string {
+	switch {
+	case errors.Is(err, nats.ErrNoServers):
+		return "is the NATS server running and the host and port right? Inside docker-compose use nats://nats:4222, from the host nats://localhost:4222; also check firewalls"
+	case errors.Is(err, nats.ErrAuthorization), errors.Is(err, nats.ErrAuthExpired):
+		return "the server rejected the credentials in the URL"
+	case errors.Is(err, nats.ErrSecureConnRequired), errors.Is(err, nats.ErrSecureConnWanted):
+		return "client and server disagree on TLS; use a tls:// URL or adjust the server's TLS settings"
+	default:
+		return "check the URL format nats://[user:password@]host:port and that the server is reachable"
+	}
+}
+
+// schemaVersionValue is the schema version header value shared by all messages, NATS only reads it.
+var schemaVersionValue = []string{strconv.Itoa(SchemaVersion)}
+
+// partialPublishError reports the clusters that failed a publish other clusters accepted.
+// Clusters closed for good are left out, nothing can be delivered to them anymore.
+type partialPublishError struct {
+	clusters []*cluster // The clusters to publish the message to again
+	err      error
+}
+
+func (e *partialPublishError) Error() string {
+	return fmt.Sprintf("%d cluster(s) failed while others accepted the message: %v", len(e.clusters), e.err)
+}
+
+func (e *partialPublishError) Unwrap() error {
+	return e.err
+}
+
+// Returns the send of a retry of a failed publish: to the clusters that failed when others
+// accepted the message, so those do not get it twice, or nil to send to every cluster
+func resendFunc(err error) sendFunc {
+	var partial *partialPublishError
+	if !errors.As(err, &partial) {
+		return nil
+	}
+	return func(subject, msgID string, data []byte) error {
+		return publishToClusters(partial.clusters, subject, msgID, data)
+	}
+}
+
+// Publishes the message with the schema version header and, unless msgID is empty, the
+// Nats-Msg-Id header to every cluster, concurrently, so a slow cluster does not hold up the
+// others. It reports nats.ErrConnectionClosed once every connection is closed for good, the
+// errors of all clusters when none accepted the message, and a *partialPublishError naming
+// the failed clusters when only some did.
+func publishToClusters(clusters []*cluster, subject, msgID string, data []byte) error {
+	header := nats.Header{SchemaVersionHeader: schemaVersionValue}
+	if msgID != "" {
+		header[jetstream.MsgIDHeader] = []string{msgID}
+	}
+	errs := make([]error, len(clusters))
+	if len(clusters) == 1 {
+		errs[0] = clusters[0].publish(&nats.Msg{Subject: subject, Data: data, Header: header})
+	} else {
+		var wg sync.WaitGroup
+		for i, c := range clusters {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = c.publish(&nats.Msg{Subject: subject, Data: data, Header: header})
+			}()
+		}
+		wg.Wait()
+	}
+
+	var failed []*cluster
+	var failures []error
+	closed := 0
+	for i, c := range clusters {
+		if errs[i] == nil {
+			c.published.Add(1)
+			continue
+		}
+		c.failed.Add(1)
+		if c.nc.IsClosed() {
+			closed++
+			continue
+		}
+		failed = append(failed, c)
+		failures = append(failures, fmt.Errorf("%s: %w", c.url, errs[i]))
+	}
+	switch {
+	case closed == len(clusters):
+		return nats.ErrConnectionClosed
+	case len(failed) == 0:
+		return nil
+	case len(failed)+closed == len(clusters):
+		return errors.Join(failures...)
+	}
+	return &partialPublishError{clusters: failed, err: errors.Join(failures...)}
+}
+
+// Publishes the message on the connection, through JetStream when enabled. A message
+// JetStream already stored within the stream's duplicate window counts as published.
+func (c *cluster) publish(msg *nats.Msg) error {
+	if c.js == nil {
+		return c.nc.PublishMsg(msg)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), jetStreamAckTimeout)
+	defer cancel()
+	ack, err := c.js.PublishMsg(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if ack.Duplicate {
+		log.Printf("Daemon: JetStream stream '%s' at %s already stored message %s on '%s', dropped the duplicate", ack.Stream, c.url, msg.Header.Get(jetstream.MsgIDHeader), msg.Subject)
+	}
+	return nil
+}
+
+// Flushes and closes every connection in parallel, logging the per-cluster delivery
+// counters, so a stuck cluster delays shutdown by at most one flush timeout.
+// A zero timeout skips the flush. Returns the flush errors of the clusters, whose
+// buffered messages may be lost.
+func closeClusters(clusters []*cluster, flushTimeout time.Duration) error {
+	errs := make([]error, len(clusters))
+	var wg sync.WaitGroup
+	for i, c := range clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.close(flushTimeout)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (c *cluster) close(flushTimeout time.Duration) error {
+	var flushErr error
+	if flushTimeout > 0 {
+		// Publish is buffered client-side, so drain it before closing or the tail of the run is lost
+		if err := c.nc.FlushTimeout(flushTimeout); err != nil {
+			log.Printf("Daemon Service (Go): Failed to flush NATS connection to %s within %s: %v", c.url, flushTimeout, err)
+			flushErr = fmt.Errorf("flushing %s: %w", c.url, err)
+		} else {
+			log.Printf("Daemon Service (Go): Flushed pending messages to NATS at %s.", c.url)
+		}
+	}
+	log.Printf("Daemon Service (Go): Closing NATS connection to %s (published %d, failed %d)...", c.url, c.published.Load(), c.failed.Load())
+	c.closing.Store(true)
+	c.nc.Close()
+	return flushErr
+}
+
+// Returns the connection state and delivery counters of every cluster
+func clusterStatuses(clusters []*cluster) []ClusterStatus {
+	var statuses []ClusterStatus
+	for _, c := range clusters {
+		statuses = append(statuses, ClusterStatus{
+			URL:       c.url,
+			Connected: c.nc.IsConnected(),
+			Published: c.published.Load(),
+			Failed:    c.failed.Load(),
+		})
+	}
+	return statuses
+}
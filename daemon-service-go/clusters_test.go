@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// smallPayload is the max_payload of a fake server rejecting every test message
+const smallPayload = 8
+
+func TestPublishToClustersSendsHeadersToEveryCluster(t *testing.T) {
+	a, b := startFakeNATS(t, 1<<20, false), startFakeNATS(t, 1<<20, false)
+	clusters := connectFakeClusters(t, false, a, b)
+
+	if err := publishToClusters(clusters, EventsSubject, "id-1", []byte(`{"id":"id-1"}`)); err != nil {
+		t.Fatalf("publishToClusters: %v", err)
+	}
+	for i, s := range []*fakeNATS{a, b} {
+		msg := waitForMessages(t, s, 1)[0]
+		if msg.Subject != EventsSubject || string(msg.Data) != `{"id":"id-1"}` {
+			t.Errorf("cluster %d got %s %s", i, msg.Subject, msg.Data)
+		}
+		if got := msg.Header.Get(jetstream.MsgIDHeader); got != "id-1" {
+			t.Errorf("cluster %d got Nats-Msg-Id %q, want id-1", i, got)
+		}
+		if got := msg.Header.Get(SchemaVersionHeader); got != strconv.Itoa(SchemaVersion) {
+			t.Errorf("cluster %d got schema version %q, want %d", i, got, SchemaVersion)
+		}
+		if clusters[i].published.Load() != 1 || clusters[i].failed.Load() != 0 {
+			t.Errorf("cluster %d counted %d published, %d failed", i, clusters[i].published.Load(), clusters[i].failed.Load())
+		}
+	}
+}
+
+func TestPublishToClustersReportsEachFailedCluster(t *testing.T) {
+	tests := []struct {
+		name        string
+		payloads    []int // max_payload per cluster
+		wantPartial []int // Clusters of the partialPublishError
+		wantErr     bool
+	}{
+		{name: "all accept", payloads: []int{1 << 20, 1 << 20}},
+		{name: "one of two fails", payloads: []int{1 << 20, smallPayload}, wantPartial: []int{1}, wantErr: true},
+		{name: "two of three fail", payloads: []int{smallPayload, 1 << 20, smallPayload}, wantPartial: []int{0, 2}, wantErr: true},
+		{name: "all fail", payloads: []int{smallPayload, smallPayload}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := make([]*fakeNATS, len(tt.payloads))
+			for i, payload := range tt.payloads {
+				servers[i] = startFakeNATS(t, payload, false)
+			}
+			clusters := connectFakeClusters(t, false, servers...)
+
+			err := publishToClusters(clusters, EventsSubject, "id-1", []byte(`{"id":"id-1"}`))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("publishToClusters = %v, want error %t", err, tt.wantErr)
+			}
+			var partial *partialPublishError
+			if errors.As(err, &partial) != (tt.wantPartial != nil) {
+				t.Fatalf("publishToClusters = %v, want partial failure of clusters %v", err, tt.wantPartial)
+			}
+			if partial != nil {
+				if len(partial.clusters) != len(tt.wantPartial) {
+					t.Fatalf("partial failure of %d cluster(s), want %v", len(partial.clusters), tt.wantPartial)
+				}
+				for i, index := range tt.wantPartial {
+					if partial.clusters[i] != clusters[index] {
+						t.Errorf("failed cluster %d is %s, want %s", i, partial.clusters[i].url, clusters[index].url)
+					}
+				}
+				if !errors.Is(err, nats.ErrMaxPayload) {
+					t.Errorf("partial failure %v does not wrap the cluster's error", err)
+				}
+			}
+			for i, payload := range tt.payloads {
+				failed := uint64(0)
+				if payload == smallPayload {
+					failed = 1
+				}
+				if clusters[i].failed.Load() != failed || clusters[i].published.Load() != 1-failed {
+					t.Errorf("cluster %d counted %d published, %d failed", i, clusters[i].published.Load(), clusters[i].failed.Load())
+				}
+			}
+		})
+	}
+}
+
+func TestPublishToClustersSkipsClosedClusters(t *testing.T) {
+	a, b := startFakeNATS(t, 1<<20, false), startFakeNATS(t, 1<<20, false)
+	clusters := connectFakeClusters(t, false, a, b)
+
+	clusters[1].nc.Close()
+	if err := publishToClusters(clusters, EventsSubject, "", []byte(`{}`)); err != nil {
+		t.Errorf("publishToClusters with one cluster closed for good = %v, want nil", err)
+	}
+	clusters[0].nc.Close()
+	if err := publishToClusters(clusters, EventsSubject, "", []byte(`{}`)); !errors.Is(err, nats.ErrConnectionClosed) {
+		t.Errorf("publishToClusters with every cluster closed = %v, want %v", err, nats.ErrConnectionClosed)
+	}
+}
+
+func TestRetryQueueRetriesOnlyFailedClusters(t *testing.T) {
+	a, b := startFakeNATS(t, 1<<20, false), startFakeNATS(t, smallPayload, false)
+	clusters := connectFakeClusters(t, false, a, b)
+	send := func(subject, msgID string, data []byte) error {
+		return publishToClusters(clusters, subject, msgID, data)
+	}
+	stats := &publishStats{}
+	q := newRetryQueue(retryConfig{QueueSize: 10, MaxAttempts: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}, send, stats)
+	var counter atomic.Uint64
+
+	data := []byte(`{"id":"id-1"}`)
+	err := q.enqueue(EventsSubject, "id-1", data, &counter, send(EventsSubject, "id-1", data))
+	if !errors.Is(err, errQueuedForRetry) {
+		t.Fatalf("enqueue = %v, want %v", err, errQueuedForRetry)
+	}
+	q.retry(time.Now(), true)
+	q.retry(time.Now(), true)
+
+	waitForMessages(t, a, 1) // The retries went to the failing cluster only
+	if clusters[1].failed.Load() != 3 {
+		t.Errorf("failing cluster tried %d time(s), want 3", clusters[1].failed.Load())
+	}
+	if stats.lost.Load() != 1 || counter.Load() != 0 {
+		t.Errorf("lost %d, published %d after the retries were exhausted, want 1 and 0", stats.lost.Load(), counter.Load())
+	}
+}
+
+func TestPublishToClustersJetStreamDuplicates(t *testing.T) {
+	s := startFakeNATS(t, 1<<20, true)
+	clusters := connectFakeClusters(t, true, s)
+
+	// A retry keeps the message ID, so the stream acks the second publish as a duplicate
+	for range 2 {
+		if err := publishToClusters(clusters, EventsSubject, "id-1", []byte(`{"id":"id-1"}`)); err != nil {
+			t.Fatalf("publishToClusters: %v", err)
+		}
+	}
+	if err := publishToClusters(clusters, EventsSubject, "id-2", []byte(`{"id":"id-2"}`)); err != nil {
+		t.Fatalf("publishToClusters: %v", err)
+	}
+	msgs := waitForMessages(t, s, 3)
+	for i, want := range []string{"id-1", "id-1", "id-2"} {
+		if got := msgs[i].Header.Get(jetstream.MsgIDHeader); got != want {
+			t.Errorf("message %d has Nats-Msg-Id %q, want %q", i, got, want)
+		}
+	}
+	if clusters[0].published.Load() != 3 || clusters[0].failed.Load() != 0 {
+		t.Errorf("counted %d published, %d failed, want a duplicate to count as published", clusters[0].published.Load(), clusters[0].failed.Load())
+	}
+}
+
+func TestClusterOptions(t *testing.T) {
+	tests := []struct {
+		name                 string
+		cfg                  connectionConfig
+		retryOnFailedConnect bool
+	}{
+		{"defaults", connectionConfig{MaxReconnects: defaultMaxReconnects, ReconnectWait: defaultReconnectWait, ConnectTimeout: defaultConnectTimeout}, false},
+		{"forever", connectionConfig{MaxReconnects: -1, ReconnectWait: 250 * time.Millisecond, ConnectTimeout: 5 * time.Second}, true},
+		{"never", connectionConfig{MaxReconnects: 0, ReconnectWait: time.Second, ConnectTimeout: 100 * time.Millisecond}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &cluster{url: "nats://127.0.0.1:4222"}
+			opts := nats.GetDefaultOptions()
+			for _, opt := range c.options(tt.cfg, tt.retryOnFailedConnect, func() {}) {
+				if err := opt(&opts); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if opts.MaxReconnect != tt.cfg.MaxReconnects || opts.ReconnectWait != tt.cfg.ReconnectWait || opts.Timeout != tt.cfg.ConnectTimeout {
+				t.Errorf("options have %d reconnects every %s with a %s timeout, want %+v", opts.MaxReconnect, opts.ReconnectWait, opts.Timeout, tt.cfg)
+			}
+			if opts.RetryOnFailedConnect != tt.retryOnFailedConnect {
+				t.Errorf("RetryOnFailedConnect = %t, want %t", opts.RetryOnFailedConnect, tt.retryOnFailedConnect)
+			}
+			if opts.Name != "daemon-service-go" || opts.ClosedCB == nil || opts.ReconnectErrCB == nil {
+				t.Errorf("options named %q without the daemon's handlers", opts.Name)
+			}
+		})
+	}
+}
+
+func TestClusterOptionsLogSampledReconnectAttempts(t *testing.T) {
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	c := &cluster{url: "nats://127.0.0.1:4222"}
+	opts := nats.GetDefaultOptions()
+	for _, opt := range c.options(connectionConfig{MaxReconnects: 60}, false, func() {}) {
+		_ = opt(&opts)
+	}
+	for range 25 {
+		opts.ReconnectErrCB(nil, errors.New("connection refused"))
+	}
+	var attempts []string
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		_, after, _ := strings.Cut(line, "Reconnect attempt ")
+		attempt, _, _ := strings.Cut(after, " ")
+		attempts = append(attempts, attempt)
+	}
+	if !slices.Equal(attempts, []string{"1", "11", "21"}) {
+		t.Errorf("logged attempts %v of 25, want the first and every %d-th: %s", attempts, reconnectLogSampling, logs)
+	}
+	if !strings.Contains(logs.String(), "Reconnect attempt 1 of 60 to NATS at nats://127.0.0.1:4222 failed: connection refused") {
+		t.Errorf("log does not name the attempt limit, server and error:\n%s", logs)
+	}
+}
+
+func TestClosedHandlerCallsOnClosed(t *testing.T) {
+	var closed atomic.Int64
+	c := &cluster{url: "nats://127.0.0.1:4222"}
+	opts := nats.GetDefaultOptions()
+	for _, opt := range c.options(connectionConfig{}, false, func() { closed.Add(1) }) {
+		_ = opt(&opts)
+	}
+	opts.ClosedCB(nil)
+	if closed.Load() != 1 {
+		t.Fatalf("connection closed by NATS called onClosed %d time(s), want 1", closed.Load())
+	}
+	c.closing.Store(true)
+	opts.ClosedCB(nil)
+	if closed.Load() != 1 {
+		t.Error("connection closed by the daemon on shutdown called onClosed")
+	}
+}
+
+func TestConnectClustersReportsEveryConnectionClosed(t *testing.T) {
+	a, b := startFakeNATS(t, 1<<20, false), startFakeNATS(t, 1<<20, false)
+	closed := make(chan struct{}, 2)
+	cfg := connectionConfig{MaxReconnects: 0, ReconnectWait: 10 * time.Millisecond, ConnectTimeout: time.Second}
+	clusters, err := connectClusters([]string{a.url(), b.url()}, cfg, func() { closed <- struct{}{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = closeClusters(clusters, 0) }()
+
+	a.stop()
+	select {
+	case <-closed:
+		t.Fatal("onClosed called while a cluster is still connected")
+	case <-time.After(200 * time.Millisecond):
+	}
+	b.stop()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("onClosed not called once every connection was closed for good")
+	}
+}
+
+// The daemon exits non-zero once NATS gives up on the connection, so the orchestrator restarts it
+func TestLostConnectionExitsNonZero(t *testing.T) {
+	s := startFakeNATS(t, 1<<20, false)
+	go func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for len(s.received()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		s.stop()
+	}()
+	code, logs := runDaemon(t, "--nats-url", s.url(), "--nats-max-reconnects", "0", "--nats-reconnect-wait", "10ms",
+		"--device-count", "5", "--generation-interval", "5ms", "--seed", "7",
+		"--heartbeat-interval-seconds", "0", "--summary-interval", "0")
+	if code != 1 {
+		t.Fatalf("exit code %d, want 1; log:\n%s", code, logs)
+	}
+	if !strings.Contains(logs, "Exiting after losing every NATS connection.") {
+		t.Errorf("log does not report the lost connection:\n%s", logs)
+	}
+}
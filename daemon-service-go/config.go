@@ -0,0 +1,468 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"daemon-service-go/pkg/simulator"
+)
+
+// Config holds every configuration knob of the daemon.
+// Values are resolved with the precedence flags > environment variables > defaults.
+type Config struct {
+	NatsURL                 string
+	NatsURLs                string // Comma-separated clusters that all receive every message, overrides NatsURL
+	Connection              connectionConfig
+	DryRun                  bool          // Write messages to stdout instead of connecting to NATS
+	GenerationInterval      int           // Legacy: whole seconds between generation cycles
+	Interval                time.Duration // Time between generation cycles, overrides GenerationInterval when set
+	HeartbeatInterval       int           // Seconds between heartbeats, 0 disables them
+	CriticalityDistribution string
+	DeviceCount             int
+	InventoryBucket         string // JetStream key-value bucket holding the device inventory, empty for the static fleet
+	Seed                    int64  // Master seed of all generated values, 0 picks one from the clock
+	Enclosures              int    // Enclosures of disk units, 0 keeps disk units top-level
+	DisksPerEnclosure       int
+	SecurityEventTypes      string        // Comma-separated, "none" routes every event to EventsSubject
+	AllowForeignSubjects    bool          // Allow eventSubjects outside the events.* namespace
+	FlushTimeout            time.Duration // Deadline for flushing buffered publishes on shutdown
+	Lifecycle               lifecycleConfig
+	Escalation              escalationConfig
+	Dedup                   dedupConfig
+	Resolution              resolutionConfig
+	Rebuild                 rebuildConfig
+	Capacity                simulator.CapacityConfig
+	Latency                 simulator.LatencyConfig
+	MetricMetadata          string        // Unit and precision table per metric type, "none" omits both fields
+	ChaosDuplicateRate      float64       // Probability per publish of republishing an earlier message, 0 disables it
+	ChaosReorderRate        float64       // Probability per publish of holding a message back a few cycles, 0 disables it
+	ChaosMalformedRate      float64       // Probability per publish of corrupting the payload, 0 disables it
+	RunCycles               int           // Bounded run: cycles per device before exiting, 0 for no bound
+	RunMessageLimit         int           // Bounded run: published metrics and events before exiting, 0 for no bound
+	CardinalityTestDevices  int           // Stress mode: unique device names to generate before exiting, 0 disables it
+	CardinalityTestAck      bool          // Must be set to run the cardinality stress mode
+	SummaryInterval         time.Duration // Time between generation summaries, 0 only logs the final one
+	SummaryTopDevices       int           // Devices listed individually in a summary, the rest are aggregated
+	SummaryCycles           int           // Cycles between rollup summaries on SummarySubject, 0 disables them
+	Drill                   drillConfig
+	BackfillDuration        time.Duration // History synthesized per device on startup, 0 disables the backfill
+	BackfillRate            int           // Backfill messages per second across the fleet
+	Retry                   retryConfig
+	HealthAddr              string // Listen address of the /healthz endpoint, empty disables it
+	PprofAddr               string // Listen address of the /debug/pprof/ endpoints, empty disables them
+	OTLPEndpoint            string // Base URL of the OTLP/HTTP collector also receiving the metrics, empty disables the export
+	ConfigFile              string // Path of the JSON config file with the structured settings, empty for none
+
+	File FileConfig // Settings read from ConfigFile
+}
+
+// envFlags maps every flag name to the environment variable it mirrors.
+var envFlags = map[string]string{
+	"nats-url":                    "NATS_URL",
+	"nats-urls":                   "NATS_URLS",
+	"nats-max-reconnects":         "NATS_MAX_RECONNECTS",
+	"nats-jetstream":              "NATS_JETSTREAM",
+	"nats-reconnect-wait":         "NATS_RECONNECT_WAIT",
+	"nats-connect-timeout":        "NATS_CONNECT_TIMEOUT",
+	"dry-run":                     "DRY_RUN",
+	"generation-interval":         "GENERATION_INTERVAL",
+	"generation-interval-seconds": "GENERATION_INTERVAL_SECONDS",
+	"heartbeat-interval-seconds":  "HEARTBEAT_INTERVAL_SECONDS",
+	"criticality-distribution":    "CRITICALITY_DISTRIBUTION",
+	"device-count":                "DEVICE_COUNT",
+	"seed":                        "SEED",
+	"inventory-bucket":            "INVENTORY_BUCKET",
+	"enclosures":                  "ENCLOSURE_COUNT",
+	"disks-per-enclosure":         "DISKS_PER_ENCLOSURE",
+	"security-event-types":        "SECURITY_EVENT_TYPES",
+	"allow-foreign-subjects":      "ALLOW_FOREIGN_SUBJECTS",
+	"flush-timeout":               "FLUSH_TIMEOUT",
+	"offline-probability":         "DEVICE_OFFLINE_PROBABILITY",
+	"maintenance-probability":     "DEVICE_MAINTENANCE_PROBABILITY",
+	"min-downtime":                "DEVICE_MIN_DOWNTIME",
+	"max-downtime":                "DEVICE_MAX_DOWNTIME",
+	"dedup-window":                "DEDUP_WINDOW",
+	"dedup-occurrence-count":      "DEDUP_OCCURRENCE_COUNT",
+	"escalation-window":           "ESCALATION_WINDOW",
+	"escalation-step":             "ESCALATION_STEP",
+	"resolve-fraction":            "RESOLVE_FRACTION",
+	"resolve-min-delay":           "RESOLVE_MIN_DELAY",
+	"resolve-max-delay":           "RESOLVE_MAX_DELAY",
+	"rebuild-probability":         "REBUILD_PROBABILITY",
+	"rebuild-duration":            "REBUILD_DURATION",
+	"capacity-growth-per-hour":    "CAPACITY_GROWTH_PER_HOUR",
+	"capacity-cleanups-per-hour":  "CAPACITY_CLEANUPS_PER_HOUR",
+	"latency-base":                "LATENCY_BASE",
+	"latency-iops-coefficient":    "LATENCY_IOPS_COEFFICIENT",
+	"latency-noise":               "LATENCY_NOISE",
+	"metric-metadata":             "METRIC_METADATA",
+	"chaos-duplicate-rate":        "CHAOS_DUPLICATE_RATE",
+	"chaos-reorder-rate":          "CHAOS_REORDER_RATE",
+	"chaos-malformed-rate":        "CHAOS_MALFORMED_RATE",
+	"config":                      "DAEMON_CONFIG",
+	"health-addr":                 "HEALTH_ADDR",
+	"pprof-addr":                  "PPROF_ADDR",
+	"otlp-endpoint":               "OTEL_EXPORTER_OTLP_ENDPOINT",
+	"retry-queue-size":            "RETRY_QUEUE_SIZE",
+	"retry-max-attempts":          "RETRY_MAX_ATTEMPTS",
+	"retry-backoff":               "RETRY_BACKOFF",
+	"retry-max-backoff":           "RETRY_MAX_BACKOFF",
+	"retry-lost-file":             "RETRY_LOST_FILE",
+	"summary-interval":            "SUMMARY_INTERVAL",
+	"run-cycles":                  "RUN_CYCLES",
+	"run-message-limit":           "RUN_MESSAGE_LIMIT",
+	"cardinality-test-devices":    "CARDINALITY_TEST_DEVICES",
+	"i-understand-this-is-a-test": "I_UNDERSTAND_THIS_IS_A_TEST",
+	"summary-top-devices":         "SUMMARY_TOP_DEVICES",
+	"summary-cycles":              "SUMMARY_CYCLES",
+	"backfill-duration":           "BACKFILL_DURATION",
+	"drill-event-type":            "DRILL_EVENT_TYPE",
+	"drill-device":                "DRILL_DEVICE",
+	"backfill-rate":               "BACKFILL_RATE",
+}
+
+// Builds the flag set bound to cfg, with the built-in defaults as flag defaults
+func newFlagSet(cfg *Config, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	fs.StringVar(&cfg.NatsURL, "nats-url", defaultNatsURL, "NATS server URL")
+	fs.StringVar(&cfg.NatsURLs, "nats-urls", "", "comma-separated NATS URLs of independent clusters that each receive every message, overrides --nats-url")
+	fs.IntVar(&cfg.Connection.MaxReconnects, "nats-max-reconnects", defaultMaxReconnects, "reconnect attempts per server before the connection is closed and the daemon exits non-zero, -1 retries forever")
+	fs.DurationVar(&cfg.Connection.ReconnectWait, "nats-reconnect-wait", defaultReconnectWait, "pause between reconnect attempts to the same server")
+	fs.DurationVar(&cfg.Connection.ConnectTimeout, "nats-connect-timeout", defaultConnectTimeout, "deadline of a single connection attempt")
+	fs.BoolVar(&cfg.Connection.JetStream, "nats-jetstream", false, "publish through JetStream and wait for the stream's ack; a stream must capture the subjects, and its duplicate window drops retried messages by their Nats-Msg-Id")
+	fs.BoolVar(&cfg.DryRun, "dry-run", false, "skip NATS and write every message to stdout as '<subject> <payload>', logs stay on stderr")
+	fs.DurationVar(&cfg.Interval, "generation-interval", 0, "time between generation cycles such as 250ms or 2s, overrides --generation-interval-seconds")
+	fs.IntVar(&cfg.GenerationInterval, "generation-interval-seconds", defaultGenerationInterval, "legacy: whole seconds between generation cycles")
+	fs.IntVar(&cfg.HeartbeatInterval, "heartbeat-interval-seconds", defaultHeartbeatInterval, "seconds between heartbeats on '"+HeartbeatSubject+"', 0 disables them")
+	fs.StringVar(&cfg.CriticalityDistribution, "criticality-distribution", defaultCriticalityDist, "named distribution (uniform, realistic, noisy) or weight table such as 1-3:70,4-7:25,8-10:5")
+	fs.IntVar(&cfg.DeviceCount, "device-count", defaultDeviceCount, "number of simulated devices, 0 keeps one device per base type")
+	fs.StringVar(&cfg.InventoryBucket, "inventory-bucket", "", "JetStream key-value bucket with one key per device name, watched for live changes; falls back to the static fleet when absent")
+	fs.Int64Var(&cfg.Seed, "seed", 0, "master seed for reproducible runs, each device derives its own RNG from it and its name; 0 picks one from the clock")
+	fs.IntVar(&cfg.Enclosures, "enclosures", 0, "number of enclosures holding the disk units, 0 keeps disk units top-level; device-count then only sizes the other types")
+	fs.IntVar(&cfg.DisksPerEnclosure, "disks-per-enclosure", defaultDisksPerEnclosure, "number of disk units in each enclosure")
+	fs.StringVar(&cfg.SecurityEventTypes, "security-event-types", defaultSecurityEventTypes, "comma-separated event types published to '"+SecurityEventsSubject+"', or none")
+
+	fs.BoolVar(&cfg.AllowForeignSubjects, "allow-foreign-subjects", false, "allow eventSubjects in the config file outside the events.* namespace, which the writer does not consume")
+
+	fs.DurationVar(&cfg.FlushTimeout, "flush-timeout", defaultFlushTimeout, "deadline for flushing buffered messages to NATS on shutdown")
+	fs.Float64Var(&cfg.Lifecycle.OfflineProbability, "offline-probability", 0, "per device and cycle probability of going offline, 0 disables outages")
+	fs.Float64Var(&cfg.Lifecycle.MaintenanceProbability, "maintenance-probability", 0, "per device and cycle probability of entering maintenance, 0 disables maintenance")
+	fs.DurationVar(&cfg.Lifecycle.MinDowntime, "min-downtime", defaultMinDowntime, "shortest time a device stays offline or in maintenance")
+	fs.DurationVar(&cfg.Lifecycle.MaxDowntime, "max-downtime", defaultMaxDowntime, "longest time a device stays offline or in maintenance")
+	fs.DurationVar(&cfg.Dedup.Window, "dedup-window", 0, "suppress repeats of an event type on a device within this window after the last emitted one, 0 disables it")
+	fs.BoolVar(&cfg.Dedup.OccurrenceCount, "dedup-occurrence-count", false, "attach the number of occurrences since the last emitted event as occurrenceCount")
+	fs.DurationVar(&cfg.Escalation.Window, "escalation-window", defaultEscalationWindow, "repeats of an event type on a device within this window escalate its criticality, 0 disables escalation")
+	fs.IntVar(&cfg.Escalation.Step, "escalation-step", defaultEscalationStep, "criticality added per repeated incident, capped at 10")
+	fs.Float64Var(&cfg.Resolution.Fraction, "resolve-fraction", defaultResolveFraction, "share of DriveFailure incidents that are later resolved by an event with the same correlationId")
+	fs.DurationVar(&cfg.Resolution.MinDelay, "resolve-min-delay", defaultResolveMinDelay, "shortest time until an incident is resolved")
+	fs.DurationVar(&cfg.Resolution.MaxDelay, "resolve-max-delay", defaultResolveMaxDelay, "longest time until an incident is resolved")
+	fs.Float64Var(&cfg.Rebuild.Probability, "rebuild-probability", defaultRebuildProbability, "chance that a DriveFailure starts a RAID rebuild reporting "+RebuildProgressMetric+" until a "+RebuildCompleteEvent+" event, 0 disables rebuilds")
+	fs.DurationVar(&cfg.Rebuild.Duration, "rebuild-duration", defaultRebuildDuration, "time a RAID rebuild takes from 0 to 100% progress")
+	fs.Float64Var(&cfg.Capacity.GrowthPerHour, "capacity-growth-per-hour", simulator.DefaultCapacity.GrowthPerHour, "mean CapacityUsed growth per device in percentage points per hour")
+	fs.Float64Var(&cfg.Capacity.CleanupsPerHour, "capacity-cleanups-per-hour", simulator.DefaultCapacity.CleanupsPerHour, "expected cleanups per device and hour, each dropping CapacityUsed by 5-25 points")
+	fs.Float64Var(&cfg.Latency.Base, "latency-base", simulator.DefaultLatency.Base, "Latency of a device at zero IOPs")
+	fs.Float64Var(&cfg.Latency.PerIOPs, "latency-iops-coefficient", simulator.DefaultLatency.PerIOPs, "Latency added per IOPs of the device, 0 generates Latency independently of IOPs")
+	fs.Float64Var(&cfg.Latency.Noise, "latency-noise", simulator.DefaultLatency.Noise, "largest random deviation of Latency from base + coefficient·IOPs")
+	fs.StringVar(&cfg.MetricMetadata, "metric-metadata", defaultMetricMetadata, "unit and precision per metric type as <metricType>:<unit>[:<precision>],..., or none")
+	fs.Float64Var(&cfg.ChaosDuplicateRate, "chaos-duplicate-rate", 0, "fault injection: probability of republishing an earlier message verbatim, 0 disables it")
+	fs.Float64Var(&cfg.ChaosReorderRate, "chaos-reorder-rate", 0, "fault injection: probability of delaying a message a few cycles, 0 disables it")
+	fs.Float64Var(&cfg.ChaosMalformedRate, "chaos-malformed-rate", 0, "fault injection: probability of corrupting a payload (truncated, wrong types, missing fields, absurd values, not JSON), 0 disables it")
+	fs.IntVar(&cfg.RunCycles, "run-cycles", 0, "bounded run: generation cycles per device before exiting, 0 runs forever")
+	fs.IntVar(&cfg.RunMessageLimit, "run-message-limit", 0, "bounded run: published metrics and events before exiting, 0 runs forever")
+	fs.IntVar(&cfg.CardinalityTestDevices, "cardinality-test-devices", 0, "stress mode: report every cycle under a new, never-repeating device name and exit after this many names, 0 disables it")
+	fs.BoolVar(&cfg.CardinalityTestAck, "i-understand-this-is-a-test", false, "required to run the cardinality stress mode")
+	fs.DurationVar(&cfg.SummaryInterval, "summary-interval", defaultSummaryInterval, "time between generation summaries in the log, 0 only logs the final one")
+	fs.IntVar(&cfg.SummaryCycles, "summary-cycles", 0, "cycles between rollup summaries published to '"+SummarySubject+"', 0 disables them")
+	fs.StringVar(&cfg.Drill.EventType, "drill-event-type", defaultDrillEventType, "event type published on SIGUSR1 and SIGUSR2 drills")
+	fs.StringVar(&cfg.Drill.Device, "drill-device", defaultDrillDevice, "source device of drill events")
+	fs.DurationVar(&cfg.BackfillDuration, "backfill-duration", 0, "history to synthesize per device on startup with past timestamps (e.g. 6h), 0 disables the backfill")
+	fs.IntVar(&cfg.BackfillRate, "backfill-rate", defaultBackfillRate, "backfill messages per second across the fleet")
+	fs.IntVar(&cfg.SummaryTopDevices, "summary-top-devices", defaultSummaryTopDevices, "devices listed individually in a summary, the rest are aggregated as other")
+	fs.IntVar(&cfg.Retry.QueueSize, "retry-queue-size", defaultRetryQueueSize, "failed publishes waiting for a retry at most, 0 drops failed publishes")
+	fs.IntVar(&cfg.Retry.MaxAttempts, "retry-max-attempts", defaultRetryMaxAttempts, "retries per failed publish before the message counts as lost")
+	fs.DurationVar(&cfg.Retry.Backoff, "retry-backoff", defaultRetryBackoff, "delay before the first retry, doubled for every further one")
+	fs.DurationVar(&cfg.Retry.MaxBackoff, "retry-max-backoff", defaultRetryMaxBackoff, "upper bound of the delay between retries")
+	fs.StringVar(&cfg.Retry.LostFile, "retry-lost-file", "", "file receiving messages that exhausted their retries as JSON lines, empty only counts them")
+	fs.StringVar(&cfg.HealthAddr, "health-addr", "", "listen address of the HTTP /healthz endpoint such as :8080, empty disables it")
+	fs.StringVar(&cfg.PprofAddr, "pprof-addr", "", "listen address of the net/http/pprof endpoints such as localhost:6060, empty disables them; do not expose it publicly")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", "", "base URL of an OTLP/HTTP collector such as http://otel-collector:4318 that also receives the metrics as gauges, empty disables the export")
+	fs.StringVar(&cfg.ConfigFile, "config", "", "path of the JSON config file with structured settings such as clockSkew")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of daemon:\n")
+		fmt.Fprintf(fs.Output(), "Every flag overrides the environment variable shown in brackets, which overrides the default.\n\n")
+		fs.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(fs.Output(), "  --%s [%s]\n    \t%s (default %q)\n", f.Name, envFlags[f.Name], f.Usage, f.DefValue)
+		})
+	}
+	return fs
+}
+
+// Resolves the configuration from command-line args and the environment.
+// Environment variables only apply to flags that were not given explicitly; an empty
+// variable counts as unset. Every unparsable or out-of-range setting is reported in one
+// error naming the variable, the value and what is accepted. It returns flag.ErrHelp
+// when --help was requested.
+func loadConfig(args []string, getenv func(string) string) (Config, error) {
+	var cfg Config
+	fs := newFlagSet(&cfg, os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return cfg, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var problems configProblems
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] {
+			return
+		}
+		value := getenv(envFlags[f.Name])
+		if value == "" {
+			return
+		}
+		if err := f.Value.Set(value); err != nil {
+			problems.add(f.Name, fmt.Sprintf("%q", value), "expected "+flagFormat(f))
+		}
+	})
+	if len(problems) > 0 {
+		// Range checks on half-parsed values would only add noise
+		return cfg, problems.err()
+	}
+
+	// Keep the historical lenient behavior for non-positive legacy intervals, while the
+	// duration form is new and strict
+	if cfg.GenerationInterval <= 0 {
+		warnDefault("generation-interval-seconds", cfg.GenerationInterval, "a positive number of seconds", defaultGenerationInterval)
+		cfg.GenerationInterval = defaultGenerationInterval
+	}
+	if cfg.Interval < 0 || (cfg.Interval == 0 && (explicit["generation-interval"] || getenv("GENERATION_INTERVAL") != "")) {
+		problems.add("generation-interval", cfg.Interval, "must be a positive duration such as 250ms or 2s")
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Duration(cfg.GenerationInterval) * time.Second
+	}
+	if cfg.HeartbeatInterval < 0 {
+		warnDefault("heartbeat-interval-seconds", cfg.HeartbeatInterval, "a non-negative number of seconds", defaultHeartbeatInterval)
+		cfg.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if cfg.FlushTimeout <= 0 {
+		warnDefault("flush-timeout", cfg.FlushTimeout, "a positive duration", defaultFlushTimeout)
+		cfg.FlushTimeout = defaultFlushTimeout
+	}
+	if cfg.SummaryInterval < 0 {
+		warnDefault("summary-interval", cfg.SummaryInterval, "a non-negative duration", defaultSummaryInterval)
+		cfg.SummaryInterval = defaultSummaryInterval
+	}
+	cfg.validate(&problems)
+
+	if cfg.ConfigFile != "" && len(problems) == 0 {
+		fc, err := loadConfigFile(cfg.ConfigFile)
+		if err != nil {
+			problems.add("config", cfg.ConfigFile, err.Error())
+		}
+		cfg.File = fc
+	}
+	return cfg, problems.err()
+}
+
+// Checks the ranges of the resolved settings, recording every violation
+func (c *Config) validate(problems *configProblems) {
+	if c.Connection.MaxReconnects < -1 {
+		problems.add("nats-max-reconnects", c.Connection.MaxReconnects, "must be -1 (forever) or a non-negative integer")
+	}
+	if c.Connection.ReconnectWait <= 0 {
+		problems.add("nats-reconnect-wait", c.Connection.ReconnectWait, "must be a positive duration")
+	}
+	if c.Connection.ConnectTimeout <= 0 {
+		problems.add("nats-connect-timeout", c.Connection.ConnectTimeout, "must be a positive duration")
+	}
+	if c.Drill.EventType == "" {
+		problems.add("drill-event-type", `""`, "must not be empty")
+	}
+	if c.Drill.Device == "" {
+		problems.add("drill-device", `""`, "must not be empty")
+	}
+	if c.BackfillDuration < 0 {
+		problems.add("backfill-duration", c.BackfillDuration, "must be a non-negative duration")
+	}
+	if c.BackfillRate <= 0 {
+		problems.add("backfill-rate", c.BackfillRate, "must be a positive integer")
+	}
+	if c.SummaryCycles < 0 {
+		problems.add("summary-cycles", c.SummaryCycles, "must be a non-negative integer")
+	}
+	if c.SummaryTopDevices < 0 {
+		problems.add("summary-top-devices", c.SummaryTopDevices, "must be a non-negative integer")
+	}
+	if c.RunCycles < 0 {
+		problems.add("run-cycles", c.RunCycles, "must be a non-negative integer")
+	}
+	if c.RunMessageLimit < 0 {
+		problems.add("run-message-limit", c.RunMessageLimit, "must be a non-negative integer")
+	}
+	if c.CardinalityTestDevices < 0 {
+		problems.add("cardinality-test-devices", c.CardinalityTestDevices, "must be a non-negative integer")
+	}
+	if c.CardinalityTestDevices > 0 && !c.CardinalityTestAck {
+		problems.add("i-understand-this-is-a-test", false, "the cardinality stress mode floods consumers with unique device names; set it to true to run it")
+	}
+	if c.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems.add("otlp-endpoint", c.OTLPEndpoint, "must be an http:// or https:// URL")
+		}
+	}
+	if c.DeviceCount < 0 {
+		problems.add("device-count", c.DeviceCount, "must be a non-negative integer")
+	}
+	if c.Enclosures < 0 {
+		problems.add("enclosures", c.Enclosures, "must be a non-negative integer")
+	}
+	if c.Enclosures > 0 && c.DisksPerEnclosure <= 0 {
+		problems.add("disks-per-enclosure", c.DisksPerEnclosure, "must be a positive integer when enclosures are simulated")
+	}
+	lc := c.Lifecycle
+	if lc.OfflineProbability < 0 || lc.OfflineProbability > 1 {
+		problems.add("offline-probability", lc.OfflineProbability, "must be between 0 and 1")
+	}
+	if lc.MaintenanceProbability < 0 || lc.MaintenanceProbability > 1 {
+		problems.add("maintenance-probability", lc.MaintenanceProbability, "must be between 0 and 1")
+	}
+	if lc.OfflineProbability+lc.MaintenanceProbability > 1 {
+		problems.add("maintenance-probability", lc.MaintenanceProbability, fmt.Sprintf("must not exceed 1 together with the offline probability %g", lc.OfflineProbability))
+	}
+	if lc.MinDowntime < 0 {
+		problems.add("min-downtime", lc.MinDowntime, "must be a non-negative duration")
+	}
+	if lc.MaxDowntime < lc.MinDowntime {
+		problems.add("max-downtime", lc.MaxDowntime, fmt.Sprintf("must not be shorter than the min downtime %s", lc.MinDowntime))
+	}
+	if c.Dedup.Window < 0 {
+		problems.add("dedup-window", c.Dedup.Window, "must be a non-negative duration")
+	}
+	if c.Escalation.Window < 0 {
+		problems.add("escalation-window", c.Escalation.Window, "must be a non-negative duration")
+	}
+	if c.Escalation.Step < 0 {
+		problems.add("escalation-step", c.Escalation.Step, "must be a non-negative integer")
+	}
+	rc := c.Resolution
+	if rc.Fraction < 0 || rc.Fraction > 1 {
+		problems.add("resolve-fraction", rc.Fraction, "must be between 0 and 1")
+	}
+	if rc.MinDelay < 0 {
+		problems.add("resolve-min-delay", rc.MinDelay, "must be a non-negative duration")
+	}
+	if rc.MaxDelay < rc.MinDelay {
+		problems.add("resolve-max-delay", rc.MaxDelay, fmt.Sprintf("must not be shorter than the min delay %s", rc.MinDelay))
+	}
+	if c.Rebuild.Probability < 0 || c.Rebuild.Probability > 1 {
+		problems.add("rebuild-probability", c.Rebuild.Probability, "must be between 0 and 1")
+	}
+	if c.Rebuild.Duration <= 0 {
+		problems.add("rebuild-duration", c.Rebuild.Duration, "must be a positive duration")
+	}
+	r := c.Retry
+	if r.QueueSize < 0 {
+		problems.add("retry-queue-size", r.QueueSize, "must be a non-negative integer")
+	}
+	if r.MaxAttempts <= 0 {
+		problems.add("retry-max-attempts", r.MaxAttempts, "must be a positive integer")
+	}
+	if r.Backoff <= 0 {
+		problems.add("retry-backoff", r.Backoff, "must be a positive duration")
+	}
+	if r.MaxBackoff < r.Backoff {
+		problems.add("retry-max-backoff", r.MaxBackoff, fmt.Sprintf("must not be shorter than the backoff %s", r.Backoff))
+	}
+	if c.Capacity.GrowthPerHour < 0 {
+		problems.add("capacity-growth-per-hour", c.Capacity.GrowthPerHour, "must be non-negative")
+	}
+	if c.Capacity.CleanupsPerHour < 0 {
+		problems.add("capacity-cleanups-per-hour", c.Capacity.CleanupsPerHour, "must be non-negative")
+	}
+	if c.Latency.Noise < 0 {
+		problems.add("latency-noise", c.Latency.Noise, "must be non-negative")
+	}
+	for _, chaos := range []struct {
+		flag string
+		rate float64
+	}{
+		{"chaos-duplicate-rate", c.ChaosDuplicateRate},
+		{"chaos-reorder-rate", c.ChaosReorderRate},
+		{"chaos-malformed-rate", c.ChaosMalformedRate},
+	} {
+		if chaos.rate < 0 || chaos.rate > 1 {
+			problems.add(chaos.flag, chaos.rate, "must be between 0 and 1")
+		}
+	}
+}
+
+// configProblems collects every invalid setting so that all of them are reported at once.
+type configProblems []string
+
+// Records that the setting of the given flag, or the environment variable it mirrors,
+// holds a value that does not satisfy want
+func (p *configProblems) add(flagName string, value any, want string) {
+	*p = append(*p, fmt.Sprintf("%s=%v (--%s): %s", envFlags[flagName], value, flagName, want))
+}
+
+// Returns nil without problems, otherwise one error listing all of them
+func (p configProblems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d invalid setting(s):\n  %s", len(p), strings.Join(p, "\n  "))
+}
+
+// Logs loudly that an out-of-range legacy setting falls back to its default
+func warnDefault(flagName string, value any, want string, def any) {
+	log.Printf("Daemon Service (Go): WARNING: %s=%v (--%s) is not %s, falling back to the default %v",
+		envFlags[flagName], value, flagName, want, def)
+}
+
+// Returns the accepted format of a flag's values for error messages
+func flagFormat(f *flag.Flag) string {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return "a valid value"
+	}
+	switch getter.Get().(type) {
+	case bool:
+		return "true or false"
+	case int, int64:
+		return "an integer such as 10"
+	case float64:
+		return "a number such as 0.25"
+	case time.Duration:
+		return "a duration such as 500ms, 30s or 5m"
+	default:
+		return "a valid value"
+	}
+}
+
+// Returns the URLs of the NATS clusters to publish to
+func (c Config) natsURLs() []string {
+	if urls := parseNatsURLs(c.NatsURLs); len(urls) > 0 {
+		return urls
+	}
+	return []string{c.NatsURL}
+}
+
+// Reports whether the daemon exits on its own after a bounded run
+func (c Config) bounded() bool {
+	return c.RunCycles > 0 || c.RunMessageLimit > 0 || c.CardinalityTestDevices > 0
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envOf returns a getenv reading the variables from env
+func envOf(env map[string]string) func(string) string {
+	return func(name string) string { return env[name] }
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		env   map[string]string
+		check func(Config) (got, want any)
+	}{
+		{
+			name:  "default",
+			check: func(c Config) (any, any) { return c.NatsURL, defaultNatsURL },
+		},
+		{
+			name:  "env over default",
+			env:   map[string]string{"NATS_URL": "nats://env:4222"},
+			check: func(c Config) (any, any) { return c.NatsURL, "nats://env:4222" },
+		},
+		{
+			name:  "flag over env",
+			args:  []string{"--nats-url", "nats://flag:4222"},
+			env:   map[string]string{"NATS_URL": "nats://env:4222"},
+			check: func(c Config) (any, any) { return c.NatsURL, "nats://flag:4222" },
+		},
+		{
+			name:  "empty env counts as unset",
+			env:   map[string]string{"DEVICE_COUNT": ""},
+			check: func(c Config) (any, any) { return c.DeviceCount, defaultDeviceCount },
+		},
+		{
+			name:  "int from env",
+			env:   map[string]string{"DEVICE_COUNT": "42"},
+			check: func(c Config) (any, any) { return c.DeviceCount, 42 },
+		},
+		{
+			name:  "int flag over env",
+			args:  []string{"--device-count=7"},
+			env:   map[string]string{"DEVICE_COUNT": "42"},
+			check: func(c Config) (any, any) { return c.DeviceCount, 7 },
+		},
+		{
+			name:  "flag set to its default still wins",
+			args:  []string{"--dry-run=false"},
+			env:   map[string]string{"DRY_RUN": "true"},
+			check: func(c Config) (any, any) { return c.DryRun, false },
+		},
+		{
+			name:  "bool from env",
+			env:   map[string]string{"DRY_RUN": "true"},
+			check: func(c Config) (any, any) { return c.DryRun, true },
+		},
+		{
+			name:  "duration from env",
+			env:   map[string]string{"FLUSH_TIMEOUT": "750ms"},
+			check: func(c Config) (any, any) { return c.FlushTimeout, 750 * time.Millisecond },
+		},
+		{
+			name:  "float flag",
+			args:  []string{"--chaos-duplicate-rate", "0.25"},
+			env:   map[string]string{"CHAOS_DUPLICATE_RATE": "0.5"},
+			check: func(c Config) (any, any) { return c.ChaosDuplicateRate, 0.25 },
+		},
+		{
+			name:  "legacy interval in seconds",
+			env:   map[string]string{"GENERATION_INTERVAL_SECONDS": "3"},
+			check: func(c Config) (any, any) { return c.Interval, 3 * time.Second },
+		},
+		{
+			name:  "interval overrides the legacy one",
+			args:  []string{"--generation-interval", "250ms"},
+			env:   map[string]string{"GENERATION_INTERVAL_SECONDS": "3"},
+			check: func(c Config) (any, any) { return c.Interval, 250 * time.Millisecond },
+		},
+		{
+			name:  "non-positive legacy interval falls back to the default",
+			env:   map[string]string{"GENERATION_INTERVAL_SECONDS": "0"},
+			check: func(c Config) (any, any) { return c.Interval, defaultGenerationInterval * time.Second },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(tt.args, envOf(tt.env))
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if got, want := tt.check(cfg); got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestEveryFlagMirrorsAnEnvironmentVariable(t *testing.T) {
+	var cfg Config
+	flags := map[string]bool{}
+	newFlagSet(&cfg, io.Discard).VisitAll(func(f *flag.Flag) {
+		flags[f.Name] = true
+		if envFlags[f.Name] == "" {
+			t.Errorf("--%s has no environment variable", f.Name)
+		}
+	})
+	vars := map[string]string{}
+	for name, env := range envFlags {
+		if !flags[name] {
+			t.Errorf("%s mirrors --%s, which does not exist", env, name)
+		}
+		if other, ok := vars[env]; ok {
+			t.Errorf("%s is mirrored by --%s and --%s", env, name, other)
+		}
+		vars[env] = name
+	}
+}
+
+func TestLoadConfigReportsEveryProblem(t *testing.T) {
+	_, err := loadConfig(nil, envOf(map[string]string{"DEVICE_COUNT": "many", "DRY_RUN": "perhaps"}))
+	if err == nil {
+		t.Fatal("loadConfig accepted unparsable values")
+	}
+	for _, want := range []string{"2 invalid setting(s)", `DEVICE_COUNT="many" (--device-count): expected an integer`, `DRY_RUN="perhaps" (--dry-run): expected true or false`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+
+	_, err = loadConfig([]string{"--nats-reconnect-wait=0s", "--nats-max-reconnects=-2"}, envOf(nil))
+	if err == nil || !strings.Contains(err.Error(), "NATS_RECONNECT_WAIT=0s") || !strings.Contains(err.Error(), "NATS_MAX_RECONNECTS=-2") {
+		t.Errorf("loadConfig = %v, want both out-of-range settings reported", err)
+	}
+}
+
+func TestLoadConfigHelp(t *testing.T) {
+	if _, err := loadConfig([]string{"--help"}, envOf(nil)); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("loadConfig(--help) = %v, want %v", err, flag.ErrHelp)
+	}
+	if _, err := loadConfig([]string{"extra"}, envOf(nil)); err == nil {
+		t.Error("loadConfig accepted a positional argument")
+	}
+}
+
+func TestLoadConfigGenerationInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    time.Duration
+		wantErr string // Part of the error, empty when the config is valid
+	}{
+		{name: "neither set", want: defaultGenerationInterval * time.Second},
+		{name: "only legacy set", env: map[string]string{"GENERATION_INTERVAL_SECONDS": "4"}, want: 4 * time.Second},
+		{name: "only duration set", env: map[string]string{"GENERATION_INTERVAL": "1.5s"}, want: 1500 * time.Millisecond},
+		{name: "sub-second duration", env: map[string]string{"GENERATION_INTERVAL": "50ms"}, want: 50 * time.Millisecond},
+		{name: "both set", env: map[string]string{"GENERATION_INTERVAL": "250ms", "GENERATION_INTERVAL_SECONDS": "4"}, want: 250 * time.Millisecond},
+		{name: "garbage duration", env: map[string]string{"GENERATION_INTERVAL": "fast"}, wantErr: `GENERATION_INTERVAL="fast"`},
+		{name: "duration without unit", env: map[string]string{"GENERATION_INTERVAL": "5"}, wantErr: `GENERATION_INTERVAL="5"`},
+		{name: "zero duration", env: map[string]string{"GENERATION_INTERVAL": "0s"}, wantErr: "GENERATION_INTERVAL=0s"},
+		{name: "negative duration", env: map[string]string{"GENERATION_INTERVAL": "-1s"}, wantErr: "GENERATION_INTERVAL=-1s"},
+		{name: "garbage legacy", env: map[string]string{"GENERATION_INTERVAL_SECONDS": "4s"}, wantErr: `GENERATION_INTERVAL_SECONDS="4s"`},
+		{name: "garbage legacy beside a valid duration", env: map[string]string{"GENERATION_INTERVAL": "2s", "GENERATION_INTERVAL_SECONDS": "x"}, wantErr: `GENERATION_INTERVAL_SECONDS="x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(nil, envOf(tt.env))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("loadConfig = %v, want an error about %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if cfg.Interval != tt.want {
+				t.Errorf("interval %s, want %s", cfg.Interval, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRejectsBadInputs(t *testing.T) {
+	tests := []struct {
+		args []string
+		env  map[string]string
+		want string // The reported problem, naming the variable, the flag and the expectation
+	}{
+		{[]string{"--device-count=-1"}, nil, "DEVICE_COUNT=-1 (--device-count): must be a non-negative integer"},
+		{[]string{"--enclosures=-2"}, nil, "ENCLOSURE_COUNT=-2 (--enclosures): must be a non-negative integer"},
+		{[]string{"--enclosures=2", "--disks-per-enclosure=0"}, nil, "DISKS_PER_ENCLOSURE=0 (--disks-per-enclosure): must be a positive integer when enclosures are simulated"},
+		{[]string{"--nats-max-reconnects=-2"}, nil, "(--nats-max-reconnects): must be -1 (forever) or a non-negative integer"},
+		{[]string{"--nats-connect-timeout=0s"}, nil, "(--nats-connect-timeout): must be a positive duration"},
+		{[]string{"--drill-device="}, nil, `DRILL_DEVICE="" (--drill-device): must not be empty`},
+		{[]string{"--backfill-rate=0"}, nil, "(--backfill-rate): must be a positive integer"},
+		{[]string{"--run-cycles=-1"}, nil, "(--run-cycles): must be a non-negative integer"},
+		{[]string{"--cardinality-test-devices=10"}, nil, "(--i-understand-this-is-a-test)"},
+		{[]string{"--otlp-endpoint=collector:4318"}, nil, "(--otlp-endpoint): must be an http:// or https:// URL"},
+		{[]string{"--offline-probability=-0.5"}, nil, "(--offline-probability): must be between 0 and 1"},
+		{[]string{"--offline-probability=0.6", "--maintenance-probability=0.6"}, nil, "must not exceed 1 together with the offline probability 0.6"},
+		{[]string{"--min-downtime=2m", "--max-downtime=1m"}, nil, "(--max-downtime): must not be shorter than the min downtime 2m0s"},
+		{[]string{"--escalation-step=-1"}, nil, "(--escalation-step): must be a non-negative integer"},
+		{[]string{"--resolve-fraction=2"}, nil, "(--resolve-fraction): must be between 0 and 1"},
+		{[]string{"--resolve-min-delay=1m", "--resolve-max-delay=1s"}, nil, "(--resolve-max-delay): must not be shorter than the min delay 1m0s"},
+		{[]string{"--rebuild-duration=0s"}, nil, "(--rebuild-duration): must be a positive duration"},
+		{[]string{"--retry-max-attempts=0"}, nil, "(--retry-max-attempts): must be a positive integer"},
+		{[]string{"--retry-backoff=1s", "--retry-max-backoff=10ms"}, nil, "(--retry-max-backoff): must not be shorter than the backoff 1s"},
+		{[]string{"--capacity-growth-per-hour=-1"}, nil, "(--capacity-growth-per-hour): must be non-negative"},
+		{[]string{"--latency-noise=-0.5"}, nil, "(--latency-noise): must be non-negative"},
+		{[]string{"--chaos-reorder-rate=-0.1"}, nil, "CHAOS_REORDER_RATE=-0.1 (--chaos-reorder-rate): must be between 0 and 1"},
+		{[]string{"--summary-top-devices=-1"}, nil, "(--summary-top-devices): must be a non-negative integer"},
+		{nil, map[string]string{"DEVICE_COUNT": "ten"}, `DEVICE_COUNT="ten" (--device-count): expected an integer such as 10`},
+		{nil, map[string]string{"FLUSH_TIMEOUT": "soon"}, `FLUSH_TIMEOUT="soon" (--flush-timeout): expected a duration such as 500ms, 30s or 5m`},
+		{nil, map[string]string{"CHAOS_DUPLICATE_RATE": "often"}, `CHAOS_DUPLICATE_RATE="often" (--chaos-duplicate-rate): expected a number such as 0.25`},
+		{[]string{"--config=/nonexistent/daemon.json"}, nil, "CONFIG=/nonexistent/daemon.json (--config)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			_, err := loadConfig(tt.args, envOf(tt.env))
+			if err == nil {
+				t.Fatal("loadConfig accepted the input")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not contain %q", err, tt.want)
+			}
+			if !strings.HasPrefix(err.Error(), "1 invalid setting(s)") {
+				t.Errorf("error %q reports more than the one bad input", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigConnection(t *testing.T) {
+	cfg, err := loadConfig(nil, envOf(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (connectionConfig{MaxReconnects: defaultMaxReconnects, ReconnectWait: defaultReconnectWait, ConnectTimeout: defaultConnectTimeout}); cfg.Connection != want {
+		t.Errorf("default connection %+v, want %+v", cfg.Connection, want)
+	}
+	cfg, err = loadConfig([]string{"--nats-connect-timeout=3s"}, envOf(map[string]string{"NATS_MAX_RECONNECTS": "-1", "NATS_RECONNECT_WAIT": "250ms", "NATS_CONNECT_TIMEOUT": "9s"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (connectionConfig{MaxReconnects: -1, ReconnectWait: 250 * time.Millisecond, ConnectTimeout: 3 * time.Second}); cfg.Connection != want {
+		t.Errorf("connection %+v, want %+v with the flag over the environment", cfg.Connection, want)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// FileConfig holds the structured settings that do not fit a flag or an environment
+// variable. It is read from the JSON file given by --config / DAEMON_CONFIG; every
+// section is optional and an absent file leaves all of them at their zero defaults.
+type FileConfig struct {
+	// Clock offsets keyed by device name (e.g. "DiskUnit-0003") or base device type
+	// (e.g. "CloudStorage"), an exact name takes precedence over the type.
+	ClockSkew map[string]ClockSkew `json:"clockSkew"`
+
+	// Value ranges keyed by metric type, merged over the built-in ranges.
+	MetricRanges map[string]ValueRange `json:"metricRanges"`
+	// Range for metric types that have none of their own, defaults to 0-100.
+	FallbackRange *ValueRange `json:"fallbackRange"`
+
+	// Relative weights for picking the source of random events, keyed by device name or
+	// base device type. Unlisted devices weigh 1 and a weight of 0 excludes a device.
+	EventWeights map[string]float64 `json:"eventWeights"`
+
+	// NATS subject per event type, overriding the security routing. Subjects must be below
+	// events.* unless ALLOW_FOREIGN_SUBJECTS is set.
+	EventSubjects map[string]string `json:"eventSubjects"`
+
+	// Model and firmware pools keyed by base device type, replacing the built-in lists.
+	Hardware map[string]HardwarePool `json:"hardware"`
+
+	// Scheduled silent periods and the clock they are evaluated against.
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows"`
+	MaintenanceClock   *MaintenanceClock   `json:"maintenanceClock"`
+
+	// Optional diurnal profile modulating metric values and the event rate.
+	LoadProfile *LoadProfile `json:"loadProfile"`
+}
+
+// ClockSkew shifts the timestamps a device reports away from the true time.
+type ClockSkew struct {
+	Offset       Duration `json:"offset"`       // Constant offset, e.g. "+2h" or "-45s"
+	DriftPerHour Duration `json:"driftPerHour"` // Additional offset accumulated per hour of uptime, e.g. "1.5s"
+}
+
+// Duration is a time.Duration written in config files as a Go duration string.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"45s\" or \"-2h\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Reads the daemon config file, rejecting unknown keys so typos do not go unnoticed
+func loadConfigFile(path string) (FileConfig, error) {
+	var fc FileConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fc, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&fc); err != nil {
+		return fc, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if fc.LoadProfile != nil {
+		if err := fc.LoadProfile.validate(); err != nil {
+			return fc, err
+		}
+	}
+	return fc, nil
+}
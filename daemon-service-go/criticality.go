@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Bounds of the criticality scale used by generated events.
+const (
+	minCriticality = 1
+	maxCriticality = 10
+)
+
+// namedCriticalityDistributions are presets accepted by CRITICALITY_DISTRIBUTION.
+var namedCriticalityDistributions = map[string]string{
+	"uniform":   "1-10:100",              // Every criticality is equally likely
+	"realistic": "1-3:70,4-7:25,8-10:5",  // Mostly low-severity events with rare criticals
+	"noisy":     "1-3:40,4-7:40,8-10:20", // A fleet in trouble, useful for alert-threshold demos
+}
+
+// criticalityBand is an inclusive criticality range and its share of generated events.
+type criticalityBand struct {
+	min    int
+	max    int
+	weight float64 // Normalized so that all bands of a distribution sum to 1
+}
+
+// criticalityDistribution picks event criticalities according to weighted bands.
+type criticalityDistribution struct {
+	bands []criticalityBand
+	total float64 // Sum of the configured weights before normalization, in percent
+}
+
+// Parses a named distribution or a weight table such as "1-3:70,4-7:25,8-10:5".
+// Weights are normalized when they do not sum to 100; the original sum is kept in total.
+func parseCriticalityDistribution(spec string) (criticalityDistribution, error) {
+	spec = strings.TrimSpace(spec)
+	if named, ok := namedCriticalityDistributions[strings.ToLower(spec)]; ok {
+		spec = named
+	}
+
+	var dist criticalityDistribution
+	covered := make(map[int]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		rangePart, weightPart, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return dist, fmt.Errorf("entry %q: expected <min>-<max>:<weight>", entry)
+		}
+
+		minStr, maxStr, isRange := strings.Cut(rangePart, "-")
+		if !isRange {
+			maxStr = minStr
+		}
+		lo, err := strconv.Atoi(strings.TrimSpace(minStr))
+		if err != nil {
+			return dist, fmt.Errorf("entry %q: invalid lower bound: %v", entry, err)
+		}
+		hi, err := strconv.Atoi(strings.TrimSpace(maxStr))
+		if err != nil {
+			return dist, fmt.Errorf("entry %q: invalid upper bound: %v", entry, err)
+		}
+		if lo < minCriticality || hi > maxCriticality || lo > hi {
+			return dist, fmt.Errorf("entry %q: range must lie within %d-%d", entry, minCriticality, maxCriticality)
+		}
+		for c := lo; c <= hi; c++ {
+			if covered[c] {
+				return dist, fmt.Errorf("entry %q: criticality %d is covered by more than one range", entry, c)
+			}
+			covered[c] = true
+		}
+
+		weight, err := strconv.ParseFloat(strings.TrimSpace(weightPart), 64)
+		if err != nil || weight < 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+			return dist, fmt.Errorf("entry %q: weight must be a non-negative number", entry)
+		}
+
+		dist.bands = append(dist.bands, criticalityBand{min: lo, max: hi, weight: weight})
+		dist.total += weight
+	}
+
+	if dist.total <= 0 {
+		return dist, fmt.Errorf("weights must sum to a positive value")
+	}
+	for i := range dist.bands {
+		dist.bands[i].weight /= dist.total
+	}
+	return dist, nil
+}
+
+// Reports whether the configured weights had to be normalized to reach 100%.
+func (d criticalityDistribution) normalized() bool {
+	return math.Abs(d.total-100) > 1e-9
+}
+
+// Draws a criticality: first a band by weight, then a uniform value inside it
+func (d criticalityDistribution) sample(randGen *rand.Rand) int {
+	r := randGen.Float64()
+	for _, band := range d.bands {
+		if r < band.weight {
+			return band.min + randGen.Intn(band.max-band.min+1)
+		}
+		r -= band.weight
+	}
+	// Floating point leftovers land in the last band that has any weight
+	for i := len(d.bands) - 1; i > 0; i-- {
+		if d.bands[i].weight > 0 {
+			return d.bands[i].min + randGen.Intn(d.bands[i].max-d.bands[i].min+1)
+		}
+	}
+	return d.bands[0].min + randGen.Intn(d.bands[0].max-d.bands[0].min+1)
+}
+
+func (d criticalityDistribution) String() string {
+	parts := make([]string, 0, len(d.bands))
+	for _, band := range d.bands {
+		parts = append(parts, fmt.Sprintf("%d-%d:%.1f%%", band.min, band.max, band.weight*100))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestParseCriticalityDistribution(t *testing.T) {
+	tests := []struct {
+		spec           string
+		want           string // String of the distribution
+		wantNormalized bool
+		wantErr        bool
+	}{
+		{spec: "realistic", want: "1-3:70.0%,4-7:25.0%,8-10:5.0%"},
+		{spec: "Uniform", want: "1-10:100.0%"},
+		{spec: "1-5:1, 6-10:3", want: "1-5:25.0%,6-10:75.0%", wantNormalized: true},
+		{spec: "10:100", want: "10-10:100.0%"},
+		{spec: "1-3:50,8-10:50", want: "1-3:50.0%,8-10:50.0%"},
+		{spec: "1-3", wantErr: true},
+		{spec: "0-3:100", wantErr: true},
+		{spec: "5-11:100", wantErr: true},
+		{spec: "7-3:100", wantErr: true},
+		{spec: "1-5:50,5-10:50", wantErr: true},
+		{spec: "1-10:-1", wantErr: true},
+		{spec: "1-10:NaN", wantErr: true},
+		{spec: "1-5:0,6-10:0", wantErr: true},
+		{spec: "dramatic", wantErr: true},
+	}
+	for _, tt := range tests {
+		dist, err := parseCriticalityDistribution(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCriticalityDistribution(%q) = %v, want error %t", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if dist.String() != tt.want || dist.normalized() != tt.wantNormalized {
+			t.Errorf("parseCriticalityDistribution(%q) = %s (normalized %t), want %s (%t)", tt.spec, dist, dist.normalized(), tt.want, tt.wantNormalized)
+		}
+	}
+}
+
+func TestCriticalityDistributionProportions(t *testing.T) {
+	const events = 100000
+	const tolerance = 0.01
+	for _, spec := range []string{"realistic", "noisy", "1-3:50,8-10:50"} {
+		t.Run(spec, func(t *testing.T) {
+			dist, err := parseCriticalityDistribution(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			randGen := rand.New(rand.NewSource(42))
+			counts := map[int]int{}
+			for range events {
+				c := dist.sample(randGen)
+				if c < minCriticality || c > maxCriticality {
+					t.Fatalf("sampled criticality %d out of range", c)
+				}
+				counts[c]++
+			}
+			for _, band := range dist.bands {
+				inBand := 0
+				for c := band.min; c <= band.max; c++ {
+					inBand += counts[c]
+					// Uniform within the band
+					if want := band.weight / float64(band.max-band.min+1); math.Abs(float64(counts[c])/events-want) > tolerance {
+						t.Errorf("criticality %d in %.3f of the events, want %.3f", c, float64(counts[c])/events, want)
+					}
+				}
+				if share := float64(inBand) / events; math.Abs(share-band.weight) > tolerance {
+					t.Errorf("band %d-%d has %.3f of the events, want %.3f", band.min, band.max, share, band.weight)
+				}
+			}
+			for c := minCriticality; c <= maxCriticality; c++ {
+				covered := false
+				for _, band := range dist.bands {
+					covered = covered || c >= band.min && c <= band.max
+				}
+				if !covered && counts[c] > 0 {
+					t.Errorf("criticality %d outside every band sampled %d time(s)", c, counts[c])
+				}
+			}
+		})
+	}
+}
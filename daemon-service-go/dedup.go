@@ -0,0 +1,55 @@
+package main
+
+import "time"
+
+// dedupConfig controls the producer-side debouncing of repeated events.
+type dedupConfig struct {
+	Window          time.Duration // Repeats of an event type on a device within this window are suppressed, 0 disables it
+	OccurrenceCount bool          // Attach the number of occurrences since the last emitted event to the next one
+}
+
+// dedupState is the debounce state of one event type on one device.
+type dedupState struct {
+	emitted    time.Time // True time the event type was last emitted
+	suppressed int       // Occurrences suppressed since then
+}
+
+// Decides whether the event is emitted. Repeats of the event type within the window after
+// the last emitted one are suppressed and counted; the first event after the window carries
+// the occurrence count when configured. Quiet event types are evicted, so the state stays
+// bounded per device.
+func (c dedupConfig) emit(dev *device, event *Event, now time.Time) bool {
+	if c.Window <= 0 {
+		return true
+	}
+	c.evict(dev, now)
+
+	state, seen := dev.dedup[event.EventType]
+	if seen && now.Sub(state.emitted) < c.Window {
+		state.suppressed++
+		dev.dedup[event.EventType] = state
+		return false
+	}
+	if c.OccurrenceCount && state.suppressed > 0 {
+		event.OccurrenceCount = state.suppressed + 1
+	}
+	if dev.dedup == nil {
+		dev.dedup = make(map[string]dedupState)
+	}
+	dev.dedup[event.EventType] = dedupState{emitted: now}
+	return true
+}
+
+// Drops the state of event types that were last emitted before the window. With occurrence
+// counts, a type with suppressed occurrences is kept until its next event carries them,
+// which still bounds the state by the number of event types.
+func (c dedupConfig) evict(dev *device, now time.Time) {
+	for eventType, state := range dev.dedup {
+		if now.Sub(state.emitted) >= c.Window && (state.suppressed == 0 || !c.OccurrenceCount) {
+			delete(dev.dedup, eventType)
+		}
+	}
+	if len(dev.dedup) == 0 {
+		dev.dedup = nil
+	}
+}
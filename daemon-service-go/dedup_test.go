@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDedupSuppressesAndReleases(t *testing.T) {
+	c := dedupConfig{Window: 10 * time.Second, OccurrenceCount: true}
+	dev := newDevice("StorageArray-0001", "StorageArray")
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		at        time.Duration
+		eventType string
+		wantEmit  bool
+		wantCount int // OccurrenceCount of an emitted event
+	}{
+		{0, "DriveFailure", true, 0},
+		{2 * time.Second, "DriveFailure", false, 0},
+		{5 * time.Second, "DataCorruption", true, 0}, // Types are debounced independently
+		{9 * time.Second, "DriveFailure", false, 0},
+		{10 * time.Second, "DriveFailure", true, 3}, // The window is over: released with both repeats
+		{11 * time.Second, "DriveFailure", false, 0},
+		{40 * time.Second, "DriveFailure", true, 2},
+		{60 * time.Second, "DriveFailure", true, 0}, // Nothing suppressed since
+	}
+	for _, s := range steps {
+		event := Event{EventType: s.eventType, SourceDevice: dev.Name}
+		if got := c.emit(dev, &event, start.Add(s.at)); got != s.wantEmit || event.OccurrenceCount != s.wantCount {
+			t.Errorf("%s at %s: emitted %t with count %d, want %t with %d", s.eventType, s.at, got, event.OccurrenceCount, s.wantEmit, s.wantCount)
+		}
+	}
+
+	c.evict(dev, start.Add(2*time.Minute))
+	if dev.dedup != nil {
+		t.Errorf("state %v kept after every window ended", dev.dedup)
+	}
+
+	off := dedupConfig{}
+	for range 3 {
+		if !off.emit(dev, &Event{EventType: "DriveFailure"}, start) {
+			t.Fatal("suppressed an event with deduplication off")
+		}
+	}
+}
+
+// Runs one device with a fixed seed and checks the emitted random events against the window
+func TestDedupWithFixedSeed(t *testing.T) {
+	const window = 20 * time.Second
+	var out bytes.Buffer
+	settings := newTestSettings(t, &out, time.Second)
+	settings.dedup = dedupConfig{Window: window, OccurrenceCount: true}
+	settings.eventShare = func(*device) float64 { return 4 } // 4·fleetEventProbability: an event every cycle
+	g := newDeviceGenerator(newDevice("StorageArray-0001", "StorageArray"), 42, settings)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 600 {
+		if err := g.cycle(start.Add(time.Duration(i) * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	last := map[string]time.Time{}
+	emitted, counted := 0, 0
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		_, payload, _ := strings.Cut(scanner.Text(), " ")
+		var event Event
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			t.Fatalf("malformed dry-run line %q", scanner.Text())
+		}
+		if !slices.Contains(eventTypes, event.EventType) {
+			continue
+		}
+		ts, _ := time.Parse(time.RFC3339Nano, event.Timestamp)
+		if prev, ok := last[event.EventType]; ok && ts.Sub(prev) < window {
+			t.Errorf("%s emitted %s after the previous one, within the %s window", event.EventType, ts.Sub(prev), window)
+		}
+		last[event.EventType] = ts
+		emitted++
+		if event.OccurrenceCount > 1 {
+			counted++
+		}
+	}
+
+	suppressed := uint64(0)
+	for _, n := range settings.pub.counter.lifetime.Suppressed {
+		suppressed += n
+	}
+	// 600 cycles with an event each: at most one emitted per type and window
+	if emitted < 60 || emitted > 3*600/int(window/time.Second)+3 {
+		t.Errorf("%d event(s) emitted in 600 cycles with a %s window", emitted, window)
+	}
+	if suppressed < 400 {
+		t.Errorf("%d event(s) suppressed, want most of them", suppressed)
+	}
+	if counted < emitted/2 {
+		t.Errorf("%d of %d emitted events carry an occurrence count, want the released ones", counted, emitted)
+	}
+}
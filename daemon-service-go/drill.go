@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Drill defaults.
+const (
+	defaultDrillEventType = "UnauthorizedAccess"
+	defaultDrillDevice    = "StorageArray"
+)
+
+// drillConfig selects the event fired on demand for incident-response drills.
+type drillConfig struct {
+	EventType string
+	Device    string
+}
+
+// Publishes a drill event on every SIGUSR1 (criticality 10) and SIGUSR2 (criticality 1)
+// until ctx is cancelled. Drill events bypass the event probability but otherwise take
+// the normal publish path, so they are routed and counted like any other event.
+func (c drillConfig) run(ctx context.Context, pub *publisher) error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sigChan)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sig := <-sigChan:
+			trigger, criticality := "SIGUSR2", minCriticality
+			if sig == syscall.SIGUSR1 {
+				trigger, criticality = "SIGUSR1", maxCriticality
+			}
+			event := c.event(trigger, criticality, time.Now())
+			log.Printf("Daemon: DRILL: %s received, publishing drill event [%s] from [%s] with criticality [%d] (ID %s)",
+				trigger, event.EventType, event.SourceDevice, event.Criticality, event.ID)
+			if err := pub.publishEvent(event); err != nil {
+				log.Printf("Daemon: DRILL: Failed to publish drill event %s: %v", event.ID, err)
+			}
+		}
+	}
+}
+
+// Returns a drill event naming the signal that triggered it
+func (c drillConfig) event(trigger string, criticality int, now time.Time) Event {
+	return Event{
+		ID:           uuid.New().String(),
+		Criticality:  criticality,
+		Timestamp:    now.Format(time.RFC3339Nano),
+		SourceDevice: c.Device,
+		EventType:    c.EventType,
+		EventMessage: fmt.Sprintf("DRILL: test event triggered by %s, no action required", trigger),
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// dryRunWriter replaces NATS in dry-run mode: every would-be publish becomes one line
+// holding the subject, a space and the payload. Lines from concurrent generators never
+// interleave.
+type dryRunWriter struct {
+	mu  sync.Mutex
+	out *bufio.Writer
+}
+
+func newDryRunWriter(out io.Writer) *dryRunWriter {
+	return &dryRunWriter{out: bufio.NewWriter(out)}
+}
+
+// Writes a message as a single line and flushes it, so a piped consumer sees it immediately
+func (w *dryRunWriter) send(subject string, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.out.WriteString(subject)
+	w.out.WriteByte(' ')
+	w.out.Write(data)
+	w.out.WriteByte('\n')
+	return w.out.Flush()
+}
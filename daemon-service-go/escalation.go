@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Defaults of the event escalation.
+const (
+	defaultEscalationWindow = 5 * time.Minute
+	defaultEscalationStep   = 2
+)
+
+// escalationConfig controls how repeated incidents on a device escalate.
+type escalationConfig struct {
+	Window time.Duration // Repeats of an event type within this window escalate, 0 disables escalation
+	Step   int           // Criticality added per repeat, capped at maxCriticality
+}
+
+// incident is the recent history of one event type on one device.
+type incident struct {
+	occurrences int       // Occurrences since the history was last reset
+	last        time.Time // True time of the latest occurrence
+}
+
+// Reports whether repeated incidents escalate
+func (c escalationConfig) enabled() bool {
+	return c.Window > 0 && c.Step > 0
+}
+
+// Escalates the event when the same type fired on the device within the window: its
+// criticality grows by Step per earlier occurrence and the message carries the count.
+// Histories of quiet event types are evicted, so the state stays bounded per device.
+func (c escalationConfig) apply(dev *device, event *Event, now time.Time) {
+	if !c.enabled() {
+		return
+	}
+	c.evict(dev, now)
+
+	inc := dev.incidents[event.EventType]
+	inc.occurrences++
+	inc.last = now
+	if dev.incidents == nil {
+		dev.incidents = make(map[string]incident)
+	}
+	dev.incidents[event.EventType] = inc
+
+	if inc.occurrences == 1 {
+		return
+	}
+	event.Criticality = min(maxCriticality, event.Criticality+(inc.occurrences-1)*c.Step)
+	note := fmt.Sprintf("occurrence %d within %s", inc.occurrences, c.Window)
+	if event.EventMessage == "" {
+		event.EventMessage = "Repeated incident: " + note
+	} else {
+		event.EventMessage += " (" + note + ")"
+	}
+}
+
+// Drops the histories of event types that did not fire within the window
+func (c escalationConfig) evict(dev *device, now time.Time) {
+	for eventType, inc := range dev.incidents {
+		if now.Sub(inc.last) > c.Window {
+			delete(dev.incidents, eventType)
+		}
+	}
+	if len(dev.incidents) == 0 {
+		dev.incidents = nil
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"daemon-service-go/pkg/simulator"
+)
+
+// Names of the enclosure hierarchy.
+const (
+	enclosureName  = "Enclosure" // Name prefix of the enclosures grouping disk units
+	diskDeviceType = "DiskUnit"  // Base device type placed inside enclosures
+)
+
+// device is one simulated device of the fleet together with its metric state.
+//
+// The state is intentionally small: the name, the base type, the lifecycle status, the
+// clock skew and one float64 per metric type, which is roughly 350 bytes per device
+// including map overhead.
+// A fleet of 100k devices therefore stays in the tens of megabytes.
+type device struct {
+	*simulator.Device // Name, type, parent, hardware and the metric state of the value models
+
+	status    string    // Lifecycle state: online, offline or maintenance
+	downUntil time.Time // When an offline or maintenance period ends
+
+	maintenanceWindows  []*maintenanceWindow // Scheduled silent periods of the device
+	inMaintenanceWindow bool                 // Whether one of the windows is currently open
+
+	clockOffset time.Duration // Constant skew of the device clock
+	clockDrift  time.Duration // Skew accumulated per hour since clockSince
+	clockSince  time.Time
+
+	eventWeight float64 // Relative weight in the fleet's random events, 0 excludes the device
+
+	incidents   map[string]incident   // Recent incidents per event type driving escalation, nil when quiet
+	resolutions []pendingResolution   // Resolved events scheduled for open incidents
+	dedup       map[string]dedupState // Debounce state per event type, nil when quiet
+	rebuild     *rebuild              // RAID rebuild in progress, nil when none
+}
+
+func newDevice(name, deviceType string) *device {
+	return &device{Device: simulator.NewDevice(name, deviceType), status: deviceOnline}
+}
+
+// Expands the base device types into the simulated fleet.
+// A count of 0 keeps one device per base type named after the type itself; otherwise
+// count uniquely named devices are distributed round-robin across the base types and
+// numbered per type, e.g. StorageArray-0001, DiskUnit-0001, CloudStorage-0001, StorageArray-0002.
+func buildFleet(count int, deviceTypes []string) []*device {
+	if count <= 0 {
+		fleet := make([]*device, 0, len(deviceTypes))
+		for _, deviceType := range deviceTypes {
+			fleet = append(fleet, newDevice(deviceType, deviceType))
+		}
+		return fleet
+	}
+
+	perType := (count + len(deviceTypes) - 1) / len(deviceTypes)
+	width := max(4, len(strconv.Itoa(perType)))
+
+	fleet := make([]*device, 0, count)
+	for i := 0; i < count; i++ {
+		deviceType := deviceTypes[i%len(deviceTypes)]
+		name := fmt.Sprintf("%s-%0*d", deviceType, width, i/len(deviceTypes)+1)
+		fleet = append(fleet, newDevice(name, deviceType))
+	}
+	return fleet
+}
+
+// Builds disksPerEnclosure disk units in each enclosure, named after and parented to it,
+// e.g. Enclosure-01-DiskUnit-01 .. Enclosure-01-DiskUnit-12, Enclosure-02-DiskUnit-01.
+// Enclosures only group the disks; they do not report metrics or events themselves.
+func buildEnclosures(enclosures, disksPerEnclosure int) []*device {
+	enclosureWidth := max(2, len(strconv.Itoa(enclosures)))
+	diskWidth := max(2, len(strconv.Itoa(disksPerEnclosure)))
+
+	disks := make([]*device, 0, enclosures*disksPerEnclosure)
+	for e := 1; e <= enclosures; e++ {
+		enclosure := fmt.Sprintf("%s-%0*d", enclosureName, enclosureWidth, e)
+		for d := 1; d <= disksPerEnclosure; d++ {
+			disk := newDevice(fmt.Sprintf("%s-%s-%0*d", enclosure, diskDeviceType, diskWidth, d), diskDeviceType)
+			disk.Parent = enclosure
+			disks = append(disks, disk)
+		}
+	}
+	return disks
+}
+
+// Builds the whole fleet: the flat fleet of count devices, or, when enclosures are
+// configured, the flat fleet without disk units plus the enclosure hierarchy.
+func buildFleetWithEnclosures(count, enclosures, disksPerEnclosure int) []*device {
+	if enclosures <= 0 {
+		return buildFleet(count, sourceDevices)
+	}
+	topLevel := slices.DeleteFunc(slices.Clone(sourceDevices), func(t string) bool { return t == diskDeviceType })
+	return append(buildFleet(count, topLevel), buildEnclosures(enclosures, disksPerEnclosure)...)
+}
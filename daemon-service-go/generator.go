@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"daemon-service-go/pkg/simulator"
+)
+
+// fleetEventProbability is the chance per generation cycle that some device of the fleet
+// reports an incident. Each device gets its weighted share, so the fleet-wide rate does not
+// depend on the fleet size.
+const fleetEventProbability = 0.25
+
+// generatorSettings is the read-only configuration shared by all device generators.
+type generatorSettings struct {
+	interval    time.Duration
+	cycles      int // Bounded-run number of cycles per device, 0 runs until cancelled
+	lifecycle   lifecycleConfig
+	metadata    map[string]metricMetadata
+	profile     *LoadProfile // Optional diurnal load profile, nil for a flat load
+	escalation  escalationConfig
+	resolution  resolutionConfig
+	maintenance maintenanceClock
+	simulator   simulator.Config          // Value models shared by every device's simulator.Generator
+	eventShare  func(dev *device) float64 // Share of the fleet's random events, set by the fleet runner
+	cardinality *cardinalityTest          // Optional stress mode renaming devices every cycle, nil when off
+	dedup       dedupConfig
+	rebuild     rebuildConfig
+	backfill    *backfill // Optional history synthesized before real-time generation, nil when off
+	pub         *publisher
+}
+
+// deviceGenerator produces the metrics and events of a single device on its own schedule.
+// Its RNG and the device state are owned by the generator goroutine, so nothing is shared.
+type deviceGenerator struct {
+	dev         *device
+	randGen     *rand.Rand
+	sim         *simulator.Generator // Draws from randGen at the time of the current cycle
+	now         time.Time            // Time of the current cycle, the clock of sim
+	settings    *generatorSettings
+	backfilling bool // Marks published messages as backfill while history is synthesized
+	sent        int  // Metrics and events handed to the publisher, for the backfill rate limit
+}
+
+func newDeviceGenerator(dev *device, masterSeed int64, settings *generatorSettings) *deviceGenerator {
+	g := &deviceGenerator{dev: dev, randGen: newDeviceRand(masterSeed, dev.Name), settings: settings}
+	g.sim = simulator.New(settings.simulator, func() time.Time { return g.now }, g.randGen)
+	return g
+}
+
+// Runs generation cycles until ctx is cancelled or the bounded number of cycles is done,
+// after the backfill if one is configured. The first real-time cycle starts at a random offset within the interval so that devices do not all
+// publish in lockstep. A non-nil error stops the whole daemon; errMessageLimitReached
+// means the bounded run is complete.
+func (g *deviceGenerator) run(ctx context.Context) error {
+	if b := g.settings.backfill; b != nil {
+		if err := b.run(ctx, g); err != nil {
+			return fmt.Errorf("device %s: backfill: %w", g.dev.Name, err)
+		}
+	}
+
+	offset := time.Duration(g.randGen.Int63n(int64(g.settings.interval)))
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-time.After(offset):
+	}
+
+	ticker := time.NewTicker(g.settings.interval)
+	defer ticker.Stop()
+
+	for cycle := 1; ; cycle++ {
+		if err := g.cycle(time.Now()); err != nil {
+			return fmt.Errorf("device %s: %w", g.dev.Name, err)
+		}
+		if g.settings.cycles > 0 && cycle >= g.settings.cycles {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Advances the device lifecycle and publishes the device's metric and, occasionally, an event
+func (g *deviceGenerator) cycle(now time.Time) error {
+	g.now = now
+	s := g.settings
+	dev := g.dev
+	if s.cardinality != nil {
+		if err := s.cardinality.rename(dev); err != nil {
+			return err
+		}
+	}
+
+	if event := s.lifecycle.step(dev, now, g.randGen); event != nil {
+		if err := g.publishEvent(*event); isFatalPublishError(err) {
+			return err
+		}
+	}
+	if event := s.maintenance.step(dev, now); event != nil {
+		if err := g.publishEvent(*event); isFatalPublishError(err) {
+			return err
+		}
+	}
+	if dev.status != deviceOnline || dev.inMaintenanceWindow {
+		return nil
+	}
+	for _, event := range s.resolution.due(dev, now) {
+		if err := g.publishEvent(event); isFatalPublishError(err) {
+			return err
+		}
+	}
+
+	load := s.profile.factor(now)
+
+	metric := g.sim.Metric(dev.Device)
+	if dev.skewed() {
+		metric.Timestamp = dev.clock(now).Format(time.RFC3339Nano)
+	}
+	if s.profile.modulates(metric.MetricType) {
+		metric.Value *= load
+	}
+	applyMetricMetadata(&metric, s.metadata)
+	if dev.skewed() {
+		log.Printf("Daemon: Device [%s] clock is skewed: reporting %s at true time %s", dev.Name, metric.Timestamp, now.Format(time.RFC3339Nano))
+	}
+	if err := g.publishMetric(metric); isFatalPublishError(err) {
+		return err
+	}
+
+	if dev.rebuild != nil {
+		progress, complete := s.rebuild.step(dev, now)
+		if err := g.publishMetric(rebuildMetric(dev, progress, now)); isFatalPublishError(err) {
+			return err
+		}
+		if complete != nil {
+			if err := g.publishEvent(*complete); isFatalPublishError(err) {
+				return err
+			}
+		}
+	}
+
+	if event := capacityWarning(dev, now, g.randGen); event != nil {
+		if err := g.publishEvent(*event); isFatalPublishError(err) {
+			return err
+		}
+	}
+
+	// Generate and publish events with a lower probability
+	if g.randGen.Float64() < fleetEventProbability*s.eventShare(dev)*load {
+		event := g.sim.Event(dev.Device)
+		if dev.skewed() {
+			event.Timestamp = dev.clock(now).Format(time.RFC3339Nano)
+		}
+		if !s.dedup.emit(dev, &event, now) {
+			s.pub.counter.recordSuppressed(event.EventType)
+			return nil
+		}
+		s.escalation.apply(dev, &event, now)
+		s.resolution.open(dev, &event, now, g.randGen)
+		s.rebuild.start(dev, event, now, g.randGen)
+		if err := g.publishEvent(event); isFatalPublishError(err) {
+			return err
+		}
+		return nil
+	}
+	if dev.incidents != nil {
+		s.escalation.evict(dev, now)
+	}
+	if dev.dedup != nil {
+		s.dedup.evict(dev, now)
+	}
+	return nil
+}
+
+// Publishes a metric of the device, marked as backfill while history is synthesized
+func (g *deviceGenerator) publishMetric(metric DeviceMetric) error {
+	metric.Backfill = g.backfilling
+	g.sent++
+	return g.settings.pub.publishMetric(metric)
+}
+
+// Publishes an event of the device, marked as backfill while history is synthesized
+func (g *deviceGenerator) publishEvent(event Event) error {
+	event.Backfill = g.backfilling
+	g.sent++
+	return g.settings.pub.publishEvent(event)
+}
+
+// Reports whether a publish error means generation has to stop: either no further publish
+// can succeed or the bounded-run message limit was reached
+func isFatalPublishError(err error) bool {
+	return errors.Is(err, nats.ErrConnectionClosed) || errors.Is(err, errMessageLimitReached)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"daemon-service-go/pkg/simulator"
+)
+
+// newTestSettings returns generator settings publishing in dry-run mode to out, without
+// any optional behavior. Publish logs are discarded for the duration of the test.
+func newTestSettings(t testing.TB, out io.Writer, interval time.Duration) *generatorSettings {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	router, err := newEventRouter(defaultSecurityEventTypes, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startedAt := time.Now()
+	maintenance, err := newMaintenanceClock(nil, startedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &generatorSettings{
+		interval:    interval,
+		maintenance: maintenance,
+		simulator:   simulator.DefaultConfig(),
+		pub: &publisher{
+			dryRun:  newDryRunWriter(out),
+			stats:   &publishStats{},
+			router:  router,
+			counter: newGenerationCounter(startedAt, defaultSummaryTopDevices),
+		},
+	}
+}
+
+// dryRunMessages parses the lines of a dry-run writer into their subjects and source devices
+func dryRunMessages(t *testing.T, out string) (subjects, devices map[string]int) {
+	t.Helper()
+	subjects, devices = map[string]int{}, map[string]int{}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		subject, payload, ok := strings.Cut(scanner.Text(), " ")
+		var msg struct {
+			SourceDevice string `json:"sourceDevice"`
+		}
+		if !ok || json.Unmarshal([]byte(payload), &msg) != nil {
+			t.Fatalf("malformed dry-run line %q", scanner.Text())
+		}
+		subjects[subject]++
+		devices[msg.SourceDevice]++
+	}
+	return subjects, devices
+}
+
+func TestFleetRunnerRunsManyDevicesConcurrently(t *testing.T) {
+	const devices = 100
+	const interval = 10 * time.Millisecond
+	out := &syncBuffer{}
+	settings := newTestSettings(t, out, interval)
+	fleet := buildFleet(devices, sourceDevices)
+
+	baseline := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runner := newFleetRunner(ctx, settings, 7)
+	for _, dev := range fleet {
+		runner.start(dev)
+	}
+	if running := runtime.NumGoroutine() - baseline; running < devices || running > devices+5 {
+		t.Errorf("%d goroutine(s) for %d devices, want one per device", running, devices)
+	}
+	if runner.size() != devices {
+		t.Errorf("runner reports %d generator(s), want %d", runner.size(), devices)
+	}
+
+	time.Sleep(2 * time.Second)
+	cancel() // Like a shutdown signal
+	if err := runner.wait(); err != nil {
+		t.Fatalf("runner stopped with %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline+2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond) // Context goroutines may still be unwinding
+	}
+	if leaked := runtime.NumGoroutine() - baseline; leaked > 2 {
+		t.Errorf("%d goroutine(s) left after shutdown", leaked)
+	}
+
+	subjects, perDevice := dryRunMessages(t, out.String())
+	if len(perDevice) != devices {
+		t.Errorf("%d device(s) published, want %d", len(perDevice), devices)
+	}
+	for _, dev := range fleet {
+		if perDevice[dev.Name] < 10 {
+			t.Errorf("device %s published %d message(s) in 2s at a %s interval", dev.Name, perDevice[dev.Name], interval)
+		}
+	}
+	if got := settings.pub.stats.metrics.Load(); got != uint64(subjects[DeviceMetricsSubject]) {
+		t.Errorf("counted %d metric(s), wrote %d", got, subjects[DeviceMetricsSubject])
+	}
+}
+
+func TestFleetRunnerStopsOneDevice(t *testing.T) {
+	settings := newTestSettings(t, io.Discard, 10*time.Millisecond)
+	fleet := buildFleet(3, sourceDevices)
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := newFleetRunner(ctx, settings, 7)
+	for _, dev := range fleet {
+		runner.start(dev)
+	}
+
+	if dev := runner.stop(fleet[1].Name); dev != fleet[1] {
+		t.Errorf("stop returned %v, want the stopped device", dev)
+	}
+	if runner.stop("unknown") != nil {
+		t.Error("stop of an unknown device returned a device")
+	}
+	if runner.size() != 2 {
+		t.Errorf("%d generator(s) running, want 2", runner.size())
+	}
+	cancel()
+	if err := runner.wait(); err != nil {
+		t.Errorf("runner stopped with %v", err)
+	}
+}
+
+func BenchmarkDeviceCycle(b *testing.B) {
+	settings := newTestSettings(b, io.Discard, time.Second)
+	settings.eventShare = func(*device) float64 { return 1 }
+	g := newDeviceGenerator(newDevice("StorageArray-0001", "StorageArray"), 7, settings)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := g.cycle(now); err != nil {
+			b.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"slices"
+)
+
+// HardwarePool lists the models and firmware versions a device type is drawn from.
+type HardwarePool struct {
+	Models   []string `json:"models"`
+	Firmware []string `json:"firmware"`
+}
+
+// defaultHardware is the built-in hardware pool per base device type.
+var defaultHardware = map[string]HardwarePool{
+	"StorageArray": {Models: []string{"SA-4000", "SA-5200", "SA-7000X"}, Firmware: []string{"4.2.1", "4.3.0", "5.0.2"}},
+	"DiskUnit":     {Models: []string{"HDD-12T-7K2", "HDD-18T-7K2", "SSD-3T84-NV", "SSD-7T68-NV"}, Firmware: []string{"FW21", "FW23", "FW24A"}},
+	"CloudStorage": {Models: []string{"CGW-100", "CGW-200"}, Firmware: []string{"2024.06", "2025.01"}},
+}
+
+// Assigns every device a model and firmware version from the pool of its base type.
+// Overrides keyed by device type replace the matching built-in list; the picks only depend
+// on randGen's seed and the fleet order, so a device keeps its identity for the whole run.
+func assignHardware(fleet []*device, overrides map[string]HardwarePool, randGen *rand.Rand) {
+	for deviceType := range overrides {
+		if !slices.Contains(sourceDevices, deviceType) {
+			log.Printf("Daemon Service (Go): Ignoring hardware pool for unknown device type '%s'", deviceType)
+		}
+	}
+
+	for _, dev := range fleet {
+		pool := hardwarePool(dev.Type, overrides)
+		dev.Model = pick(pool.Models, randGen)
+		dev.Firmware = pick(pool.Firmware, randGen)
+	}
+}
+
+// Returns the hardware pool of the device type, with the lists given in overrides
+// replacing the built-in ones
+func hardwarePool(deviceType string, overrides map[string]HardwarePool) HardwarePool {
+	pool := defaultHardware[deviceType]
+	if o, ok := overrides[deviceType]; ok {
+		if len(o.Models) > 0 {
+			pool.Models = o.Models
+		}
+		if len(o.Firmware) > 0 {
+			pool.Firmware = o.Firmware
+		}
+	}
+	return pool
+}
+
+// Returns a random element of values, or "" when there is none
+func pick(values []string, randGen *rand.Rand) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[randGen.Intn(len(values))]
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssignHardware(t *testing.T) {
+	overrides := map[string]HardwarePool{"DiskUnit": {Models: []string{"HDD-20T-7K2"}}}
+	fleet := buildFleet(30, sourceDevices)
+	assignHardware(fleet, overrides, rand.New(rand.NewSource(7)))
+	again := buildFleet(30, sourceDevices)
+	assignHardware(again, overrides, rand.New(rand.NewSource(7)))
+
+	for i, dev := range fleet {
+		pool := hardwarePool(dev.Type, overrides)
+		if !slices.Contains(pool.Models, dev.Model) || !slices.Contains(pool.Firmware, dev.Firmware) {
+			t.Errorf("%s got %s/%s outside its pool %+v", dev.Name, dev.Model, dev.Firmware, pool)
+		}
+		if dev.Type == "DiskUnit" && (dev.Model != "HDD-20T-7K2" || !slices.Contains(defaultHardware["DiskUnit"].Firmware, dev.Firmware)) {
+			t.Errorf("%s got %s/%s, want the overridden model with a built-in firmware", dev.Name, dev.Model, dev.Firmware)
+		}
+		if again[i].Model != dev.Model || again[i].Firmware != dev.Firmware {
+			t.Errorf("%s got %s/%s and %s/%s with the same seed", dev.Name, dev.Model, dev.Firmware, again[i].Model, again[i].Firmware)
+		}
+	}
+}
+
+func TestDeviceReportsTheSameHardwareWithinARun(t *testing.T) {
+	var out bytes.Buffer
+	settings := newTestSettings(t, &out, time.Second)
+	settings.eventShare = func(*device) float64 { return 1 }
+	fleet := buildFleet(9, sourceDevices)
+	assignHardware(fleet, nil, rand.New(rand.NewSource(7)))
+	want := map[string]string{}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, dev := range fleet {
+		want[dev.Name] = dev.Model + "/" + dev.Firmware
+		g := newDeviceGenerator(dev, 7, settings)
+		for i := range 200 {
+			if err := g.cycle(now.Add(time.Duration(i) * time.Second)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(&out)
+	messages := 0
+	for scanner.Scan() {
+		_, payload, _ := strings.Cut(scanner.Text(), " ")
+		var msg struct {
+			SourceDevice string `json:"sourceDevice"`
+			Model        string `json:"model"`
+			Firmware     string `json:"firmware"`
+		}
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			t.Fatalf("malformed dry-run line %q", scanner.Text())
+		}
+		if got := msg.Model + "/" + msg.Firmware; got != want[msg.SourceDevice] {
+			t.Fatalf("%s reported %s, want %s", msg.SourceDevice, got, want[msg.SourceDevice])
+		}
+		messages++
+	}
+	if messages < len(fleet)*200 {
+		t.Errorf("checked %d message(s), want at least a metric per cycle", messages)
+	}
+}
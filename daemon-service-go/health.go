@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// healthStaleCycles is the number of generation intervals without a successful publish
+// after which the daemon reports itself as not ready.
+const healthStaleCycles = 3
+
+// Represents the response of the /healthz endpoint.
+type Health struct {
+	Ready       bool            `json:"ready"`
+	Reason      string          `json:"reason,omitempty"` // Why the daemon is not ready
+	DryRun      bool            `json:"dryRun,omitempty"`
+	LastPublish string          `json:"lastPublish,omitempty"` // Time of the latest successful publish, absent before the first
+	Clusters    []ClusterStatus `json:"clusters"`
+}
+
+// healthServer serves /healthz from the publisher's state.
+type healthServer struct {
+	pub      *publisher
+	interval time.Duration // Generation interval, readiness allows healthStaleCycles of them between publishes
+	now      func() time.Time
+}
+
+func newHealthServer(pub *publisher, interval time.Duration) *healthServer {
+	return &healthServer{pub: pub, interval: interval, now: time.Now}
+}
+
+// Evaluates the current health
+func (h *healthServer) check() Health {
+	health := Health{DryRun: h.pub.dryRun != nil, Clusters: clusterStatuses(h.pub.clusters)}
+	last := h.pub.stats.lastPublish.Load()
+	lastPublish := time.Unix(0, last)
+	if last != 0 {
+		health.LastPublish = lastPublish.UTC().Format(time.RFC3339Nano)
+	}
+
+	switch {
+	case !health.DryRun && !slices.ContainsFunc(health.Clusters, func(c ClusterStatus) bool { return c.Connected }):
+		health.Reason = "not connected to any NATS cluster"
+		return health
+	case last == 0:
+		health.Reason = "nothing published yet"
+		return health
+	}
+	if stale := h.now().Sub(lastPublish); stale > healthStaleCycles*h.interval {
+		health.Reason = "no successful publish for " + stale.Round(time.Millisecond).String()
+		return health
+	}
+	health.Ready = true
+	return health
+}
+
+// Answers 200 when ready and 503 otherwise, with the health as JSON in both cases
+func (h *healthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	health := h.check()
+	w.Header().Set("Content-Type", "application/json")
+	if !health.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(health)
+}
+
+// Serves /healthz on addr until ctx is cancelled
+func (h *healthServer) run(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", h)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Daemon Service (Go): Serving health checks on http://%s/healthz", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Daemon Service (Go): Health endpoint failed: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthFollowsTheLastPublish(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clusters := connectFakeClusters(t, false, startFakeNATS(t, 1<<20, false))
+	tests := []struct {
+		name        string
+		pub         *publisher
+		lastPublish time.Time // Zero before the first publish
+		wantReady   bool
+		wantReason  string
+	}{
+		{name: "nothing published yet", pub: &publisher{clusters: clusters}, wantReason: "nothing published yet"},
+		{name: "recent publish", pub: &publisher{clusters: clusters}, lastPublish: now.Add(-time.Second), wantReady: true},
+		{name: "publish within the stale cycles", pub: &publisher{clusters: clusters}, lastPublish: now.Add(-healthStaleCycles * 2 * time.Second), wantReady: true},
+		{name: "stale publish", pub: &publisher{clusters: clusters}, lastPublish: now.Add(-7 * time.Second), wantReason: "no successful publish for 7s"},
+		{name: "not connected", pub: &publisher{}, lastPublish: now, wantReason: "not connected to any NATS cluster"},
+		{name: "dry run needs no cluster", pub: &publisher{dryRun: newDryRunWriter(nil)}, lastPublish: now, wantReady: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.pub.stats = &publishStats{}
+			if !tt.lastPublish.IsZero() {
+				tt.pub.stats.lastPublish.Store(tt.lastPublish.UnixNano())
+			}
+			h := newHealthServer(tt.pub, 2*time.Second)
+			h.now = func() time.Time { return now }
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			var health Health
+			if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+				t.Fatalf("decoding %q: %v", rec.Body, err)
+			}
+			wantStatus := http.StatusServiceUnavailable
+			if tt.wantReady {
+				wantStatus = http.StatusOK
+			}
+			if rec.Code != wantStatus || health.Ready != tt.wantReady || health.Reason != tt.wantReason {
+				t.Errorf("status %d, %+v; want %d, ready %t, reason %q", rec.Code, health, wantStatus, tt.wantReady, tt.wantReason)
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+				t.Errorf("content type %q", got)
+			}
+		})
+	}
+}
+
+func TestHealthFlipsWhenPublishingStops(t *testing.T) {
+	pub := &publisher{dryRun: newDryRunWriter(nil), stats: &publishStats{}}
+	h := newHealthServer(pub, time.Second)
+	now := time.Now()
+	h.now = func() time.Time { return now }
+
+	pub.stats.lastPublish.Store(now.UnixNano())
+	if !h.check().Ready {
+		t.Fatal("not ready right after a publish")
+	}
+	now = now.Add(healthStaleCycles*time.Second + time.Millisecond)
+	if h.check().Ready {
+		t.Error("still ready after publishing stopped for more than the stale cycles")
+	}
+	pub.stats.lastPublish.Store(now.UnixNano())
+	if !h.check().Ready {
+		t.Error("not ready again after a new publish")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Represents a daemon liveness message published to HeartbeatSubject.
+type Heartbeat struct {
+	InstanceID       string          `json:"instanceId"`
+	Hostname         string          `json:"hostname"`
+	Status           string          `json:"status"`           // "running" or "stopping"
+	Reason           string          `json:"reason,omitempty"` // Why the daemon is going down, set on the final heartbeat only
+	Timestamp        string          `json:"timestamp"`
+	UptimeSeconds    float64         `json:"uptimeSeconds"`
+	DeviceCount      int             `json:"deviceCount"`
+	MetricsPublished uint64          `json:"metricsPublished"`
+	EventsPublished  uint64          `json:"eventsPublished"`
+	Clusters         []ClusterStatus `json:"clusters"`
+	MessagesRetried  uint64          `json:"messagesRetried,omitempty"` // Failed publishes delivered by the retry queue
+	MessagesLost     uint64          `json:"messagesLost,omitempty"`    // Failed publishes the retry queue gave up on
+	ChaosDuplicates  uint64          `json:"chaosDuplicates,omitempty"` // Duplicates injected by the fault-injection mode
+	ChaosReordered   uint64          `json:"chaosReordered,omitempty"`  // Messages delayed by the fault-injection mode
+	ChaosMalformed   uint64          `json:"chaosMalformed,omitempty"`  // Payloads corrupted by the fault-injection mode
+}
+
+// Represents the delivery counters of one NATS cluster in a heartbeat.
+type ClusterStatus struct {
+	URL       string `json:"url"`
+	Connected bool   `json:"connected"`
+	Published uint64 `json:"published"`
+	Failed    uint64 `json:"failed"`
+}
+
+// heartbeater periodically reports the daemon's identity and publish totals.
+type heartbeater struct {
+	clusters    []*cluster
+	send        sendFunc
+	stats       *publishStats
+	instanceID  string
+	hostname    string
+	startedAt   time.Time
+	deviceCount func() int // Current fleet size
+}
+
+func newHeartbeater(pub *publisher, startedAt time.Time, deviceCount func() int) *heartbeater {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return &heartbeater{
+		clusters:    pub.clusters,
+		send:        pub.send,
+		stats:       pub.stats,
+		instanceID:  uuid.New().String(),
+		hostname:    hostname,
+		startedAt:   startedAt,
+		deviceCount: deviceCount,
+	}
+}
+
+// Publishes a "running" heartbeat every interval until ctx is cancelled
+func (h *heartbeater) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	h.publish("running", "")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.publish("running", "")
+		}
+	}
+}
+
+// Publishes a single heartbeat with the given status and optional reason
+func (h *heartbeater) publish(status, reason string) {
+	hb := Heartbeat{
+		InstanceID:       h.instanceID,
+		Hostname:         h.hostname,
+		Status:           status,
+		Reason:           reason,
+		Timestamp:        time.Now().Format(time.RFC3339Nano),
+		UptimeSeconds:    time.Since(h.startedAt).Seconds(),
+		DeviceCount:      h.deviceCount(),
+		MetricsPublished: h.stats.metrics.Load(),
+		EventsPublished:  h.stats.events.Load(),
+		MessagesRetried:  h.stats.retried.Load(),
+		MessagesLost:     h.stats.lost.Load(),
+		ChaosDuplicates:  h.stats.chaosDuplicates.Load(),
+		ChaosReordered:   h.stats.chaosReordered.Load(),
+		ChaosMalformed:   h.stats.chaosMalformed.Load(),
+		Clusters:         clusterStatuses(h.clusters),
+	}
+	hbJSON, err := json.Marshal(hb)
+	if err != nil {
+		log.Printf("Daemon: Failed to serialize heartbeat: %v", err)
+		return
+	}
+	if err := h.send(HeartbeatSubject, "", hbJSON); err != nil {
+		log.Printf("Daemon: Error publishing heartbeat: %v", err)
+		return
+	}
+	if reason != "" {
+		log.Printf("Daemon: Published [%s] heartbeat to '%s' (reason: %s)", status, HeartbeatSubject, reason)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// inventoryLoadTimeout bounds how long the initial read of the inventory bucket may take.
+const inventoryLoadTimeout = 10 * time.Second
+
+// InventoryDevice is the value of a device key in the inventory bucket; the key itself is
+// the device name.
+type InventoryDevice struct {
+	Type         string   `json:"type"`                   // Base device type from sourceDevices
+	ParentDevice string   `json:"parentDevice,omitempty"` // Enclosure of the device
+	Model        string   `json:"model,omitempty"`        // Defaults to a pick from the type's hardware pool
+	Firmware     string   `json:"firmware,omitempty"`     // Defaults to a pick from the type's hardware pool
+	Weight       *float64 `json:"weight,omitempty"`       // Event weight, defaults to the config file's eventWeights or 1
+}
+
+// deviceSetup applies the config-file settings to devices that join from the inventory.
+type deviceSetup struct {
+	file      FileConfig
+	windows   []*maintenanceWindow
+	startedAt time.Time
+	seed      int64
+}
+
+// inventory keeps the fleet in sync with a JetStream key-value bucket of devices.
+type inventory struct {
+	bucket  string
+	watcher jetstream.KeyWatcher
+	setup   deviceSetup
+}
+
+// bucketLookup finds a key-value bucket, as jetstream.JetStream does; the tests fake it.
+type bucketLookup interface {
+	KeyValue(ctx context.Context, bucket string) (jetstream.KeyValue, error)
+}
+
+// Opens the inventory bucket and reads the current devices. It returns
+// jetstream.ErrBucketNotFound when the bucket does not exist, in which case the daemon
+// falls back to the static fleet. The watch started here keeps running until ctx ends.
+func openInventory(ctx context.Context, js bucketLookup, bucket string, setup deviceSetup) (*inventory, []*device, error) {
+	loadCtx, cancel := context.WithTimeout(ctx, inventoryLoadTimeout)
+	defer cancel()
+	kv, err := js.KeyValue(loadCtx, bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+	watcher, err := kv.WatchAll(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return loadInventory(loadCtx, bucket, watcher, setup)
+}
+
+// Opens the inventory bucket and logs the devices loaded from it, or why the daemon falls
+// back to the static fleet, in which case the inventory is nil.
+func inventoryFleet(ctx context.Context, js bucketLookup, bucket string, setup deviceSetup) (*inventory, []*device) {
+	inv, fleet, err := openInventory(ctx, js, bucket, setup)
+	if err != nil {
+		log.Printf("Daemon Service (Go): Inventory bucket '%s' unavailable (%v), using the static fleet.", bucket, err)
+		return nil, nil
+	}
+	log.Printf("Daemon Service (Go): Loaded %d device(s) from inventory bucket '%s'.", len(fleet), bucket)
+	return inv, fleet
+}
+
+// Reads the current devices from a watch of the bucket, until the watcher signals that
+// all of them were delivered or ctx ends. The watcher is stopped on failure only.
+func loadInventory(ctx context.Context, bucket string, watcher jetstream.KeyWatcher, setup deviceSetup) (*inventory, []*device, error) {
+	inv := &inventory{bucket: bucket, watcher: watcher, setup: setup}
+	devices := make(map[string]*device)
+	for {
+		select {
+		case <-ctx.Done():
+			_ = watcher.Stop()
+			return nil, nil, fmt.Errorf("reading bucket '%s': %w", bucket, ctx.Err())
+		case entry := <-watcher.Updates():
+			if entry == nil {
+				// All current values were delivered, later updates are live changes
+				fleet := make([]*device, 0, len(devices))
+				for _, dev := range devices {
+					fleet = append(fleet, dev)
+				}
+				slices.SortFunc(fleet, func(a, b *device) int { return strings.Compare(a.Name, b.Name) })
+				return inv, fleet, nil
+			}
+			if entry.Operation() != jetstream.KeyValuePut {
+				delete(devices, entry.Key())
+				continue
+			}
+			dev, err := inv.device(entry)
+			if err != nil {
+				log.Printf("Daemon Service (Go): Ignoring inventory entry '%s': %v", entry.Key(), err)
+				continue
+			}
+			devices[dev.Name] = dev
+		}
+	}
+}
+
+// Stops watching the bucket, the fleet stays as it is
+func (inv *inventory) stop() {
+	_ = inv.watcher.Stop()
+}
+
+// Applies live changes of the bucket to the running fleet until ctx is cancelled:
+// new keys start a generator, updated keys restart it with the new attributes while
+// keeping the metric state, deleted keys stop it
+func (inv *inventory) run(ctx context.Context, runner *fleetRunner) {
+	defer inv.stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case entry, ok := <-inv.watcher.Updates():
+			if !ok {
+				log.Printf("Daemon Service (Go): Inventory watch on bucket '%s' ended, the fleet stays as it is", inv.bucket)
+				return
+			}
+			if entry == nil {
+				continue
+			}
+			name := entry.Key()
+			if entry.Operation() != jetstream.KeyValuePut {
+				if runner.stop(name) != nil {
+					log.Printf("Daemon Service (Go): Inventory: removed device '%s'", name)
+				}
+				continue
+			}
+
+			dev, err := inv.device(entry)
+			if err != nil {
+				log.Printf("Daemon Service (Go): Ignoring inventory entry '%s': %v", name, err)
+				continue
+			}
+			if old := runner.stop(name); old != nil {
+				dev.Inherit(old.Device)
+				log.Printf("Daemon Service (Go): Inventory: updated device '%s'", name)
+			} else {
+				log.Printf("Daemon Service (Go): Inventory: added device '%s'", name)
+			}
+			runner.start(dev)
+		}
+	}
+}
+
+// Builds the device described by a put entry
+func (inv *inventory) device(entry jetstream.KeyValueEntry) (*device, error) {
+	var spec InventoryDevice
+	if err := json.Unmarshal(entry.Value(), &spec); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(sourceDevices, spec.Type) {
+		return nil, fmt.Errorf("type '%s' is not one of %v", spec.Type, sourceDevices)
+	}
+	if spec.Weight != nil && *spec.Weight < 0 {
+		return nil, fmt.Errorf("weight must not be negative")
+	}
+
+	dev := newDevice(entry.Key(), spec.Type)
+	dev.Parent = spec.ParentDevice
+	inv.setup.apply(dev)
+	if spec.Model != "" {
+		dev.Model = spec.Model
+	}
+	if spec.Firmware != "" {
+		dev.Firmware = spec.Firmware
+	}
+	if spec.Weight != nil {
+		dev.eventWeight = *spec.Weight
+	}
+	return dev, nil
+}
+
+// Applies hardware, clock skew, maintenance windows and event weight from the config file.
+// The hardware picks derive from the seed and the name, so they are stable across restarts.
+func (s deviceSetup) apply(dev *device) {
+	pool := hardwarePool(dev.Type, s.file.Hardware)
+	randGen := newDeviceRand(s.seed, dev.Name+"/hardware")
+	dev.Model = pick(pool.Models, randGen)
+	dev.Firmware = pick(pool.Firmware, randGen)
+	dev.setClockSkew(s.file.ClockSkew, s.startedAt)
+	dev.setMaintenanceWindows(s.windows)
+	dev.eventWeight, _ = eventWeightOf(dev, s.file.EventWeights)
+}
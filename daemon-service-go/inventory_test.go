@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+
+	"daemon-service-go/pkg/simulator"
+)
+
+// fakeWatcher is a watch of the inventory bucket fed by the test, as no JetStream server
+// is embedded in the tests
+type fakeWatcher struct {
+	updates chan jetstream.KeyValueEntry
+	stopped chan struct{}
+}
+
+func newFakeWatcher() *fakeWatcher {
+	return &fakeWatcher{updates: make(chan jetstream.KeyValueEntry, 16), stopped: make(chan struct{})}
+}
+
+func (w *fakeWatcher) Updates() <-chan jetstream.KeyValueEntry { return w.updates }
+
+func (w *fakeWatcher) Stop() error {
+	close(w.stopped)
+	return nil
+}
+
+// put sends a put of a device key
+func (w *fakeWatcher) put(key, value string) {
+	w.updates <- &fakeEntry{key: key, value: []byte(value), op: jetstream.KeyValuePut}
+}
+
+// delete sends a delete of a device key
+func (w *fakeWatcher) delete(key string) {
+	w.updates <- &fakeEntry{key: key, op: jetstream.KeyValueDelete}
+}
+
+// fakeEntry is a key-value entry of the inventory bucket
+type fakeEntry struct {
+	key   string
+	value []byte
+	op    jetstream.KeyValueOp
+}
+
+func (e *fakeEntry) Bucket() string                  { return "inventory" }
+func (e *fakeEntry) Key() string                     { return e.key }
+func (e *fakeEntry) Value() []byte                   { return e.value }
+func (e *fakeEntry) Revision() uint64                { return 1 }
+func (e *fakeEntry) Created() time.Time              { return time.Time{} }
+func (e *fakeEntry) Delta() uint64                   { return 0 }
+func (e *fakeEntry) Operation() jetstream.KeyValueOp { return e.op }
+
+// fakeJetStream looks up the inventory bucket, nil standing for a missing one
+type fakeJetStream struct {
+	kv     *fakeKeyValue
+	bucket string // The bucket looked up
+}
+
+func (js *fakeJetStream) KeyValue(ctx context.Context, bucket string) (jetstream.KeyValue, error) {
+	js.bucket = bucket
+	if js.kv == nil {
+		return nil, jetstream.ErrBucketNotFound
+	}
+	return js.kv, nil
+}
+
+// fakeKeyValue is the inventory bucket, watched through its fakeWatcher; its other methods
+// are not used by the daemon
+type fakeKeyValue struct {
+	jetstream.KeyValue
+	watcher *fakeWatcher
+}
+
+func (kv *fakeKeyValue) WatchAll(ctx context.Context, opts ...jetstream.WatchOpt) (jetstream.KeyWatcher, error) {
+	return kv.watcher, nil
+}
+
+// runningDevices returns the devices of the running generators by name
+func runningDevices(r *fleetRunner) map[string]*device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	devices := make(map[string]*device, len(r.running))
+	for name, gen := range r.running {
+		devices[name] = gen.dev
+	}
+	return devices
+}
+
+// waitForFleet waits until the running devices satisfy ok
+func waitForFleet(t *testing.T, r *fleetRunner, what string, ok func(map[string]*device) bool) map[string]*device {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		devices := runningDevices(r)
+		if ok(devices) {
+			return devices
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("fleet never %s: %v", what, devices)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLoadInventory(t *testing.T) {
+	w := newFakeWatcher()
+	w.put("StorageArray-0002", `{"type":"StorageArray"}`)
+	w.put("DiskUnit-0001", `{"type":"DiskUnit","parentDevice":"Enclosure-01","model":"HDD-20T","weight":0}`)
+	w.put("CloudStorage-0001", `{"type":"CloudStorage"}`)
+	w.delete("CloudStorage-0001")
+	w.put("Tape-0001", `{"type":"Tape"}`)
+	w.put("StorageArray-0003", `{"type":"StorageArray","weight":-1}`)
+	w.put("StorageArray-0004", `not json`)
+	w.updates <- nil // All current values delivered
+
+	setup := deviceSetup{file: FileConfig{EventWeights: map[string]float64{"StorageArray": 3}}, seed: 7}
+	inv, fleet, err := loadInventory(context.Background(), "inventory", w, setup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, dev := range fleet {
+		names = append(names, dev.Name)
+	}
+	if !slices.Equal(names, []string{"DiskUnit-0001", "StorageArray-0002"}) {
+		t.Fatalf("loaded %v, want the valid devices that were not deleted, sorted", names)
+	}
+	disk, array := fleet[0], fleet[1]
+	if disk.Parent != "Enclosure-01" || disk.Model != "HDD-20T" || disk.eventWeight != 0 || disk.Firmware == "" {
+		t.Errorf("disk %+v, want its parent, model and weight from the entry and a pooled firmware", disk)
+	}
+	if array.eventWeight != 3 || !slices.Contains(defaultHardware["StorageArray"].Models, array.Model) {
+		t.Errorf("array weighs %g with model %s, want the config file's weight and a pooled model", array.eventWeight, array.Model)
+	}
+	if inv.watcher != w {
+		t.Error("inventory does not keep watching the bucket")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := loadInventory(ctx, "inventory", newFakeWatcher(), setup); err == nil {
+		t.Error("loaded an inventory whose initial values never ended")
+	}
+}
+
+func TestOpenInventory(t *testing.T) {
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	missing := &fakeJetStream{}
+	if _, _, err := openInventory(context.Background(), missing, "inventory", deviceSetup{}); !errors.Is(err, jetstream.ErrBucketNotFound) {
+		t.Errorf("openInventory of a missing bucket = %v, want %v", err, jetstream.ErrBucketNotFound)
+	}
+	if inv, fleet := inventoryFleet(context.Background(), missing, "inventory", deviceSetup{}); inv != nil || fleet != nil {
+		t.Errorf("inventory %v with %d device(s) for a missing bucket, want the static fleet", inv, len(fleet))
+	}
+	if want := "Inventory bucket 'inventory' unavailable (nats: bucket not found), using the static fleet."; !strings.Contains(logs.String(), want) {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	logs.Reset()
+	w := newFakeWatcher()
+	w.put("DiskUnit-0001", `{"type":"DiskUnit"}`)
+	w.updates <- nil
+	found := &fakeJetStream{kv: &fakeKeyValue{watcher: w}}
+	inv, fleet := inventoryFleet(context.Background(), found, "devices", deviceSetup{})
+	if found.bucket != "devices" || inv == nil || inv.watcher != w || len(fleet) != 1 || fleet[0].Name != "DiskUnit-0001" {
+		t.Errorf("opened bucket %q: inventory %v with %d device(s), want the bucket's device", found.bucket, inv, len(fleet))
+	}
+	if want := "Loaded 1 device(s) from inventory bucket 'devices'."; !strings.Contains(logs.String(), want) {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+}
+
+func TestInventoryAppliesLiveChanges(t *testing.T) {
+	w := newFakeWatcher()
+	w.put("StorageArray-0001", `{"type":"StorageArray","model":"SA-4000"}`)
+	w.put("DiskUnit-0001", `{"type":"DiskUnit"}`)
+	w.updates <- nil
+	inv, fleet, err := loadInventory(context.Background(), "inventory", w, deviceSetup{seed: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Seed a metric state; the generators never reach their first cycle within an hour, so
+	// the state is only touched by the test
+	seeded := simulator.New(simulator.DefaultConfig(), time.Now, rand.New(rand.NewSource(1))).MetricOf(fleet[1].Device, simulator.DiskTemp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := newFleetRunner(ctx, newTestSettings(t, io.Discard, time.Hour), 7)
+	for _, dev := range fleet {
+		runner.start(dev)
+	}
+	runner.wg.Add(1)
+	go func() {
+		defer runner.wg.Done()
+		inv.run(runner.ctx, runner)
+	}()
+
+	// Add
+	w.put("CloudStorage-0001", `{"type":"CloudStorage"}`)
+	waitForFleet(t, runner, "added the new device", func(d map[string]*device) bool { return d["CloudStorage-0001"] != nil && len(d) == 3 })
+
+	// Update, keeping the metric state of the old device
+	w.put("StorageArray-0001", `{"type":"StorageArray","model":"SA-7000X"}`)
+	waitForFleet(t, runner, "updated the model", func(d map[string]*device) bool {
+		return d["StorageArray-0001"] != nil && d["StorageArray-0001"].Model == "SA-7000X"
+	})
+	updated := runner.stop("StorageArray-0001")
+	if value, ok := updated.Value(simulator.DiskTemp); !ok || value != seeded.Value {
+		t.Errorf("updated device has DiskTemp %g (%t), want the old device's %g", value, ok, seeded.Value)
+	}
+	runner.start(updated)
+
+	// Delete
+	w.delete("DiskUnit-0001")
+	waitForFleet(t, runner, "removed the deleted device", func(d map[string]*device) bool { return d["DiskUnit-0001"] == nil })
+
+	// An invalid update leaves the running device alone
+	w.put("StorageArray-0001", `{"type":"Tape"}`)
+	w.put("DiskUnit-0002", `{"type":"DiskUnit"}`) // Applied after the invalid one
+	devices := waitForFleet(t, runner, "added the second disk", func(d map[string]*device) bool { return d["DiskUnit-0002"] != nil })
+	if devices["StorageArray-0001"] == nil || devices["StorageArray-0001"].Model != "SA-7000X" {
+		t.Errorf("invalid update changed the running device: %v", devices["StorageArray-0001"])
+	}
+
+	cancel()
+	if err := runner.wait(); err != nil {
+		t.Errorf("runner stopped with %v", err)
+	}
+	select {
+	case <-w.stopped:
+	default:
+		t.Error("watch not stopped on shutdown")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Lifecycle states of a simulated device. Devices that are not online emit no metrics.
+const (
+	deviceOnline      = "online"
+	deviceOffline     = "offline"
+	deviceMaintenance = "maintenance"
+)
+
+// Event types bracketing the periods during which a device is not reporting.
+const (
+	DeviceOfflineEvent = "DeviceOffline"
+	DeviceOnlineEvent  = "DeviceOnline"
+)
+
+// lifecycleEventTypes lists the event types emitted by device state rather than at random.
+var lifecycleEventTypes = []string{DeviceOfflineEvent, DeviceOnlineEvent, MaintenanceStartEvent, MaintenanceEndEvent, CapacityWarningEvent}
+
+// lifecycleConfig controls how often devices drop out and for how long.
+type lifecycleConfig struct {
+	OfflineProbability     float64       // Per device and cycle chance of an unplanned outage
+	MaintenanceProbability float64       // Per device and cycle chance of entering maintenance
+	MinDowntime            time.Duration // Shortest time a device stays offline or in maintenance
+	MaxDowntime            time.Duration // Longest time a device stays offline or in maintenance
+}
+
+// Reports whether any lifecycle transition can happen at all
+func (c lifecycleConfig) enabled() bool {
+	return c.OfflineProbability > 0 || c.MaintenanceProbability > 0
+}
+
+// Advances the lifecycle of a device by one cycle.
+// It returns the DeviceOffline or DeviceOnline event to publish when the device changed state.
+func (c lifecycleConfig) step(dev *device, now time.Time, randGen *rand.Rand) *Event {
+	if dev.status != deviceOnline {
+		if now.Before(dev.downUntil) {
+			return nil
+		}
+		previous := dev.status
+		dev.status = deviceOnline
+		return newLifecycleEvent(dev, DeviceOnlineEvent, 2, now,
+			fmt.Sprintf("Device is back online after %s", previous))
+	}
+
+	if !c.enabled() {
+		return nil
+	}
+
+	roll := randGen.Float64()
+	switch {
+	case roll < c.OfflineProbability:
+		dev.status = deviceOffline
+	case roll < c.OfflineProbability+c.MaintenanceProbability:
+		dev.status = deviceMaintenance
+	default:
+		return nil
+	}
+
+	downtime := c.MinDowntime
+	if c.MaxDowntime > c.MinDowntime {
+		downtime += time.Duration(randGen.Int63n(int64(c.MaxDowntime - c.MinDowntime)))
+	}
+	dev.downUntil = now.Add(downtime)
+
+	if dev.status == deviceMaintenance {
+		return newLifecycleEvent(dev, DeviceOfflineEvent, 3, now,
+			fmt.Sprintf("Device entered planned maintenance for %s", downtime.Round(time.Second)))
+	}
+	return newLifecycleEvent(dev, DeviceOfflineEvent, 7, now,
+		fmt.Sprintf("Device went offline unexpectedly for %s", downtime.Round(time.Second)))
+}
+
+// Creates a lifecycle event for the device
+func newLifecycleEvent(dev *device, eventType string, criticality int, now time.Time, message string) *Event {
+	return &Event{
+		ID:           uuid.New().String(),
+		Criticality:  criticality,
+		Timestamp:    dev.clock(now).Format(time.RFC3339Nano),
+		SourceDevice: dev.Name,
+		ParentDevice: dev.Parent,
+		EventType:    eventType,
+		EventMessage: message,
+		Model:        dev.Model,
+		Firmware:     dev.Firmware,
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// Shapes accepted for a load profile.
+const (
+	loadProfileSine   = "sine"
+	loadProfileHourly = "hourly"
+)
+
+// LoadProfile modulates metric values and the event rate over a simulated day so that
+// demo data rises during business hours and falls at night. The factor is applied on top
+// of the random walk, so short-term noise remains.
+type LoadProfile struct {
+	Type      string    `json:"type"`      // "sine" or "hourly"
+	Period    Duration  `json:"period"`    // Length of a simulated day, defaults to 24h; compress it (e.g. "60s") for tests
+	Amplitude float64   `json:"amplitude"` // Sine only: relative swing around 1, e.g. 0.4 yields factors 0.6-1.4
+	Peak      Duration  `json:"peak"`      // Sine only: offset into the period at which load peaks, e.g. "14h"
+	Hourly    []float64 `json:"hourly"`    // Hourly only: 24 non-negative factors, slot 0 starting at the period boundary
+	Metrics   []string  `json:"metrics"`   // Modulated metric types, defaults to IOPs and Latency
+}
+
+// Fills in defaults and checks the profile for consistency
+func (p *LoadProfile) validate() error {
+	if p.Period == 0 {
+		p.Period = Duration(24 * time.Hour)
+	}
+	if p.Period < 0 {
+		return errors.New("loadProfile.period must be positive")
+	}
+	if len(p.Metrics) == 0 {
+		p.Metrics = []string{"IOPs", "Latency"}
+	}
+
+	switch p.Type {
+	case loadProfileSine:
+		if p.Amplitude < 0 || p.Amplitude > 1 {
+			return errors.New("loadProfile.amplitude must be between 0 and 1")
+		}
+	case loadProfileHourly:
+		if len(p.Hourly) != 24 {
+			return fmt.Errorf("loadProfile.hourly must have 24 entries, got %d", len(p.Hourly))
+		}
+		for i, f := range p.Hourly {
+			if f < 0 {
+				return fmt.Errorf("loadProfile.hourly[%d] must not be negative", i)
+			}
+		}
+	default:
+		return fmt.Errorf("loadProfile.type must be %q or %q, got %q", loadProfileSine, loadProfileHourly, p.Type)
+	}
+	return nil
+}
+
+// Returns the load factor at time t, 1 when no profile is configured
+func (p *LoadProfile) factor(t time.Time) float64 {
+	if p == nil {
+		return 1
+	}
+	period := time.Duration(p.Period)
+	offset := time.Duration(t.UnixNano() % int64(period))
+
+	if p.Type == loadProfileHourly {
+		slot := int(int64(offset) * 24 / int64(period))
+		return p.Hourly[slot]
+	}
+	angle := 2 * math.Pi * float64(offset-time.Duration(p.Peak)) / float64(period)
+	return 1 + p.Amplitude*math.Cos(angle)
+}
+
+// Reports whether values of the metric type follow the profile
+func (p *LoadProfile) modulates(metricType string) bool {
+	return p != nil && slices.Contains(p.Metrics, metricType)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDay is the compressed period of the load profiles under test
+const testDay = 60 * time.Second
+
+func TestLoadProfileSineShape(t *testing.T) {
+	p := &LoadProfile{Type: loadProfileSine, Period: Duration(testDay), Amplitude: 0.4, Peak: Duration(15 * time.Second)}
+	if err := p.validate(); err != nil {
+		t.Fatal(err)
+	}
+	day := time.Unix(0, 0).Add(100 * testDay) // Any period boundary
+	at := func(offset time.Duration) float64 { return p.factor(day.Add(offset)) }
+
+	tests := []struct {
+		offset time.Duration
+		want   float64
+	}{
+		{15 * time.Second, 1.4},         // Peak
+		{45 * time.Second, 0.6},         // Half a period later, the trough
+		{0, 1},                          // A quarter before the peak, the mean
+		{30 * time.Second, 1},           // A quarter after it
+		{15*time.Second + testDay, 1.4}, // The next day repeats
+		{15*time.Second - testDay/12, 1.4 - 0.4*(1-math.Cos(2*math.Pi/12))},
+	}
+	for _, tt := range tests {
+		if got := at(tt.offset); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("factor at %s = %.4f, want %.4f", tt.offset, got, tt.want)
+		}
+	}
+
+	mean := 0.0
+	for s := range 60 {
+		f := at(time.Duration(s) * time.Second)
+		if f < 0.6-1e-9 || f > 1.4+1e-9 {
+			t.Errorf("factor %.4f at %ds outside 1±amplitude", f, s)
+		}
+		mean += f / 60
+	}
+	if math.Abs(mean-1) > 1e-9 {
+		t.Errorf("mean factor over a day %.4f, want 1", mean)
+	}
+}
+
+func TestLoadProfileHourlySlots(t *testing.T) {
+	hourly := make([]float64, 24)
+	for i := range hourly {
+		hourly[i] = float64(i)
+	}
+	p := &LoadProfile{Type: loadProfileHourly, Period: Duration(testDay), Hourly: hourly}
+	if err := p.validate(); err != nil {
+		t.Fatal(err)
+	}
+	day := time.Unix(0, 0)
+	for slot := range 24 {
+		start := day.Add(time.Duration(slot) * testDay / 24)
+		if got := p.factor(start); got != float64(slot) {
+			t.Errorf("factor at the start of slot %d = %g", slot, got)
+		}
+		if got := p.factor(start.Add(testDay/24 - time.Millisecond)); got != float64(slot) {
+			t.Errorf("factor at the end of slot %d = %g", slot, got)
+		}
+	}
+}
+
+func TestLoadProfileValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile LoadProfile
+		wantErr bool
+	}{
+		{name: "sine with defaults", profile: LoadProfile{Type: loadProfileSine, Amplitude: 0.5}},
+		{name: "unknown type", profile: LoadProfile{Type: "square"}, wantErr: true},
+		{name: "negative period", profile: LoadProfile{Type: loadProfileSine, Period: Duration(-time.Hour)}, wantErr: true},
+		{name: "amplitude above 1", profile: LoadProfile{Type: loadProfileSine, Amplitude: 1.5}, wantErr: true},
+		{name: "short hourly table", profile: LoadProfile{Type: loadProfileHourly, Hourly: []float64{1, 2}}, wantErr: true},
+		{name: "negative hourly factor", profile: LoadProfile{Type: loadProfileHourly, Hourly: append(make([]float64, 23), -1)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.profile.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && (tt.profile.Period != Duration(24*time.Hour) || !slices.Equal(tt.profile.Metrics, []string{"IOPs", "Latency"})) {
+				t.Errorf("defaults not filled in: %+v", tt.profile)
+			}
+		})
+	}
+	var none *LoadProfile
+	if none.factor(time.Now()) != 1 || none.modulates("IOPs") {
+		t.Error("a missing profile modulates the load")
+	}
+}
+
+// Generates many compressed days and compares the metrics and events of the peak and the
+// trough quarter of the day
+func TestLoadProfileModulatesMetricsAndEvents(t *testing.T) {
+	const days = 200
+	var out bytes.Buffer
+	settings := newTestSettings(t, &out, time.Second)
+	settings.profile = &LoadProfile{Type: loadProfileSine, Period: Duration(testDay), Amplitude: 0.5, Peak: Duration(15 * time.Second), Metrics: []string{"IOPs"}}
+	if err := settings.profile.validate(); err != nil {
+		t.Fatal(err)
+	}
+	settings.eventShare = func(*device) float64 { return 1 }
+	g := newDeviceGenerator(newDevice("StorageArray-0001", "StorageArray"), 42, settings)
+
+	start := time.Unix(0, 0).UTC()
+	for s := range days * int(testDay/time.Second) {
+		if err := g.cycle(start.Add(time.Duration(s) * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Sums per quarter of the day: 0 holds the peak, 2 the trough
+	var iops, otherMetrics [4]struct{ sum, n float64 }
+	var events [4]int
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		subject, payload, _ := strings.Cut(scanner.Text(), " ")
+		var msg struct {
+			Timestamp  string  `json:"timestamp"`
+			MetricType string  `json:"metricType"`
+			EventType  string  `json:"eventType"`
+			Value      float64 `json:"value"`
+		}
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			t.Fatalf("malformed dry-run line %q", scanner.Text())
+		}
+		ts, _ := time.Parse(time.RFC3339Nano, msg.Timestamp)
+		offset := (ts.Sub(start) % testDay) - 15*time.Second + testDay/8 // Peak quarter from 0 to testDay/4
+		quarter := int((offset+testDay)%testDay) / int(testDay/4)
+		switch {
+		case subject == DeviceMetricsSubject && msg.MetricType == "IOPs":
+			iops[quarter].sum += msg.Value
+			iops[quarter].n++
+		case subject == DeviceMetricsSubject:
+			otherMetrics[quarter].sum += msg.Value
+			otherMetrics[quarter].n++
+		case slices.Contains(eventTypes, msg.EventType):
+			events[quarter]++
+		}
+	}
+
+	mean := func(q struct{ sum, n float64 }) float64 { return q.sum / q.n }
+	// The mean factor over the peak quarter is 1+0.5·0.9, over the trough 1-0.5·0.9
+	if ratio := mean(iops[0]) / mean(iops[2]); ratio < 2.1 || ratio > 3.2 {
+		t.Errorf("IOPs at the peak %.1f times those at the trough, want about 2.6", ratio)
+	}
+	if mean(iops[1]) <= mean(iops[2]) || mean(iops[1]) >= mean(iops[0]) || mean(iops[3]) <= mean(iops[2]) || mean(iops[3]) >= mean(iops[0]) {
+		t.Errorf("mean IOPs per quarter %.0f %.0f %.0f %.0f, want them falling after the peak and rising before it",
+			mean(iops[0]), mean(iops[1]), mean(iops[2]), mean(iops[3]))
+	}
+	if ratio := mean(otherMetrics[0]) / mean(otherMetrics[2]); ratio < 0.8 || ratio > 1.25 {
+		t.Errorf("unmodulated metrics at the peak %.2f times those at the trough, want about 1", ratio)
+	}
+	if ratio := float64(events[0]) / float64(events[2]); ratio < 2.1 || ratio > 3.2 {
+		t.Errorf("%d events at the peak and %d at the trough, want about 2.6 times as many", events[0], events[2])
+	}
+}
@@ -3,174 +3,402 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"math/rand"
 	"os"
-	"strconv"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/google/uuid"
-	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"golang.org/x/sync/errgroup"
+
+	"daemon-service-go/pkg/simulator"
 )
 
 // Constants for default configuration and subject names.
 const (
 	defaultNatsURL            = "nats://nats:4222"
-	EventsSubject             = "events.event"   // NATS subject for  events
-	DeviceMetricsSubject      = "events.metrics" // NATS subject for device metrics
-	defaultGenerationInterval = 1                // Default time in seconds between each event/metric generation cycle
+	EventsSubject             = "events.event"       // NATS subject for  events
+	SecurityEventsSubject     = "events.security"    // NATS subject for security-class events
+	DeviceMetricsSubject      = "events.metrics"     // NATS subject for device metrics
+	HeartbeatSubject          = "daemon.heartbeat"   // NATS subject for daemon liveness heartbeats
+	SummarySubject            = "events.summary"     // NATS subject for periodic rollup summaries
+	AckSubject                = "events.ack"         // NATS subject of the operators' event acknowledgments, published by the client
+	defaultGenerationInterval = 1                    // Default time in seconds between each event/metric generation cycle
+	defaultHeartbeatInterval  = 30                   // Default time in seconds between heartbeats, 0 disables them
+	defaultCriticalityDist    = "uniform"            // Default criticality distribution of generated events
+	defaultDeviceCount        = 0                    // Default fleet size, 0 keeps one device per base type
+	defaultDisksPerEnclosure  = 12                   // Default number of disk units per enclosure
+	defaultSecurityEventTypes = "UnauthorizedAccess" // Default comma-separated event types routed to SecurityEventsSubject
+	defaultFlushTimeout       = 5 * time.Second      // Default deadline for flushing buffered messages on shutdown
+	defaultMinDowntime        = 30 * time.Second     // Default shortest offline or maintenance period of a device
+	defaultMaxDowntime        = 5 * time.Minute      // Default longest offline or maintenance period of a device
+	defaultSummaryInterval    = time.Minute          // Default time between generation summaries, 0 only logs the final one
+	defaultSummaryTopDevices  = 10                   // Default number of devices listed individually in a summary
 )
 
-// Represents a simulated event.
-type Event struct {
-	ID           string `json:"id"`
-	Criticality  int    `json:"criticality"` // Criticality level (e.g., 1-10).
-	Timestamp    string `json:"timestamp"`   // UTC timestamp (RFC3339Nano format).
-	SourceDevice string `json:"sourceDevice"`
-	EventType    string `json:"eventType"` // The type of  event
-}
+// SchemaVersion is the version of the Event and DeviceMetric payloads, sent in the
+// schemaVersion field and the SchemaVersionHeader.
+const SchemaVersion = simulator.SchemaVersion
 
-// Represents a simulated device metric
-type DeviceMetric struct {
-	Timestamp    string  `json:"timestamp"`
-	SourceDevice string  `json:"sourceDevice"`
-	MetricType   string  `json:"metricType"` //The type of metric
-	Value        float64 `json:"value"`
-}
+// SchemaVersionHeader carries SchemaVersion on every message for consumers that route
+// before parsing.
+const SchemaVersionHeader = "Nats-Schema-Version"
+
+// The wire formats and value models live in the simulator package, shared with the
+// fixtures of other services.
+type (
+	Event        = simulator.Event
+	DeviceMetric = simulator.DeviceMetric
+)
 
 // List of available simulated devices and event/metric types.
 var (
-	sourceDevices = []string{
-		"StorageArray", // General storage system
-		"DiskUnit",     // Individual disk drive
-		"CloudStorage", // Cloud integration point
+	sourceDevices = simulator.DeviceTypes
+	eventTypes    = simulator.EventTypes
+	metricTypes   = simulator.MetricTypes
+)
+
+// publishStats holds totals of successfully published messages since start.
+type publishStats struct {
+	metrics atomic.Uint64
+	events  atomic.Uint64
+	failed  atomic.Uint64 // Metrics and events that could not be serialized or published
+
+	retried atomic.Uint64 // Messages delivered by the retry queue after a failed publish
+	lost    atomic.Uint64 // Messages dropped after the retry queue gave up on them
+
+	lastPublish atomic.Int64 // Unix nanoseconds of the latest successful metric or event publish, 0 before the first
+
+	chaosDuplicates atomic.Uint64 // Messages republished verbatim by the fault-injection mode
+	chaosReordered  atomic.Uint64 // Messages held back by the fault-injection mode
+	chaosMalformed  atomic.Uint64 // Payloads deliberately corrupted by the fault-injection mode
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Getenv))
+}
+
+// Runs the daemon configured by the command-line args and the environment until shutdown
+// and returns the process exit code. The final messages, the retry queue and the NATS flush
+// are done before the exit code is chosen, see shutdown.
+func run(args []string, getenv func(string) string) int {
+	startedAt := time.Now()
+
+	cfg, err := loadConfig(args, getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		log.Fatalf("Daemon Service (Go): Invalid configuration: %v", err)
 	}
 
-	// eventTypes are critical storage-related incidents.
-	eventTypes = []string{
-		"DriveFailure",       // Disk drive hardware failure
-		"DataCorruption",     // Data integrity issue
-		"UnauthorizedAccess", // Security breach attempt
+	// Setup context for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle OS signals for graceful shutdown, remembering the reason for the final heartbeat
+	var shutdownReason atomic.Value
+	shutdownReason.Store("context cancelled")
+	var connectionClosed atomic.Bool // Set when NATS gave up on every connection
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	go func() {
+		select {
+		case sig := <-sigChan:
+			log.Printf("Daemon Service (Go): Received %s. Initiating graceful shutdown...", sig)
+			shutdownReason.Store("received signal " + sig.String())
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Connect to every configured NATS cluster, unless the messages only go to stdout
+	var clusters []*cluster
+	var dryRun *dryRunWriter
+	if cfg.DryRun {
+		log.Printf("Daemon Service (Go): Dry run: writing every message to stdout as '<subject> <payload>' instead of publishing to NATS.")
+		dryRun = newDryRunWriter(os.Stdout)
+	} else {
+		clusters, err = connectClusters(cfg.natsURLs(), cfg.Connection, func() {
+			// Nothing can be published anymore; exit non-zero so the orchestrator restarts us
+			log.Printf("Daemon Service (Go): Every NATS connection is closed for good. Shutting down...")
+			shutdownReason.Store("NATS connection closed")
+			connectionClosed.Store(true)
+			cancel()
+		})
+		if err != nil {
+			log.Fatalf("Daemon Service (Go): Failed to connect to NATS: %v", err)
+		}
+		if cfg.Connection.JetStream {
+			log.Printf("Daemon Service (Go): Publishing through JetStream with acks; retried messages are deduplicated by their Nats-Msg-Id.")
+		}
 	}
 
-	// metricTypes are core storage performance and health indicators.
-	metricTypes = []string{
-		"DiskTemp",     // Drive temperature
-		"IOPs",         // Input/Output Operations Per Second
-		"Latency",      // Data access latency
-		"CapacityUsed", // Storage capacity utilization
+	// Parse the criticality distribution, failing fast on a bad table
+	criticality, err := parseCriticalityDistribution(cfg.CriticalityDistribution)
+	if err != nil {
+		log.Fatalf("Daemon Service (Go): Invalid criticality distribution %q: %v", cfg.CriticalityDistribution, err)
 	}
-)
+	if criticality.normalized() {
+		log.Printf("Daemon Service (Go): Criticality distribution weights sum to %.2f%%, normalizing to 100%%.", criticality.total)
+	}
+	log.Printf("Daemon Service (Go): Using criticality distribution %s", criticality)
 
-func main() {
+	// Expand the device list into the simulated fleet
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Printf("Daemon Service (Go): Using seed %d (pass --seed %d to reproduce the generated values).", seed, seed)
+	windows, err := parseMaintenanceWindows(cfg.File.MaintenanceWindows)
+	if err != nil {
+		log.Fatalf("Daemon Service (Go): Invalid maintenance windows in config file: %v", err)
+	}
+	maintenance, err := newMaintenanceClock(cfg.File.MaintenanceClock, startedAt)
+	if err != nil {
+		log.Fatalf("Daemon Service (Go): Invalid maintenance clock in config file: %v", err)
+	}
+	if len(windows) > 0 {
+		log.Printf("Daemon Service (Go): Scheduling %d maintenance window(s), evaluated from %s at %gx speed.",
+			len(windows), maintenance.simStart.UTC().Format(time.RFC3339), maintenance.speed)
+	}
 
-	// Read NATS URL from environment variable or use default
-	natsURL := os.Getenv("NATS_URL")
-	if natsURL == "" {
-		natsURL = defaultNatsURL
+	// Take the fleet from the inventory bucket when there is one, otherwise build it
+	var inv *inventory
+	var fleet []*device
+	if cfg.InventoryBucket != "" && dryRun != nil {
+		log.Printf("Daemon Service (Go): Dry run: ignoring inventory bucket '%s', using the static fleet.", cfg.InventoryBucket)
+	} else if cfg.InventoryBucket != "" {
+		setup := deviceSetup{file: cfg.File, windows: windows, startedAt: startedAt, seed: seed}
+		js, err := jetstream.New(clusters[0].nc)
+		if err != nil {
+			log.Fatalf("Daemon Service (Go): Failed to open JetStream for inventory bucket '%s': %v", cfg.InventoryBucket, err)
+		}
+		inv, fleet = inventoryFleet(ctx, js, cfg.InventoryBucket, setup)
+	}
+	if inv == nil {
+		fleet = buildFleetWithEnclosures(cfg.DeviceCount, cfg.Enclosures, cfg.DisksPerEnclosure)
+		assignHardware(fleet, cfg.File.Hardware, rand.New(rand.NewSource(seed)))
+		applyClockSkew(fleet, cfg.File.ClockSkew, startedAt)
+		if err := applyEventWeights(fleet, cfg.File.EventWeights); err != nil {
+			log.Fatalf("Daemon Service (Go): Invalid event weights in config file: %v", err)
+		}
+		applyMaintenanceWindows(fleet, windows)
+	}
+	log.Printf("Daemon Service (Go): Simulating a fleet of %d device(s) across %d device type(s).", len(fleet), len(sourceDevices))
+	if cfg.Enclosures > 0 && inv == nil {
+		log.Printf("Daemon Service (Go): Placing %d disk unit(s) in each of %d enclosure(s).", cfg.DisksPerEnclosure, cfg.Enclosures)
+	}
+	if cfg.Lifecycle.enabled() {
+		log.Printf("Daemon Service (Go): Simulating device lifecycles: offline probability %.4f, maintenance probability %.4f, downtime %s-%s per transition.",
+			cfg.Lifecycle.OfflineProbability, cfg.Lifecycle.MaintenanceProbability, cfg.Lifecycle.MinDowntime, cfg.Lifecycle.MaxDowntime)
 	}
 
-	// Connect to NATS server
-	nc, err := nats.Connect(natsURL)
+	router, err := newEventRouter(cfg.SecurityEventTypes, cfg.File.EventSubjects, cfg.AllowForeignSubjects)
 	if err != nil {
-		log.Fatalf("Daemon Service (Go): Failed to connect to NATS: %v", err)
-	}
-	defer nc.Close()
-	log.Printf("Daemon Service (Go): Connected to NATS at %s", natsURL)
-
-	// Read generation interval from environment variable
-	generationIntervalStr := os.Getenv("GENERATION_INTERVAL_SECONDS")
-	generationInterval, err := strconv.Atoi(generationIntervalStr)
-	if err != nil || generationInterval <= 0 {
-		generationInterval = defaultGenerationInterval
-	}
-
-	log.Printf("Daemon Service (Go): Publishing events to '%s' and metrics to '%s' every %d second(s).",
-		EventsSubject, DeviceMetricsSubject, generationInterval)
-
-	// Create a new ticker that sends a signal on its channel.
-	ticker := time.NewTicker(time.Duration(generationInterval) * time.Second)
-	defer ticker.Stop()
-
-	// Create a new random number generator instance
-	randGen := rand.New(rand.NewSource(time.Now().UnixNano()))
-
-	for range ticker.C {
-
-		// Generate and publish device metrics
-		for _, device := range sourceDevices {
-			metric := generateDeviceMetric(device, randGen)
-			metricJSON, err := json.Marshal(metric)
-			if err != nil {
-				log.Printf("Daemon: Failed to serialize metric for device '%s': %v", device, err)
-				continue
-			}
-			err = nc.Publish(DeviceMetricsSubject, metricJSON)
-			if err != nil {
-				log.Printf("Daemon: Error publishing metric from device '%s': %v", device, err)
-			} else {
-				log.Printf("Daemon: Published metric [%s] from device [%s]", metric.MetricType, metric.SourceDevice)
-			}
-		}
+		log.Fatalf("Daemon Service (Go): Invalid event routing: %v", err)
+	}
+	if routes := router.routes(); len(routes) > 0 {
+		log.Printf("Daemon Service (Go): Routing event types to dedicated subjects: %s", strings.Join(routes, ", "))
+	}
 
-		// Generate and publish events with a lower probability
-		if randGen.Float32() < 0.25 {
-			event := generateEvent(randGen)
-			eventJSON, err := json.Marshal(event)
-			if err != nil {
-				log.Printf("Daemon: Failed to serialize event '%s' from device '%s': %v", event.EventType, event.SourceDevice, err)
-				continue
-			}
-			err = nc.Publish(EventsSubject, eventJSON)
-			if err != nil {
-				log.Printf("Daemon: Error publishing event [%s] from [%s]: %v", event.EventType, event.SourceDevice, err)
-			} else {
-				log.Printf("Daemon: Published event [%s] from [%s] with criticality [%d]", event.EventType, event.SourceDevice, event.Criticality)
-			}
-		}
+	ranges, err := newMetricRanges(cfg.File.MetricRanges, cfg.File.FallbackRange)
+	if err != nil {
+		log.Fatalf("Daemon Service (Go): Invalid value ranges in config file: %v", err)
+	}
+
+	metadata, err := parseMetricMetadata(cfg.MetricMetadata)
+	if err != nil {
+		log.Fatalf("Daemon Service (Go): Invalid metric metadata %q: %v", cfg.MetricMetadata, err)
+	}
+
+	log.Printf("Daemon Service (Go): Publishing events to '%s' (security events %v to '%s') and metrics to '%s' every %s.",
+		EventsSubject, router.securityTypes(), SecurityEventsSubject, DeviceMetricsSubject, cfg.Interval)
+
+	stats := &publishStats{}
+	pub := &publisher{
+		clusters: clusters,
+		dryRun:   dryRun,
+		stats:    stats,
+		router:   router,
+		chaos:    newChaosInjector(cfg.ChaosDuplicateRate, cfg.ChaosReorderRate, cfg.ChaosMalformedRate, stats),
+		counter:  newGenerationCounter(startedAt, cfg.SummaryTopDevices),
+
+		messageLimit: uint64(cfg.RunMessageLimit),
+	}
+	if pub.chaos != nil {
+		log.Printf("Daemon Service (Go): CHAOS MODE ENABLED: duplicate rate %.4f, reorder rate %.4f, malformed rate %.4f. Do not use with real consumers.",
+			cfg.ChaosDuplicateRate, cfg.ChaosReorderRate, cfg.ChaosMalformedRate)
+	}
+	pub.retry = newRetryQueue(cfg.Retry, pub.send, stats)
+	if pub.otlp, err = newOTLPExporter(ctx, cfg.OTLPEndpoint); err != nil {
+		log.Printf("Daemon Service (Go): OTLP export disabled: %v", err)
+	} else if pub.otlp != nil {
+		log.Printf("Daemon Service (Go): Exporting metrics as OTel gauges to '%s' alongside NATS.", cfg.OTLPEndpoint)
+	}
+	if cfg.SummaryCycles > 0 {
+		pub.rollup = newRollup(startedAt)
+		log.Printf("Daemon Service (Go): Publishing rollup summaries to '%s' every %d cycle(s).", SummarySubject, cfg.SummaryCycles)
+	}
+
+	// Run one generator goroutine per device, each with its own schedule, RNG and state
+	settings := &generatorSettings{
+		interval:    cfg.Interval,
+		cycles:      cfg.RunCycles,
+		lifecycle:   cfg.Lifecycle,
+		metadata:    metadata,
+		profile:     cfg.File.LoadProfile,
+		escalation:  cfg.Escalation,
+		resolution:  cfg.Resolution,
+		rebuild:     cfg.Rebuild,
+		maintenance: maintenance,
+		simulator: simulator.Config{
+			Ranges:      ranges,
+			Capacity:    cfg.Capacity,
+			Latency:     cfg.Latency,
+			Criticality: criticality.sample,
+		},
+		cardinality: newCardinalityTest(cfg.CardinalityTestDevices),
+		dedup:       cfg.Dedup,
+		backfill:    newBackfill(cfg.BackfillDuration, cfg.BackfillRate),
+		pub:         pub,
+	}
+	if cfg.Dedup.Window > 0 {
+		log.Printf("Daemon Service (Go): Suppressing repeats of an event type per device within %s.", cfg.Dedup.Window)
+	}
+	log.Printf("Daemon Service (Go): Send SIGUSR1 (critical) or SIGUSR2 (benign) to publish a [%s] drill event from [%s].", cfg.Drill.EventType, cfg.Drill.Device)
+	if settings.backfill != nil {
+		log.Printf("Daemon Service (Go): Backfilling %s of history per device at up to %d message(s) per second before real-time generation.", cfg.BackfillDuration, cfg.BackfillRate)
+	}
+	if cfg.Escalation.enabled() {
+		log.Printf("Daemon Service (Go): Escalating repeated event types per device within %s by %d criticality step(s).", cfg.Escalation.Window, cfg.Escalation.Step)
+	}
+	if p := cfg.File.LoadProfile; p != nil {
+		log.Printf("Daemon Service (Go): Applying %s load profile over a %s period to %v and the event rate.", p.Type, time.Duration(p.Period), p.Metrics)
+	}
+	if settings.cardinality != nil {
+		log.Printf("Daemon Service (Go): CARDINALITY TEST MODE: every cycle of every device reports under a new name until %d unique device name(s) were generated. Do not point this at a production database.",
+			cfg.CardinalityTestDevices)
+	}
+	if cfg.bounded() {
+		log.Printf("Daemon Service (Go): Bounded run: stopping after %d cycle(s) per device or %d message(s), whichever comes first (0 = no bound).",
+			cfg.RunCycles, cfg.RunMessageLimit)
+	}
+
+	runner := newFleetRunner(ctx, settings, seed)
+	hb := newHeartbeater(pub, startedAt, runner.size)
+	if cfg.HeartbeatInterval > 0 {
+		log.Printf("Daemon Service (Go): Publishing heartbeats to '%s' every %d second(s) as instance %s.",
+			HeartbeatSubject, cfg.HeartbeatInterval, hb.instanceID)
+		go hb.run(ctx, time.Duration(cfg.HeartbeatInterval)*time.Second)
+	}
+
+	if cfg.HealthAddr != "" {
+		health := newHealthServer(pub, settings.interval)
+		go func() { _ = health.run(ctx, cfg.HealthAddr) }()
+	}
+	if cfg.PprofAddr != "" {
+		go func() { _ = runPprofServer(ctx, cfg.PprofAddr) }()
+	}
+
+	// Helpers such as the chaos ticker and summaries stop once the generators are done
+	auxCtx, cancelAux := context.WithCancel(ctx)
+	defer cancelAux()
+	aux, auxCtx := errgroup.WithContext(auxCtx)
+	aux.Go(func() error { return pub.runChaosTicker(auxCtx, settings.interval) })
+	aux.Go(func() error { return cfg.Drill.run(auxCtx, pub) })
+	if pub.retry != nil {
+		aux.Go(func() error { return pub.retry.run(auxCtx) })
+	}
+	if cfg.SummaryInterval > 0 {
+		aux.Go(func() error { return pub.counter.run(auxCtx, cfg.SummaryInterval) })
+	}
+	if settings.backfill != nil {
+		aux.Go(func() error { return settings.backfill.logProgress(auxCtx) })
+	}
+	if pub.rollup != nil {
+		aux.Go(func() error {
+			return pub.rollup.run(auxCtx, pub.send, time.Duration(cfg.SummaryCycles)*settings.interval)
+		})
+	}
+
+	for _, dev := range fleet {
+		runner.start(dev)
+	}
+	log.Printf("Daemon Service (Go): Started %d device generator(s).", len(fleet))
+	if inv != nil && cfg.bounded() {
+		log.Printf("Daemon Service (Go): Bounded run: ignoring live changes of inventory bucket '%s'.", cfg.InventoryBucket)
+		inv.stop()
+	} else if inv != nil {
+		// The watch counts as a generator, so the daemon keeps running while the bucket is empty
+		runner.wg.Add(1)
+		go func() {
+			defer runner.wg.Done()
+			inv.run(runner.ctx, runner)
+		}()
 	}
-}
 
-// Creates a random event
-func generateEvent(randGen *rand.Rand) Event {
-	device := sourceDevices[randGen.Intn(len(sourceDevices))]
-	eventType := eventTypes[randGen.Intn(len(eventTypes))]
-	criticality := randGen.Intn(10) + 1 // Random int from 1 to 10
+	err = runner.wait()
+	cancelAux()
+	_ = aux.Wait()
+	generationFailed := err != nil && !errors.Is(err, errMessageLimitReached) && !errors.Is(err, errCardinalityTestComplete)
+	boundedRunComplete := cfg.bounded() && ctx.Err() == nil
+	switch {
+	case generationFailed:
+		log.Printf("Daemon Service (Go): Generation stopped: %v", err)
+		shutdownReason.Store("generation failed: " + err.Error())
+	case boundedRunComplete:
+		shutdownReason.Store("bounded run complete")
+	}
+	if cfg.HeartbeatInterval > 0 {
+		hb.publish("stopping", shutdownReason.Load().(string))
+	}
+	flushErr := shutdown(pub, clusters, cfg.FlushTimeout)
 
-	return Event{
-		ID:           uuid.New().String(),
-		Criticality:  criticality,
-		Timestamp:    time.Now().Format(time.RFC3339Nano),
-		SourceDevice: device,
-		EventType:    eventType,
+	switch {
+	case generationFailed:
+		return 1
+	case connectionClosed.Load():
+		log.Println("Daemon Service (Go): Exiting after losing every NATS connection.")
+		return 1
+	case flushErr != nil:
+		log.Printf("Daemon Service (Go): Exiting after failing to flush NATS: %v", flushErr)
+		return 1
+	case boundedRunComplete:
+		log.Printf("Daemon Service (Go): Bounded run complete: published %d metric(s) and %d event(s), %d failure(s), %d lost after retries.",
+			stats.metrics.Load(), stats.events.Load(), stats.failed.Load(), stats.lost.Load())
+		if stats.failed.Load()+stats.lost.Load() > 0 {
+			return 1
+		}
 	}
+	log.Println("Daemon Service (Go): Shutting down.")
+	return 0
 }
 
-// Creates a random device metric
-func generateDeviceMetric(device string, randGen *rand.Rand) DeviceMetric {
-	metricType := metricTypes[randGen.Intn(len(metricTypes))]
-	value := 0.0
-
-	// Generate values
-	switch metricType {
-	case "DiskTemp":
-		value = 25.0 + randGen.Float64()*35.0 // Disk temperature: 25.0 to 60.0
-	case "IOPs":
-		value = 100.0 + randGen.Float64()*900.0 // I/O Operations Per Second: 100 to 1000
-	case "Latency":
-		value = 0.5 + randGen.Float64()*10.0 // Latency: 0.5 to 10.5
-	case "CapacityUsed":
-		value = 10.0 + randGen.Float64()*85.0 // Capacity utilization: 10.0 to 95.0 %
-	default:
-		// Fallback for any unexpected metric types
-		value = randGen.Float64() * 100.0 // 0.0 to 100.0
-	}
-
-	return DeviceMetric{
-		Timestamp:    time.Now().Format(time.RFC3339Nano),
-		SourceDevice: device,
-		MetricType:   metricType,
-		Value:        value,
+// Publishes the final rollup, sends what the chaos mode and the retry queue still hold,
+// then flushes and closes the clusters, in that order, so messages failing in the chaos
+// drain still get retried and everything is counted before the exit code is chosen.
+// Returns the flush error of any cluster.
+func shutdown(pub *publisher, clusters []*cluster, flushTimeout time.Duration) error {
+	if pub.rollup != nil {
+		// Covers the partial final window
+		pub.rollup.publish(pub.send, true)
+	}
+	if pub.otlp != nil {
+		pub.otlp.shutdown()
+	}
+	pub.counter.log(true)
+	pub.drain()
+	if pub.retry != nil {
+		pub.retry.drain(flushTimeout)
 	}
+	return closeClusters(clusters, flushTimeout)
 }
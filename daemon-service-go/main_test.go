@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a buffer safe for concurrent use, as NATS callbacks may still log after
+// the run returned
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// runDaemon runs the daemon with the args and no environment, returning its exit code and
+// its log
+func runDaemon(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+	code := run(args, func(string) string { return "" })
+	return code, logs.String()
+}
+
+// boundedRunLine is the log line of a completed bounded run
+var boundedRunLine = regexp.MustCompile(`Bounded run complete: published (\d+) metric\(s\) and (\d+) event\(s\), (\d+) failure\(s\), (\d+) lost`)
+
+// boundedRunCounts returns the counts of the bounded run line of a log
+func boundedRunCounts(t *testing.T, logs string) (metrics, events, failed, lost int) {
+	t.Helper()
+	m := boundedRunLine.FindStringSubmatch(logs)
+	if m == nil {
+		t.Fatalf("no bounded run line in the log:\n%s", logs)
+	}
+	counts := make([]int, 4)
+	for i := range counts {
+		counts[i], _ = strconv.Atoi(m[i+1])
+	}
+	return counts[0], counts[1], counts[2], counts[3]
+}
+
+func TestBoundedRunFlushesEveryMessage(t *testing.T) {
+	for _, jetStream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("jetstream %t", jetStream), func(t *testing.T) {
+			s := startFakeNATS(t, 1<<20, jetStream)
+			code, logs := runDaemon(t,
+				"--nats-url", s.url(), fmt.Sprintf("--nats-jetstream=%t", jetStream),
+				"--device-count", "20", "--run-cycles", "5", "--generation-interval", "5ms", "--seed", "7",
+				"--heartbeat-interval-seconds", "0", "--summary-interval", "0")
+			if code != 0 {
+				t.Fatalf("exit code %d, want 0; log:\n%s", code, logs)
+			}
+			metrics, events, _, _ := boundedRunCounts(t, logs)
+			received := map[string]int{}
+			for _, msg := range s.received() {
+				received[msg.Subject]++
+			}
+			if received[DeviceMetricsSubject] != metrics {
+				t.Errorf("server received %d metric(s), the daemon published %d", received[DeviceMetricsSubject], metrics)
+			}
+			if total := len(s.received()) - received[DeviceMetricsSubject]; total != events {
+				t.Errorf("server received %d event(s), the daemon published %d: %v", total, events, received)
+			}
+			if metrics == 0 {
+				t.Error("no metrics published")
+			}
+		})
+	}
+}
+
+func TestBoundedRunExitCode(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxPayload   int
+		args         []string
+		wantCode     int
+		wantMessages int // Published metrics and events, -1 when only the exit code matters
+	}{
+		{name: "cycles", maxPayload: 1 << 20, args: []string{"--run-cycles", "3"}, wantMessages: -1},
+		{name: "message limit", maxPayload: 1 << 20, args: []string{"--run-message-limit", "10"}, wantMessages: 10},
+		{name: "message limit before the cycles", maxPayload: 1 << 20, args: []string{"--run-cycles", "1000", "--run-message-limit", "25"}, wantMessages: 25},
+		{name: "failed publishes", maxPayload: smallPayload, args: []string{"--run-cycles", "2", "--retry-queue-size", "0"}, wantCode: 1, wantMessages: 0},
+		{name: "publishes lost after retries", maxPayload: smallPayload, args: []string{"--run-cycles", "2", "--retry-max-attempts", "1", "--retry-backoff", "1ms"}, wantCode: 1, wantMessages: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := startFakeNATS(t, tt.maxPayload, false)
+			args := append([]string{"--nats-url", s.url(), "--device-count", "5", "--generation-interval", "5ms", "--seed", "7",
+				"--heartbeat-interval-seconds", "0", "--summary-interval", "0"}, tt.args...)
+			code, logs := runDaemon(t, args...)
+			if code != tt.wantCode {
+				t.Fatalf("exit code %d, want %d; log:\n%s", code, tt.wantCode, logs)
+			}
+			metrics, events, failed, lost := boundedRunCounts(t, logs)
+			if tt.wantMessages >= 0 && metrics+events != tt.wantMessages {
+				t.Errorf("published %d metric(s) and %d event(s), want %d message(s)", metrics, events, tt.wantMessages)
+			}
+			if (failed+lost > 0) != (tt.wantCode != 0) {
+				t.Errorf("%d failure(s) and %d lost with exit code %d", failed, lost, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Event types bracketing a scheduled maintenance window.
+const (
+	MaintenanceStartEvent = "MaintenanceStart"
+	MaintenanceEndEvent   = "MaintenanceEnd"
+)
+
+// MaintenanceWindow is a scheduled silent period as written in the config file.
+// Start is either a time of day "HH:MM" in UTC, repeating daily or on the listed weekdays,
+// or an RFC3339 timestamp for a one-off window. Windows may span midnight and overlap;
+// a device is in maintenance while any of its windows is open.
+type MaintenanceWindow struct {
+	Devices  []string `json:"devices"`  // Device names or base types, empty for the whole fleet
+	Start    string   `json:"start"`    // "22:30" or "2026-03-01T02:00:00Z"
+	Duration Duration `json:"duration"` // Length of the window, e.g. "2h"
+	Weekdays []string `json:"weekdays"` // Daily windows only: restricts the start to these days, e.g. ["Sat", "Sun"]
+}
+
+// MaintenanceClock maps the real time to the time windows are evaluated against, so a
+// test can start right before a window and fast-forward through it.
+type MaintenanceClock struct {
+	Start time.Time `json:"start"` // Simulated time at daemon start, defaults to the real time
+	Speed float64   `json:"speed"` // Simulated seconds per real second, defaults to 1
+}
+
+// maintenanceWindow is a parsed MaintenanceWindow.
+type maintenanceWindow struct {
+	devices   []string
+	at        time.Time     // Start of a one-off window, zero for daily windows
+	timeOfDay time.Duration // Start of a daily window after midnight UTC
+	weekdays  []time.Weekday
+	duration  time.Duration
+}
+
+// maintenanceClock converts the real time into the simulated maintenance time.
+type maintenanceClock struct {
+	realStart time.Time
+	simStart  time.Time
+	speed     float64
+}
+
+// Parses the configured windows, rejecting malformed starts, durations and weekdays
+func parseMaintenanceWindows(windows []MaintenanceWindow) ([]*maintenanceWindow, error) {
+	parsed := make([]*maintenanceWindow, 0, len(windows))
+	for i, w := range windows {
+		mw := &maintenanceWindow{devices: w.Devices, duration: time.Duration(w.Duration)}
+		if mw.duration <= 0 {
+			return nil, fmt.Errorf("maintenanceWindows[%d]: duration must be positive", i)
+		}
+		if at, err := time.Parse(time.RFC3339, w.Start); err == nil {
+			if len(w.Weekdays) > 0 {
+				return nil, fmt.Errorf("maintenanceWindows[%d]: weekdays only apply to daily windows", i)
+			}
+			mw.at = at
+		} else if tod, err := time.Parse("15:04", w.Start); err == nil {
+			mw.timeOfDay = time.Duration(tod.Hour())*time.Hour + time.Duration(tod.Minute())*time.Minute
+		} else {
+			return nil, fmt.Errorf("maintenanceWindows[%d]: start %q is neither HH:MM nor an RFC3339 timestamp", i, w.Start)
+		}
+		for _, day := range w.Weekdays {
+			weekday, err := parseWeekday(day)
+			if err != nil {
+				return nil, fmt.Errorf("maintenanceWindows[%d]: %w", i, err)
+			}
+			mw.weekdays = append(mw.weekdays, weekday)
+		}
+		parsed = append(parsed, mw)
+	}
+	return parsed, nil
+}
+
+// Parses a weekday by its English name or three-letter abbreviation
+func parseWeekday(day string) (time.Weekday, error) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		name := weekday.String()
+		if strings.EqualFold(day, name) || strings.EqualFold(day, name[:3]) {
+			return weekday, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", day)
+}
+
+// Reports whether the window is open at t. Daily windows are checked against every start
+// that could still be running, so windows spanning midnight or lasting days work as well.
+func (w *maintenanceWindow) open(t time.Time) bool {
+	t = t.UTC()
+	if !w.at.IsZero() {
+		return !t.Before(w.at) && t.Before(w.at.Add(w.duration))
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	for back := 0; back <= int(w.duration/(24*time.Hour))+1; back++ {
+		start := midnight.AddDate(0, 0, -back).Add(w.timeOfDay)
+		if len(w.weekdays) > 0 && !slices.Contains(w.weekdays, start.Weekday()) {
+			continue
+		}
+		if !t.Before(start) && t.Before(start.Add(w.duration)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Assigns each device the windows listing its name or type, or no device at all.
+// Devices named in a window that match no simulated device are reported.
+func applyMaintenanceWindows(fleet []*device, windows []*maintenanceWindow) {
+	used := make(map[string]bool)
+	for _, dev := range fleet {
+		for _, key := range dev.setMaintenanceWindows(windows) {
+			used[key] = true
+		}
+	}
+	for _, w := range windows {
+		for _, key := range w.devices {
+			if !used[key] {
+				log.Printf("Daemon Service (Go): WARNING: maintenance window configured for '%s', which matches no simulated device", key)
+			}
+		}
+	}
+}
+
+// Sets the windows listing the device's name or type, or no device at all, and returns
+// the names and types that matched
+func (d *device) setMaintenanceWindows(windows []*maintenanceWindow) []string {
+	d.maintenanceWindows = nil
+	var matched []string
+	for _, w := range windows {
+		if len(w.devices) == 0 {
+			d.maintenanceWindows = append(d.maintenanceWindows, w)
+			continue
+		}
+		for _, key := range []string{d.Name, d.Type} {
+			if slices.Contains(w.devices, key) {
+				matched = append(matched, key)
+				d.maintenanceWindows = append(d.maintenanceWindows, w)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+func newMaintenanceClock(cfg *MaintenanceClock, startedAt time.Time) (maintenanceClock, error) {
+	clock := maintenanceClock{realStart: startedAt, simStart: startedAt, speed: 1}
+	if cfg == nil {
+		return clock, nil
+	}
+	if cfg.Speed < 0 {
+		return clock, errors.New("maintenanceClock.speed must not be negative")
+	}
+	if !cfg.Start.IsZero() {
+		clock.simStart = cfg.Start
+	}
+	if cfg.Speed > 0 {
+		clock.speed = cfg.Speed
+	}
+	return clock, nil
+}
+
+// Returns the simulated time corresponding to the real time now
+func (c maintenanceClock) now(now time.Time) time.Time {
+	if c.speed == 1 && c.simStart.Equal(c.realStart) {
+		return now
+	}
+	return c.simStart.Add(time.Duration(float64(now.Sub(c.realStart)) * c.speed))
+}
+
+// Tracks whether a scheduled window of the device is open at the simulated time and
+// returns the MaintenanceStart or MaintenanceEnd event when that changed, nil otherwise
+func (c maintenanceClock) step(dev *device, now time.Time) *Event {
+	if len(dev.maintenanceWindows) == 0 {
+		return nil
+	}
+	simNow := c.now(now)
+	open := slices.ContainsFunc(dev.maintenanceWindows, func(w *maintenanceWindow) bool { return w.open(simNow) })
+	if open == dev.inMaintenanceWindow {
+		return nil
+	}
+	dev.inMaintenanceWindow = open
+	if open {
+		return newLifecycleEvent(dev, MaintenanceStartEvent, 1, now,
+			fmt.Sprintf("Scheduled maintenance window started at %s", simNow.UTC().Format(time.RFC3339)))
+	}
+	return newLifecycleEvent(dev, MaintenanceEndEvent, 1, now,
+		fmt.Sprintf("Scheduled maintenance window ended at %s", simNow.UTC().Format(time.RFC3339)))
+}
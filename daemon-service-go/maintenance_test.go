@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mustParseWindow parses a single maintenance window
+func mustParseWindow(t *testing.T, w MaintenanceWindow) *maintenanceWindow {
+	t.Helper()
+	windows, err := parseMaintenanceWindows([]MaintenanceWindow{w})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return windows[0]
+}
+
+func TestMaintenanceWindowOpen(t *testing.T) {
+	saturday := time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		window MaintenanceWindow
+		at     time.Time
+		want   bool
+	}{
+		{"one-off before", MaintenanceWindow{Start: "2026-03-01T02:00:00Z", Duration: Duration(30 * time.Minute)}, time.Date(2026, 3, 1, 1, 59, 59, 0, time.UTC), false},
+		{"one-off at its start", MaintenanceWindow{Start: "2026-03-01T02:00:00Z", Duration: Duration(30 * time.Minute)}, time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC), true},
+		{"one-off at its end", MaintenanceWindow{Start: "2026-03-01T02:00:00Z", Duration: Duration(30 * time.Minute)}, time.Date(2026, 3, 1, 2, 30, 0, 0, time.UTC), false},
+		{"daily", MaintenanceWindow{Start: "12:00", Duration: Duration(time.Hour)}, saturday.Add(12*time.Hour + 59*time.Minute), true},
+		{"daily outside", MaintenanceWindow{Start: "12:00", Duration: Duration(time.Hour)}, saturday.Add(13 * time.Hour), false},
+		{"spanning midnight, after it", MaintenanceWindow{Start: "23:30", Duration: Duration(time.Hour)}, saturday.Add(20 * time.Minute), true},
+		{"lasting days", MaintenanceWindow{Start: "06:00", Duration: Duration(50 * time.Hour)}, saturday.Add(55 * time.Hour), true},
+		{"on a listed weekday", MaintenanceWindow{Start: "10:00", Duration: Duration(time.Hour), Weekdays: []string{"Sat"}}, saturday.Add(10 * time.Hour), true},
+		{"on another weekday", MaintenanceWindow{Start: "10:00", Duration: Duration(time.Hour), Weekdays: []string{"sunday"}}, saturday.Add(10 * time.Hour), false},
+		{"spanning into an unlisted day", MaintenanceWindow{Start: "23:30", Duration: Duration(time.Hour), Weekdays: []string{"Fri"}}, saturday.Add(20 * time.Minute), true},
+		{"other time zone", MaintenanceWindow{Start: "12:00", Duration: Duration(time.Hour)}, saturday.Add(12 * time.Hour).In(time.FixedZone("UTC+5", 5*3600)), true},
+	}
+	for _, tt := range tests {
+		if got := mustParseWindow(t, tt.window).open(tt.at); got != tt.want {
+			t.Errorf("%s: open(%s) = %t, want %t", tt.name, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestParseMaintenanceWindowsRejects(t *testing.T) {
+	for _, w := range []MaintenanceWindow{
+		{Start: "12:00"},
+		{Start: "12:00", Duration: Duration(-time.Hour)},
+		{Start: "noon", Duration: Duration(time.Hour)},
+		{Start: "25:00", Duration: Duration(time.Hour)},
+		{Start: "12:00", Duration: Duration(time.Hour), Weekdays: []string{"Funday"}},
+		{Start: "2026-03-01T02:00:00Z", Duration: Duration(time.Hour), Weekdays: []string{"Sun"}},
+	} {
+		if _, err := parseMaintenanceWindows([]MaintenanceWindow{w}); err == nil {
+			t.Errorf("accepted %+v", w)
+		}
+	}
+	if _, err := newMaintenanceClock(&MaintenanceClock{Speed: -1}, time.Now()); err == nil {
+		t.Error("accepted a negative clock speed")
+	}
+}
+
+// Fast-forwards a device through a window: a simulated hour passes every real second
+func TestMaintenanceWindowSilencesTheDevice(t *testing.T) {
+	var out bytes.Buffer
+	settings := newTestSettings(t, &out, time.Second)
+	settings.eventShare = func(*device) float64 { return 0 }
+	realStart := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	clock, err := newMaintenanceClock(&MaintenanceClock{Start: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), Speed: 3600}, realStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.maintenance = clock
+
+	// Open from 02:00 to 04:00 simulated, that is real seconds 2 to 4
+	windows := []*maintenanceWindow{
+		mustParseWindow(t, MaintenanceWindow{Devices: []string{"StorageArray"}, Start: "02:00", Duration: Duration(2 * time.Hour)}),
+	}
+	fleet := buildFleet(3, sourceDevices)
+	applyMaintenanceWindows(fleet, windows)
+
+	for _, dev := range fleet {
+		g := newDeviceGenerator(dev, 7, settings)
+		for second := range 6 {
+			if err := g.cycle(realStart.Add(time.Duration(second) * time.Second)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var got []string // "<device type> <second> <metric or event type>"
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		_, payload, _ := strings.Cut(scanner.Text(), " ")
+		var msg struct {
+			Timestamp    string `json:"timestamp"`
+			SourceDevice string `json:"sourceDevice"`
+			MetricType   string `json:"metricType"`
+			EventType    string `json:"eventType"`
+		}
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			t.Fatalf("malformed dry-run line %q", scanner.Text())
+		}
+		ts, _ := time.Parse(time.RFC3339Nano, msg.Timestamp)
+		kind := "metric"
+		if msg.EventType != "" {
+			kind = msg.EventType
+		}
+		got = append(got, strings.Split(msg.SourceDevice, "-")[0]+" "+ts.Sub(realStart).String()+" "+kind)
+	}
+	want := []string{
+		"StorageArray 0s metric", "StorageArray 1s metric",
+		"StorageArray 2s " + MaintenanceStartEvent,
+		"StorageArray 4s " + MaintenanceEndEvent, "StorageArray 4s metric",
+		"StorageArray 5s metric",
+	}
+	for _, deviceType := range []string{"DiskUnit", "CloudStorage"} {
+		for second := range 6 {
+			want = append(want, deviceType+" "+(time.Duration(second)*time.Second).String()+" metric")
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("published\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strconv"
+)
+
+// payloadCorruption is one documented way of breaking a serialized payload.
+type payloadCorruption struct {
+	name        string
+	description string
+	apply       func(data []byte, randGen *rand.Rand) []byte
+}
+
+// payloadCorruptions lists every corruption the malformed-payload injection can choose from.
+var payloadCorruptions = []payloadCorruption{
+	{
+		name:        "truncated",
+		description: "cuts the JSON document at a random byte, leaving it unterminated",
+		apply:       truncatePayload,
+	},
+	{
+		name:        "wrong-types",
+		description: "turns numeric fields into strings and string fields into numbers",
+		apply:       swapFieldTypes,
+	},
+	{
+		name:        "missing-fields",
+		description: "drops the required timestamp and sourceDevice fields",
+		apply:       dropRequiredFields,
+	},
+	{
+		name:        "absurd-values",
+		description: "sets numeric fields to extreme values and the timestamp to a far-future date",
+		apply:       setAbsurdValues,
+	},
+	{
+		name:        "not-json",
+		description: "replaces the payload with bytes that are not JSON at all",
+		apply:       func([]byte, *rand.Rand) []byte { return []byte("\x00\xffnot json at all}") },
+	},
+}
+
+// Picks a random corruption and applies it to a copy of the payload
+func corruptPayload(data []byte, randGen *rand.Rand) ([]byte, payloadCorruption) {
+	corruption := payloadCorruptions[randGen.Intn(len(payloadCorruptions))]
+	return corruption.apply(append([]byte(nil), data...), randGen), corruption
+}
+
+func truncatePayload(data []byte, randGen *rand.Rand) []byte {
+	if len(data) < 2 {
+		return data[:0]
+	}
+	return data[:1+randGen.Intn(len(data)-1)]
+}
+
+func swapFieldTypes(data []byte, _ *rand.Rand) []byte {
+	return mutateFields(data, func(fields map[string]any) {
+		for key, value := range fields {
+			switch v := value.(type) {
+			case float64:
+				fields[key] = strconv.FormatFloat(v, 'f', -1, 64) // a string where a number is expected
+			case string:
+				fields[key] = len(v) // a number where a string is expected
+			}
+		}
+	})
+}
+
+func dropRequiredFields(data []byte, _ *rand.Rand) []byte {
+	return mutateFields(data, func(fields map[string]any) {
+		delete(fields, "timestamp")
+		delete(fields, "sourceDevice")
+	})
+}
+
+func setAbsurdValues(data []byte, randGen *rand.Rand) []byte {
+	absurd := []float64{-1e308, 1e308, -273.16, 4294967296}
+	return mutateFields(data, func(fields map[string]any) {
+		for key, value := range fields {
+			if _, ok := value.(float64); ok {
+				fields[key] = absurd[randGen.Intn(len(absurd))]
+			}
+		}
+		if _, ok := fields["timestamp"]; ok {
+			fields["timestamp"] = "9999-12-31T23:59:59.999999999Z"
+		}
+	})
+}
+
+// Decodes a JSON object, lets mutate change its fields and encodes it again.
+// Payloads that are not objects are returned unchanged.
+func mutateFields(data []byte, mutate func(map[string]any)) []byte {
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data
+	}
+	mutate(fields)
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return data
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+// validMetricPayload is a serialized metric as the publisher sends it
+const validMetricPayload = `{"schemaVersion":2,"timestamp":"2025-01-01T00:00:00Z","sourceDevice":"StorageArray-0001","metricType":"DiskTemp","value":41.5}`
+
+// decodedFields returns the fields of a JSON object, nil when data is not one
+func decodedFields(data []byte) map[string]any {
+	var fields map[string]any
+	if json.Unmarshal(data, &fields) != nil {
+		return nil
+	}
+	return fields
+}
+
+func TestPayloadCorruptions(t *testing.T) {
+	checks := map[string]func(t *testing.T, corrupted []byte){
+		"truncated": func(t *testing.T, corrupted []byte) {
+			if json.Valid(corrupted) {
+				t.Errorf("truncated payload %q is valid JSON", corrupted)
+			}
+			if len(corrupted) == 0 || !bytes.HasPrefix([]byte(validMetricPayload), corrupted) {
+				t.Errorf("payload %q is not a non-empty prefix of the original", corrupted)
+			}
+		},
+		"wrong-types": func(t *testing.T, corrupted []byte) {
+			fields := decodedFields(corrupted)
+			if _, ok := fields["value"].(string); !ok {
+				t.Errorf("value %#v is not a string", fields["value"])
+			}
+			if _, ok := fields["sourceDevice"].(float64); !ok {
+				t.Errorf("sourceDevice %#v is not a number", fields["sourceDevice"])
+			}
+		},
+		"missing-fields": func(t *testing.T, corrupted []byte) {
+			fields := decodedFields(corrupted)
+			for _, name := range []string{"timestamp", "sourceDevice"} {
+				if _, ok := fields[name]; ok {
+					t.Errorf("required field %s kept", name)
+				}
+			}
+			if fields["metricType"] != "DiskTemp" {
+				t.Errorf("other fields not kept: %s", corrupted)
+			}
+		},
+		"absurd-values": func(t *testing.T, corrupted []byte) {
+			fields := decodedFields(corrupted)
+			if v, ok := fields["value"].(float64); !ok || v == 41.5 {
+				t.Errorf("value %#v not replaced by an absurd number", fields["value"])
+			}
+			if fields["timestamp"] != "9999-12-31T23:59:59.999999999Z" {
+				t.Errorf("timestamp %v not moved to the far future", fields["timestamp"])
+			}
+		},
+		"not-json": func(t *testing.T, corrupted []byte) {
+			if json.Valid(corrupted) {
+				t.Errorf("payload %q is valid JSON", corrupted)
+			}
+		},
+	}
+
+	for _, corruption := range payloadCorruptions {
+		t.Run(corruption.name, func(t *testing.T) {
+			check, ok := checks[corruption.name]
+			if !ok {
+				t.Fatalf("corruption %s has no test", corruption.name)
+			}
+			if corruption.description == "" {
+				t.Error("corruption is not documented")
+			}
+			for seed := range int64(20) {
+				original := []byte(validMetricPayload)
+				corrupted := corruption.apply(append([]byte(nil), original...), rand.New(rand.NewSource(seed)))
+				if bytes.Equal(corrupted, original) {
+					t.Fatalf("seed %d: payload unchanged", seed)
+				}
+				check(t, corrupted)
+			}
+		})
+	}
+	if len(checks) != len(payloadCorruptions) {
+		t.Errorf("%d checks for %d corruptions", len(checks), len(payloadCorruptions))
+	}
+}
+
+func TestCorruptPayloadLeavesTheOriginal(t *testing.T) {
+	original := []byte(validMetricPayload)
+	randGen := rand.New(rand.NewSource(1))
+	seen := map[string]bool{}
+	for range 200 {
+		_, corruption := corruptPayload(original, randGen)
+		seen[corruption.name] = true
+		if string(original) != validMetricPayload {
+			t.Fatalf("corruption %s changed the original payload to %q", corruption.name, original)
+		}
+	}
+	if len(seen) != len(payloadCorruptions) {
+		t.Errorf("chose %d of %d corruptions in 200 draws", len(seen), len(payloadCorruptions))
+	}
+}
+
+func TestMutateFieldsKeepsNonObjects(t *testing.T) {
+	for _, data := range []string{`[1,2]`, `"text"`, `{"broken"`} {
+		if got := mutateFields([]byte(data), func(map[string]any) { t.Errorf("mutated %s", data) }); string(got) != data {
+			t.Errorf("mutateFields(%s) = %s, want it unchanged", data, got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultMetricMetadata describes the unit and display precision of the built-in metric types.
+const defaultMetricMetadata = "DiskTemp:°C:1,IOPs:ops/s:0,Latency:ms:2,CapacityUsed:%:1"
+
+// metricMetadata is the optional unit and precision attached to every metric of one type.
+type metricMetadata struct {
+	Unit      string
+	Precision *int // Number of meaningful decimal places, nil when not configured
+}
+
+// Parses a metadata table such as "DiskTemp:°C:1,IOPs:ops/s". The precision is optional
+// and "none" yields an empty table, which keeps generated metrics free of metadata.
+func parseMetricMetadata(spec string) (map[string]metricMetadata, error) {
+	table := make(map[string]metricMetadata)
+	spec = strings.TrimSpace(spec)
+	if spec == "" || strings.EqualFold(spec, "none") {
+		return table, nil
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("entry %q: expected <metricType>:<unit>[:<precision>]", entry)
+		}
+
+		meta := metricMetadata{Unit: parts[1]}
+		if len(parts) == 3 {
+			precision, err := strconv.Atoi(parts[2])
+			if err != nil || precision < 0 {
+				return nil, fmt.Errorf("entry %q: precision must be a non-negative integer", entry)
+			}
+			meta.Precision = &precision
+		}
+		if !slices.Contains(metricTypes, parts[0]) {
+			log.Printf("Daemon Service (Go): WARNING: metadata defined for unknown metric type '%s'", parts[0])
+		}
+		table[parts[0]] = meta
+	}
+	return table, nil
+}
+
+// Fills the unit and precision of a metric from the table, leaving them empty when undefined
+func applyMetricMetadata(metric *DeviceMetric, table map[string]metricMetadata) {
+	meta, ok := table[metric.MetricType]
+	if !ok {
+		return
+	}
+	metric.Unit = meta.Unit
+	metric.Precision = meta.Precision
+}
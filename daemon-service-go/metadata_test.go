@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func TestParseMetricMetadata(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[string]string // Unit and precision per metric type as "<unit>:<precision>"
+		wantErr bool
+	}{
+		{spec: defaultMetricMetadata, want: map[string]string{"DiskTemp": "°C:1", "IOPs": "ops/s:0", "Latency": "ms:2", "CapacityUsed": "%:1"}},
+		{spec: "DiskTemp:°F", want: map[string]string{"DiskTemp": "°F:-"}},
+		{spec: " IOPs:ops/s:0 , Latency:us:3 ", want: map[string]string{"IOPs": "ops/s:0", "Latency": "us:3"}},
+		{spec: "none", want: map[string]string{}},
+		{spec: "", want: map[string]string{}},
+		{spec: "DiskTemp", wantErr: true},
+		{spec: "DiskTemp:", wantErr: true},
+		{spec: ":°C", wantErr: true},
+		{spec: "DiskTemp:°C:one", wantErr: true},
+		{spec: "DiskTemp:°C:-1", wantErr: true},
+		{spec: "DiskTemp:°C:1:2", wantErr: true},
+	}
+	for _, tt := range tests {
+		table, err := parseMetricMetadata(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseMetricMetadata(%q) = %v, want error %t", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		got := make(map[string]string, len(table))
+		for metricType, meta := range table {
+			precision := "-"
+			if meta.Precision != nil {
+				precision = strconv.Itoa(*meta.Precision)
+			}
+			got[metricType] = meta.Unit + ":" + precision
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseMetricMetadata(%q) = %v, want %v", tt.spec, got, tt.want)
+			continue
+		}
+		for metricType, want := range tt.want {
+			if got[metricType] != want {
+				t.Errorf("parseMetricMetadata(%q)[%s] = %q, want %q", tt.spec, metricType, got[metricType], want)
+			}
+		}
+	}
+}
+
+func TestMetricJSONWithAndWithoutMetadata(t *testing.T) {
+	table, err := parseMetricMetadata("DiskTemp:°C:1,IOPs:ops/s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		metricType    string
+		table         map[string]metricMetadata
+		wantUnit      any // nil when the field must be absent
+		wantPrecision any
+	}{
+		{name: "unit and precision", metricType: "DiskTemp", table: table, wantUnit: "°C", wantPrecision: 1.0},
+		{name: "unit only", metricType: "IOPs", table: table, wantUnit: "ops/s"},
+		{name: "type without metadata", metricType: "Latency", table: table},
+		{name: "metadata disabled", metricType: "DiskTemp", table: map[string]metricMetadata{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric := DeviceMetric{Timestamp: "2025-01-01T00:00:00Z", SourceDevice: "StorageArray-0001", MetricType: tt.metricType, Value: 42.5}
+			applyMetricMetadata(&metric, tt.table)
+			data, err := json.Marshal(metric)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]any
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatal(err)
+			}
+			if unit, ok := fields["unit"]; unit != tt.wantUnit || ok != (tt.wantUnit != nil) {
+				t.Errorf("unit = %v (present %t), want %v in %s", unit, ok, tt.wantUnit, data)
+			}
+			if precision, ok := fields["precision"]; precision != tt.wantPrecision || ok != (tt.wantPrecision != nil) {
+				t.Errorf("precision = %v (present %t), want %v in %s", precision, ok, tt.wantPrecision, data)
+			}
+			if fields["value"] != 42.5 {
+				t.Errorf("value = %v, want 42.5 in %s", fields["value"], data)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// fakeNATS is a NATS server speaking just enough of the client protocol for the daemon's
+// connections, as no server is embedded in the tests: it records every published message
+// and, in jetStream mode, acks messages with a reply subject the way a stream would,
+// flagging messages whose Nats-Msg-Id it stored before as duplicates.
+type fakeNATS struct {
+	ln         net.Listener
+	maxPayload int
+	jetStream  bool
+
+	mu       sync.Mutex
+	messages []*nats.Msg
+	stored   map[string]bool // Message IDs acked so far
+	subs     map[net.Conn]map[string]string
+	conns    map[net.Conn]bool
+}
+
+// startFakeNATS starts a fakeNATS on a free local port, stopped when the test ends
+func startFakeNATS(t *testing.T, maxPayload int, jetStream bool) *fakeNATS {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeNATS{
+		ln: ln, maxPayload: maxPayload, jetStream: jetStream,
+		stored: map[string]bool{}, subs: map[net.Conn]map[string]string{}, conns: map[net.Conn]bool{},
+	}
+	go s.accept()
+	t.Cleanup(s.stop)
+	return s
+}
+
+func (s *fakeNATS) url() string {
+	return "nats://" + s.ln.Addr().String()
+}
+
+// stop closes the listener and every client connection
+func (s *fakeNATS) stop() {
+	s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// received returns the messages published so far
+func (s *fakeNATS) received() []*nats.Msg {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*nats.Msg(nil), s.messages...)
+}
+
+func (s *fakeNATS) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.subs[conn] = map[string]string{}
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+// serve answers one client connection until it is closed
+func (s *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"version\":\"2.10.0\",\"proto\":1,\"headers\":true,\"max_payload\":%d}\r\n", s.maxPayload)
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			s.write(conn, "PONG\r\n")
+		case "SUB": // SUB <subject> [queue] <sid>
+			s.mu.Lock()
+			s.subs[conn][fields[len(fields)-1]] = fields[1]
+			s.mu.Unlock()
+		case "UNSUB":
+			s.mu.Lock()
+			delete(s.subs[conn], fields[1])
+			s.mu.Unlock()
+		case "PUB", "HPUB": // PUB <subject> [reply] <size>, HPUB <subject> [reply] <header size> <size>
+			headers := fields[0] == "HPUB"
+			sizes := 1
+			if headers {
+				sizes = 2
+			}
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			reply := ""
+			if len(fields) == 3+sizes {
+				reply = fields[2]
+			}
+			raw := make([]byte, size+2)
+			if _, err := io.ReadFull(r, raw); err != nil {
+				return
+			}
+			msg := &nats.Msg{Subject: fields[1], Reply: reply, Data: raw[:size], Header: nats.Header{}}
+			if headers {
+				headerSize, _ := strconv.Atoi(fields[len(fields)-2])
+				msg.Header = parseFakeHeader(string(raw[:headerSize]))
+				msg.Data = raw[headerSize:size]
+			}
+			s.publish(msg)
+		}
+	}
+}
+
+// publish records a message and acks it in jetStream mode
+func (s *fakeNATS) publish(msg *nats.Msg) {
+	s.mu.Lock()
+	s.messages = append(s.messages, msg)
+	if !s.jetStream || msg.Reply == "" {
+		s.mu.Unlock()
+		return
+	}
+	id := msg.Header.Get(jetstream.MsgIDHeader)
+	duplicate := id != "" && s.stored[id]
+	s.stored[id] = true
+	ack, _ := json.Marshal(map[string]interface{}{"stream": "EVENTS", "seq": len(s.messages), "duplicate": duplicate})
+	var deliveries []func()
+	for conn, subs := range s.subs {
+		for sid, subject := range subs {
+			if subjectMatches(subject, msg.Reply) {
+				deliveries = append(deliveries, func() {
+					s.write(conn, fmt.Sprintf("MSG %s %s %d\r\n%s\r\n", msg.Reply, sid, len(ack), ack))
+				})
+			}
+		}
+	}
+	s.mu.Unlock()
+	for _, deliver := range deliveries {
+		deliver()
+	}
+}
+
+func (s *fakeNATS) write(conn net.Conn, data string) {
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_, _ = io.WriteString(conn, data)
+}
+
+// parseFakeHeader parses the NATS/1.0 header block of an HPUB
+func parseFakeHeader(raw string) nats.Header {
+	header := nats.Header{}
+	for _, line := range strings.Split(raw, "\r\n")[1:] {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			header.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+	}
+	return header
+}
+
+// subjectMatches reports whether subject matches pattern, which may hold * and > wildcards
+func subjectMatches(pattern, subject string) bool {
+	p, s := strings.Split(pattern, "."), strings.Split(subject, ".")
+	for i, token := range p {
+		if token == ">" {
+			return len(s) > i
+		}
+		if i >= len(s) || token != "*" && token != s[i] {
+			return false
+		}
+	}
+	return len(p) == len(s)
+}
+
+// connectFakeClusters connects a cluster to each server as the daemon would
+func connectFakeClusters(t *testing.T, jetStream bool, servers ...*fakeNATS) []*cluster {
+	t.Helper()
+	urls := make([]string, len(servers))
+	for i, s := range servers {
+		urls[i] = s.url()
+	}
+	cfg := connectionConfig{MaxReconnects: 0, ReconnectWait: 10 * time.Millisecond, ConnectTimeout: time.Second, JetStream: jetStream}
+	clusters, err := connectClusters(urls, cfg, func() {})
+	if err != nil {
+		t.Fatalf("connectClusters: %v", err)
+	}
+	t.Cleanup(func() { _ = closeClusters(clusters, 0) })
+	return clusters
+}
+
+// waitForMessages waits until the server received n messages and returns them
+func waitForMessages(t *testing.T, s *fakeNATS, n int) []*nats.Msg {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		msgs := s.received()
+		if len(msgs) >= n || time.Now().After(deadline) {
+			if len(msgs) != n {
+				t.Fatalf("server received %d message(s), want %d", len(msgs), n)
+			}
+			return msgs
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// OTLP export constants.
+const (
+	otlpServiceName     = "daemon-service-go"
+	otlpMetricsPath     = "/v1/metrics" // Appended to the endpoint like the SDK does for OTEL_EXPORTER_OTLP_ENDPOINT
+	otlpShutdownTimeout = 5 * time.Second
+)
+
+// otlpExporter records the published device metrics as OTel gauges, one instrument per
+// metric type with the device as attribute, and exports them periodically over OTLP/HTTP.
+// Recording only updates in-memory aggregates; exports run on the reader's own goroutine
+// and their failures are logged, so NATS publishing never waits for the collector.
+type otlpExporter struct {
+	provider *sdkmetric.MeterProvider
+	meter    metric.Meter
+
+	mu     sync.Mutex
+	gauges map[string]metric.Float64Gauge // Instruments by metric type, created on first use
+}
+
+// Returns the exporter sending to the collector at endpoint, nil when endpoint is empty.
+// The export interval and headers follow the standard OTEL_* environment variables.
+func newOTLPExporter(ctx context.Context, endpoint string) (*otlpExporter, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	exporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(strings.TrimSuffix(endpoint, "/")+otlpMetricsPath))
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", otlpServiceName)),
+		resource.WithFromEnv(), // OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Printf("Daemon: OTLP export failed: %v", err)
+	}))
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(res),
+	)
+	return &otlpExporter{
+		provider: provider,
+		meter:    provider.Meter(otlpServiceName),
+		gauges:   make(map[string]metric.Float64Gauge),
+	}, nil
+}
+
+// Records the metric value on the gauge of its metric type
+func (e *otlpExporter) recordMetric(m DeviceMetric) {
+	gauge, err := e.gauge(m.MetricType, m.Unit)
+	if err != nil {
+		log.Printf("Daemon: Failed to create OTLP instrument for metric [%s]: %v", m.MetricType, err)
+		return
+	}
+	gauge.Record(context.Background(), m.Value, metric.WithAttributes(attribute.String("device", m.SourceDevice)))
+}
+
+// Returns the gauge of the metric type, created with the unit of its first metric
+func (e *otlpExporter) gauge(metricType, unit string) (metric.Float64Gauge, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if gauge, ok := e.gauges[metricType]; ok {
+		return gauge, nil
+	}
+	var opts []metric.Float64GaugeOption
+	if unit != "" {
+		opts = append(opts, metric.WithUnit(unit))
+	}
+	gauge, err := e.meter.Float64Gauge(metricType, opts...)
+	if err != nil {
+		return nil, err
+	}
+	e.gauges[metricType] = gauge
+	return gauge, nil
+}
+
+// Exports what was recorded since the last export and stops the exporter, giving up
+// after otlpShutdownTimeout so an unreachable collector does not hold up the exit
+func (e *otlpExporter) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), otlpShutdownTimeout)
+	defer cancel()
+	if err := e.provider.Shutdown(ctx); err != nil {
+		log.Printf("Daemon Service (Go): Failed to flush OTLP metrics on shutdown: %v", err)
+	}
+}
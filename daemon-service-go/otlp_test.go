@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// newManualOTLPExporter returns an exporter whose metrics are collected by the test
+func newManualOTLPExporter() (*otlpExporter, *sdkmetric.ManualReader) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	return &otlpExporter{
+		provider: provider,
+		meter:    provider.Meter(otlpServiceName),
+		gauges:   make(map[string]metric.Float64Gauge),
+	}, reader
+}
+
+func TestOTLPExporterRecordsPublishedMetrics(t *testing.T) {
+	exporter, reader := newManualOTLPExporter()
+	var out strings.Builder
+	pub := newTestSettings(t, &out, time.Second).pub
+	pub.otlp = exporter
+
+	for _, m := range []DeviceMetric{
+		{SourceDevice: "StorageArray-0001", MetricType: "IOPs", Value: 100},
+		{SourceDevice: "StorageArray-0001", MetricType: "IOPs", Value: 250}, // A gauge keeps the last value
+		{SourceDevice: "DiskUnit-0001", MetricType: "IOPs", Value: 700},
+		{SourceDevice: "DiskUnit-0001", MetricType: "DiskTemp", Value: 41.5, Unit: "Cel"},
+	} {
+		if err := pub.publishMetric(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 4 {
+		t.Errorf("published %d message(s), want every metric on the primary path", lines)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{} // "<instrument> <device>" → value
+	units := map[string]string{}
+	for _, scope := range rm.ScopeMetrics {
+		if scope.Scope.Name != otlpServiceName {
+			t.Errorf("instruments of scope %q, want %q", scope.Scope.Name, otlpServiceName)
+		}
+		for _, m := range scope.Metrics {
+			units[m.Name] = m.Unit
+			gauge, ok := m.Data.(metricdata.Gauge[float64])
+			if !ok {
+				t.Fatalf("%s recorded as %T, want a float64 gauge", m.Name, m.Data)
+			}
+			for _, dp := range gauge.DataPoints {
+				device, ok := dp.Attributes.Value(attribute.Key("device"))
+				if !ok || dp.Attributes.Len() != 1 {
+					t.Errorf("%s data point has attributes %v, want just the device", m.Name, dp.Attributes.ToSlice())
+				}
+				got[m.Name+" "+device.AsString()] = dp.Value
+			}
+		}
+	}
+	want := map[string]float64{
+		"IOPs StorageArray-0001": 250,
+		"IOPs DiskUnit-0001":     700,
+		"DiskTemp DiskUnit-0001": 41.5,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("recorded %v, want %v", got, want)
+	}
+	if units["DiskTemp"] != "Cel" || units["IOPs"] != "" {
+		t.Errorf("instrument units %v, want the metrics' units", units)
+	}
+}
+
+// A failing collector neither fails publishing nor holds up the shutdown
+func TestOTLPExporterFailuresLeavePublishingAlone(t *testing.T) {
+	var exports atomic.Int64
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exports.Add(1)
+		http.Error(w, "collector down", http.StatusInternalServerError)
+	}))
+	defer collector.Close()
+
+	if exporter, err := newOTLPExporter(context.Background(), ""); exporter != nil || err != nil {
+		t.Fatalf("newOTLPExporter without endpoint = %v, %v, want neither", exporter, err)
+	}
+	exporter, err := newOTLPExporter(context.Background(), collector.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := newTestSettings(t, io.Discard, time.Second).pub
+	pub.otlp = exporter
+	if err := pub.publishMetric(DeviceMetric{SourceDevice: "StorageArray-0001", MetricType: "IOPs", Value: 100}); err != nil {
+		t.Fatalf("publishMetric with a failing collector = %v", err)
+	}
+	start := time.Now()
+	exporter.shutdown()
+	if elapsed := time.Since(start); elapsed > otlpShutdownTimeout {
+		t.Errorf("shutdown took %s", elapsed)
+	}
+	if exports.Load() == 0 {
+		t.Error("metrics not exported to the collector on shutdown")
+	}
+	if pub.stats.metrics.Load() != 1 || pub.stats.failed.Load() != 0 {
+		t.Errorf("counted %d published and %d failed metric(s)", pub.stats.metrics.Load(), pub.stats.failed.Load())
+	}
+}
@@ -0,0 +1,52 @@
+package simulator
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Capacity model constants.
+const (
+	capacityCriticalLevel  = 95.0 // CapacityUsed above which cleanups become more likely
+	capacityNoiseFraction  = 0.5  // Noise of a growth step relative to the step itself
+	capacityMinCleanupDrop = 5.0  // Smallest cleanup drop in percentage points
+	capacityMaxCleanupDrop = 25.0 // Largest cleanup drop in percentage points
+)
+
+// CapacityConfig shapes how CapacityUsed develops per device.
+type CapacityConfig struct {
+	GrowthPerHour   float64 // Mean growth in percentage points per hour
+	CleanupsPerHour float64 // Expected cleanups per hour, each dropping usage by 5-25 points
+}
+
+// DefaultCapacity grows usage by half a point per hour with a cleanup every two days.
+var DefaultCapacity = CapacityConfig{GrowthPerHour: 0.5, CleanupsPerHour: 0.02}
+
+// Returns the next CapacityUsed of the device. Usage starts uniformly within [lo, hi],
+// then grows with the elapsed time plus some noise, drops now and then when data is
+// cleaned up (more likely the fuller the device) and stays within [0, 100].
+func (d *Device) nextCapacity(cfg CapacityConfig, lo, hi float64, now time.Time, randGen *rand.Rand) float64 {
+	prev, ok := d.values[CapacityUsed]
+	if !ok {
+		value := lo + randGen.Float64()*(hi-lo)
+		d.values[CapacityUsed] = value
+		d.capacityAt = now
+		return value
+	}
+
+	growth := cfg.GrowthPerHour * now.Sub(d.capacityAt).Hours()
+	value := prev + growth + growth*capacityNoiseFraction*(2*randGen.Float64()-1)
+
+	cleanup := cfg.CleanupsPerHour * now.Sub(d.capacityAt).Hours()
+	if value > capacityCriticalLevel {
+		cleanup *= 5 // Full devices get cleaned up sooner
+	}
+	if randGen.Float64() < cleanup {
+		value -= capacityMinCleanupDrop + randGen.Float64()*(capacityMaxCleanupDrop-capacityMinCleanupDrop)
+	}
+
+	value = min(max(value, 0), 100)
+	d.values[CapacityUsed] = value
+	d.capacityAt = now
+	return value
+}
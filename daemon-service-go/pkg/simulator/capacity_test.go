@@ -0,0 +1,75 @@
+package simulator
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// capacitySeries returns CapacityUsed sampled every step over the simulated duration
+func capacitySeries(cfg CapacityConfig, seed int64, duration, step time.Duration) []float64 {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := DefaultConfig()
+	c.Capacity = cfg
+	gen := New(c, func() time.Time { return now }, rand.New(rand.NewSource(seed)))
+	dev := NewDevice("StorageArray-0001", "StorageArray")
+	var series []float64
+	for elapsed := time.Duration(0); elapsed <= duration; elapsed += step {
+		series = append(series, gen.MetricOf(dev, CapacityUsed).Value)
+		now = now.Add(step)
+	}
+	return series
+}
+
+func TestCapacityGrowsWithoutCleanups(t *testing.T) {
+	series := capacitySeries(CapacityConfig{GrowthPerHour: 0.5}, 7, 48*time.Hour, time.Minute)
+	vr := DefaultMetricRanges[CapacityUsed]
+	if series[0] < vr.Min || series[0] > vr.Max {
+		t.Errorf("first sample %.2f outside the starting range %g-%g", series[0], vr.Min, vr.Max)
+	}
+	for i := 1; i < len(series); i++ {
+		if series[i] < series[i-1] || series[i] > 100 {
+			t.Fatalf("minute %d: %.3f after %.3f, want monotonic growth up to 100", i, series[i], series[i-1])
+		}
+	}
+	// 48h at half a point per hour, noise averages out
+	if growth := series[len(series)-1] - series[0]; series[len(series)-1] < 100 && (growth < 20 || growth > 28) {
+		t.Errorf("grew by %.2f points in 48h, want about 24", growth)
+	}
+}
+
+func TestCapacityCleanupsKeepItBounded(t *testing.T) {
+	for seed := range int64(20) {
+		series := capacitySeries(CapacityConfig{GrowthPerHour: 2, CleanupsPerHour: 0.1}, seed, 7*24*time.Hour, 10*time.Minute)
+		drops := 0
+		for i := 1; i < len(series); i++ {
+			if series[i] < 0 || series[i] > 100 {
+				t.Fatalf("seed %d: sample %.2f outside 0-100", seed, series[i])
+			}
+			if drop := series[i-1] - series[i]; drop > 0 {
+				drops++
+				// Growth within the step offsets a drop slightly, and usage stops at 0
+				if (drop < capacityMinCleanupDrop-1 && series[i] > 0) || drop > capacityMaxCleanupDrop {
+					t.Errorf("seed %d: dropped by %.2f points, want a cleanup of 5-25", seed, drop)
+				}
+			}
+		}
+		// About 0.1 cleanups per hour over a week, more once the device is full
+		if drops < 5 {
+			t.Errorf("seed %d: %d cleanup(s) in a week, want regular ones", seed, drops)
+		}
+	}
+}
+
+func TestCapacityDefaultsShowNetGrowth(t *testing.T) {
+	const devices = 100
+	change := 0.0
+	for seed := range int64(devices) {
+		series := capacitySeries(DefaultCapacity, seed, 24*time.Hour, 5*time.Minute)
+		change += (series[len(series)-1] - series[0]) / devices
+	}
+	// 12 points of growth a day against a cleanup of 15 points every other day
+	if change < 1 || change > 10 {
+		t.Errorf("mean change over a simulated day %.2f points, want net growth of about 4.5", change)
+	}
+}
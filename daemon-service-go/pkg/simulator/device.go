@@ -0,0 +1,52 @@
+package simulator
+
+import (
+	"math/rand"
+	"time"
+)
+
+// randomWalkStep is the largest per-cycle change of a metric, as a fraction of its range.
+const randomWalkStep = 0.05
+
+// Device is one simulated device together with the metric state its values walk from.
+type Device struct {
+	Name     string // Unique device name, e.g. "DiskUnit-0007"
+	Type     string // Base device type from DeviceTypes, e.g. "DiskUnit"
+	Parent   string // Enclosure holding the device, empty for top-level devices
+	Model    string // Hardware model, empty when unknown
+	Firmware string // Firmware version, empty when unknown
+
+	values     map[string]float64 // Last generated value per metric type, drives the random walk
+	capacityAt time.Time          // When CapacityUsed was last generated, drives its growth
+}
+
+func NewDevice(name, deviceType string) *Device {
+	return &Device{Name: name, Type: deviceType, values: make(map[string]float64, len(MetricTypes))}
+}
+
+// Returns the last generated value of a metric type, false before the first one
+func (d *Device) Value(metricType string) (float64, bool) {
+	value, ok := d.values[metricType]
+	return value, ok
+}
+
+// Carries the metric state of old over, so a replaced device continues where it left off
+func (d *Device) Inherit(old *Device) {
+	d.values, d.capacityAt = old.values, old.capacityAt
+}
+
+// Returns the next value of a metric for the device: a uniform draw within [lo, hi]
+// the first time, then a bounded random walk from the previous value.
+func (d *Device) nextValue(metricType string, lo, hi float64, randGen *rand.Rand) float64 {
+	prev, ok := d.values[metricType]
+	if !ok {
+		value := lo + randGen.Float64()*(hi-lo)
+		d.values[metricType] = value
+		return value
+	}
+
+	step := (hi - lo) * randomWalkStep * (2*randGen.Float64() - 1)
+	value := min(max(prev+step, lo), hi)
+	d.values[metricType] = value
+	return value
+}
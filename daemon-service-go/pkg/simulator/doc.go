@@ -0,0 +1,25 @@
+// Package simulator generates realistic storage-fleet metrics and events.
+//
+// It holds the value models of the daemon (bounded random walks within per-type ranges,
+// CapacityUsed growing with time and dropping on cleanups, Latency tracking IOPs) and the
+// wire formats of the messages, without any publishing. A Generator is configured by a
+// Config and driven by an injected clock and RNG, so the same inputs always yield the
+// same messages. That makes it usable for fixtures in the tests of other services:
+//
+//	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+//	cfg := simulator.DefaultConfig()
+//	ids := 0
+//	cfg.NewID = func() string { ids++; return fmt.Sprintf("event-%d", ids) }
+//	gen := simulator.New(cfg, func() time.Time { return now }, rand.New(rand.NewSource(42)))
+//
+//	dev := simulator.NewDevice("StorageArray-0001", "StorageArray")
+//	for i := 0; i < 100; i++ {
+//		metric := gen.Metric(dev) // Walks on from the previous value of the type
+//		event := gen.Event(dev)   // Random type and criticality, no escalation or dedup
+//		now = now.Add(time.Second)
+//		// ... feed metric and event to the code under test
+//	}
+//
+// Scenario behavior such as device outages, escalation or deduplication stays with the
+// daemon, which builds on the messages generated here.
+package simulator
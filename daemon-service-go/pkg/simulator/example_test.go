@@ -0,0 +1,35 @@
+package simulator_test
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"daemon-service-go/pkg/simulator"
+)
+
+// Generates fixture messages for the tests of another service: a fixed clock, seed and
+// event IDs make every run produce the same messages.
+func Example() {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := simulator.DefaultConfig()
+	ids := 0
+	cfg.NewID = func() string { ids++; return fmt.Sprintf("event-%d", ids) }
+	gen := simulator.New(cfg, func() time.Time { return now }, rand.New(rand.NewSource(42)))
+
+	dev := simulator.NewDevice("StorageArray-0001", "StorageArray")
+	for range 3 {
+		metric := gen.MetricOf(dev, simulator.DiskTemp)
+		event := gen.Event(dev)
+		fmt.Printf("%s %s %s=%.2f\n", metric.Timestamp, metric.SourceDevice, metric.MetricType, metric.Value)
+		fmt.Printf("%s %s %s criticality %d\n", event.Timestamp, event.ID, event.EventType, event.Criticality)
+		now = now.Add(time.Second)
+	}
+	// Output:
+	// 2025-01-01T00:00:00Z StorageArray-0001 DiskTemp=38.06
+	// 2025-01-01T00:00:00Z event-1 UnauthorizedAccess criticality 9
+	// 2025-01-01T00:00:01Z StorageArray-0001 DiskTemp=37.04
+	// 2025-01-01T00:00:01Z event-2 DataCorruption criticality 6
+	// 2025-01-01T00:00:02Z StorageArray-0001 DiskTemp=38.13
+	// 2025-01-01T00:00:02Z event-3 UnauthorizedAccess criticality 9
+}
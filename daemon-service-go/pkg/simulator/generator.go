@@ -0,0 +1,104 @@
+package simulator
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Config selects the value models of a Generator.
+type Config struct {
+	Ranges      Ranges               // Value range per metric type, an empty ByType uses the defaults
+	Capacity    CapacityConfig       // Growth and cleanups of CapacityUsed
+	Latency     LatencyConfig        // Coupling of Latency to IOPs
+	Criticality func(*rand.Rand) int // Criticality of random events, nil draws uniformly from 1 to 10
+	NewID       func() string        // Event IDs, nil for random UUIDs
+}
+
+// Returns the configuration the daemon uses without any overrides
+func DefaultConfig() Config {
+	return Config{Ranges: DefaultRanges(), Capacity: DefaultCapacity, Latency: DefaultLatency}
+}
+
+// Generator produces the metrics and events of devices. It is not safe for concurrent
+// use; the daemon runs one per device goroutine.
+type Generator struct {
+	cfg     Config
+	clock   func() time.Time
+	randGen *rand.Rand
+
+	stampTime time.Time // Time of the last formatted timestamp, reused while the clock stands still
+	stamp     string
+}
+
+// Returns a generator taking the time of every message from clock and every random
+// choice from randGen
+func New(cfg Config, clock func() time.Time, randGen *rand.Rand) *Generator {
+	if len(cfg.Ranges.ByType) == 0 {
+		cfg.Ranges = DefaultRanges()
+	}
+	if cfg.Criticality == nil {
+		cfg.Criticality = func(randGen *rand.Rand) int { return randGen.Intn(10) + 1 }
+	}
+	if cfg.NewID == nil {
+		cfg.NewID = uuid.NewString
+	}
+	return &Generator{cfg: cfg, clock: clock, randGen: randGen}
+}
+
+// Creates a device metric with a random type, see MetricOf
+func (g *Generator) Metric(dev *Device) DeviceMetric {
+	return g.MetricOf(dev, MetricTypes[g.randGen.Intn(len(MetricTypes))])
+}
+
+// Creates a device metric of the given type whose value walks within the type's range;
+// CapacityUsed instead follows the device's capacity model and Latency tracks its IOPs.
+func (g *Generator) MetricOf(dev *Device, metricType string) DeviceMetric {
+	now := g.clock()
+	vr := g.cfg.Ranges.Of(metricType)
+	var value float64
+	switch metricType {
+	case CapacityUsed:
+		value = dev.nextCapacity(g.cfg.Capacity, vr.Min, vr.Max, now, g.randGen)
+	case Latency:
+		value = dev.nextLatency(g.cfg.Latency, vr.Min, vr.Max, g.randGen)
+	default:
+		value = dev.nextValue(metricType, vr.Min, vr.Max, g.randGen)
+	}
+
+	return DeviceMetric{
+		Timestamp:    g.timestamp(now),
+		SourceDevice: dev.Name,
+		ParentDevice: dev.Parent,
+		MetricType:   metricType,
+		Value:        value,
+		Model:        dev.Model,
+		Firmware:     dev.Firmware,
+	}
+}
+
+// Creates a random event from the given device
+func (g *Generator) Event(dev *Device) Event {
+	eventType := EventTypes[g.randGen.Intn(len(EventTypes))]
+
+	return Event{
+		ID:           g.cfg.NewID(),
+		Criticality:  g.cfg.Criticality(g.randGen),
+		Timestamp:    g.timestamp(g.clock()),
+		SourceDevice: dev.Name,
+		ParentDevice: dev.Parent,
+		EventType:    eventType,
+		Model:        dev.Model,
+		Firmware:     dev.Firmware,
+	}
+}
+
+// Returns now in RFC3339Nano. A metric and an event of the same cycle share the time,
+// so the last formatted timestamp is reused instead of formatting it again.
+func (g *Generator) timestamp(now time.Time) string {
+	if !now.Equal(g.stampTime) || now.Location() != g.stampTime.Location() || g.stamp == "" {
+		g.stampTime, g.stamp = now, now.Format(time.RFC3339Nano)
+	}
+	return g.stamp
+}
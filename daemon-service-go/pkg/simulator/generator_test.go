@@ -0,0 +1,202 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fixedClock returns a clock standing at t until the test moves it
+func fixedClock(t *time.Time) func() time.Time {
+	return func() time.Time { return *t }
+}
+
+// messages generates a metric and an event per second for the device and returns them
+// formatted, so runs can be compared
+func messages(cfg Config, seed int64, dev *Device, n int) []string {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ids := 0
+	cfg.NewID = func() string { ids++; return fmt.Sprintf("event-%d", ids) }
+	gen := New(cfg, fixedClock(&now), rand.New(rand.NewSource(seed)))
+	var out []string
+	for range n {
+		out = append(out, fmt.Sprintf("%+v", gen.Metric(dev)), fmt.Sprintf("%+v", gen.Event(dev)))
+		now = now.Add(time.Second)
+	}
+	return out
+}
+
+func TestGeneratorIsDeterministic(t *testing.T) {
+	first := messages(DefaultConfig(), 42, NewDevice("StorageArray-0001", "StorageArray"), 200)
+	second := messages(DefaultConfig(), 42, NewDevice("StorageArray-0001", "StorageArray"), 200)
+	if !slices.Equal(first, second) {
+		t.Error("the same seed and clock generated different messages")
+	}
+	if other := messages(DefaultConfig(), 43, NewDevice("StorageArray-0001", "StorageArray"), 200); slices.Equal(first, other) {
+		t.Error("another seed generated the same messages")
+	}
+}
+
+func TestMetricsStayWithinTheirRanges(t *testing.T) {
+	ranges := DefaultRanges()
+	ranges.ByType[DiskTemp] = ValueRange{Min: 30, Max: 31}
+	ranges.ByType["Throughput"] = ValueRange{Min: 0, Max: 0} // Never generated by Metric
+	ranges.Fallback = ValueRange{Min: -5, Max: -1}
+	cfg := DefaultConfig()
+	cfg.Ranges = ranges
+	cfg.Capacity = CapacityConfig{} // CapacityUsed walks like the others
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	gen := New(cfg, fixedClock(&now), rand.New(rand.NewSource(7)))
+	dev := NewDevice("DiskUnit-0001", "DiskUnit")
+	for _, metricType := range append(slices.Clone(MetricTypes), "FanSpeed") {
+		vr := ranges.Of(metricType)
+		prev := 0.0
+		for i := range 1000 {
+			m := gen.MetricOf(dev, metricType)
+			if m.MetricType != metricType || m.Value < vr.Min || m.Value > vr.Max {
+				t.Fatalf("%s %g outside %g-%g", m.MetricType, m.Value, vr.Min, vr.Max)
+			}
+			if step := (vr.Max - vr.Min) * randomWalkStep; metricType != Latency && i > 0 && (m.Value-prev > step+1e-9 || prev-m.Value > step+1e-9) {
+				t.Fatalf("%s walked from %g to %g, more than the %g step", metricType, prev, m.Value, step)
+			}
+			prev = m.Value
+		}
+		if value, ok := dev.Value(metricType); !ok || value != prev {
+			t.Errorf("device keeps %s %g (%t), want the last generated %g", metricType, value, ok, prev)
+		}
+	}
+}
+
+func TestMetricPicksEveryType(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	gen := New(DefaultConfig(), fixedClock(&now), rand.New(rand.NewSource(7)))
+	dev := NewDevice("CloudStorage-0001", "CloudStorage")
+	seen := map[string]int{}
+	for range 400 {
+		seen[gen.Metric(dev).MetricType]++
+	}
+	for _, metricType := range MetricTypes {
+		if seen[metricType] < 50 {
+			t.Errorf("%s generated %d time(s) in 400, want about 100", metricType, seen[metricType])
+		}
+	}
+	if len(seen) != len(MetricTypes) {
+		t.Errorf("generated types %v, want %v", seen, MetricTypes)
+	}
+}
+
+func TestEventFields(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	dev := &Device{Name: "DiskUnit-0003", Type: "DiskUnit", Parent: "Enclosure-01", Model: "HDD-20T", Firmware: "FW-2.1"}
+
+	gen := New(Config{}, fixedClock(&now), rand.New(rand.NewSource(7)))
+	ids := map[string]bool{}
+	types := map[string]bool{}
+	for range 300 {
+		e := gen.Event(dev)
+		if e.SourceDevice != dev.Name || e.ParentDevice != dev.Parent || e.Model != dev.Model || e.Firmware != dev.Firmware {
+			t.Fatalf("event %+v does not carry the device's fields", e)
+		}
+		if e.Criticality < 1 || e.Criticality > 10 {
+			t.Fatalf("criticality %d outside 1-10", e.Criticality)
+		}
+		if e.Timestamp != "2025-01-01T12:00:00Z" {
+			t.Fatalf("timestamp %q, want the clock's time", e.Timestamp)
+		}
+		if ids[e.ID] {
+			t.Fatalf("event ID %s generated twice", e.ID)
+		}
+		ids[e.ID] = true
+		types[e.EventType] = true
+	}
+	if len(types) != len(EventTypes) {
+		t.Errorf("generated event types %v, want every one of %v", types, EventTypes)
+	}
+
+	cfg := Config{Criticality: func(*rand.Rand) int { return 9 }, NewID: func() string { return "fixed" }}
+	if e := New(cfg, fixedClock(&now), rand.New(rand.NewSource(7))).Event(dev); e.Criticality != 9 || e.ID != "fixed" {
+		t.Errorf("event %+v ignores the configured criticality and IDs", e)
+	}
+}
+
+func TestTimestampReuse(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 500, time.UTC)
+	gen := New(DefaultConfig(), fixedClock(&now), rand.New(rand.NewSource(7)))
+	dev := NewDevice("StorageArray-0001", "StorageArray")
+
+	metric, event := gen.Metric(dev), gen.Event(dev)
+	if metric.Timestamp != "2025-01-01T00:00:00.0000005Z" || event.Timestamp != metric.Timestamp {
+		t.Errorf("metric at %q and event at %q, want both at the clock's time", metric.Timestamp, event.Timestamp)
+	}
+	now = now.Add(time.Second)
+	if got := gen.Metric(dev).Timestamp; got != "2025-01-01T00:00:01.0000005Z" {
+		t.Errorf("timestamp %q after the clock moved on", got)
+	}
+	// The same instant in another zone is formatted anew
+	now = now.In(time.FixedZone("UTC+2", 2*3600))
+	if got := gen.Metric(dev).Timestamp; got != "2025-01-01T02:00:01.0000005+02:00" {
+		t.Errorf("timestamp %q after the clock changed zone", got)
+	}
+}
+
+func TestInheritContinuesTheWalk(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	gen := New(DefaultConfig(), fixedClock(&now), rand.New(rand.NewSource(7)))
+	old := NewDevice("StorageArray-0001", "StorageArray")
+	if _, ok := old.Value(IOPs); ok {
+		t.Fatal("new device has an IOPs value before the first metric")
+	}
+	first := gen.MetricOf(old, IOPs).Value
+
+	replaced := NewDevice("StorageArray-0001", "StorageArray")
+	replaced.Model = "SA-7000X"
+	replaced.Inherit(old)
+	if value, ok := replaced.Value(IOPs); !ok || value != first {
+		t.Fatalf("replaced device has IOPs %g (%t), want %g", value, ok, first)
+	}
+	step := (DefaultMetricRanges[IOPs].Max - DefaultMetricRanges[IOPs].Min) * randomWalkStep
+	if next := gen.MetricOf(replaced, IOPs); next.Value < first-step || next.Value > first+step || next.Model != "SA-7000X" {
+		t.Errorf("replaced device generated %+v, want a step from %g with its new model", next, first)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	r := DefaultRanges()
+	r.ByType[DiskTemp] = ValueRange{Min: 0, Max: 1}
+	if DefaultMetricRanges[DiskTemp] == r.ByType[DiskTemp] {
+		t.Error("changing the ranges changed the defaults")
+	}
+	if got := r.Of("Unknown"); got != DefaultFallbackRange {
+		t.Errorf("unknown type ranges %+v, want the fallback %+v", got, DefaultFallbackRange)
+	}
+	for metricType, want := range DefaultMetricRanges {
+		if got := DefaultRanges().Of(metricType); got != want {
+			t.Errorf("%s ranges %+v, want %+v", metricType, got, want)
+		}
+	}
+}
+
+func BenchmarkMetric(b *testing.B) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	gen := New(DefaultConfig(), fixedClock(&now), rand.New(rand.NewSource(7)))
+	dev := NewDevice("StorageArray-0001", "StorageArray")
+	b.ReportAllocs()
+	for b.Loop() {
+		gen.Metric(dev)
+		now = now.Add(time.Second)
+	}
+}
+
+func BenchmarkEvent(b *testing.B) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	gen := New(DefaultConfig(), fixedClock(&now), rand.New(rand.NewSource(7)))
+	dev := NewDevice("StorageArray-0001", "StorageArray")
+	b.ReportAllocs()
+	for b.Loop() {
+		gen.Event(dev)
+		now = now.Add(time.Second)
+	}
+}
@@ -0,0 +1,33 @@
+package simulator
+
+import "math/rand"
+
+// LatencyConfig couples Latency to the device's current IOPs so that high load shows up
+// as high latency: Base + PerIOPs·IOPs + uniform noise in [-Noise, Noise].
+type LatencyConfig struct {
+	Base    float64 // Latency at zero IOPs
+	PerIOPs float64 // Coupling coefficient k, 0 samples Latency independently of IOPs
+	Noise   float64 // Largest random deviation from the coupled value
+}
+
+// DefaultLatency adds 5 to the idle latency of 0.5 at 1000 IOPs, give or take 1.
+var DefaultLatency = LatencyConfig{Base: 0.5, PerIOPs: 0.005, Noise: 1.0}
+
+// Reports whether Latency is derived from IOPs
+func (c LatencyConfig) coupled() bool {
+	return c.PerIOPs != 0
+}
+
+// Returns the next Latency of the device. Once the device has an IOPs value, Latency is
+// derived from it and clamped to [lo, hi]; before that, and without coupling, it follows
+// the usual random walk.
+func (d *Device) nextLatency(cfg LatencyConfig, lo, hi float64, randGen *rand.Rand) float64 {
+	iops, ok := d.values[IOPs]
+	if !cfg.coupled() || !ok {
+		return d.nextValue(Latency, lo, hi, randGen)
+	}
+	value := cfg.Base + cfg.PerIOPs*iops + cfg.Noise*(2*randGen.Float64()-1)
+	value = min(max(value, lo), hi)
+	d.values[Latency] = value
+	return value
+}
@@ -0,0 +1,77 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// correlation returns the Pearson correlation coefficient of xs and ys
+func correlation(xs, ys []float64) float64 {
+	n := float64(len(xs))
+	var sx, sy, sxx, syy, sxy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		syy += ys[i] * ys[i]
+		sxy += xs[i] * ys[i]
+	}
+	return (n*sxy - sx*sy) / math.Sqrt((n*sxx-sx*sx)*(n*syy-sy*sy))
+}
+
+// latencySamples returns pairs of IOPs and the Latency generated right after them, over
+// many devices so that IOPs covers its whole range
+func latencySamples(cfg LatencyConfig, seed int64) (iops, latency []float64) {
+	c := DefaultConfig()
+	c.Latency = cfg
+	gen := New(c, func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) }, rand.New(rand.NewSource(seed)))
+	for d := range 200 {
+		dev := NewDevice(fmt.Sprintf("StorageArray-%04d", d), "StorageArray")
+		for range 50 {
+			iops = append(iops, gen.MetricOf(dev, IOPs).Value)
+			latency = append(latency, gen.MetricOf(dev, Latency).Value)
+		}
+	}
+	return iops, latency
+}
+
+func TestLatencyTracksIOPs(t *testing.T) {
+	iops, latency := latencySamples(DefaultLatency, 42)
+	if r := correlation(iops, latency); r < 0.9 {
+		t.Errorf("correlation of IOPs and Latency %.3f, want strongly positive", r)
+	}
+	vr := DefaultMetricRanges[Latency]
+	for i := range latency {
+		want := DefaultLatency.Base + DefaultLatency.PerIOPs*iops[i]
+		if latency[i] < vr.Min || latency[i] > vr.Max {
+			t.Fatalf("Latency %.3f outside %g-%g", latency[i], vr.Min, vr.Max)
+		}
+		if math.Abs(latency[i]-min(max(want, vr.Min), vr.Max)) > DefaultLatency.Noise+1e-9 {
+			t.Fatalf("Latency %.3f at %.0f IOPs, want %.3f within the noise", latency[i], iops[i], want)
+		}
+	}
+}
+
+func TestLatencyWithoutCoupling(t *testing.T) {
+	iops, latency := latencySamples(LatencyConfig{}, 42)
+	if r := correlation(iops, latency); math.Abs(r) > 0.1 {
+		t.Errorf("correlation of IOPs and Latency %.3f without coupling, want about 0", r)
+	}
+}
+
+func TestLatencyBeforeTheFirstIOPs(t *testing.T) {
+	gen := New(DefaultConfig(), time.Now, rand.New(rand.NewSource(1)))
+	dev := NewDevice("StorageArray-0001", "StorageArray")
+	vr := DefaultMetricRanges[Latency]
+	for range 100 {
+		if v := gen.MetricOf(dev, Latency).Value; v < vr.Min || v > vr.Max {
+			t.Fatalf("Latency %.3f outside %g-%g before any IOPs", v, vr.Min, vr.Max)
+		}
+	}
+	if _, ok := dev.Value(IOPs); ok {
+		t.Error("Latency generated an IOPs value")
+	}
+}
@@ -0,0 +1,65 @@
+package simulator
+
+// SchemaVersion is the version of the Event and DeviceMetric payloads, sent in their
+// schemaVersion field. Version 2 added eventMessage.
+const SchemaVersion = 2
+
+// Metric types generated by default.
+const (
+	DiskTemp     = "DiskTemp"     // Drive temperature
+	IOPs         = "IOPs"         // Input/Output Operations Per Second
+	Latency      = "Latency"      // Data access latency
+	CapacityUsed = "CapacityUsed" // Storage capacity utilization
+)
+
+// List of available simulated devices and event/metric types.
+var (
+	DeviceTypes = []string{
+		"StorageArray", // General storage system
+		"DiskUnit",     // Individual disk drive
+		"CloudStorage", // Cloud integration point
+	}
+
+	// EventTypes are critical storage-related incidents.
+	EventTypes = []string{
+		"DriveFailure",       // Disk drive hardware failure
+		"DataCorruption",     // Data integrity issue
+		"UnauthorizedAccess", // Security breach attempt
+	}
+
+	// MetricTypes are core storage performance and health indicators.
+	MetricTypes = []string{DiskTemp, IOPs, Latency, CapacityUsed}
+)
+
+// Represents a simulated event.
+type Event struct {
+	SchemaVersion   int    `json:"schemaVersion"` // Payload version, set by the publisher
+	ID              string `json:"id"`
+	Criticality     int    `json:"criticality"` // Criticality level (e.g., 1-10).
+	Timestamp       string `json:"timestamp"`   // UTC timestamp (RFC3339Nano format).
+	SourceDevice    string `json:"sourceDevice"`
+	ParentDevice    string `json:"parentDevice,omitempty"`    // Enclosure of the source device, absent for top-level devices
+	EventType       string `json:"eventType"`                 // The type of  event
+	EventMessage    string `json:"eventMessage,omitempty"`    // Human readable details, when the event carries any
+	Status          string `json:"status,omitempty"`          // "open" or "resolved" for incidents that can be resolved
+	CorrelationID   string `json:"correlationId,omitempty"`   // Pairs a resolved event with the open one
+	OccurrenceCount int    `json:"occurrenceCount,omitempty"` // Occurrences since the last emitted event of the type, when debounced
+	Backfill        bool   `json:"backfill,omitempty"`        // Synthesized history published on startup
+	Model           string `json:"model,omitempty"`           // Hardware model of the source device
+	Firmware        string `json:"firmware,omitempty"`        // Firmware version of the source device
+}
+
+// Represents a simulated device metric
+type DeviceMetric struct {
+	SchemaVersion int     `json:"schemaVersion"` // Payload version, set by the publisher
+	Timestamp     string  `json:"timestamp"`
+	SourceDevice  string  `json:"sourceDevice"`
+	ParentDevice  string  `json:"parentDevice,omitempty"` // Enclosure of the source device, absent for top-level devices
+	MetricType    string  `json:"metricType"`             //The type of metric
+	Value         float64 `json:"value"`
+	Unit          string  `json:"unit,omitempty"`      // Unit of the value, absent when no metadata is defined
+	Precision     *int    `json:"precision,omitempty"` // Meaningful decimal places, absent when no metadata is defined
+	Model         string  `json:"model,omitempty"`     // Hardware model of the source device
+	Firmware      string  `json:"firmware,omitempty"`  // Firmware version of the source device
+	Backfill      bool    `json:"backfill,omitempty"`  // Synthesized history published on startup
+}
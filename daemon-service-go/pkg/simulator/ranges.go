@@ -0,0 +1,42 @@
+package simulator
+
+// ValueRange is the inclusive range of values generated for a metric type.
+type ValueRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// DefaultMetricRanges are used for every metric type without a range of its own.
+var DefaultMetricRanges = map[string]ValueRange{
+	DiskTemp:     {Min: 25.0, Max: 60.0},    // Disk temperature: 25.0 to 60.0
+	IOPs:         {Min: 100.0, Max: 1000.0}, // I/O Operations Per Second: 100 to 1000
+	Latency:      {Min: 0.5, Max: 10.5},     // Latency: 0.5 to 10.5
+	CapacityUsed: {Min: 10.0, Max: 95.0},    // Capacity utilization: 10.0 to 95.0 %
+}
+
+// DefaultFallbackRange applies to metric types without a range of their own.
+var DefaultFallbackRange = ValueRange{Min: 0.0, Max: 100.0}
+
+// Ranges resolves the value range of each metric type.
+type Ranges struct {
+	ByType   map[string]ValueRange
+	Fallback ValueRange
+}
+
+// Returns the built-in ranges
+func DefaultRanges() Ranges {
+	r := Ranges{ByType: make(map[string]ValueRange, len(DefaultMetricRanges)), Fallback: DefaultFallbackRange}
+	for metricType, vr := range DefaultMetricRanges {
+		r.ByType[metricType] = vr
+	}
+	return r
+}
+
+// Returns the range of values generated for a metric type
+func (r Ranges) Of(metricType string) ValueRange {
+	if vr, ok := r.ByType[metricType]; ok {
+		return vr
+	}
+	// Fallback for any unexpected metric types
+	return r.Fallback
+}
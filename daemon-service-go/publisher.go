@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// sendFunc hands a serialized message to NATS. A non-empty msgID is sent as the
+// Nats-Msg-Id header, which JetStream uses to drop duplicates of the same message.
+type sendFunc func(subject, msgID string, data []byte) error
+
+// publisher serializes generated data, publishes it to its subject on every configured
+// cluster and keeps the totals.
+type publisher struct {
+	clusters []*cluster
+	dryRun   *dryRunWriter // Replaces the clusters in dry-run mode, nil otherwise
+	stats    *publishStats
+	router   *eventRouter
+	chaos    *chaosInjector     // Optional fault injection, nil unless a chaos rate is configured
+	retry    *retryQueue        // Optional retries of failed publishes, nil when disabled
+	counter  *generationCounter // Per-device and per-type counts for the generation summary
+	rollup   *rollup            // Optional aggregates for SummarySubject, nil when disabled
+	otlp     *otlpExporter      // Optional OTLP export of the metrics, nil when disabled
+
+	messageLimit uint64        // Bounded-run limit on published metrics and events, 0 for none
+	reserved     atomic.Uint64 // Messages admitted against messageLimit so far
+}
+
+// errMessageLimitReached is returned instead of publishing once the bounded run is complete.
+var errMessageLimitReached = errors.New("message limit reached")
+
+// payloadBuffers holds the serialization buffers of metrics and events. A payload is only
+// valid until its buffer is returned, which publish accounts for by copying whatever it
+// keeps beyond the call.
+var payloadBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// Serializes v like json.Marshal into a pooled buffer; the caller returns the buffer to
+// payloadBuffers once the payload was handed on
+func marshalPayload(v any) (*bytes.Buffer, []byte, error) {
+	buf := payloadBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		payloadBuffers.Put(buf)
+		return nil, nil, err
+	}
+	return buf, bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Returns the message ID of a metric, a hash of device, metric type and timestamp. Metrics
+// carry no ID of their own, but the same sample always gets the same message ID.
+func metricMsgID(metric *DeviceMetric) string {
+	h := fnv.New128a()
+	h.Write([]byte(metric.SourceDevice))
+	h.Write([]byte{0})
+	h.Write([]byte(metric.MetricType))
+	h.Write([]byte{0})
+	h.Write([]byte(metric.Timestamp))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Publishes a device metric to DeviceMetricsSubject. Errors are logged and returned.
+func (p *publisher) publishMetric(metric DeviceMetric) error {
+	metric.SchemaVersion = SchemaVersion
+	buf, metricJSON, err := marshalPayload(&metric)
+	if err != nil {
+		p.stats.failed.Add(1)
+		log.Printf("Daemon: Failed to serialize metric for device '%s': %v", metric.SourceDevice, err)
+		return err
+	}
+	msgID := metricMsgID(&metric)
+	err = p.publish(DeviceMetricsSubject, msgID, metricJSON, &p.stats.metrics)
+	payloadBuffers.Put(buf)
+	if err != nil {
+		if errors.Is(err, errMessageLimitReached) {
+			return err
+		}
+		if errors.Is(err, errQueuedForRetry) {
+			p.counter.recordMetric(metric.SourceDevice, metric.MetricType)
+			log.Printf("Daemon: Queued metric [%s] from device [%s] (id %s) for retry: %v", metric.MetricType, metric.SourceDevice, msgID, err)
+			return nil
+		}
+		p.stats.failed.Add(1)
+		log.Printf("Daemon: Error publishing metric from device '%s': %v", metric.SourceDevice, err)
+		return err
+	}
+	p.counter.recordMetric(metric.SourceDevice, metric.MetricType)
+	if p.rollup != nil {
+		p.rollup.recordMetric(metric)
+	}
+	if p.otlp != nil {
+		p.otlp.recordMetric(metric)
+	}
+	log.Printf("Daemon: Published metric [%s] from device [%s] (id %s)", metric.MetricType, metric.SourceDevice, msgID)
+	return nil
+}
+
+// Publishes an event to the subject resolved by the router. Errors are logged and returned.
+func (p *publisher) publishEvent(event Event) error {
+	event.SchemaVersion = SchemaVersion
+	buf, eventJSON, err := marshalPayload(&event)
+	if err != nil {
+		p.stats.failed.Add(1)
+		log.Printf("Daemon: Failed to serialize event '%s' from device '%s': %v", event.EventType, event.SourceDevice, err)
+		return err
+	}
+	subject := p.router.subject(event.EventType)
+	err = p.publish(subject, event.ID, eventJSON, &p.stats.events)
+	payloadBuffers.Put(buf)
+	if err != nil {
+		if errors.Is(err, errMessageLimitReached) {
+			return err
+		}
+		if errors.Is(err, errQueuedForRetry) {
+			p.counter.recordEvent(event.SourceDevice, event.EventType)
+			log.Printf("Daemon: Queued event [%s] from [%s] (id %s) to '%s' for retry: %v", event.EventType, event.SourceDevice, event.ID, subject, err)
+			return nil
+		}
+		p.stats.failed.Add(1)
+		log.Printf("Daemon: Error publishing event [%s] from [%s] to '%s': %v", event.EventType, event.SourceDevice, subject, err)
+		return err
+	}
+	p.counter.recordEvent(event.SourceDevice, event.EventType)
+	if p.rollup != nil {
+		p.rollup.recordEvent(event)
+	}
+	log.Printf("Daemon: Published event [%s] from [%s] with criticality [%d] (id %s) to '%s'", event.EventType, event.SourceDevice, event.Criticality, event.ID, subject)
+	return nil
+}
+
+// Publishes a serialized message and increments counter once every cluster accepted it;
+// clusters that failed get the message from the retry queue when it is enabled.
+// With chaos enabled the message may be corrupted, held back for a few cycles or duplicated;
+// retries and chaos keep msgID, so JetStream stores a retried message only once.
+// data is not retained after the call, so it may live in a reused buffer.
+func (p *publisher) publish(subject, msgID string, data []byte, counter *atomic.Uint64) error {
+	if p.messageLimit > 0 && p.reserved.Add(1) > p.messageLimit {
+		return errMessageLimitReached
+	}
+	if p.chaos != nil {
+		data = p.chaos.corrupt(subject, bytes.Clone(data)) // Held and duplicated messages outlive the call
+		if p.chaos.hold(subject, msgID, data, counter) {
+			return nil
+		}
+	}
+	if err := p.send(subject, msgID, data); err != nil {
+		if p.retry != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			return p.retry.enqueue(subject, msgID, bytes.Clone(data), counter, err)
+		}
+		return err
+	}
+	counter.Add(1)
+	p.stats.lastPublish.Store(time.Now().UnixNano())
+	if p.chaos != nil {
+		p.chaos.published(p.send, subject, msgID, data)
+	}
+	return nil
+}
+
+// Sends a serialized message to every cluster as is, or to stdout in dry-run mode
+func (p *publisher) send(subject, msgID string, data []byte) error {
+	if p.dryRun != nil {
+		return p.dryRun.send(subject, data)
+	}
+	return publishToClusters(p.clusters, subject, msgID, data)
+}
+
+// Releases held-back chaos messages once per interval until ctx is cancelled
+func (p *publisher) runChaosTicker(ctx context.Context, interval time.Duration) error {
+	if p.chaos == nil {
+		return nil
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			p.chaos.tick(p.send)
+		}
+	}
+}
+
+// Sends anything still held back, must be called before flushing on shutdown
+func (p *publisher) drain() {
+	if p.chaos != nil {
+		p.chaos.drain(p.send)
+		log.Printf("Daemon: CHAOS: injected %d duplicate(s), %d reordered and %d malformed message(s) in total",
+			p.stats.chaosDuplicates.Load(), p.stats.chaosReordered.Load(), p.stats.chaosMalformed.Load())
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newClusterPublisher returns a publisher sending to the fake servers
+func newClusterPublisher(t *testing.T, servers ...*fakeNATS) *publisher {
+	t.Helper()
+	router, err := newEventRouter(defaultSecurityEventTypes, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &publisher{
+		clusters: connectFakeClusters(t, false, servers...),
+		stats:    &publishStats{},
+		router:   router,
+		counter:  newGenerationCounter(time.Now(), defaultSummaryTopDevices),
+	}
+}
+
+func TestPayloadsCarryTheSchemaVersion(t *testing.T) {
+	s := startFakeNATS(t, 1<<20, false)
+	pub := newClusterPublisher(t, s)
+	if err := pub.publishMetric(DeviceMetric{Timestamp: "2025-01-01T00:00:00Z", SourceDevice: "StorageArray-0001", MetricType: "IOPs", Value: 512}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.publishEvent(Event{ID: "event-1", Criticality: 9, Timestamp: "2025-01-01T00:00:00Z", SourceDevice: "StorageArray-0001", EventType: "UnauthorizedAccess"}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := waitForMessages(t, s, 2)
+	wantSubjects := []string{DeviceMetricsSubject, SecurityEventsSubject}
+	for i, msg := range messages {
+		if msg.Subject != wantSubjects[i] {
+			t.Errorf("message %d on %s, want %s", i, msg.Subject, wantSubjects[i])
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(msg.Data, &fields); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if fields["schemaVersion"] != float64(SchemaVersion) {
+			t.Errorf("%s payload has schemaVersion %v, want %d: %s", msg.Subject, fields["schemaVersion"], SchemaVersion, msg.Data)
+		}
+		if got := msg.Header.Get(SchemaVersionHeader); got != strconv.Itoa(SchemaVersion) {
+			t.Errorf("%s message has %s %q, want %d", msg.Subject, SchemaVersionHeader, got, SchemaVersion)
+		}
+	}
+}
+
+// The marshal+publish hot path, sending to a dry-run writer that discards every message
+// in place of a NATS connection
+func BenchmarkPublishMetric(b *testing.B) {
+	pub := newTestSettings(b, io.Discard, time.Second).pub
+	metric := DeviceMetric{Timestamp: "2025-01-01T00:00:00.123456789Z", SourceDevice: "StorageArray-0001", MetricType: "IOPs", Value: 512.25, Model: "SA-4000", Firmware: "4.2.1"}
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := pub.publishMetric(metric); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPublishEvent(b *testing.B) {
+	pub := newTestSettings(b, io.Discard, time.Second).pub
+	event := Event{ID: "9b2f4c1e-6a53-4bb4-a1d4-53a1d8cfa3a1", Criticality: 7, Timestamp: "2025-01-01T00:00:00.123456789Z", SourceDevice: "StorageArray-0001", EventType: "DriveFailure", Model: "SA-4000", Firmware: "4.2.1"}
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := pub.publishEvent(event); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalPayload(b *testing.B) {
+	metric := DeviceMetric{SchemaVersion: SchemaVersion, Timestamp: "2025-01-01T00:00:00.123456789Z", SourceDevice: "StorageArray-0001", MetricType: "IOPs", Value: 512.25}
+	b.ReportAllocs()
+	for b.Loop() {
+		buf, _, err := marshalPayload(&metric)
+		if err != nil {
+			b.Fatal(err)
+		}
+		payloadBuffers.Put(buf)
+	}
+}
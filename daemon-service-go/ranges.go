@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"daemon-service-go/pkg/simulator"
+)
+
+// ValueRange is the inclusive range of values generated for a metric type.
+type ValueRange = simulator.ValueRange
+
+// Merges the ranges from the config file over the defaults. Ranges for metric types the
+// daemon does not generate are kept but reported, since they are most likely typos.
+func newMetricRanges(overrides map[string]ValueRange, fallback *ValueRange) (simulator.Ranges, error) {
+	r := simulator.DefaultRanges()
+	for metricType, vr := range overrides {
+		if vr.Min > vr.Max {
+			return r, fmt.Errorf("metricRanges.%s: min %g is greater than max %g", metricType, vr.Min, vr.Max)
+		}
+		if !slices.Contains(metricTypes, metricType) {
+			log.Printf("Daemon Service (Go): WARNING: value range configured for unknown metric type '%s'", metricType)
+		}
+		r.ByType[metricType] = vr
+	}
+	if fallback != nil {
+		if fallback.Min > fallback.Max {
+			return r, fmt.Errorf("fallbackRange: min %g is greater than max %g", fallback.Min, fallback.Max)
+		}
+		r.Fallback = *fallback
+	}
+	return r, nil
+}
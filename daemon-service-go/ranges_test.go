@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"daemon-service-go/pkg/simulator"
+)
+
+// writeConfigFile writes a daemon config file into a temporary directory and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "daemon.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGeneratedValuesStayWithinConfiguredRanges(t *testing.T) {
+	fc, err := loadConfigFile(writeConfigFile(t, `{
+		"metricRanges": {"IOPs": {"min": 5000, "max": 90000}, "DiskTemp": {"min": 30, "max": 31}},
+		"fallbackRange": {"min": -5, "max": 5}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges, err := newMetricRanges(fc.MetricRanges, fc.FallbackRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]ValueRange{"Throughput": *fc.FallbackRange} // Not generated by default, takes the fallback
+	for metricType, vr := range fc.MetricRanges {
+		want[metricType] = vr
+	}
+	want[simulator.Latency] = simulator.DefaultMetricRanges[simulator.Latency] // Not configured, keeps its default
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := simulator.DefaultConfig()
+	cfg.Ranges = ranges
+	cfg.Latency = simulator.LatencyConfig{} // Latency walks within its range instead of tracking IOPs
+	gen := simulator.New(cfg, func() time.Time { return now }, rand.New(rand.NewSource(7)))
+	dev := simulator.NewDevice("StorageArray-0001", "StorageArray")
+	for metricType, vr := range want {
+		for range 500 {
+			if v := gen.MetricOf(dev, metricType).Value; v < vr.Min || v > vr.Max {
+				t.Fatalf("%s value %g outside its configured range %g-%g", metricType, v, vr.Min, vr.Max)
+			}
+		}
+	}
+}
+
+func TestNewMetricRanges(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	r, err := newMetricRanges(map[string]ValueRange{"Throughput": {Min: 1, Max: 2}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "WARNING: value range configured for unknown metric type 'Throughput'") {
+		t.Errorf("no warning for an unknown metric type, log: %q", logs.String())
+	}
+	if r.Of("Throughput") != (ValueRange{Min: 1, Max: 2}) || r.Of(simulator.DiskTemp) != simulator.DefaultMetricRanges[simulator.DiskTemp] {
+		t.Errorf("ranges %+v, want the override merged over the defaults", r.ByType)
+	}
+	if r.Fallback != simulator.DefaultFallbackRange {
+		t.Errorf("fallback %+v, want the default %+v", r.Fallback, simulator.DefaultFallbackRange)
+	}
+
+	if _, err := newMetricRanges(map[string]ValueRange{"IOPs": {Min: 10, Max: 1}}, nil); err == nil {
+		t.Error("accepted a range with min above max")
+	}
+	if _, err := newMetricRanges(nil, &ValueRange{Min: 10, Max: 1}); err == nil {
+		t.Error("accepted a fallback range with min above max")
+	}
+}
+
+func TestExampleConfigFileLoads(t *testing.T) {
+	fc, err := loadConfigFile("config.example.json")
+	if err != nil {
+		t.Fatalf("config.example.json: %v", err)
+	}
+	if _, err := newMetricRanges(fc.MetricRanges, fc.FallbackRange); err != nil {
+		t.Errorf("ranges of config.example.json: %v", err)
+	}
+	if _, err := loadConfigFile(writeConfigFile(t, `{"metricRange": {}}`)); err == nil {
+		t.Error("accepted an unknown key")
+	}
+}
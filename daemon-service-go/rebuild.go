@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RAID rebuild constants.
+const (
+	RebuildProgressMetric     = "RebuildProgress"
+	RebuildCompleteEvent      = "RebuildComplete"
+	rebuildTriggerEvent       = "DriveFailure"
+	defaultRebuildProbability = 0.3
+	defaultRebuildDuration    = 10 * time.Minute
+)
+
+// rebuildConfig controls the RAID rebuilds started by drive failures.
+type rebuildConfig struct {
+	Probability float64       // Chance that a DriveFailure starts a rebuild, 0 disables them
+	Duration    time.Duration // Time from 0 to 100% progress
+}
+
+// rebuild is the RAID rebuild running on a device.
+type rebuild struct {
+	start         time.Time
+	correlationID string  // Of the DriveFailure that started it, shared by RebuildComplete
+	progress      float64 // Last reported progress in percent
+}
+
+// Starts a rebuild on the device with the configured probability when the event is a
+// DriveFailure; a device runs at most one rebuild at a time
+func (c rebuildConfig) start(dev *device, event Event, now time.Time, randGen *rand.Rand) {
+	if event.EventType != rebuildTriggerEvent || dev.rebuild != nil || c.Probability <= 0 {
+		return
+	}
+	if randGen.Float64() >= c.Probability {
+		return
+	}
+	dev.rebuild = &rebuild{start: now, correlationID: event.CorrelationID}
+}
+
+// Returns the progress of the device's rebuild at now and, once it reached 100%, the
+// RebuildComplete event, after which the rebuild is removed from the device. The
+// progress never decreases, even when the clock steps back during a backfill.
+func (c rebuildConfig) step(dev *device, now time.Time) (progress float64, complete *Event) {
+	r := dev.rebuild
+	r.progress = max(r.progress, rebuildProgress(now.Sub(r.start), c.Duration))
+	if r.progress < 100 {
+		return r.progress, nil
+	}
+
+	dev.rebuild = nil
+	event := newLifecycleEvent(dev, RebuildCompleteEvent, 2, now,
+		fmt.Sprintf("RAID rebuild completed after %s", now.Sub(r.start).Round(time.Second)))
+	event.CorrelationID = r.correlationID
+	return 100, event
+}
+
+// Returns the progress in percent after elapsed of a rebuild taking duration. It follows
+// an ease-out curve: a rebuild starts at full speed and slows down over the last stripes,
+// where the array also serves the load that built up meanwhile.
+func rebuildProgress(elapsed, duration time.Duration) float64 {
+	if elapsed >= duration {
+		return 100
+	}
+	done := max(float64(elapsed)/float64(duration), 0)
+	return math.Round(1000*(1-math.Pow(1-done, 2))) / 10 // One decimal like the other percentages
+}
+
+// Returns the RebuildProgress metric of the device
+func rebuildMetric(dev *device, progress float64, now time.Time) DeviceMetric {
+	return DeviceMetric{
+		Timestamp:    dev.clock(now).Format(time.RFC3339Nano),
+		SourceDevice: dev.Name,
+		ParentDevice: dev.Parent,
+		MetricType:   RebuildProgressMetric,
+		Value:        progress,
+		Model:        dev.Model,
+		Firmware:     dev.Firmware,
+	}
+}
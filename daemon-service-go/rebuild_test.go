@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRebuildProgress(t *testing.T) {
+	tests := []struct {
+		elapsed time.Duration
+		want    float64
+	}{
+		{-time.Second, 0},
+		{0, 0},
+		{10 * time.Second, 19}, // Full speed at the start...
+		{50 * time.Second, 75}, // ...three quarters done at half time...
+		{90 * time.Second, 99}, // ...and slowing down near the end
+		{100 * time.Second, 100},
+		{time.Hour, 100},
+	}
+	for _, tt := range tests {
+		if got := rebuildProgress(tt.elapsed, 100*time.Second); got != tt.want {
+			t.Errorf("rebuildProgress(%s) = %g, want %g", tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestRebuildStartAndStep(t *testing.T) {
+	c := rebuildConfig{Probability: 1, Duration: time.Minute}
+	randGen := rand.New(rand.NewSource(7))
+	dev := newDevice("StorageArray-0001", "StorageArray")
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	c.start(dev, Event{EventType: "DataCorruption"}, start, randGen)
+	if dev.rebuild != nil {
+		t.Fatal("rebuild started by another event than a DriveFailure")
+	}
+	c.start(dev, Event{EventType: rebuildTriggerEvent, CorrelationID: "failure-1"}, start, randGen)
+	if dev.rebuild == nil {
+		t.Fatal("DriveFailure did not start a rebuild")
+	}
+	c.start(dev, Event{EventType: rebuildTriggerEvent, CorrelationID: "failure-2"}, start.Add(30*time.Second), randGen)
+	if dev.rebuild.correlationID != "failure-1" || !dev.rebuild.start.Equal(start) {
+		t.Fatalf("second DriveFailure replaced the running rebuild: %+v", dev.rebuild)
+	}
+
+	if progress, complete := c.step(dev, start.Add(30*time.Second)); progress != 75 || complete != nil {
+		t.Errorf("progress %g at half time (complete %v), want 75", progress, complete)
+	}
+	// A clock stepping back never lowers the progress
+	if progress, _ := c.step(dev, start.Add(10*time.Second)); progress != 75 {
+		t.Errorf("progress %g after the clock stepped back, want 75", progress)
+	}
+	progress, complete := c.step(dev, start.Add(time.Minute))
+	if progress != 100 || complete == nil {
+		t.Fatalf("progress %g at the end without a %s event", progress, RebuildCompleteEvent)
+	}
+	if complete.EventType != RebuildCompleteEvent || complete.CorrelationID != "failure-1" || complete.SourceDevice != dev.Name {
+		t.Errorf("completion event %+v, want a %s of the device sharing the failure's correlation ID", complete, RebuildCompleteEvent)
+	}
+	if dev.rebuild != nil {
+		t.Error("completed rebuild kept on the device")
+	}
+
+	never := rebuildConfig{Probability: 0, Duration: time.Minute}
+	never.start(dev, Event{EventType: rebuildTriggerEvent}, start, randGen)
+	if dev.rebuild != nil {
+		t.Error("rebuild started with probability 0")
+	}
+}
+
+// Runs a device with a compressed rebuild of 30 cycles and follows its rebuilds
+func TestRebuildWithCompressedDuration(t *testing.T) {
+	const duration = 30 * time.Second
+	var out bytes.Buffer
+	settings := newTestSettings(t, &out, time.Second)
+	settings.rebuild = rebuildConfig{Probability: 1, Duration: duration}
+	settings.eventShare = func(*device) float64 { return 1 }
+	g := newDeviceGenerator(newDevice("StorageArray-0001", "StorageArray"), 7, settings)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 600 {
+		if err := g.cycle(start.Add(time.Duration(i) * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		running   bool
+		startedAt time.Time // Of the running rebuild
+		last      float64   // Last progress of the running rebuild
+		completed int
+	)
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		_, payload, _ := strings.Cut(scanner.Text(), " ")
+		var msg struct {
+			Timestamp  string  `json:"timestamp"`
+			MetricType string  `json:"metricType"`
+			EventType  string  `json:"eventType"`
+			Value      float64 `json:"value"`
+		}
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			t.Fatalf("malformed dry-run line %q", scanner.Text())
+		}
+		ts, _ := time.Parse(time.RFC3339Nano, msg.Timestamp)
+		switch {
+		case msg.EventType == rebuildTriggerEvent && !running:
+			running, startedAt, last = true, ts, 0
+		case msg.MetricType == RebuildProgressMetric:
+			if !running {
+				t.Fatalf("%s %g at %s without a rebuild running", RebuildProgressMetric, msg.Value, ts)
+			}
+			if msg.Value <= last || msg.Value > 100 {
+				t.Fatalf("progress went from %g to %g at %s", last, msg.Value, ts)
+			}
+			last = msg.Value
+		case msg.EventType == RebuildCompleteEvent:
+			if !running || last != 100 {
+				t.Fatalf("%s at %s after progress %g", RebuildCompleteEvent, ts, last)
+			}
+			if took := ts.Sub(startedAt); took != duration {
+				t.Errorf("rebuild took %s, want %s", took, duration)
+			}
+			running = false
+			completed++
+		}
+	}
+	if completed < 2 {
+		t.Errorf("%d rebuild(s) completed in 600 cycles, want several", completed)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Statuses of events that take part in open/resolve pairing.
+const (
+	EventStatusOpen     = "open"
+	EventStatusResolved = "resolved"
+)
+
+// Defaults of the open/resolve pairing.
+const (
+	defaultResolveFraction = 0.5
+	defaultResolveMinDelay = 30 * time.Second
+	defaultResolveMaxDelay = 5 * time.Minute
+)
+
+// resolvableEventTypes are opened with a correlation ID and may be resolved later.
+var resolvableEventTypes = []string{"DriveFailure"}
+
+// resolutionConfig controls how opened incidents get resolved.
+type resolutionConfig struct {
+	Fraction float64       // Share of opened incidents that are resolved at all
+	MinDelay time.Duration // Shortest time until the resolved event
+	MaxDelay time.Duration // Longest time until the resolved event
+}
+
+// pendingResolution is a resolved event waiting for its due time.
+type pendingResolution struct {
+	due   time.Time
+	event Event
+}
+
+// Marks a resolvable event as open with a fresh correlation ID and, for the configured
+// fraction of them, schedules the matching resolved event on the device
+func (c resolutionConfig) open(dev *device, event *Event, now time.Time, randGen *rand.Rand) {
+	if !slices.Contains(resolvableEventTypes, event.EventType) {
+		return
+	}
+	event.Status = EventStatusOpen
+	event.CorrelationID = uuid.New().String()
+	if randGen.Float64() >= c.Fraction {
+		return
+	}
+
+	delay := c.MinDelay
+	if c.MaxDelay > c.MinDelay {
+		delay += time.Duration(randGen.Int63n(int64(c.MaxDelay - c.MinDelay)))
+	}
+	resolved := *event
+	resolved.ID = uuid.New().String()
+	resolved.Status = EventStatusResolved
+	resolved.EventMessage = fmt.Sprintf("Resolved: %s cleared after %s", event.EventType, delay.Round(time.Second))
+	dev.resolutions = append(dev.resolutions, pendingResolution{due: now.Add(delay), event: resolved})
+}
+
+// Removes and returns the resolved events of the device that are due, timestamped now
+func (c resolutionConfig) due(dev *device, now time.Time) []Event {
+	var events []Event
+	dev.resolutions = slices.DeleteFunc(dev.resolutions, func(r pendingResolution) bool {
+		if now.Before(r.due) {
+			return false
+		}
+		r.event.Timestamp = dev.clock(now).Format(time.RFC3339Nano)
+		events = append(events, r.event)
+		return true
+	})
+	return events
+}
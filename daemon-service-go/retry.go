@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of the retry queue.
+const (
+	defaultRetryQueueSize   = 1000
+	defaultRetryMaxAttempts = 5
+	defaultRetryBackoff     = 200 * time.Millisecond
+	defaultRetryMaxBackoff  = 10 * time.Second
+	retryPollInterval       = 50 * time.Millisecond // How often the queue looks for due retries
+)
+
+// errQueuedForRetry reports that a publish failed and the message waits in the retry queue.
+var errQueuedForRetry = errors.New("queued for retry")
+
+// retryConfig controls the retry queue of failed publishes.
+type retryConfig struct {
+	QueueSize   int           // Messages waiting for a retry at most, 0 disables retries
+	MaxAttempts int           // Retries per message before it counts as lost
+	Backoff     time.Duration // Delay before the first retry, doubled for every further one
+	MaxBackoff  time.Duration // Upper bound of the delay between retries
+	LostFile    string        // Optional file receiving lost messages as JSON lines
+}
+
+// retryMessage is a failed publish waiting in the retry queue.
+type retryMessage struct {
+	subject  string
+	msgID    string // Kept across attempts, so JetStream stores the message at most once
+	data     []byte
+	send     sendFunc       // Sends a retry, nil for the send of the queue
+	counter  *atomic.Uint64 // Publish total to increment once the message is finally sent
+	attempts int            // Retries done so far
+	next     time.Time      // When the next retry is due
+	lastErr  error
+}
+
+// Represents a message that exhausted its retries, as written to the lost file.
+type LostMessage struct {
+	Timestamp string `json:"timestamp"`
+	Subject   string `json:"subject"`
+	Payload   string `json:"payload"`
+	Attempts  int    `json:"attempts"`
+	Error     string `json:"error"`
+}
+
+// retryQueue retries failed publishes in the background with exponential backoff, keeping
+// their original subject and payload. It is safe for concurrent use by the generators.
+type retryQueue struct {
+	mu       sync.Mutex
+	cfg      retryConfig
+	send     sendFunc
+	stats    *publishStats
+	messages []retryMessage
+	inFlight int // Messages taken out for a retry, still counted against the queue size
+}
+
+// Returns nil when the queue size is zero, so failed publishes are dropped as before
+func newRetryQueue(cfg retryConfig, send sendFunc, stats *publishStats) *retryQueue {
+	if cfg.QueueSize <= 0 {
+		return nil
+	}
+	return &retryQueue{cfg: cfg, send: send, stats: stats}
+}
+
+// Queues a failed publish for its first retry and returns errQueuedForRetry wrapping err;
+// a full queue loses the message. A publish that only failed on some clusters is retried
+// on those, see resendFunc.
+func (q *retryQueue) enqueue(subject, msgID string, data []byte, counter *atomic.Uint64, err error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	msg := retryMessage{subject: subject, msgID: msgID, data: data, send: resendFunc(err), counter: counter, next: time.Now().Add(q.cfg.Backoff), lastErr: err}
+	if len(q.messages)+q.inFlight >= q.cfg.QueueSize {
+		q.lose(msg, "retry queue full")
+		return fmt.Errorf("retry queue full, message lost: %w", err)
+	}
+	q.messages = append(q.messages, msg)
+	return fmt.Errorf("%w: %w", errQueuedForRetry, err)
+}
+
+// Retries due messages until ctx is cancelled
+func (q *retryQueue) run(ctx context.Context) error {
+	ticker := time.NewTicker(retryPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			q.retry(now, false)
+		}
+	}
+}
+
+// Retries every due message, or every message when force is set. Successful messages are
+// counted as published, those out of attempts as lost; the rest wait with a longer backoff.
+func (q *retryQueue) retry(now time.Time, force bool) {
+	q.resend(q.take(now, force), now, time.Time{})
+}
+
+// Removes the due messages from the queue, or every message when force is set, and counts
+// them as in flight until resend puts them back or settles them.
+func (q *retryQueue) take(now time.Time, force bool) []retryMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var due []retryMessage
+	pending := q.messages[:0]
+	for _, msg := range q.messages {
+		if !force && now.Before(msg.next) {
+			pending = append(pending, msg)
+			continue
+		}
+		due = append(due, msg)
+	}
+	clear(q.messages[len(pending):])
+	q.messages = pending
+	q.inFlight += len(due)
+	return due
+}
+
+// Sends the messages taken from the queue without holding q.mu, since a send can block up
+// to jetStreamAckTimeout and the generators keep enqueueing meanwhile. The failures go back
+// to the queue; past a non-zero deadline the messages not sent yet are lost.
+func (q *retryQueue) resend(due []retryMessage, now time.Time, deadline time.Time) {
+	for i, msg := range due {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			q.mu.Lock()
+			for _, msg := range due[i:] {
+				q.lose(msg, "shutdown before retry succeeded")
+			}
+			q.inFlight -= len(due) - i
+			q.mu.Unlock()
+			return
+		}
+		msg.attempts++
+		send := msg.send
+		if send == nil {
+			send = q.send
+		}
+		msg.lastErr = send(msg.subject, msg.msgID, msg.data)
+
+		q.mu.Lock()
+		q.inFlight--
+		switch {
+		case msg.lastErr == nil:
+			msg.counter.Add(1)
+			q.stats.lastPublish.Store(time.Now().UnixNano())
+			q.stats.retried.Add(1)
+		case msg.attempts >= q.cfg.MaxAttempts:
+			q.lose(msg, "retries exhausted")
+		default:
+			if resend := resendFunc(msg.lastErr); resend != nil {
+				msg.send = resend // Only the clusters still failing get the next retry
+			}
+			backoff := q.cfg.Backoff << msg.attempts
+			if backoff <= 0 || backoff > q.cfg.MaxBackoff {
+				backoff = q.cfg.MaxBackoff
+			}
+			msg.next = now.Add(backoff)
+			q.messages = append(q.messages, msg)
+		}
+		q.mu.Unlock()
+	}
+}
+
+// Retries the remaining messages without backoff until the queue is empty or the grace
+// period ends, checked before every send; whatever is left is lost. Must be called before
+// flushing on shutdown.
+func (q *retryQueue) drain(grace time.Duration) {
+	deadline := time.Now().Add(grace)
+	for {
+		q.mu.Lock()
+		remaining := len(q.messages)
+		q.mu.Unlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			q.mu.Lock()
+			for _, msg := range q.messages {
+				q.lose(msg, "shutdown before retry succeeded")
+			}
+			q.messages = nil
+			q.mu.Unlock()
+			break
+		}
+		now := time.Now()
+		q.resend(q.take(now, true), now, deadline)
+		time.Sleep(retryPollInterval)
+	}
+	log.Printf("Daemon: Retry queue: %d message(s) delivered on retry, %d lost in total", q.stats.retried.Load(), q.stats.lost.Load())
+}
+
+// Counts the message as lost and appends it to the lost file when configured.
+// The caller holds q.mu, which also serializes the file writes.
+func (q *retryQueue) lose(msg retryMessage, reason string) {
+	q.stats.lost.Add(1)
+	log.Printf("Daemon: Lost message to '%s' after %d retry attempt(s): %s: %v", msg.subject, msg.attempts, reason, msg.lastErr)
+	if q.cfg.LostFile == "" {
+		return
+	}
+
+	lost := LostMessage{
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Subject:   msg.subject,
+		Payload:   string(msg.data),
+		Attempts:  msg.attempts,
+		Error:     reason,
+	}
+	if msg.lastErr != nil {
+		lost.Error += ": " + msg.lastErr.Error()
+	}
+	line, err := json.Marshal(lost)
+	if err != nil {
+		log.Printf("Daemon: Failed to serialize lost message: %v", err)
+		return
+	}
+	f, err := os.OpenFile(q.cfg.LostFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("Daemon: Failed to open lost message file %s: %v", q.cfg.LostFile, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("Daemon: Failed to write lost message file %s: %v", q.cfg.LostFile, err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// A retry blocked in its send, waiting for a JetStream ack, must not block the generators
+func TestRetryDoesNotHoldTheQueueWhileSending(t *testing.T) {
+	sending, release := make(chan struct{}), make(chan struct{})
+	send := func(subject, msgID string, data []byte) error {
+		close(sending)
+		<-release
+		return nil
+	}
+	stats := &publishStats{}
+	q := newRetryQueue(retryConfig{QueueSize: 2, MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}, send, stats)
+	var counter atomic.Uint64
+	q.enqueue(EventsSubject, "id-1", []byte(`{}`), &counter, errUnavailable)
+
+	retried := make(chan struct{})
+	go func() {
+		q.retry(time.Now(), true)
+		close(retried)
+	}()
+	<-sending
+
+	enqueued := make(chan error, 1)
+	go func() { enqueued <- q.enqueue(EventsSubject, "id-2", []byte(`{}`), &counter, errUnavailable) }()
+	select {
+	case err := <-enqueued:
+		if !errors.Is(err, errQueuedForRetry) {
+			t.Errorf("enqueue during a send = %v, want %v", err, errQueuedForRetry)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("enqueue blocked while a retry was sending")
+	}
+	// The message in flight still counts against the queue size
+	if err := q.enqueue(EventsSubject, "id-3", []byte(`{}`), &counter, errUnavailable); errors.Is(err, errQueuedForRetry) {
+		t.Errorf("enqueue into a full queue = %v, want the message lost", err)
+	}
+
+	close(release)
+	<-retried
+	if counter.Load() != 1 || stats.retried.Load() != 1 || len(q.messages) != 1 || q.inFlight != 0 {
+		t.Errorf("published %d, retried %d, %d queued, %d in flight, want 1, 1, 1, 0", counter.Load(), stats.retried.Load(), len(q.messages), q.inFlight)
+	}
+}
+
+// The grace period ends during a pass: the messages not sent yet are lost without a send
+func TestDrainChecksTheDeadlineBeforeEverySend(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	const sendTime = 100 * time.Millisecond
+	var sends atomic.Int32
+	send := func(subject, msgID string, data []byte) error {
+		sends.Add(1)
+		time.Sleep(sendTime)
+		return errUnavailable
+	}
+	stats := &publishStats{}
+	q := newRetryQueue(retryConfig{QueueSize: 10, MaxAttempts: 10, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}, send, stats)
+	var counter atomic.Uint64
+	for _, id := range []string{"id-1", "id-2", "id-3", "id-4", "id-5"} {
+		q.enqueue(EventsSubject, id, []byte(`{}`), &counter, errUnavailable)
+	}
+
+	start := time.Now()
+	q.drain(sendTime + sendTime/2)
+	if elapsed := time.Since(start); elapsed >= 4*sendTime {
+		t.Errorf("drained in %s, want the grace period kept to within a send", elapsed)
+	}
+	if n := sends.Load(); n != 2 {
+		t.Errorf("sent %d time(s) within the grace period, want 2", n)
+	}
+	if stats.lost.Load() != 5 || len(q.messages) != 0 || q.inFlight != 0 {
+		t.Errorf("lost %d, %d queued, %d in flight after the drain, want 5, 0, 0", stats.lost.Load(), len(q.messages), q.inFlight)
+	}
+}
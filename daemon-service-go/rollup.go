@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// RollupSummary is the aggregate of one window published to SummarySubject for consumers
+// that want a rollup rather than the raw messages. Unlike the generation summary in the
+// log, it covers every device and carries value statistics per metric type.
+type RollupSummary struct {
+	SchemaVersion int                     `json:"schemaVersion"`
+	Final         bool                    `json:"final"` // Set on the partial window published on shutdown
+	WindowStart   string                  `json:"windowStart"`
+	WindowEnd     string                  `json:"windowEnd"`
+	Devices       map[string]uint64       `json:"devices"` // Metrics emitted per device
+	Metrics       map[string]MetricRollup `json:"metrics"` // Value statistics per metric type
+	Events        map[string]uint64       `json:"events"`  // Events emitted per event type
+}
+
+// MetricRollup holds the value statistics of one metric type over a window.
+type MetricRollup struct {
+	Count uint64  `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+}
+
+// metricAccumulator collects the values of one metric type; the mean is only taken on publish.
+type metricAccumulator struct {
+	count    uint64
+	min, max float64
+	sum      float64
+}
+
+// rollup aggregates the published metrics and events of the current window.
+type rollup struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	devices     map[string]uint64
+	metrics     map[string]*metricAccumulator
+	events      map[string]uint64
+}
+
+func newRollup(startedAt time.Time) *rollup {
+	r := &rollup{}
+	r.reset(startedAt)
+	return r
+}
+
+// Starts a new window. Callers hold mu unless the rollup is not shared yet.
+func (r *rollup) reset(now time.Time) {
+	r.windowStart = now
+	r.devices = make(map[string]uint64)
+	r.metrics = make(map[string]*metricAccumulator)
+	r.events = make(map[string]uint64)
+}
+
+func (r *rollup) recordMetric(metric DeviceMetric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.devices[metric.SourceDevice]++
+	acc, ok := r.metrics[metric.MetricType]
+	if !ok {
+		acc = &metricAccumulator{min: math.Inf(1), max: math.Inf(-1)}
+		r.metrics[metric.MetricType] = acc
+	}
+	acc.count++
+	acc.sum += metric.Value
+	acc.min = min(acc.min, metric.Value)
+	acc.max = max(acc.max, metric.Value)
+}
+
+func (r *rollup) recordEvent(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[event.EventType]++
+}
+
+// Builds the summary of the current window and starts a new one
+func (r *rollup) snapshot(now time.Time, final bool) RollupSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	summary := RollupSummary{
+		SchemaVersion: SchemaVersion,
+		Final:         final,
+		WindowStart:   r.windowStart.Format(time.RFC3339Nano),
+		WindowEnd:     now.Format(time.RFC3339Nano),
+		Devices:       r.devices,
+		Metrics:       make(map[string]MetricRollup, len(r.metrics)),
+		Events:        r.events,
+	}
+	for metricType, acc := range r.metrics {
+		summary.Metrics[metricType] = MetricRollup{Count: acc.count, Min: acc.min, Max: acc.max, Mean: acc.sum / float64(acc.count)}
+	}
+	r.reset(now)
+	return summary
+}
+
+// Publishes the summary of the current window to SummarySubject. Summaries bypass the
+// message limit and fault injection, like heartbeats.
+func (r *rollup) publish(send sendFunc, final bool) {
+	summary := r.snapshot(time.Now(), final)
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		log.Printf("Daemon: Failed to serialize rollup summary: %v", err)
+		return
+	}
+	if err := send(SummarySubject, "", summaryJSON); err != nil {
+		log.Printf("Daemon: Error publishing rollup summary to '%s': %v", SummarySubject, err)
+		return
+	}
+	log.Printf("Daemon: Published rollup summary of %d device(s) to '%s' (final: %t)", len(summary.Devices), SummarySubject, final)
+}
+
+// Publishes a summary every interval until ctx is cancelled
+func (r *rollup) run(ctx context.Context, send sendFunc, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.publish(send, false)
+		}
+	}
+}
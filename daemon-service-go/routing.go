@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// eventSubjectNamespace is the prefix every event subject must have unless foreign
+// subjects are allowed, so that the writer's events.* subscription sees all events.
+const eventSubjectNamespace = "events."
+
+// reservedSubjects are the subjects of the namespace the writer reads as something other
+// than events, which no event type may be routed to
+var reservedSubjects = map[string]string{
+	DeviceMetricsSubject: "device metrics",
+	SummarySubject:       "rollup summaries",
+	AckSubject:           "event acknowledgments",
+}
+
+// eventRouter resolves the NATS subject an event is published to.
+// Event types with a configured subject go there, security-class event types go to
+// SecurityEventsSubject and everything else to EventsSubject.
+type eventRouter struct {
+	security map[string]bool
+	subjects map[string]string // Subject per event type from the config file
+}
+
+// Builds a router from a comma-separated list of security-class event types, "none" disables
+// routing, and the per-event-type subjects of the config file, which take precedence.
+// Types that the daemon never generates are kept but reported, since they are most likely typos.
+// It fails for subjects outside the events.* namespace unless allowForeign is set.
+func newEventRouter(securityEventTypes string, subjects map[string]string, allowForeign bool) (*eventRouter, error) {
+	for eventType, subject := range subjects {
+		if err := validateEventSubject(subject, allowForeign); err != nil {
+			return nil, fmt.Errorf("subject of event type '%s': %w", eventType, err)
+		}
+		if !slices.Contains(eventTypes, eventType) && !slices.Contains(lifecycleEventTypes, eventType) {
+			log.Printf("Daemon Service (Go): WARNING: routed event type '%s' is not one of the generated event types %v", eventType, eventTypes)
+		}
+	}
+
+	r := &eventRouter{security: make(map[string]bool), subjects: subjects}
+	for _, eventType := range strings.Split(securityEventTypes, ",") {
+		eventType = strings.TrimSpace(eventType)
+		if eventType == "" || strings.EqualFold(eventType, "none") {
+			continue
+		}
+		if !slices.Contains(eventTypes, eventType) {
+			log.Printf("Daemon Service (Go): WARNING: security event type '%s' is not one of the generated event types %v", eventType, eventTypes)
+		}
+		r.security[eventType] = true
+	}
+	return r, nil
+}
+
+// Checks that subject is a literal NATS subject other than the reservedSubjects and, unless
+// allowForeign is set, a single token below the events namespace, which the writer stores
+// as events
+func validateEventSubject(subject string, allowForeign bool) error {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n*>") || slices.Contains(strings.Split(subject, "."), "") {
+		return fmt.Errorf("'%s' is not a valid literal NATS subject", subject)
+	}
+	if use, ok := reservedSubjects[subject]; ok {
+		return fmt.Errorf("'%s' is reserved for %s", subject, use)
+	}
+	if allowForeign {
+		return nil
+	}
+	token, ok := strings.CutPrefix(subject, eventSubjectNamespace)
+	if !ok || strings.Contains(token, ".") {
+		return fmt.Errorf("'%s' is outside the %s* namespace, set ALLOW_FOREIGN_SUBJECTS=true to allow it", subject, eventSubjectNamespace)
+	}
+	return nil
+}
+
+// Returns the subject for the given event type
+func (r *eventRouter) subject(eventType string) string {
+	if subject, ok := r.subjects[eventType]; ok {
+		return subject
+	}
+	if r.security[eventType] {
+		return SecurityEventsSubject
+	}
+	return EventsSubject
+}
+
+// Returns the configured security-class event types in a stable order
+func (r *eventRouter) securityTypes() []string {
+	types := make([]string, 0, len(r.security))
+	for eventType := range r.security {
+		types = append(types, eventType)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// Returns the configured per-event-type subjects as "type -> subject" in a stable order
+func (r *eventRouter) routes() []string {
+	routes := make([]string, 0, len(r.subjects))
+	for eventType, subject := range r.subjects {
+		routes = append(routes, eventType+" -> "+subject)
+	}
+	slices.Sort(routes)
+	return routes
+}
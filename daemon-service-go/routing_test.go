@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEventRouterSubject(t *testing.T) {
+	router, err := newEventRouter("UnauthorizedAccess, none", map[string]string{
+		"DataCorruption":     "events.integrity",
+		"UnauthorizedAccess": "events.audit", // The config file takes precedence over the security routing
+	}, false)
+	if err != nil {
+		t.Fatalf("newEventRouter: %v", err)
+	}
+	tests := []struct {
+		eventType, want string
+	}{
+		{"DataCorruption", "events.integrity"},
+		{"UnauthorizedAccess", "events.audit"},
+		{"DriveFailure", EventsSubject},
+		{"NotGenerated", EventsSubject},
+	}
+	for _, tt := range tests {
+		if got := router.subject(tt.eventType); got != tt.want {
+			t.Errorf("subject(%q) = %q, want %q", tt.eventType, got, tt.want)
+		}
+	}
+}
+
+func TestEventRouterSecurityTypes(t *testing.T) {
+	router, err := newEventRouter(" UnauthorizedAccess ,DriveFailure,,", nil, false)
+	if err != nil {
+		t.Fatalf("newEventRouter: %v", err)
+	}
+	if got := router.subject("DriveFailure"); got != SecurityEventsSubject {
+		t.Errorf("subject(DriveFailure) = %q, want %q", got, SecurityEventsSubject)
+	}
+	if got := strings.Join(router.securityTypes(), ","); got != "DriveFailure,UnauthorizedAccess" {
+		t.Errorf("securityTypes() = %s", got)
+	}
+
+	router, err = newEventRouter("none", nil, false)
+	if err != nil {
+		t.Fatalf("newEventRouter(none): %v", err)
+	}
+	if got := router.subject("UnauthorizedAccess"); got != EventsSubject {
+		t.Errorf("subject(UnauthorizedAccess) with routing disabled = %q, want %q", got, EventsSubject)
+	}
+}
+
+func TestValidateEventSubject(t *testing.T) {
+	tests := []struct {
+		subject      string
+		allowForeign bool
+		wantErr      string // Part of the error, "" for a valid subject
+	}{
+		{"events.integrity", false, ""},
+		{"events.event", false, ""},
+		{"events.security", false, ""},
+		{"integrity.events", false, "outside the events.* namespace"},
+		{"events.integrity.disk", false, "outside the events.* namespace"},
+		{"integrity.events", true, ""},
+		{"events.integrity.disk", true, ""},
+		{DeviceMetricsSubject, false, "reserved for device metrics"},
+		{SummarySubject, true, "reserved for rollup summaries"},
+		{AckSubject, false, "reserved for event acknowledgments"},
+		{"events.*", false, "not a valid literal NATS subject"},
+		{"events.>", true, "not a valid literal NATS subject"},
+		{"events..integrity", false, "not a valid literal NATS subject"},
+		{"events.data corruption", false, "not a valid literal NATS subject"},
+		{"", false, "not a valid literal NATS subject"},
+	}
+	for _, tt := range tests {
+		err := validateEventSubject(tt.subject, tt.allowForeign)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("validateEventSubject(%q, %t) = %v, want nil", tt.subject, tt.allowForeign, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("validateEventSubject(%q, %t) = %v, want an error containing %q", tt.subject, tt.allowForeign, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNewEventRouterRejectsInvalidSubjects(t *testing.T) {
+	_, err := newEventRouter("", map[string]string{"DataCorruption": "integrity"}, false)
+	if err == nil || !strings.Contains(err.Error(), "DataCorruption") {
+		t.Fatalf("newEventRouter with a foreign subject = %v, want an error naming the event type", err)
+	}
+	if _, err := newEventRouter("", map[string]string{"DataCorruption": "integrity"}, true); err != nil {
+		t.Fatalf("newEventRouter with a foreign subject allowed = %v", err)
+	}
+}
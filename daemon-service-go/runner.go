@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// fleetRunner runs one generator goroutine per device and lets devices join, change and
+// leave while the daemon is running. A fatal error of any generator stops all of them.
+type fleetRunner struct {
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	settings *generatorSettings
+	seed     int64
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]*runningGenerator
+
+	totalWeight atomic.Uint64 // Sum of the event weights of the running devices, as float64 bits
+}
+
+// runningGenerator is the handle of one generator goroutine.
+type runningGenerator struct {
+	dev    *device
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newFleetRunner(ctx context.Context, settings *generatorSettings, seed int64) *fleetRunner {
+	ctx, cancel := context.WithCancelCause(ctx)
+	r := &fleetRunner{ctx: ctx, cancel: cancel, settings: settings, seed: seed, running: make(map[string]*runningGenerator)}
+	settings.eventShare = r.eventShare
+	return r
+}
+
+// Starts the generator of a device that is not running yet
+func (r *fleetRunner) start(dev *device) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	gen := &runningGenerator{dev: dev, cancel: cancel, done: make(chan struct{})}
+	r.running[dev.Name] = gen
+	r.addWeight(dev.eventWeight)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(gen.done)
+		if err := newDeviceGenerator(dev, r.seed, r.settings).run(ctx); err != nil {
+			r.cancel(err)
+		}
+	}()
+}
+
+// Stops the generator of the named device, waits for it to return and hands back its
+// device, which the caller may then modify and start again. It returns nil for unknown names.
+func (r *fleetRunner) stop(name string) *device {
+	r.mu.Lock()
+	gen, ok := r.running[name]
+	if ok {
+		delete(r.running, name)
+		r.addWeight(-gen.dev.eventWeight)
+	}
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	gen.cancel()
+	<-gen.done
+	return gen.dev
+}
+
+// Returns the number of running generators
+func (r *fleetRunner) size() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.running)
+}
+
+// Waits until every generator has returned and reports the first fatal error, if any.
+// Generators return once the daemon shuts down, their bounded cycles are done or a
+// fatal error stopped them all.
+func (r *fleetRunner) wait() error {
+	r.wg.Wait()
+	if cause := context.Cause(r.ctx); cause != nil && !errors.Is(cause, context.Canceled) {
+		return cause
+	}
+	return nil
+}
+
+// Returns the device's share of the fleet's random events: its weight relative to the
+// weights of all running devices
+func (r *fleetRunner) eventShare(dev *device) float64 {
+	total := math.Float64frombits(r.totalWeight.Load())
+	if total <= 0 {
+		return 0
+	}
+	return dev.eventWeight / total
+}
+
+// Adds delta to the total weight; the caller holds r.mu
+func (r *fleetRunner) addWeight(delta float64) {
+	total := math.Float64frombits(r.totalWeight.Load()) + delta
+	r.totalWeight.Store(math.Float64bits(max(total, 0)))
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+// Derives the RNG seed of a device generator from the master seed and the device name.
+// math/rand sources are not safe for concurrent use, so every generator owns a source of
+// its own; deriving it from the name instead of the fleet position keeps the per-device
+// sequences identical across runs with the same seed, even when the fleet composition
+// changes. Distinct names give distinct seeds unless their FNV-1a hashes collide.
+func deviceSeed(master int64, name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return master ^ int64(h.Sum64())
+}
+
+// Returns a new RNG for the device, never shared with another generator
+func newDeviceRand(master int64, name string) *rand.Rand {
+	return rand.New(rand.NewSource(deviceSeed(master, name)))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDeviceRandIsPerDevice(t *testing.T) {
+	a, b := newDeviceRand(7, "DiskUnit-0001"), newDeviceRand(7, "DiskUnit-0001")
+	for range 10 {
+		if a.Int63() != b.Int63() {
+			t.Fatal("same seed and device drew different numbers")
+		}
+	}
+	if newDeviceRand(7, "DiskUnit-0001").Int63() == newDeviceRand(7, "DiskUnit-0002").Int63() {
+		t.Error("devices share their random sequence")
+	}
+	if newDeviceRand(7, "DiskUnit-0001").Int63() == newDeviceRand(8, "DiskUnit-0001").Int63() {
+		t.Error("seeds share their random sequence")
+	}
+}
+
+func TestGeneratorsNeverShareASource(t *testing.T) {
+	settings := newTestSettings(t, nil, time.Second)
+	fleet := buildFleet(20, sourceDevices)
+	seen := map[any]string{}
+	for _, dev := range fleet {
+		g := newDeviceGenerator(dev, 7, settings)
+		if other, ok := seen[g.randGen]; ok {
+			t.Errorf("%s and %s share an RNG", dev.Name, other)
+		}
+		seen[g.randGen] = dev.Name
+	}
+}
+
+// metricSequences runs the fleet for a number of cycles, device after device, and returns
+// the metric types and values each device generated
+func metricSequences(t *testing.T, fleet []*device, seed int64, cycles int) map[string][]string {
+	t.Helper()
+	var out bytes.Buffer
+	settings := newTestSettings(t, &out, time.Second)
+	settings.eventShare = func(*device) float64 { return 1 }
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, dev := range fleet {
+		g := newDeviceGenerator(dev, seed, settings)
+		for i := range cycles {
+			if err := g.cycle(start.Add(time.Duration(i) * time.Second)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	sequences := map[string][]string{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		subject, payload, _ := strings.Cut(scanner.Text(), " ")
+		var metric DeviceMetric
+		if subject != DeviceMetricsSubject {
+			continue
+		}
+		if err := json.Unmarshal([]byte(payload), &metric); err != nil {
+			t.Fatalf("malformed metric %q", payload)
+		}
+		sequences[metric.SourceDevice] = append(sequences[metric.SourceDevice], fmt.Sprintf("%s %s %v", metric.Timestamp, metric.MetricType, metric.Value))
+	}
+	return sequences
+}
+
+func TestSameSeedYieldsIdenticalPerDeviceSequences(t *testing.T) {
+	const cycles = 100
+	small := buildFleet(6, sourceDevices)
+	large := buildFleet(30, sourceDevices)
+	slices.Reverse(large) // Another fleet order and composition must not matter either
+
+	first := metricSequences(t, small, 7, cycles)
+	second := metricSequences(t, large, 7, cycles)
+	for _, dev := range small {
+		if len(first[dev.Name]) != cycles {
+			t.Fatalf("%s generated %d metric(s), want %d", dev.Name, len(first[dev.Name]), cycles)
+		}
+		if !slices.Equal(first[dev.Name], second[dev.Name]) {
+			t.Errorf("%s generated different sequences with the same seed", dev.Name)
+		}
+	}
+
+	other := metricSequences(t, buildFleet(6, sourceDevices), 8, cycles)
+	if slices.Equal(first[small[0].Name], other[small[0].Name]) {
+		t.Errorf("%s generated the same sequence with another seed", small[0].Name)
+	}
+}
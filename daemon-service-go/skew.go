@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Applies the configured clock skew to the fleet. Entries that match no device are reported.
+func applyClockSkew(fleet []*device, skews map[string]ClockSkew, startedAt time.Time) {
+	used := make(map[string]bool)
+	for _, dev := range fleet {
+		if key := dev.setClockSkew(skews, startedAt); key != "" {
+			used[key] = true
+		}
+	}
+	for key := range skews {
+		if !used[key] {
+			log.Printf("Daemon Service (Go): WARNING: clock skew configured for '%s', which matches no simulated device", key)
+		}
+	}
+}
+
+// Sets the clock skew configured for the device's name or else its type and returns the
+// matching key, "" when there is none
+func (d *device) setClockSkew(skews map[string]ClockSkew, startedAt time.Time) string {
+	for _, key := range []string{d.Name, d.Type} {
+		if skew, ok := skews[key]; ok {
+			d.clockOffset = time.Duration(skew.Offset)
+			d.clockDrift = time.Duration(skew.DriftPerHour)
+			d.clockSince = startedAt
+			return key
+		}
+	}
+	return ""
+}
+
+// Reports whether the device's clock deviates from the true time
+func (d *device) skewed() bool {
+	return d.clockOffset != 0 || d.clockDrift != 0
+}
+
+// Returns the time as seen by the device's own clock
+func (d *device) clock(now time.Time) time.Time {
+	if !d.skewed() {
+		return now
+	}
+	drift := time.Duration(float64(d.clockDrift) * now.Sub(d.clockSince).Hours())
+	return now.Add(d.clockOffset + drift)
+}
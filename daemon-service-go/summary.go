@@ -0,0 +1,202 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// GenerationSummary is the structured log block describing what was generated.
+// Window counts cover the time since the previous summary, lifetime counts the whole run.
+// Only the busiest devices of the window are listed; the rest are folded into Other.
+type GenerationSummary struct {
+	Final         bool            `json:"final"`
+	WindowStart   string          `json:"windowStart"`
+	WindowEnd     string          `json:"windowEnd"`
+	UptimeSeconds float64         `json:"uptimeSeconds"`
+	Window        SummaryCounts   `json:"window"`
+	Lifetime      SummaryCounts   `json:"lifetime"`
+	TopDevices    []DeviceSummary `json:"topDevices"`
+	Other         *OtherDevices   `json:"other,omitempty"`
+}
+
+// SummaryCounts holds message counts keyed by metric type and by event type.
+// Suppressed counts the events held back by the producer-side deduplication.
+type SummaryCounts struct {
+	Metrics    map[string]uint64 `json:"metrics"`
+	Events     map[string]uint64 `json:"events"`
+	Suppressed map[string]uint64 `json:"suppressed,omitempty"`
+}
+
+// DeviceSummary holds the window counts of one device.
+type DeviceSummary struct {
+	Device string `json:"device"`
+	SummaryCounts
+}
+
+// OtherDevices aggregates the window counts of the devices outside the top list.
+type OtherDevices struct {
+	Devices int    `json:"devices"`
+	Metrics uint64 `json:"metrics"`
+	Events  uint64 `json:"events"`
+}
+
+func newSummaryCounts() SummaryCounts {
+	return SummaryCounts{Metrics: make(map[string]uint64), Events: make(map[string]uint64), Suppressed: make(map[string]uint64)}
+}
+
+func (c SummaryCounts) total() uint64 {
+	var total uint64
+	for _, n := range c.Metrics {
+		total += n
+	}
+	for _, n := range c.Events {
+		total += n
+	}
+	return total
+}
+
+// generationCounter counts published metrics and events per device and type.
+// Per-device counts only live for one window, so memory is bounded by the devices
+// that were active since the last summary rather than growing with the run.
+type generationCounter struct {
+	mu          sync.Mutex
+	startedAt   time.Time
+	windowStart time.Time
+	topN        int
+	window      SummaryCounts
+	lifetime    SummaryCounts
+	devices     map[string]SummaryCounts
+}
+
+func newGenerationCounter(startedAt time.Time, topN int) *generationCounter {
+	return &generationCounter{
+		startedAt:   startedAt,
+		windowStart: startedAt,
+		topN:        topN,
+		window:      newSummaryCounts(),
+		lifetime:    newSummaryCounts(),
+		devices:     make(map[string]SummaryCounts),
+	}
+}
+
+func (g *generationCounter) recordMetric(device, metricType string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.window.Metrics[metricType]++
+	g.lifetime.Metrics[metricType]++
+	g.device(device).Metrics[metricType]++
+}
+
+func (g *generationCounter) recordEvent(device, eventType string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.window.Events[eventType]++
+	g.lifetime.Events[eventType]++
+	g.device(device).Events[eventType]++
+}
+
+func (g *generationCounter) recordSuppressed(eventType string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.window.Suppressed[eventType]++
+	g.lifetime.Suppressed[eventType]++
+}
+
+// Returns the window counts of a device, creating them on first use. Callers hold mu.
+func (g *generationCounter) device(name string) SummaryCounts {
+	counts, ok := g.devices[name]
+	if !ok {
+		counts = newSummaryCounts()
+		g.devices[name] = counts
+	}
+	return counts
+}
+
+// Builds the summary of the current window and starts a new one
+func (g *generationCounter) snapshot(now time.Time, final bool) GenerationSummary {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	summary := GenerationSummary{
+		Final:         final,
+		WindowStart:   g.windowStart.Format(time.RFC3339),
+		WindowEnd:     now.Format(time.RFC3339),
+		UptimeSeconds: now.Sub(g.startedAt).Seconds(),
+		Window:        g.window,
+		Lifetime:      copySummaryCounts(g.lifetime),
+	}
+
+	ranked := make([]DeviceSummary, 0, len(g.devices))
+	for name, counts := range g.devices {
+		ranked = append(ranked, DeviceSummary{Device: name, SummaryCounts: counts})
+	}
+	slices.SortFunc(ranked, func(a, b DeviceSummary) int {
+		if c := cmp.Compare(b.total(), a.total()); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Device, b.Device)
+	})
+	if len(ranked) > g.topN {
+		other := &OtherDevices{Devices: len(ranked) - g.topN}
+		for _, d := range ranked[g.topN:] {
+			for _, n := range d.Metrics {
+				other.Metrics += n
+			}
+			for _, n := range d.Events {
+				other.Events += n
+			}
+		}
+		summary.Other = other
+		ranked = ranked[:g.topN]
+	}
+	summary.TopDevices = ranked
+
+	g.windowStart = now
+	g.window = newSummaryCounts()
+	g.devices = make(map[string]SummaryCounts)
+	return summary
+}
+
+func copySummaryCounts(c SummaryCounts) SummaryCounts {
+	out := newSummaryCounts()
+	for k, v := range c.Metrics {
+		out.Metrics[k] = v
+	}
+	for k, v := range c.Events {
+		out.Events[k] = v
+	}
+	for k, v := range c.Suppressed {
+		out.Suppressed[k] = v
+	}
+	return out
+}
+
+// Logs the summary of the current window as one JSON document
+func (g *generationCounter) log(final bool) {
+	summary := g.snapshot(time.Now(), final)
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		log.Printf("Daemon: Failed to serialize generation summary: %v", err)
+		return
+	}
+	log.Printf("Daemon: Generation summary: %s", summaryJSON)
+}
+
+// Logs a summary every interval until ctx is cancelled
+func (g *generationCounter) run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			g.log(false)
+		}
+	}
+}
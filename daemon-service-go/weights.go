@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Assigns each device its weight in the fleet's events from weights keyed by device name
+// or base device type (an exact name wins). Devices without a weight get 1, a weight of 0
+// excludes a device from events while it keeps producing metrics. A device's share of the
+// events is its weight relative to the total of the running fleet.
+func applyEventWeights(fleet []*device, weights map[string]float64) error {
+	used := make(map[string]bool)
+	total := 0.0
+	for _, dev := range fleet {
+		weight, key := eventWeightOf(dev, weights)
+		if key != "" {
+			used[key] = true
+		}
+		if weight < 0 {
+			return fmt.Errorf("eventWeights: weight of '%s' must not be negative", dev.Name)
+		}
+		dev.eventWeight = weight
+		total += weight
+	}
+	for key := range weights {
+		if !used[key] {
+			log.Printf("Daemon Service (Go): WARNING: event weight configured for '%s', which matches no simulated device", key)
+		}
+	}
+	if total == 0 {
+		return errors.New("eventWeights: at least one device must have a positive weight")
+	}
+	return nil
+}
+
+// Returns the event weight configured for the device's name or else its type together
+// with the matching key, or 1 and "" when there is none
+func eventWeightOf(dev *device, weights map[string]float64) (float64, string) {
+	for _, key := range []string{dev.Name, dev.Type} {
+		if w, ok := weights[key]; ok {
+			return w, key
+		}
+	}
+	return 1, ""
+}
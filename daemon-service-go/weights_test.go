@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyEventWeights(t *testing.T) {
+	fleet := buildFleet(6, sourceDevices)
+	weights := map[string]float64{"StorageArray": 3, "DiskUnit": 5, "CloudStorage": 0, fleet[0].Name: 1}
+	if err := applyEventWeights(fleet, weights); err != nil {
+		t.Fatal(err)
+	}
+	for _, dev := range fleet {
+		want := weights[dev.Type]
+		if dev == fleet[0] {
+			want = 1 // The exact name wins over the type
+		}
+		if dev.eventWeight != want {
+			t.Errorf("%s weighs %g, want %g", dev.Name, dev.eventWeight, want)
+		}
+	}
+
+	if err := applyEventWeights(buildFleet(3, sourceDevices), nil); err != nil {
+		t.Errorf("no weights: %v", err)
+	}
+	if err := applyEventWeights(buildFleet(3, sourceDevices), map[string]float64{"DiskUnit": -1}); err == nil {
+		t.Error("accepted a negative weight")
+	}
+	if err := applyEventWeights(buildFleet(3, sourceDevices), map[string]float64{"StorageArray": 0, "DiskUnit": 0, "CloudStorage": 0}); err == nil {
+		t.Error("accepted a fleet without any positive weight")
+	}
+}
+
+func TestEventWeightsProportions(t *testing.T) {
+	const cycles = 20000
+	const tolerance = 0.02
+	var out bytes.Buffer
+	settings := newTestSettings(t, &out, time.Second)
+	fleet := buildFleet(6, sourceDevices)
+	if err := applyEventWeights(fleet, map[string]float64{"StorageArray": 3, "DiskUnit": 5, "CloudStorage": 0}); err != nil {
+		t.Fatal(err)
+	}
+	total := 0.0
+	for _, dev := range fleet {
+		total += dev.eventWeight
+	}
+	settings.eventShare = func(dev *device) float64 { return dev.eventWeight / total }
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	generators := make([]*deviceGenerator, len(fleet))
+	for i, dev := range fleet {
+		generators[i] = newDeviceGenerator(dev, 42, settings)
+	}
+	for range cycles {
+		for _, g := range generators {
+			if err := g.cycle(now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		now = now.Add(time.Second)
+	}
+
+	events, metrics := map[string]int{}, map[string]int{} // Random events and metrics per device type
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		subject, payload, _ := strings.Cut(scanner.Text(), " ")
+		var event Event
+		if json.Unmarshal([]byte(payload), &event) != nil {
+			t.Fatalf("malformed dry-run line %q", scanner.Text())
+		}
+		deviceType := strings.Split(event.SourceDevice, "-")[0]
+		if subject == DeviceMetricsSubject {
+			metrics[deviceType]++
+		} else if slices.Contains(eventTypes, event.EventType) {
+			events[deviceType]++
+		}
+	}
+	if metrics["CloudStorage"] != 2*cycles {
+		t.Errorf("CloudStorage published %d metric(s), want one per cycle of each device despite its weight of 0", metrics["CloudStorage"])
+	}
+	sum := events["StorageArray"] + events["DiskUnit"] + events["CloudStorage"]
+	if want := fleetEventProbability * cycles; math.Abs(float64(sum)-want) > want*0.05 {
+		t.Errorf("%d random event(s) in %d cycles, want about %.0f whatever the fleet size", sum, cycles, want)
+	}
+	for deviceType, want := range map[string]float64{"StorageArray": 6.0 / 16, "DiskUnit": 10.0 / 16, "CloudStorage": 0} {
+		if share := float64(events[deviceType]) / float64(sum); math.Abs(share-want) > tolerance {
+			t.Errorf("%s sourced %.3f of the events, want %.3f", deviceType, share, want)
+		}
+	}
+	if events["CloudStorage"] != 0 {
+		t.Errorf("CloudStorage weighs 0 but sourced %d event(s)", events["CloudStorage"])
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Params of anomaly_temperature
+const (
+	temperatureMetric       = "DiskTemp" // Metric type of the temperature readings the daemon publishes
+	defaultAnomalyThreshold = 1.3        // In standard deviations, as the client's default
+	defaultAnomalyWindow    = 20         // Minutes
+)
+
+// minStdDev is the standard deviation below which readings count as constant: none of them
+// deviates, rather than all of them by a huge z-score from rounding noise.
+const minStdDev = 1e-9
+
+// scoredSample is a reading with its z-score, its deviation from the mean in standard
+// deviations.
+type scoredSample struct {
+	sample
+	zScore float64
+}
+
+// baseline is the result of detectAnomalies.
+type baseline struct {
+	mean      float64
+	stdDev    float64 // Of the population: the readings are the whole window
+	anomalies []scoredSample
+}
+
+// detectAnomalies computes the mean and standard deviation of the samples and returns those
+// deviating from the mean by more than threshold standard deviations, either way, in their
+// order. Needs at least one sample; nearly constant samples have no anomalies.
+func detectAnomalies(samples []sample, threshold float64) baseline {
+	var b baseline
+	for _, s := range samples {
+		b.mean += s.value
+	}
+	b.mean /= float64(len(samples))
+	variance := 0.0
+	for _, s := range samples {
+		variance += (s.value - b.mean) * (s.value - b.mean)
+	}
+	b.stdDev = math.Sqrt(variance / float64(len(samples)))
+	if b.stdDev < minStdDev {
+		return b
+	}
+	for _, s := range samples {
+		if z := (s.value - b.mean) / b.stdDev; math.Abs(z) > threshold {
+			b.anomalies = append(b.anomalies, scoredSample{sample: s, zScore: z})
+		}
+	}
+	return b
+}
+
+var anomalyTemperatureParams = []paramSpec{
+	{name: "source_device", kind: paramString, required: true},
+	{name: "threshold", kind: paramNumber, positive: true},
+	{name: "window_minutes", kind: paramInt, positive: true},
+}
+
+// anomalyTemperature answers anomaly_temperature: the temperature readings of a device in the
+// last window_minutes (default 20) deviating from their mean by more than threshold (default
+// 1.3) standard deviations, with the mean and standard deviation. Fewer readings than
+// anomalyMinSamples get a message instead, as too few make a meaningless baseline.
+func (r *reader) anomalyTemperature(ctx context.Context, params map[string]interface{}) (ReaderResponse, error) {
+	device, err := requiredString(params, "source_device")
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	threshold, err := floatParam(params, "threshold", defaultAnomalyThreshold)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	window, err := intParam(params, "window_minutes", defaultAnomalyWindow)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	samples, err := r.metricSamples(ctx, device, temperatureMetric, time.Duration(window)*time.Minute)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	if len(samples) < r.anomalyMinSamples {
+		return success(fmt.Sprintf("insufficient data: %d %s reading(s) of %s in the last %d minute(s), %d needed", len(samples), temperatureMetric, device, window, r.anomalyMinSamples)), nil
+	}
+
+	b := detectAnomalies(samples, threshold)
+	anomalies := make([]map[string]interface{}, 0, len(b.anomalies))
+	for _, a := range b.anomalies {
+		anomalies = append(anomalies, map[string]interface{}{
+			"timestamp": a.at.UTC().Format(time.RFC3339Nano),
+			"value":     a.value,
+			"z_score":   math.Round(a.zScore*100) / 100,
+		})
+	}
+	return success(map[string]interface{}{
+		"device":    device,
+		"samples":   len(samples),
+		"mean":      b.mean,
+		"stddev":    b.stdDev,
+		"threshold": threshold,
+		"anomaly":   len(anomalies) > 0,
+		"anomalies": anomalies,
+	}), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// samplesOf returns samples of the values a minute apart
+func samplesOf(values ...float64) []sample {
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	samples := make([]sample, len(values))
+	for i, v := range values {
+		samples[i] = sample{at: start.Add(time.Duration(i) * time.Minute), value: v}
+	}
+	return samples
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	tests := []struct {
+		name       string
+		values     []float64
+		threshold  float64
+		wantMean   float64
+		wantStdDev float64
+		wantAt     []int // Indexes of the anomalies
+		wantZ      []float64
+	}{
+		{name: "one sample", values: []float64{42}, threshold: 1, wantMean: 42},
+		{name: "constant", values: []float64{40, 40, 40, 40}, threshold: 0.1, wantMean: 40},
+		{name: "rounding noise", values: []float64{0.1 + 0.2, 0.3, 0.3}, threshold: 0.1, wantMean: 0.3},
+		{name: "spike", values: []float64{40, 40, 40, 40, 60}, threshold: 1.5, wantMean: 44, wantStdDev: 8, wantAt: []int{4}, wantZ: []float64{2}},
+		{name: "dip", values: []float64{40, 40, 40, 40, 20}, threshold: 1.5, wantMean: 36, wantStdDev: 8, wantAt: []int{4}, wantZ: []float64{-2}},
+		{name: "at the threshold is no anomaly", values: []float64{40, 40, 40, 40, 60}, threshold: 2, wantMean: 44, wantStdDev: 8},
+		{name: "both ways in order", values: []float64{30, 50, 40, 40, 40, 40}, threshold: 1.5, wantMean: 40, wantStdDev: math.Sqrt(200.0 / 6), wantAt: []int{0, 1}, wantZ: []float64{-10 / math.Sqrt(200.0/6), 10 / math.Sqrt(200.0/6)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := samplesOf(tt.values...)
+			b := detectAnomalies(samples, tt.threshold)
+			if math.Abs(b.mean-tt.wantMean) > 1e-9 || math.Abs(b.stdDev-tt.wantStdDev) > 1e-9 {
+				t.Errorf("mean %g, stddev %g, want %g and %g", b.mean, b.stdDev, tt.wantMean, tt.wantStdDev)
+			}
+			if len(b.anomalies) != len(tt.wantAt) {
+				t.Fatalf("%d anomalies, want %d", len(b.anomalies), len(tt.wantAt))
+			}
+			for i, a := range b.anomalies {
+				if a.sample != samples[tt.wantAt[i]] || math.Abs(a.zScore-tt.wantZ[i]) > 1e-9 {
+					t.Errorf("anomaly %d is %v with z-score %g, want %v with %g", i, a.sample, a.zScore, samples[tt.wantAt[i]], tt.wantZ[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAnomalyTemperatureInsufficientData(t *testing.T) {
+	influx := &fakeInflux{results: map[string]string{
+		deviceMetricsFlux: fluxTable(readingColumns, "2026-10-16T10:00:00Z,40", "2026-10-16T10:01:00Z,90"),
+	}}
+	response := newTestReader(t, influx).handle(context.Background(),
+		ReaderRequest{QueryType: "anomaly_temperature", Params: map[string]interface{}{"source_device": "Storage-01", "window_minutes": 5.0}}, time.Now())
+	message, _ := response.Data.(string)
+	if response.Status != "success" || !strings.HasPrefix(message, "insufficient data: 2 DiskTemp reading(s)") {
+		t.Fatalf("response %+v, want insufficient data for 2 readings", response)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// defaultCacheTTLs is how long the response of each query type is reused, see responseCache.
+// Query types without an entry, as acknowledge, which writes, are never cached.
+const defaultCacheTTLs = "alerts_critical:5s,device_health:10s,anomaly_temperature:10s,metric_summary:30s," +
+	"device_list:30s,top_devices:10s,metric_timeseries:10s,events_by_type:30s"
+
+// defaultCacheSize is how many responses the cache holds at most
+const defaultCacheSize = 1000
+
+// noCacheParam is the param of any query type that bypasses the cache, for debugging: the
+// request runs its own Flux query, and its response is not cached either
+const noCacheParam = "no_cache"
+
+// cacheEntry is a cached response, or the call producing it while it runs
+type cacheEntry struct {
+	key      string
+	response ReaderResponse
+	at       time.Time     // When the response was produced
+	done     chan struct{} // Closed once response is set; requests for the key wait on it
+	element  *list.Element // In lru, once done
+}
+
+// responseCache reuses the successful responses of identical requests, the same query type
+// and params, for the ttl of their query type, and runs the handler once for identical
+// requests arriving while it runs. It holds at most size responses, evicting the least
+// recently used.
+type responseCache struct {
+	ttls map[string]time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry // Cached and running, by key
+	lru     *list.List             // The cached entries, most recently used first
+}
+
+func newResponseCache(ttls map[string]time.Duration, size int) *responseCache {
+	return &responseCache{ttls: ttls, size: size, entries: map[string]*cacheEntry{}, lru: list.New()}
+}
+
+// cacheKey returns the key of a request: its query type and its params as JSON, which
+// sorts the keys of maps
+func cacheKey(queryType string, params map[string]interface{}) string {
+	canonical, _ := json.Marshal(params)
+	return queryType + " " + string(canonical)
+}
+
+// get returns the response of a request, from the cache when a response of an identical
+// request is at most the ttl of its query type old, marked cached with its age, and from
+// handle otherwise. Only successful responses are cached. A request waiting for an identical
+// one to finish gives up when ctx is done.
+func (c *responseCache) get(ctx context.Context, queryType string, params map[string]interface{}, handle func() ReaderResponse) ReaderResponse {
+	ttl := c.ttls[queryType]
+	if ttl <= 0 || c.size <= 0 {
+		return handle()
+	}
+	key := cacheKey(queryType, params)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && entry.element != nil && time.Since(entry.at) > ttl {
+		c.remove(entry)
+		ok = false
+	}
+	if ok {
+		if entry.element != nil {
+			c.lru.MoveToFront(entry.element)
+		}
+		c.mu.Unlock()
+		select {
+		case <-entry.done:
+			return entry.cached()
+		case <-ctx.Done():
+			return errorResponse(ctx.Err())
+		}
+	}
+	entry = &cacheEntry{key: key, done: make(chan struct{})}
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	response := handle()
+
+	c.mu.Lock()
+	entry.response, entry.at = response, time.Now()
+	close(entry.done)
+	if response.Status == "success" {
+		entry.element = c.lru.PushFront(entry)
+		for c.lru.Len() > c.size {
+			c.remove(c.lru.Back().Value.(*cacheEntry))
+		}
+	} else {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	return response
+}
+
+// remove drops a cached entry; c.mu must be held
+func (c *responseCache) remove(entry *cacheEntry) {
+	c.lru.Remove(entry.element)
+	delete(c.entries, entry.key)
+}
+
+// cached returns the response of the entry for another request: marked cached, with its
+// age, unless it is the error of a call the request waited for
+func (e *cacheEntry) cached() ReaderResponse {
+	response := e.response
+	if response.Status != "success" {
+		return response
+	}
+	age := time.Since(e.at).Milliseconds()
+	response.Cached, response.AgeMs = true, &age
+	return response
+}
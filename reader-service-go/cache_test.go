@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingHandle returns a handler answering with status, and how often it ran
+func countingHandle(status string) (func() ReaderResponse, *atomic.Int32) {
+	var calls atomic.Int32
+	return func() ReaderResponse {
+		calls.Add(1)
+		return ReaderResponse{Status: status, Data: "answer"}
+	}, &calls
+}
+
+func TestResponseCacheHitAndMiss(t *testing.T) {
+	c := newResponseCache(map[string]time.Duration{"device_list": time.Minute}, 10)
+	handle, calls := countingHandle("success")
+	ctx := context.Background()
+
+	first := c.get(ctx, "device_list", map[string]interface{}{"limit": 3.0}, handle)
+	if first.Cached || first.AgeMs != nil {
+		t.Errorf("first response %+v, want it uncached", first)
+	}
+	hit := c.get(ctx, "device_list", map[string]interface{}{"limit": 3.0}, handle)
+	if !hit.Cached || hit.AgeMs == nil || hit.Data != "answer" {
+		t.Errorf("second response %+v, want it cached with its age", hit)
+	}
+	c.get(ctx, "device_list", map[string]interface{}{"limit": 4.0}, handle)
+	c.get(ctx, "top_devices", map[string]interface{}{"limit": 3.0}, handle) // No ttl
+	c.get(ctx, "top_devices", map[string]interface{}{"limit": 3.0}, handle)
+	if calls.Load() != 4 {
+		t.Errorf("handler ran %d times, want 4: other params and query types without a ttl miss", calls.Load())
+	}
+}
+
+func TestCacheKeyIsCanonical(t *testing.T) {
+	a := cacheKey("top_devices", map[string]interface{}{"metric_type": "DiskTemp", "limit": 3.0, "window": "1h"})
+	b := cacheKey("top_devices", map[string]interface{}{"window": "1h", "limit": 3.0, "metric_type": "DiskTemp"})
+	if a != b {
+		t.Errorf("keys %q and %q of the same params differ", a, b)
+	}
+	if a == cacheKey("metric_summary", map[string]interface{}{"metric_type": "DiskTemp", "limit": 3.0, "window": "1h"}) {
+		t.Errorf("query types share the key %q", a)
+	}
+}
+
+func TestResponseCacheTTLExpiry(t *testing.T) {
+	c := newResponseCache(map[string]time.Duration{"device_list": 20 * time.Millisecond}, 10)
+	handle, calls := countingHandle("success")
+	ctx := context.Background()
+
+	c.get(ctx, "device_list", nil, handle)
+	if !c.get(ctx, "device_list", nil, handle).Cached {
+		t.Fatal("response within its ttl not cached")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if c.get(ctx, "device_list", nil, handle).Cached || calls.Load() != 2 {
+		t.Errorf("response past its ttl answered from the cache, handler ran %d times", calls.Load())
+	}
+}
+
+func TestResponseCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newResponseCache(map[string]time.Duration{"device_health": time.Minute}, 2)
+	handle, calls := countingHandle("success")
+	ctx := context.Background()
+	device := func(name string) map[string]interface{} { return map[string]interface{}{"source_device": name} }
+
+	c.get(ctx, "device_health", device("a"), handle)
+	c.get(ctx, "device_health", device("b"), handle)
+	c.get(ctx, "device_health", device("a"), handle) // a is now the most recently used
+	c.get(ctx, "device_health", device("c"), handle) // Evicts b
+	if calls.Load() != 3 {
+		t.Fatalf("handler ran %d times, want 3", calls.Load())
+	}
+	if !c.get(ctx, "device_health", device("a"), handle).Cached || !c.get(ctx, "device_health", device("c"), handle).Cached {
+		t.Error("recently used responses evicted")
+	}
+	if c.get(ctx, "device_health", device("b"), handle).Cached {
+		t.Error("least recently used response not evicted")
+	}
+	if c.lru.Len() != 2 || len(c.entries) != 2 {
+		t.Errorf("cache holds %d responses and %d entries, want at most 2", c.lru.Len(), len(c.entries))
+	}
+}
+
+func TestResponseCacheDoesNotCacheErrors(t *testing.T) {
+	c := newResponseCache(map[string]time.Duration{"device_list": time.Minute}, 10)
+	handle, calls := countingHandle("error")
+	ctx := context.Background()
+
+	for range 3 {
+		if response := c.get(ctx, "device_list", nil, handle); response.Cached || response.Status != "error" {
+			t.Errorf("response %+v, want the uncached error", response)
+		}
+	}
+	if calls.Load() != 3 || len(c.entries) != 0 {
+		t.Errorf("handler ran %d times with %d entries left, want every request to run it", calls.Load(), len(c.entries))
+	}
+}
+
+func TestResponseCacheSingleflight(t *testing.T) {
+	c := newResponseCache(map[string]time.Duration{"device_list": time.Minute}, 10)
+	release := make(chan struct{})
+	var calls atomic.Int32
+	handle := func() ReaderResponse {
+		calls.Add(1)
+		<-release
+		return success("answer")
+	}
+
+	const requests = 10
+	responses := make([]ReaderResponse, requests)
+	var started, done sync.WaitGroup
+	for i := range requests {
+		started.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			started.Done()
+			responses[i] = c.get(context.Background(), "device_list", nil, handle)
+		}()
+	}
+	started.Wait()
+	time.Sleep(20 * time.Millisecond) // Let every request reach the cache
+	close(release)
+	done.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("handler ran %d times for %d identical requests, want once", calls.Load(), requests)
+	}
+	cached := 0
+	for _, response := range responses {
+		if response.Status != "success" || response.Data != "answer" {
+			t.Errorf("response %+v, want the shared answer", response)
+		}
+		if response.Cached {
+			cached++
+		}
+	}
+	if cached != requests-1 {
+		t.Errorf("%d responses marked cached, want all but the one that ran", cached)
+	}
+}
+
+func TestResponseCacheWaiterGivesUp(t *testing.T) {
+	c := newResponseCache(map[string]time.Duration{"device_list": time.Minute}, 10)
+	release := make(chan struct{})
+	defer close(release)
+	go c.get(context.Background(), "device_list", nil, func() ReaderResponse { <-release; return success(nil) })
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	response := c.get(ctx, "device_list", nil, func() ReaderResponse { t.Error("ran a second query"); return success(nil) })
+	if response.Status != "error" || response.Message != context.DeadlineExceeded.Error() {
+		t.Errorf("response %+v, want the deadline error", response)
+	}
+}
+
+func TestHandleNoCacheBypassesTheCache(t *testing.T) {
+	influx := &fakeInflux{results: map[string]string{deviceListFlux: fluxTable(tagValueColumns, "Storage-01")}}
+	r := newTestReader(t, influx)
+	r.cache = newResponseCache(map[string]time.Duration{"device_list": time.Minute}, 10)
+	ask := func(params map[string]interface{}) ReaderResponse {
+		return r.handle(context.Background(), ReaderRequest{QueryType: "device_list", Params: params}, time.Now())
+	}
+
+	ask(nil)
+	if !ask(nil).Cached {
+		t.Error("identical request not answered from the cache")
+	}
+	if ask(map[string]interface{}{noCacheParam: true}).Cached {
+		t.Error("request with no_cache answered from the cache")
+	}
+	if len(influx.ran()) != 2 {
+		t.Errorf("ran %d queries, want 2", len(influx.ran()))
+	}
+
+	influx.err = errors.New("InfluxDB down")
+	if response := ask(map[string]interface{}{"limit": 1.0}); response.Status != "error" || ask(map[string]interface{}{"limit": 1.0}).Cached {
+		t.Error("error response cached")
+	}
+}
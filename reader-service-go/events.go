@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultEventsSince is the window of events_by_type, a day as for the daily report
+const defaultEventsSince = 24 * time.Hour
+
+var eventsByTypeParams = withPaging(
+	paramSpec{name: "since", kind: paramDuration},
+	paramSpec{name: "since_minutes", kind: paramInt, positive: true},
+	paramSpec{name: "source_device", kind: paramString},
+)
+
+// eventsByTypeFlux counts the events per event type and device, in InfluxDB rather than in
+// the reader. An empty source_device counts the events of all devices.
+const eventsByTypeFlux = `from(bucket: params.bucket)
+  |> range(start: params.start, stop: params.stop)
+  |> filter(fn: (r) => r._measurement == "events" and r._field == "event_message")
+  |> filter(fn: (r) => params.source_device == "" or r.source_device == params.source_device)
+  |> group(columns: ["event_type", "source_device"])
+  |> count()
+  |> group()`
+
+// eventsByType answers events_by_type: a page of the numbers of events per event type and
+// device over the last since (a duration, default 24h), of all devices or of source_device
+// only, sorted by device and type. Pairs without events are left out; the client pivots the
+// counts. The client sends the window as since_minutes, which is taken too.
+func (r *reader) eventsByType(ctx context.Context, params map[string]interface{}) (ReaderResponse, error) {
+	since, err := eventsSince(params)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	device, err := stringParam(params, "source_device", "")
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	p, err := pageParams(params)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	records, err := r.records(ctx, eventsByTypeFlux, map[string]interface{}{
+		"start":         p.now.Add(-since),
+		"stop":          p.now,
+		"source_device": device,
+	})
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+
+	type eventCount struct {
+		device, eventType string
+		count             int64
+	}
+	counts := make([]eventCount, 0, len(records))
+	for _, rec := range records {
+		if n, ok := rec.Value().(int64); ok {
+			counts = append(counts, eventCount{device: tag(rec, "source_device"), eventType: tag(rec, "event_type"), count: n})
+		}
+	}
+	slices.SortFunc(counts, func(a, b eventCount) int {
+		if c := strings.Compare(a.device, b.device); c != 0 {
+			return c
+		}
+		return strings.Compare(a.eventType, b.eventType)
+	})
+	rows := make([]map[string]interface{}, 0, len(counts))
+	for _, c := range counts {
+		rows = append(rows, map[string]interface{}{"source_device": c.device, "event_type": c.eventType, "count": c.count})
+	}
+	return slicePage(p, rows), nil
+}
+
+// eventsSince returns the window of events_by_type, given as the duration since or in whole
+// minutes as since_minutes, but not both
+func eventsSince(params map[string]interface{}) (time.Duration, error) {
+	sinceParam, err := stringParam(params, "since", "")
+	if err != nil {
+		return 0, err
+	}
+	if params["since_minutes"] != nil {
+		if sinceParam != "" {
+			return 0, fmt.Errorf("since: cannot be combined with since_minutes")
+		}
+		minutes, err := intParam(params, "since_minutes", 0)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(minutes) * time.Minute, nil
+	}
+	if sinceParam == "" {
+		return defaultEventsSince, nil
+	}
+	since, err := time.ParseDuration(sinceParam)
+	if err != nil {
+		return 0, fmt.Errorf("since: %w", err)
+	}
+	return since, nil
+}
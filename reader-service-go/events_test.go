@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventsByType(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     map[string]interface{}
+		result     string
+		wantParams string // Of the query, see formatParams
+		want       string // device/type=count, in order
+		wantErr    string
+	}{
+		{
+			name:   "grouped by device and type",
+			params: map[string]interface{}{},
+			result: fluxTable(eventTypeColumns,
+				"Storage-02,PowerLoss,1", "Storage-01,Overheating,4", "Storage-02,Overheating,2", "Storage-01,DiskFailure,1"),
+			wantParams: ` bucket="events" source_device="" start="now-24h0m0s" stop="now"`,
+			want:       "Storage-01/DiskFailure=1 Storage-01/Overheating=4 Storage-02/Overheating=2 Storage-02/PowerLoss=1",
+		},
+		{
+			name:       "one device",
+			params:     map[string]interface{}{"since": "6h", "source_device": "Storage-02"},
+			result:     fluxTable(eventTypeColumns, "Storage-02,PowerLoss,1", "Storage-02,Overheating,2"),
+			wantParams: ` bucket="events" source_device="Storage-02" start="now-6h0m0s" stop="now"`,
+			want:       "Storage-02/Overheating=2 Storage-02/PowerLoss=1",
+		},
+		{
+			name:       "since_minutes of the client",
+			params:     map[string]interface{}{"since_minutes": 90.0},
+			result:     emptyResult,
+			wantParams: ` bucket="events" source_device="" start="now-1h30m0s" stop="now"`,
+		},
+		{
+			name:       "empty bucket",
+			params:     map[string]interface{}{},
+			result:     emptyResult,
+			wantParams: ` bucket="events" source_device="" start="now-24h0m0s" stop="now"`,
+		},
+		{
+			name:    "since and since_minutes",
+			params:  map[string]interface{}{"since": "1h", "since_minutes": 60.0},
+			wantErr: "since: cannot be combined with since_minutes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			influx := &fakeInflux{results: map[string]string{eventsByTypeFlux: tt.result}}
+			now := time.Now()
+			response := newTestReader(t, influx).handle(context.Background(), ReaderRequest{QueryType: "events_by_type", Params: tt.params}, now)
+			if tt.wantErr != "" {
+				if response.Status != "error" || !strings.Contains(response.Message, tt.wantErr) {
+					t.Fatalf("response %+v, want an error containing %q", response, tt.wantErr)
+				}
+				return
+			}
+			if response.Status != "success" {
+				t.Fatalf("response %+v, want success", response)
+			}
+			if got := formatParams(influx.ran()[0].params, now); got != tt.wantParams {
+				t.Errorf("params%s, want%s", got, tt.wantParams)
+			}
+			rows, ok := response.Data.([]map[string]interface{})
+			if !ok {
+				t.Fatalf("data %#v, want an array", response.Data)
+			}
+			var counts []string
+			for _, row := range rows {
+				if len(row) != 3 {
+					t.Errorf("row %v, want source_device, event_type and count", row)
+				}
+				counts = append(counts, fmt.Sprintf("%s/%s=%d", row["source_device"], row["event_type"], row["count"]))
+			}
+			if got := strings.Join(counts, " "); got != tt.want {
+				t.Errorf("counts %s, want %s", got, tt.want)
+			}
+			if body, _ := json.Marshal(response); len(rows) == 0 && !strings.Contains(string(body), `"data":[]`) {
+				t.Errorf("response %s, want an empty array as data", body)
+			}
+			if response.TotalCount == nil || *response.TotalCount != len(rows) {
+				t.Errorf("total_count %v, want %d", response.TotalCount, len(rows))
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+module reader-service-go
+
+go 1.24.3
+
+require (
+	github.com/influxdata/influxdb-client-go/v2 v2.14.0
+	github.com/nats-io/nats.go v1.43.0
+)
+
+require (
+	github.com/apapsch/go-jsonmerge/v2 v2.0.0 // indirect
+	github.com/google/uuid v1.3.1 // indirect
+	github.com/influxdata/line-protocol v0.0.0-20200327222509-2487e7298839 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/nats-io/nkeys v0.4.11 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/oapi-codegen/runtime v1.0.0 // indirect
+	golang.org/x/crypto v0.37.0 // indirect
+	golang.org/x/net v0.23.0 // indirect
+	golang.org/x/sys v0.32.0 // indirect
+)
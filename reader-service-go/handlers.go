@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strconv"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+)
+
+const ackMeasurement = "acknowledgments" // Measurement the writer stores acknowledgments in
+
+// Params of alerts_critical
+const (
+	defaultSinceMinutes   = 15
+	defaultMinCriticality = 8
+	maxCriticality        = 10 // The daemon's events are critical from 1 to 10
+)
+
+var alertsCriticalParams = withPaging(
+	paramSpec{name: "since_minutes", kind: paramInt, positive: true},
+	paramSpec{name: "min_criticality", kind: paramInt, positive: true, max: maxCriticality},
+)
+
+// alertsCriticalFlux selects a page of the events at or above a criticality, newest first.
+// The criticality is stored as the tag criticality_level, a string, so it is converted before
+// comparing; the events' messages are their event_message field. The range stops at the now
+// of the first page, so that events arriving meanwhile do not shift the later pages.
+const alertsCriticalFlux = `from(bucket: params.bucket)
+  |> range(start: params.start, stop: params.stop)
+  |> filter(fn: (r) => r._measurement == "events" and r._field == "event_message")
+  |> filter(fn: (r) => int(v: r.criticality_level) >= params.min_criticality)
+  |> group()
+  |> sort(columns: ["_time", "event_id"], desc: true)
+  |> limit(n: params.limit, offset: params.offset)`
+
+// alertsPerDeviceFlux counts the events alertsCriticalFlux selects per device, over all pages
+const alertsPerDeviceFlux = `from(bucket: params.bucket)
+  |> range(start: params.start, stop: params.stop)
+  |> filter(fn: (r) => r._measurement == "events" and r._field == "event_message")
+  |> filter(fn: (r) => int(v: r.criticality_level) >= params.min_criticality)
+  |> group(columns: ["source_device"])
+  |> count()
+  |> group()`
+
+// alertsCritical answers alerts_critical: a page of the events of the last since_minutes
+// (default 15) at or above min_criticality (default 8, 1 to 10), newest first, with the
+// number of them per device over all pages as summary and their sum as total_count
+func (r *reader) alertsCritical(ctx context.Context, params map[string]interface{}) (ReaderResponse, error) {
+	sinceMinutes, err := intParam(params, "since_minutes", defaultSinceMinutes)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	threshold, err := intParam(params, "min_criticality", defaultMinCriticality)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	p, err := pageParams(params)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	window := map[string]interface{}{
+		"start":           p.now.Add(-time.Duration(sinceMinutes) * time.Minute),
+		"stop":            p.now,
+		"min_criticality": threshold,
+	}
+	records, err := r.records(ctx, alertsCriticalFlux, p.fluxParams(maps.Clone(window)))
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	counts, err := r.records(ctx, alertsPerDeviceFlux, window)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(records))
+	for _, rec := range records {
+		level, _ := strconv.Atoi(tag(rec, "criticality_level"))
+		message, _ := rec.Value().(string)
+		rows = append(rows, map[string]interface{}{
+			"event_id":      tag(rec, "event_id"),
+			"timestamp":     rec.Time().UTC().Format(time.RFC3339Nano),
+			"source_device": tag(rec, "source_device"),
+			"event_type":    tag(rec, "event_type"),
+			"criticality":   level,
+			"event_message": message,
+		})
+	}
+	perDevice := map[string]int64{}
+	total := 0
+	for _, rec := range counts {
+		if n, ok := rec.Value().(int64); ok {
+			perDevice[tag(rec, "source_device")] = n
+			total += int(n)
+		}
+	}
+	devices := make([]string, 0, len(perDevice))
+	for device := range perDevice {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	summary := make([]map[string]interface{}, 0, len(devices))
+	for _, device := range devices {
+		summary = append(summary, map[string]interface{}{"source_device": device, "critical_event_count": perDevice[device]})
+	}
+
+	response := respondPage(p, rows)
+	response.Summary = summary
+	response.TotalCount = &total
+	return response, nil
+}
+
+// deviceMetricsFlux selects the readings of a metric of a device, oldest first
+const deviceMetricsFlux = `from(bucket: params.bucket)
+  |> range(start: params.start)
+  |> filter(fn: (r) => r._measurement == "device_metrics" and r._field == "value")
+  |> filter(fn: (r) => r.source_device == params.source_device and r.metric_type == params.metric_type)
+  |> group()
+  |> sort(columns: ["_time"])`
+
+var metricSummaryParams = []paramSpec{
+	{name: "source_device", kind: paramString, required: true},
+	{name: "metric_type", kind: paramString, required: true},
+	{name: "window_minutes", kind: paramInt, positive: true},
+}
+
+// metricSummary answers metric_summary: count, min, max, mean and last value of a metric of
+// a device in the last window_minutes (default 60), or "no data"
+func (r *reader) metricSummary(ctx context.Context, params map[string]interface{}) (ReaderResponse, error) {
+	device, err := requiredString(params, "source_device")
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	metric, err := requiredString(params, "metric_type")
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	window, err := intParam(params, "window_minutes", 60)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	samples, err := r.metricSamples(ctx, device, metric, time.Duration(window)*time.Minute)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	if len(samples) == 0 {
+		return success("no data"), nil
+	}
+	minimum, maximum, sum := samples[0].value, samples[0].value, 0.0
+	for _, s := range samples {
+		minimum, maximum, sum = min(minimum, s.value), max(maximum, s.value), sum+s.value
+	}
+	return success(map[string]interface{}{
+		"device": device,
+		"metric": metric,
+		"count":  len(samples),
+		"min":    minimum,
+		"max":    maximum,
+		"mean":   sum / float64(len(samples)),
+		"last":   samples[len(samples)-1].value,
+	}), nil
+}
+
+// sample is a reading of a metric
+type sample struct {
+	at    time.Time
+	value float64
+}
+
+// metricSamples returns the readings of a metric of a device within the window, oldest first
+func (r *reader) metricSamples(ctx context.Context, device, metric string, window time.Duration) ([]sample, error) {
+	records, err := r.records(ctx, deviceMetricsFlux, map[string]interface{}{
+		"start":         time.Now().Add(-window),
+		"source_device": device,
+		"metric_type":   metric,
+	})
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]sample, 0, len(records))
+	for _, rec := range records {
+		if v, ok := rec.Value().(float64); ok {
+			samples = append(samples, sample{at: rec.Time(), value: v})
+		}
+	}
+	return samples, nil
+}
+
+// deviceListFlux lists the devices that have published metrics within the bucket's retention.
+// schema.tagValues only looks back 30 days unless given a start, so deviceList passes the
+// start of the epoch.
+const deviceListFlux = `import "influxdata/influxdb/schema"
+
+schema.tagValues(bucket: params.bucket, tag: "source_device", predicate: (r) => r._measurement == "device_metrics", start: params.start)`
+
+var deviceListParams = withPaging()
+
+// deviceList answers device_list: a page of the names of the devices, sorted
+func (r *reader) deviceList(ctx context.Context, params map[string]interface{}) (ReaderResponse, error) {
+	p, err := pageParams(params)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	records, err := r.records(ctx, deviceListFlux, map[string]interface{}{"start": time.Unix(0, 0).UTC()})
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	devices := make([]string, 0, len(records))
+	for _, rec := range records {
+		if device, ok := rec.Value().(string); ok {
+			devices = append(devices, device)
+		}
+	}
+	sort.Strings(devices)
+	return slicePage(p, devices), nil
+}
+
+var acknowledgeParams = []paramSpec{
+	{name: "event_id", kind: paramString, required: true},
+	{name: "acknowledged_by", kind: paramString, required: true},
+	{name: "note", kind: paramString},
+	{name: "timestamp", kind: paramTimestamp, required: true},
+}
+
+// acknowledge answers acknowledge: records an operator's acknowledgment of an event as the
+// writer does from events.ack, the same point, so that whichever arrives second overwrites
+// the first, and returns it
+func (r *reader) acknowledge(ctx context.Context, params map[string]interface{}) (ReaderResponse, error) {
+	var problems []error
+	eventID, err := requiredString(params, "event_id")
+	problems = append(problems, err)
+	by, err := requiredString(params, "acknowledged_by")
+	problems = append(problems, err)
+	note, err := stringParam(params, "note", "")
+	problems = append(problems, err)
+	timestamp, err := requiredString(params, "timestamp")
+	problems = append(problems, err)
+	if err := errors.Join(problems...); err != nil {
+		return ReaderResponse{}, err
+	}
+	at, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return ReaderResponse{}, fmt.Errorf("timestamp: expected RFC 3339, got %q", timestamp)
+	}
+
+	p := influxdb2.NewPointWithMeasurement(ackMeasurement).
+		AddTag("event_id", eventID).
+		AddField("acknowledged_by", by).
+		AddField("note", note).
+		SetTime(at)
+	if err := r.writes.WritePoint(ctx, p); err != nil {
+		return ReaderResponse{}, fmt.Errorf("writing the acknowledgment to InfluxDB: %w", err)
+	}
+	return success(map[string]interface{}{
+		"event_id":        eventID,
+		"acknowledged_by": by,
+		"note":            note,
+		"timestamp":       timestamp,
+	}), nil
+}
+
+// tag returns a tag of a record, or "" when it has none
+func tag(rec *query.FluxRecord, name string) string {
+	s, _ := rec.ValueByKey(name).(string)
+	return s
+}
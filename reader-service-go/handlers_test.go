@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// Columns of the recorded results
+var (
+	alertColumns       = []string{"_time:dateTime:RFC3339", "_value:string", "event_id:string", "source_device:string", "event_type:string", "criticality_level:string"}
+	deviceCountColumns = []string{"source_device:string", "_value:long"}
+	readingColumns     = []string{"_time:dateTime:RFC3339", "_value:double"}
+	latestColumns      = []string{"_time:dateTime:RFC3339", "_value:double", "metric_type:string"}
+	countColumns       = []string{"_value:long"}
+	tagValueColumns    = []string{"_value:string"}
+	scoreColumns       = []string{"source_device:string", "_value:double"}
+	eventTypeColumns   = []string{"source_device:string", "event_type:string", "_value:long"}
+)
+
+// TestHandlers runs a request of each query type against recorded results, pinning the Flux
+// queries it runs, their params and its response in testdata/handlers/<query type>.golden.
+// Params that are times are shown relative to now, or as timestamps when long past.
+func TestHandlers(t *testing.T) {
+	tests := []struct {
+		queryType string
+		params    map[string]interface{}
+		results   map[string]string
+	}{
+		{
+			queryType: "alerts_critical",
+			params:    map[string]interface{}{"since_minutes": 30.0, "min_criticality": 9.0},
+			results: map[string]string{
+				alertsCriticalFlux: fluxTable(alertColumns,
+					"2026-10-16T10:05:00Z,Disk failure,ev-2,Storage-02,HardwareFailure,10",
+					"2026-10-16T10:01:00Z,Controller overheating,ev-1,Storage-01,Overheating,9"),
+				alertsPerDeviceFlux: fluxTable(deviceCountColumns, "Storage-02,1", "Storage-01,1"),
+			},
+		},
+		{
+			queryType: "device_health",
+			params:    map[string]interface{}{"source_device": "Storage-01"},
+			results: map[string]string{
+				latestMetricsFlux: fluxTable(latestColumns,
+					"2026-10-16T10:00:00Z,41.5,DiskTemp",
+					"2026-10-16T10:00:00Z,9.2,Latency",
+					"2026-10-16T10:00:00Z,1200,IOPs"),
+				deviceEventsFlux: fluxTable(countColumns, "3"),
+			},
+		},
+		{
+			queryType: "anomaly_temperature",
+			params:    map[string]interface{}{"source_device": "Storage-01", "threshold": 1.5},
+			results: map[string]string{
+				deviceMetricsFlux: fluxTable(readingColumns,
+					"2026-10-16T10:00:00Z,40",
+					"2026-10-16T10:01:00Z,40",
+					"2026-10-16T10:02:00Z,40",
+					"2026-10-16T10:03:00Z,40",
+					"2026-10-16T10:04:00Z,60"),
+			},
+		},
+		{
+			queryType: "metric_summary",
+			params:    map[string]interface{}{"source_device": "Storage-01", "metric_type": "Latency", "window_minutes": 30.0},
+			results: map[string]string{
+				deviceMetricsFlux: fluxTable(readingColumns,
+					"2026-10-16T10:00:00Z,4",
+					"2026-10-16T10:01:00Z,8",
+					"2026-10-16T10:02:00Z,6"),
+			},
+		},
+		{
+			queryType: "device_list",
+			params:    map[string]interface{}{},
+			results: map[string]string{
+				deviceListFlux: fluxTable(tagValueColumns, "Storage-02", "Storage-01", "Storage-03"),
+			},
+		},
+		{
+			queryType: "top_devices",
+			params:    map[string]interface{}{"metric_type": "DiskTemp", "limit": 2.0},
+			results: map[string]string{
+				fmt.Sprintf(topDevicesFlux, topAggregations["max"]): fluxTable(scoreColumns, "Storage-01,45", "Storage-02,52", "Storage-03,38"),
+			},
+		},
+		{
+			queryType: "metric_timeseries",
+			params:    map[string]interface{}{"source_device": "Storage-01", "metric_type": "IOPs", "start": "-10m", "every": "5m"},
+			results: map[string]string{
+				metricTimeseriesFlux: fluxTable(readingColumns, "2026-10-16T10:05:00Z,1100", "2026-10-16T10:10:00Z,1250.5"),
+			},
+		},
+		{
+			queryType: "events_by_type",
+			params:    map[string]interface{}{"since": "2h"},
+			results: map[string]string{
+				eventsByTypeFlux: fluxTable(eventTypeColumns, "Storage-02,Overheating,2", "Storage-01,PowerLoss,1", "Storage-01,Overheating,4"),
+			},
+		},
+		{
+			queryType: "acknowledge",
+			params: map[string]interface{}{
+				"event_id": "ev-1", "acknowledged_by": "oncall", "note": "replacing the fan", "timestamp": "2026-10-16T10:30:00Z",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.queryType, func(t *testing.T) {
+			influx := &fakeInflux{results: tt.results}
+			writer := &fakeWriter{}
+			r := newTestReader(t, influx)
+			r.writes = writer
+
+			now := time.Now()
+			response := r.handle(context.Background(), ReaderRequest{QueryType: tt.queryType, Params: tt.params}, now)
+			if response.Status != "success" {
+				t.Fatalf("response %+v, want success", response)
+			}
+
+			var b strings.Builder
+			for i, call := range influx.ran() {
+				fmt.Fprintf(&b, "query %d:\n%s\nparams:%s\n\n", i+1, call.flux, formatParams(call.params, now))
+			}
+			for _, p := range writer.points {
+				fmt.Fprintf(&b, "point:\n%s\n", write.PointToLineProtocol(p, time.Second))
+			}
+			body, err := json.MarshalIndent(response, "", "  ")
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			fmt.Fprintf(&b, "response:\n%s\n", body)
+			checkGolden(t, "handlers/"+tt.queryType+".golden", b.String())
+		})
+	}
+}
+
+// formatParams renders Flux params sorted by name, times relative to now rounded to the
+// minute, or as timestamps before 2000
+func formatParams(params map[string]interface{}, now time.Time) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		v := params[name]
+		if at, ok := v.(time.Time); ok {
+			switch ago := now.Sub(at).Round(time.Minute); {
+			case at.Year() < 2000:
+				v = at.UTC().Format(time.RFC3339)
+			case ago == 0:
+				v = "now"
+			default:
+				v = "now-" + ago.String()
+			}
+		}
+		fmt.Fprintf(&b, " %s=%#v", name, v)
+	}
+	return b.String()
+}
+
+func TestAlertsCritical(t *testing.T) {
+	tests := []struct {
+		name      string
+		params    map[string]interface{}
+		alerts    string
+		counts    string
+		wantIDs   []string
+		wantTotal int
+		wantError []string // Params of the validation errors
+		wantQuery string   // Params of the page query, see formatParams
+	}{
+		{
+			name:      "defaults",
+			params:    map[string]interface{}{},
+			alerts:    emptyResult,
+			counts:    emptyResult,
+			wantIDs:   []string{},
+			wantQuery: ` bucket="events" limit=501 min_criticality=8 offset=0 start="now-15m0s" stop="now"`,
+		},
+		{
+			name:   "newest first as sorted by the query",
+			params: map[string]interface{}{"min_criticality": 8.0},
+			alerts: fluxTable(alertColumns,
+				"2026-10-16T10:09:00Z,c,ev-3,Storage-01,Overheating,8",
+				"2026-10-16T10:09:00Z,b,ev-2,Storage-02,PowerLoss,10",
+				"2026-10-16T10:01:00Z,a,ev-1,Storage-01,Overheating,9"),
+			counts:    fluxTable(deviceCountColumns, "Storage-02,1", "Storage-01,2"),
+			wantIDs:   []string{"ev-3", "ev-2", "ev-1"},
+			wantTotal: 3,
+		},
+		{name: "negative window", params: map[string]interface{}{"since_minutes": -5.0}, wantError: []string{"since_minutes"}},
+		{name: "criticality above 10", params: map[string]interface{}{"min_criticality": 11.0}, wantError: []string{"min_criticality"}},
+		{name: "both out of range", params: map[string]interface{}{"since_minutes": 0.0, "min_criticality": 0.0}, wantError: []string{"min_criticality", "since_minutes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			influx := &fakeInflux{results: map[string]string{alertsCriticalFlux: tt.alerts, alertsPerDeviceFlux: tt.counts}}
+			now := time.Now()
+			response := newTestReader(t, influx).handle(context.Background(), ReaderRequest{QueryType: "alerts_critical", Params: tt.params}, now)
+
+			if tt.wantError != nil {
+				if response.Status != "error" || len(response.Errors) != len(tt.wantError) {
+					t.Fatalf("response %+v, want errors for %v", response, tt.wantError)
+				}
+				for i, param := range tt.wantError {
+					if response.Errors[i].Param != param {
+						t.Errorf("error %d is about %s, want %s", i, response.Errors[i].Param, param)
+					}
+				}
+				if len(influx.ran()) != 0 {
+					t.Errorf("ran %d queries for invalid params", len(influx.ran()))
+				}
+				return
+			}
+			if response.Status != "success" {
+				t.Fatalf("response %+v, want success", response)
+			}
+			rows := response.Data.([]map[string]interface{})
+			ids := make([]string, len(rows))
+			for i, row := range rows {
+				ids[i] = row["event_id"].(string)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("events %v, want %v", ids, tt.wantIDs)
+			}
+			if response.TotalCount == nil || *response.TotalCount != tt.wantTotal {
+				t.Errorf("total_count %v, want %d", response.TotalCount, tt.wantTotal)
+			}
+			if summary := response.Summary.([]map[string]interface{}); len(summary) > 0 && summary[0]["source_device"] != "Storage-01" {
+				t.Errorf("summary %v, want the devices sorted by name", summary)
+			}
+			if got := formatParams(influx.ran()[0].params, now); tt.wantQuery != "" && got != tt.wantQuery {
+				t.Errorf("page query params%s, want%s", got, tt.wantQuery)
+			}
+		})
+	}
+}
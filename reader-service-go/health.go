@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultHealthThresholds rates the metrics of the daemon's default ranges: the hottest and
+// slowest disks and the fullest arrays. IOPs has no threshold, more of them is not worse.
+const defaultHealthThresholds = "DiskTemp:50:55,Latency:8:10,CapacityUsed:85:92"
+
+// Windows of device_health: readings older than healthLookback do not count, and the events
+// of the device are counted over healthEventsWindow
+const (
+	healthLookback     = time.Hour
+	healthEventsWindow = time.Hour
+)
+
+// Health statuses, from best to worst; unknown is a device without readings
+var healthRanks = map[string]int{"unknown": 0, "ok": 1, "warn": 2, "critical": 3}
+
+// healthThreshold rates the readings of a metric: at or above warning it is warn, at or
+// above critical critical.
+type healthThreshold struct {
+	warning  float64
+	critical float64
+}
+
+// healthThresholds are the thresholds of the rated metric types, by metric type.
+type healthThresholds map[string]healthThreshold
+
+// Parses a threshold table such as "DiskTemp:50:55,Latency:8:10" (HEALTH_THRESHOLDS); "none"
+// rates every reading ok
+func parseHealthThresholds(spec string) (healthThresholds, error) {
+	table := healthThresholds{}
+	spec = strings.TrimSpace(spec)
+	if spec == "" || strings.EqualFold(spec, "none") {
+		return table, nil
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("entry %q: expected <metricType>:<warning>:<critical>", entry)
+		}
+		warning, err1 := strconv.ParseFloat(parts[1], 64)
+		critical, err2 := strconv.ParseFloat(parts[2], 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("entry %q: thresholds must be numbers", entry)
+		}
+		if warning > critical {
+			return nil, fmt.Errorf("entry %q: the warning threshold must not exceed the critical one", entry)
+		}
+		table[parts[0]] = healthThreshold{warning: warning, critical: critical}
+	}
+	return table, nil
+}
+
+// rate returns the health of a reading of a metric; metrics without a threshold are ok
+func (t healthThresholds) rate(metricType string, value float64) string {
+	threshold, ok := t[metricType]
+	switch {
+	case !ok:
+		return "ok"
+	case value >= threshold.critical:
+		return "critical"
+	case value >= threshold.warning:
+		return "warn"
+	}
+	return "ok"
+}
+
+// latestMetricsFlux selects the latest reading of every series of a device's metrics; a
+// metric type has several series when e.g. the device's firmware changed
+const latestMetricsFlux = `from(bucket: params.bucket)
+  |> range(start: params.start)
+  |> filter(fn: (r) => r._measurement == "device_metrics" and r._field == "value")
+  |> filter(fn: (r) => r.source_device == params.source_device)
+  |> last()`
+
+// deviceEventsFlux counts the events of a device
+const deviceEventsFlux = `from(bucket: params.bucket)
+  |> range(start: params.start)
+  |> filter(fn: (r) => r._measurement == "events" and r._field == "event_message")
+  |> filter(fn: (r) => r.source_device == params.source_device)
+  |> group()
+  |> count()`
+
+var deviceHealthParams = []paramSpec{
+	{name: "source_device", kind: paramString, required: true},
+}
+
+// deviceHealth answers device_health: the latest reading of each metric of a device within
+// healthLookback, rated by the thresholds, the number of its events within healthEventsWindow
+// and its health, the worst rating of its readings, or unknown without any readings
+func (r *reader) deviceHealth(ctx context.Context, params map[string]interface{}) (ReaderResponse, error) {
+	device, err := requiredString(params, "source_device")
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	now := time.Now()
+	records, err := r.records(ctx, latestMetricsFlux, map[string]interface{}{
+		"start":         now.Add(-healthLookback),
+		"source_device": device,
+	})
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	type reading struct {
+		value float64
+		at    time.Time
+	}
+	latest := map[string]reading{}
+	for _, rec := range records {
+		value, ok := rec.Value().(float64)
+		if !ok {
+			continue
+		}
+		metricType := tag(rec, "metric_type")
+		if prev, seen := latest[metricType]; !seen || rec.Time().After(prev.at) {
+			latest[metricType] = reading{value: value, at: rec.Time()}
+		}
+	}
+
+	events, err := r.records(ctx, deviceEventsFlux, map[string]interface{}{
+		"start":         now.Add(-healthEventsWindow),
+		"source_device": device,
+	})
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	eventCount := int64(0)
+	for _, rec := range events {
+		if n, ok := rec.Value().(int64); ok {
+			eventCount += n
+		}
+	}
+
+	metricTypes := make([]string, 0, len(latest))
+	for metricType := range latest {
+		metricTypes = append(metricTypes, metricType)
+	}
+	sort.Strings(metricTypes)
+	health := "unknown"
+	metrics := make([]map[string]interface{}, 0, len(metricTypes))
+	for _, metricType := range metricTypes {
+		rd := latest[metricType]
+		rating := r.thresholds.rate(metricType, rd.value)
+		if healthRanks[rating] > healthRanks[health] {
+			health = rating
+		}
+		metrics = append(metrics, map[string]interface{}{
+			"metric_type": metricType,
+			"value":       rd.value,
+			"timestamp":   rd.at.UTC().Format(time.RFC3339Nano),
+			"health":      rating,
+		})
+	}
+	return success(map[string]interface{}{
+		"device":           device,
+		"health":           health,
+		"events_last_hour": eventCount,
+		"metrics":          metrics,
+	}), nil
+}
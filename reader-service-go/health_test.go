@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeviceHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		readings   string
+		events     string
+		wantHealth string
+		wantRates  map[string]string // By metric type
+		wantEvents int64
+	}{
+		{
+			name: "healthy",
+			readings: fluxTable(latestColumns,
+				"2026-10-16T10:00:00Z,38,DiskTemp",
+				"2026-10-16T10:00:00Z,3.5,Latency",
+				"2026-10-16T10:00:00Z,60,CapacityUsed"),
+			events:     fluxTable(countColumns, "0"),
+			wantHealth: "ok",
+			wantRates:  map[string]string{"DiskTemp": "ok", "Latency": "ok", "CapacityUsed": "ok"},
+		},
+		{
+			name: "hot",
+			readings: fluxTable(latestColumns,
+				"2026-10-16T10:00:00Z,56.5,DiskTemp",
+				"2026-10-16T10:00:00Z,8.5,Latency"),
+			events:     fluxTable(countColumns, "7"),
+			wantHealth: "critical",
+			wantRates:  map[string]string{"DiskTemp": "critical", "Latency": "warn"},
+			wantEvents: 7,
+		},
+		{
+			name: "latest series wins",
+			readings: fluxTable(latestColumns,
+				"2026-10-16T09:00:00Z,57,DiskTemp",
+				"2026-10-16T10:00:00Z,51,DiskTemp"),
+			events:     emptyResult,
+			wantHealth: "warn",
+			wantRates:  map[string]string{"DiskTemp": "warn"},
+		},
+		{
+			name:       "unknown",
+			readings:   emptyResult,
+			events:     emptyResult,
+			wantHealth: "unknown",
+			wantRates:  map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			influx := &fakeInflux{results: map[string]string{latestMetricsFlux: tt.readings, deviceEventsFlux: tt.events}}
+			response := newTestReader(t, influx).handle(context.Background(),
+				ReaderRequest{QueryType: "device_health", Params: map[string]interface{}{"source_device": "Storage-01"}}, time.Now())
+			if response.Status != "success" {
+				t.Fatalf("response %+v, want success", response)
+			}
+			data := response.Data.(map[string]interface{})
+			if data["health"] != tt.wantHealth || data["events_last_hour"] != tt.wantEvents || data["device"] != "Storage-01" {
+				t.Errorf("health %v with %v event(s) for %v, want %s with %d", data["health"], data["events_last_hour"], data["device"], tt.wantHealth, tt.wantEvents)
+			}
+			metrics := data["metrics"].([]map[string]interface{})
+			if len(metrics) != len(tt.wantRates) {
+				t.Fatalf("%d metric(s), want %d", len(metrics), len(tt.wantRates))
+			}
+			for _, m := range metrics {
+				if want := tt.wantRates[m["metric_type"].(string)]; m["health"] != want {
+					t.Errorf("%s rated %v, want %s", m["metric_type"], m["health"], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseHealthThresholds(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    healthThresholds
+		wantErr bool
+	}{
+		{spec: "DiskTemp:50:55", want: healthThresholds{"DiskTemp": {warning: 50, critical: 55}}},
+		{spec: " DiskTemp:50:55, Latency:8.5:10 ", want: healthThresholds{"DiskTemp": {50, 55}, "Latency": {8.5, 10}}},
+		{spec: "none", want: healthThresholds{}},
+		{spec: "", want: healthThresholds{}},
+		{spec: "DiskTemp:50", wantErr: true},
+		{spec: ":50:55", wantErr: true},
+		{spec: "DiskTemp:hot:55", wantErr: true},
+		{spec: "DiskTemp:55:50", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseHealthThresholds(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseHealthThresholds(%q) = %v, want error %t", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseHealthThresholds(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+		for metricType, threshold := range tt.want {
+			if got[metricType] != threshold {
+				t.Errorf("parseHealthThresholds(%q)[%s] = %v, want %v", tt.spec, metricType, got[metricType], threshold)
+			}
+		}
+	}
+}
+
+func TestHealthThresholdsRate(t *testing.T) {
+	thresholds := healthThresholds{"DiskTemp": {warning: 50, critical: 55}}
+	for _, tt := range []struct {
+		metricType string
+		value      float64
+		want       string
+	}{
+		{"DiskTemp", 49.9, "ok"},
+		{"DiskTemp", 50, "warn"},
+		{"DiskTemp", 55, "critical"},
+		{"IOPs", 1e9, "ok"},
+	} {
+		if got := thresholds.rate(tt.metricType, tt.value); got != tt.want {
+			t.Errorf("rate(%s, %g) = %s, want %s", tt.metricType, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/nats-io/nats.go"
+)
+
+// Constants for default configuration
+const (
+	defaultNatsURL           = "nats://nats:4222"
+	defaultRequestSubject    = "reader.query"       // Subject the client sends its ReaderRequests to
+	defaultQueueGroup        = "reader_queue_group" // NATS queue group, so that replicas share the requests
+	defaultInfluxDBHost      = "http://influxdb:8086"
+	defaultMaxInFlight       = 16               // Requests handled at once; further ones wait in the subscription
+	defaultAnomalyMinSamples = 10               // Readings anomaly_temperature needs for a baseline
+	defaultQueryTimeout      = 8 * time.Second  // Below the client's 10s, so that the timeout reaches it
+	defaultStartupTimeout    = 2 * time.Minute  // How long NATS and InfluxDB are retried at startup
+	defaultShutdownTimeout   = 15 * time.Second // How long requests in flight may finish on shutdown
+	startupBackoff           = 500 * time.Millisecond
+	maxStartupBackoff        = 10 * time.Second
+)
+
+// config is the reader's configuration, read from the environment like the writer's.
+type config struct {
+	natsURL           string
+	subject           string
+	queueGroup        string
+	influxDBHost      string
+	influxDBToken     string
+	influxDBOrg       string
+	influxDBBucket    string
+	maxInFlight       int
+	thresholds        healthThresholds
+	anomalyMinSamples int
+	cacheTTLs         map[string]time.Duration
+	cacheSize         int
+	queryTimeout      time.Duration            // How long a request may take from its arrival
+	queryTimeouts     map[string]time.Duration // Overriding queryTimeout per query type
+	startupTimeout    time.Duration
+	shutdownTimeout   time.Duration
+}
+
+func init() {
+	// Configure logger to show file and line number for easier debugging
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	log.SetPrefix("Reader Service (Go): ")
+}
+
+func main() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Setup context for the startup, cancelled on the first shutdown signal
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		log.Println("Received shutdown signal. Initiating graceful shutdown...")
+		cancel()
+	}()
+
+	// 1. Connect to InfluxDB, waiting for it to become healthy
+	client := influxdb2.NewClient(cfg.influxDBHost, cfg.influxDBToken)
+	defer func() {
+		log.Println("Closing InfluxDB client...")
+		client.Close()
+	}()
+	err = retryStartup(ctx, "InfluxDB health check", cfg.startupTimeout, func() error {
+		health, err := client.Health(ctx)
+		if err != nil {
+			return err
+		}
+		if health.Status != "pass" {
+			return fmt.Errorf("status %s", health.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("InfluxDB at %s is not available: %v", cfg.influxDBHost, err)
+	}
+	log.Printf("Connected to InfluxDB at %s, Org: %s, Bucket: %s", cfg.influxDBHost, cfg.influxDBOrg, cfg.influxDBBucket)
+
+	// 2. Connect to NATS, retrying until the server is up
+	var nc *nats.Conn
+	err = retryStartup(ctx, "NATS connection", cfg.startupTimeout, func() error {
+		nc, err = nats.Connect(cfg.natsURL,
+			nats.Name("reader-service-go"),
+			nats.MaxReconnects(-1), // Once up, the reader outlives NATS outages
+			nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+				if err != nil {
+					log.Printf("Disconnected from NATS: %v", err)
+				}
+			}),
+			nats.ReconnectHandler(func(nc *nats.Conn) {
+				log.Printf("Reconnected to NATS at %s", nc.ConnectedUrl())
+			}),
+		)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to NATS at %s: %v", cfg.natsURL, err)
+	}
+	defer func() {
+		log.Println("Closing NATS connection...")
+		nc.Close()
+	}()
+	log.Printf("Connected to NATS at %s", nc.ConnectedUrl())
+
+	// 3. Subscribe to the request subject in the queue group. Requests are handled in their
+	// own goroutines, at most maxInFlight at once; the context of the handlers outlives the
+	// shutdown signal so that the requests in flight can finish. The timeout of a request
+	// counts from its arrival, waiting for a slot included.
+	r := newReader(client.QueryAPI(cfg.influxDBOrg), client.WriteAPIBlocking(cfg.influxDBOrg, cfg.influxDBBucket), cfg)
+	for queryType := range cfg.queryTimeouts {
+		if _, ok := r.handlers[queryType]; !ok {
+			log.Fatalf("Invalid configuration: QUERY_TIMEOUTS: unknown query type %s, supported: %s", queryType, r.supportedTypes())
+		}
+	}
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	defer cancelHandlers()
+	slots := make(chan struct{}, cfg.maxInFlight)
+	var inFlight sync.WaitGroup
+	sub, err := nc.QueueSubscribe(cfg.subject, cfg.queueGroup, func(m *nats.Msg) {
+		received := time.Now()
+		slots <- struct{}{}
+		inFlight.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				inFlight.Done()
+			}()
+			r.serve(handlerCtx, m, received)
+		}()
+	})
+	if err != nil {
+		log.Fatalf("Failed to subscribe to NATS subject '%s' with queue group '%s': %v", cfg.subject, cfg.queueGroup, err)
+	}
+	log.Printf("Subscribed to NATS subject '%s' in queue group '%s', serving %s. Waiting for requests...", cfg.subject, cfg.queueGroup, r.supportedTypes())
+
+	// Keep the service running until context is cancelled (e.g., by OS signal)
+	<-ctx.Done()
+
+	// Stop taking requests, leaving them to the other replicas, and let those in flight finish
+	if err := sub.Drain(); err != nil {
+		log.Printf("ERROR: Failed to drain the subscription to '%s': %v", cfg.subject, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		for sub.IsValid() {
+			time.Sleep(50 * time.Millisecond)
+		}
+		inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("All requests in flight were answered.")
+	case <-time.After(cfg.shutdownTimeout):
+		log.Printf("WARNING: Requests still in flight after %s are abandoned.", cfg.shutdownTimeout)
+		cancelHandlers()
+	}
+	log.Println("Shutting down.")
+}
+
+// loadConfig reads the configuration from the environment, applying the defaults
+func loadConfig() (config, error) {
+	cfg := config{
+		natsURL:           envOr("NATS_URL", defaultNatsURL),
+		subject:           envOr("NATS_SUBJECT_REQUEST", defaultRequestSubject),
+		queueGroup:        envOr("NATS_QUEUE_GROUP", defaultQueueGroup),
+		influxDBHost:      envOr("INFLUXDB_HOST", defaultInfluxDBHost),
+		influxDBToken:     os.Getenv("INFLUXDB_TOKEN"),
+		influxDBOrg:       os.Getenv("INFLUXDB_ORG"),
+		influxDBBucket:    os.Getenv("INFLUXDB_BUCKET"),
+		maxInFlight:       defaultMaxInFlight,
+		anomalyMinSamples: defaultAnomalyMinSamples,
+		cacheSize:         defaultCacheSize,
+		queryTimeout:      defaultQueryTimeout,
+		startupTimeout:    defaultStartupTimeout,
+		shutdownTimeout:   defaultShutdownTimeout,
+	}
+	if cfg.influxDBToken == "" || cfg.influxDBOrg == "" || cfg.influxDBBucket == "" {
+		return cfg, fmt.Errorf("InfluxDB token, organization, or bucket environment variables are not set. Please check your .env file.")
+	}
+	if v := os.Getenv("MAX_IN_FLIGHT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("MAX_IN_FLIGHT %q: must be a positive integer", v)
+		}
+		cfg.maxInFlight = n
+	}
+	if v := os.Getenv("ANOMALY_MIN_SAMPLES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 2 {
+			return cfg, fmt.Errorf("ANOMALY_MIN_SAMPLES %q: must be an integer of at least 2", v)
+		}
+		cfg.anomalyMinSamples = n
+	}
+	thresholds, err := parseHealthThresholds(envOr("HEALTH_THRESHOLDS", defaultHealthThresholds))
+	if err != nil {
+		return cfg, fmt.Errorf("HEALTH_THRESHOLDS: %w", err)
+	}
+	cfg.thresholds = thresholds
+	if cfg.cacheTTLs, err = parseQueryDurations(defaultCacheTTLs); err != nil {
+		return cfg, fmt.Errorf("default cache ttls: %w", err)
+	}
+	overrides, err := parseQueryDurations(os.Getenv("CACHE_TTLS"))
+	if err != nil {
+		return cfg, fmt.Errorf("CACHE_TTLS: %w", err)
+	}
+	for queryType, ttl := range overrides {
+		if _, ok := cfg.cacheTTLs[queryType]; !ok {
+			return cfg, fmt.Errorf("CACHE_TTLS: %s is not a cacheable query type, expected one of %s", queryType, strings.Join(sortedKeys(cfg.cacheTTLs), ", "))
+		}
+		cfg.cacheTTLs[queryType] = ttl
+	}
+	if v := os.Getenv("CACHE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("CACHE_SIZE %q: must be a non-negative integer, 0 disables the cache", v)
+		}
+		cfg.cacheSize = n
+	}
+	if cfg.queryTimeouts, err = parseQueryDurations(os.Getenv("QUERY_TIMEOUTS")); err != nil {
+		return cfg, fmt.Errorf("QUERY_TIMEOUTS: %w", err)
+	}
+	for queryType, timeout := range cfg.queryTimeouts {
+		if timeout <= 0 {
+			return cfg, fmt.Errorf("QUERY_TIMEOUTS: the timeout of %s must be positive", queryType)
+		}
+	}
+	for name, d := range map[string]*time.Duration{"STARTUP_TIMEOUT": &cfg.startupTimeout, "SHUTDOWN_TIMEOUT": &cfg.shutdownTimeout, "QUERY_TIMEOUT": &cfg.queryTimeout} {
+		if v := os.Getenv(name); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed <= 0 {
+				return cfg, fmt.Errorf("%s %q: must be a positive duration such as 30s", name, v)
+			}
+			*d = parsed
+		}
+	}
+	return cfg, nil
+}
+
+// parseQueryDurations parses the format of CACHE_TTLS and QUERY_TIMEOUTS, comma-separated
+// <queryType>:<duration> entries such as alerts_critical:5s
+func parseQueryDurations(spec string) (map[string]time.Duration, error) {
+	durations := map[string]time.Duration{}
+	spec = strings.TrimSpace(spec)
+	if spec == "" || strings.EqualFold(spec, "none") {
+		return durations, nil
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		queryType, duration, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || queryType == "" {
+			return nil, fmt.Errorf("entry %q: expected <queryType>:<duration>", entry)
+		}
+		d, err := time.ParseDuration(duration)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("entry %q: expected a duration such as 5s", entry)
+		}
+		durations[queryType] = d
+	}
+	return durations, nil
+}
+
+// envOr returns the environment variable name, or def when it is unset or empty
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// retryStartup calls attempt until it succeeds, with a delay doubling from startupBackoff up
+// to maxStartupBackoff, for at most timeout. Dependencies started alongside the reader, as in
+// docker-compose, may take a while to accept connections.
+func retryStartup(ctx context.Context, what string, timeout time.Duration, attempt func() error) error {
+	deadline := time.Now().Add(timeout)
+	backoff := startupBackoff
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("giving up after %d attempt(s) in %s: %w", n, timeout, err)
+		}
+		log.Printf("%s failed (attempt %d): %v. Retrying in %s...", what, n, err, backoff)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("interrupted after %d attempt(s): %w", n, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxStartupBackoff)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readerEnv are the variables loadConfig reads
+var readerEnv = []string{
+	"NATS_URL", "NATS_SUBJECT_REQUEST", "NATS_QUEUE_GROUP", "INFLUXDB_HOST", "INFLUXDB_TOKEN", "INFLUXDB_ORG", "INFLUXDB_BUCKET",
+	"MAX_IN_FLIGHT", "ANOMALY_MIN_SAMPLES", "HEALTH_THRESHOLDS", "CACHE_TTLS", "CACHE_SIZE", "QUERY_TIMEOUTS",
+	"STARTUP_TIMEOUT", "SHUTDOWN_TIMEOUT", "QUERY_TIMEOUT",
+}
+
+// setReaderEnv sets the reader's variables to env, the others to empty, for the test
+func setReaderEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, name := range readerEnv {
+		t.Setenv(name, env[name])
+	}
+}
+
+// influxEnv is the InfluxDB configuration the reader shares with the writer
+var influxEnv = map[string]string{"INFLUXDB_TOKEN": "token", "INFLUXDB_ORG": "org", "INFLUXDB_BUCKET": "events"}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	setReaderEnv(t, influxEnv)
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.natsURL != defaultNatsURL || cfg.subject != "reader.query" || cfg.queueGroup != defaultQueueGroup || cfg.influxDBHost != defaultInfluxDBHost {
+		t.Errorf("connections %+v, want the defaults", cfg)
+	}
+	if cfg.influxDBToken != "token" || cfg.influxDBOrg != "org" || cfg.influxDBBucket != "events" {
+		t.Errorf("InfluxDB configuration %+v, want the environment's", cfg)
+	}
+	if cfg.maxInFlight != defaultMaxInFlight || cfg.queryTimeout != defaultQueryTimeout || cfg.startupTimeout != defaultStartupTimeout || cfg.cacheTTLs["alerts_critical"] != 5*time.Second {
+		t.Errorf("limits %+v, want the defaults", cfg)
+	}
+
+	setReaderEnv(t, map[string]string{"INFLUXDB_TOKEN": "token", "INFLUXDB_ORG": "org", "INFLUXDB_BUCKET": "events",
+		"NATS_SUBJECT_REQUEST": "reader.staging", "QUERY_TIMEOUTS": "metric_timeseries:20s", "CACHE_TTLS": "alerts_critical:1s", "STARTUP_TIMEOUT": "5s"})
+	cfg, err = loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.subject != "reader.staging" || cfg.queryTimeouts["metric_timeseries"] != 20*time.Second || cfg.cacheTTLs["alerts_critical"] != time.Second || cfg.startupTimeout != 5*time.Second {
+		t.Errorf("configuration %+v, want the environment's", cfg)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name, value, want string
+	}{
+		{"INFLUXDB_TOKEN", "", "InfluxDB token, organization, or bucket"},
+		{"MAX_IN_FLIGHT", "0", `MAX_IN_FLIGHT "0": must be a positive integer`},
+		{"ANOMALY_MIN_SAMPLES", "1", `ANOMALY_MIN_SAMPLES "1"`},
+		{"HEALTH_THRESHOLDS", "DiskTemp", "HEALTH_THRESHOLDS: "},
+		{"CACHE_TTLS", "acknowledge:5s", "CACHE_TTLS: acknowledge is not a cacheable query type"},
+		{"CACHE_SIZE", "-1", `CACHE_SIZE "-1"`},
+		{"QUERY_TIMEOUTS", "device_list:0s", "QUERY_TIMEOUTS: the timeout of device_list must be positive"},
+		{"STARTUP_TIMEOUT", "forever", `STARTUP_TIMEOUT "forever": must be a positive duration`},
+		{"QUERY_TIMEOUT", "-1s", `QUERY_TIMEOUT "-1s"`},
+	}
+	for _, tt := range tests {
+		env := map[string]string{tt.name: tt.value}
+		for name, value := range influxEnv {
+			if name != tt.name {
+				env[name] = value
+			}
+		}
+		setReaderEnv(t, env)
+		if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s=%q: %v, want %q", tt.name, tt.value, err, tt.want)
+		}
+	}
+}
+
+func TestRetryStartup(t *testing.T) {
+	unavailable := errors.New("connection refused")
+	attempts := 0
+	start := time.Now()
+	err := retryStartup(context.Background(), "test", time.Minute, func() error {
+		if attempts++; attempts < 2 {
+			return unavailable
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("retryStartup = %v after %d attempt(s), want a success at the second", err, attempts)
+	}
+	if elapsed := time.Since(start); elapsed < startupBackoff {
+		t.Errorf("retried after %s, want a backoff of %s", elapsed, startupBackoff)
+	}
+
+	// A retry would end past the timeout
+	attempts = 0
+	err = retryStartup(context.Background(), "test", startupBackoff/2, func() error { attempts++; return unavailable })
+	if !errors.Is(err, unavailable) || attempts != 1 || !strings.Contains(err.Error(), "giving up after 1 attempt(s)") {
+		t.Errorf("retryStartup = %v after %d attempt(s), want it to give up", err, attempts)
+	}
+
+	// Interrupted by the shutdown signal while waiting to retry
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(startupBackoff/10, cancel)
+	start = time.Now()
+	err = retryStartup(ctx, "test", time.Minute, func() error { return unavailable })
+	if !errors.Is(err, unavailable) || !strings.Contains(err.Error(), "interrupted after 1 attempt(s)") {
+		t.Errorf("retryStartup = %v, want it interrupted", err)
+	}
+	if elapsed := time.Since(start); elapsed >= startupBackoff {
+		t.Errorf("interrupted after %s, want it before the backoff ends", elapsed)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Params of the list handlers
+const (
+	defaultPageLimit = 500  // Items per page when the request has no limit
+	maxPageLimit     = 5000 // Cap of limit, keeping a page well within the NATS payload limit
+)
+
+// pageCursor is the position of a page, sent to the client as next_cursor: base64 of its
+// JSON, opaque to the client. It holds everything a replica needs to answer the next page,
+// nothing lives in the reader.
+type pageCursor struct {
+	Offset int       `json:"offset"` // Items of the result before the page
+	Now    time.Time `json:"now"`    // When the first page was asked for, anchoring windows relative to now
+}
+
+// page is the part of a result a request asks for, from its limit and cursor params
+type page struct {
+	limit  int
+	offset int
+	now    time.Time // Now for the windows of the request, the same for all its pages
+}
+
+// pageParams returns the page a request of a list handler asks for: the first limit (default
+// 500, at most 5000) items, or those after the position of cursor, a next_cursor of an
+// earlier page of the same request
+func pageParams(params map[string]interface{}) (page, error) {
+	limit, err := intParam(params, "limit", defaultPageLimit)
+	if err != nil {
+		return page{}, err
+	}
+	p := page{limit: limit, now: time.Now()}
+	encoded, err := stringParam(params, "cursor", "")
+	if err != nil || encoded == "" {
+		return p, err
+	}
+	var cursor pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err == nil {
+		err = json.Unmarshal(raw, &cursor)
+	}
+	if err != nil || cursor.Offset <= 0 || cursor.Now.IsZero() {
+		return page{}, fmt.Errorf("cursor: %q is not a next_cursor of this reader", encoded)
+	}
+	p.offset, p.now = cursor.Offset, cursor.Now
+	return p, nil
+}
+
+// fluxParams returns the Flux params limit and offset of the page, asking for one item more
+// than the page holds to tell whether more are left, see respondPage
+func (p page) fluxParams(params map[string]interface{}) map[string]interface{} {
+	params["limit"] = p.limit + 1
+	params["offset"] = p.offset
+	return params
+}
+
+// respondPage returns the success response of a page of a result sliced by Flux, from the
+// items fluxParams asked for: at most limit of them, with a next_cursor if there was one more
+func respondPage[T any](p page, items []T) ReaderResponse {
+	more := len(items) > p.limit
+	if more {
+		items = items[:p.limit]
+	}
+	response := success(items)
+	if more {
+		response.NextCursor = p.next()
+	}
+	return response
+}
+
+// slicePage returns the success response of the page of a whole result, with its
+// total_count and a next_cursor if items are left after the page
+func slicePage[T any](p page, items []T) ReaderResponse {
+	total := len(items)
+	from := min(p.offset, total)
+	to := min(from+p.limit, total)
+	response := success(items[from:to])
+	response.TotalCount = &total
+	if to < total {
+		response.NextCursor = p.next()
+	}
+	return response
+}
+
+// next returns the cursor of the page after p
+func (p page) next() string {
+	raw, _ := json.Marshal(pageCursor{Offset: p.offset + p.limit, Now: p.now})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+)
+
+// slicingInflux answers every query with the page of points its limit and offset params
+// select, as Flux's limit() does
+type slicingInflux struct {
+	points []string // Rows of readingColumns
+	starts []time.Time
+}
+
+func (f *slicingInflux) QueryWithParams(ctx context.Context, flux string, params interface{}) (*api.QueryTableResult, error) {
+	p := params.(map[string]interface{})
+	f.starts = append(f.starts, p["start"].(time.Time))
+	offset, limit := p["offset"].(int), p["limit"].(int)
+	end := min(offset+limit, len(f.points))
+	result := fluxTable(readingColumns, f.points[min(offset, end):end]...)
+	return api.NewQueryTableResult(io.NopCloser(strings.NewReader(result))), nil
+}
+
+// walkPages asks for every page of a request, each from a new reader as if from another
+// replica, and returns the items in order
+func walkPages(t *testing.T, newReader func() *reader, request ReaderRequest) (items []interface{}, pages int) {
+	t.Helper()
+	params := request.Params
+	for {
+		pages++
+		response := newReader().handle(context.Background(), ReaderRequest{QueryType: request.QueryType, Params: params}, time.Now())
+		if response.Status != "success" {
+			t.Fatalf("page %d: %+v", pages, response)
+		}
+		switch data := response.Data.(type) {
+		case []string:
+			for _, item := range data {
+				items = append(items, item)
+			}
+		case []map[string]interface{}:
+			for _, item := range data {
+				items = append(items, item["time"])
+			}
+		}
+		if response.NextCursor == "" {
+			return items, pages
+		}
+		if pages == 10 {
+			t.Fatalf("still paging after %d pages", pages)
+		}
+		params = maps.Clone(request.Params)
+		params["cursor"] = response.NextCursor
+	}
+}
+
+func TestPagingWalksSlicedResults(t *testing.T) {
+	devices := []string{"Storage-01", "Storage-02", "Storage-03", "Storage-04", "Storage-05", "Storage-06", "Storage-07"}
+	influx := &fakeInflux{results: map[string]string{
+		deviceListFlux: fluxTable(tagValueColumns, devices[3], devices[0], devices[6], devices[1], devices[5], devices[2], devices[4]),
+	}}
+	items, pages := walkPages(t, func() *reader { return newTestReader(t, influx) },
+		ReaderRequest{QueryType: "device_list", Params: map[string]interface{}{"limit": 3.0}})
+	if pages != 3 || fmt.Sprint(items) != fmt.Sprint(devices) {
+		t.Errorf("%d page(s) of %v, want 3 pages of %v without duplicates or gaps", pages, items, devices)
+	}
+}
+
+func TestPagingWalksFluxPages(t *testing.T) {
+	var points, want []string
+	for i := range 8 {
+		at := time.Date(2026, 10, 16, 10, i, 0, 0, time.UTC).Format(time.RFC3339)
+		points = append(points, fmt.Sprintf("%s,%d", at, i))
+		want = append(want, at)
+	}
+	influx := &slicingInflux{points: points}
+	items, pages := walkPages(t, func() *reader { return newTestReader(t, influx) }, ReaderRequest{
+		QueryType: "metric_timeseries",
+		Params:    map[string]interface{}{"source_device": "Storage-01", "metric_type": "IOPs", "start": "-10m", "limit": 3.0},
+	})
+	if pages != 3 || fmt.Sprint(items) != fmt.Sprint(want) {
+		t.Errorf("%d page(s) of %v, want 3 pages of %v without duplicates or gaps", pages, items, want)
+	}
+	for i, start := range influx.starts {
+		if !start.Equal(influx.starts[0]) {
+			t.Errorf("page %d starts at %s, want the start of the first page %s", i+1, start, influx.starts[0])
+		}
+	}
+}
+
+func TestPageParamsRejectsForeignCursors(t *testing.T) {
+	for _, cursor := range []string{"bogus", "e30", "eyJvZmZzZXQiOjN9"} { // Not base64 JSON, {}, {"offset":3}
+		if _, err := pageParams(map[string]interface{}{"cursor": cursor}); err == nil || !strings.Contains(err.Error(), "is not a next_cursor") {
+			t.Errorf("pageParams with cursor %q = %v, want it refused", cursor, err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// paramKind is the type of value a param takes
+type paramKind int
+
+const (
+	paramString    paramKind = iota
+	paramNumber              // A JSON number, or a number in a string as the Python reader took
+	paramInt                 // A paramNumber without fraction
+	paramDuration            // A positive Go duration in a string, e.g. 1h30m
+	paramTime                // now, an RFC 3339 timestamp or a relative duration, see parseTimeParam
+	paramTimestamp           // An RFC 3339 timestamp
+	paramBool
+)
+
+// paramSpec describes a param of a query type. Params are validated against the specs of
+// their query type before its handler runs, so that a typo or a value out of range is an
+// error rather than a success answered with the defaults.
+type paramSpec struct {
+	name     string
+	kind     paramKind
+	required bool     // Must be given; required strings must not be empty either
+	positive bool     // Numbers must be above 0
+	max      float64  // Numbers must be at most max, unless 0
+	oneOf    []string // Strings must be one of these, unless empty
+}
+
+// paramError is a param violating its spec, reported in the errors of the response
+type paramError struct {
+	Param      string      `json:"param"`
+	Value      interface{} `json:"value,omitempty"` // As sent, absent for missing params
+	Constraint string      `json:"constraint"`
+}
+
+// commonParams are taken by every query type besides its own params: the client's
+// --page-size sends limit with any query, and query types that do not answer lists answer a
+// single item, within any limit; no_cache bypasses the cache.
+var commonParams = []paramSpec{
+	{name: "limit", kind: paramInt, positive: true, max: maxPageLimit},
+	{name: noCacheParam, kind: paramBool},
+}
+
+// pagingParams are the params of the query types answering lists, see pageParams
+var pagingParams = []paramSpec{
+	{name: "limit", kind: paramInt, positive: true, max: maxPageLimit},
+	{name: "cursor", kind: paramString},
+}
+
+// withPaging returns the specs of a list query type, its own and pagingParams
+func withPaging(specs ...paramSpec) []paramSpec {
+	return append(specs, pagingParams...)
+}
+
+// validateParams checks the params of a request of queryType against its specs and
+// commonParams, returning a paramError for each param that violates its spec, is missing or
+// is not a param of the query type, ordered by param name
+func validateParams(queryType string, specs []paramSpec, params map[string]interface{}) []paramError {
+	known := map[string]paramSpec{}
+	for _, spec := range commonParams {
+		known[spec.name] = spec
+	}
+	for _, spec := range specs {
+		known[spec.name] = spec
+	}
+	var problems []paramError
+	for name, spec := range known {
+		v := params[name]
+		if v == nil || v == "" && spec.required {
+			if spec.required {
+				problems = append(problems, paramError{Param: name, Constraint: "is required"})
+			}
+			continue
+		}
+		if constraint := spec.check(v); constraint != "" {
+			problems = append(problems, paramError{Param: name, Value: v, Constraint: constraint})
+		}
+	}
+	for name, v := range params {
+		if _, ok := known[name]; !ok {
+			problems = append(problems, paramError{Param: name, Value: v, Constraint: fmt.Sprintf("is not a parameter of %s (%s)", queryType, paramNames(known))})
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Param < problems[j].Param })
+	return problems
+}
+
+// check returns the constraint a value violates, or "" if it is valid
+func (s paramSpec) check(v interface{}) string {
+	switch s.kind {
+	case paramNumber, paramInt:
+		var f float64
+		switch v := v.(type) {
+		case float64:
+			f = v
+		case string:
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return "must be a number"
+			}
+			f = parsed
+		default:
+			return "must be a number"
+		}
+		if s.kind == paramInt && f != float64(int(f)) {
+			return "must be an integer"
+		}
+		switch {
+		case s.positive && s.max != 0 && (f <= 0 || f > s.max):
+			if s.kind == paramInt {
+				return fmt.Sprintf("must be between 1 and %g", s.max)
+			}
+			return fmt.Sprintf("must be above 0 and at most %g", s.max)
+		case s.positive && f <= 0:
+			return "must be positive"
+		case s.max != 0 && f > s.max:
+			return fmt.Sprintf("must be at most %g", s.max)
+		}
+		return ""
+	case paramBool:
+		if _, ok := v.(bool); !ok {
+			return "must be true or false"
+		}
+		return ""
+	}
+
+	str, ok := v.(string)
+	if !ok {
+		return "must be a string"
+	}
+	switch s.kind {
+	case paramDuration:
+		if d, err := time.ParseDuration(str); err != nil || d <= 0 {
+			return "must be a positive duration such as 1h or 30m"
+		}
+	case paramTime:
+		if _, err := parseTimeParam(str, time.Now()); err != nil {
+			return "must be now, an RFC 3339 timestamp or a relative duration such as -1h"
+		}
+	case paramTimestamp:
+		if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+			return "must be an RFC 3339 timestamp"
+		}
+	}
+	if len(s.oneOf) > 0 && !slices.Contains(s.oneOf, str) {
+		return "must be one of " + strings.Join(s.oneOf, ", ")
+	}
+	return ""
+}
+
+// invalidParams returns the error response of a request with invalid params: the
+// problems as errors, summed up in the message
+func invalidParams(problems []paramError) ReaderResponse {
+	lines := make([]string, 0, len(problems))
+	for _, p := range problems {
+		if p.Value == nil {
+			lines = append(lines, fmt.Sprintf("%s %s", p.Param, p.Constraint))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: %s, got %v", p.Param, p.Constraint, p.Value))
+		}
+	}
+	return ReaderResponse{Status: "error", Message: "invalid params: " + strings.Join(lines, "; "), Errors: problems}
+}
+
+// paramNames lists the names of the specs, sorted
+func paramNames(specs map[string]paramSpec) string {
+	return "takes " + strings.Join(sortedKeys(specs), ", ")
+}
+
+// sortedKeys returns the keys of m, sorted
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateParams(t *testing.T) {
+	r := newTestReader(t, &fakeInflux{})
+	tests := []struct {
+		queryType string
+		params    map[string]interface{}
+		want      []string // param: constraint of each error, in order
+	}{
+		// Missing
+		{"device_health", map[string]interface{}{}, []string{"source_device: is required"}},
+		{"device_health", map[string]interface{}{"source_device": ""}, []string{"source_device: is required"}},
+		{"metric_summary", map[string]interface{}{}, []string{"metric_type: is required", "source_device: is required"}},
+		{"anomaly_temperature", map[string]interface{}{}, []string{"source_device: is required"}},
+		{"top_devices", map[string]interface{}{}, []string{"metric_type: is required"}},
+		{"metric_timeseries", map[string]interface{}{"metric_type": "IOPs"}, []string{"source_device: is required"}},
+		{"acknowledge", map[string]interface{}{"event_id": "ev-1"}, []string{"acknowledged_by: is required", "timestamp: is required"}},
+
+		// Mistyped
+		{"alerts_critical", map[string]interface{}{"since_minutes": "soon"}, []string{"since_minutes: must be a number"}},
+		{"alerts_critical", map[string]interface{}{"since_minutes": true}, []string{"since_minutes: must be a number"}},
+		{"alerts_critical", map[string]interface{}{"min_criticality": 8.5}, []string{"min_criticality: must be an integer"}},
+		{"device_health", map[string]interface{}{"source_device": 7.0}, []string{"source_device: must be a string"}},
+		{"anomaly_temperature", map[string]interface{}{"source_device": "Storage-01", "threshold": []interface{}{1.0}}, []string{"threshold: must be a number"}},
+		{"top_devices", map[string]interface{}{"metric_type": "DiskTemp", "window": "an hour"}, []string{"window: must be a positive duration such as 1h or 30m"}},
+		{"events_by_type", map[string]interface{}{"since": 3600.0}, []string{"since: must be a string"}},
+		{"metric_timeseries", map[string]interface{}{"source_device": "Storage-01", "metric_type": "IOPs", "stop": "later"}, []string{"stop: must be now, an RFC 3339 timestamp or a relative duration such as -1h"}},
+		{"acknowledge", map[string]interface{}{"event_id": "ev-1", "acknowledged_by": "oncall", "timestamp": "10:30"}, []string{"timestamp: must be an RFC 3339 timestamp"}},
+		{"device_list", map[string]interface{}{"no_cache": "yes"}, []string{"no_cache: must be true or false"}},
+
+		// Out of range
+		{"alerts_critical", map[string]interface{}{"since_minutes": -1.0}, []string{"since_minutes: must be positive"}},
+		{"alerts_critical", map[string]interface{}{"min_criticality": 11.0}, []string{"min_criticality: must be between 1 and 10"}},
+		{"anomaly_temperature", map[string]interface{}{"source_device": "Storage-01", "threshold": 0.0, "window_minutes": -5.0}, []string{"threshold: must be positive", "window_minutes: must be positive"}},
+		{"metric_summary", map[string]interface{}{"source_device": "Storage-01", "metric_type": "IOPs", "window_minutes": 0.0}, []string{"window_minutes: must be positive"}},
+		{"top_devices", map[string]interface{}{"metric_type": "DiskTemp", "window": "-1h"}, []string{"window: must be a positive duration such as 1h or 30m"}},
+		{"top_devices", map[string]interface{}{"metric_type": "DiskTemp", "aggregation": "sum"}, []string{"aggregation: must be one of last, max, mean"}},
+		{"metric_timeseries", map[string]interface{}{"source_device": "Storage-01", "metric_type": "IOPs", "fill": "zero"}, []string{"fill: must be one of omit, null"}},
+		{"device_list", map[string]interface{}{"limit": 0.0}, []string{"limit: must be between 1 and 5000"}},
+		{"events_by_type", map[string]interface{}{"limit": 5001.0}, []string{"limit: must be between 1 and 5000"}},
+		{"device_health", map[string]interface{}{"source_device": "Storage-01", "limit": -3.0}, []string{"limit: must be between 1 and 5000"}},
+
+		// Unknown
+		{"alerts_critical", map[string]interface{}{"since_minute": 30.0}, []string{"since_minute: is not a parameter of alerts_critical (takes cursor, limit, min_criticality, no_cache, since_minutes)"}},
+		{"device_list", map[string]interface{}{"device": "Storage-01"}, []string{"device: is not a parameter of device_list (takes cursor, limit, no_cache)"}},
+
+		// Valid, numbers in strings as the Python reader took them
+		{"alerts_critical", map[string]interface{}{"since_minutes": "30", "min_criticality": 10.0, "limit": 5000.0, "cursor": ""}, nil},
+		{"metric_timeseries", map[string]interface{}{"source_device": "Storage-01", "metric_type": "IOPs", "start": "-7d", "stop": "now", "every": "1h", "fill": "null"}, nil},
+		{"device_health", map[string]interface{}{"source_device": "Storage-01", "limit": 1.0, "no_cache": true}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %v", tt.queryType, tt.params), func(t *testing.T) {
+			var got []string
+			for _, p := range validateParams(tt.queryType, r.handlers[tt.queryType].params, tt.params) {
+				got = append(got, p.Param+": "+p.Constraint)
+				if p.Constraint != "is required" && fmt.Sprint(p.Value) != fmt.Sprint(tt.params[p.Param]) {
+					t.Errorf("error for %s carries the value %v, want %v", p.Param, p.Value, tt.params[p.Param])
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestInvalidParamsRunNoQuery(t *testing.T) {
+	influx := &fakeInflux{}
+	response := newTestReader(t, influx).handle(context.Background(), ReaderRequest{
+		QueryType: "alerts_critical",
+		Params:    map[string]interface{}{"since_minutes": -5.0, "min_criticalty": 9.0},
+	}, time.Now())
+	if response.Status != "error" || len(response.Errors) != 2 {
+		t.Fatalf("response %+v, want two errors", response)
+	}
+	want := "invalid params: min_criticalty: is not a parameter of alerts_critical (takes cursor, limit, min_criticality, no_cache, since_minutes), got 9; since_minutes: must be positive, got -5"
+	if response.Message != want {
+		t.Errorf("message %q, want %q", response.Message, want)
+	}
+	if len(influx.ran()) != 0 {
+		t.Errorf("ran %d queries", len(influx.ran()))
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/nats-io/nats.go"
+)
+
+// ReaderRequest is a query sent by the client on the request subject
+type ReaderRequest struct {
+	RequestID string                 `json:"request_id,omitempty"` // Echoed in the response, so that both logs can be matched
+	QueryType string                 `json:"query_type"`
+	Params    map[string]interface{} `json:"params"`
+}
+
+// ReaderResponse is the reply to a ReaderRequest. Data has the shape the client expects of
+// the query type, see responseSchemas in client-service-go/responses.go.
+type ReaderResponse struct {
+	RequestID  string       `json:"request_id,omitempty"`
+	Status     string       `json:"status"`         // success or error
+	Code       string       `json:"code,omitempty"` // timeout for requests that ran out of time, see queryTimeout
+	Message    string       `json:"message,omitempty"`
+	Data       interface{}  `json:"data,omitempty"`
+	Summary    interface{}  `json:"summary,omitempty"`
+	NextCursor string       `json:"next_cursor,omitempty"` // Set by list handlers when more items are left, see pageParams
+	TotalCount *int         `json:"total_count,omitempty"` // Items of the whole result, when known without extra work
+	Errors     []paramError `json:"errors,omitempty"`      // The invalid params of an error response, see validateParams
+	Cached     bool         `json:"cached,omitempty"`      // Set when the response was answered to an identical request, see responseCache
+	AgeMs      *int64       `json:"age_ms,omitempty"`      // Of a cached response
+}
+
+// fluxQuerier runs parameterized Flux queries; api.QueryAPI implements it, and tests can
+// answer with recorded results through api.NewQueryTableResult.
+type fluxQuerier interface {
+	QueryWithParams(ctx context.Context, query string, params interface{}) (*api.QueryTableResult, error)
+}
+
+// pointWriter writes points; api.WriteAPIBlocking implements it.
+type pointWriter interface {
+	WritePoint(ctx context.Context, point ...*write.Point) error
+}
+
+// queryHandler answers the requests of one query type
+type queryHandler func(ctx context.Context, params map[string]interface{}) (ReaderResponse, error)
+
+// queryDef is a query type the reader answers: its handler and the params it takes
+type queryDef struct {
+	handle queryHandler
+	params []paramSpec
+}
+
+// reader answers ReaderRequests from InfluxDB.
+type reader struct {
+	queries           fluxQuerier
+	writes            pointWriter
+	bucket            string
+	thresholds        healthThresholds // Rate the readings of device_health
+	anomalyMinSamples int              // Readings anomaly_temperature needs for a baseline
+	cache             *responseCache
+	queryTimeout      time.Duration
+	queryTimeouts     map[string]time.Duration // By query type, overriding queryTimeout
+	handlers          map[string]queryDef      // By query type
+}
+
+func newReader(queries fluxQuerier, writes pointWriter, cfg config) *reader {
+	r := &reader{
+		queries:           queries,
+		writes:            writes,
+		bucket:            cfg.influxDBBucket,
+		thresholds:        cfg.thresholds,
+		anomalyMinSamples: cfg.anomalyMinSamples,
+		cache:             newResponseCache(cfg.cacheTTLs, cfg.cacheSize),
+		queryTimeout:      cfg.queryTimeout,
+		queryTimeouts:     cfg.queryTimeouts,
+	}
+	r.handlers = map[string]queryDef{
+		"alerts_critical":     {r.alertsCritical, alertsCriticalParams},
+		"device_health":       {r.deviceHealth, deviceHealthParams},
+		"anomaly_temperature": {r.anomalyTemperature, anomalyTemperatureParams},
+		"metric_summary":      {r.metricSummary, metricSummaryParams},
+		"device_list":         {r.deviceList, deviceListParams},
+		"top_devices":         {r.topDevices, topDevicesParams},
+		"metric_timeseries":   {r.metricTimeseries, metricTimeseriesParams},
+		"events_by_type":      {r.eventsByType, eventsByTypeParams},
+		"acknowledge":         {r.acknowledge, acknowledgeParams},
+	}
+	return r
+}
+
+// supportedTypes lists the query types the reader answers, sorted
+func (r *reader) supportedTypes() string {
+	types := make([]string, 0, len(r.handlers))
+	for queryType := range r.handlers {
+		types = append(types, queryType)
+	}
+	sort.Strings(types)
+	return strings.Join(types, ", ")
+}
+
+// serve answers a request message, received at received, on its reply subject
+func (r *reader) serve(ctx context.Context, m *nats.Msg, received time.Time) {
+	start := time.Now()
+	var request ReaderRequest
+	var response ReaderResponse
+	if err := json.Unmarshal(m.Data, &request); err != nil {
+		log.Printf("ERROR: Failed to unmarshal request: %v. Data: %s", err, string(m.Data))
+		response = errorResponse(fmt.Errorf("invalid request: %v", err))
+	} else {
+		response = r.handle(ctx, request, received)
+	}
+	response.RequestID = request.RequestID
+
+	if m.Reply == "" {
+		log.Printf("WARNING: Request %s (%s) has no reply subject, dropping the response", request.RequestID, request.QueryType)
+		return
+	}
+	payload, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal the response to request %s: %v", request.RequestID, err)
+		payload, _ = json.Marshal(ReaderResponse{RequestID: request.RequestID, Status: "error", Message: "the response could not be encoded"})
+	}
+	if err := m.Respond(payload); err != nil {
+		log.Printf("ERROR: Failed to respond to request %s: %v", request.RequestID, err)
+		return
+	}
+	if response.Status == "error" {
+		log.Printf("Request %s (%s) failed in %s: %s", request.RequestID, request.QueryType, time.Since(start).Round(time.Millisecond), response.Message)
+	} else {
+		cached := ""
+		if response.Cached {
+			cached = " from the cache"
+		}
+		log.Printf("Request %s (%s) answered%s in %s", request.RequestID, request.QueryType, cached, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// handle dispatches a request to the handler of its query type, once its params are valid,
+// unless the cache has its response. The request must be answered within the timeout of its
+// query type from received; its Flux queries are cancelled when it runs out.
+func (r *reader) handle(ctx context.Context, request ReaderRequest, received time.Time) ReaderResponse {
+	def, ok := r.handlers[request.QueryType]
+	if !ok {
+		return errorResponse(fmt.Errorf("unknown query_type %q, supported: %s", request.QueryType, r.supportedTypes()))
+	}
+	timeout := r.timeout(request.QueryType)
+	ctx, cancel := context.WithDeadline(ctx, received.Add(timeout))
+	defer cancel()
+	queued := time.Since(received)
+	if ctx.Err() != nil {
+		return timeoutResponse(request.QueryType, timeout, queued)
+	}
+	params := request.Params
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	if problems := validateParams(request.QueryType, def.params, params); len(problems) > 0 {
+		return invalidParams(problems)
+	}
+	run := func() ReaderResponse {
+		response, err := def.handle(ctx, params)
+		switch {
+		case err == nil:
+			return response
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			return timeoutResponse(request.QueryType, timeout, queued)
+		}
+		return errorResponse(err)
+	}
+	if params[noCacheParam] == true {
+		return run()
+	}
+	response := r.cache.get(ctx, request.QueryType, params, run)
+	if response.Status == "error" && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// Given up waiting for an identical request
+		return timeoutResponse(request.QueryType, timeout, queued)
+	}
+	return response
+}
+
+// timeout returns the timeout of the requests of a query type
+func (r *reader) timeout(queryType string) time.Duration {
+	if timeout, ok := r.queryTimeouts[queryType]; ok {
+		return timeout
+	}
+	return r.queryTimeout
+}
+
+// timeoutResponse returns the error response of a request that ran out of time, having
+// waited for queued before the reader took it up
+func timeoutResponse(queryType string, timeout, queued time.Duration) ReaderResponse {
+	return ReaderResponse{
+		Status:  "error",
+		Code:    "timeout",
+		Message: fmt.Sprintf("%s did not finish within its timeout of %s (%s of it waiting for the reader)", queryType, timeout, queued.Round(time.Millisecond)),
+	}
+}
+
+// success returns a successful response carrying data
+func success(data interface{}) ReaderResponse {
+	return ReaderResponse{Status: "success", Data: data}
+}
+
+// errorResponse returns an error response carrying the message of err
+func errorResponse(err error) ReaderResponse {
+	return ReaderResponse{Status: "error", Message: err.Error()}
+}
+
+// records runs a Flux query and collects its records. The query reads the bucket as
+// params.bucket; values of the request are passed as params too, never spliced into the query.
+func (r *reader) records(ctx context.Context, flux string, params map[string]interface{}) ([]*query.FluxRecord, error) {
+	all := map[string]interface{}{"bucket": r.bucket}
+	for k, v := range params {
+		all[k] = v
+	}
+	result, err := r.queries.QueryWithParams(ctx, flux, all)
+	if err != nil {
+		return nil, fmt.Errorf("querying InfluxDB: %w", err)
+	}
+	defer result.Close()
+	var records []*query.FluxRecord
+	for result.Next() {
+		records = append(records, result.Record())
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("reading the InfluxDB result: %w", err)
+	}
+	return records, nil
+}
+
+// stringParam returns a string param, or def when it is absent
+func stringParam(params map[string]interface{}, name, def string) (string, error) {
+	v, ok := params[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: expected a string, got %v", name, v)
+	}
+	return s, nil
+}
+
+// requiredString returns a string param that must be given and not be empty
+func requiredString(params map[string]interface{}, name string) (string, error) {
+	s, err := stringParam(params, name, "")
+	if err != nil {
+		return "", err
+	}
+	if s == "" {
+		return "", fmt.Errorf("%s is required", name)
+	}
+	return s, nil
+}
+
+// floatParam returns a numeric param, or def when it is absent. Numbers in strings are
+// accepted as well, as the Python reader did.
+func floatParam(params map[string]interface{}, name string, def float64) (float64, error) {
+	v, ok := params[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("%s: expected a number, got %v", name, v)
+}
+
+// intParam returns an integer param, or def when it is absent
+func intParam(params map[string]interface{}, name string, def int) (int, error) {
+	f, err := floatParam(params, name, float64(def))
+	if err != nil {
+		return 0, err
+	}
+	if f != float64(int(f)) {
+		return 0, fmt.Errorf("%s: expected an integer, got %v", name, params[name])
+	}
+	return int(f), nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// fluxCall is a query the fakeInflux ran
+type fluxCall struct {
+	flux   string
+	params map[string]interface{}
+}
+
+// fakeInflux answers Flux queries with recorded results, annotated CSV as InfluxDB sends it,
+// by query; a query without a result fails. It records the queries it ran with their params.
+type fakeInflux struct {
+	results map[string]string
+	err     error // Returned for every query when set
+
+	mu    sync.Mutex
+	calls []fluxCall
+}
+
+func (f *fakeInflux) QueryWithParams(ctx context.Context, flux string, params interface{}) (*api.QueryTableResult, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, fluxCall{flux: flux, params: params.(map[string]interface{})})
+	f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	result, ok := f.results[flux]
+	if !ok {
+		return nil, fmt.Errorf("no recorded result for query:\n%s", flux)
+	}
+	return api.NewQueryTableResult(io.NopCloser(strings.NewReader(result))), nil
+}
+
+// ran returns the queries run so far
+func (f *fakeInflux) ran() []fluxCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fluxCall(nil), f.calls...)
+}
+
+// fakeWriter records the points written
+type fakeWriter struct {
+	mu     sync.Mutex
+	points []*write.Point
+}
+
+func (w *fakeWriter) WritePoint(ctx context.Context, points ...*write.Point) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.points = append(w.points, points...)
+	return nil
+}
+
+// fluxTable returns a result of one table in annotated CSV. columns are name:type pairs
+// such as _value:double or _time:dateTime:RFC3339, rows the comma-separated values.
+func fluxTable(columns []string, rows ...string) string {
+	names, types := make([]string, len(columns)), make([]string, len(columns))
+	for i, column := range columns {
+		names[i], types[i], _ = strings.Cut(column, ":")
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "#datatype,string,long,%s\n", strings.Join(types, ","))
+	fmt.Fprintf(&b, "#group,false,false%s\n", strings.Repeat(",false", len(columns)))
+	fmt.Fprintf(&b, "#default,_result,%s\n", strings.Repeat(",", len(columns)))
+	fmt.Fprintf(&b, ",result,table,%s\n", strings.Join(names, ","))
+	for _, row := range rows {
+		fmt.Fprintf(&b, ",,0,%s\n", row)
+	}
+	return b.String() + "\n"
+}
+
+// emptyResult is the answer of InfluxDB to a query without results
+const emptyResult = "\n"
+
+// newTestReader returns a reader over the fakes with the default thresholds, no cache and
+// a timeout of a few seconds
+func newTestReader(t *testing.T, queries fluxQuerier) *reader {
+	t.Helper()
+	thresholds, err := parseHealthThresholds(defaultHealthThresholds)
+	if err != nil {
+		t.Fatalf("parseHealthThresholds: %v", err)
+	}
+	return newReader(queries, &fakeWriter{}, config{
+		influxDBBucket:    "events",
+		thresholds:        thresholds,
+		anomalyMinSamples: 3,
+		queryTimeout:      5 * time.Second,
+	})
+}
+
+// checkGolden compares got with the golden file testdata/<name>, rewriting it with -update
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the golden file:\n--- got\n%s\n--- want\n%s", name, got, want)
+	}
+}
+
+func TestHandleUnknownQueryType(t *testing.T) {
+	r := newTestReader(t, &fakeInflux{})
+	response := r.handle(context.Background(), ReaderRequest{QueryType: "bogus"}, time.Now())
+	if response.Status != "error" {
+		t.Fatalf("status %q, want error", response.Status)
+	}
+	for _, queryType := range []string{"acknowledge", "alerts_critical", "device_health", "device_list", "events_by_type", "metric_timeseries", "top_devices"} {
+		if !strings.Contains(response.Message, queryType) {
+			t.Errorf("message %q does not list %s", response.Message, queryType)
+		}
+	}
+}
+
+func TestHandleReportsQueryErrors(t *testing.T) {
+	r := newTestReader(t, &fakeInflux{err: errors.New("connection refused")})
+	response := r.handle(context.Background(), ReaderRequest{QueryType: "device_list"}, time.Now())
+	if response.Status != "error" || response.Code != "" || !strings.Contains(response.Message, "connection refused") {
+		t.Fatalf("response %+v, want an error carrying the InfluxDB error", response)
+	}
+}
+
+// blockingInflux is a query API stuck on every query until its context is done, as
+// InfluxDB running a pathological query; it reports the error of the context it saw
+type blockingInflux struct {
+	cancelled chan error
+}
+
+func (f *blockingInflux) QueryWithParams(ctx context.Context, flux string, params interface{}) (*api.QueryTableResult, error) {
+	<-ctx.Done()
+	f.cancelled <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func TestHandleTimesOutSlowQueries(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeouts    map[string]time.Duration
+		queued      time.Duration // Before the reader took the request up
+		wantTimeout time.Duration
+		wantQuery   bool
+	}{
+		{name: "default timeout", wantTimeout: 50 * time.Millisecond, wantQuery: true},
+		{name: "per query type", timeouts: map[string]time.Duration{"device_list": 20 * time.Millisecond}, wantTimeout: 20 * time.Millisecond, wantQuery: true},
+		{name: "other query type", timeouts: map[string]time.Duration{"top_devices": time.Hour}, wantTimeout: 50 * time.Millisecond, wantQuery: true},
+		{name: "queued past the timeout", queued: 60 * time.Millisecond, wantTimeout: 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			influx := &blockingInflux{cancelled: make(chan error, 1)}
+			r := newTestReader(t, influx)
+			r.queryTimeout, r.queryTimeouts = 50*time.Millisecond, tt.timeouts
+
+			start := time.Now()
+			response := r.handle(context.Background(), ReaderRequest{QueryType: "device_list"}, start.Add(-tt.queued))
+			elapsed := time.Since(start)
+			if response.Status != "error" || response.Code != "timeout" || !strings.Contains(response.Message, "within its timeout of "+tt.wantTimeout.String()) {
+				t.Fatalf("response %+v, want a timeout of %s", response, tt.wantTimeout)
+			}
+			if elapsed > tt.wantTimeout+time.Second {
+				t.Errorf("answered after %s, want about %s", elapsed, tt.wantTimeout)
+			}
+			select {
+			case err := <-influx.cancelled:
+				if !tt.wantQuery {
+					t.Errorf("ran a query with no time left")
+				}
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("query context ended with %v, want %v", err, context.DeadlineExceeded)
+				}
+			default:
+				if tt.wantQuery {
+					t.Errorf("query context not cancelled")
+				}
+			}
+		})
+	}
+}
+
+func TestHandleQueueingCountsAgainstTheTimeout(t *testing.T) {
+	influx := &blockingInflux{cancelled: make(chan error, 1)}
+	r := newTestReader(t, influx)
+	r.queryTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	response := r.handle(context.Background(), ReaderRequest{QueryType: "device_list"}, start.Add(-70*time.Millisecond))
+	if elapsed := time.Since(start); response.Code != "timeout" || elapsed >= r.queryTimeout {
+		t.Errorf("response %+v after %s, want a timeout once the 30ms left ran out", response, elapsed)
+	}
+	if !strings.Contains(response.Message, "ms of it waiting for the reader") {
+		t.Errorf("message %q does not report the time queued", response.Message)
+	}
+}
+
+func TestParseQueryDurations(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[string]time.Duration
+		wantErr bool
+	}{
+		{spec: "alerts_critical:5s, metric_timeseries:1m30s", want: map[string]time.Duration{"alerts_critical": 5 * time.Second, "metric_timeseries": 90 * time.Second}},
+		{spec: "none", want: map[string]time.Duration{}},
+		{spec: "", want: map[string]time.Duration{}},
+		{spec: "alerts_critical", wantErr: true},
+		{spec: ":5s", wantErr: true},
+		{spec: "alerts_critical:soon", wantErr: true},
+		{spec: "alerts_critical:-5s", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseQueryDurations(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseQueryDurations(%q) = %v, want error %t", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseQueryDurations(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Params of metric_timeseries
+const (
+	defaultSeriesStart = "-1h"
+	defaultSeriesStop  = "now"
+	defaultSeriesEvery = "1m"
+	maxSeriesPoints    = 10000 // Cap of the points of a response
+)
+
+// seriesEverySteps are the windows suggested when a request asks for too many points
+var seriesEverySteps = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+// metricTimeseriesFlux averages the readings of a metric of a device per window of every, a
+// duration passed as string since Flux params cannot be durations. Windows without readings
+// are left out, or kept with a null value with create_empty.
+const metricTimeseriesFlux = `from(bucket: params.bucket)
+  |> range(start: params.start, stop: params.stop)
+  |> filter(fn: (r) => r._measurement == "device_metrics" and r._field == "value")
+  |> filter(fn: (r) => r.source_device == params.source_device and r.metric_type == params.metric_type)
+  |> group()
+  |> aggregateWindow(every: duration(v: params.every), fn: mean, createEmpty: params.create_empty)
+  |> limit(n: params.limit, offset: params.offset)`
+
+// parseTimeParam parses the start or stop of a time range: "now", an RFC 3339 timestamp or a
+// duration relative to now such as -1h, -90m or -7d (d for days and w for weeks besides the
+// units of Go durations)
+func parseTimeParam(s string, now time.Time) (time.Time, error) {
+	if s == "now" {
+		return now, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	d, err := parseRelativeDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected now, an RFC 3339 timestamp or a relative duration such as -1h, got %q", s)
+	}
+	return now.Add(d), nil
+}
+
+// parseRelativeDuration parses a signed duration such as -1h30m, also taking d for days and
+// w for weeks in its last unit, e.g. -7d
+func parseRelativeDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, ok := strings.CutSuffix(s, suffix); ok {
+			n, err := strconv.Atoi(number)
+			if err != nil || !strings.HasPrefix(number, "-") && !strings.HasPrefix(number, "+") {
+				return 0, fmt.Errorf("invalid relative duration %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	if !strings.HasPrefix(s, "-") && !strings.HasPrefix(s, "+") {
+		return 0, fmt.Errorf("invalid relative duration %q", s)
+	}
+	return time.ParseDuration(s)
+}
+
+// seriesPoints returns how many windows of every a range of span can touch at most: windows
+// are aligned to every, not to the start of the range
+func seriesPoints(span, every time.Duration) int64 {
+	return int64((span+every-1)/every) + 1
+}
+
+// coarserEvery returns the smallest of seriesEverySteps splitting span into at most
+// maxSeriesPoints windows
+func coarserEvery(span time.Duration) time.Duration {
+	for _, step := range seriesEverySteps {
+		if seriesPoints(span, step) <= maxSeriesPoints {
+			return step
+		}
+	}
+	return seriesEverySteps[len(seriesEverySteps)-1]
+}
+
+var metricTimeseriesParams = withPaging(
+	paramSpec{name: "source_device", kind: paramString, required: true},
+	paramSpec{name: "metric_type", kind: paramString, required: true},
+	paramSpec{name: "start", kind: paramTime},
+	paramSpec{name: "stop", kind: paramTime},
+	paramSpec{name: "every", kind: paramDuration},
+	paramSpec{name: "fill", kind: paramString, oneOf: []string{"omit", "null"}},
+)
+
+// metricTimeseries answers metric_timeseries: a page of the means of a metric of a device per
+// window of every (default 1m) from start (default -1h) to stop (default now), as time and
+// value points for graphs. fill is omit (the default) to leave empty windows out or null to
+// keep them with a null value. Ranges of more than maxSeriesPoints windows are refused with
+// a coarser every to use instead.
+func (r *reader) metricTimeseries(ctx context.Context, params map[string]interface{}) (ReaderResponse, error) {
+	device, err := requiredString(params, "source_device")
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	metric, err := requiredString(params, "metric_type")
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	p, err := pageParams(params)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	now := p.now // Relative start and stop are the same range on every page
+	startParam, err := stringParam(params, "start", defaultSeriesStart)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	start, err := parseTimeParam(startParam, now)
+	if err != nil {
+		return ReaderResponse{}, fmt.Errorf("start: %w", err)
+	}
+	stopParam, err := stringParam(params, "stop", defaultSeriesStop)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	stop, err := parseTimeParam(stopParam, now)
+	if err != nil {
+		return ReaderResponse{}, fmt.Errorf("stop: %w", err)
+	}
+	switch {
+	case start.After(now):
+		return ReaderResponse{}, fmt.Errorf("start: %s is in the future", start.UTC().Format(time.RFC3339))
+	case stop.After(now):
+		return ReaderResponse{}, fmt.Errorf("stop: %s is in the future", stop.UTC().Format(time.RFC3339))
+	case !start.Before(stop):
+		return ReaderResponse{}, fmt.Errorf("start: %s must be before stop %s", start.UTC().Format(time.RFC3339), stop.UTC().Format(time.RFC3339))
+	}
+	everyParam, err := stringParam(params, "every", defaultSeriesEvery)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	every, err := time.ParseDuration(everyParam)
+	if err != nil {
+		return ReaderResponse{}, fmt.Errorf("every: %w", err)
+	}
+	fill, err := stringParam(params, "fill", "omit")
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	if windows := seriesPoints(stop.Sub(start), every); windows > maxSeriesPoints {
+		return ReaderResponse{}, fmt.Errorf("every: %s splits the range into up to %d points, more than %d; use every %s or a shorter range", every, windows, maxSeriesPoints, coarserEvery(stop.Sub(start)))
+	}
+
+	records, err := r.records(ctx, metricTimeseriesFlux, p.fluxParams(map[string]interface{}{
+		"start":         start,
+		"stop":          stop,
+		"source_device": device,
+		"metric_type":   metric,
+		"every":         every.String(),
+		"create_empty":  fill == "null",
+	}))
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	points := make([]map[string]interface{}, 0, len(records))
+	for _, rec := range records {
+		points = append(points, map[string]interface{}{
+			"time":  rec.Time().UTC().Format(time.RFC3339Nano),
+			"value": rec.Value(), // nil for empty windows
+		})
+	}
+	return respondPage(p, points), nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeParam(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "now", want: now},
+		{in: "-1h", want: now.Add(-time.Hour)},
+		{in: "-90m", want: now.Add(-90 * time.Minute)},
+		{in: "-1h30m", want: now.Add(-90 * time.Minute)},
+		{in: "-7d", want: now.AddDate(0, 0, -7)},
+		{in: "-2w", want: now.AddDate(0, 0, -14)},
+		{in: "+1d", want: now.AddDate(0, 0, 1)},
+		{in: "2026-10-15T08:30:00Z", want: time.Date(2026, 10, 15, 8, 30, 0, 0, time.UTC)},
+		{in: "2026-10-15T10:30:00.5+02:00", want: time.Date(2026, 10, 15, 8, 30, 0, 5e8, time.UTC)},
+		{in: "1h", wantErr: true},
+		{in: "7d", wantErr: true},
+		{in: "-1.5d", wantErr: true},
+		{in: "-d", wantErr: true},
+		{in: "yesterday", wantErr: true},
+		{in: "2026-10-15", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeParam(tt.in, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTimeParam(%q) = %v, want error %t", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !got.Equal(tt.want) {
+			t.Errorf("parseTimeParam(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMetricTimeseriesValidatesTheRange(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr string
+	}{
+		{name: "start after stop", params: map[string]interface{}{"start": "-1h", "stop": "-2h"}, wantErr: "must be before stop"},
+		{name: "empty range", params: map[string]interface{}{"start": "-1h", "stop": "-1h"}, wantErr: "must be before stop"},
+		{name: "start in the future", params: map[string]interface{}{"start": future}, wantErr: "start: " + future + " is in the future"},
+		{name: "stop in the future", params: map[string]interface{}{"stop": "+1h"}, wantErr: "stop: "},
+		{name: "too many points", params: map[string]interface{}{"start": "-7d", "every": "10s"}, wantErr: "more than 10000; use every 5m0s"},
+		{name: "invalid start", params: map[string]interface{}{"start": "1h"}, wantErr: "start: must be now, an RFC 3339 timestamp or a relative duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			influx := &fakeInflux{}
+			params := map[string]interface{}{"source_device": "Storage-01", "metric_type": "IOPs"}
+			for k, v := range tt.params {
+				params[k] = v
+			}
+			response := newTestReader(t, influx).handle(context.Background(), ReaderRequest{QueryType: "metric_timeseries", Params: params}, time.Now())
+			if response.Status != "error" || !strings.Contains(response.Message, tt.wantErr) {
+				t.Fatalf("response %+v, want an error containing %q", response, tt.wantErr)
+			}
+			if len(influx.ran()) != 0 {
+				t.Errorf("ran %d queries for an invalid range", len(influx.ran()))
+			}
+		})
+	}
+}
+
+func TestMetricTimeseriesFill(t *testing.T) {
+	for _, fill := range []string{"omit", "null"} {
+		t.Run(fill, func(t *testing.T) {
+			result := fluxTable(readingColumns, "2026-10-16T10:01:00Z,5", "2026-10-16T10:03:00Z,7")
+			if fill == "null" {
+				result = fluxTable(readingColumns, "2026-10-16T10:01:00Z,5", "2026-10-16T10:02:00Z,", "2026-10-16T10:03:00Z,7")
+			}
+			influx := &fakeInflux{results: map[string]string{metricTimeseriesFlux: result}}
+			response := newTestReader(t, influx).handle(context.Background(), ReaderRequest{QueryType: "metric_timeseries", Params: map[string]interface{}{
+				"source_device": "Storage-01", "metric_type": "IOPs", "start": "-3m", "fill": fill,
+			}}, time.Now())
+			if response.Status != "success" {
+				t.Fatalf("response %+v, want success", response)
+			}
+			if createEmpty := influx.ran()[0].params["create_empty"]; createEmpty != (fill == "null") {
+				t.Errorf("create_empty %v for fill %s", createEmpty, fill)
+			}
+			points := response.Data.([]map[string]interface{})
+			if fill == "null" {
+				if len(points) != 3 || points[1]["value"] != nil {
+					t.Errorf("points %v, want the empty window with a null value", points)
+				}
+			} else if len(points) != 2 {
+				t.Errorf("points %v, want the empty window left out", points)
+			}
+		})
+	}
+}
+
+func TestCoarserEvery(t *testing.T) {
+	for _, tt := range []struct {
+		span time.Duration
+		want time.Duration
+	}{
+		{time.Hour, time.Second},
+		{24 * time.Hour, 10 * time.Second},
+		{7 * 24 * time.Hour, 5 * time.Minute},
+		{365 * 24 * time.Hour, time.Hour},
+	} {
+		got := coarserEvery(tt.span)
+		if got != tt.want || seriesPoints(tt.span, got) > maxSeriesPoints {
+			t.Errorf("coarserEvery(%s) = %s, want %s", tt.span, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Params of top_devices
+const (
+	defaultTopWindow      = time.Hour
+	defaultTopAggregation = "max"
+	defaultTopLimit       = 10
+	maxTopLimit           = 100 // Cap of limit, whatever the request asks for
+)
+
+// topAggregations are the Flux steps reducing a device's readings to its score, by the name
+// of the aggregation param. last needs the readings of all the device's series in time order.
+var topAggregations = map[string]string{
+	"max":  "max()",
+	"mean": "mean()",
+	"last": `sort(columns: ["_time"])
+  |> last()`,
+}
+
+// topDevicesFlux is the template of top_devices, scoring every device with readings of the
+// metric by the aggregation filled in; ranking happens in the reader, which breaks ties
+const topDevicesFlux = `from(bucket: params.bucket)
+  |> range(start: params.start)
+  |> filter(fn: (r) => r._measurement == "device_metrics" and r._field == "value")
+  |> filter(fn: (r) => r.metric_type == params.metric_type)
+  |> group(columns: ["source_device"])
+  |> %s
+  |> group()`
+
+var topDevicesParams = []paramSpec{
+	{name: "metric_type", kind: paramString, required: true},
+	{name: "window", kind: paramDuration},
+	{name: "aggregation", kind: paramString, oneOf: sortedKeys(topAggregations)},
+	{name: "limit", kind: paramInt, positive: true}, // Capped rather than refused above maxTopLimit
+}
+
+// topDevices answers top_devices: the limit (default 10, at most 100) devices with the
+// highest score, the aggregation (max, the default, mean or last) of their readings of
+// metric_type over the last window (default 1h), highest first and ties by device name
+func (r *reader) topDevices(ctx context.Context, params map[string]interface{}) (ReaderResponse, error) {
+	metric, err := requiredString(params, "metric_type")
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	windowParam, err := stringParam(params, "window", defaultTopWindow.String())
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	window, err := time.ParseDuration(windowParam)
+	if err != nil {
+		return ReaderResponse{}, fmt.Errorf("window: %w", err)
+	}
+	aggregation, err := stringParam(params, "aggregation", defaultTopAggregation)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	limit, err := intParam(params, "limit", defaultTopLimit)
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	capped := limit > maxTopLimit
+	limit = min(limit, maxTopLimit)
+
+	records, err := r.records(ctx, fmt.Sprintf(topDevicesFlux, topAggregations[aggregation]), map[string]interface{}{
+		"start":       time.Now().Add(-window),
+		"metric_type": metric,
+	})
+	if err != nil {
+		return ReaderResponse{}, err
+	}
+	type score struct {
+		device string
+		value  float64
+	}
+	scores := make([]score, 0, len(records))
+	for _, rec := range records {
+		if v, ok := rec.Value().(float64); ok {
+			scores = append(scores, score{device: tag(rec, "source_device"), value: v})
+		}
+	}
+	slices.SortFunc(scores, func(a, b score) int {
+		if a.value != b.value {
+			if a.value > b.value {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.device, b.device)
+	})
+	if len(scores) > limit {
+		scores = scores[:limit]
+	}
+
+	rows := make([]map[string]interface{}, 0, len(scores))
+	for i, s := range scores {
+		rows = append(rows, map[string]interface{}{"rank": i + 1, "source_device": s.device, "score": s.value})
+	}
+	response := success(rows)
+	if capped {
+		response.Message = fmt.Sprintf("limit capped at %d", maxTopLimit)
+	}
+	return response, nil
+}
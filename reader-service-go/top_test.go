@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTopDevices(t *testing.T) {
+	// Scores as InfluxDB would reduce the readings of each aggregation
+	scores := map[string]string{
+		"max":  fluxTable(scoreColumns, "Storage-01,55", "Storage-02,61", "Storage-03,55", "Storage-04,40"),
+		"mean": fluxTable(scoreColumns, "Storage-01,47.5", "Storage-02,44", "Storage-03,50.25", "Storage-04,40"),
+		"last": fluxTable(scoreColumns, "Storage-01,41", "Storage-02,41", "Storage-03,39", "Storage-04,45"),
+	}
+	tests := []struct {
+		aggregation string // "" for the default
+		limit       float64
+		want        string // device=score, best first
+		wantMessage string
+	}{
+		{aggregation: "", want: "Storage-02=61 Storage-01=55 Storage-03=55 Storage-04=40"},
+		{aggregation: "max", limit: 3, want: "Storage-02=61 Storage-01=55 Storage-03=55"},
+		{aggregation: "mean", limit: 2, want: "Storage-03=50.25 Storage-01=47.5"},
+		{aggregation: "last", want: "Storage-04=45 Storage-01=41 Storage-02=41 Storage-03=39"},
+		{aggregation: "last", limit: 500, want: "Storage-04=45 Storage-01=41 Storage-02=41 Storage-03=39", wantMessage: "limit capped at 100"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s limit %g", tt.aggregation, tt.limit), func(t *testing.T) {
+			aggregation := tt.aggregation
+			params := map[string]interface{}{"metric_type": "DiskTemp", "window": "30m"}
+			if aggregation == "" {
+				aggregation = defaultTopAggregation
+			} else {
+				params["aggregation"] = aggregation
+			}
+			if tt.limit != 0 {
+				params["limit"] = tt.limit
+			}
+			flux := fmt.Sprintf(topDevicesFlux, topAggregations[aggregation])
+			influx := &fakeInflux{results: map[string]string{flux: scores[aggregation]}}
+			now := time.Now()
+			response := newTestReader(t, influx).handle(context.Background(), ReaderRequest{QueryType: "top_devices", Params: params}, now)
+			if response.Status != "success" {
+				t.Fatalf("response %+v, want success", response)
+			}
+			if !strings.Contains(flux, "|> "+topAggregations[aggregation]+"\n") {
+				t.Errorf("query does not reduce by %s:\n%s", aggregation, flux)
+			}
+			if got := formatParams(influx.ran()[0].params, now); got != ` bucket="events" metric_type="DiskTemp" start="now-30m0s"` {
+				t.Errorf("params%s", got)
+			}
+			var ranked []string
+			for i, row := range response.Data.([]map[string]interface{}) {
+				if row["rank"] != i+1 {
+					t.Errorf("row %d ranked %v", i, row["rank"])
+				}
+				ranked = append(ranked, fmt.Sprintf("%s=%g", row["source_device"], row["score"]))
+			}
+			if got := strings.Join(ranked, " "); got != tt.want {
+				t.Errorf("ranking %s, want %s", got, tt.want)
+			}
+			if response.Message != tt.wantMessage {
+				t.Errorf("message %q, want %q", response.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestTopDevicesRejectsUnknownAggregation(t *testing.T) {
+	influx := &fakeInflux{}
+	response := newTestReader(t, influx).handle(context.Background(),
+		ReaderRequest{QueryType: "top_devices", Params: map[string]interface{}{"metric_type": "DiskTemp", "aggregation": "median"}}, time.Now())
+	if response.Status != "error" || len(response.Errors) != 1 || response.Errors[0].Constraint != "must be one of last, max, mean" {
+		t.Fatalf("response %+v, want the aggregation refused", response)
+	}
+	if len(influx.ran()) != 0 {
+		t.Errorf("ran %d queries", len(influx.ran()))
+	}
+}
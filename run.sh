@@ -4,8 +4,8 @@ set -e
 
 # --- Configuration ---
 PROJECT_ROOT=$(dirname "$(realpath "$0")") # Get the directory where the script is located
-GO_SERVICES=("daemon-service-go" "writer-service-go" "client-service-go") # List of Go services
-PYTHON_SERVICES=("reader-service-py") # List of Python services
+GO_SERVICES=("daemon-service-go" "writer-service-go" "reader-service-go" "client-service-go") # List of Go services
+PYTHON_SERVICES=() # List of Python services
 ALL_SERVICES=("${GO_SERVICES[@]}" "${PYTHON_SERVICES[@]}")
 
 # --- Functions ---
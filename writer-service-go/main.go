@@ -7,40 +7,100 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"github.com/nats-io/nats.go"
 )
 
 // Constants for default configuration and subject names
 const (
 	defaultNatsURL      = "nats://nats:4222"
-	natsSubjectWildcard = "events.*"           // Wildcard to subscribe to all event types (events.security, events.metrics)
+	natsSubjectWildcard = "events.*"           // Wildcard to subscribe to all event types (events.event, events.security, events.metrics, events.summary, events.ack and the daemon's dedicated event subjects)
 	natsQueueGroup      = "writer_queue_group" // NATS queue group for distributed consumption
 	defaultInfluxDBHost = "http://influxdb:8086"
-	eventsMeasurement   = "events"         // InfluxDB measurement for all generic events (e.g., DriveFailure, UnauthorizedAccess)
-	metricsMeasurement  = "device_metrics" // InfluxDB measurement for device metrics (e.g., DiskTemp, IOPs)
+	eventsMeasurement   = "events"          // InfluxDB measurement for all generic events (e.g., DriveFailure, UnauthorizedAccess)
+	metricsMeasurement  = "device_metrics"  // InfluxDB measurement for device metrics (e.g., DiskTemp, IOPs)
+	summaryMeasurement  = "daemon_summary"  // InfluxDB measurement for the daemon's rollup summaries
+	ackMeasurement      = "acknowledgments" // InfluxDB measurement for the event acknowledgments of operators
+
+	supportedSchemaVersion = 2                     // Newest payload version this writer understands
+	schemaVersionHeader    = "Nats-Schema-Version" // Header carrying the payload version, absent on older producers
+
+	defaultHardwareTagLimit = 50      // Default number of distinct values each of the model and firmware tags takes
+	maxHardwareTagLength    = 64      // Longer models and firmware versions are never used as tag values
+	otherHardwareTag        = "other" // Tag value of the models and firmware versions beyond the limit
 )
 
+// hardwareTags guards the series cardinality of the model and firmware tags, see hardwareTagGuard
+var hardwareTags = newHardwareTagGuard(defaultHardwareTagLimit)
+
+// warnedSchemaVersions remembers the unsupported schema versions already reported, so the log is not flooded
+var warnedSchemaVersions sync.Map
+
 // Event represents a generic event, including security events (matches daemon-go's structure more closely)
 type Event struct {
-	ID           string `json:"id"`
-	Criticality  int    `json:"criticality"`
-	Timestamp    string `json:"timestamp"`
-	SourceDevice string `json:"sourceDevice"`
-	EventType    string `json:"eventType"`
-	EventMessage string `json:"eventMessage"` // Added field for the event message
+	SchemaVersion int    `json:"schemaVersion,omitempty"` // Payload version, absent (version 1) on older producers
+	ID            string `json:"id"`
+	Criticality   int    `json:"criticality"`
+	Timestamp     string `json:"timestamp"`
+	SourceDevice  string `json:"sourceDevice"`
+	ParentDevice  string `json:"parentDevice,omitempty"` // Optional enclosure of the source device
+	EventType     string `json:"eventType"`
+	EventMessage  string `json:"eventMessage"`            // Added field for the event message
+	Status        string `json:"status,omitempty"`        // Optional "open" or "resolved" of incidents that can be resolved
+	CorrelationID string `json:"correlationId,omitempty"` // Optional ID pairing a resolved event with the open one
+	Model         string `json:"model,omitempty"`         // Optional hardware model of the source device
+	Firmware      string `json:"firmware,omitempty"`      // Optional firmware version of the source device
+	Backfill      bool   `json:"backfill,omitempty"`      // Set on history the daemon synthesized on startup
 }
 
 // DeviceMetric represents a device metric (compact structure)
 type DeviceMetric struct {
-	Timestamp    string  `json:"timestamp"`
-	SourceDevice string  `json:"sourceDevice"`
-	MetricType   string  `json:"metricType"`
-	Value        float64 `json:"value"`
+	SchemaVersion int     `json:"schemaVersion,omitempty"` // Payload version, absent (version 1) on older producers
+	Timestamp     string  `json:"timestamp"`
+	SourceDevice  string  `json:"sourceDevice"`
+	ParentDevice  string  `json:"parentDevice,omitempty"` // Optional enclosure of the source device
+	MetricType    string  `json:"metricType"`
+	Value         float64 `json:"value"`
+	Unit          string  `json:"unit,omitempty"`     // Optional unit of the value (e.g., °C, %)
+	Model         string  `json:"model,omitempty"`    // Optional hardware model of the source device
+	Firmware      string  `json:"firmware,omitempty"` // Optional firmware version of the source device
+	Backfill      bool    `json:"backfill,omitempty"` // Set on history the daemon synthesized on startup
+}
+
+// RollupSummary represents the daemon's periodic aggregate of one window (events.summary)
+type RollupSummary struct {
+	SchemaVersion int                     `json:"schemaVersion"`
+	Final         bool                    `json:"final"`
+	WindowStart   string                  `json:"windowStart"`
+	WindowEnd     string                  `json:"windowEnd"`
+	Devices       map[string]uint64       `json:"devices"` // Metrics emitted per device
+	Metrics       map[string]MetricRollup `json:"metrics"` // Value statistics per metric type
+	Events        map[string]uint64       `json:"events"`  // Events emitted per event type
+}
+
+// MetricRollup represents the value statistics of one metric type in a rollup summary
+type MetricRollup struct {
+	Count uint64  `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+}
+
+// Acknowledgment represents an operator acknowledging an event (events.ack), as published by the client
+type Acknowledgment struct {
+	SchemaVersion  int    `json:"schemaVersion"`
+	EventID        string `json:"eventId"`
+	AcknowledgedBy string `json:"acknowledgedBy"`
+	Note           string `json:"note,omitempty"`
+	Timestamp      string `json:"timestamp"`
 }
 
 func init() {
@@ -81,6 +141,14 @@ func main() {
 		log.Fatalf("InfluxDB token, organization, or bucket environment variables are not set. Please check your .env file.")
 	}
 
+	if limit := os.Getenv("HARDWARE_TAG_LIMIT"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			log.Fatalf("Invalid HARDWARE_TAG_LIMIT %q: must be a non-negative number of tag values", limit)
+		}
+		hardwareTags = newHardwareTagGuard(n)
+	}
+
 	// 2. Connect to NATS
 	nc, err := nats.Connect(natsURL)
 	if err != nil {
@@ -112,13 +180,17 @@ func main() {
 	// 4. Subscribe to NATS subject(s) using a wildcard and a queue group
 	_, err = nc.QueueSubscribe(natsSubjectWildcard, natsQueueGroup, func(m *nats.Msg) {
 		go func(m *nats.Msg) {
+			checkSchemaVersion(m)
 			switch m.Subject {
-			case "events.event":
-				handleEvent(ctx, m.Data, writeAPI)
 			case "events.metrics":
 				handleDeviceMetric(ctx, m.Data, writeAPI)
+			case "events.summary":
+				handleSummary(ctx, m.Data, writeAPI)
+			case "events.ack":
+				handleAck(ctx, m.Data, writeAPI)
 			default:
-				log.Printf("Received unknown message type on subject: %s", m.Subject)
+				// events.event, events.security and the subjects the daemon routes event types to (eventSubjects)
+				handleEvent(ctx, m.Data, writeAPI)
 			}
 		}(m) // передаём m внутрь горутины
 	})
@@ -134,6 +206,29 @@ func main() {
 	log.Println("Writer Service (Go): Shutting down.")
 }
 
+// checkSchemaVersion reports payloads newer than this writer understands. They are still
+// decoded: versions only ever add optional fields, which older writers simply ignore.
+func checkSchemaVersion(m *nats.Msg) {
+	version := 1
+	if header := m.Header.Get(schemaVersionHeader); header != "" {
+		if v, err := strconv.Atoi(header); err == nil {
+			version = v
+		}
+	} else {
+		var payload struct {
+			SchemaVersion int `json:"schemaVersion"`
+		}
+		if json.Unmarshal(m.Data, &payload) == nil && payload.SchemaVersion > 0 {
+			version = payload.SchemaVersion
+		}
+	}
+	if version > supportedSchemaVersion {
+		if _, warned := warnedSchemaVersions.LoadOrStore(version, true); !warned {
+			log.Printf("WARNING: Received schema version %d on %s, newer than the supported version %d. Decoding known fields only.", version, m.Subject, supportedSchemaVersion)
+		}
+	}
+}
+
 // handleEvent processes and writes a generic event to InfluxDB
 func handleEvent(ctx context.Context, data []byte, writeAPI api.WriteAPIBlocking) {
 	var event Event // Use the updated Event struct
@@ -155,6 +250,19 @@ func handleEvent(ctx context.Context, data []byte, writeAPI api.WriteAPIBlocking
 									AddTag("event_type", event.EventType).
 									AddField("event_message", event.EventMessage). // Add EventMessage as a field
 									SetTime(parsedTime)
+	addHardwareTags(p, event.Model, event.Firmware)
+	if event.CorrelationID != "" {
+		p.AddTag("correlation_id", event.CorrelationID)
+	}
+	if event.Status != "" {
+		p.AddField("status", event.Status)
+	}
+	if event.ParentDevice != "" {
+		p.AddTag("parent_device", event.ParentDevice) // Only disks inside an enclosure have a parent
+	}
+	if event.Backfill {
+		p.AddTag("backfill", "true") // Live data carries no tag, so existing queries are unaffected
+	}
 
 	if err := writeAPI.WritePoint(ctx, p); err != nil {
 		log.Printf("ERROR: Failed to write event ID %s to InfluxDB: %v", event.ID, err)
@@ -182,6 +290,16 @@ func handleDeviceMetric(ctx context.Context, data []byte, writeAPI api.WriteAPIB
 		AddTag("metric_type", metric.MetricType).
 		AddField("value", metric.Value). // Numerical values are typically fields
 		SetTime(parsedTime)
+	if metric.Unit != "" {
+		p.AddTag("unit", metric.Unit) // Older producers send no unit, so the tag is only set when present
+	}
+	addHardwareTags(p, metric.Model, metric.Firmware)
+	if metric.ParentDevice != "" {
+		p.AddTag("parent_device", metric.ParentDevice) // Only disks inside an enclosure have a parent
+	}
+	if metric.Backfill {
+		p.AddTag("backfill", "true") // Live data carries no tag, so existing queries are unaffected
+	}
 
 	if err := writeAPI.WritePoint(ctx, p); err != nil {
 		log.Printf("ERROR: Failed to write device metric for %s/%s to InfluxDB: %v", metric.SourceDevice, metric.MetricType, err)
@@ -189,3 +307,155 @@ func handleDeviceMetric(ctx context.Context, data []byte, writeAPI api.WriteAPIB
 		log.Printf("Successfully wrote device metric for %s/%s (Value: %.2f) to InfluxDB.", metric.SourceDevice, metric.MetricType, metric.Value)
 	}
 }
+
+// handleSummary writes a rollup summary to InfluxDB as one point per metric type, event
+// type and device, all stamped with the end of the window. The window start is kept as a
+// field so partial final windows can be told apart by their length.
+func handleSummary(ctx context.Context, data []byte, writeAPI api.WriteAPIBlocking) {
+	var summary RollupSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		log.Printf("ERROR: Failed to unmarshal rollup summary: %v. Data: %s", err, string(data))
+		return
+	}
+
+	windowEnd, err := time.Parse(time.RFC3339Nano, summary.WindowEnd)
+	if err != nil {
+		log.Printf("ERROR: Failed to parse rollup summary window end '%s': %v", summary.WindowEnd, err)
+		return
+	}
+
+	newPoint := func(kind string) *write.Point {
+		return influxdb2.NewPointWithMeasurement(summaryMeasurement).
+			AddTag("kind", kind).
+			AddTag("final", strconv.FormatBool(summary.Final)).
+			AddField("window_start", summary.WindowStart).
+			SetTime(windowEnd)
+	}
+	points := make([]*write.Point, 0, len(summary.Metrics)+len(summary.Events)+len(summary.Devices))
+	for metricType, stats := range summary.Metrics {
+		points = append(points, newPoint("metric").
+			AddTag("metric_type", metricType).
+			AddField("count", stats.Count).
+			AddField("min", stats.Min).
+			AddField("max", stats.Max).
+			AddField("mean", stats.Mean))
+	}
+	for eventType, count := range summary.Events {
+		points = append(points, newPoint("event").AddTag("event_type", eventType).AddField("count", count))
+	}
+	for device, count := range summary.Devices {
+		points = append(points, newPoint("device").AddTag("source_device", device).AddField("metrics", count))
+	}
+	if len(points) == 0 {
+		return // Nothing was generated in the window
+	}
+
+	if err := writeAPI.WritePoint(ctx, points...); err != nil {
+		log.Printf("ERROR: Failed to write rollup summary ending %s to InfluxDB: %v", summary.WindowEnd, err)
+	} else {
+		log.Printf("Successfully wrote rollup summary ending %s (%d point(s), final: %t) to InfluxDB.", summary.WindowEnd, len(points), summary.Final)
+	}
+}
+
+// handleAck writes an acknowledgment to InfluxDB, stamped with the time it was given. The
+// reader records the same point when the client asks it to, so whichever arrives second
+// simply overwrites the first.
+func handleAck(ctx context.Context, data []byte, writeAPI api.WriteAPIBlocking) {
+	var ack Acknowledgment
+	if err := json.Unmarshal(data, &ack); err != nil {
+		log.Printf("ERROR: Failed to unmarshal acknowledgment: %v. Data: %s", err, string(data))
+		return
+	}
+	if ack.EventID == "" || ack.AcknowledgedBy == "" {
+		log.Printf("ERROR: Acknowledgment without an event ID or acknowledger. Data: %s", string(data))
+		return
+	}
+
+	parsedTime, err := time.Parse(time.RFC3339Nano, ack.Timestamp)
+	if err != nil {
+		log.Printf("ERROR: Failed to parse acknowledgment timestamp '%s': %v", ack.Timestamp, err)
+		return
+	}
+
+	p := influxdb2.NewPointWithMeasurement(ackMeasurement).
+		AddTag("event_id", ack.EventID).
+		AddField("acknowledged_by", ack.AcknowledgedBy).
+		AddField("note", ack.Note).
+		SetTime(parsedTime)
+
+	if err := writeAPI.WritePoint(ctx, p); err != nil {
+		log.Printf("ERROR: Failed to write acknowledgment of event ID %s to InfluxDB: %v", ack.EventID, err)
+	} else {
+		log.Printf("Successfully wrote acknowledgment of event ID %s by %s to InfluxDB.", ack.EventID, ack.AcknowledgedBy)
+	}
+}
+
+// addHardwareTags tags a point with the device model and firmware when the producer sent them,
+// within the cardinality guard of hardwareTags. The firmware tag only holds the major.minor
+// version; the full version is kept in the firmware_version field, and a model beyond the
+// guard in the model_name field.
+func addHardwareTags(p *write.Point, model, firmware string) {
+	if model != "" {
+		tag := hardwareTags.value("model", model)
+		p.AddTag("model", tag)
+		if tag != model {
+			p.AddField("model_name", model)
+		}
+	}
+	if firmware != "" {
+		p.AddTag("firmware", hardwareTags.value("firmware", firmwareRelease(firmware)))
+		p.AddField("firmware_version", firmware)
+	}
+}
+
+// firmwareRelease returns the major.minor part of a dotted firmware version, e.g. 4.2 of
+// 4.2.1, and other versions as they are
+func firmwareRelease(firmware string) string {
+	if parts := strings.SplitN(firmware, ".", 3); len(parts) == 3 {
+		return parts[0] + "." + parts[1]
+	}
+	return firmware
+}
+
+// hardwareTagGuard bounds the values of the hardware tags: each tag takes the first limit
+// distinct values it sees, later values and those longer than maxHardwareTagLength are
+// tagged otherHardwareTag. A misconfigured producer sending e.g. serial numbers as models
+// thus adds at most limit series per tag. It is safe for concurrent use by the handlers.
+type hardwareTagGuard struct {
+	limit int
+
+	mu     sync.Mutex
+	values map[string]map[string]bool // Values let through, by tag
+	full   map[string]bool            // Tags already reported full
+}
+
+func newHardwareTagGuard(limit int) *hardwareTagGuard {
+	return &hardwareTagGuard{limit: limit, values: map[string]map[string]bool{}, full: map[string]bool{}}
+}
+
+// value returns the value to store in the tag for v: v itself while the tag is within the
+// limit, otherwise otherHardwareTag, reporting once per tag that it is full
+func (g *hardwareTagGuard) value(tag, v string) string {
+	if len(v) > maxHardwareTagLength {
+		return otherHardwareTag
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	seen := g.values[tag]
+	if seen == nil {
+		seen = map[string]bool{}
+		g.values[tag] = seen
+	}
+	if seen[v] {
+		return v
+	}
+	if len(seen) >= g.limit {
+		if !g.full[tag] {
+			g.full[tag] = true
+			log.Printf("WARNING: Tag '%s' reached its limit of %d distinct values (HARDWARE_TAG_LIMIT); further values are tagged '%s'.", tag, g.limit, otherHardwareTag)
+		}
+		return otherHardwareTag
+	}
+	seen[v] = true
+	return v
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// recordingWriteAPI is a blocking write API keeping the written points
+type recordingWriteAPI struct {
+	points []*write.Point
+}
+
+func (w *recordingWriteAPI) WriteRecord(context.Context, ...string) error { return nil }
+func (w *recordingWriteAPI) EnableBatching()                              {}
+func (w *recordingWriteAPI) Flush(context.Context) error                  { return nil }
+
+func (w *recordingWriteAPI) WritePoint(_ context.Context, points ...*write.Point) error {
+	w.points = append(w.points, points...)
+	return nil
+}
+
+// pointTags returns the tags of a point by key
+func pointTags(p *write.Point) map[string]string {
+	tags := map[string]string{}
+	for _, tag := range p.TagList() {
+		tags[tag.Key] = tag.Value
+	}
+	return tags
+}
+
+func TestFirmwareRelease(t *testing.T) {
+	tests := []struct {
+		firmware, want string
+	}{
+		{"4.2.1", "4.2"},
+		{"5.0.2-rc1", "5.0"},
+		{"2024.06", "2024.06"},
+		{"FW24A", "FW24A"},
+		{"1.2.3.4", "1.2"},
+	}
+	for _, tt := range tests {
+		if got := firmwareRelease(tt.firmware); got != tt.want {
+			t.Errorf("firmwareRelease(%q) = %q, want %q", tt.firmware, got, tt.want)
+		}
+	}
+}
+
+func TestHardwareTagGuardLimitsDistinctValues(t *testing.T) {
+	g := newHardwareTagGuard(2)
+	steps := []struct {
+		tag, value, want string
+	}{
+		{"model", "SA-4000", "SA-4000"},
+		{"model", "SA-5200", "SA-5200"},
+		{"model", "SA-7000X", otherHardwareTag}, // Third distinct model
+		{"model", "SA-4000", "SA-4000"},         // Seen values stay
+		{"firmware", "4.2", "4.2"},              // Every tag has its own limit
+		{"model", strings.Repeat("x", maxHardwareTagLength+1), otherHardwareTag},
+	}
+	for i, s := range steps {
+		if got := g.value(s.tag, s.value); got != s.want {
+			t.Errorf("step %d: value(%q, %q) = %q, want %q", i, s.tag, s.value, got, s.want)
+		}
+	}
+}
+
+func TestAddHardwareTags(t *testing.T) {
+	defer func(guard *hardwareTagGuard) { hardwareTags = guard }(hardwareTags)
+	hardwareTags = newHardwareTagGuard(1)
+
+	tests := []struct {
+		name            string
+		model, firmware string
+		wantTags        map[string]string
+		wantFields      map[string]interface{}
+	}{
+		{
+			name:       "firmware reduced to its release",
+			model:      "SA-4000",
+			firmware:   "4.2.1",
+			wantTags:   map[string]string{"model": "SA-4000", "firmware": "4.2"},
+			wantFields: map[string]interface{}{"firmware_version": "4.2.1"},
+		},
+		{
+			name:       "model beyond the limit kept as field",
+			model:      "SA-5200",
+			firmware:   "4.2.7",
+			wantTags:   map[string]string{"model": otherHardwareTag, "firmware": "4.2"},
+			wantFields: map[string]interface{}{"model_name": "SA-5200", "firmware_version": "4.2.7"},
+		},
+		{
+			name:       "nothing sent",
+			wantTags:   map[string]string{},
+			wantFields: map[string]interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := influxdb2.NewPointWithMeasurement(metricsMeasurement)
+			addHardwareTags(p, tt.model, tt.firmware)
+
+			tags := pointTags(p)
+			fields := map[string]interface{}{}
+			for _, field := range p.FieldList() {
+				fields[field.Key] = field.Value
+			}
+			if len(tags) != len(tt.wantTags) || len(fields) != len(tt.wantFields) {
+				t.Fatalf("tags %v, fields %v, want %v and %v", tags, fields, tt.wantTags, tt.wantFields)
+			}
+			for k, v := range tt.wantTags {
+				if tags[k] != v {
+					t.Errorf("tag %s = %q, want %q", k, tags[k], v)
+				}
+			}
+			for k, v := range tt.wantFields {
+				if fields[k] != v {
+					t.Errorf("field %s = %v, want %v", k, fields[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleDeviceMetricUnitTag(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		wantUnit string // Empty when the point must not carry the tag
+	}{
+		{
+			name:     "with metadata",
+			payload:  `{"schemaVersion":2,"timestamp":"2025-01-01T00:00:00Z","sourceDevice":"StorageArray-0001","metricType":"DiskTemp","value":41.5,"unit":"°C","precision":1}`,
+			wantUnit: "°C",
+		},
+		{
+			name:    "without metadata",
+			payload: `{"schemaVersion":2,"timestamp":"2025-01-01T00:00:00Z","sourceDevice":"StorageArray-0001","metricType":"DiskTemp","value":41.5}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &recordingWriteAPI{}
+			handleDeviceMetric(context.Background(), []byte(tt.payload), w)
+			if len(w.points) != 1 {
+				t.Fatalf("wrote %d point(s), want 1", len(w.points))
+			}
+			tags := pointTags(w.points[0])
+			if unit, ok := tags["unit"]; unit != tt.wantUnit || ok != (tt.wantUnit != "") {
+				t.Errorf("unit tag = %q (present %t), want %q", unit, ok, tt.wantUnit)
+			}
+			if tags["metric_type"] != "DiskTemp" || tags["source_device"] != "StorageArray-0001" {
+				t.Errorf("tags %v, want the metric type and source device", tags)
+			}
+		})
+	}
+}
+
+func TestHandleAck(t *testing.T) {
+	w := &recordingWriteAPI{}
+	handleAck(context.Background(), []byte(`{"schemaVersion":1,"eventId":"0b8e4c2a-5f0e-4d3b-9a61-2c7f1e9d8a34","acknowledgedBy":"alice","note":"INC-42","timestamp":"2026-10-16T10:30:00.123456789Z"}`), w)
+	if len(w.points) != 1 {
+		t.Fatalf("wrote %d point(s), want 1", len(w.points))
+	}
+	p := w.points[0]
+	fields := map[string]interface{}{}
+	for _, field := range p.FieldList() {
+		fields[field.Key] = field.Value
+	}
+	if p.Name() != ackMeasurement || pointTags(p)["event_id"] != "0b8e4c2a-5f0e-4d3b-9a61-2c7f1e9d8a34" ||
+		fields["acknowledged_by"] != "alice" || fields["note"] != "INC-42" || p.Time().Nanosecond() != 123456789 {
+		t.Errorf("point %s %v %v at %s, want the acknowledgment at its own time", p.Name(), pointTags(p), fields, p.Time())
+	}
+
+	for _, payload := range []string{
+		`{"eventId":"0b8e4c2a-5f0e-4d3b-9a61-2c7f1e9d8a34","acknowledgedBy":"","timestamp":"2026-10-16T10:30:00Z"}`,
+		`{"acknowledgedBy":"alice","timestamp":"2026-10-16T10:30:00Z"}`,
+		`{"eventId":"0b8e4c2a-5f0e-4d3b-9a61-2c7f1e9d8a34","acknowledgedBy":"alice","timestamp":"10:30"}`,
+		`not json`,
+	} {
+		w := &recordingWriteAPI{}
+		handleAck(context.Background(), []byte(payload), w)
+		if len(w.points) != 0 {
+			t.Errorf("wrote %d point(s) of %s", len(w.points), payload)
+		}
+	}
+}